@@ -0,0 +1,276 @@
+package adctest
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+// DefaultTimeout is the default time a virtual client waits for a packet from the hub.
+const DefaultTimeout = 5 * time.Second
+
+// Client is a scripted virtual ADC client used to test hub implementations.
+//
+// Client writes raw lines to the connection, so it can send malformed input that a
+// regular client would never produce. All methods fail the test on unexpected results.
+type Client struct {
+	tb   testing.TB
+	conn net.Conn
+	c    *adc.Conn
+
+	// Timeout is the time the client waits for the next packet from the hub.
+	Timeout time.Duration
+
+	SID  adc.SID
+	PID  types.PID
+	CID  types.CID
+	Name string
+}
+
+// NewClient creates a virtual client on the connection. The connection is closed when
+// the client is closed.
+func NewClient(tb testing.TB, conn net.Conn) *Client {
+	tb.Helper()
+	c, err := adc.NewConn(conn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pid := types.NewPID()
+	return &Client{
+		tb: tb, conn: conn, c: c,
+		Timeout: DefaultTimeout,
+		PID:     pid,
+		CID:     pid.Hash(),
+	}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+// Send writes a raw line to the hub. Line delimiter is added if necessary.
+func (c *Client) Send(line string) {
+	c.tb.Helper()
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	c.SendRaw([]byte(line))
+}
+
+// SendRaw writes raw bytes to the hub.
+func (c *Client) SendRaw(b []byte) {
+	c.tb.Helper()
+	c.conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	if _, err := c.conn.Write(b); err != nil {
+		c.tb.Fatalf("%s: cannot write: %v", c.name(), err)
+	}
+}
+
+// SendMsg encodes the message as a packet with a given kind ('H', 'B', etc) and sends it.
+// The client SID is used as a source for routed packets.
+func (c *Client) SendMsg(kind byte, msg adc.Message, targ ...adc.SID) {
+	c.tb.Helper()
+	data, err := adc.Marshal(msg)
+	if err != nil {
+		c.tb.Fatal(err)
+	}
+	line := string(kind) + msg.Cmd().String()
+	switch kind {
+	case 'H', 'I', 'C':
+	default:
+		line += " " + c.SID.String()
+		for _, s := range targ {
+			line += " " + s.String()
+		}
+	}
+	if len(data) != 0 {
+		line += " " + string(data)
+	}
+	c.Send(line)
+}
+
+func (c *Client) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.conn.LocalAddr().String()
+}
+
+// Read reads the next packet from the hub.
+func (c *Client) Read() (adc.Packet, error) {
+	return c.c.ReadPacket(time.Now().Add(c.Timeout))
+}
+
+// Expect skips all packets until it finds one with a given command and kind, and returns it.
+// Kind may be zero to accept any kind.
+func (c *Client) Expect(kind byte, cmd string) adc.Packet {
+	c.tb.Helper()
+	for {
+		p, err := c.Read()
+		if err != nil {
+			c.tb.Fatalf("%s: waiting for %c%s: %v", c.name(), kind, cmd, err)
+		}
+		if p.Message().Type.String() == cmd && (kind == 0 || p.Kind() == kind) {
+			return p
+		}
+	}
+}
+
+// ExpectStatus skips all packets until the hub sends a status message, and returns it.
+func (c *Client) ExpectStatus() adc.Status {
+	c.tb.Helper()
+	p := c.Expect(0, adc.Status{}.Cmd().String())
+	var st adc.Status
+	if err := adc.Unmarshal(p.Message().Data, &st); err != nil {
+		c.tb.Fatalf("%s: cannot decode status: %v", c.name(), err)
+	}
+	return st
+}
+
+// ExpectError waits for a fatal status message with a given code and expects the hub to close the connection.
+func (c *Client) ExpectError(code int) {
+	c.tb.Helper()
+	st := c.ExpectStatus()
+	if st.Sev != adc.Fatal || st.Code != code {
+		c.tb.Fatalf("%s: expected fatal error %d, got: %d%02d %q", c.name(), code, st.Sev, st.Code, st.Msg)
+	}
+	c.ExpectClosed()
+}
+
+// ExpectClosed reads and discards all packets until the hub closes the connection.
+// The test fails if the connection is still open after the timeout.
+func (c *Client) ExpectClosed() {
+	c.tb.Helper()
+	deadline := time.Now().Add(c.Timeout)
+	for {
+		_, err := c.c.ReadPacket(deadline)
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			c.tb.Fatalf("%s: expected the hub to close the connection", c.name())
+		} else if err != nil {
+			return
+		}
+	}
+}
+
+// ExpectNoChat checks that the hub doesn't deliver any chat messages from a given SID for the duration.
+func (c *Client) ExpectNoChat(from adc.SID, dt time.Duration) {
+	c.tb.Helper()
+	deadline := time.Now().Add(dt)
+	for {
+		p, err := c.c.ReadPacket(deadline)
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return
+		} else if err != nil {
+			c.tb.Fatalf("%s: unexpected error: %v", c.name(), err)
+		}
+		if p.Message().Type != (adc.ChatMessage{}).Cmd() {
+			continue
+		}
+		if p, ok := p.(adc.PeerPacket); ok && p.Source() == from {
+			c.tb.Fatalf("%s: unexpected message from %v", c.name(), from)
+		}
+	}
+}
+
+// Protocol sends supported features and waits for the session ID.
+func (c *Client) Protocol(fea ...adc.Feature) {
+	c.tb.Helper()
+	if len(fea) == 0 {
+		fea = []adc.Feature{adc.FeaBASE, adc.FeaTIGR}
+	}
+	sup := adc.ModFeatures{}
+	for _, f := range fea {
+		sup[f] = true
+	}
+	c.SendMsg('H', adc.Supported{Features: sup})
+	c.Expect('I', adc.Supported{}.Cmd().String())
+	p := c.Expect('I', adc.SIDAssign{}.Cmd().String())
+	var sid adc.SIDAssign
+	if err := adc.Unmarshal(p.Message().Data, &sid); err != nil {
+		c.tb.Fatal(err)
+	}
+	c.SID = sid.SID
+}
+
+// Identify sends the user info and waits until the hub sends the user list, ending with the client itself.
+func (c *Client) Identify(name string) {
+	c.tb.Helper()
+	c.Name = name
+	c.SendMsg('B', c.User())
+	c.ExpectJoin(c.SID)
+}
+
+// User returns the user info sent by the client during the handshake.
+func (c *Client) User() adc.User {
+	pid := c.PID
+	return adc.User{
+		Id:          c.CID,
+		Pid:         &pid,
+		Name:        c.Name,
+		Application: "adctest",
+		Version:     "1.0",
+		Slots:       1,
+		SlotsFree:   1,
+		HubsNormal:  1,
+		ShareSize:   1,
+	}
+}
+
+// Handshake runs a full handshake with the hub.
+func (c *Client) Handshake(name string) {
+	c.tb.Helper()
+	c.Protocol()
+	c.Identify(name)
+}
+
+// ExpectJoin waits for the user info of the user with a given SID.
+func (c *Client) ExpectJoin(sid adc.SID) adc.User {
+	c.tb.Helper()
+	for {
+		p := c.Expect('B', adc.User{}.Cmd().String())
+		if p.(*adc.BroadcastPacket).ID != sid {
+			continue
+		}
+		var u adc.User
+		if err := adc.Unmarshal(p.Message().Data, &u); err != nil {
+			c.tb.Fatal(err)
+		}
+		return u
+	}
+}
+
+// ExpectQuit waits for the hub to announce that the user with a given SID left.
+func (c *Client) ExpectQuit(sid adc.SID) {
+	c.tb.Helper()
+	for {
+		p := c.Expect('I', adc.Disconnect{}.Cmd().String())
+		var q adc.Disconnect
+		if err := adc.Unmarshal(p.Message().Data, &q); err != nil {
+			c.tb.Fatal(err)
+		}
+		if q.ID == sid {
+			return
+		}
+	}
+}
+
+// ExpectChat waits for a chat message from a given SID, and returns it.
+func (c *Client) ExpectChat(from adc.SID) adc.ChatMessage {
+	c.tb.Helper()
+	for {
+		p := c.Expect(0, adc.ChatMessage{}.Cmd().String())
+		if pp, ok := p.(adc.PeerPacket); !ok || pp.Source() != from {
+			continue
+		}
+		var m adc.ChatMessage
+		if err := adc.Unmarshal(p.Message().Data, &m); err != nil {
+			c.tb.Fatal(err)
+		}
+		return m
+	}
+}
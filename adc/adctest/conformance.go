@@ -0,0 +1,311 @@
+package adctest
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+// Dialer opens a new connection to the hub under test.
+type Dialer func() (net.Conn, error)
+
+// Conformance configures the ADC conformance suite.
+type Conformance struct {
+	// Dial opens a new connection to the hub.
+	Dial Dialer
+	// HandshakeTimeout is the time the hub allows for a single handshake step.
+	// If set, the suite checks that stalled connections are dropped.
+	HandshakeTimeout time.Duration
+	// Timeout is the time virtual clients wait for a packet. Zero value means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Run runs the conformance suite against the hub. Each test uses unique nicknames,
+// so the suite can run against a long-living hub instance.
+//
+// The hub must allow multiple logins from the same address and must not require
+// registration or passwords.
+func (s Conformance) Run(t *testing.T) {
+	r := &runner{s: s, prefix: "adctest_" + types.NewPID().Hash().ToBase32()[:6]}
+	for _, c := range []struct {
+		name string
+		fnc  func(t *testing.T)
+	}{
+		{"handshake/basic", r.testHandshake},
+		{"handshake/no base", r.testNoBase},
+		{"handshake/wrong command", r.testWrongCommand},
+		{"handshake/invalid pid", r.testInvalidPID},
+		{"handshake/nick taken", r.testNickTaken},
+		{"handshake/cid taken", r.testCIDTaken},
+		{"handshake/wrong sid", r.testWrongSID},
+		{"malformed/garbage", r.testGarbage},
+		{"malformed/spoofed sid", r.testSpoofedSID},
+		{"malformed/no delimiter", r.testNoDelimiter},
+		{"chat/broadcast", r.testBroadcastChat},
+		{"chat/direct", r.testDirectChat},
+		{"quit", r.testQuit},
+		{"timing/fragmented", r.testFragmented},
+		{"timing/stalled handshake", r.testStalledHandshake},
+		{"timing/slow handshake", r.testSlowHandshake},
+	} {
+		t.Run(c.name, c.fnc)
+	}
+}
+
+type runner struct {
+	s      Conformance
+	prefix string
+	n      int
+}
+
+// nick returns a unique nickname for the test.
+func (r *runner) nick(name string) string {
+	r.n++
+	return r.prefix + "_" + name + strconv.Itoa(r.n)
+}
+
+func (r *runner) client(t *testing.T) *Client {
+	t.Helper()
+	conn, err := r.s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(t, conn)
+	if r.s.Timeout > 0 {
+		c.Timeout = r.s.Timeout
+	}
+	return c
+}
+
+func (r *runner) login(t *testing.T, name string) *Client {
+	t.Helper()
+	c := r.client(t)
+	c.Handshake(r.nick(name))
+	return c
+}
+
+func (r *runner) testHandshake(t *testing.T) {
+	c := r.client(t)
+	defer c.Close()
+	c.Protocol()
+	if c.SID == (adc.SID{}) {
+		t.Fatal("expected SID to be assigned")
+	}
+	c.Name = r.nick("basic")
+	c.SendMsg('B', c.User())
+	c.Expect('I', adc.HubInfo{}.Cmd().String())
+	u := c.ExpectJoin(c.SID)
+	if u.Name != c.Name {
+		t.Fatalf("unexpected name in the user list: %q vs %q", u.Name, c.Name)
+	} else if u.Id != c.CID {
+		t.Fatalf("unexpected CID in the user list: %v vs %v", u.Id, c.CID)
+	} else if u.Pid != nil {
+		t.Fatal("hub must not broadcast PID")
+	}
+}
+
+func (r *runner) testNoBase(t *testing.T) {
+	c := r.client(t)
+	defer c.Close()
+	c.Send("HSUP ADTIGR")
+	c.ExpectError(adc.CodeFeatureMissing)
+}
+
+func (r *runner) testWrongCommand(t *testing.T) {
+	c := r.client(t)
+	defer c.Close()
+	c.Send("BMSG AAAA hello")
+	c.ExpectClosed()
+}
+
+func (r *runner) testInvalidPID(t *testing.T) {
+	c := r.client(t)
+	defer c.Close()
+	c.Protocol()
+	c.Name = r.nick("pid")
+	c.PID = types.NewPID()
+	c.SendMsg('B', c.User())
+	c.ExpectError(adc.CodeInvalidPID)
+}
+
+func (r *runner) testNickTaken(t *testing.T) {
+	c1 := r.login(t, "nick")
+	defer c1.Close()
+
+	c2 := r.client(t)
+	defer c2.Close()
+	c2.Protocol()
+	c2.Name = c1.Name
+	c2.SendMsg('B', c2.User())
+	c2.ExpectError(adc.CodeNickTaken)
+}
+
+func (r *runner) testCIDTaken(t *testing.T) {
+	c1 := r.login(t, "cid")
+	defer c1.Close()
+
+	c2 := r.client(t)
+	defer c2.Close()
+	c2.PID, c2.CID = c1.PID, c1.CID
+	c2.Protocol()
+	c2.Name = r.nick("cid")
+	c2.SendMsg('B', c2.User())
+	c2.ExpectError(adc.CodeCIDTaken)
+}
+
+func (r *runner) testWrongSID(t *testing.T) {
+	c := r.client(t)
+	defer c.Close()
+	c.Protocol()
+	c.Name = r.nick("sid")
+	sid := c.SID
+	c.SID = adc.SID{'Z', 'Z', 'Z', 'Z'}
+	if sid == c.SID {
+		c.SID = adc.SID{'Y', 'Y', 'Y', 'Y'}
+	}
+	c.SendMsg('B', c.User())
+	c.ExpectError(adc.CodeProtocolGeneric)
+}
+
+func (r *runner) testGarbage(t *testing.T) {
+	c1 := r.login(t, "observer")
+	defer c1.Close()
+	c2 := r.login(t, "garbage")
+	defer c2.Close()
+	c1.ExpectJoin(c2.SID)
+
+	c2.Send("this is not an ADC packet")
+	c2.ExpectClosed()
+	c1.ExpectQuit(c2.SID)
+}
+
+func (r *runner) testSpoofedSID(t *testing.T) {
+	c1 := r.login(t, "victim")
+	defer c1.Close()
+	c2 := r.login(t, "spoofer")
+	defer c2.Close()
+	c1.ExpectJoin(c2.SID)
+
+	c2.Send("BMSG " + c1.SID.String() + " spoofed")
+	c2.ExpectClosed()
+	c1.ExpectQuit(c2.SID)
+}
+
+func (r *runner) testNoDelimiter(t *testing.T) {
+	c := r.client(t)
+	defer c.Close()
+	// a huge line without a delimiter must not be buffered indefinitely
+	line := "HSUP ADBASE ADTIGR AD" + strings.Repeat("X", 2*maxLineSize)
+	conn := c.conn
+	go func() {
+		conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+		_, _ = conn.Write([]byte(line))
+	}()
+	c.ExpectClosed()
+}
+
+func (r *runner) testBroadcastChat(t *testing.T) {
+	c1 := r.login(t, "chat1")
+	defer c1.Close()
+	c2 := r.login(t, "chat2")
+	defer c2.Close()
+	c1.ExpectJoin(c2.SID)
+
+	c1.SendMsg('B', adc.ChatMessage{Text: "hello world"})
+	if m := c2.ExpectChat(c1.SID); m.Text != "hello world" {
+		t.Fatalf("unexpected message: %q", m.Text)
+	}
+	if m := c1.ExpectChat(c1.SID); m.Text != "hello world" {
+		t.Fatalf("unexpected message: %q", m.Text)
+	}
+}
+
+func (r *runner) testDirectChat(t *testing.T) {
+	c1 := r.login(t, "pm1")
+	defer c1.Close()
+	c2 := r.login(t, "pm2")
+	defer c2.Close()
+	c3 := r.login(t, "pm3")
+	defer c3.Close()
+	c1.ExpectJoin(c3.SID)
+
+	c1.SendMsg('E', adc.ChatMessage{Text: "secret", PM: &c1.SID}, c3.SID)
+	if m := c3.ExpectChat(c1.SID); m.Text != "secret" {
+		t.Fatalf("unexpected message: %q", m.Text)
+	}
+	// echo to the sender
+	if m := c1.ExpectChat(c1.SID); m.Text != "secret" {
+		t.Fatalf("unexpected message: %q", m.Text)
+	}
+	c2.ExpectNoChat(c1.SID, 200*time.Millisecond)
+}
+
+func (r *runner) testQuit(t *testing.T) {
+	c1 := r.login(t, "stay")
+	defer c1.Close()
+	c2 := r.login(t, "leave")
+	c1.ExpectJoin(c2.SID)
+
+	c2.Close()
+	c1.ExpectQuit(c2.SID)
+}
+
+func (r *runner) testFragmented(t *testing.T) {
+	c1 := r.login(t, "frag1")
+	defer c1.Close()
+	c2 := r.login(t, "frag2")
+	defer c2.Close()
+	c1.ExpectJoin(c2.SID)
+
+	line := "BMSG " + c2.SID.String() + " fragmented\\smessage\n"
+	for i := 0; i < len(line); i += 3 {
+		end := i + 3
+		if end > len(line) {
+			end = len(line)
+		}
+		c2.SendRaw([]byte(line[i:end]))
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m := c1.ExpectChat(c2.SID); m.Text != "fragmented message" {
+		t.Fatalf("unexpected message: %q", m.Text)
+	}
+}
+
+func (r *runner) testStalledHandshake(t *testing.T) {
+	if r.s.HandshakeTimeout == 0 {
+		t.Skip("handshake timeout is not set")
+	}
+	c := r.client(t)
+	defer c.Close()
+	c.Timeout = 2*r.s.HandshakeTimeout + time.Second
+	c.Protocol()
+	// never send INF
+	c.ExpectClosed()
+}
+
+func (r *runner) testSlowHandshake(t *testing.T) {
+	if r.s.HandshakeTimeout == 0 {
+		t.Skip("handshake timeout is not set")
+	}
+	c := r.client(t)
+	defer c.Close()
+	c.Timeout = 2*r.s.HandshakeTimeout + time.Second
+	// send the packet byte by byte, slower than the hub allows
+	line := "HSUP ADBASE ADTIGR\n"
+	delay := r.s.HandshakeTimeout / time.Duration(len(line)/2)
+	conn := c.conn
+	go func() {
+		for i := 0; i < len(line); i++ {
+			if _, err := conn.Write([]byte{line[i]}); err != nil {
+				return
+			}
+			time.Sleep(delay)
+		}
+	}()
+	c.ExpectClosed()
+}
@@ -0,0 +1,93 @@
+// Package adctest implements helpers for testing and benchmarking ADC protocol implementations.
+package adctest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+const (
+	lineDelim   = '\n'
+	maxLineSize = 1024 * 1024
+)
+
+// Session is a recorded ADC session.
+type Session struct {
+	// Lines contains raw ADC packets, including the line delimiter.
+	Lines [][]byte
+}
+
+// ReadSession reads a session dump. Each line of the dump is a single ADC packet.
+// Empty lines (keep alive) and lines starting with '#' (comments) are skipped.
+func ReadSession(r io.Reader) (*Session, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxLineSize)
+	s := &Session{}
+	for sc.Scan() {
+		line := bytes.TrimRight(sc.Bytes(), "\r")
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		b := make([]byte, len(line)+1)
+		copy(b, line)
+		b[len(line)] = lineDelim
+		s.Lines = append(s.Lines, b)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadSession reads a session dump from a file. The test fails if the file cannot be read.
+func LoadSession(tb testing.TB, path string) *Session {
+	tb.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	s, err := ReadSession(f)
+	if err != nil {
+		tb.Fatalf("cannot read session %q: %v", path, err)
+	}
+	return s
+}
+
+// Size returns the total size of all packets in the session.
+func (s *Session) Size() int64 {
+	var n int64
+	for _, l := range s.Lines {
+		n += int64(len(l))
+	}
+	return n
+}
+
+// Replay calls fn for each packet in the session. It stops on the first error.
+//
+// The function must not retain or modify the line.
+func (s *Session) Replay(fn func(line []byte) error) error {
+	for i, l := range s.Lines {
+		if err := fn(l); err != nil {
+			return fmt.Errorf("packet %d (%q): %v", i+1, bytes.TrimSuffix(l, []byte{lineDelim}), err)
+		}
+	}
+	return nil
+}
+
+// Bench replays the session b.N times and reports the throughput.
+func (s *Session) Bench(b *testing.B, fn func(line []byte) error) {
+	b.Helper()
+	b.SetBytes(s.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Replay(fn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
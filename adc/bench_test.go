@@ -0,0 +1,102 @@
+package adc_test
+
+import (
+	"testing"
+
+	. "github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/adctest"
+)
+
+const hubSession = "testdata/hub_session.adc"
+
+func decodeLine(line []byte) error {
+	p, err := DecodePacket(line)
+	if err != nil {
+		return err
+	}
+	_, err = p.Decode()
+	return err
+}
+
+func TestSessionReplay(t *testing.T) {
+	s := adctest.LoadSession(t, hubSession)
+	if len(s.Lines) == 0 {
+		t.Fatal("empty session")
+	}
+	if err := s.Replay(decodeLine); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkDecodePacket(b *testing.B) {
+	s := adctest.LoadSession(b, hubSession)
+	s.Bench(b, func(line []byte) error {
+		_, err := DecodePacket(line)
+		return err
+	})
+}
+
+func BenchmarkDecodeMessage(b *testing.B) {
+	s := adctest.LoadSession(b, hubSession)
+	s.Bench(b, decodeLine)
+}
+
+func BenchmarkEncodePacket(b *testing.B) {
+	s := adctest.LoadSession(b, hubSession)
+	packets := make([]Packet, 0, len(s.Lines))
+	err := s.Replay(func(line []byte) error {
+		p, err := DecodePacket(line)
+		if err == nil {
+			packets = append(packets, p)
+		}
+		return err
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(s.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range packets {
+			if _, err := p.MarshalPacket(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Allocation budgets for the parsing hot path. Update them only if the regression is justified.
+var allocBudgets = []struct {
+	name   string
+	line   string
+	decode bool
+	allocs float64
+}{
+	{"packet", "BMSG AAAC hello\\severyone\n", false, 1},
+	{"chat", "BMSG AAAC hello\\severyone\n", true, 8},
+	{"user", "BINF AAAB IDKAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI NIdennnn I4172.17.42.1 SS25146919163 SF23 VEEiskaltDC++\\s2.2.9 SL3 SUSEGA,ADC0,TCP4,UDP4\n", true, 20},
+	{"search", "BSCH AAAC TO4171511714 ANsome ANdata GR32\n", true, 18},
+}
+
+func TestDecodeAllocBudget(t *testing.T) {
+	for _, c := range allocBudgets {
+		t.Run(c.name, func(t *testing.T) {
+			line := []byte(c.line)
+			n := testing.AllocsPerRun(100, func() {
+				p, err := DecodePacket(line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.decode {
+					if _, err = p.Decode(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			})
+			if n > c.allocs {
+				t.Fatalf("allocation budget exceeded: %v > %v", n, c.allocs)
+			}
+		})
+	}
+}
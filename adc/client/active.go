@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// ServePeers accepts client-client connections on the listener. This allows dialing
+// passive peers by sending them our address (CTM).
+//
+// The port is advertised to peers; if it's zero, the port of the listener is used.
+// Both plain and secure (ADCS) connections are accepted on the same listener.
+// The function returns when the listener is closed.
+func (c *Conn) ServePeers(l net.Listener, port int) error {
+	if port == 0 {
+		addr, ok := l.Addr().(*net.TCPAddr)
+		if !ok {
+			return fmt.Errorf("cannot detect the port for %v", l.Addr())
+		}
+		port = addr.Port
+	}
+	c.active.Lock()
+	c.active.port = port
+	c.active.Unlock()
+	defer func() {
+		c.active.Lock()
+		c.active.port = 0
+		c.active.Unlock()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := c.acceptPeer(conn); err != nil {
+				log.Printf("%v: %v", conn.RemoteAddr(), err)
+				_ = conn.Close()
+			}
+		}()
+	}
+}
+
+// activePort returns the port advertised to peers, or zero if the client is not listening.
+func (c *Conn) activePort() int {
+	c.active.RLock()
+	defer c.active.RUnlock()
+	return c.active.port
+}
+
+// acceptPeer runs a handshake with a connected peer and delivers the connection
+// to the dial that sent the token.
+func (c *Conn) acceptPeer(conn net.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeouts.handshake())
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	conn, secure, err := isTLS(conn, deadline)
+	if err != nil {
+		return err
+	}
+	var certs [][]byte
+	if secure {
+		if c.cert == nil {
+			return errors.New("secure connections are disabled")
+		}
+		tconn := tls.Server(conn, c.serverTLS())
+		_ = conn.SetDeadline(deadline)
+		err = withContext(ctx, conn, tconn.Handshake)
+		_ = conn.SetDeadline(time.Time{})
+		if err != nil {
+			return fmt.Errorf("TLS handshake failed: %v", err)
+		}
+		for _, cert := range tconn.ConnectionState().PeerCertificates {
+			certs = append(certs, cert.Raw)
+		}
+		conn = tconn
+	}
+	aconn, err := adc.NewConn(conn)
+	if err != nil {
+		return err
+	}
+	var (
+		pc  *PeerConn
+		tok *connToken
+	)
+	err = withContext(ctx, aconn, func() error {
+		var err error
+		pc, tok, err = c.handshakeAccept(ctx, aconn, secure, certs)
+		return err
+	})
+	if err != nil {
+		if tok != nil {
+			tok.errc <- err
+		}
+		return err
+	}
+	tok.conn <- pc
+	return nil
+}
+
+// handshakeAccept runs a handshake on the accepting side of a client-client connection.
+// The peer is identified by the token sent in CTM.
+func (c *Conn) handshakeAccept(ctx context.Context, conn *adc.Conn, secure bool, certs [][]byte) (*PeerConn, *connToken, error) {
+	deadline := ctxDeadline(ctx, c.timeouts.handshake())
+
+	// wait for a list of features
+	msg, err := conn.ReadClientMsg(deadline)
+	if err != nil {
+		return nil, nil, err
+	}
+	sup, ok := msg.(adc.Supported)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a list of peer's features, got: %#v", msg)
+	}
+	peerFeatures := sup.Features
+	if !peerFeatures.IsSet(adc.FeaBASE) || !peerFeatures.IsSet(adc.FeaTIGR) {
+		return nil, nil, fmt.Errorf("no basic features support for peer: %v", peerFeatures)
+	}
+
+	// send our features
+	ourFeatures := clientExtensions()
+	if peerFeatures.IsSet(adc.FeaCCPM) && c.ccpmEnabled() {
+		// the peer wants a PM connection; the dialer checks if it asked for one
+		ourFeatures[adc.FeaCCPM] = true
+	}
+	err = conn.WriteClientMsg(adc.Supported{
+		Features: ourFeatures,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = conn.Flush()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// wait for an identification
+	msg, err = conn.ReadClientMsg(deadline)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, ok := msg.(adc.User)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a peer's identity, got: %#v", msg)
+	}
+	tok, ok := c.tokens.take(u.Token)
+	if !ok {
+		return nil, nil, errors.New("wrong auth token")
+	} else if u.Id != tok.cid {
+		return nil, tok, fmt.Errorf("wrong client connected: %v", u.Id)
+	} else if secure != (tok.proto == adc.ProtoADCS) {
+		return nil, tok, fmt.Errorf("expected %s connection", tok.proto)
+	}
+	p := c.peerByCID(u.Id)
+	if p == nil {
+		return nil, tok, ErrPeerOffline
+	}
+	if secure {
+		if err = p.verifyCert(certs); err != nil {
+			return nil, tok, err
+		}
+	}
+
+	// identify ourselves
+	err = conn.WriteClientMsg(adc.User{
+		Id: c.CID(),
+	})
+	if err != nil {
+		return nil, tok, err
+	}
+	err = conn.Flush()
+	if err != nil {
+		return nil, tok, err
+	}
+	return &PeerConn{p: p, conn: conn, fea: ourFeatures.Intersect(peerFeatures), secure: secure}, tok, nil
+}
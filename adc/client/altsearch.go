@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const (
+	// DefaultAltSearchInterval is a default interval between searches for the same file.
+	DefaultAltSearchInterval = 10 * time.Minute
+	// DefaultHubSearchInterval is a default minimal interval between searches on the same hub.
+	// Most hubs will drop searches that are sent more frequently.
+	DefaultHubSearchInterval = 30 * time.Second
+
+	altSearchTimeout = time.Minute
+)
+
+// SourceFinder periodically searches connected hubs for the TTH of queued files
+// to discover alternate download sources.
+//
+// Each file is searched on all hubs. Only one search is sent to each hub per HubInterval,
+// and the same file is searched again on the hub only after Interval passes.
+//
+// The zero value is ready to use.
+type SourceFinder struct {
+	// Interval is a minimal interval between searches for the same file on the same hub.
+	// Zero value means DefaultAltSearchInterval.
+	Interval time.Duration
+	// HubInterval is a minimal interval between searches on the same hub.
+	// Zero value means DefaultHubSearchInterval.
+	HubInterval time.Duration
+	// OnSource is called for each new source of a file. Optional.
+	OnSource func(tth adc.TTH, r SearchResult)
+	// Blacklist is used to skip sources that sent corrupted data. Optional.
+	Blacklist *Blacklist
+
+	mu    sync.Mutex
+	hubs  map[*Conn]time.Time
+	files map[adc.TTH]*altFile
+}
+
+type altFile struct {
+	added   time.Time
+	last    map[*Conn]time.Time // last search on each hub
+	sources map[adc.CID]SearchResult
+}
+
+// NewSourceFinder creates a SourceFinder with default intervals.
+func NewSourceFinder() *SourceFinder {
+	return &SourceFinder{
+		Interval:    DefaultAltSearchInterval,
+		HubInterval: DefaultHubSearchInterval,
+		hubs:        make(map[*Conn]time.Time),
+		files:       make(map[adc.TTH]*altFile),
+	}
+}
+
+func (f *SourceFinder) interval() time.Duration {
+	if f.Interval <= 0 {
+		return DefaultAltSearchInterval
+	}
+	return f.Interval
+}
+
+func (f *SourceFinder) hubInterval() time.Duration {
+	if f.HubInterval <= 0 {
+		return DefaultHubSearchInterval
+	}
+	return f.HubInterval
+}
+
+// AddHub adds a hub connection to search on.
+func (f *SourceFinder) AddHub(c *Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.hubs == nil {
+		f.hubs = make(map[*Conn]time.Time)
+	}
+	if _, ok := f.hubs[c]; !ok {
+		f.hubs[c] = time.Time{}
+	}
+}
+
+// RemoveHub stops searching on a given hub.
+func (f *SourceFinder) RemoveHub(c *Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.hubs, c)
+	for _, file := range f.files {
+		delete(file.last, c)
+	}
+}
+
+// Add queues a file for the alternate sources search.
+func (f *SourceFinder) Add(tth adc.TTH) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.files == nil {
+		f.files = make(map[adc.TTH]*altFile)
+	}
+	if _, ok := f.files[tth]; !ok {
+		f.files[tth] = &altFile{
+			added:   time.Now(),
+			last:    make(map[*Conn]time.Time),
+			sources: make(map[adc.CID]SearchResult),
+		}
+	}
+}
+
+// Remove removes a file from the search queue, for example when it's downloaded.
+func (f *SourceFinder) Remove(tth adc.TTH) {
+	f.mu.Lock()
+	delete(f.files, tth)
+	f.mu.Unlock()
+}
+
+// Sources returns all known sources for a file, except blacklisted ones.
+//
+// Sources that advertise more free slots go first, so they should be dialed first.
+func (f *SourceFinder) Sources(tth adc.TTH) []SearchResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file := f.files[tth]
+	if file == nil {
+		return nil
+	}
+	out := make([]SearchResult, 0, len(file.sources))
+	for cid, r := range file.sources {
+		if !f.Blacklist.Allowed(tth, cid) {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return freeSlots(out[i]) > freeSlots(out[j])
+	})
+	return out
+}
+
+// freeSlots returns the number of free slots of the source. The user info is
+// used if the peer is online, since it's updated more often than search results.
+func freeSlots(r SearchResult) int {
+	if r.Peer != nil && r.Peer.Online() {
+		return r.Peer.Info().SlotsFree
+	}
+	return r.Slots
+}
+
+type altSearch struct {
+	hub *Conn
+	tth adc.TTH
+}
+
+// next selects a file to search for on each hub that is allowed to receive a search now.
+// On each hub, the file that was not searched for there the longest time is selected first.
+func (f *SourceFinder) next(now time.Time) []altSearch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	interval, hubInterval := f.interval(), f.hubInterval()
+	var hubs []*Conn
+	for c, last := range f.hubs {
+		if last.IsZero() || now.Sub(last) >= hubInterval {
+			hubs = append(hubs, c)
+		}
+	}
+	sort.Slice(hubs, func(i, j int) bool {
+		return f.hubs[hubs[i]].Before(f.hubs[hubs[j]])
+	})
+	var out []altSearch
+	for _, c := range hubs {
+		var (
+			best     adc.TTH
+			bestf    *altFile
+			bestLast time.Time
+		)
+		for tth, file := range f.files {
+			last := file.last[c]
+			if !last.IsZero() && now.Sub(last) < interval {
+				continue
+			}
+			if bestf == nil || last.Before(bestLast) ||
+				(last.Equal(bestLast) && file.added.Before(bestf.added)) {
+				best, bestf, bestLast = tth, file, last
+			}
+		}
+		if bestf == nil {
+			continue
+		}
+		f.hubs[c] = now
+		bestf.last[c] = now
+		out = append(out, altSearch{hub: c, tth: best})
+	}
+	return out
+}
+
+// addSource records a search result. It returns false if the result doesn't match
+// the file or the source is already known.
+func (f *SourceFinder) addSource(tth adc.TTH, r SearchResult) bool {
+	if r.Peer == nil || r.Dir || r.TTH == nil || *r.TTH != tth {
+		return false
+	}
+	cid := r.Peer.Info().Id
+	if !f.Blacklist.Allowed(tth, cid) {
+		return false
+	}
+	f.mu.Lock()
+	file := f.files[tth]
+	if file == nil {
+		f.mu.Unlock()
+		return false
+	}
+	if _, ok := file.sources[cid]; ok {
+		// keep the number of free slots up to date
+		file.sources[cid] = r
+		f.mu.Unlock()
+		return false
+	}
+	file.sources[cid] = r
+	f.mu.Unlock()
+	if f.OnSource != nil {
+		f.OnSource(tth, r)
+	}
+	return true
+}
+
+// Run searches for alternate sources until the context is cancelled.
+func (f *SourceFinder) Run(ctx context.Context) error {
+	tick := f.hubInterval() / 2
+	if tick <= 0 {
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		for _, s := range f.next(time.Now()) {
+			go f.search(ctx, s)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *SourceFinder) search(ctx context.Context, s altSearch) {
+	ctx, cancel := context.WithTimeout(ctx, altSearchTimeout)
+	defer cancel()
+	tth := s.tth
+	results, err := s.hub.Search(ctx, Search{TTH: &tth})
+	if err != nil {
+		return
+	}
+	for r := range results {
+		f.addSource(tth, r)
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestSourceFinderNext(t *testing.T) {
+	f := NewSourceFinder()
+	f.Interval = time.Minute
+	f.HubInterval = 10 * time.Second
+
+	h1, h2 := &Conn{sid: adc.SID{1}}, &Conn{sid: adc.SID{2}}
+	f.AddHub(h1)
+	f.AddHub(h2)
+	tth1, tth2, tth3 := adc.TTH{1}, adc.TTH{2}, adc.TTH{3}
+	f.Add(tth1)
+	time.Sleep(time.Millisecond)
+	f.Add(tth2)
+	time.Sleep(time.Millisecond)
+	f.Add(tth3)
+
+	// each file is searched on all hubs
+	now := time.Now()
+	got := f.next(now)
+	require.Len(t, got, 2)
+	require.Equal(t, tth1, got[0].tth)
+	require.Equal(t, tth1, got[1].tth)
+	require.True(t, got[0].hub != got[1].hub)
+
+	// hubs are rate-limited
+	require.Empty(t, f.next(now.Add(time.Second)))
+
+	// the next file goes first, searched files are not repeated before the interval
+	got = f.next(now.Add(10 * time.Second))
+	require.Len(t, got, 2)
+	require.Equal(t, tth2, got[0].tth)
+	require.Equal(t, tth2, got[1].tth)
+	got = f.next(now.Add(20 * time.Second))
+	require.Len(t, got, 2)
+	require.Equal(t, tth3, got[0].tth)
+	require.Empty(t, f.next(now.Add(30*time.Second)))
+
+	got = f.next(now.Add(time.Minute))
+	require.Len(t, got, 2)
+	require.Equal(t, tth1, got[0].tth)
+
+	// a new hub gets searches for all files
+	h3 := &Conn{sid: adc.SID{3}}
+	f.AddHub(h3)
+	got = f.next(now.Add(time.Minute + time.Second))
+	require.Equal(t, []altSearch{{hub: h3, tth: tth1}}, got)
+
+	f.RemoveHub(h2)
+	f.Remove(tth1)
+	got = f.next(now.Add(time.Hour))
+	require.Len(t, got, 2)
+	require.Equal(t, tth2, got[0].tth)
+	require.Equal(t, tth2, got[1].tth)
+	require.True(t, got[0].hub != h2 && got[1].hub != h2 && got[0].hub != got[1].hub)
+}
+
+func TestSourceFinderZero(t *testing.T) {
+	var f SourceFinder
+	h := &Conn{sid: adc.SID{1}}
+	tth := adc.TTH{1}
+	f.AddHub(h)
+	f.Add(tth)
+	require.Equal(t, []altSearch{{hub: h, tth: tth}}, f.next(time.Now()))
+	require.Empty(t, f.Sources(adc.TTH{2}))
+}
+
+func TestSourceFinderAddSource(t *testing.T) {
+	f := NewSourceFinder()
+	var found []adc.CID
+	f.OnSource = func(_ adc.TTH, r SearchResult) {
+		found = append(found, r.Peer.Info().Id)
+	}
+	tth, other := adc.TTH{1}, adc.TTH{2}
+	f.Add(tth)
+
+	p1 := &Peer{user: &adc.User{Id: adc.CID{1}}}
+	p2 := &Peer{user: &adc.User{Id: adc.CID{2}}}
+
+	require.True(t, f.addSource(tth, SearchResult{Peer: p1, Path: "/a", TTH: &tth}))
+	require.False(t, f.addSource(tth, SearchResult{Peer: p1, Path: "/b", TTH: &tth}))
+	require.False(t, f.addSource(tth, SearchResult{Peer: p2, Path: "/a", TTH: &other}))
+	require.False(t, f.addSource(other, SearchResult{Peer: p2, Path: "/a", TTH: &other}))
+	require.True(t, f.addSource(tth, SearchResult{Peer: p2, Path: "/c", TTH: &tth}))
+
+	require.Equal(t, []adc.CID{{1}, {2}}, found)
+	require.Len(t, f.Sources(tth), 2)
+}
+
+func TestSourceFinderFreeSlots(t *testing.T) {
+	f := NewSourceFinder()
+	tth := adc.TTH{1}
+	f.Add(tth)
+
+	p1 := &Peer{user: &adc.User{Id: adc.CID{1}}}
+	p2 := &Peer{user: &adc.User{Id: adc.CID{2}}}
+	p3 := &Peer{user: &adc.User{Id: adc.CID{3}, SlotsFree: 5}}
+	f.addSource(tth, SearchResult{Peer: p1, Path: "/a", TTH: &tth})
+	f.addSource(tth, SearchResult{Peer: p2, Path: "/a", TTH: &tth, Slots: 2})
+	f.addSource(tth, SearchResult{Peer: p3, Path: "/a", TTH: &tth})
+
+	src := f.Sources(tth)
+	require.Len(t, src, 3)
+	require.Equal(t, p2, src[0].Peer)
+
+	// newer results update the number of slots
+	require.False(t, f.addSource(tth, SearchResult{Peer: p1, Path: "/a", TTH: &tth, Slots: 3}))
+	require.Equal(t, p1, f.Sources(tth)[0].Peer)
+
+	// online peers report free slots in their info
+	p3.online(adc.SID{3})
+	require.Equal(t, p3, f.Sources(tth)[0].Peer)
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+// listType is an ADC transfer type for partial file lists.
+const listType = "list"
+
+// listPath converts a directory path to the form used in partial list requests:
+// it always starts and ends with a slash, and a single slash is the root.
+func listPath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "/"
+	}
+	return "/" + path + "/"
+}
+
+// GetFileList fetches and parses the full file list of the peer.
+func (c *PeerConn) GetFileList(ctx context.Context) (*filelist.FileList, error) {
+	rc, err := c.GetFileListBZIP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return filelist.DecodeBZIP(rc)
+}
+
+// GetPartialList requests a partial file list for a given directory.
+// If recursive is not set, only the direct contents of the directory are returned
+// and subdirectories are marked as incomplete.
+func (c *PeerConn) GetPartialList(ctx context.Context, path string, recursive bool) (*filelist.FileList, error) {
+	rc, err := c.get(ctx, adc.GetRequest{
+		Type: listType, Path: listPath(path),
+		Start: 0, Bytes: -1,
+		Recursive: recursive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// partial lists are always uncompressed
+	return filelist.ReadAll(rc)
+}
+
+// Browse returns a directory from the peer's file list.
+//
+// The list is fetched lazily: only the requested directory is downloaded, and only if it's
+// not already known. Subdirectories of the returned directory may be incomplete, and can be
+// fetched by calling Browse for them.
+//
+// The returned directory is a copy and is safe to use after the next call to Browse.
+func (c *PeerConn) Browse(ctx context.Context, path string) (*filelist.Dir, error) {
+	c.browse.Lock()
+	defer c.browse.Unlock()
+	if c.browse.list == nil {
+		c.browse.list = &filelist.FileList{Base: "/"}
+		c.browse.incomplete = true
+	}
+	d, f := c.browse.list.Lookup(path)
+	if f != nil {
+		return nil, fmt.Errorf("not a directory: %q", path)
+	}
+	if d != nil && !d.IsIncomplete() && !(d.Name == "" && c.browse.incomplete) {
+		return copyDir(d), nil
+	}
+	// directory is unknown or incomplete - fetch it
+	list, err := c.GetPartialList(ctx, path, false)
+	if err != nil {
+		return nil, err
+	}
+	d = c.browse.mkdir(path)
+	d.Dirs, d.Files = list.Dirs, list.Files
+	d.Incomplete = 0
+	if strings.Trim(path, "/") == "" {
+		c.browse.list.Dirs, c.browse.list.Files = d.Dirs, d.Files
+		c.browse.incomplete = false
+	}
+	return copyDir(d), nil
+}
+
+type browseCache struct {
+	list *filelist.FileList
+	// incomplete is set until the root directory is fetched
+	incomplete bool
+}
+
+// mkdir finds or creates a directory in the cached list.
+func (b *browseCache) mkdir(path string) *filelist.Dir {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return &filelist.Dir{}
+	}
+	names := strings.Split(path, "/")
+	dirs := &b.list.Dirs
+	var d *filelist.Dir
+	for _, name := range names {
+		d = nil
+		for i := range *dirs {
+			if (*dirs)[i].Name == name {
+				d = &(*dirs)[i]
+				break
+			}
+		}
+		if d == nil {
+			// parent doesn't list this directory yet
+			*dirs = append(*dirs, filelist.Dir{Name: name, Incomplete: 1})
+			d = &(*dirs)[len(*dirs)-1]
+		}
+		dirs = &d.Dirs
+	}
+	return d
+}
+
+func copyDir(d *filelist.Dir) *filelist.Dir {
+	out := *d
+	out.Dirs = append([]filelist.Dir(nil), d.Dirs...)
+	out.Files = append([]filelist.File(nil), d.Files...)
+	return &out
+}
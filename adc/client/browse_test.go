@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+var testPartialLists = map[string]string{
+	"/": `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<FileListing Version="1" Base="/" Generator="test">
+<Directory Name="music" Incomplete="1"/>
+<File Name="readme.txt" Size="10" TTH="UDRJ6EGCH3CGWIIU2V6CH7VLFN4N2PCZKSPTBQA"/>
+</FileListing>`,
+	"/music/": `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<FileListing Version="1" Base="/music/" Generator="test">
+<Directory Name="album" Incomplete="1"/>
+<File Name="song.mp3" Size="100" TTH="LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ"/>
+</FileListing>`,
+}
+
+// servePartialLists answers GET list requests on a peer connection.
+func servePartialLists(t *testing.T, conn *adc.Conn, raw net.Conn, reqs chan<- string) {
+	for {
+		msg, err := conn.ReadClientMsg(time.Time{})
+		if err != nil {
+			return
+		}
+		get, ok := msg.(adc.GetRequest)
+		if !ok || get.Type != "list" {
+			t.Errorf("unexpected message: %#v", msg)
+			return
+		}
+		reqs <- get.Path
+		data := testPartialLists[get.Path]
+		res := adc.GetResponse(get)
+		res.Bytes = int64(len(data))
+		if err = conn.WriteClientMsg(res); err != nil {
+			return
+		}
+		if err = conn.Flush(); err != nil {
+			return
+		}
+		// binary data follows the command
+		if _, err = raw.Write([]byte(data)); err != nil {
+			return
+		}
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	cli, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	srv, err := adc.NewConn(c2)
+	require.NoError(t, err)
+
+	reqs := make(chan string, 10)
+	go servePartialLists(t, srv, c2, reqs)
+
+	pc := &PeerConn{conn: cli}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	root, err := pc.Browse(ctx, "/")
+	require.NoError(t, err)
+	require.Equal(t, "/", <-reqs)
+	require.Len(t, root.Dirs, 1)
+	require.True(t, root.Dirs[0].IsIncomplete())
+	require.Equal(t, "readme.txt", root.Files[0].Name)
+
+	music, err := pc.Browse(ctx, "music")
+	require.NoError(t, err)
+	require.Equal(t, "/music/", <-reqs)
+	require.False(t, music.IsIncomplete())
+	require.Equal(t, "song.mp3", music.Files[0].Name)
+
+	// cached
+	root, err = pc.Browse(ctx, "")
+	require.NoError(t, err)
+	require.False(t, root.Dirs[0].IsIncomplete())
+	music, err = pc.Browse(ctx, "/music/")
+	require.NoError(t, err)
+	require.Len(t, music.Dirs, 1)
+	require.Len(t, reqs, 0)
+
+	_, err = pc.Browse(ctx, "readme.txt")
+	require.Error(t, err)
+}
+
+func TestListPath(t *testing.T) {
+	require.Equal(t, "/", listPath(""))
+	require.Equal(t, "/", listPath("/"))
+	require.Equal(t, "/a/b/", listPath("a/b"))
+	require.Equal(t, "/a/", listPath("/a/"))
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// ErrCCPMUnsupported is returned when a direct PM connection cannot be established with the peer.
+var ErrCCPMUnsupported = errors.New("direct private messages are not supported")
+
+// ccpmExtensions returns client-client features for direct PM connections.
+func ccpmExtensions() adc.ModFeatures {
+	fea := clientExtensions()
+	fea[adc.FeaCCPM] = true
+	return fea
+}
+
+// ccpmEnabled checks if the client accepts direct PM connections.
+// CCPM requires secure client-client connections.
+func (c *Conn) ccpmEnabled() bool {
+	return c.Secure()
+}
+
+// CanUpgradePM checks if private messages with the peer can be sent over a direct connection.
+func (p *Peer) CanUpgradePM() bool {
+	return p.hub.ccpmEnabled() && p.secure() && p.Info().Features.Has(adc.FeaCCPM) && p.CanDial()
+}
+
+// UpgradePM establishes a direct encrypted connection to the peer (CCPM). Once it's done,
+// private messages with the peer are sent over this connection instead of the hub.
+//
+// It's a no-op if the conversation with the peer is already direct.
+func (c *Conn) UpgradePM(ctx context.Context, p *Peer) error {
+	if c.directPM(p) != nil {
+		return nil
+	}
+	if !p.CanUpgradePM() {
+		return ErrCCPMUnsupported
+	}
+	pc, err := p.dial(ctx, ccpmExtensions())
+	if err != nil {
+		return err
+	}
+	c.addPM(p, pc)
+	return nil
+}
+
+// IsDirectPM checks if private messages with the peer are sent over a direct connection.
+func (c *Conn) IsDirectPM(p *Peer) bool {
+	return c.directPM(p) != nil
+}
+
+// ClosePM closes a direct PM connection with the peer, if any. Further private messages
+// are sent through the hub.
+func (c *Conn) ClosePM(p *Peer) error {
+	pc := c.directPM(p)
+	if pc == nil {
+		return nil
+	}
+	c.removePM(p, pc)
+	return pc.Close()
+}
+
+func (c *Conn) directPM(p *Peer) *PeerConn {
+	cid := p.Info().Id
+	c.ccpm.Lock()
+	defer c.ccpm.Unlock()
+	return c.ccpm.conns[cid]
+}
+
+// addPM registers a direct PM connection and starts reading messages from it.
+// If there is a connection to the peer already, the new one is closed.
+func (c *Conn) addPM(p *Peer, pc *PeerConn) {
+	cid := p.Info().Id
+	c.ccpm.Lock()
+	if _, ok := c.ccpm.conns[cid]; ok {
+		c.ccpm.Unlock()
+		_ = pc.Close()
+		return
+	}
+	if c.ccpm.conns == nil {
+		c.ccpm.conns = make(map[adc.CID]*PeerConn)
+	}
+	c.ccpm.conns[cid] = pc
+	c.ccpm.Unlock()
+	go c.readPM(p, pc)
+}
+
+// removePM unregisters a direct PM connection, unless it was already replaced.
+func (c *Conn) removePM(p *Peer, pc *PeerConn) {
+	cid := p.Info().Id
+	c.ccpm.Lock()
+	defer c.ccpm.Unlock()
+	if c.ccpm.conns[cid] == pc {
+		delete(c.ccpm.conns, cid)
+	}
+}
+
+// closePMs closes all direct PM connections.
+func (c *Conn) closePMs() {
+	c.ccpm.Lock()
+	conns := c.ccpm.conns
+	c.ccpm.conns = nil
+	c.ccpm.Unlock()
+	for _, pc := range conns {
+		_ = pc.Close()
+	}
+}
+
+func (c *Conn) readPM(p *Peer, pc *PeerConn) {
+	defer func() {
+		c.removePM(p, pc)
+		_ = pc.Close()
+	}()
+	for {
+		msg, err := pc.conn.ReadClientMsg(time.Time{})
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case adc.ChatMessage:
+			m := newMessage(p, false, msg)
+			m.PM, m.Direct = true, true
+			c.dispatchMessage(m)
+		default:
+			log.Printf("unhandled PM command from %v: %T", p.Info().Id, msg)
+		}
+	}
+}
+
+// sendPM writes a private message to the direct connection.
+func (c *PeerConn) sendPM(ctx context.Context, timeouts Timeouts, msg adc.ChatMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deadline := timeouts.writeDeadline(ctx); !deadline.IsZero() {
+		_ = c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return withContext(ctx, c.conn, func() error {
+		if err := c.conn.WriteClientMsg(msg); err != nil {
+			return err
+		}
+		return c.conn.Flush()
+	})
+}
+
+// acceptPM connects to the peer that asked for a secure connection (CTM). If the peer
+// didn't negotiate CCPM, the connection is used to answer requests for our share.
+func (c *Conn) acceptPM(p *Peer, s adc.ConnectRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeouts.handshake())
+	defer cancel()
+	addr, err := p.addr(s.Port)
+	if err != nil {
+		log.Printf("cannot connect to %v: %v", p.Info().Id, err)
+		return
+	}
+	pc, err := p.dialAddr(ctx, addr, s.Proto, s.Token, ccpmExtensions())
+	if err != nil {
+		log.Printf("cannot connect to %v: %v", p.Info().Id, err)
+		return
+	}
+	if !pc.fea.IsSet(adc.FeaCCPM) {
+		// a regular connection; the peer wants something from our share
+		c.serveShare(pc)
+		return
+	}
+	c.addPM(p, pc)
+}
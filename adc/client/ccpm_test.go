@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func newTestSecureConn(t *testing.T, sid adc.SID, cid adc.CID) *Conn {
+	cert, err := GenerateCertificate()
+	require.NoError(t, err)
+	c := &Conn{sid: sid, cert: cert}
+	c.user.Id = cid
+	c.user.KP = adc.Keyprint(cert.Certificate[0])
+	return c
+}
+
+func TestCCPM(t *testing.T) {
+	alice := newTestSecureConn(t, adc.SID{'A', 'A', 'A', 'A'}, adc.CID{1})
+	bob := newTestSecureConn(t, adc.SID{'B', 'B', 'B', 'B'}, adc.CID{2})
+	defer alice.closePMs()
+	defer bob.closePMs()
+
+	fea := adc.ExtFeatures{adc.FeaADC0, adc.FeaCCPM, adc.FeaTCP4}
+	bobPeer := alice.peerJoins(bob.sid, adc.User{Id: bob.CID(), KP: bob.user.KP, Features: fea})
+	alicePeer := bob.peerJoins(alice.sid, adc.User{Id: alice.CID(), KP: alice.user.KP, Features: fea, Ip4: "127.0.0.1"})
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go alice.ServePeers(l, 0)
+
+	msgs := make(chan Message, 2)
+	alice.OnMessage(func(m Message) { msgs <- m })
+	bob.OnMessage(func(m Message) { msgs <- m })
+
+	// alice asks bob to connect (CTM), as done by UpgradePM
+	token, tok := alice.tokens.add(bob.CID(), adc.ProtoADCS)
+	bob.acceptPM(alicePeer, adc.ConnectRequest{
+		Proto: adc.ProtoADCS, Port: l.Addr().(*net.TCPAddr).Port, Token: token,
+	})
+	var pc *PeerConn
+	select {
+	case pc = <-tok.conn:
+	case err = <-tok.errc:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	require.True(t, pc.Secure())
+	require.True(t, pc.fea.IsSet(adc.FeaCCPM))
+	alice.addPM(bobPeer, pc)
+	require.True(t, alice.IsDirectPM(bobPeer))
+	require.True(t, bob.IsDirectPM(alicePeer))
+
+	ctx := context.Background()
+	require.NoError(t, bob.SendPM(ctx, alicePeer, "hi alice"))
+	m := <-msgs
+	require.True(t, m.From == bobPeer)
+	require.True(t, m.PM && m.Direct)
+	require.Equal(t, "hi alice", m.Text)
+
+	require.NoError(t, alice.SendPM(ctx, bobPeer, "hi bob"))
+	m = <-msgs
+	require.True(t, m.From == alicePeer)
+	require.True(t, m.PM && m.Direct)
+	require.Equal(t, "hi bob", m.Text)
+
+	// the other side notices that the conversation is no longer direct
+	require.NoError(t, alice.ClosePM(bobPeer))
+	require.False(t, alice.IsDirectPM(bobPeer))
+	for i := 0; i < 100 && bob.IsDirectPM(alicePeer); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.False(t, bob.IsDirectPM(alicePeer))
+}
+
+func TestCCPMKeyprint(t *testing.T) {
+	alice := newTestSecureConn(t, adc.SID{'A', 'A', 'A', 'A'}, adc.CID{1})
+	bob := newTestSecureConn(t, adc.SID{'B', 'B', 'B', 'B'}, adc.CID{2})
+	defer alice.closePMs()
+	defer bob.closePMs()
+
+	fea := adc.ExtFeatures{adc.FeaADC0, adc.FeaCCPM, adc.FeaTCP4}
+	alice.peerJoins(bob.sid, adc.User{Id: bob.CID(), KP: bob.user.KP, Features: fea})
+	// bob expects a different certificate
+	alicePeer := bob.peerJoins(alice.sid, adc.User{Id: alice.CID(), KP: bob.user.KP, Features: fea, Ip4: "127.0.0.1"})
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go alice.ServePeers(l, 0)
+
+	token, tok := alice.tokens.add(bob.CID(), adc.ProtoADCS)
+	bob.acceptPM(alicePeer, adc.ConnectRequest{
+		Proto: adc.ProtoADCS, Port: l.Addr().(*net.TCPAddr).Port, Token: token,
+	})
+	require.False(t, bob.IsDirectPM(alicePeer))
+	select {
+	case <-tok.conn:
+		t.Fatal("unexpected connection")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
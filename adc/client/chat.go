@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// Message is a chat message received from the hub or from a peer.
+type Message struct {
+	// From is the sender of the message. It's nil for messages sent by the hub
+	// and for our own messages echoed back by the hub.
+	From *Peer
+	// Self is set for our own messages echoed back by the hub.
+	Self bool
+	// PM is set for private messages.
+	PM bool
+	// Direct is set for private messages received over a direct connection (CCPM).
+	Direct bool
+	Text   string
+	// Me is set for third-person messages (/me).
+	Me   bool
+	Time time.Time
+}
+
+// MessageFunc is called for each chat message.
+type MessageFunc func(m Message)
+
+// OnMessage sets a function that will be called for each chat message received
+// from the hub, including private messages.
+func (c *Conn) OnMessage(fnc MessageFunc) {
+	c.chat.Lock()
+	c.chat.onMessage = fnc
+	c.chat.Unlock()
+}
+
+// SendChat sends a message to the main chat.
+func (c *Conn) SendChat(ctx context.Context, text string) error {
+	return c.writeBroadcast(ctx, adc.ChatMessage{Text: text})
+}
+
+// SendPM sends a private message to the peer.
+//
+// If the conversation was upgraded with UpgradePM, the message is sent over a direct
+// connection. If it fails, the direct connection is dropped and the message is sent
+// through the hub instead.
+func (c *Conn) SendPM(ctx context.Context, p *Peer, text string) error {
+	if pc := c.directPM(p); pc != nil {
+		err := pc.sendPM(ctx, c.timeouts, adc.ChatMessage{Text: text})
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		c.removePM(p, pc)
+		_ = pc.Close()
+	}
+	sid := p.getSID()
+	if sid == nil {
+		return ErrPeerOffline
+	}
+	from := c.SID()
+	return c.write(ctx, func(w *adc.Conn) error {
+		return w.WriteEcho(from, *sid, adc.ChatMessage{Text: text, PM: &from})
+	})
+}
+
+// handleMessage dispatches a chat message. It returns false if there is no handler.
+func (c *Conn) handleMessage(from *Peer, self bool, msg adc.ChatMessage) bool {
+	return c.dispatchMessage(newMessage(from, self, msg))
+}
+
+func newMessage(from *Peer, self bool, msg adc.ChatMessage) Message {
+	m := Message{
+		From: from, Self: self, PM: msg.PM != nil,
+		Text: msg.Text, Me: msg.Me,
+		Time: time.Now(),
+	}
+	if msg.TS != 0 {
+		m.Time = time.Unix(msg.TS, 0)
+	}
+	return m
+}
+
+// dispatchMessage calls the message handler. It returns false if there is no handler.
+func (c *Conn) dispatchMessage(m Message) bool {
+	c.chat.RLock()
+	fnc := c.chat.onMessage
+	c.chat.RUnlock()
+	if fnc == nil {
+		return false
+	}
+	fnc(m)
+	return true
+}
+
+func (c *Conn) handleEcho(cmd *adc.EchoPacket) error {
+	if cmd.ID == c.SID() {
+		// echo of our own message
+		return nil
+	} else if cmd.Targ != c.SID() {
+		// TODO: ADC flaw: same as for direct messages
+		log.Println("echo command to a wrong destination:", cmd.Targ)
+		return nil
+	}
+	msg, err := cmd.Decode()
+	if err != nil {
+		return err
+	}
+	switch msg := msg.(type) {
+	case adc.ChatMessage:
+		c.handleMessage(c.peerBySID(cmd.ID), false, msg)
+	default:
+		log.Printf("unhandled echo command: %v", cmd.Name)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestChatDispatch(t *testing.T) {
+	c := &Conn{sid: adc.SID{'A', 'A', 'A', 'A'}}
+	bob := c.peerJoins(adc.SID{'B', 'B', 'B', 'B'}, adc.User{Id: adc.CID{1}, Name: "bob"})
+
+	var got []Message
+	c.OnMessage(func(m Message) {
+		got = append(got, m)
+	})
+
+	data, err := adc.Marshal(adc.ChatMessage{Text: "hello all", Me: true})
+	require.NoError(t, err)
+	require.NoError(t, c.handleBroadcast(&adc.BroadcastPacket{
+		ID: adc.SID{'B', 'B', 'B', 'B'}, BasePacket: adc.BasePacket{Name: adc.ChatMessage{}.Cmd(), Data: data},
+	}))
+
+	data, err = adc.Marshal(adc.ChatMessage{Text: "hello", PM: &adc.SID{'B', 'B', 'B', 'B'}, TS: 100})
+	require.NoError(t, err)
+	require.NoError(t, c.handleEcho(&adc.EchoPacket{
+		ID: adc.SID{'B', 'B', 'B', 'B'}, Targ: c.sid,
+		BasePacket: adc.BasePacket{Name: adc.ChatMessage{}.Cmd(), Data: data},
+	}))
+	// our own echo
+	require.NoError(t, c.handleEcho(&adc.EchoPacket{
+		ID: c.sid, Targ: adc.SID{'B', 'B', 'B', 'B'},
+		BasePacket: adc.BasePacket{Name: adc.ChatMessage{}.Cmd(), Data: data},
+	}))
+
+	// our own broadcast echoed by the hub
+	data, err = adc.Marshal(adc.ChatMessage{Text: "hi"})
+	require.NoError(t, err)
+	require.NoError(t, c.handleBroadcast(&adc.BroadcastPacket{
+		ID: c.sid, BasePacket: adc.BasePacket{Name: adc.ChatMessage{}.Cmd(), Data: data},
+	}))
+
+	data, err = adc.Marshal(adc.ChatMessage{Text: "from hub"})
+	require.NoError(t, err)
+	require.NoError(t, c.handleInfo(&adc.InfoPacket{
+		BasePacket: adc.BasePacket{Name: adc.ChatMessage{}.Cmd(), Data: data},
+	}))
+
+	require.Len(t, got, 4)
+	require.True(t, got[0].From == bob)
+	require.True(t, got[0].Me)
+	require.False(t, got[0].PM)
+	require.Equal(t, "hello all", got[0].Text)
+
+	require.True(t, got[1].From == bob)
+	require.True(t, got[1].PM)
+	require.Equal(t, int64(100), got[1].Time.Unix())
+
+	require.Nil(t, got[2].From)
+	require.True(t, got[2].Self)
+	require.Equal(t, "hi", got[2].Text)
+
+	require.Nil(t, got[3].From)
+	require.False(t, got[3].Self)
+	require.Equal(t, "from hub", got[3].Text)
+}
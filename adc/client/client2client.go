@@ -2,9 +2,11 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sync"
 	"time"
 
@@ -17,20 +19,48 @@ var (
 )
 
 func (p *Peer) CanDial() bool {
-	// online and active
-	return p.Online() && p.Info().Features.Has(adc.FeaTCP4)
+	// online and either the peer or we are active
+	return p.Online() && (p.Info().Features.Has(adc.FeaTCP4) || p.hub.activePort() != 0)
 }
 
 // Dial tries to dial the peer either in passive or active mode.
+//
+// If both clients support secure connections, the connection uses ADCS.
 func (p *Peer) Dial(ctx context.Context) (*PeerConn, error) {
+	return p.dial(ctx, clientExtensions())
+}
+
+// dial connects to the peer and negotiates a given set of client-client features.
+func (p *Peer) dial(ctx context.Context, fea adc.ModFeatures) (*PeerConn, error) {
 	if !p.Online() {
 		return nil, ErrPeerOffline
 	}
-	// TODO: active mode
-	return p.dialPassive(ctx)
+	dial := p.dialPassive
+	if !p.Info().Features.Has(adc.FeaTCP4) {
+		if p.hub.activePort() == 0 {
+			return nil, ErrPeerPassive
+		}
+		dial = p.dialActive
+	}
+	var c *PeerConn
+	err := p.hub.retry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		c, err = dial(ctx, fea)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.fea.IsSet(adc.FeaCCPM) != fea.IsSet(adc.FeaCCPM) {
+		// PM connections cannot be used for file transfers and vice versa
+		_ = c.Close()
+		return nil, errors.New("unexpected connection type")
+	}
+	return c, nil
 }
 
-func (p *Peer) dialPassive(ctx context.Context) (*PeerConn, error) {
+// dialPassive asks the peer to send us an address to connect to (RCM).
+func (p *Peer) dialPassive(ctx context.Context, fea adc.ModFeatures) (*PeerConn, error) {
 	if !p.Info().Features.Has(adc.FeaTCP4) {
 		return nil, ErrPeerPassive
 	}
@@ -39,13 +69,12 @@ func (p *Peer) dialPassive(ctx context.Context) (*PeerConn, error) {
 		return nil, ErrPeerOffline
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	token, caddr, errc := p.hub.revConnToken(ctx, p.Info().Id)
+	proto := p.proto()
+	token, tok := p.hub.tokens.add(p.Info().Id, proto)
+	defer p.hub.tokens.remove(token)
 
-	err := p.hub.writeDirect(*sid, adc.RevConnectRequest{
-		Proto: adc.ProtoADC, Token: token,
+	err := p.hub.writeDirect(ctx, *sid, adc.RevConnectRequest{
+		Proto: proto, Token: token,
 	})
 	if err != nil {
 		return nil, err
@@ -54,23 +83,94 @@ func (p *Peer) dialPassive(ctx context.Context) (*PeerConn, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
-	case err = <-errc:
+	case err = <-tok.errc:
 		return nil, err
-	case addr := <-caddr:
-		pconn, err := adc.Dial(addr)
-		if err != nil {
-			return nil, err
+	case addr := <-tok.addr:
+		return p.dialAddr(ctx, addr, proto, token, fea)
+	}
+}
+
+// dialActive asks the peer to connect to our listener (CTM).
+//
+// The peer is the one to send features first, see handshakeAccept.
+func (p *Peer) dialActive(ctx context.Context, _ adc.ModFeatures) (*PeerConn, error) {
+	port := p.hub.activePort()
+	if port == 0 {
+		return nil, ErrPeerPassive
+	}
+	sid := p.getSID()
+	if sid == nil {
+		return nil, ErrPeerOffline
+	}
+
+	proto := p.proto()
+	token, tok := p.hub.tokens.add(p.Info().Id, proto)
+	defer func() {
+		p.hub.tokens.remove(token)
+		// the peer may have connected after we gave up
+		select {
+		case c := <-tok.conn:
+			_ = c.Close()
+		default:
 		}
-		fea, err := p.handshakePassive(pconn, token)
+	}()
+
+	err := p.hub.writeDirect(ctx, *sid, adc.ConnectRequest{
+		Proto: proto, Port: port, Token: token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err = <-tok.errc:
+		return nil, err
+	case c := <-tok.conn:
+		return c, nil
+	}
+}
+
+var peerDialer net.Dialer
+
+// dialAddr connects to the peer and runs the handshake.
+func (p *Peer) dialAddr(ctx context.Context, addr, proto, token string, ourFeatures adc.ModFeatures) (*PeerConn, error) {
+	conn, err := peerDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	secure := proto == adc.ProtoADCS
+	if secure {
+		tconn := tls.Client(conn, p.clientTLS())
+		_ = conn.SetDeadline(ctxDeadline(ctx, p.hub.timeouts.handshake()))
+		err = withContext(ctx, conn, tconn.Handshake)
+		_ = conn.SetDeadline(time.Time{})
 		if err != nil {
-			pconn.Close()
-			return nil, err
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %v", err)
 		}
-		return &PeerConn{p: p, conn: pconn, fea: fea}, nil
+		conn = tconn
+	}
+	pconn, err := adc.NewConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
 	}
+	var fea adc.ModFeatures
+	err = withContext(ctx, pconn, func() error {
+		var err error
+		fea, err = p.handshakePassive(ctx, pconn, token, ourFeatures)
+		return err
+	})
+	if err != nil {
+		pconn.Close()
+		return nil, err
+	}
+	return &PeerConn{p: p, conn: pconn, fea: fea, secure: secure}, nil
 }
 
-func (p *Peer) clientExtensions() adc.ModFeatures {
+func clientExtensions() adc.ModFeatures {
 	return adc.ModFeatures{
 		// should always be set for ADC
 		adc.FeaBASE: true,
@@ -81,11 +181,10 @@ func (p *Peer) clientExtensions() adc.ModFeatures {
 	}
 }
 
-func (p *Peer) handshakePassive(conn *adc.Conn, token string) (adc.ModFeatures, error) {
+func (p *Peer) handshakePassive(ctx context.Context, conn *adc.Conn, token string, ourFeatures adc.ModFeatures) (adc.ModFeatures, error) {
 	// we are dialing - send things upfront
 
 	// send our features
-	ourFeatures := p.clientExtensions()
 	err := conn.WriteClientMsg(adc.Supported{
 		Features: ourFeatures,
 	})
@@ -101,39 +200,7 @@ func (p *Peer) handshakePassive(conn *adc.Conn, token string) (adc.ModFeatures,
 		return nil, err
 	}
 
-	deadline := time.Now().Add(time.Second * 5)
-	// wait for a list of features
-	msg, err := conn.ReadClientMsg(deadline)
-	if err != nil {
-		return nil, err
-	}
-	sup, ok := msg.(adc.Supported)
-	if !ok {
-		return nil, fmt.Errorf("expected a list of peer's features, got: %#v", msg)
-	}
-	peerFeatures := sup.Features
-	if !peerFeatures.IsSet(adc.FeaBASE) || !peerFeatures.IsSet(adc.FeaTIGR) {
-		return nil, fmt.Errorf("no basic features support for peer: %v", peerFeatures)
-	}
-
-	// wait for an identification
-	msg, err = conn.ReadClientMsg(deadline)
-	if err != nil {
-		return nil, err
-	}
-	u, ok := msg.(adc.User)
-	if !ok {
-		return nil, fmt.Errorf("expected a peer's identity, got: %#v", msg)
-	} else if u.Id != p.Info().Id {
-		return nil, fmt.Errorf("wrong client connected: %v", u.Id)
-	}
-	return ourFeatures.Intersect(peerFeatures), nil
-}
-
-func (p *Peer) handshakeActive(conn *adc.Conn, token string) (adc.ModFeatures, error) {
-	// we are accepting the connection, so wait for a message from peer
-	deadline := time.Now().Add(time.Second * 5)
-
+	deadline := ctxDeadline(ctx, p.hub.timeouts.handshake())
 	// wait for a list of features
 	msg, err := conn.ReadClientMsg(deadline)
 	if err != nil {
@@ -148,19 +215,6 @@ func (p *Peer) handshakeActive(conn *adc.Conn, token string) (adc.ModFeatures, e
 		return nil, fmt.Errorf("no basic features support for peer: %v", peerFeatures)
 	}
 
-	// send our features
-	ourFeatures := p.clientExtensions()
-	err = conn.WriteClientMsg(adc.Supported{
-		Features: ourFeatures,
-	})
-	if err != nil {
-		return nil, err
-	}
-	err = conn.Flush()
-	if err != nil {
-		return nil, err
-	}
-
 	// wait for an identification
 	msg, err = conn.ReadClientMsg(deadline)
 	if err != nil {
@@ -171,31 +225,22 @@ func (p *Peer) handshakeActive(conn *adc.Conn, token string) (adc.ModFeatures, e
 		return nil, fmt.Errorf("expected a peer's identity, got: %#v", msg)
 	} else if u.Id != p.Info().Id {
 		return nil, fmt.Errorf("wrong client connected: %v", u.Id)
-	} else if u.Token != token {
-		return nil, errors.New("wrong auth token")
 	}
-
-	// identify ourselves
-	err = conn.WriteClientMsg(adc.User{
-		Id: p.hub.CID(),
-	})
-	if err != nil {
-		return nil, err
-	}
-	err = conn.Flush()
-	if err != nil {
-		return nil, err
-	}
-
 	return ourFeatures.Intersect(peerFeatures), nil
 }
 
 type PeerConn struct {
-	p   *Peer
-	fea adc.ModFeatures
+	p      *Peer
+	fea    adc.ModFeatures
+	secure bool
 
 	mu   sync.Mutex
 	conn *adc.Conn
+
+	browse struct {
+		sync.Mutex
+		browseCache
+	}
 }
 
 func (c *PeerConn) Close() error {
@@ -206,6 +251,11 @@ func (c *PeerConn) Peer() *Peer {
 	return c.p
 }
 
+// Secure checks if the connection uses TLS (ADCS).
+func (c *PeerConn) Secure() bool {
+	return c.secure
+}
+
 type FileInfo struct {
 	Size int64
 	TTH  *adc.TTH
@@ -220,58 +270,79 @@ type File interface {
 	TTH() *adc.TTH
 }
 
-func (c *PeerConn) statFile(ctx context.Context, typ, path string) (*adc.SearchResult, error) {
-	deadline, ok := ctx.Deadline()
-	if !ok {
-		deadline = time.Now().Add(time.Second * 3)
+// timeout returns the time allowed for a single request.
+func (c *PeerConn) timeout() time.Duration {
+	if c.p == nil || c.p.hub == nil {
+		return DefaultHandshakeTimeout
 	}
+	return c.p.hub.timeouts.handshake()
+}
+
+// request sends a request to the peer and waits for a response.
+// The connection is closed if the context is cancelled before the response is received.
+func (c *PeerConn) request(ctx context.Context, req adc.Message, timeout time.Duration) (adc.Message, error) {
+	deadline := ctxDeadline(ctx, timeout)
+	var resp adc.Message
+	err := withContext(ctx, c.conn, func() error {
+		err := c.conn.WriteClientMsg(req)
+		if err != nil {
+			return err
+		}
+		err = c.conn.Flush()
+		if err != nil {
+			return err
+		}
+		resp, err = c.conn.ReadClientMsg(deadline)
+		return err
+	})
+	return resp, err
+}
+
+func (c *PeerConn) statFile(ctx context.Context, typ, path string) (*adc.SearchResult, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	err := c.conn.WriteClientMsg(adc.GetInfoRequest{
+	msg, err := c.request(ctx, adc.GetInfoRequest{
 		Type: typ, Path: path,
-	})
-	if err != nil {
-		return nil, err
-	}
-	err = c.conn.Flush()
+	}, c.timeout())
 	if err != nil {
 		return nil, err
 	}
-	msg, err := c.conn.ReadClientMsg(deadline)
-	if err != nil {
-		return nil, err
-	}
-	res, ok := msg.(adc.SearchResult)
-	if !ok {
-		return nil, fmt.Errorf("expected file info (search) response, got: %#v", msg)
+	switch msg := msg.(type) {
+	case adc.SearchResult:
+		return &msg, nil
+	case adc.Status:
+		if err := msg.Err(); err != nil {
+			return nil, err
+		}
 	}
-	return &res, nil
+	return nil, fmt.Errorf("expected file info (search) response, got: %#v", msg)
 }
 
 func (c *PeerConn) readFile(ctx context.Context, typ, path string, off, size int64) (io.ReadCloser, error) {
-	deadline, ok := ctx.Deadline()
-	if !ok {
-		deadline = time.Now().Add(time.Second * 5)
-	}
 	if size <= 0 {
 		size = -1
 	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	err := c.conn.WriteClientMsg(adc.GetRequest{
+	return c.get(ctx, adc.GetRequest{
 		Type: typ, Path: path,
 		Start: off, Bytes: size,
 	})
+}
+
+// get sends a file request to the peer and returns the file contents.
+// If the context is cancelled while reading the file, the connection is closed.
+func (c *PeerConn) get(ctx context.Context, req adc.GetRequest) (io.ReadCloser, error) {
+	typ, path, off := req.Type, req.Path, req.Start
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg, err := c.request(ctx, req, c.timeout())
 	if err != nil {
 		return nil, err
 	}
-	err = c.conn.Flush()
-	if err != nil {
-		return nil, err
-	}
-	msg, err := c.conn.ReadClientMsg(deadline)
-	if err != nil {
-		return nil, err
+	if st, ok := msg.(adc.Status); ok {
+		// the peer may report a queue position if all slots are taken, see adc.QueuePos
+		if err = st.Err(); err != nil {
+			return nil, err
+		}
 	}
 	res, ok := msg.(adc.GetResponse)
 	if !ok {
@@ -289,14 +360,14 @@ func (c *PeerConn) readFile(ctx context.Context, typ, path string, off, size int
 	// it's safe to unlock the mutex here since the underlying conn
 	// will be blocked and other requests will wait for this one complete
 	// TODO: open a new connection if we get another read request
-	//return c.conn.ReadBinary(res.Bytes), nil
-	return nil, fmt.Errorf("file download not supported")
+	return newCtxReader(ctx, c.conn, c.conn.ReadBinary(res.Bytes)), nil
 }
 
+// StatFile requests the size and TTH of a remote file without downloading it (GFI).
+// If the peer doesn't have the file, os.ErrNotExist is returned.
 func (c *PeerConn) StatFile(ctx context.Context, path string) (FileInfo, error) {
 	info, err := c.statFile(ctx, "file", path)
 	if err != nil {
-		// TODO: handle not found error
 		return FileInfo{}, err
 	}
 	return FileInfo{Size: info.Size, TTH: info.TTH}, nil
@@ -305,7 +376,6 @@ func (c *PeerConn) StatFile(ctx context.Context, path string) (FileInfo, error)
 func (c *PeerConn) GetFile(ctx context.Context, path string) (File, error) {
 	info, err := c.statFile(ctx, "file", path)
 	if err != nil {
-		// TODO: handle not found error
 		return nil, err
 	}
 	return &peerFile{c: c, typ: "file", path: path, info: *info}, nil
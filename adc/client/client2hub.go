@@ -2,10 +2,11 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"net"
 	"strconv"
 	"sync"
 	"time"
@@ -16,17 +17,96 @@ import (
 
 // DialHub connects to a hub and runs a handshake.
 func DialHub(addr string, info *Config) (*Conn, error) {
-	conn, err := adc.Dial(addr)
+	return DialHubContext(context.Background(), addr, info)
+}
+
+// DialHubContext connects to a hub and runs a handshake.
+// Failed attempts are retried according to the Retry policy in the config.
+//
+// The context only controls the connection setup; cancelling it after the function
+// returns has no effect on the connection.
+func DialHubContext(ctx context.Context, addr string, info *Config) (*Conn, error) {
+	if err := info.validate(); err != nil {
+		return nil, err
+	}
+	if info.Indexer != nil && info.MinHashed > 0 {
+		if err := info.Indexer.WaitHashed(ctx, info.MinHashed); err != nil {
+			return nil, err
+		}
+	}
+	dialer := info.Dialer
+	if dialer == nil {
+		dialer = &adc.Dialer{}
+	}
+	var c *Conn
+	err := info.Retry.Do(ctx, func(ctx context.Context) error {
+		conn, err := dialer.DialContext(ctx, addr)
+		if err != nil {
+			return err
+		}
+		c, err = HubHandshakeContext(ctx, conn, info)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return HubHandshake(conn, info)
+	return c, nil
 }
 
 type Config struct {
 	PID        adc.PID
 	Name       string
 	Extensions adc.ExtFeatures
+	// Features is a set of protocol extensions supported by the client.
+	// Handlers in the set are called with the client *Conn as a session.
+	// If not set, DefaultFeatures is used.
+	Features *adc.FeatureSet
+	// Timeouts for the hub connection and for client-client connections.
+	Timeouts Timeouts
+	// Retry is a policy for retrying hub and peer dials. No retries are made if not set.
+	Retry *RetryPolicy
+	// Dialer is used to connect to the hub. It resolves SRV records for addresses without a port
+	// and tries all addresses of the hub. If not set, a Dialer with default timeouts is used.
+	Dialer *adc.Dialer
+	// Certificate is used for secure client-client connections (ADCS).
+	// If not set, a self-signed certificate is generated.
+	Certificate *tls.Certificate
+	// DisableTLS disables secure client-client connections.
+	DisableTLS bool
+	// Share is a set of files exposed on this hub, for example a ShareProfile.
+	// It can be changed later with SetShare.
+	Share Share
+	// Indexer that builds the share. If set, DialHub waits until at least MinHashed
+	// fraction (from 0 to 1) of the share size is hashed before connecting to the hub.
+	Indexer   *Indexer
+	MinHashed float64
+	// UDP is a server that receives search results in active mode. If set, the client
+	// advertises the UDP4 extension with the port of the server. The default handler
+	// of the server is replaced, thus it cannot be shared between hub connections.
+	UDP *adc.UDPServer
+	// Previous is an earlier connection to the same hub. If the hub supports the DLTA extension,
+	// the user list of that connection is reused, and only the changes are received.
+	Previous *Conn
+}
+
+// DefaultFeatures returns a default set of protocol extensions supported by the client.
+func DefaultFeatures() *adc.FeatureSet {
+	fea := adc.NewFeatureSet(
+		// extensions
+
+		// TODO: some hubs will stop the handshake after sending the hub info
+		//       if this extension is specified
+		//adc.FeaPING,
+
+		adc.FeaBZIP,
+		adc.FeaHBRI,
+		adc.FeaDLTA,
+		// TODO: ZLIG
+	)
+	// should always be set for ADC
+	fea.Require(adc.FeaBASE, adc.FeaBAS0)
+	fea.Require(adc.FeaTIGR)
+	return fea
 }
 
 func (c *Config) validate() error {
@@ -41,65 +121,116 @@ func (c *Config) validate() error {
 
 // HubHandshake begins a Client-Hub handshake on a connection.
 func HubHandshake(conn *adc.Conn, conf *Config) (*Conn, error) {
+	return HubHandshakeContext(context.Background(), conn, conf)
+}
+
+// HubHandshakeContext begins a Client-Hub handshake on a connection.
+// The connection is closed if the context is cancelled before the handshake completes.
+func HubHandshakeContext(ctx context.Context, conn *adc.Conn, conf *Config) (*Conn, error) {
 	if err := conf.validate(); err != nil {
 		return nil, err
 	}
-	sid, mutual, err := protocolToHub(conn)
+	features := conf.Features
+	if features == nil {
+		features = DefaultFeatures()
+	}
+	var c *Conn
+	err := withContext(ctx, conn, func() error {
+		var err error
+		c, err = hubHandshake(ctx, conn, conf, features)
+		return err
+	})
 	if err != nil {
 		_ = conn.Close()
 		return nil, err
 	}
+	//c.conn.KeepAlive(time.Minute / 2)
+	go c.readLoop()
+	if conf.Share != nil {
+		c.SetShare(conf.Share)
+	}
+	if conf.UDP != nil {
+		c.udp = conf.UDP.HandleDefault(c.HandleUDP)
+	}
+	return c, nil
+}
+
+func hubHandshake(ctx context.Context, conn *adc.Conn, conf *Config, features *adc.FeatureSet) (*Conn, error) {
+	sid, mutual, err := protocolToHub(ctx, conn, features, conf.Timeouts.handshake())
+	if err != nil {
+		return nil, err
+	}
 	c := &Conn{
 		conn: conn,
 		sid:  sid, pid: conf.PID,
-		fea:     mutual,
-		closing: make(chan struct{}),
-		closed:  make(chan struct{}),
+		timeouts: conf.Timeouts,
+		retry:    conf.Retry,
+		fea:      mutual,
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
 	}
 	c.user.Pid = &conf.PID
 	c.user.Name = conf.Name
-	c.user.Features = conf.Extensions
+	c.user.Features = append(adc.ExtFeatures{}, conf.Extensions...)
 	c.user.Slots = 1
+	if st, ok := conf.Share.(ShareStats); ok {
+		c.user.ShareSize, c.user.ShareFiles = st.Stats()
+	}
+
+	if !conf.DisableTLS {
+		c.cert = conf.Certificate
+		if c.cert == nil {
+			c.cert, err = GenerateCertificate()
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.user.KP = adc.Keyprint(c.cert.Certificate[0])
+		for _, f := range []adc.Feature{adc.FeaADC0, adc.FeaCCPM} {
+			if !c.user.Features.Has(f) {
+				c.user.Features = append(c.user.Features, f)
+			}
+		}
+	}
 
+	if conf.UDP != nil {
+		addr, ok := conf.UDP.Addr().(*net.UDPAddr)
+		if !ok {
+			return nil, fmt.Errorf("cannot detect the port for %v", conf.UDP.Addr())
+		}
+		c.user.Udp4 = addr.Port
+		if !c.user.Features.Has(adc.FeaUDP4) {
+			c.user.Features = append(c.user.Features, adc.FeaUDP4)
+		}
+	}
+
+	if conf.Previous != nil && mutual.IsSet(adc.FeaDLTA) {
+		c.user.ListVersion = conf.Previous.listVersion()
+	}
 	if err := identifyToHub(conn, sid, &c.user); err != nil {
-		conn.Close()
+		return nil, err
+	}
+	c.user.ListVersion = ""
+	if err := features.Activate(mutual, c); err != nil {
 		return nil, err
 	}
 	c.ext = make(map[adc.Feature]struct{})
 	for _, ext := range c.user.Features {
 		c.ext[ext] = struct{}{}
 	}
-	if err := c.acceptUsersList(); err != nil {
-		conn.Close()
+	if err := c.acceptUsersList(ctx, conf.Previous); err != nil {
 		return nil, err
 	}
-	//c.conn.KeepAlive(time.Minute / 2)
-	go c.readLoop()
 	return c, nil
 }
 
-func protocolToHub(conn *adc.Conn) (adc.SID, adc.ModFeatures, error) {
-	ourFeatures := adc.ModFeatures{
-		// should always be set for ADC
-		adc.FeaBASE: true,
-		adc.FeaBAS0: true,
-		adc.FeaTIGR: true,
-		// extensions
-
-		// TODO: some hubs will stop the handshake after sending the hub info
-		//       if this extension is specified
-		//adc.FeaPING: true,
-
-		adc.FeaBZIP: true,
-		// TODO: ZLIG
-	}
-
+func protocolToHub(ctx context.Context, conn *adc.Conn, features *adc.FeatureSet, timeout time.Duration) (adc.SID, adc.ModFeatures, error) {
 	// Send supported features (SUP), initiating the PROTOCOL state.
 	// We expect SUP followed by SID to transition to IDENTIFY.
 	//
 	// https://adc.sourceforge.io/ADC.html#_protocol
 	err := conn.WriteHubMsg(adc.Supported{
-		Features: ourFeatures,
+		Features: features.Features(),
 	})
 	if err != nil {
 		return adc.SID{}, nil, err
@@ -108,7 +239,7 @@ func protocolToHub(conn *adc.Conn) (adc.SID, adc.ModFeatures, error) {
 		return adc.SID{}, nil, err
 	}
 	// shouldn't take longer than this
-	deadline := time.Now().Add(time.Second * 5)
+	deadline := ctxDeadline(ctx, timeout)
 
 	// first, we expect a SUP from the hub with a list of supported features
 	msg, err := conn.ReadInfoMsg(deadline)
@@ -122,11 +253,9 @@ func protocolToHub(conn *adc.Conn) (adc.SID, adc.ModFeatures, error) {
 	hubFeatures := sup.Features
 
 	// check mutual features
-	mutual := ourFeatures.Intersect(hubFeatures)
-	if !mutual.IsSet(adc.FeaBASE) && !mutual.IsSet(adc.FeaBAS0) {
-		return adc.SID{}, nil, fmt.Errorf("hub does not support BASE")
-	} else if !mutual.IsSet(adc.FeaTIGR) {
-		return adc.SID{}, nil, fmt.Errorf("hub does not support TIGR")
+	mutual, err := features.Negotiate(hubFeatures)
+	if err != nil {
+		return adc.SID{}, nil, err
 	}
 
 	// next, we expect a SID that will assign a Session ID
@@ -154,7 +283,7 @@ func identifyToHub(conn *adc.Conn, sid adc.SID, user *adc.User) error {
 		user.Application = version.Name
 		user.Version = version.Vers
 	}
-	for _, f := range []adc.Feature{adc.FeaSEGA, adc.FeaTCP4} {
+	for _, f := range []adc.Feature{adc.FeaSEGA, adc.FeaASCH, adc.FeaTCP4} {
 		if !user.Features.Has(f) {
 			user.Features = append(user.Features, f)
 		}
@@ -173,8 +302,13 @@ func identifyToHub(conn *adc.Conn, sid adc.SID, user *adc.User) error {
 // Conn represents a Client-to-Hub connection.
 type Conn struct {
 	conn *adc.Conn
+	wmu  sync.Mutex // serializes write batches
 	fea  adc.ModFeatures
 
+	timeouts Timeouts
+	retry    *RetryPolicy
+	cert     *tls.Certificate // for client-client TLS
+
 	closing chan struct{}
 	closed  chan struct{}
 
@@ -191,19 +325,57 @@ type Conn struct {
 		byCID map[adc.CID]*Peer
 		// only keeps online users
 		bySID map[adc.SID]*Peer
+		// version of the user list (DLTA extension)
+		version string
 	}
 
-	revConn struct {
+	// tokens sent in RCM and CTM commands
+	tokens connTokens
+
+	// removes the search results handler, see Config.UDP
+	udp func()
+
+	// client-client listener, see ServePeers
+	active struct {
+		sync.RWMutex
+		port int
+	}
+
+	search struct {
 		sync.Mutex
-		tokens map[string]revConnToken
+		tokens map[string]*activeSearch
+	}
+
+	partial struct {
+		sync.RWMutex
+		share    PartialShare
+		onSource PartialSourceFunc
 	}
-}
 
-type revConnToken struct {
-	cid    adc.CID
-	cancel <-chan struct{}
-	addr   chan string
-	errc   chan error
+	// files answered in GFI requests, see SetShare
+	share struct {
+		sync.RWMutex
+		files Share
+		stop  chan struct{}
+	}
+
+	// upload slots advertised to peers, see SetSlots
+	slots struct {
+		sync.RWMutex
+		s    *Slots
+		stop chan struct{}
+	}
+
+	chat struct {
+		sync.RWMutex
+		onMessage MessageFunc
+	}
+
+	// direct PM connections, see UpgradePM
+	ccpm struct {
+		sync.Mutex
+		conns map[adc.CID]*PeerConn
+	}
 }
 
 // PID returns Private ID associated with this connection.
@@ -222,6 +394,9 @@ func (c *Conn) Hub() adc.HubInfo { return c.hub }
 // Features returns a set of negotiated features.
 func (c *Conn) Features() adc.ModFeatures { return c.fea.Clone() }
 
+// HasFeature checks if the extension is supported by both the client and the hub.
+func (c *Conn) HasFeature(f adc.Feature) bool { return c.fea.IsSet(f) }
+
 func (c *Conn) Close() error {
 	select {
 	case <-c.closing:
@@ -230,42 +405,51 @@ func (c *Conn) Close() error {
 	default:
 	}
 	close(c.closing)
+	if c.udp != nil {
+		c.udp()
+	}
+	c.closePMs()
 	err := c.conn.Close()
 	<-c.closed
 	return err
 }
 
-func (c *Conn) writeDirect(to adc.SID, msg adc.Message) error {
-	if err := c.conn.WriteDirect(c.SID(), to, msg); err != nil {
+// write runs a batch of writes on the hub connection and flushes it.
+//
+// If the context is cancelled before the batch is written, the connection is closed,
+// since the stream may be left with a partially written command.
+func (c *Conn) write(ctx context.Context, fnc func(w *adc.Conn) error) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	return c.conn.Flush()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if deadline := c.timeouts.writeDeadline(ctx); !deadline.IsZero() {
+		_ = c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return withContext(ctx, c.conn, func() error {
+		if err := fnc(c.conn); err != nil {
+			return err
+		}
+		return c.conn.Flush()
+	})
 }
 
-func (c *Conn) revConnToken(ctx context.Context, cid adc.CID) (token string, addr <-chan string, _ <-chan error) {
-	ch := make(chan string, 1)
-	errc := make(chan error, 1)
-	for {
-		tok := strconv.Itoa(rand.Int())
-		c.revConn.Lock()
-		_, ok := c.revConn.tokens[tok]
-		if !ok {
-			if c.revConn.tokens == nil {
-				c.revConn.tokens = make(map[string]revConnToken)
-			}
-			c.revConn.tokens[tok] = revConnToken{cancel: ctx.Done(), cid: cid, addr: ch, errc: errc}
-			c.revConn.Unlock()
-			return tok, ch, errc
-		}
-		c.revConn.Unlock()
-		// collision, pick another token
-	}
+func (c *Conn) writeDirect(ctx context.Context, to adc.SID, msg adc.Message) error {
+	return c.write(ctx, func(w *adc.Conn) error {
+		return w.WriteDirect(c.SID(), to, msg)
+	})
 }
 
 func (c *Conn) readLoop() {
 	defer close(c.closed)
 	for {
-		cmd, err := c.conn.ReadPacket(time.Time{})
+		var deadline time.Time
+		if c.timeouts.ReadIdle > 0 {
+			deadline = time.Now().Add(c.timeouts.ReadIdle)
+		}
+		cmd, err := c.conn.ReadPacket(deadline)
 		if err != nil {
 			log.Println(err)
 			return
@@ -297,6 +481,11 @@ func (c *Conn) readLoop() {
 				log.Println(err)
 				return
 			}
+		case *adc.EchoPacket:
+			if err := c.handleEcho(cmd); err != nil {
+				log.Println(err)
+				return
+			}
 		default:
 			log.Printf("unhandled command: %T", cmd)
 		}
@@ -315,7 +504,13 @@ func (c *Conn) handleBroadcast(p *adc.BroadcastPacket) error {
 		// async decoding
 		go c.handleSearch(peer, p.Data)
 		return nil
-	// TODO: MSG
+	case (adc.ChatMessage{}).Cmd():
+		var msg adc.ChatMessage
+		if err := adc.Unmarshal(p.Data, &msg); err != nil {
+			return err
+		}
+		c.handleMessage(c.peerBySID(p.ID), p.ID == c.sid, msg)
+		return nil
 	default:
 		log.Printf("unhandled broadcast command: %v", p.Name)
 		return nil
@@ -331,7 +526,9 @@ func (c *Conn) handleInfo(p *adc.InfoPacket) error {
 	case adc.ChatMessage:
 		// TODO: ADC: maybe hub should take a AAAA SID for itself
 		//       and this will become B-MSG AAAA, instead of I-MSG
-		fmt.Printf("%s\n", msg.Text)
+		if !c.handleMessage(nil, false, msg) {
+			fmt.Printf("%s\n", msg.Text)
+		}
 		return nil
 	case adc.Disconnect:
 		// TODO: ADC flaw: this should be B-QUI, not I-QUI
@@ -370,43 +567,54 @@ func (c *Conn) handleDirect(cmd *adc.DirectPacket) error {
 	}
 	switch msg := msg.(type) {
 	case adc.ConnectRequest:
-		c.revConn.Lock()
-		tok, ok := c.revConn.tokens[msg.Token]
-		delete(c.revConn.tokens, msg.Token)
-		c.revConn.Unlock()
+		p := c.peerBySID(cmd.ID)
+		tok, ok := c.tokens.take(msg.Token)
 		if !ok {
+			if p != nil && msg.Proto == adc.ProtoADCS && c.ccpmEnabled() {
+				// the peer may ask for a direct PM connection or a regular one
+				go c.acceptPM(p, msg)
+				return nil
+			}
+			if p != nil && c.getShare() != nil {
+				go c.acceptShare(p, msg)
+				return nil
+			}
 			// TODO: handle a direct connection request from peers
 			log.Printf("ignoring connection attempt from %v", cmd.ID)
 			return nil
 		}
-		p := c.peerBySID(cmd.ID)
 		go c.handleConnReq(p, tok, msg)
 		return nil
+	case adc.SearchResult:
+		c.handleResult(c.peerBySID(cmd.ID), cmd.ID.String(), msg)
+		return nil
+	case adc.PartialResult:
+		go c.handlePartial(c.peerBySID(cmd.ID), msg)
+		return nil
+	case adc.ChatMessage:
+		c.handleMessage(c.peerBySID(cmd.ID), false, msg)
+		return nil
 	default:
 		log.Printf("unhandled direct command: %v", cmd.Name)
 		return nil
 	}
 }
 
-func (c *Conn) handleConnReq(p *Peer, tok revConnToken, s adc.ConnectRequest) {
+func (c *Conn) handleConnReq(p *Peer, tok *connToken, s adc.ConnectRequest) {
 	if p == nil {
 		tok.errc <- ErrPeerOffline
 		return
 	}
-	if s.Proto != adc.ProtoADC {
-		tok.errc <- fmt.Errorf("unsupported protocol: %q", s.Proto)
-		return
-	}
-	if s.Port == 0 {
-		tok.errc <- errors.New("no port to connect to")
+	if s.Proto != tok.proto {
+		tok.errc <- fmt.Errorf("expected %q protocol, got %q", tok.proto, s.Proto)
 		return
 	}
-	addr := p.Info().Ip4
-	if addr == "" {
-		tok.errc <- errors.New("no address to connect to")
+	addr, err := p.addr(s.Port)
+	if err != nil {
+		tok.errc <- err
 		return
 	}
-	tok.addr <- addr + ":" + strconv.Itoa(s.Port)
+	tok.addr <- addr
 }
 
 func (c *Conn) handleSearch(p *Peer, data []byte) {
@@ -416,6 +624,8 @@ func (c *Conn) handleSearch(p *Peer, data []byte) {
 		return
 	}
 	log.Printf("search: %+v", sch)
+	c.answerPartialSearch(p, sch)
+	c.answerSearch(p, sch)
 }
 
 func (c *Conn) OnlinePeers() []*Peer {
@@ -434,6 +644,13 @@ func (c *Conn) peerBySID(sid adc.SID) *Peer {
 	return p
 }
 
+func (c *Conn) peerByCID(cid adc.CID) *Peer {
+	c.peers.RLock()
+	p := c.peers.byCID[cid]
+	c.peers.RUnlock()
+	return p
+}
+
 func (c *Conn) peerJoins(sid adc.SID, u adc.User) *Peer {
 	c.peers.Lock()
 	defer c.peers.Unlock()
@@ -494,15 +711,44 @@ func (c *Conn) peerUpdate(sid adc.SID, data []byte) error {
 	return nil
 }
 
-func (c *Conn) acceptUsersList() error {
+// listVersion returns the version of the user list received from the hub, if it supports DLTA.
+func (c *Conn) listVersion() string {
+	c.peers.RLock()
+	defer c.peers.RUnlock()
+	return c.peers.version
+}
+
+// copyPeers copies the user list from a previous connection to the hub.
+func (c *Conn) copyPeers(prev *Conn) {
+	prev.peers.RLock()
+	defer prev.peers.RUnlock()
+	c.peers.Lock()
+	defer c.peers.Unlock()
+	c.peers.bySID = make(map[adc.SID]*Peer, len(prev.peers.bySID))
+	c.peers.byCID = make(map[adc.CID]*Peer, len(prev.peers.byCID))
+	for cid, p := range prev.peers.byCID {
+		p.mu.RLock()
+		u := *p.user
+		p2 := &Peer{hub: c, user: &u}
+		if p.sid != nil {
+			c.peers.bySID[*p.sid] = p2
+			p2.online(*p.sid)
+		}
+		p.mu.RUnlock()
+		c.peers.byCID[cid] = p2
+	}
+}
+
+func (c *Conn) acceptUsersList(ctx context.Context, prev *Conn) error {
 	// https://adc.sourceforge.io/ADC.html#_identify
 
-	deadline := time.Now().Add(time.Minute)
+	deadline := ctxDeadline(ctx, time.Minute)
 	// Accept commands in the following order:
 	// 1) Hub info (I-INF)
 	// 2) Status (I-STA, optional)
-	// 3) User info (B-INF, xN)
-	// 3.1) Our own info (B-INF)
+	// 3) User list version (I-ULS, DLTA extension only)
+	// 4) User info (B-INF, xN), or a delta: users that left (I-QUI) and changed (B-INF)
+	// 4.1) Our own info (B-INF)
 	const (
 		hubInfo = iota
 		optStatus
@@ -516,6 +762,40 @@ func (c *Conn) acceptUsersList() error {
 		}
 		switch cmd := cmd.(type) {
 		case *adc.InfoPacket:
+			if cmd.Name == (adc.HybridBridge{}).Cmd() && stage == hubInfo {
+				// hub validates our address of the other IP version
+				var req adc.HybridBridge
+				if err := adc.Unmarshal(cmd.Data, &req); err != nil {
+					return err
+				}
+				if err := hybridBridge(ctx, req, c.timeouts.handshake()); err != nil {
+					log.Printf("cannot validate the address with the hub: %v", err)
+				}
+				continue
+			}
+			if cmd.Name == (adc.UserListSync{}).Cmd() && stage != hubInfo {
+				var ls adc.UserListSync
+				if err := adc.Unmarshal(cmd.Data, &ls); err != nil {
+					return err
+				}
+				if ls.Delta && prev != nil {
+					c.copyPeers(prev)
+				}
+				c.peers.Lock()
+				c.peers.version = ls.Version
+				c.peers.Unlock()
+				stage = userList
+				continue
+			}
+			if cmd.Name == (adc.Disconnect{}).Cmd() && stage == userList {
+				// user left since the previous connection
+				var q adc.Disconnect
+				if err := adc.Unmarshal(cmd.Data, &q); err != nil {
+					return err
+				}
+				_ = c.peerQuit(q.ID)
+				continue
+			}
 			switch stage {
 			case hubInfo:
 				// waiting for hub info
@@ -599,6 +879,18 @@ func (p *Peer) getSID() *adc.SID {
 	return sid
 }
 
+// addr returns the address of the peer for a given port.
+func (p *Peer) addr(port int) (string, error) {
+	if port == 0 {
+		return "", errors.New("no port to connect to")
+	}
+	ip := p.Info().Ip4
+	if ip == "" {
+		return "", errors.New("no address to connect to")
+	}
+	return ip + ":" + strconv.Itoa(port), nil
+}
+
 func (p *Peer) Online() bool {
 	return p.getSID() != nil
 }
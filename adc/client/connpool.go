@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const (
+	// DefaultMaxDials is the default number of concurrent outgoing dials made by a pool.
+	DefaultMaxDials = 5
+	// DefaultIdleTimeout is the default time after which idle pooled connections are closed.
+	DefaultIdleTimeout = 2 * time.Minute
+)
+
+// ErrPoolClosed is returned when requesting a connection from a closed pool.
+var ErrPoolClosed = errors.New("connection pool is closed")
+
+// PoolConfig configures a pool of client-client connections.
+type PoolConfig struct {
+	// MaxDials limits the number of concurrent outgoing dials.
+	// Zero value means DefaultMaxDials.
+	MaxDials int
+	// IdleTimeout is the time after which unused connections are closed.
+	// Zero value means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+}
+
+// ConnPool reuses client-client connections for multiple requests to the same peer.
+//
+// The pool keeps a single connection per peer CID, since peers usually don't grant more
+// than one slot to the same user. The connection is leased to one user at a time;
+// other users of the same peer wait for it to be released, instead of dialing the peer again.
+type ConnPool struct {
+	conf  PoolConfig
+	dials chan struct{} // limits concurrent dials
+
+	// dial is used by tests
+	dial func(ctx context.Context, p *Peer) (*PeerConn, error)
+
+	mu     sync.Mutex
+	closed bool
+	peers  map[adc.CID]*poolEntry
+}
+
+type poolEntry struct {
+	lease chan struct{} // held by the user of the connection
+	users int           // number of users holding or waiting for the lease
+	conn  *PeerConn
+	used  time.Time
+	timer *time.Timer
+}
+
+// NewConnPool creates a connection pool with a given config.
+func NewConnPool(conf PoolConfig) *ConnPool {
+	if conf.MaxDials <= 0 {
+		conf.MaxDials = DefaultMaxDials
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = DefaultIdleTimeout
+	}
+	return &ConnPool{
+		conf:  conf,
+		dials: make(chan struct{}, conf.MaxDials),
+		peers: make(map[adc.CID]*poolEntry),
+		dial: func(ctx context.Context, p *Peer) (*PeerConn, error) {
+			return p.Dial(ctx)
+		},
+	}
+}
+
+// Get returns a connection to the peer. It reuses an idle connection, waits for the
+// connection to be released by another user, or dials the peer.
+//
+// The connection must be returned to the pool with PooledConn.Release.
+func (p *ConnPool) Get(ctx context.Context, peer *Peer) (*PooledConn, error) {
+	cid := peer.Info().Id
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	e := p.peers[cid]
+	if e == nil {
+		e = &poolEntry{lease: make(chan struct{}, 1)}
+		p.peers[cid] = e
+	}
+	e.users++
+	p.mu.Unlock()
+
+	select {
+	case e.lease <- struct{}{}:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.unref(cid, e)
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		p.release(cid, e, ErrPoolClosed)
+		return nil, ErrPoolClosed
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	if e.conn == nil {
+		c, err := p.dialLimit(ctx, peer)
+		if err != nil {
+			p.release(cid, e, err)
+			return nil, err
+		}
+		e.conn = c
+	}
+	return &PooledConn{PeerConn: e.conn, p: p, cid: cid, e: e}, nil
+}
+
+func (p *ConnPool) dialLimit(ctx context.Context, peer *Peer) (*PeerConn, error) {
+	select {
+	case p.dials <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.dials }()
+	return p.dial(ctx, peer)
+}
+
+// unref drops a reference to the entry. It must be called with the lock held.
+func (p *ConnPool) unref(cid adc.CID, e *poolEntry) {
+	e.users--
+	if e.users == 0 && e.conn == nil && p.peers[cid] == e {
+		delete(p.peers, cid)
+	}
+}
+
+// release returns the lease. The connection is closed if err is set.
+func (p *ConnPool) release(cid adc.CID, e *poolEntry, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.conn != nil {
+		if err != nil || p.closed {
+			_ = e.conn.Close()
+			e.conn = nil
+		} else {
+			e.used = time.Now()
+			e.timer = time.AfterFunc(p.conf.IdleTimeout, func() {
+				p.expire(cid, e)
+			})
+		}
+	}
+	p.unref(cid, e)
+	<-e.lease
+}
+
+// expire closes the connection if it's still idle.
+func (p *ConnPool) expire(cid adc.CID, e *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case e.lease <- struct{}{}:
+		defer func() { <-e.lease }()
+	default:
+		// in use
+		return
+	}
+	if e.conn == nil || time.Since(e.used) < p.conf.IdleTimeout {
+		return
+	}
+	_ = e.conn.Close()
+	e.conn = nil
+	if e.users == 0 && p.peers[cid] == e {
+		delete(p.peers, cid)
+	}
+}
+
+// Len returns the number of open connections in the pool.
+func (p *ConnPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, e := range p.peers {
+		select {
+		case e.lease <- struct{}{}:
+			if e.conn != nil {
+				n++
+			}
+			<-e.lease
+		default:
+			// leased connections are always open
+			n++
+		}
+	}
+	return n
+}
+
+// Close closes all idle connections. Leased connections are closed when released.
+func (p *ConnPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for cid, e := range p.peers {
+		select {
+		case e.lease <- struct{}{}:
+		default:
+			continue
+		}
+		if e.timer != nil {
+			e.timer.Stop()
+			e.timer = nil
+		}
+		if e.conn != nil {
+			_ = e.conn.Close()
+			e.conn = nil
+		}
+		<-e.lease
+		if e.users == 0 {
+			delete(p.peers, cid)
+		}
+	}
+	return nil
+}
+
+// PooledConn is a connection leased from a pool.
+type PooledConn struct {
+	*PeerConn
+	p    *ConnPool
+	cid  adc.CID
+	e    *poolEntry
+	once sync.Once
+}
+
+// Release returns the connection to the pool. If the error is set, the connection
+// is considered broken and is closed instead. It's safe to call it multiple times.
+func (c *PooledConn) Release(err error) {
+	c.once.Do(func() {
+		c.p.release(c.cid, c.e, err)
+	})
+}
+
+// Close returns the connection to the pool. Use Release to report a broken connection.
+func (c *PooledConn) Close() error {
+	c.Release(nil)
+	return nil
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func newTestPool(t *testing.T, conf PoolConfig, delay time.Duration) (*ConnPool, *int32) {
+	var dials int32
+	p := NewConnPool(conf)
+	p.dial = func(ctx context.Context, peer *Peer) (*PeerConn, error) {
+		atomic.AddInt32(&dials, 1)
+		time.Sleep(delay)
+		c1, c2 := net.Pipe()
+		go func() {
+			// close the remote side when the local side is closed
+			_, _ = c2.Read(make([]byte, 1))
+			_ = c2.Close()
+		}()
+		conn, err := adc.NewConn(c1)
+		require.NoError(t, err)
+		return &PeerConn{p: peer, conn: conn}, nil
+	}
+	return p, &dials
+}
+
+func TestConnPoolReuse(t *testing.T) {
+	p, dials := newTestPool(t, PoolConfig{}, 10*time.Millisecond)
+	defer p.Close()
+	peer := &Peer{user: &adc.User{Id: adc.CID{1}}}
+	ctx := context.Background()
+
+	// concurrent users share a single dial
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[*PeerConn]struct{})
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := p.Get(ctx, peer)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			conns[c.PeerConn] = struct{}{}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			c.Release(nil)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(dials))
+	require.Len(t, conns, 1)
+	require.Equal(t, 1, p.Len())
+
+	// broken connection is not reused
+	c, err := p.Get(ctx, peer)
+	require.NoError(t, err)
+	c.Release(errors.New("broken"))
+	c.Release(nil) // no-op
+	require.Equal(t, 0, p.Len())
+
+	c, err = p.Get(ctx, peer)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(dials))
+
+	// waiting for a leased connection respects the context
+	ctx2, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(ctx2, peer)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.NoError(t, c.Close())
+
+	require.NoError(t, p.Close())
+	require.Equal(t, 0, p.Len())
+	_, err = p.Get(ctx, peer)
+	require.Equal(t, ErrPoolClosed, err)
+}
+
+func TestConnPoolLimits(t *testing.T) {
+	p, dials := newTestPool(t, PoolConfig{MaxDials: 2, IdleTimeout: 200 * time.Millisecond}, 50*time.Millisecond)
+	defer p.Close()
+	ctx := context.Background()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		peer := &Peer{user: &adc.User{Id: adc.CID{byte(i + 1)}}}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := p.Get(ctx, peer)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.Release(nil)
+		}()
+	}
+	wg.Wait()
+	// only two dials at a time
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+	require.Equal(t, int32(4), atomic.LoadInt32(dials))
+	require.Equal(t, 4, p.Len())
+
+	// idle connections are closed
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, 0, p.Len())
+}
+
+func TestConnTokens(t *testing.T) {
+	var m connTokens
+	m.ttl = 50 * time.Millisecond
+
+	tok1, t1 := m.add(adc.CID{1}, adc.ProtoADC)
+	got, ok := m.take(tok1)
+	require.True(t, ok)
+	require.True(t, got == t1)
+	_, ok = m.take(tok1)
+	require.False(t, ok)
+
+	tok2, _ := m.add(adc.CID{2}, adc.ProtoADC)
+	time.Sleep(60 * time.Millisecond)
+	_, ok = m.take(tok2)
+	require.False(t, ok, "expired token")
+
+	_, _ = m.add(adc.CID{3}, adc.ProtoADC)
+	time.Sleep(60 * time.Millisecond)
+	tok4, _ := m.add(adc.CID{4}, adc.ProtoADC)
+	require.Equal(t, 1, m.len(), "expired tokens should be dropped")
+	m.remove(tok4)
+	require.Equal(t, 0, m.len())
+}
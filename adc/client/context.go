@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultHandshakeTimeout is the time allowed for a single handshake step
+// when the context has no deadline.
+const DefaultHandshakeTimeout = 5 * time.Second
+
+// ctxDeadline returns the deadline of the context, or a deadline dt from now
+// if the context has none.
+func ctxDeadline(ctx context.Context, dt time.Duration) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(dt)
+}
+
+// watchContext calls fnc when the context is cancelled. The returned function
+// must be called when the operation completes; it reports if fnc was called.
+func watchContext(ctx context.Context, fnc func()) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	done := make(chan struct{})
+	called := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			fnc()
+			called <- true
+		case <-done:
+			called <- false
+		}
+	}()
+	var (
+		once sync.Once
+		res  bool
+	)
+	return func() bool {
+		once.Do(func() {
+			close(done)
+			res = <-called
+		})
+		return res
+	}
+}
+
+// withContext runs fnc and closes the connection if the context is cancelled
+// before fnc returns. In this case the context error is returned.
+func withContext(ctx context.Context, c io.Closer, fnc func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := watchContext(ctx, func() {
+		_ = c.Close()
+	})
+	err := fnc()
+	if stop() {
+		return ctx.Err()
+	}
+	return ctxError(ctx, err)
+}
+
+// ctxError converts a timeout error caused by the context deadline to the context error.
+func ctxError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	} else if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		// the connection deadline may be reached slightly before the context timer fires
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// ctxReader closes the connection if the context is cancelled while reading.
+type ctxReader struct {
+	ctx  context.Context
+	rc   io.ReadCloser
+	stop func() bool
+}
+
+func newCtxReader(ctx context.Context, c io.Closer, rc io.ReadCloser) io.ReadCloser {
+	if ctx.Done() == nil {
+		return rc
+	}
+	return &ctxReader{ctx: ctx, rc: rc, stop: watchContext(ctx, func() {
+		_ = c.Close()
+	})}
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if err != nil && err != io.EOF {
+		err = ctxError(r.ctx, err)
+	}
+	return n, err
+}
+
+func (r *ctxReader) Close() error {
+	r.stop()
+	return r.rc.Close()
+}
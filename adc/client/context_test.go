@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func TestHubHandshakeContext(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		err  error
+	}{
+		{
+			name: "cancel",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			err: context.Canceled,
+		},
+		{
+			name: "timeout",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			err: context.DeadlineExceeded,
+		},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+			// the hub never answers
+			go io.Copy(ioutil.Discard, c2)
+
+			conn, err := adc.NewConn(c1)
+			require.NoError(t, err)
+
+			ctx, cancel := c.ctx()
+			defer cancel()
+			start := time.Now()
+			_, err = HubHandshakeContext(ctx, conn, &Config{PID: types.NewPID(), Name: "test"})
+			require.Equal(t, c.err, err)
+			require.True(t, time.Since(start) < DefaultHandshakeTimeout)
+		})
+	}
+}
+
+func TestGetCancel(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	cli, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	srv, err := adc.NewConn(c2)
+	require.NoError(t, err)
+
+	go func() {
+		msg, err := srv.ReadClientMsg(time.Time{})
+		if err != nil {
+			return
+		}
+		res := adc.GetResponse(msg.(adc.GetRequest))
+		res.Bytes = 1000
+		if srv.WriteClientMsg(res) != nil || srv.Flush() != nil {
+			return
+		}
+		// send only a part of the file and stall
+		_, _ = c2.Write(make([]byte, 10))
+		_, _ = io.Copy(ioutil.Discard, c2)
+	}()
+
+	pc := &PeerConn{conn: cli}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc, err := pc.readFile(ctx, "file", "a", 0, 1000)
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(rc, buf)
+	require.NoError(t, err)
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = rc.Read(buf)
+	require.Equal(t, context.Canceled, err)
+	_ = rc.Close()
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// Share provides information about files shared by the client.
+type Share interface {
+	// FileInfo returns the size and TTH of a shared file. The path is either a path
+	// in the share, or "TTH/<root>" for lookups by hash.
+	FileInfo(path string) (FileInfo, bool)
+}
+
+// ShareSearcher can be implemented by Share to answer searches from peers.
+type ShareSearcher interface {
+	// Search returns shared files and directories that match the request.
+	// The token and the number of free slots are set by the client.
+	Search(req adc.SearchRequest) []adc.SearchResult
+}
+
+// SetShare sets the files that are reported to peers in file info requests (GFI)
+// and, if the share implements ShareSearcher, in search results.
+//
+// Once the share is set, connection requests from peers are accepted. File uploads
+// are not served yet, so peers can only learn the size and TTH of shared files.
+//
+// If the share implements ShareStats, its size is reported to the hub and kept updated.
+func (c *Conn) SetShare(s Share) {
+	c.share.Lock()
+	if c.share.stop != nil {
+		close(c.share.stop)
+		c.share.stop = nil
+	}
+	c.share.files = s
+	st, ok := s.(ShareStats)
+	var stop chan struct{}
+	if ok {
+		stop = make(chan struct{})
+		c.share.stop = stop
+	}
+	c.share.Unlock()
+	if ok {
+		go c.advertiseShare(st, stop)
+	}
+}
+
+func (c *Conn) getShare() Share {
+	c.share.RLock()
+	defer c.share.RUnlock()
+	return c.share.files
+}
+
+// StatFile dials the peer and requests the size and TTH of a remote file without downloading it.
+func (p *Peer) StatFile(ctx context.Context, path string) (FileInfo, error) {
+	c, err := p.Dial(ctx)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer c.Close()
+	return c.StatFile(ctx, path)
+}
+
+// acceptShare connects to the peer that asked for a regular connection (CTM)
+// and answers its requests.
+func (c *Conn) acceptShare(p *Peer, s adc.ConnectRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeouts.handshake())
+	defer cancel()
+	addr, err := p.addr(s.Port)
+	if err != nil {
+		log.Printf("cannot connect to %v: %v", p.Info().Id, err)
+		return
+	}
+	pc, err := p.dialAddr(ctx, addr, s.Proto, s.Token, clientExtensions())
+	if err != nil {
+		log.Printf("cannot connect to %v: %v", p.Info().Id, err)
+		return
+	}
+	c.serveShare(pc)
+}
+
+// serveShare answers requests sent by the peer until the connection is closed.
+func (c *Conn) serveShare(pc *PeerConn) {
+	defer pc.Close()
+	for {
+		msg, err := pc.conn.ReadClientMsg(time.Time{})
+		if err != nil {
+			return
+		}
+		var resp adc.Message
+		switch msg := msg.(type) {
+		case adc.GetInfoRequest:
+			resp = c.answerInfo(msg)
+		case adc.GetRequest:
+			// TODO: serve uploads
+			resp = adc.NewError(adc.Recoverable, adc.CodeFileNotAvailable, "uploads are not supported").Status
+		default:
+			log.Printf("unhandled command from %v: %T", pc.conn.RemoteAddr(), msg)
+			return
+		}
+		pc.mu.Lock()
+		err = pc.conn.WriteClientMsg(resp)
+		if err == nil {
+			err = pc.conn.Flush()
+		}
+		pc.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// answerInfo returns a response to a file info request (GFI): either a RES with the size
+// and TTH of the file, or an error status.
+func (c *Conn) answerInfo(req adc.GetInfoRequest) adc.Message {
+	if req.Type != "file" {
+		return adc.ErrUnsupportedTransfer("unsupported type: " + req.Type).Status
+	}
+	var (
+		fi FileInfo
+		ok bool
+	)
+	if s := c.getShare(); s != nil {
+		fi, ok = s.FileInfo(req.Path)
+	}
+	if !ok {
+		return adc.NewError(adc.Recoverable, adc.CodeFileNotAvailable, "").Status
+	}
+	return adc.SearchResult{Path: req.Path, Size: fi.Size, TTH: fi.TTH, Slots: c.freeSlots()}
+}
+
+// maxSearchResults is the maximal number of results sent in response to a single search.
+const maxSearchResults = 10
+
+// answerSearch sends results from our share in response to a search request,
+// if the share implements ShareSearcher.
+func (c *Conn) answerSearch(p *Peer, sch adc.SearchRequest) {
+	s, ok := c.getShare().(ShareSearcher)
+	if !ok || p == nil {
+		return
+	}
+	results := s.Search(sch)
+	if len(results) == 0 {
+		return
+	} else if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	sid := p.getSID()
+	if sid == nil {
+		return
+	}
+	slots := c.freeSlots()
+	err := c.write(context.Background(), func(w *adc.Conn) error {
+		for _, r := range results {
+			r.Token = sch.Token
+			r.Slots = slots
+			if err := w.WriteDirect(c.SID(), *sid, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("failed to send search results:", err)
+	}
+}
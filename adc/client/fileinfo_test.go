@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+type testShare map[string]FileInfo
+
+func (s testShare) FileInfo(path string) (FileInfo, bool) {
+	fi, ok := s[path]
+	return fi, ok
+}
+
+func TestStatFile(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+
+	cli, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	srv, err := adc.NewConn(c2)
+	require.NoError(t, err)
+
+	tth := adc.TTH{1, 2, 3}
+	var c Conn
+	c.SetShare(testShare{
+		"/music/song.mp3":     {Size: 10, TTH: &tth},
+		"TTH/" + tth.Base32(): {Size: 10, TTH: &tth},
+	})
+	c.slots.s = NewSlots(TransferConfig{UploadSlots: 2})
+	go c.serveShare(&PeerConn{conn: srv})
+
+	pc := &PeerConn{conn: cli}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fi, err := pc.StatFile(ctx, "/music/song.mp3")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), fi.Size)
+	require.Equal(t, tth, *fi.TTH)
+
+	res, err := pc.statFile(ctx, "file", "/music/song.mp3")
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Slots)
+
+	fi, err = pc.StatFile(ctx, "TTH/"+tth.Base32())
+	require.NoError(t, err)
+	require.Equal(t, int64(10), fi.Size)
+
+	_, err = pc.StatFile(ctx, "/music/other.mp3")
+	require.Equal(t, os.ErrNotExist, err)
+
+	// uploads are not served, but the connection is still usable
+	_, err = pc.readFile(ctx, "file", "/music/song.mp3", 0, -1)
+	require.Error(t, err)
+	_, err = pc.statFile(ctx, "list", "/")
+	require.Error(t, err)
+	fi, err = pc.StatFile(ctx, "/music/song.mp3")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), fi.Size)
+
+	// the connection is closed on unexpected commands
+	require.NoError(t, cli.WriteClientMsg(adc.ChatMessage{Text: "hi"}))
+	require.NoError(t, cli.Flush())
+	_, err = ioutil.ReadAll(c1)
+	require.NoError(t, err)
+}
@@ -0,0 +1,348 @@
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+const (
+	// GatewayUserPath is the path prefix for browsing file lists of users.
+	GatewayUserPath = "/u/"
+
+	defaultGatewayTimeout = 30 * time.Second
+)
+
+// Gateway is an HTTP handler that exposes file lists of users on a hub as web pages
+// and proxies file downloads over HTTP.
+//
+// The index page lists online users, "/u/<cid>/<path>/" shows a directory and
+// "/u/<cid>/<path>" downloads a file. Range requests are supported for downloads.
+// Links in the pages are relative, so the gateway can be mounted under a path prefix
+// with http.StripPrefix.
+type Gateway struct {
+	// Auth checks HTTP basic auth credentials.
+	// If not set, all requests are rejected unless Public is set.
+	Auth func(user, pass string) bool
+	// Public allows access without credentials when Auth is not set.
+	Public bool
+	// Limiter caps the total bandwidth of all downloads. Optional.
+	Limiter *Limiter
+	// DownloadRate caps the bandwidth of each download in bytes per second. Zero means no limit.
+	DownloadRate int64
+	// Timeout is a timeout for file list requests.
+	Timeout time.Duration
+	// IdleTimeout is the time after which unused browsing connections are closed.
+	// Zero value means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+
+	peers func() []gatewayPeer
+	dial  func(ctx context.Context, cid adc.CID) (*PeerConn, error)
+	open  func(ctx context.Context, cid adc.CID, tth adc.TTH) (File, error)
+
+	mu    sync.Mutex
+	conns map[adc.CID]*gatewayConn
+}
+
+type gatewayConn struct {
+	conn  *PeerConn
+	used  time.Time
+	timer *time.Timer
+}
+
+type gatewayPeer struct {
+	CID   adc.CID
+	Name  string
+	Share int64
+}
+
+// NewGateway creates an HTTP gateway for users on a given hub.
+func NewGateway(c *Conn) *Gateway {
+	g := &Gateway{
+		Timeout: defaultGatewayTimeout,
+		conns:   make(map[adc.CID]*gatewayConn),
+	}
+	g.peers = func() []gatewayPeer {
+		var out []gatewayPeer
+		for _, p := range c.OnlinePeers() {
+			u := p.Info()
+			out = append(out, gatewayPeer{CID: u.Id, Name: u.Name, Share: u.ShareSize})
+		}
+		return out
+	}
+	g.dial = func(ctx context.Context, cid adc.CID) (*PeerConn, error) {
+		p := c.peerByCID(cid)
+		if p == nil {
+			return nil, ErrPeerOffline
+		}
+		return p.Dial(ctx)
+	}
+	g.open = func(ctx context.Context, cid adc.CID, tth adc.TTH) (File, error) {
+		p := c.peerByCID(cid)
+		if p == nil {
+			return nil, ErrPeerOffline
+		}
+		return p.OpenFile(ctx, tth)
+	}
+	return g
+}
+
+// Close closes all cached peer connections.
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for cid, e := range g.conns {
+		e.timer.Stop()
+		_ = e.conn.Close()
+		delete(g.conns, cid)
+	}
+	return nil
+}
+
+func (g *Gateway) idleTimeout() time.Duration {
+	if g.IdleTimeout <= 0 {
+		return DefaultIdleTimeout
+	}
+	return g.IdleTimeout
+}
+
+// conn returns a cached connection to the peer used for browsing.
+func (g *Gateway) conn(ctx context.Context, cid adc.CID) (*PeerConn, error) {
+	g.mu.Lock()
+	if e := g.conns[cid]; e != nil {
+		e.used = time.Now()
+		g.mu.Unlock()
+		return e.conn, nil
+	}
+	g.mu.Unlock()
+	c, err := g.dial(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if e := g.conns[cid]; e != nil {
+		_ = c.Close()
+		e.used = time.Now()
+		return e.conn, nil
+	}
+	e := &gatewayConn{conn: c, used: time.Now()}
+	e.timer = time.AfterFunc(g.idleTimeout(), func() {
+		g.expire(cid, e)
+	})
+	g.conns[cid] = e
+	return c, nil
+}
+
+// expire closes the cached connection if it was not used for IdleTimeout.
+func (g *Gateway) expire(cid adc.CID, e *gatewayConn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conns[cid] != e {
+		return
+	}
+	if idle := time.Since(e.used); idle < g.idleTimeout() {
+		e.timer.Reset(g.idleTimeout() - idle)
+		return
+	}
+	delete(g.conns, cid)
+	_ = e.conn.Close()
+}
+
+func (g *Gateway) dropConn(cid adc.CID, c *PeerConn) {
+	g.mu.Lock()
+	if e := g.conns[cid]; e != nil && e.conn == c {
+		e.timer.Stop()
+		delete(g.conns, cid)
+	}
+	g.mu.Unlock()
+	_ = c.Close()
+}
+
+func (g *Gateway) authorized(r *http.Request) bool {
+	if g.Auth == nil {
+		return g.Public
+	}
+	user, pass, ok := r.BasicAuth()
+	return ok && g.Auth(user, pass)
+}
+
+// BasicAuth returns an auth function that accepts a single user.
+func BasicAuth(user, pass string) func(user, pass string) bool {
+	return func(u, p string) bool {
+		ok := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		return subtle.ConstantTimeCompare([]byte(p), []byte(pass)) == 1 && ok
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="dc gateway"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/":
+		g.serveIndex(w, r)
+	case strings.HasPrefix(r.URL.Path, GatewayUserPath):
+		g.serveUser(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *Gateway) serveIndex(w http.ResponseWriter, r *http.Request) {
+	peers := g.peers()
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Name < peers[j].Name
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = gatewayIndexTmpl.Execute(w, peers)
+}
+
+func (g *Gateway) serveUser(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, GatewayUserPath)
+	if rest == "" {
+		// users are listed on the index page; the relative location keeps the path prefix
+		w.Header().Set("Location", "../")
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusFound)
+		return
+	}
+	cid, err := types.ParseCID(rest[:i])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fpath := rest[i:]
+	if strings.HasSuffix(fpath, "/") {
+		g.serveDir(w, r, cid, fpath)
+		return
+	}
+	g.serveFile(w, r, cid, fpath)
+}
+
+func (g *Gateway) browse(r *http.Request, cid adc.CID, dir string) (*filelist.Dir, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), g.Timeout)
+	defer cancel()
+	c, err := g.conn(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.Browse(ctx, dir)
+	if err != nil {
+		// the connection state is unknown; dial again next time
+		g.dropConn(cid, c)
+		return nil, err
+	}
+	return d, nil
+}
+
+type gatewayDir struct {
+	CID  adc.CID
+	Path string
+	Dir  *filelist.Dir
+}
+
+func (g *Gateway) serveDir(w http.ResponseWriter, r *http.Request, cid adc.CID, dir string) {
+	d, err := g.browse(r, cid, dir)
+	if err == ErrPeerOffline {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = gatewayDirTmpl.Execute(w, gatewayDir{CID: cid, Path: dir, Dir: d})
+}
+
+func (g *Gateway) serveFile(w http.ResponseWriter, r *http.Request, cid adc.CID, fpath string) {
+	dir, name := path.Split(fpath)
+	d, err := g.browse(r, cid, dir)
+	if err == ErrPeerOffline {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	file := d.File(name)
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := g.open(r.Context(), cid, file.TTH)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("ETag", `"`+file.TTH.Base32()+`"`)
+	lw := &limitedResponse{ResponseWriter: w}
+	lw.w = LimitWriter(r.Context(), w, g.Limiter, NewLimiter(g.DownloadRate))
+	http.ServeContent(lw, r, name, time.Time{}, f)
+}
+
+type limitedResponse struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *limitedResponse) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+var gatewayFuncs = template.FuncMap{
+	"pathEscape": url.PathEscape,
+}
+
+var gatewayIndexTmpl = template.Must(template.New("").Funcs(gatewayFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>Users</title>
+</head>
+<body>
+	<h2>Users</h2>
+	<ul>
+	{{range .}}<li><a href="./u/{{.CID}}/">{{.Name}}</a> ({{.Share}} bytes)</li>
+	{{end}}</ul>
+</body>
+</html>`))
+
+var gatewayDirTmpl = template.Must(template.New("").Funcs(gatewayFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>{{.Path}}</title>
+</head>
+<body>
+	<h2>{{.Path}}</h2>
+	<ul>
+	<li><a href="{{if eq .Path "/"}}../../{{else}}../{{end}}">..</a></li>
+	{{range .Dir.Dirs}}<li><a href="./{{pathEscape .Name}}/">{{.Name}}/</a></li>
+	{{end}}{{range .Dir.Files}}<li><a href="./{{pathEscape .Name}}">{{.Name}}</a> ({{.Size}} bytes)</li>
+	{{end}}</ul>
+</body>
+</html>`))
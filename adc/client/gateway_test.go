@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+// serveGateway answers file list, file info and file requests on a peer connection.
+func serveGateway(conn *adc.Conn, raw net.Conn, files map[string][]byte) {
+	for {
+		msg, err := conn.ReadClientMsg(time.Time{})
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case adc.GetInfoRequest:
+			var tth adc.TTH
+			_ = tth.FromBase32(strings.TrimPrefix(msg.Path, "TTH/"))
+			err = conn.WriteClientMsg(adc.SearchResult{
+				Path: msg.Path, Size: int64(len(files[msg.Path])), TTH: &tth,
+			})
+			if err == nil {
+				err = conn.Flush()
+			}
+		case adc.GetRequest:
+			var data []byte
+			if msg.Type == "list" {
+				data = []byte(testPartialLists[msg.Path])
+			} else {
+				data = files[msg.Path][msg.Start:]
+				if msg.Bytes >= 0 && msg.Bytes < int64(len(data)) {
+					data = data[:msg.Bytes]
+				}
+			}
+			res := adc.GetResponse(msg)
+			res.Bytes = int64(len(data))
+			if err = conn.WriteClientMsg(res); err == nil {
+				err = conn.Flush()
+			}
+			if err == nil {
+				_, err = raw.Write(data)
+			}
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	bob := adc.CID{1}
+	files := map[string][]byte{
+		"TTH/UDRJ6EGCH3CGWIIU2V6CH7VLFN4N2PCZKSPTBQA": []byte("0123456789"),
+	}
+	var pipes []net.Conn
+	defer func() {
+		for _, c := range pipes {
+			c.Close()
+		}
+	}()
+	dial := func() *PeerConn {
+		c1, c2 := net.Pipe()
+		pipes = append(pipes, c1, c2)
+		cli, err := adc.NewConn(c1)
+		require.NoError(t, err)
+		srv, err := adc.NewConn(c2)
+		require.NoError(t, err)
+		go serveGateway(srv, c2, files)
+		return &PeerConn{conn: cli}
+	}
+
+	dials := 0
+	g := &Gateway{
+		Auth:    BasicAuth("user", "pass"),
+		Timeout: 5 * time.Second,
+		conns:   make(map[adc.CID]*gatewayConn),
+		peers: func() []gatewayPeer {
+			return []gatewayPeer{{CID: bob, Name: "bob", Share: 10}}
+		},
+		dial: func(ctx context.Context, cid adc.CID) (*PeerConn, error) {
+			if cid != bob {
+				return nil, ErrPeerOffline
+			}
+			dials++
+			return dial(), nil
+		},
+		open: func(ctx context.Context, cid adc.CID, tth adc.TTH) (File, error) {
+			return dial().openStream(ctx, tth, true)
+		},
+	}
+	defer g.Close()
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	get := func(path string, hdr map[string]string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("user", "pass")
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(data)
+	}
+
+	resp, err := http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, body := get("/", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, body, `href="./u/`+bob.String()+`/"`)
+
+	resp, body = get("/u/"+bob.String()+"/", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, body, `href="./music/"`)
+	require.Contains(t, body, `href="./readme.txt"`)
+	require.Contains(t, body, `href="../../"`, "root directory should link to the index")
+
+	resp, body = get("/u/", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "/", resp.Request.URL.Path)
+	require.Contains(t, body, `href="./u/`+bob.String()+`/"`)
+
+	resp, body = get("/u/"+bob.String()+"/readme.txt", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "0123456789", body)
+
+	resp, body = get("/u/"+bob.String()+"/readme.txt", map[string]string{"Range": "bytes=2-4"})
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	require.Equal(t, "234", body)
+	require.Equal(t, 1, dials, "browse connection should be reused")
+
+	resp, _ = get("/u/"+bob.String()+"/missing.txt", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("/u/"+adc.CID{2}.String()+"/", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// idle browsing connections are closed
+	g.mu.Lock()
+	g.IdleTimeout = time.Millisecond
+	g.conns[bob].timer.Reset(0)
+	g.mu.Unlock()
+	for deadline := time.Now().Add(time.Second); ; {
+		g.mu.Lock()
+		n := len(g.conns)
+		g.mu.Unlock()
+		if n == 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("idle connection was not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, _ = get("/u/"+bob.String()+"/", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, dials)
+}
+
+func TestGatewayPublic(t *testing.T) {
+	g := &Gateway{
+		peers: func() []gatewayPeer { return nil },
+	}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	// access without Auth must be enabled explicitly
+	resp, err := http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	g.Public = true
+	resp, err = http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestGatewayDirEscape(t *testing.T) {
+	var buf bytes.Buffer
+	err := gatewayDirTmpl.Execute(&buf, gatewayDir{Path: "/", Dir: &filelist.Dir{
+		Dirs:  []filelist.Dir{{Name: "a?b"}},
+		Files: []filelist.File{{Name: "c #1.txt"}},
+	}})
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `href="./a%3Fb/"`)
+	require.Contains(t, buf.String(), `href="./c%20%231.txt"`)
+}
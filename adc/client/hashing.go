@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/tiger"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// DefaultHashers is the default number of files hashed concurrently by the Indexer.
+const DefaultHashers = 2
+
+// HashProgress reports the state of indexing.
+//
+// Files found in the hash store are counted as hashed.
+type HashProgress struct {
+	Scanning bool // directories are still being scanned, so totals may grow
+	Paused   bool
+
+	Files       int // number of shared files found so far
+	HashedFiles int
+	Bytes       int64 // total size of shared files found so far
+	HashedBytes int64
+
+	// Speed is the average hashing speed in bytes per second.
+	Speed int64
+}
+
+// FilesLeft returns the number of files that are not hashed yet.
+func (p HashProgress) FilesLeft() int {
+	return p.Files - p.HashedFiles
+}
+
+// BytesLeft returns the size of files that are not hashed yet.
+func (p HashProgress) BytesLeft() int64 {
+	return p.Bytes - p.HashedBytes
+}
+
+// ETA returns the estimated time until all files are hashed, or zero if it's unknown.
+func (p HashProgress) ETA() time.Duration {
+	if p.Speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(p.BytesLeft()) / float64(p.Speed) * float64(time.Second))
+}
+
+// Fraction returns the hashed fraction of the share size, from 0 to 1.
+func (p HashProgress) Fraction() float64 {
+	if p.Bytes <= 0 {
+		if p.FilesLeft() > 0 {
+			return 0
+		}
+		return 1
+	}
+	return float64(p.HashedBytes) / float64(p.Bytes)
+}
+
+// SetHashers sets the maximal number of files hashed concurrently.
+// It affects Index calls that start after this call.
+func (ix *Indexer) SetHashers(n int) {
+	if n <= 0 {
+		n = DefaultHashers
+	}
+	ix.mu.Lock()
+	ix.hashers = n
+	ix.mu.Unlock()
+}
+
+// SetHashRate limits the rate at which files are read for hashing, in bytes per second.
+// Zero rate means no limit. The limit is shared by all hashers.
+func (ix *Indexer) SetHashRate(rate int64) {
+	ix.limit.SetRate(rate)
+}
+
+// HashRate returns the current hashing rate limit.
+func (ix *Indexer) HashRate() int64 {
+	return ix.limit.Rate()
+}
+
+// Pause suspends hashing until Resume is called. Directory scanning is not paused.
+func (ix *Indexer) Pause() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.paused {
+		return
+	}
+	ix.paused = true
+	ix.resume = make(chan struct{})
+	ix.notify()
+}
+
+// Resume continues hashing suspended by Pause.
+func (ix *Indexer) Resume() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.paused {
+		return
+	}
+	ix.paused = false
+	close(ix.resume)
+	ix.notify()
+}
+
+// Paused checks if hashing is paused.
+func (ix *Indexer) Paused() bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.paused
+}
+
+// Progress returns the state of indexing. Counters are reset when a new Index call
+// starts while no other calls are running.
+func (ix *Indexer) Progress() HashProgress {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.getProgress()
+}
+
+// getProgress must be called with the lock held.
+func (ix *Indexer) getProgress() HashProgress {
+	p := ix.progress
+	p.Scanning = ix.scanning > 0
+	p.Paused = ix.paused
+	if dt := time.Since(ix.start).Seconds(); ix.read > 0 && dt > 0 {
+		p.Speed = int64(float64(ix.read) / dt)
+	}
+	return p
+}
+
+// WaitHashed blocks until directories are scanned and at least a given fraction
+// of the share size is hashed.
+func (ix *Indexer) WaitHashed(ctx context.Context, fraction float64) error {
+	for {
+		ix.mu.Lock()
+		p := ix.getProgress()
+		changed := ix.change
+		ix.mu.Unlock()
+		if !p.Scanning && p.Fraction() >= fraction {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notify wakes up goroutines waiting for the progress change. It must be called with the lock held.
+func (ix *Indexer) notify() {
+	close(ix.change)
+	ix.change = make(chan struct{})
+}
+
+func (ix *Indexer) begin() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.running == 0 {
+		ix.progress = HashProgress{}
+		ix.start = time.Now()
+		ix.read = 0
+	}
+	ix.running++
+	ix.scanning++
+	ix.notify()
+}
+
+func (ix *Indexer) scanned() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.scanning--
+	ix.notify()
+}
+
+func (ix *Indexer) end() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.running--
+	ix.notify()
+}
+
+// scannedFile adds a file to the progress counters.
+func (ix *Indexer) scannedFile(size int64, hashed bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.progress.Files++
+	ix.progress.Bytes += size
+	if hashed {
+		ix.progress.HashedFiles++
+		ix.progress.HashedBytes += size
+	}
+}
+
+// hashedFile updates the progress after hashing a file. Failed files are removed from totals.
+func (ix *Indexer) hashedFile(size int64, failed bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if failed {
+		ix.progress.Files--
+		ix.progress.Bytes -= size
+	} else {
+		ix.progress.HashedFiles++
+		ix.progress.HashedBytes += size
+	}
+	ix.notify()
+}
+
+// waitResumed blocks while hashing is paused.
+func (ix *Indexer) waitResumed(ctx context.Context) error {
+	ix.mu.Lock()
+	paused, resume := ix.paused, ix.resume
+	ix.mu.Unlock()
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hashAll hashes files in concurrent workers and sets their TTH.
+// It returns relative paths of files that cannot be hashed.
+func (ix *Indexer) hashAll(ctx context.Context, jobs []hashJob) (map[string]struct{}, error) {
+	ix.mu.Lock()
+	n := ix.hashers
+	ix.mu.Unlock()
+	if n > len(jobs) {
+		n = len(jobs)
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed = make(map[string]struct{})
+	)
+	ch := make(chan *hashJob)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				size := j.fi.Size()
+				tth, err := ix.hashThrottled(ctx, j.path)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("cannot hash %s: %v", j.path, err)
+					}
+					mu.Lock()
+					failed[j.rel] = struct{}{}
+					mu.Unlock()
+					ix.hashedFile(size, true)
+					continue
+				}
+				j.f.TTH = tth
+				ix.hashedFile(size, false)
+				if ix.store == nil {
+					continue
+				}
+				if err = ix.store.Put(j.path, size, j.fi.ModTime(), tth); err != nil {
+					log.Printf("cannot save the hash of %s: %v", j.path, err)
+				}
+			}
+		}()
+	}
+loop:
+	for i := range jobs {
+		select {
+		case ch <- &jobs[i]:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// hashThrottled computes the TTH of a local file, respecting the rate limit and pauses.
+func (ix *Indexer) hashThrottled(ctx context.Context, fpath string) (adc.TTH, error) {
+	if err := ix.waitResumed(ctx); err != nil {
+		return adc.TTH{}, err
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return adc.TTH{}, err
+	}
+	defer f.Close()
+	r := LimitReader(ctx, &hashReader{ctx: ctx, ix: ix, r: f}, ix.limit)
+	return tiger.TreeHash(r)
+}
+
+// hashReader counts bytes read by hashers and blocks reads while hashing is paused.
+type hashReader struct {
+	ctx context.Context
+	ix  *Indexer
+	r   io.Reader
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	if err := r.ix.waitResumed(r.ctx); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.ix.mu.Lock()
+		r.ix.read += int64(n)
+		r.ix.mu.Unlock()
+	}
+	return n, err
+}
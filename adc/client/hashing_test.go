@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func TestIndexerHashing(t *testing.T) {
+	root, err := ioutil.TempDir("", "dc-share-")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	writeTestFiles(t, root, map[string]string{
+		"a.txt":     strings.Repeat("a", 1000),
+		"b.txt":     strings.Repeat("b", 1000),
+		"sub/c.txt": strings.Repeat("c", 2000),
+	})
+
+	ix, err := NewIndexer(ShareRules{})
+	require.NoError(t, err)
+	ix.SetHashers(3)
+	ix.Pause()
+	require.True(t, ix.Paused())
+
+	type result struct {
+		files int
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		d, err := ix.Index(context.Background(), "share", root)
+		done <- result{files: d.Count(), err: err}
+	}()
+
+	// the share is scanned, but not hashed while paused
+	for i := 0; ix.Progress().Files < 3 || ix.Progress().Scanning; i++ {
+		require.True(t, i < 100, "scan timeout")
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	err = ix.WaitHashed(ctx, 0.5)
+	cancel()
+	require.Equal(t, context.DeadlineExceeded, err)
+	p := ix.Progress()
+	require.False(t, p.Scanning)
+	require.True(t, p.Paused)
+	require.Equal(t, 3, p.Files)
+	require.Equal(t, 3, p.FilesLeft())
+	require.Equal(t, int64(4000), p.BytesLeft())
+	require.Equal(t, 0.0, p.Fraction())
+
+	ix.SetHashRate(16 * 1024)
+	require.Equal(t, int64(16*1024), ix.HashRate())
+	ix.Resume()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, ix.WaitHashed(ctx, 1))
+
+	res := <-done
+	require.NoError(t, res.err)
+	require.Equal(t, 3, res.files)
+	p = ix.Progress()
+	require.Equal(t, 0, p.FilesLeft())
+	require.Equal(t, 1.0, p.Fraction())
+	require.True(t, p.Speed > 0)
+	require.Equal(t, time.Duration(0), p.ETA())
+}
+
+func TestDialWaitHashed(t *testing.T) {
+	ix, err := NewIndexer(ShareRules{})
+	require.NoError(t, err)
+	ix.begin()
+	ix.scannedFile(100, false)
+	ix.scanned()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// login is refused before the hub address is even resolved
+	_, err = DialHubContext(ctx, "adc://invalid.", &Config{
+		PID: types.NewPID(), Name: "user",
+		Indexer: ix, MinHashed: 0.5,
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
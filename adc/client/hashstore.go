@@ -0,0 +1,217 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// hashRecord is a single line in the hash store journal.
+type hashRecord struct {
+	Path    string  `json:"p"`
+	Size    int64   `json:"s,omitempty"`
+	ModTime int64   `json:"m,omitempty"` // unix nanoseconds
+	TTH     adc.TTH `json:"t"`
+	Deleted bool    `json:"d,omitempty"`
+}
+
+type hashEntry struct {
+	size    int64
+	modTime int64
+	tth     adc.TTH
+}
+
+// HashStore persists TTH of local files keyed by the path, size and modification time,
+// so files are not hashed again after restart unless they change.
+//
+// The store is an append-only journal in JSON lines format. Records that are replaced
+// or deleted stay in the file until Compact is called.
+type HashStore struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	entries map[string]hashEntry
+}
+
+// OpenHashStore opens or creates a hash store file.
+// Records that cannot be decoded (for example, after a crash) are skipped.
+func OpenHashStore(path string) (*HashStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &HashStore{path: path, f: f, entries: make(map[string]hashEntry)}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		var r hashRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil || r.Path == "" {
+			continue
+		}
+		if r.Deleted {
+			delete(s.entries, r.Path)
+			continue
+		}
+		s.entries[r.Path] = hashEntry{size: r.Size, modTime: r.ModTime, tth: r.TTH}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the store file.
+func (s *HashStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// Len returns the number of files in the store.
+func (s *HashStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Get returns the TTH of a file, if the file with the same size and modification time was stored.
+func (s *HashStore) Get(path string, size int64, modTime time.Time) (adc.TTH, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[path]
+	if !ok || e.size != size || e.modTime != modTime.UnixNano() {
+		return adc.TTH{}, false
+	}
+	return e.tth, true
+}
+
+// Put stores the TTH of a file.
+func (s *HashStore) Put(path string, size int64, modTime time.Time, tth adc.TTH) error {
+	e := hashEntry{size: size, modTime: modTime.UnixNano(), tth: tth}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.entries[path]; ok && old == e {
+		return nil
+	}
+	s.entries[path] = e
+	return s.append(hashRecord{Path: path, Size: e.size, ModTime: e.modTime, TTH: tth})
+}
+
+// Delete removes a file from the store.
+func (s *HashStore) Delete(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[path]; !ok {
+		return nil
+	}
+	delete(s.entries, path)
+	return s.append(hashRecord{Path: path, Deleted: true})
+}
+
+// append writes a record to the journal. It must be called with the lock held.
+func (s *HashStore) append(r hashRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = s.f.Write(data)
+	return err
+}
+
+// Compact removes files that no longer exist or were modified, and rewrites
+// the journal without replaced and deleted records. It returns the number of removed files.
+func (s *HashStore) Compact() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for path, e := range s.entries {
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() || fi.Size() != e.size || fi.ModTime().UnixNano() != e.modTime {
+			delete(s.entries, path)
+			removed++
+		}
+	}
+	paths := make([]string, 0, len(s.entries))
+	for path := range s.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return removed, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, path := range paths {
+		e := s.entries[path]
+		if err = enc.Encode(hashRecord{Path: path, Size: e.size, ModTime: e.modTime, TTH: e.tth}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return removed, err
+	}
+	s.f.Close()
+	if err = os.Rename(tmp, s.path); err != nil {
+		return removed, err
+	}
+	s.f, err = os.OpenFile(s.path, os.O_RDWR|os.O_APPEND, 0644)
+	return removed, err
+}
+
+// Verify hashes all unmodified files in the store again and compares the result with the stored TTH.
+// Files with a different hash are removed from the store, so they are hashed again on the next
+// indexing. It returns paths of such files.
+func (s *HashStore) Verify(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	paths := make([]string, 0, len(s.entries))
+	for path := range s.entries {
+		paths = append(paths, path)
+	}
+	s.mu.Unlock()
+	sort.Strings(paths)
+
+	var bad []string
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return bad, err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		exp, ok := s.Get(path, fi.Size(), fi.ModTime())
+		if !ok {
+			continue
+		}
+		tth, err := hashFile(path)
+		if err != nil || tth == exp {
+			continue
+		}
+		bad = append(bad, path)
+		if err = s.Delete(path); err != nil {
+			return bad, err
+		}
+	}
+	return bad, nil
+}
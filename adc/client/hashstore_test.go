@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dc-hashes-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "share")
+	writeTestFiles(t, root, map[string]string{
+		"a.txt":     "first file",
+		"sub/b.txt": "second file",
+	})
+	spath := filepath.Join(dir, "hashes.db")
+
+	s, err := OpenHashStore(spath)
+	require.NoError(t, err)
+	ix, err := NewIndexer(ShareRules{})
+	require.NoError(t, err)
+	ix.SetHashStore(s)
+	d1, err := ix.Index(context.Background(), "share", root)
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Len())
+	require.NoError(t, s.Close())
+
+	// modify the file without changing its size and modification time
+	apath := filepath.Join(root, "a.txt")
+	fi, err := os.Stat(apath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(apath, []byte("FIRST FILE"), 0644))
+	require.NoError(t, os.Chtimes(apath, fi.ModTime(), fi.ModTime()))
+
+	s, err = OpenHashStore(spath)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 2, s.Len())
+	ix.SetHashStore(s)
+	d2, err := ix.Index(context.Background(), "share", root)
+	require.NoError(t, err)
+	// the hash is taken from the store
+	require.Equal(t, d1, d2)
+
+	bad, err := s.Verify(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{apath}, bad)
+	require.Equal(t, 1, s.Len())
+	d2, err = ix.Index(context.Background(), "share", root)
+	require.NoError(t, err)
+	require.NotEqual(t, d1.File("a.txt").TTH, d2.File("a.txt").TTH)
+
+	// modified and removed files are dropped on compaction
+	require.NoError(t, os.Remove(filepath.Join(root, "sub", "b.txt")))
+	require.NoError(t, os.Chtimes(apath, time.Now(), time.Now().Add(-time.Hour)))
+	n, err := s.Compact()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 0, s.Len())
+
+	_, err = ix.Index(context.Background(), "share", root)
+	require.NoError(t, err)
+	require.Equal(t, 1, s.Len())
+	data, err := ioutil.ReadFile(spath)
+	require.NoError(t, err)
+	require.Equal(t, 1, bytes.Count(data, []byte("\n")))
+}
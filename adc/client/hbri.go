@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// hybridBridge makes a secondary connection to the hub over the other IP version,
+// so the hub can validate the address of the client (HBRI extension).
+func hybridBridge(ctx context.Context, req adc.HybridBridge, timeout time.Duration) error {
+	host, port := req.Ip4, req.Port4
+	if req.Ip6 != "" {
+		host, port = req.Ip6, req.Port6
+	}
+	if host == "" || port == 0 || req.Token == "" {
+		return errors.New("hbri: invalid bridge request")
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := adc.DialContext(ctx, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return withContext(ctx, conn, func() error {
+		fea := adc.NewFeatureSet(adc.FeaHBRI)
+		fea.Require(adc.FeaBASE, adc.FeaBAS0)
+		fea.Require(adc.FeaTIGR)
+		if _, _, err := protocolToHub(ctx, conn, fea, timeout); err != nil {
+			return err
+		}
+		if err := conn.WriteHubMsg(adc.HybridBridge{Token: req.Token}); err != nil {
+			return err
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		msg, err := conn.ReadInfoMsg(ctxDeadline(ctx, timeout))
+		if err != nil {
+			return err
+		}
+		st, ok := msg.(adc.Status)
+		if !ok {
+			return errors.New("hbri: expected status from the hub")
+		}
+		return st.Err()
+	})
+}
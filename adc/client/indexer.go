@@ -0,0 +1,381 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/tiger"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+// SymlinkPolicy controls how the indexer handles symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinksSkip excludes symbolic links from the share.
+	SymlinksSkip = SymlinkPolicy(iota)
+	// SymlinksFollow shares the targets of symbolic links. Links that point
+	// to one of their parent directories are skipped.
+	SymlinksFollow
+)
+
+// systemNames are names of files created by operating systems that are excluded by default.
+var systemNames = map[string]struct{}{
+	"thumbs.db":                 {},
+	"desktop.ini":               {},
+	"$recycle.bin":              {},
+	"system volume information": {},
+	"lost+found":                {},
+}
+
+// ShareRules controls which local files and directories are shared.
+type ShareRules struct {
+	// Exclude is a list of glob patterns in path.Match syntax. Patterns without a slash
+	// are matched against file and directory names, other patterns are matched against
+	// slash-separated paths relative to the shared directory. Matching is case-insensitive.
+	Exclude []string
+	// MinSize and MaxSize exclude files smaller or larger than the limit. Zero means no limit.
+	MinSize int64
+	MaxSize int64
+	// Hidden allows sharing hidden files and directories (names starting with a dot).
+	Hidden bool
+	// System allows sharing files created by the operating system, like "Thumbs.db".
+	// Special files (devices, pipes and sockets) are never shared.
+	System bool
+	// Symlinks controls how symbolic links are handled.
+	Symlinks SymlinkPolicy
+}
+
+// ExcludeReason explains why a file is not shared.
+type ExcludeReason int
+
+const (
+	Included        = ExcludeReason(iota) // the file is shared
+	ExcludedPattern                       // matches one of exclusion patterns
+	ExcludedHidden                        // hidden file or directory
+	ExcludedSystem                        // a file created by the operating system
+	ExcludedSpecial                       // not a regular file or directory
+	ExcludedSize                          // the file size is out of limits
+	ExcludedSymlink                       // a symbolic link that is not followed or is broken
+	ExcludedLoop                          // a symbolic link to one of the parent directories
+)
+
+func (r ExcludeReason) String() string {
+	switch r {
+	case Included:
+		return "shared"
+	case ExcludedPattern:
+		return "matches an exclusion pattern"
+	case ExcludedHidden:
+		return "hidden file"
+	case ExcludedSystem:
+		return "system file"
+	case ExcludedSpecial:
+		return "special file"
+	case ExcludedSize:
+		return "file size is out of limits"
+	case ExcludedSymlink:
+		return "symbolic link"
+	case ExcludedLoop:
+		return "symbolic link loop"
+	}
+	return fmt.Sprintf("ExcludeReason(%d)", int(r))
+}
+
+// ShareCheck is the result of checking a path against share rules.
+type ShareCheck struct {
+	// Path is a local path that determined the result. It may be one of the parents
+	// of the checked path, if the parent is excluded.
+	Path    string
+	Reason  ExcludeReason
+	Pattern string // the exclusion pattern that matched, if any
+}
+
+// Shared checks if the path is shared.
+func (c ShareCheck) Shared() bool {
+	return c.Reason == Included
+}
+
+func (c ShareCheck) String() string {
+	switch c.Reason {
+	case Included:
+		return c.Path + ": shared"
+	case ExcludedPattern:
+		return fmt.Sprintf("%s: %v %q", c.Path, c.Reason, c.Pattern)
+	}
+	return c.Path + ": " + c.Reason.String()
+}
+
+// Indexer builds shared directories from the local filesystem.
+//
+// The result of indexing can be added to the share with ShareProfile.SetDir.
+// Files are hashed in background workers; see SetHashers, SetHashRate and Pause
+// for hashing controls and Progress for the state of indexing.
+type Indexer struct {
+	rules ShareRules
+	store *HashStore
+	limit *Limiter // limits the hashing I/O rate
+
+	mu       sync.Mutex
+	hashers  int
+	paused   bool
+	resume   chan struct{} // closed when hashing is resumed
+	change   chan struct{} // closed and replaced when the progress changes
+	running  int           // number of Index calls in progress
+	scanning int           // number of Index calls that are still scanning directories
+	progress HashProgress
+	start    time.Time // when the current indexing started
+	read     int64     // bytes read by hashers since start
+}
+
+// NewIndexer creates an indexer with given share rules.
+// It returns an error if one of exclusion patterns is invalid.
+func NewIndexer(rules ShareRules) (*Indexer, error) {
+	for _, p := range rules.Exclude {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclusion pattern %q: %v", p, err)
+		}
+	}
+	rules.Exclude = append([]string{}, rules.Exclude...)
+	return &Indexer{
+		rules:   rules,
+		limit:   NewLimiter(0),
+		hashers: DefaultHashers,
+		change:  make(chan struct{}),
+	}, nil
+}
+
+// SetHashStore sets a store for computed hashes. Files that are already in the store
+// and were not modified are not hashed again. It must be called before indexing.
+func (ix *Indexer) SetHashStore(s *HashStore) {
+	ix.store = s
+}
+
+// hashJob is a file that is waiting to be hashed.
+type hashJob struct {
+	path string // local path
+	rel  string // path relative to the shared directory
+	fi   os.FileInfo
+	f    *filelist.File
+}
+
+// Index walks a local directory and returns it as a shared directory with a given name.
+// Files that are not allowed by share rules are skipped. Unreadable subdirectories
+// and files are logged and skipped as well.
+//
+// The directory is scanned first, and then files that are not in the hash store are hashed.
+func (ix *Indexer) Index(ctx context.Context, name, root string) (filelist.Dir, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return filelist.Dir{}, err
+	}
+	st, err := os.Stat(root)
+	if err != nil {
+		return filelist.Dir{}, err
+	} else if !st.IsDir() {
+		return filelist.Dir{}, fmt.Errorf("not a directory: %s", root)
+	}
+	ix.begin()
+	defer ix.end()
+
+	d := filelist.Dir{Name: name}
+	pending := make(map[string]hashJob)
+	err = ix.indexDir(ctx, &d, root, "", []os.FileInfo{st}, pending)
+	ix.scanned()
+	if err != nil {
+		return filelist.Dir{}, err
+	}
+	// the tree won't change anymore, so we can take pointers to files
+	jobs := make([]hashJob, 0, len(pending))
+	_ = d.Walk(func(fpath string, _ *filelist.Dir, f *filelist.File) error {
+		if j, ok := pending[fpath]; ok && f != nil {
+			j.f = f
+			jobs = append(jobs, j)
+		}
+		return nil
+	})
+	failed, err := ix.hashAll(ctx, jobs)
+	if err != nil {
+		return filelist.Dir{}, err
+	}
+	if len(failed) != 0 {
+		removeFiles(&d, "", failed)
+	}
+	return d, nil
+}
+
+// indexDir adds the contents of a local directory to d. Parents are used to detect symlink loops.
+// Files that are not in the hash store are added to pending by their relative path.
+func (ix *Indexer) indexDir(ctx context.Context, d *filelist.Dir, dir, rel string, parents []os.FileInfo, pending map[string]hashJob) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	list, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	for _, lfi := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fpath := filepath.Join(dir, lfi.Name())
+		frel := path.Join(rel, lfi.Name())
+		fi, chk := ix.check(fpath, frel, lfi, parents)
+		if !chk.Shared() {
+			continue
+		}
+		if fi.IsDir() {
+			sub := filelist.Dir{Name: lfi.Name()}
+			if err := ix.indexDir(ctx, &sub, fpath, frel, append(parents[:len(parents):len(parents)], fi), pending); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Printf("cannot index %s: %v", fpath, err)
+				continue
+			}
+			d.Dirs = append(d.Dirs, sub)
+			continue
+		}
+		file := filelist.File{Name: lfi.Name(), Size: fi.Size(), Date: fi.ModTime().Unix()}
+		var ok bool
+		if ix.store != nil {
+			file.TTH, ok = ix.store.Get(fpath, fi.Size(), fi.ModTime())
+		}
+		if !ok {
+			pending[frel] = hashJob{path: fpath, rel: frel, fi: fi}
+		}
+		ix.scannedFile(fi.Size(), ok)
+		d.Files = append(d.Files, file)
+	}
+	return nil
+}
+
+// removeFiles removes files with given relative paths from the directory.
+func removeFiles(d *filelist.Dir, prefix string, paths map[string]struct{}) {
+	files := d.Files[:0]
+	for _, f := range d.Files {
+		if _, ok := paths[prefix+f.Name]; !ok {
+			files = append(files, f)
+		}
+	}
+	d.Files = files
+	for i := range d.Dirs {
+		sub := &d.Dirs[i]
+		removeFiles(sub, prefix+sub.Name+"/", paths)
+	}
+}
+
+// hashFile computes the TTH of a local file.
+func hashFile(fpath string) (adc.TTH, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return adc.TTH{}, err
+	}
+	defer f.Close()
+	return tiger.TreeHash(f)
+}
+
+// check applies share rules to a file with a given local path, slash-separated path relative
+// to the shared directory and the result of Lstat. It returns the info of the file
+// the path resolves to, if the file is shared.
+func (ix *Indexer) check(fpath, rel string, lfi os.FileInfo, parents []os.FileInfo) (os.FileInfo, ShareCheck) {
+	name := strings.ToLower(lfi.Name())
+	rel = strings.ToLower(rel)
+	for _, p := range ix.rules.Exclude {
+		s := name
+		if strings.Contains(p, "/") {
+			s = rel
+		}
+		if ok, _ := path.Match(strings.ToLower(p), s); ok {
+			return nil, ShareCheck{Path: fpath, Reason: ExcludedPattern, Pattern: p}
+		}
+	}
+	if !ix.rules.Hidden && strings.HasPrefix(name, ".") {
+		return nil, ShareCheck{Path: fpath, Reason: ExcludedHidden}
+	}
+	if _, ok := systemNames[name]; ok && !ix.rules.System {
+		return nil, ShareCheck{Path: fpath, Reason: ExcludedSystem}
+	}
+	fi := lfi
+	if lfi.Mode()&os.ModeSymlink != 0 {
+		if ix.rules.Symlinks != SymlinksFollow {
+			return nil, ShareCheck{Path: fpath, Reason: ExcludedSymlink}
+		}
+		var err error
+		fi, err = os.Stat(fpath)
+		if err != nil {
+			return nil, ShareCheck{Path: fpath, Reason: ExcludedSymlink}
+		}
+	}
+	if fi.IsDir() {
+		for _, p := range parents {
+			if os.SameFile(p, fi) {
+				return nil, ShareCheck{Path: fpath, Reason: ExcludedLoop}
+			}
+		}
+		return fi, ShareCheck{Path: fpath, Reason: Included}
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, ShareCheck{Path: fpath, Reason: ExcludedSpecial}
+	}
+	if size := fi.Size(); (ix.rules.MinSize > 0 && size < ix.rules.MinSize) ||
+		(ix.rules.MaxSize > 0 && size > ix.rules.MaxSize) {
+		return nil, ShareCheck{Path: fpath, Reason: ExcludedSize}
+	}
+	return fi, ShareCheck{Path: fpath, Reason: Included}
+}
+
+// Explain checks if a local file or directory inside the shared root directory
+// would be shared, and reports the reason if it's not.
+func (ix *Indexer) Explain(root, fpath string) (ShareCheck, error) {
+	rel, err := filepath.Rel(root, fpath)
+	if err != nil {
+		return ShareCheck{}, err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return ShareCheck{}, errors.New("path is not in the shared directory: " + fpath)
+	}
+	st, err := os.Stat(root)
+	if err != nil {
+		return ShareCheck{}, err
+	}
+	cur := ShareCheck{Path: root, Reason: Included}
+	if rel == "." {
+		return cur, nil
+	}
+	parents := []os.FileInfo{st}
+	names := strings.Split(rel, "/")
+	for i, name := range names {
+		fpath := filepath.Join(cur.Path, name)
+		lfi, err := os.Lstat(fpath)
+		if err != nil {
+			return ShareCheck{}, err
+		}
+		fi, chk := ix.check(fpath, strings.Join(names[:i+1], "/"), lfi, parents)
+		if !chk.Shared() || i == len(names)-1 {
+			return chk, nil
+		} else if !fi.IsDir() {
+			return ShareCheck{}, errors.New("not a directory: " + fpath)
+		}
+		cur = chk
+		parents = append(parents, fi)
+	}
+	return cur, nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, data := range files {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fpath), 0755))
+		require.NoError(t, ioutil.WriteFile(fpath, []byte(data), 0644))
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	root, err := ioutil.TempDir("", "dc-share-")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	writeTestFiles(t, root, map[string]string{
+		"music/song.mp3":     "some music",
+		"music/song.mp3.tmp": "partial",
+		"music/.hidden":      "secret",
+		"music/Thumbs.db":    "thumbs",
+		"music/empty.txt":    "",
+		"video/big.mkv":      "a very large movie file",
+		"video/skip/a.txt":   "skipped by path",
+	})
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "music", "loop")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "video"), filepath.Join(root, "music", "video")))
+
+	_, err = NewIndexer(ShareRules{Exclude: []string{"[a-"}})
+	require.Error(t, err)
+
+	ix, err := NewIndexer(ShareRules{
+		Exclude: []string{"*.TMP", "video/skip"},
+		MinSize: 1,
+		MaxSize: 20,
+	})
+	require.NoError(t, err)
+
+	d, err := ix.Index(context.Background(), "share", root)
+	require.NoError(t, err)
+	require.Equal(t, "share", d.Name)
+	require.Len(t, d.Dirs, 2)
+	music := d.Dir("music")
+	require.NotNil(t, music)
+	require.Len(t, music.Dirs, 0)
+	require.Len(t, music.Files, 1)
+	f := music.File("song.mp3")
+	require.NotNil(t, f)
+	require.Equal(t, int64(10), f.Size)
+	tth, err := tiger.TreeHash(bytes.NewReader([]byte("some music")))
+	require.NoError(t, err)
+	require.Equal(t, tth, f.TTH)
+	require.Len(t, d.Dir("video").Files, 0)
+	require.Len(t, d.Dir("video").Dirs, 0)
+
+	for name, exp := range map[string]ExcludeReason{
+		"music/song.mp3":     Included,
+		"music/song.mp3.tmp": ExcludedPattern,
+		"music/.hidden":      ExcludedHidden,
+		"music/Thumbs.db":    ExcludedSystem,
+		"music/empty.txt":    ExcludedSize,
+		"music/loop":         ExcludedSymlink,
+		"video/big.mkv":      ExcludedSize,
+		"video/skip/a.txt":   ExcludedPattern,
+	} {
+		chk, err := ix.Explain(root, filepath.Join(root, name))
+		require.NoError(t, err, name)
+		require.Equal(t, exp, chk.Reason, name)
+	}
+	chk, err := ix.Explain(root, filepath.Join(root, "video/skip/a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "video", "skip"), chk.Path)
+	require.Equal(t, "video/skip", chk.Pattern)
+
+	_, err = ix.Explain(root, filepath.Dir(root))
+	require.Error(t, err)
+
+	// follow symlinks, but detect loops
+	ix, err = NewIndexer(ShareRules{Hidden: true, Symlinks: SymlinksFollow})
+	require.NoError(t, err)
+	d, err = ix.Index(context.Background(), "share", root)
+	require.NoError(t, err)
+	music = d.Dir("music")
+	require.NotNil(t, music.File(".hidden"))
+	require.Nil(t, music.File("Thumbs.db"))
+	require.Nil(t, music.Dir("loop"))
+	require.NotNil(t, music.Dir("video").File("big.mkv"))
+
+	chk, err = ix.Explain(root, filepath.Join(root, "music", "loop"))
+	require.NoError(t, err)
+	require.Equal(t, ExcludedLoop, chk.Reason)
+	chk, err = ix.Explain(root, filepath.Join(root, "music", "video", "big.mkv"))
+	require.NoError(t, err)
+	require.True(t, chk.Shared())
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// minBurst is the minimal burst size of the Limiter, to avoid excessive syscalls on low rates.
+const minBurst = 4 * 1024
+
+// Limiter is a token bucket that limits a transfer rate in bytes per second.
+//
+// A nil Limiter or a Limiter with zero rate doesn't limit anything.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter with a given rate in bytes per second. Zero rate means no limit.
+func NewLimiter(rate int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate of the limiter. Zero rate means no limit.
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate < 0 {
+		rate = 0
+	}
+	l.rate = float64(rate)
+	l.burst = float64(rate)
+	if l.burst < minBurst {
+		l.burst = minBurst
+	}
+	l.tokens = l.burst
+	l.last = time.Now()
+}
+
+// Rate returns the current rate of the limiter.
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// burstSize returns the maximal number of bytes that should be transferred at once.
+func (l *Limiter) burstSize() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return 0
+	}
+	return int(l.burst)
+}
+
+// reserve takes n tokens from the bucket and returns the time to wait before using them.
+func (l *Limiter) reserve(now time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return 0
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// WaitN blocks until n bytes can be transferred.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	dt := l.reserve(time.Now(), n)
+	if dt <= 0 {
+		return nil
+	}
+	t := time.NewTimer(dt)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limits is a set of limiters that apply to a single transfer.
+type limits []*Limiter
+
+func (ls limits) chunk(n int) int {
+	for _, l := range ls {
+		if b := l.burstSize(); b > 0 && b < n {
+			n = b
+		}
+	}
+	return n
+}
+
+func (ls limits) wait(ctx context.Context, n int) error {
+	for _, l := range ls {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	ls  limits
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	p = p[:r.ls.chunk(len(p))]
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if err2 := r.ls.wait(r.ctx, n); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return n, err
+}
+
+type limitedWriter struct {
+	ctx context.Context
+	w   io.Writer
+	ls  limits
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		b := p[:w.ls.chunk(len(p))]
+		if err := w.ls.wait(w.ctx, len(b)); err != nil {
+			return total, err
+		}
+		n, err := w.w.Write(b)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// LimitReader returns a reader that is limited by all the given limiters.
+func LimitReader(ctx context.Context, r io.Reader, ls ...*Limiter) io.Reader {
+	return &limitedReader{ctx: ctx, r: r, ls: ls}
+}
+
+// LimitWriter returns a writer that is limited by all the given limiters.
+func LimitWriter(ctx context.Context, w io.Writer, ls ...*Limiter) io.Writer {
+	return &limitedWriter{ctx: ctx, w: w, ls: ls}
+}
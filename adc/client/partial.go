@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// ErrPartUnavailable is returned when requesting a file block that the peer doesn't have.
+var ErrPartUnavailable = errors.New("file part is not available from peer")
+
+// PartialFile describes a file that is being downloaded and can be partially shared.
+type PartialFile struct {
+	TTH       adc.TTH
+	Size      int64
+	BlockSize int64
+	Parts     adc.PartsInfo
+}
+
+// PartialShare provides information about partially downloaded files.
+type PartialShare interface {
+	// PartialFile returns the file with a given TTH, if it's being downloaded.
+	PartialFile(tth adc.TTH) (*PartialFile, bool)
+}
+
+// PartialSourceFunc is called when a peer advertises parts of a file it has.
+type PartialSourceFunc func(p *Peer, tth adc.TTH, parts adc.PartsInfo)
+
+// SetPartialShare enables partial file sharing for this hub connection.
+//
+// TTH searches for files in the partial share are answered with the list of available blocks.
+func (c *Conn) SetPartialShare(s PartialShare) {
+	c.partial.Lock()
+	c.partial.share = s
+	c.partial.Unlock()
+}
+
+// OnPartialSource sets a function that is called when a peer reports available parts of a file.
+func (c *Conn) OnPartialSource(fnc PartialSourceFunc) {
+	c.partial.Lock()
+	c.partial.onSource = fnc
+	c.partial.Unlock()
+}
+
+func (c *Conn) partialFile(tth adc.TTH) (*PartialFile, bool) {
+	c.partial.RLock()
+	s := c.partial.share
+	c.partial.RUnlock()
+	if s == nil {
+		return nil, false
+	}
+	f, ok := s.PartialFile(tth)
+	if !ok || f == nil || len(f.Parts) == 0 {
+		return nil, false
+	}
+	return f, true
+}
+
+func (c *Conn) partialResult(f *PartialFile, token string) adc.PartialResult {
+	tth := f.TTH
+	res := adc.PartialResult{
+		TTH:   &tth,
+		Count: len(f.Parts),
+		Parts: f.Parts,
+		Token: token,
+	}
+	if addr := c.conn.RemoteAddr(); addr != nil {
+		res.HubAddr = addr.String()
+	}
+	return res
+}
+
+// answerPartialSearch sends a list of available blocks in response to a TTH search.
+func (c *Conn) answerPartialSearch(p *Peer, sch adc.SearchRequest) {
+	if p == nil || sch.TTH == nil {
+		return
+	}
+	f, ok := c.partialFile(*sch.TTH)
+	if !ok {
+		return
+	}
+	sid := p.getSID()
+	if sid == nil {
+		return
+	}
+	if err := c.writeDirect(context.Background(), *sid, c.partialResult(f, sch.Token)); err != nil {
+		log.Println("failed to send partial result:", err)
+	}
+}
+
+// handlePartial handles partial file info sent by a peer.
+//
+// Peers answer our searches with a token set. In this case we send our own parts back
+// (without a token), so both sides learn about each other.
+func (c *Conn) handlePartial(p *Peer, res adc.PartialResult) {
+	if p == nil || res.TTH == nil {
+		return
+	}
+	c.partial.RLock()
+	fnc := c.partial.onSource
+	c.partial.RUnlock()
+	if fnc != nil && len(res.Parts) != 0 {
+		fnc(p, *res.TTH, res.Parts)
+	}
+	if res.Token == "" {
+		return
+	}
+	f, ok := c.partialFile(*res.TTH)
+	if !ok {
+		return
+	}
+	if sid := p.getSID(); sid != nil {
+		if err := c.writeDirect(context.Background(), *sid, c.partialResult(f, "")); err != nil {
+			log.Println("failed to send partial result:", err)
+		}
+	}
+}
+
+// GetBlock reads a single block of a file from the peer. Parts is the list of blocks
+// the peer advertised; the block is not requested if it's not in the list.
+func (c *PeerConn) GetBlock(ctx context.Context, f PartialFile, parts adc.PartsInfo, block int) (io.ReadCloser, error) {
+	if f.BlockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size: %d", f.BlockSize)
+	} else if !parts.Has(block) {
+		return nil, ErrPartUnavailable
+	}
+	off, size := adc.BlockRange(block, f.BlockSize, f.Size)
+	if size == 0 {
+		return nil, fmt.Errorf("block %d is out of range", block)
+	}
+	return c.readFile(ctx, "file", "TTH/"+f.TTH.Base32(), off, size)
+}
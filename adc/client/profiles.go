@@ -0,0 +1,286 @@
+package client
+
+import (
+	"context"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+// ShareStats is implemented by shares that report their size to the hub.
+type ShareStats interface {
+	Share
+	// Stats returns the total size and the number of shared files.
+	Stats() (size int64, files int)
+	// Changed returns a channel that is closed when the content of the share changes.
+	Changed() <-chan struct{}
+}
+
+var (
+	_ ShareStats    = (*ShareProfile)(nil)
+	_ ShareSearcher = (*ShareProfile)(nil)
+)
+
+// ShareProfile is a named set of shared directories.
+//
+// Each hub connection can be bound to its own profile (see SetShare and Config.Share),
+// so the same client exposes different content to different hubs. Directories are
+// described by file lists with TTH already computed. A directory can be added to
+// multiple profiles.
+type ShareProfile struct {
+	name string
+
+	mu     sync.RWMutex
+	dirs   []filelist.Dir // sorted by name
+	byTTH  map[adc.TTH]shareFile
+	index  *searchIndex
+	size   int64
+	files  int
+	change chan struct{} // closed and replaced when the content changes
+}
+
+type shareFile struct {
+	path string
+	file filelist.File
+}
+
+// NewShareProfile creates an empty share profile.
+func NewShareProfile(name string) *ShareProfile {
+	return &ShareProfile{
+		name:   name,
+		byTTH:  make(map[adc.TTH]shareFile),
+		change: make(chan struct{}),
+	}
+}
+
+// Name returns the name of the profile.
+func (p *ShareProfile) Name() string {
+	return p.name
+}
+
+// SetDir adds a directory to the share or replaces the directory with the same name.
+// The name of the directory is used as a top-level virtual name in the share.
+func (p *ShareProfile) SetDir(d filelist.Dir) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := sort.Search(len(p.dirs), func(i int) bool {
+		return p.dirs[i].Name >= d.Name
+	})
+	if i < len(p.dirs) && p.dirs[i].Name == d.Name {
+		p.dirs[i] = d
+	} else {
+		p.dirs = append(p.dirs, filelist.Dir{})
+		copy(p.dirs[i+1:], p.dirs[i:])
+		p.dirs[i] = d
+	}
+	p.reindex()
+}
+
+// RemoveDir removes a top-level directory from the share.
+// It returns false if there is no such directory.
+func (p *ShareProfile) RemoveDir(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.dirs {
+		if p.dirs[i].Name == name {
+			p.dirs = append(p.dirs[:i], p.dirs[i+1:]...)
+			p.reindex()
+			return true
+		}
+	}
+	return false
+}
+
+// Dirs returns the names of top-level shared directories.
+func (p *ShareProfile) Dirs() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]string, 0, len(p.dirs))
+	for _, d := range p.dirs {
+		out = append(out, d.Name)
+	}
+	return out
+}
+
+// reindex rebuilds the TTH index and share stats. It must be called with the lock held.
+func (p *ShareProfile) reindex() {
+	p.byTTH = make(map[adc.TTH]shareFile)
+	p.size, p.files = 0, 0
+	for i := range p.dirs {
+		d := &p.dirs[i]
+		prefix := "/" + d.Name + "/"
+		_ = d.Walk(func(fpath string, _ *filelist.Dir, f *filelist.File) error {
+			if f == nil {
+				return nil
+			}
+			p.size += f.Size
+			p.files++
+			if _, ok := p.byTTH[f.TTH]; !ok {
+				p.byTTH[f.TTH] = shareFile{path: prefix + fpath, file: *f}
+			}
+			return nil
+		})
+	}
+	p.index = newSearchIndex(p.dirs)
+	close(p.change)
+	p.change = make(chan struct{})
+}
+
+// Stats returns the total size and the number of shared files.
+// Files with the same TTH are counted multiple times.
+func (p *ShareProfile) Stats() (int64, int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.size, p.files
+}
+
+// Changed returns a channel that is closed when the content of the share changes.
+func (p *ShareProfile) Changed() <-chan struct{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.change
+}
+
+// lookup finds a directory or a file by a slash-separated path in the share.
+func (p *ShareProfile) lookup(fpath string) (*filelist.Dir, *filelist.File) {
+	l := filelist.FileList{Dirs: p.dirs}
+	return l.Lookup(fpath)
+}
+
+// FileInfo implements Share.
+func (p *ShareProfile) FileInfo(fpath string) (FileInfo, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var f *filelist.File
+	if strings.HasPrefix(fpath, "TTH/") {
+		var tth adc.TTH
+		if err := tth.FromBase32(strings.TrimPrefix(fpath, "TTH/")); err != nil {
+			return FileInfo{}, false
+		}
+		sf, ok := p.byTTH[tth]
+		if !ok {
+			return FileInfo{}, false
+		}
+		f = &sf.file
+	} else if _, f = p.lookup(fpath); f == nil {
+		return FileInfo{}, false
+	}
+	tth := f.TTH
+	return FileInfo{Size: f.Size, TTH: &tth}, true
+}
+
+// Search implements ShareSearcher.
+func (p *ShareProfile) Search(req adc.SearchRequest) []adc.SearchResult {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if req.TTH != nil {
+		sf, ok := p.byTTH[*req.TTH]
+		if !ok {
+			return nil
+		}
+		tth := sf.file.TTH
+		return []adc.SearchResult{{Path: sf.path, Size: sf.file.Size, TTH: &tth, Date: sf.file.Date}}
+	}
+	if len(req.And) == 0 || p.index == nil {
+		return nil
+	}
+	return p.index.search(req, maxSearchResults)
+}
+
+// dirResult returns a search result for a directory, with ASCH attributes.
+func dirResult(fpath string, d *filelist.Dir) adc.SearchResult {
+	r := adc.SearchResult{Path: fpath, Size: d.Size()}
+	_ = d.Walk(func(_ string, _ *filelist.Dir, f *filelist.File) error {
+		if f != nil {
+			r.Files++
+		} else {
+			r.Dirs++
+		}
+		return nil
+	})
+	return r
+}
+
+// matchSearch checks if a file or a directory (if f is nil) matches the search request.
+func matchSearch(req adc.SearchRequest, fpath string, f *filelist.File) bool {
+	if f == nil && req.Type == adc.FileTypeFile {
+		return false
+	} else if f != nil && req.Type == adc.FileTypeDir {
+		return false
+	}
+	name := strings.ToLower(fpath)
+	for _, s := range req.And {
+		if !strings.Contains(name, strings.ToLower(s)) {
+			return false
+		}
+	}
+	for _, s := range req.Not {
+		if strings.Contains(name, strings.ToLower(s)) {
+			return false
+		}
+	}
+	if f == nil {
+		return len(req.Ext) == 0 && req.Group == adc.ExtNone && req.Eq == 0 && req.Le == 0 && req.Ge == 0 &&
+			req.MinDate == 0 && req.MaxDate == 0
+	}
+	if req.Eq != 0 && f.Size != req.Eq {
+		return false
+	} else if req.Le != 0 && f.Size > req.Le {
+		return false
+	} else if req.Ge != 0 && f.Size < req.Ge {
+		return false
+	}
+	// ASCH: files with unknown dates never match the date range
+	if req.MinDate != 0 && f.Date < req.MinDate {
+		return false
+	} else if req.MaxDate != 0 && (f.Date == 0 || f.Date > req.MaxDate) {
+		return false
+	}
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(f.Name)), ".")
+	for _, e := range req.NoExt {
+		if strings.EqualFold(e, ext) {
+			return false
+		}
+	}
+	if len(req.Ext) == 0 && req.Group == adc.ExtNone {
+		return true
+	}
+	for _, e := range req.Ext {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	// SEGA: groups extend the list of extensions
+	return req.Group != adc.ExtNone && req.Group.Has(adc.ExtGroupOf(ext))
+}
+
+// advertiseShare sends the share size to the hub each time the share changes.
+func (c *Conn) advertiseShare(s ShareStats, stop <-chan struct{}) {
+	for {
+		changed := s.Changed()
+		size, files := s.Stats()
+		err := c.write(context.Background(), func(w *adc.Conn) error {
+			return w.WriteBroadcast(c.SID(), adc.UserMod{
+				adc.Tag{'S', 'S'}: strconv.FormatInt(size, 10),
+				adc.Tag{'S', 'F'}: strconv.Itoa(files),
+			})
+		})
+		if err != nil {
+			log.Println("failed to update the share size:", err)
+			return
+		}
+		select {
+		case <-changed:
+		case <-stop:
+			return
+		case <-c.closing:
+			return
+		}
+	}
+}
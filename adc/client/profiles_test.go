@@ -0,0 +1,151 @@
+package client
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+var (
+	testMusic = filelist.Dir{
+		Name: "music",
+		Dirs: []filelist.Dir{{
+			Name:  "rock",
+			Files: []filelist.File{{Name: "song.mp3", Size: 100, TTH: adc.TTH{1}}},
+		}},
+		Files: []filelist.File{{Name: "readme.txt", Size: 10, TTH: adc.TTH{2}}},
+	}
+	testVideo = filelist.Dir{
+		Name:  "video",
+		Files: []filelist.File{{Name: "movie.mkv", Size: 1000, TTH: adc.TTH{3}}},
+	}
+)
+
+func TestShareProfile(t *testing.T) {
+	p := NewShareProfile("public")
+	changed := p.Changed()
+	p.SetDir(testVideo)
+	p.SetDir(testMusic)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected a change")
+	}
+	require.Equal(t, []string{"music", "video"}, p.Dirs())
+	size, files := p.Stats()
+	require.Equal(t, int64(1110), size)
+	require.Equal(t, 3, files)
+
+	fi, ok := p.FileInfo("/music/rock/song.mp3")
+	require.True(t, ok)
+	require.Equal(t, int64(100), fi.Size)
+	fi, ok = p.FileInfo("TTH/" + adc.TTH{3}.Base32())
+	require.True(t, ok)
+	require.Equal(t, int64(1000), fi.Size)
+	_, ok = p.FileInfo("/music/rock")
+	require.False(t, ok)
+
+	tth := adc.TTH{1}
+	res := p.Search(adc.SearchRequest{TTH: &tth})
+	require.Len(t, res, 1)
+	require.Equal(t, "/music/rock/song.mp3", res[0].Path)
+
+	res = p.Search(adc.SearchRequest{And: []string{"ROCK"}})
+	require.Len(t, res, 2)
+	require.Equal(t, "/music/rock/", res[0].Path)
+	require.Equal(t, int64(100), res[0].Size)
+
+	res = p.Search(adc.SearchRequest{And: []string{"music"}, Type: adc.FileTypeFile, Ext: []string{"txt"}})
+	require.Len(t, res, 1)
+	require.Equal(t, "/music/readme.txt", res[0].Path)
+
+	// SEGA groups
+	res = p.Search(adc.SearchRequest{And: []string{"music"}, Group: adc.ExtAudio})
+	require.Len(t, res, 1)
+	require.Equal(t, "/music/rock/song.mp3", res[0].Path)
+	res = p.Search(adc.SearchRequest{And: []string{"music"}, Group: adc.ExtAudio, Ext: []string{"txt"}})
+	require.Len(t, res, 2)
+	res = p.Search(adc.SearchRequest{And: []string{"music"}, Group: adc.ExtAudio, NoExt: []string{"mp3"}})
+	require.Len(t, res, 0)
+
+	// ASCH dates and attributes
+	p.SetDir(filelist.Dir{
+		Name: "new",
+		Files: []filelist.File{
+			{Name: "old.txt", Size: 1, TTH: adc.TTH{4}, Date: 100},
+			{Name: "new.txt", Size: 1, TTH: adc.TTH{5}, Date: 200},
+		},
+	})
+	res = p.Search(adc.SearchRequest{And: []string{"txt"}, MinDate: 150})
+	require.Len(t, res, 1)
+	require.Equal(t, "/new/new.txt", res[0].Path)
+	require.Equal(t, int64(200), res[0].Date)
+	res = p.Search(adc.SearchRequest{And: []string{"txt"}, MaxDate: 150})
+	require.Len(t, res, 1)
+	require.Equal(t, "/new/old.txt", res[0].Path)
+	res = p.Search(adc.SearchRequest{And: []string{"rock"}, Type: adc.FileTypeDir})
+	require.Len(t, res, 1)
+	require.Equal(t, 1, res[0].Files)
+	require.Equal(t, 0, res[0].Dirs)
+	require.True(t, p.RemoveDir("new"))
+
+	require.True(t, p.RemoveDir("music"))
+	require.False(t, p.RemoveDir("music"))
+	size, files = p.Stats()
+	require.Equal(t, int64(1000), size)
+	require.Equal(t, 1, files)
+	_, ok = p.FileInfo("/music/readme.txt")
+	require.False(t, ok)
+}
+
+func TestShareProfilePerHub(t *testing.T) {
+	public, private := NewShareProfile("public"), NewShareProfile("private")
+	public.SetDir(testVideo)
+	private.SetDir(testVideo)
+	private.SetDir(testMusic)
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	hub, err := adc.NewConn(c2)
+	require.NoError(t, err)
+	c := &Conn{conn: conn, sid: adc.SID{'A', 'A', 'A', 'B'}, closing: make(chan struct{})}
+
+	expect := func(size, files string) {
+		p, err := hub.ReadPacket(time.Now().Add(5 * time.Second))
+		require.NoError(t, err)
+		b, ok := p.(*adc.BroadcastPacket)
+		require.True(t, ok, "%T", p)
+		var u adc.UserMod
+		require.NoError(t, adc.Unmarshal(b.Data, &u))
+		require.Equal(t, size, u[adc.Tag{'S', 'S'}])
+		require.Equal(t, files, u[adc.Tag{'S', 'F'}])
+	}
+
+	c.SetShare(public)
+	expect("1000", "1")
+	require.Equal(t, adc.ErrFileNotAvailable("").Status, c.answerInfo(adc.GetInfoRequest{Type: "file", Path: "/music/readme.txt"}))
+
+	// changes of other profiles are not reported
+	private.RemoveDir("video")
+	public.SetDir(testMusic)
+	expect("1110", "3")
+
+	c.SetShare(private)
+	expect("110", "2")
+	_, ok := c.answerInfo(adc.GetInfoRequest{Type: "file", Path: "/music/readme.txt"}).(adc.SearchResult)
+	require.True(t, ok)
+
+	c.SetShare(nil)
+	public.RemoveDir("music")
+	_, err = hub.ReadPacket(time.Now().Add(50 * time.Millisecond))
+	require.True(t, os.IsTimeout(err), "%v", err)
+}
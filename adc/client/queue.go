@@ -0,0 +1,452 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const (
+	// minBlockSize is the minimal size of a TTH leaf block used for download segments.
+	minBlockSize = 64 * 1024
+	// maxBlocks is the maximal number of segments per file.
+	maxBlocks = 512
+)
+
+var (
+	ErrAlreadyQueued = errors.New("file is already queued")
+	ErrNotQueued     = errors.New("file is not queued")
+)
+
+// Priority of a queued bundle.
+type Priority int
+
+const (
+	PriorityPaused = Priority(iota)
+	PriorityLowest
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+	PriorityHighest
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityPaused:
+		return "paused"
+	case PriorityLowest:
+		return "lowest"
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityHighest:
+		return "highest"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// BlockSize returns a segment size for a file of a given size.
+// It's always a power of two multiple of the minimal TTH leaf block size.
+func BlockSize(size int64) int64 {
+	bs := int64(minBlockSize)
+	for size/bs >= maxBlocks {
+		bs *= 2
+	}
+	return bs
+}
+
+// QueueItem is a state of a single queued file.
+type QueueItem struct {
+	Target    string        `json:"target"`
+	Size      int64         `json:"size"`
+	TTH       adc.TTH       `json:"tth"`
+	BlockSize int64         `json:"block"`
+	Done      adc.PartsInfo `json:"done,omitempty"`
+}
+
+// Blocks returns the total number of segments in the file.
+func (it *QueueItem) Blocks() int {
+	if it.BlockSize <= 0 {
+		return 0
+	}
+	return int((it.Size + it.BlockSize - 1) / it.BlockSize)
+}
+
+// Downloaded returns the number of downloaded bytes.
+func (it *QueueItem) Downloaded() int64 {
+	var n int64
+	for i := 0; i+1 < len(it.Done); i += 2 {
+		for b := it.Done[i]; b < it.Done[i+1]; b++ {
+			_, size := adc.BlockRange(b, it.BlockSize, it.Size)
+			n += size
+		}
+	}
+	return n
+}
+
+// Complete checks if all segments of the file are downloaded.
+func (it *QueueItem) Complete() bool {
+	return it.Done.Blocks() >= it.Blocks()
+}
+
+// Bundle is a group of files from the same directory that share the priority.
+type Bundle struct {
+	Dir      string      `json:"dir"`
+	Priority Priority    `json:"prio"`
+	Added    time.Time   `json:"added"`
+	Items    []QueueItem `json:"items"`
+}
+
+// Size returns the total size of all files in the bundle.
+func (b *Bundle) Size() int64 {
+	var n int64
+	for i := range b.Items {
+		n += b.Items[i].Size
+	}
+	return n
+}
+
+// Downloaded returns the number of downloaded bytes in the bundle.
+func (b *Bundle) Downloaded() int64 {
+	var n int64
+	for i := range b.Items {
+		n += b.Items[i].Downloaded()
+	}
+	return n
+}
+
+type queueBundle struct {
+	dir   string
+	prio  Priority
+	added time.Time
+	items []*QueueItem
+}
+
+func (b *queueBundle) snapshot() Bundle {
+	out := Bundle{Dir: b.dir, Priority: b.prio, Added: b.added}
+	out.Items = make([]QueueItem, 0, len(b.items))
+	for _, it := range b.items {
+		c := *it
+		c.Done = append(adc.PartsInfo(nil), it.Done...)
+		out.Items = append(out.Items, c)
+	}
+	return out
+}
+
+// Queue is a download queue that groups files into bundles.
+type Queue struct {
+	// OnItemDone is called when all segments of a file are downloaded.
+	OnItemDone func(it QueueItem)
+	// OnBundleDone is called when all files in a bundle are downloaded.
+	// The bundle is removed from the queue after this call.
+	OnBundleDone func(b Bundle)
+
+	mu      sync.RWMutex
+	bundles map[string]*queueBundle
+	byTTH   map[adc.TTH]*QueueItem
+	bundle  map[*QueueItem]*queueBundle
+}
+
+// NewQueue creates an empty download queue.
+func NewQueue() *Queue {
+	return &Queue{
+		bundles: make(map[string]*queueBundle),
+		byTTH:   make(map[adc.TTH]*QueueItem),
+		bundle:  make(map[*QueueItem]*queueBundle),
+	}
+}
+
+func bundleDir(target string) string {
+	return filepath.Dir(filepath.Clean(target))
+}
+
+// Add queues a file for download. The file is added to a bundle for its target directory.
+// New bundles have a normal priority.
+func (q *Queue) Add(target string, size int64, tth adc.TTH) (QueueItem, error) {
+	if size < 0 {
+		return QueueItem{}, fmt.Errorf("invalid file size: %d", size)
+	}
+	it := &QueueItem{
+		Target:    filepath.Clean(target),
+		Size:      size,
+		TTH:       tth,
+		BlockSize: BlockSize(size),
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.byTTH[tth]; ok {
+		return QueueItem{}, ErrAlreadyQueued
+	}
+	q.add(it, PriorityNormal, time.Now().UTC())
+	return *it, nil
+}
+
+func (q *Queue) add(it *QueueItem, prio Priority, added time.Time) {
+	dir := bundleDir(it.Target)
+	b := q.bundles[dir]
+	if b == nil {
+		b = &queueBundle{dir: dir, prio: prio, added: added}
+		q.bundles[dir] = b
+	}
+	b.items = append(b.items, it)
+	q.byTTH[it.TTH] = it
+	q.bundle[it] = b
+}
+
+// Remove removes a file from the queue. Empty bundles are removed as well.
+func (q *Queue) Remove(tth adc.TTH) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	it := q.byTTH[tth]
+	if it == nil {
+		return ErrNotQueued
+	}
+	q.remove(it)
+	return nil
+}
+
+func (q *Queue) remove(it *QueueItem) {
+	b := q.bundle[it]
+	delete(q.byTTH, it.TTH)
+	delete(q.bundle, it)
+	for i, it2 := range b.items {
+		if it2 == it {
+			b.items = append(b.items[:i], b.items[i+1:]...)
+			break
+		}
+	}
+	if len(b.items) == 0 {
+		delete(q.bundles, b.dir)
+	}
+}
+
+// Item returns a queued file by TTH.
+func (q *Queue) Item(tth adc.TTH) (QueueItem, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	it := q.byTTH[tth]
+	if it == nil {
+		return QueueItem{}, false
+	}
+	c := *it
+	c.Done = append(adc.PartsInfo(nil), it.Done...)
+	return c, true
+}
+
+// SetPriority changes the priority of a bundle in a given directory.
+func (q *Queue) SetPriority(dir string, prio Priority) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b := q.bundles[filepath.Clean(dir)]
+	if b == nil {
+		return ErrNotQueued
+	}
+	b.prio = prio
+	return nil
+}
+
+// sorted returns bundles in the download order: highest priority first, then the oldest.
+func (q *Queue) sorted() []*queueBundle {
+	out := make([]*queueBundle, 0, len(q.bundles))
+	for _, b := range q.bundles {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.prio != b.prio {
+			return a.prio > b.prio
+		}
+		if !a.added.Equal(b.added) {
+			return a.added.Before(b.added)
+		}
+		return a.dir < b.dir
+	})
+	return out
+}
+
+// Bundles returns all bundles in the download order.
+func (q *Queue) Bundles() []Bundle {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	arr := q.sorted()
+	out := make([]Bundle, 0, len(arr))
+	for _, b := range arr {
+		out = append(out, b.snapshot())
+	}
+	return out
+}
+
+// Next returns the next incomplete file to download. Paused bundles are skipped.
+// The skip function can be used to exclude files that are already being downloaded.
+func (q *Queue) Next(skip func(tth adc.TTH) bool) (QueueItem, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	for _, b := range q.sorted() {
+		if b.prio == PriorityPaused {
+			continue
+		}
+		for _, it := range b.items {
+			if it.Complete() || (skip != nil && skip(it.TTH)) {
+				continue
+			}
+			c := *it
+			c.Done = append(adc.PartsInfo(nil), it.Done...)
+			return c, true
+		}
+	}
+	return QueueItem{}, false
+}
+
+// MarkDone marks blocks in the [start, end) range of a file as downloaded.
+//
+// Completion events are emitted when the file or the whole bundle is complete.
+func (q *Queue) MarkDone(tth adc.TTH, start, end int) error {
+	q.mu.Lock()
+	it := q.byTTH[tth]
+	if it == nil {
+		q.mu.Unlock()
+		return ErrNotQueued
+	}
+	if n := it.Blocks(); start < 0 || end > n || start >= end {
+		q.mu.Unlock()
+		return fmt.Errorf("invalid block range [%d, %d) for %d blocks", start, end, n)
+	}
+	wasDone := it.Complete()
+	it.Done = it.Done.Add(start, end)
+	if wasDone || !it.Complete() {
+		q.mu.Unlock()
+		return nil
+	}
+	itemDone := *it
+	b := q.bundle[it]
+	bundleDone := true
+	for _, it2 := range b.items {
+		if !it2.Complete() {
+			bundleDone = false
+			break
+		}
+	}
+	var bundle Bundle
+	if bundleDone {
+		bundle = b.snapshot()
+		for _, it2 := range b.items {
+			delete(q.byTTH, it2.TTH)
+			delete(q.bundle, it2)
+		}
+		delete(q.bundles, b.dir)
+	}
+	q.mu.Unlock()
+
+	if q.OnItemDone != nil {
+		q.OnItemDone(itemDone)
+	}
+	if bundleDone && q.OnBundleDone != nil {
+		q.OnBundleDone(bundle)
+	}
+	return nil
+}
+
+// Invalidate marks blocks of a file as missing, so they will be downloaded again.
+func (q *Queue) Invalidate(tth adc.TTH, bad adc.PartsInfo) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	it := q.byTTH[tth]
+	if it == nil {
+		return ErrNotQueued
+	}
+	it.Done = bad.Missing(it.Done)
+	return nil
+}
+
+// MarkVerified checks blocks in the [start, end) range downloaded from a given source,
+// marks valid blocks as done and returns the corrupted ones.
+//
+// Corrupted blocks stay in the queue and the source is reported to the blacklist,
+// so the blocks are downloaded again from a different source.
+func (q *Queue) MarkVerified(v *Verifier, r io.ReaderAt, start, end int, src adc.CID, bl *Blacklist) (adc.PartsInfo, error) {
+	bad, err := v.VerifyRange(r, start, end)
+	if err != nil {
+		return nil, err
+	}
+	good := bad.Missing(adc.NewPartsInfo([2]int{start, end}))
+	for i := 0; i+1 < len(good); i += 2 {
+		if err = q.MarkDone(v.tth, good[i], good[i+1]); err != nil {
+			return bad, err
+		}
+	}
+	if len(bad) != 0 && bl != nil {
+		bl.Report(v.tth, src)
+	}
+	return bad, nil
+}
+
+// PartialFile implements PartialShare, so the downloaded parts of queued files
+// can be shared with other peers.
+func (q *Queue) PartialFile(tth adc.TTH) (*PartialFile, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	it := q.byTTH[tth]
+	if it == nil || len(it.Done) == 0 {
+		return nil, false
+	}
+	return &PartialFile{
+		TTH:       it.TTH,
+		Size:      it.Size,
+		BlockSize: it.BlockSize,
+		Parts:     append(adc.PartsInfo(nil), it.Done...),
+	}, true
+}
+
+var _ PartialShare = (*Queue)(nil)
+
+type queueFile struct {
+	Version int      `json:"v"`
+	Bundles []Bundle `json:"bundles"`
+}
+
+const queueVersion = 1
+
+// Save writes the queue state, including downloaded segments, in a compact JSON format.
+func (q *Queue) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(queueFile{
+		Version: queueVersion,
+		Bundles: q.Bundles(),
+	})
+}
+
+// Load reads the queue state written by Save and adds it to the queue.
+// Files that are already queued are skipped.
+func (q *Queue) Load(r io.Reader) error {
+	var f queueFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	} else if f.Version != queueVersion {
+		return fmt.Errorf("unsupported queue version: %d", f.Version)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range f.Bundles {
+		for i := range b.Items {
+			it := b.Items[i]
+			if _, ok := q.byTTH[it.TTH]; ok {
+				continue
+			}
+			if it.BlockSize <= 0 {
+				it.BlockSize = BlockSize(it.Size)
+			}
+			// the directory of the bundle is derived from the targets
+			q.add(&it, b.Priority, b.Added)
+		}
+	}
+	return nil
+}
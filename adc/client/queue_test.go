@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestBlockSize(t *testing.T) {
+	require.Equal(t, int64(64*1024), BlockSize(0))
+	require.Equal(t, int64(64*1024), BlockSize(511*64*1024))
+	require.Equal(t, int64(128*1024), BlockSize(512*64*1024))
+}
+
+func TestQueueBundles(t *testing.T) {
+	q := NewQueue()
+	var (
+		items   []string
+		bundles []string
+	)
+	q.OnItemDone = func(it QueueItem) {
+		items = append(items, filepath.Base(it.Target))
+	}
+	q.OnBundleDone = func(b Bundle) {
+		bundles = append(bundles, b.Dir)
+	}
+	dirA := filepath.Join("dl", "a")
+	dirB := filepath.Join("dl", "b")
+
+	_, err := q.Add(filepath.Join(dirA, "1"), 100, adc.TTH{1})
+	require.NoError(t, err)
+	_, err = q.Add(filepath.Join(dirA, "2"), 200*1024, adc.TTH{2})
+	require.NoError(t, err)
+	_, err = q.Add(filepath.Join(dirB, "3"), 100, adc.TTH{3})
+	require.NoError(t, err)
+	_, err = q.Add(filepath.Join(dirB, "4"), 100, adc.TTH{3})
+	require.Equal(t, ErrAlreadyQueued, err)
+
+	require.NoError(t, q.SetPriority(dirB, PriorityHigh))
+	bs := q.Bundles()
+	require.Len(t, bs, 2)
+	require.Equal(t, dirB, bs[0].Dir)
+	require.Len(t, bs[1].Items, 2)
+
+	it, ok := q.Next(nil)
+	require.True(t, ok)
+	require.Equal(t, adc.TTH{3}, it.TTH)
+
+	require.NoError(t, q.SetPriority(dirB, PriorityPaused))
+	it, ok = q.Next(func(tth adc.TTH) bool { return tth == adc.TTH{1} })
+	require.True(t, ok)
+	require.Equal(t, adc.TTH{2}, it.TTH)
+	require.Equal(t, 4, it.Blocks())
+
+	// partial file is shared
+	_, ok = q.PartialFile(adc.TTH{2})
+	require.False(t, ok)
+	require.NoError(t, q.MarkDone(adc.TTH{2}, 0, 2))
+	pf, ok := q.PartialFile(adc.TTH{2})
+	require.True(t, ok)
+	require.Equal(t, adc.PartsInfo{0, 2}, pf.Parts)
+	require.Error(t, q.MarkDone(adc.TTH{2}, 3, 5))
+
+	require.NoError(t, q.MarkDone(adc.TTH{1}, 0, 1))
+	require.Equal(t, []string{"1"}, items)
+	require.Empty(t, bundles)
+
+	require.NoError(t, q.MarkDone(adc.TTH{2}, 2, 4))
+	require.Equal(t, []string{"1", "2"}, items)
+	require.Equal(t, []string{dirA}, bundles)
+	require.Len(t, q.Bundles(), 1)
+
+	require.NoError(t, q.Remove(adc.TTH{3}))
+	require.Empty(t, q.Bundles())
+	require.Equal(t, ErrNotQueued, q.Remove(adc.TTH{3}))
+}
+
+func TestQueuePersist(t *testing.T) {
+	q := NewQueue()
+	_, err := q.Add(filepath.Join("a", "1"), 1024*1024, adc.TTH{1})
+	require.NoError(t, err)
+	_, err = q.Add(filepath.Join("b", "2"), 100, adc.TTH{2})
+	require.NoError(t, err)
+	require.NoError(t, q.SetPriority("b", PriorityLow))
+	require.NoError(t, q.MarkDone(adc.TTH{1}, 2, 5))
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, q.Save(buf))
+
+	q2 := NewQueue()
+	require.NoError(t, q2.Load(buf))
+	require.Equal(t, q.Bundles(), q2.Bundles())
+
+	it, ok := q2.Item(adc.TTH{1})
+	require.True(t, ok)
+	require.Equal(t, adc.PartsInfo{2, 5}, it.Done)
+	require.Equal(t, int64(3*64*1024), it.Downloaded())
+}
@@ -0,0 +1,375 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// DefaultSearchTimeout is used for searches if the context has no deadline.
+const DefaultSearchTimeout = 30 * time.Second
+
+// maxSearchQueue is the maximal number of results queued for a slow reader of a search.
+// Results received when the queue is full are dropped.
+const maxSearchQueue = 1024
+
+var errEmptySearch = errors.New("empty search request")
+
+// Search is a typed search request.
+type Search struct {
+	// And is a list of terms that must be present in the path.
+	And []string
+	// Not is a list of terms that must not be present in the path.
+	Not []string
+	// Ext is a list of file extensions to search for.
+	Ext []string
+	// NoExt is a list of extensions to exclude from the Group (SEGA extension).
+	NoExt []string
+	// Group is a set of file type groups to search for (SEGA extension).
+	Group adc.ExtGroup
+
+	// MinSize and MaxSize set an inclusive size range. Zero means no limit.
+	MinSize int64
+	MaxSize int64
+	// Size requires an exact file size.
+	Size int64
+
+	// Type restricts results to files or directories only.
+	Type adc.FileType
+
+	// MinDate and MaxDate set an inclusive range of file modification time (ASCH extension).
+	// Zero value means no limit. Searches with dates only reach peers that support ASCH.
+	MinDate time.Time
+	MaxDate time.Time
+
+	// TTH searches for a file with a given hash. Other filters are ignored.
+	TTH *adc.TTH
+}
+
+// Request builds an ADC SCH message for the search.
+func (s Search) Request(token string) (adc.SearchRequest, error) {
+	req := adc.SearchRequest{Token: token}
+	if s.TTH != nil {
+		if s.TTH.IsZero() {
+			return req, errors.New("empty TTH in search")
+		}
+		req.TTH = s.TTH
+		return req, nil
+	}
+	for _, v := range s.And {
+		if v = strings.TrimSpace(v); v != "" {
+			req.And = append(req.And, v)
+		}
+	}
+	for _, v := range s.Not {
+		if v = strings.TrimSpace(v); v != "" {
+			req.Not = append(req.Not, v)
+		}
+	}
+	req.Ext = normExts(s.Ext)
+	req.NoExt = normExts(s.NoExt)
+	req.Group = s.Group
+	if s.MinSize < 0 || s.MaxSize < 0 || s.Size < 0 {
+		return req, errors.New("negative size in search")
+	} else if s.MaxSize != 0 && s.MinSize > s.MaxSize {
+		return req, fmt.Errorf("invalid size range: [%d, %d]", s.MinSize, s.MaxSize)
+	}
+	if s.Size != 0 {
+		req.Eq = s.Size
+	} else {
+		req.Ge = s.MinSize
+		req.Le = s.MaxSize
+	}
+	if !s.MinDate.IsZero() {
+		req.MinDate = s.MinDate.Unix()
+	}
+	if !s.MaxDate.IsZero() {
+		req.MaxDate = s.MaxDate.Unix()
+		if req.MinDate > req.MaxDate {
+			return req, fmt.Errorf("invalid date range: [%v, %v]", s.MinDate, s.MaxDate)
+		}
+	}
+	switch s.Type {
+	case adc.FileTypeAny, adc.FileTypeFile, adc.FileTypeDir:
+		req.Type = s.Type
+	default:
+		return req, fmt.Errorf("invalid file type: %d", s.Type)
+	}
+	if len(req.And) == 0 && len(req.Ext) == 0 && req.Group == adc.ExtNone {
+		return req, errEmptySearch
+	}
+	return req, nil
+}
+
+func normExts(arr []string) []string {
+	var out []string
+	for _, v := range arr {
+		v = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), "."))
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// SearchResult is a single result returned by a peer.
+type SearchResult struct {
+	// Peer that returned the result. Might be nil, if the peer is not known.
+	Peer *Peer
+	// Path is a path of the file or directory in the peer's share.
+	Path  string
+	Dir   bool
+	Size  int64
+	Slots int
+	TTH   *adc.TTH
+	// Group is a file type group of the file (see SEGA extension).
+	// It's ExtNone for directories and files of unknown types.
+	Group adc.ExtGroup
+
+	// Attributes below are only reported by peers that support ASCH.
+
+	// Modified is the modification time of the file. Zero if unknown.
+	Modified time.Time
+	// Files and Dirs are the number of files and subdirectories in the directory.
+	Files int
+	Dirs  int
+}
+
+// Name returns a base name of the file or directory.
+func (r SearchResult) Name() string {
+	path := strings.TrimSuffix(r.Path, "/")
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// ParseSearchResult converts an ADC RES message into a typed result.
+func ParseSearchResult(p *Peer, res adc.SearchResult) (SearchResult, error) {
+	if res.Path == "" {
+		return SearchResult{}, errors.New("no path in search result")
+	} else if res.Size < 0 {
+		return SearchResult{}, fmt.Errorf("invalid size in search result: %d", res.Size)
+	}
+	r := SearchResult{
+		Peer:  p,
+		Path:  res.Path,
+		Dir:   strings.HasSuffix(res.Path, "/"),
+		Size:  res.Size,
+		Slots: res.Slots,
+		TTH:   res.TTH,
+	}
+	if !r.Dir {
+		r.Group = adc.ExtGroupOf(r.Name())
+	}
+	if res.Date > 0 {
+		r.Modified = time.Unix(res.Date, 0)
+	}
+	if r.Dir {
+		r.Files, r.Dirs = res.Files, res.Dirs
+	}
+	return r, nil
+}
+
+type searchKey struct {
+	cid  adc.CID
+	src  string // the source of the result, if the peer is unknown
+	path string
+}
+
+// activeSearch collects results for a single search token.
+type activeSearch struct {
+	ctx    context.Context
+	out    chan SearchResult
+	notify chan struct{}
+
+	mu    sync.Mutex
+	seen  map[searchKey]struct{}
+	queue []SearchResult
+}
+
+// push adds a result to the queue, unless it was already seen or the queue is full.
+// The source is used to distinguish results if the peer is unknown.
+func (s *activeSearch) push(src string, r SearchResult) {
+	key := searchKey{path: r.Path}
+	if r.Peer != nil {
+		key.cid = r.Peer.Info().Id
+	} else {
+		key.src = src
+	}
+	s.mu.Lock()
+	if _, ok := s.seen[key]; ok || len(s.queue) >= maxSearchQueue {
+		s.mu.Unlock()
+		return
+	}
+	s.seen[key] = struct{}{}
+	s.queue = append(s.queue, r)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued results to the output channel, until the search is done.
+func (s *activeSearch) run(done func()) {
+	defer close(s.out)
+	defer done()
+	for {
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, r := range queue {
+			select {
+			case s.out <- r:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-s.notify:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Search sends a search request to the hub and returns a channel of results.
+//
+// Results are deduplicated by the peer and path. Results are dropped if the reader
+// falls behind by too many of them. The channel is closed when the context is cancelled,
+// or after the search timeout (see Timeouts) if the context has no deadline.
+func (c *Conn) Search(ctx context.Context, s Search) (<-chan SearchResult, error) {
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); ok {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, c.timeouts.search())
+	}
+	as := &activeSearch{
+		ctx:    ctx,
+		out:    make(chan SearchResult),
+		notify: make(chan struct{}, 1),
+		seen:   make(map[searchKey]struct{}),
+	}
+	token := c.addSearch(as)
+	req, err := s.Request(token)
+	if err == nil {
+		err = c.writeSearch(ctx, req)
+	}
+	if err != nil {
+		cancel()
+		c.removeSearch(token)
+		return nil, err
+	}
+	go as.run(func() {
+		cancel()
+		c.removeSearch(token)
+	})
+	return as.out, nil
+}
+
+// writeSearch broadcasts a search request. Searches by file type groups (SEGA) are sent
+// as is only to peers that support the extension, other peers receive a search
+// by the list of extensions in these groups. Searches by modification date are
+// only sent to peers that support ASCH, since others would ignore the date range.
+func (c *Conn) writeSearch(ctx context.Context, req adc.SearchRequest) error {
+	asch := req.MinDate != 0 || req.MaxDate != 0
+	if req.Group == adc.ExtNone && !asch {
+		return c.writeBroadcast(ctx, req)
+	}
+	features := func(sega bool) map[adc.Feature]bool {
+		m := make(map[adc.Feature]bool)
+		if req.Group != adc.ExtNone {
+			m[adc.FeaSEGA] = sega
+		}
+		if asch {
+			m[adc.FeaASCH] = true
+		}
+		return m
+	}
+	return c.write(ctx, func(w *adc.Conn) error {
+		err := w.WriteFeatureBroadcast(c.SID(), features(true), req)
+		if err != nil || req.Group == adc.ExtNone {
+			return err
+		}
+		return w.WriteFeatureBroadcast(c.SID(), features(false), req.ExpandGroups())
+	})
+}
+
+func (c *Conn) writeBroadcast(ctx context.Context, msg adc.Message) error {
+	return c.write(ctx, func(w *adc.Conn) error {
+		return w.WriteBroadcast(c.SID(), msg)
+	})
+}
+
+func (c *Conn) addSearch(s *activeSearch) string {
+	c.search.Lock()
+	defer c.search.Unlock()
+	if c.search.tokens == nil {
+		c.search.tokens = make(map[string]*activeSearch)
+	}
+	for {
+		tok := strconv.FormatUint(uint64(rand.Uint32()), 36)
+		if _, ok := c.search.tokens[tok]; !ok {
+			c.search.tokens[tok] = s
+			return tok
+		}
+		// collision, pick another token
+	}
+}
+
+func (c *Conn) removeSearch(token string) {
+	c.search.Lock()
+	delete(c.search.tokens, token)
+	c.search.Unlock()
+}
+
+// handleResult dispatches a search result to an active search.
+// The source identifies the sender if the peer is unknown.
+func (c *Conn) handleResult(p *Peer, src string, res adc.SearchResult) {
+	c.search.Lock()
+	s := c.search.tokens[res.Token]
+	c.search.Unlock()
+	if s == nil {
+		// search is already done
+		return
+	}
+	r, err := ParseSearchResult(p, res)
+	if err != nil {
+		log.Println("invalid search result:", err)
+		return
+	}
+	s.push(src, r)
+}
+
+// HandleUDP handles search results received by an UDP server in active mode.
+// It is registered automatically for the server set in Config.UDP.
+func (c *Conn) HandleUDP(addr net.Addr, p *adc.UDPPacket) {
+	switch p.Name {
+	case (adc.SearchResult{}).Cmd():
+		var res adc.SearchResult
+		if err := adc.Unmarshal(p.Data, &res); err != nil {
+			log.Println("failed to decode search result:", err)
+			return
+		}
+		c.handleResult(c.peerByCID(p.ID), addr.String(), res)
+	case (adc.PartialResult{}).Cmd():
+		var res adc.PartialResult
+		if err := adc.Unmarshal(p.Data, &res); err != nil {
+			log.Println("failed to decode partial result:", err)
+			return
+		}
+		c.handlePartial(c.peerByCID(p.ID), res)
+	}
+}
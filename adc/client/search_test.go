@@ -0,0 +1,271 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func TestSearchRequest(t *testing.T) {
+	tth := adc.TTH{1}
+	cases := []struct {
+		name string
+		s    Search
+		exp  adc.SearchRequest
+		err  bool
+	}{
+		{
+			name: "terms",
+			s: Search{
+				And: []string{"foo", " ", "bar "}, Not: []string{"baz"},
+				Ext: []string{".MKV", "avi"}, MinSize: 10, MaxSize: 20,
+				Type: adc.FileTypeFile,
+			},
+			exp: adc.SearchRequest{
+				Token: "t", And: []string{"foo", "bar"}, Not: []string{"baz"},
+				Ext: []string{"mkv", "avi"}, Ge: 10, Le: 20,
+				Type: adc.FileTypeFile,
+			},
+		},
+		{
+			name: "group",
+			s:    Search{Group: adc.ExtVideo | adc.ExtAudio, NoExt: []string{"wav"}, Size: 5},
+			exp: adc.SearchRequest{
+				Token: "t", Group: adc.ExtVideo | adc.ExtAudio, NoExt: []string{"wav"}, Eq: 5,
+			},
+		},
+		{
+			name: "dates",
+			s:    Search{And: []string{"a"}, MinDate: time.Unix(100, 0), MaxDate: time.Unix(200, 0)},
+			exp:  adc.SearchRequest{Token: "t", And: []string{"a"}, MinDate: 100, MaxDate: 200},
+		},
+		{
+			name: "tth",
+			s:    Search{TTH: &tth, And: []string{"ignored"}},
+			exp:  adc.SearchRequest{Token: "t", TTH: &tth},
+		},
+		{name: "empty", s: Search{Not: []string{"foo"}}, err: true},
+		{name: "range", s: Search{And: []string{"a"}, MinSize: 20, MaxSize: 10}, err: true},
+		{name: "zero tth", s: Search{TTH: &adc.TTH{}}, err: true},
+		{name: "date range", s: Search{And: []string{"a"}, MinDate: time.Unix(200, 0), MaxDate: time.Unix(100, 0)}, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := c.s.Request("t")
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, req)
+		})
+	}
+}
+
+func TestParseSearchResult(t *testing.T) {
+	r, err := ParseSearchResult(nil, adc.SearchResult{Path: "/share/dir/", Slots: 2, Files: 3, Dirs: 1})
+	require.NoError(t, err)
+	require.True(t, r.Dir)
+	require.Equal(t, 3, r.Files)
+	require.Equal(t, 1, r.Dirs)
+	require.Equal(t, "dir", r.Name())
+	require.Equal(t, adc.ExtNone, r.Group)
+
+	r, err = ParseSearchResult(nil, adc.SearchResult{Path: "/share/file.txt", Size: 3, Date: 100})
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(100, 0), r.Modified)
+	require.False(t, r.Dir)
+	require.Equal(t, "file.txt", r.Name())
+	require.Equal(t, adc.ExtDoc, r.Group)
+
+	_, err = ParseSearchResult(nil, adc.SearchResult{})
+	require.Error(t, err)
+}
+
+func TestWriteSearchGroups(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	hub, err := adc.NewConn(c2)
+	require.NoError(t, err)
+	c := &Conn{conn: conn, sid: adc.SID{'A', 'A', 'A', 'B'}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.writeSearch(ctx, adc.SearchRequest{Token: "t", And: []string{"a"}, Group: adc.ExtArch, NoExt: []string{"zip"}})
+	}()
+
+	read := func() (map[adc.Feature]bool, adc.SearchRequest) {
+		p, err := hub.ReadPacket(time.Now().Add(5 * time.Second))
+		require.NoError(t, err)
+		fp, ok := p.(*adc.FeaturePacket)
+		require.True(t, ok, "%T", p)
+		var req adc.SearchRequest
+		require.NoError(t, adc.Unmarshal(fp.Data, &req))
+		return fp.Features, req
+	}
+	fea, req := read()
+	require.Equal(t, map[adc.Feature]bool{adc.FeaSEGA: true}, fea)
+	require.Equal(t, adc.ExtArch, req.Group)
+	require.Equal(t, []string{"zip"}, req.NoExt)
+
+	fea, req = read()
+	require.Equal(t, map[adc.Feature]bool{adc.FeaSEGA: false}, fea)
+	require.Equal(t, adc.ExtNone, req.Group)
+	require.Contains(t, req.Ext, "rar")
+	require.NotContains(t, req.Ext, "zip")
+	require.NoError(t, <-errc)
+
+	// date searches are only sent to ASCH peers
+	go func() {
+		errc <- c.writeSearch(ctx, adc.SearchRequest{Token: "t", And: []string{"a"}, MinDate: 100})
+	}()
+	fea, req = read()
+	require.Equal(t, map[adc.Feature]bool{adc.FeaASCH: true}, fea)
+	require.Equal(t, int64(100), req.MinDate)
+	require.NoError(t, <-errc)
+}
+
+func TestSearchDedup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c := &Conn{}
+	p1 := &Peer{hub: c, user: &adc.User{Id: adc.CID{1}}}
+	p2 := &Peer{hub: c, user: &adc.User{Id: adc.CID{2}}}
+
+	s := &activeSearch{
+		ctx:    ctx,
+		out:    make(chan SearchResult),
+		notify: make(chan struct{}, 1),
+		seen:   make(map[searchKey]struct{}),
+	}
+	tok := c.addSearch(s)
+	go s.run(func() { c.removeSearch(tok) })
+
+	for _, p := range []*Peer{p1, p1, p2} {
+		c.handleResult(p, "", adc.SearchResult{Token: tok, Path: "/a"})
+	}
+	c.handleResult(p1, "", adc.SearchResult{Token: "other", Path: "/b"})
+	// unknown peers are distinguished by the source
+	for _, src := range []string{"AAAB", "AAAB", "AAAC"} {
+		c.handleResult(nil, src, adc.SearchResult{Token: tok, Path: "/a"})
+	}
+
+	var got []adc.CID
+	for i := 0; i < 2; i++ {
+		r := <-s.out
+		got = append(got, r.Peer.Info().Id)
+	}
+	require.Equal(t, []adc.CID{{1}, {2}}, got)
+	for i := 0; i < 2; i++ {
+		r := <-s.out
+		require.Nil(t, r.Peer)
+	}
+	select {
+	case r := <-s.out:
+		t.Fatal("unexpected result:", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	_, ok := <-s.out
+	require.False(t, ok)
+}
+
+func TestSearchQueueLimit(t *testing.T) {
+	s := &activeSearch{
+		ctx:    context.Background(),
+		out:    make(chan SearchResult),
+		notify: make(chan struct{}, 1),
+		seen:   make(map[searchKey]struct{}),
+	}
+	for i := 0; i < maxSearchQueue+10; i++ {
+		s.push("AAAB", SearchResult{Path: "/" + strconv.Itoa(i)})
+	}
+	require.Len(t, s.queue, maxSearchQueue)
+}
+
+func TestSearchUDP(t *testing.T) {
+	srv, err := adc.ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer srv.Close()
+	go srv.Serve()
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	infc := make(chan string, 1)
+	go func() {
+		// fake hub: run the handshake and echo our INF back
+		r := bufio.NewReader(c2)
+		if _, err := r.ReadString('\n'); err != nil {
+			return
+		}
+		_, _ = io.WriteString(c2, "ISUP ADBASE ADTIGR\nISID AAAB\n")
+		inf, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		infc <- inf
+		_, _ = io.WriteString(c2, "IINF NIhub\n"+inf)
+		_, _ = io.Copy(ioutil.Discard, r)
+	}()
+
+	conn, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	c, err := HubHandshake(conn, &Config{PID: types.NewPID(), Name: "test", UDP: srv})
+	require.NoError(t, err)
+	defer c.Close()
+
+	port := srv.Addr().(*net.UDPAddr).Port
+	inf := <-infc
+	require.Contains(t, inf, " U4"+strconv.Itoa(port))
+	require.Contains(t, inf, "UDP4")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s := &activeSearch{
+		ctx:    ctx,
+		out:    make(chan SearchResult),
+		notify: make(chan struct{}, 1),
+		seen:   make(map[searchKey]struct{}),
+	}
+	tok := c.addSearch(s)
+	go s.run(func() { c.removeSearch(tok) })
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.WriteTo([]byte("URES "+adc.CID{1}.String()+" TO"+tok+" FN/a SI1\n"), srv.Addr())
+	require.NoError(t, err)
+
+	select {
+	case r := <-s.out:
+		require.Equal(t, "/a", r.Path)
+	case <-ctx.Done():
+		t.Fatal("no search result")
+	}
+
+	// the handler is removed with the connection
+	require.NoError(t, c.Close())
+	_, err = pc.WriteTo([]byte("URES "+adc.CID{1}.String()+" TO"+tok+" FN/b SI1\n"), srv.Addr())
+	require.NoError(t, err)
+	for deadline := time.Now().Add(time.Second); srv.Stats().Unhandled == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the result is still handled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+// searchIndex is an inverted index of file and directory names in the share.
+//
+// Entries are stored in depth-first order, so each directory and its contents
+// occupy a continuous range of entry IDs. A search term that matches a directory
+// name matches all its contents, since search terms are matched against full paths.
+type searchIndex struct {
+	entries []indexEntry
+	terms   map[string][]int32 // name token -> entry IDs
+	tokens  []string           // sorted keys of terms
+}
+
+type indexEntry struct {
+	path string // full path in the share; directories end with a slash
+	name string
+	dir  *filelist.Dir
+	file *filelist.File
+	end  int32 // the end of the directory range, exclusive
+}
+
+// tokenize splits a string into lowercase alphanumeric tokens.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// newSearchIndex builds an index for top-level shared directories.
+// The index references directories, so they must not be modified while it's in use.
+func newSearchIndex(dirs []filelist.Dir) *searchIndex {
+	idx := &searchIndex{terms: make(map[string][]int32)}
+	for i := range dirs {
+		d := &dirs[i]
+		idx.addDir("/"+d.Name+"/", d)
+	}
+	idx.tokens = make([]string, 0, len(idx.terms))
+	for t := range idx.terms {
+		idx.tokens = append(idx.tokens, t)
+	}
+	sort.Strings(idx.tokens)
+	return idx
+}
+
+func (idx *searchIndex) addDir(fpath string, d *filelist.Dir) {
+	id := idx.add(indexEntry{path: fpath, name: d.Name, dir: d})
+	for i := range d.Dirs {
+		sub := &d.Dirs[i]
+		idx.addDir(fpath+sub.Name+"/", sub)
+	}
+	for i := range d.Files {
+		f := &d.Files[i]
+		idx.add(indexEntry{path: fpath + f.Name, name: f.Name, file: f})
+	}
+	idx.entries[id].end = int32(len(idx.entries))
+}
+
+func (idx *searchIndex) add(e indexEntry) int32 {
+	id := int32(len(idx.entries))
+	e.end = id + 1
+	idx.entries = append(idx.entries, e)
+	seen := make(map[string]struct{})
+	for _, t := range tokenize(e.name) {
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		idx.terms[t] = append(idx.terms[t], id)
+	}
+	return id
+}
+
+// bitset is a set of entry IDs.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (s bitset) setRange(from, to int32) {
+	for i := from; i < to; {
+		if i%64 == 0 && to-i >= 64 {
+			s[i/64] = ^uint64(0)
+			i += 64
+			continue
+		}
+		s[i/64] |= 1 << uint(i%64)
+		i++
+	}
+}
+
+func (s bitset) and(o bitset) {
+	for i := range s {
+		s[i] &= o[i]
+	}
+}
+
+func (s bitset) has(i int32) bool {
+	return s[i/64]&(1<<uint(i%64)) != 0
+}
+
+// lookup returns entries that contain the token as a part of their path.
+func (idx *searchIndex) lookup(tok string) bitset {
+	s := newBitset(len(idx.entries))
+	for _, t := range idx.tokens {
+		if !strings.Contains(t, tok) {
+			continue
+		}
+		for _, id := range idx.terms[t] {
+			s.setRange(id, idx.entries[id].end)
+		}
+	}
+	return s
+}
+
+// candidates returns entries that may match all search terms. Each term is split into tokens,
+// and each token must be a substring of one of the path tokens of the entry. It returns nil
+// if there are no tokens in the search terms.
+func (idx *searchIndex) candidates(terms []string) bitset {
+	var set bitset
+	for _, term := range terms {
+		for _, tok := range tokenize(term) {
+			s := idx.lookup(tok)
+			if set == nil {
+				set = s
+			} else {
+				set.and(s)
+			}
+		}
+	}
+	return set
+}
+
+// search returns at most limit results that match the request, ordered by relevance.
+func (idx *searchIndex) search(req adc.SearchRequest, limit int) []adc.SearchResult {
+	set := idx.candidates(req.And)
+	if set == nil {
+		set = newBitset(len(idx.entries))
+		set.setRange(0, int32(len(idx.entries)))
+	}
+	type scored struct {
+		e     *indexEntry
+		score int
+	}
+	var found []scored
+	for id := range idx.entries {
+		if !set.has(int32(id)) {
+			continue
+		}
+		e := &idx.entries[id]
+		if !matchSearch(req, e.path, e.file) {
+			continue
+		}
+		found = append(found, scored{e: e, score: relevance(req.And, e.name)})
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return len(a.e.path) < len(b.e.path)
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	out := make([]adc.SearchResult, 0, len(found))
+	for _, s := range found {
+		if s.e.dir != nil {
+			out = append(out, dirResult(s.e.path, s.e.dir))
+			continue
+		}
+		f := s.e.file
+		tth := f.TTH
+		out = append(out, adc.SearchResult{Path: s.e.path, Size: f.Size, TTH: &tth, Date: f.Date})
+	}
+	return out
+}
+
+// relevance scores a name against search terms. Terms found in the name itself
+// score higher than terms found in parent directories, and whole words score
+// higher than substrings.
+func relevance(terms []string, name string) int {
+	name = strings.ToLower(name)
+	var words map[string]struct{}
+	score := 0
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		if !strings.Contains(name, term) {
+			continue
+		}
+		score += 2
+		if words == nil {
+			words = make(map[string]struct{})
+			for _, w := range tokenize(name) {
+				words[w] = struct{}{}
+			}
+		}
+		if _, ok := words[term]; ok || name == term {
+			score++
+		}
+	}
+	return score
+}
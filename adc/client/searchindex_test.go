@@ -0,0 +1,90 @@
+package client
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+func TestSearchIndex(t *testing.T) {
+	dirs := []filelist.Dir{{
+		Name: "music",
+		Dirs: []filelist.Dir{{
+			Name: "Rock Hits",
+			Files: []filelist.File{
+				{Name: "01 - Some Song.mp3", Size: 100, TTH: adc.TTH{1}},
+				{Name: "rock.mp3", Size: 200, TTH: adc.TTH{2}},
+			},
+		}},
+		Files: []filelist.File{
+			{Name: "rockabilly.flac", Size: 300, TTH: adc.TTH{3}},
+			{Name: "jazz.mp3", Size: 400, TTH: adc.TTH{4}},
+		},
+	}}
+	idx := newSearchIndex(dirs)
+
+	paths := func(res []adc.SearchResult) []string {
+		var out []string
+		for _, r := range res {
+			out = append(out, r.Path)
+		}
+		return out
+	}
+
+	// whole words in the name rank first, then substrings, then matches in parent directories
+	res := idx.search(adc.SearchRequest{And: []string{"rock"}, Type: adc.FileTypeFile}, 10)
+	require.Equal(t, []string{
+		"/music/Rock Hits/rock.mp3",
+		"/music/rockabilly.flac",
+		"/music/Rock Hits/01 - Some Song.mp3",
+	}, paths(res))
+
+	// terms may span multiple words and match in the middle of words
+	res = idx.search(adc.SearchRequest{And: []string{"ome song.mp"}}, 10)
+	require.Equal(t, []string{"/music/Rock Hits/01 - Some Song.mp3"}, paths(res))
+
+	// filters are applied to candidates
+	res = idx.search(adc.SearchRequest{And: []string{"music"}, Ext: []string{"mp3"}, Ge: 150}, 10)
+	require.Equal(t, []string{"/music/jazz.mp3", "/music/Rock Hits/rock.mp3"}, paths(res))
+	res = idx.search(adc.SearchRequest{And: []string{"music"}, Not: []string{"rock"}, Type: adc.FileTypeFile}, 10)
+	require.Equal(t, []string{"/music/jazz.mp3"}, paths(res))
+
+	res = idx.search(adc.SearchRequest{And: []string{"rock"}, Type: adc.FileTypeDir}, 10)
+	require.Equal(t, []string{"/music/Rock Hits/"}, paths(res))
+	require.Equal(t, 2, res[0].Files)
+
+	// results are limited
+	res = idx.search(adc.SearchRequest{And: []string{"mp3"}}, 2)
+	require.Len(t, res, 2)
+
+	res = idx.search(adc.SearchRequest{And: []string{"blues"}}, 10)
+	require.Len(t, res, 0)
+}
+
+func BenchmarkShareSearch(b *testing.B) {
+	const n = 100000
+	d := filelist.Dir{Name: "share"}
+	for i := 0; i < n/100; i++ {
+		sub := filelist.Dir{Name: "album " + strconv.Itoa(i)}
+		for j := 0; j < 100; j++ {
+			sub.Files = append(sub.Files, filelist.File{
+				Name: "track " + strconv.Itoa(i*100+j) + ".mp3",
+				Size: int64(j), TTH: adc.TTH{byte(i), byte(j)},
+			})
+		}
+		d.Dirs = append(d.Dirs, sub)
+	}
+	p := NewShareProfile("bench")
+	p.SetDir(d)
+	req := adc.SearchRequest{And: []string{"track", "4242"}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if res := p.Search(req); len(res) == 0 {
+			b.Fatal("no results")
+		}
+	}
+}
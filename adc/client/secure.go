@@ -0,0 +1,121 @@
+package client
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// GenerateCertificate generates a self-signed certificate for secure client-client connections.
+//
+// Peers don't validate the certificate chain; instead, the certificate is verified
+// by a keyprint advertised in the KP field of user's INF.
+func GenerateCertificate() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"go-dcpp"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// Secure checks if the client supports secure client-client connections.
+func (c *Conn) Secure() bool {
+	return c.cert != nil
+}
+
+// secure checks if the connection to the peer should use TLS.
+func (p *Peer) secure() bool {
+	return p.hub.Secure() && p.Info().Features.Has(adc.FeaADC0)
+}
+
+// proto returns a preferred client-client protocol for the peer.
+func (p *Peer) proto() string {
+	if p.secure() {
+		return adc.ProtoADCS
+	}
+	return adc.ProtoADC
+}
+
+// verifyCert checks the peer certificate against the keyprint from peer's INF.
+//
+// Peers that don't advertise a keyprint are accepted, since the connection is still encrypted.
+func (p *Peer) verifyCert(certs [][]byte) error {
+	if len(certs) == 0 {
+		return errors.New("peer sent no certificate")
+	}
+	kp := p.Info().KP
+	if kp == "" {
+		return nil
+	}
+	return adc.VerifyKeyprint(kp, certs[0])
+}
+
+// clientTLS returns a TLS config for dialing the peer.
+func (p *Peer) clientTLS() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{*p.hub.cert},
+		// certificates are self-signed; they are verified by the keyprint instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			return p.verifyCert(raw)
+		},
+	}
+}
+
+// serverTLS returns a TLS config for accepting peer connections.
+// The peer certificate is verified after the peer identifies itself.
+func (c *Conn) serverTLS() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{*c.cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+}
+
+// isTLS peeks the first byte of the connection to check if the peer starts a TLS handshake.
+func isTLS(conn net.Conn, deadline time.Time) (net.Conn, bool, error) {
+	br := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(deadline)
+	b, err := br.Peek(1)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, false, err
+	}
+	return &peekedConn{Conn: conn, r: br}, b[0] == 0x16, nil
+}
+
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,486 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const (
+	// DefaultUploadSlots is the default number of upload slots.
+	DefaultUploadSlots = 3
+	// DefaultMiniSlots is the default number of mini-slots for file lists and small files.
+	DefaultMiniSlots = 3
+	// DefaultMiniSlotSize is the default maximal size of a file that can use a mini-slot.
+	DefaultMiniSlotSize = 64 * 1024
+	// DefaultQueueTimeout is the time a peer stays in the upload queue without retrying.
+	DefaultQueueTimeout = 5 * time.Minute
+)
+
+// ErrNoSlots is returned when no upload slots are available.
+var ErrNoSlots = errors.New("no free slots")
+
+// QueuedError is returned when no upload slots are available and the peer was put into the upload queue.
+type QueuedError struct {
+	Pos int // position in the queue, starting at 1
+}
+
+func (e *QueuedError) Error() string {
+	return fmt.Sprintf("no free slots, queued at position %d", e.Pos)
+}
+
+// Status returns the status that should be sent to the peer.
+func (e *QueuedError) Status() adc.Status {
+	return adc.ErrQueued(e.Pos).Status
+}
+
+// SlotKind is a kind of a transfer slot.
+type SlotKind int
+
+const (
+	SlotNormal  = SlotKind(iota) // a regular upload or download slot
+	SlotMini                     // a mini-slot for file lists and small files
+	SlotGranted                  // an extra slot granted to a specific user
+)
+
+// TransferConfig sets limits for client transfers.
+//
+// Zero slot numbers mean defaults, zero rates mean no limit.
+type TransferConfig struct {
+	UploadSlots   int
+	DownloadSlots int // zero means no limit
+
+	// MiniSlots are used for file lists and files smaller or equal to MiniSlotSize,
+	// when all normal slots are taken.
+	MiniSlots    int
+	MiniSlotSize int64
+
+	// QueueTimeout removes peers from the upload queue if they don't retry within this time.
+	// Zero value means DefaultQueueTimeout.
+	QueueTimeout time.Duration
+
+	// UploadRate and DownloadRate are global limits in bytes per second.
+	UploadRate   int64
+	DownloadRate int64
+
+	// PeerUploadRate and PeerDownloadRate limit each peer in bytes per second.
+	PeerUploadRate   int64
+	PeerDownloadRate int64
+}
+
+// UploadRequest describes an upload that requires a slot.
+type UploadRequest struct {
+	Peer     adc.CID
+	FileList bool
+	Size     int64
+}
+
+// Slots manages upload and download slots and bandwidth limits for transfers.
+type Slots struct {
+	conf TransferConfig
+
+	up, down *Limiter
+
+	mu       sync.Mutex
+	upUsed   int
+	miniUsed int
+	downUsed int
+	downWait chan struct{} // closed and replaced when a download slot is released
+	upChange chan struct{} // closed and replaced when the number of free upload slots changes
+	granted  map[adc.CID]time.Time
+	peers    map[adc.CID]*peerLimits
+	queue    []QueuedUpload
+	onFree   func(next adc.CID)
+}
+
+// QueuedUpload is a peer waiting for an upload slot.
+type QueuedUpload struct {
+	Peer  adc.CID
+	Since time.Time // when the peer was queued
+	Last  time.Time // the last request from the peer
+}
+
+type peerLimits struct {
+	refs     int
+	up, down *Limiter
+}
+
+// NewSlots creates a slot manager with a given config.
+func NewSlots(conf TransferConfig) *Slots {
+	if conf.UploadSlots <= 0 {
+		conf.UploadSlots = DefaultUploadSlots
+	}
+	if conf.MiniSlots <= 0 {
+		conf.MiniSlots = DefaultMiniSlots
+	}
+	if conf.MiniSlotSize <= 0 {
+		conf.MiniSlotSize = DefaultMiniSlotSize
+	}
+	if conf.QueueTimeout <= 0 {
+		conf.QueueTimeout = DefaultQueueTimeout
+	}
+	return &Slots{
+		conf:     conf,
+		up:       NewLimiter(conf.UploadRate),
+		down:     NewLimiter(conf.DownloadRate),
+		downWait: make(chan struct{}),
+		upChange: make(chan struct{}),
+		granted:  make(map[adc.CID]time.Time),
+		peers:    make(map[adc.CID]*peerLimits),
+	}
+}
+
+// SetUploadRate changes the global upload rate limit.
+func (s *Slots) SetUploadRate(rate int64) { s.up.SetRate(rate) }
+
+// SetDownloadRate changes the global download rate limit.
+func (s *Slots) SetDownloadRate(rate int64) { s.down.SetRate(rate) }
+
+// FreeUploadSlots returns the number of free normal upload slots.
+// It should be advertised as FS field in user's INF.
+func (s *Slots) FreeUploadSlots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.conf.UploadSlots - s.upUsed
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// UploadSlots returns the total number of normal upload slots.
+func (s *Slots) UploadSlots() int {
+	return s.conf.UploadSlots
+}
+
+// Changed returns a channel that is closed when the number of free upload slots changes.
+func (s *Slots) Changed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.upChange
+}
+
+func (s *Slots) upChanged() {
+	close(s.upChange)
+	s.upChange = make(chan struct{})
+}
+
+// Grant gives an extra upload slot to the user for a given duration.
+// Zero duration grants the slot until it's revoked.
+func (s *Slots) Grant(cid adc.CID, dt time.Duration) {
+	var until time.Time
+	if dt > 0 {
+		until = time.Now().Add(dt)
+	}
+	s.mu.Lock()
+	s.granted[cid] = until
+	s.mu.Unlock()
+}
+
+// Revoke removes an extra slot granted to the user. Active transfers are not affected.
+func (s *Slots) Revoke(cid adc.CID) {
+	s.mu.Lock()
+	delete(s.granted, cid)
+	s.mu.Unlock()
+}
+
+// IsGranted checks if the user has an extra slot.
+func (s *Slots) IsGranted(cid adc.CID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isGranted(cid, time.Now())
+}
+
+func (s *Slots) isGranted(cid adc.CID, now time.Time) bool {
+	until, ok := s.granted[cid]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && now.After(until) {
+		delete(s.granted, cid)
+		return false
+	}
+	return true
+}
+
+func (s *Slots) peerLimits(cid adc.CID) *peerLimits {
+	p := s.peers[cid]
+	if p == nil {
+		p = &peerLimits{
+			up:   NewLimiter(s.conf.PeerUploadRate),
+			down: NewLimiter(s.conf.PeerDownloadRate),
+		}
+		s.peers[cid] = p
+	}
+	p.refs++
+	return p
+}
+
+func (s *Slots) releasePeer(cid adc.CID) {
+	if p := s.peers[cid]; p != nil {
+		p.refs--
+		if p.refs <= 0 {
+			delete(s.peers, cid)
+		}
+	}
+}
+
+// AcquireUpload takes an upload slot for a given request.
+//
+// Normal slots are used first, then mini-slots for file lists and small files,
+// and finally the slots granted to the user. ErrNoSlots is returned if none are available.
+func (s *Slots) AcquireUpload(req UploadRequest) (*Slot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sl := s.acquireUpload(req, true, time.Now())
+	if sl == nil {
+		return nil, ErrNoSlots
+	}
+	return sl, nil
+}
+
+// QueueUpload is similar to AcquireUpload, but puts the peer into the upload queue
+// if no slots are available. In this case QueuedError with the position is returned
+// and the peer is expected to retry the request later.
+//
+// Normal slots are given to queued peers in order. Mini-slots and granted slots
+// don't depend on the queue.
+func (s *Slots) QueueUpload(req UploadRequest) (*Slot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.pruneQueue(now)
+	i := s.queueIndex(req.Peer)
+	first := i == 0 || (i < 0 && len(s.queue) == 0)
+	if sl := s.acquireUpload(req, first, now); sl != nil {
+		// mini-slots don't count, the peer may still wait for a larger file
+		if i >= 0 && sl.kind != SlotMini {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		}
+		return sl, nil
+	}
+	if i < 0 {
+		s.queue = append(s.queue, QueuedUpload{Peer: req.Peer, Since: now})
+		i = len(s.queue) - 1
+	}
+	s.queue[i].Last = now
+	return nil, &QueuedError{Pos: i + 1}
+}
+
+// pruneQueue removes peers that didn't retry within the queue timeout.
+func (s *Slots) pruneQueue(now time.Time) {
+	queue := s.queue[:0]
+	for _, q := range s.queue {
+		if now.Sub(q.Last) <= s.conf.QueueTimeout {
+			queue = append(queue, q)
+		}
+	}
+	s.queue = queue
+}
+
+// queueIndex returns the index of the peer in the upload queue, or -1 if it's not queued.
+func (s *Slots) queueIndex(cid adc.CID) int {
+	for i, q := range s.queue {
+		if q.Peer == cid {
+			return i
+		}
+	}
+	return -1
+}
+
+// UploadQueue returns the peers waiting for an upload slot, in order.
+func (s *Slots) UploadQueue() []QueuedUpload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneQueue(time.Now())
+	return append([]QueuedUpload(nil), s.queue...)
+}
+
+// Dequeue removes the peer from the upload queue, for example when it goes offline.
+func (s *Slots) Dequeue(cid adc.CID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.queueIndex(cid); i >= 0 {
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	}
+}
+
+// OnSlotFree sets a function that is called when an upload slot is released while peers
+// are waiting in the queue. The function receives the first peer in the queue, which
+// can be notified to retry its request.
+func (s *Slots) OnSlotFree(fnc func(next adc.CID)) {
+	s.mu.Lock()
+	s.onFree = fnc
+	s.mu.Unlock()
+}
+
+// acquireUpload takes an upload slot or returns nil if none are available.
+// If normal is false, only mini-slots and granted slots are used.
+func (s *Slots) acquireUpload(req UploadRequest, normal bool, now time.Time) *Slot {
+	var kind SlotKind
+	switch {
+	case normal && s.upUsed < s.conf.UploadSlots:
+		kind = SlotNormal
+		s.upUsed++
+		s.upChanged()
+	case (req.FileList || req.Size <= s.conf.MiniSlotSize) && s.miniUsed < s.conf.MiniSlots:
+		kind = SlotMini
+		s.miniUsed++
+	case s.isGranted(req.Peer, now):
+		kind = SlotGranted
+	default:
+		return nil
+	}
+	p := s.peerLimits(req.Peer)
+	return &Slot{
+		s: s, kind: kind, peer: req.Peer, upload: true,
+		ls: limits{s.up, p.up},
+	}
+}
+
+// AcquireDownload waits for a free download slot.
+func (s *Slots) AcquireDownload(ctx context.Context, cid adc.CID) (*Slot, error) {
+	for {
+		s.mu.Lock()
+		if s.conf.DownloadSlots <= 0 || s.downUsed < s.conf.DownloadSlots {
+			s.downUsed++
+			p := s.peerLimits(cid)
+			s.mu.Unlock()
+			return &Slot{
+				s: s, kind: SlotNormal, peer: cid,
+				ls: limits{s.down, p.down},
+			}, nil
+		}
+		wait := s.downWait
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// Slot is an upload or download slot taken by a transfer.
+type Slot struct {
+	s      *Slots
+	kind   SlotKind
+	peer   adc.CID
+	upload bool
+	ls     limits
+
+	once sync.Once
+}
+
+// Kind returns the kind of the slot.
+func (s *Slot) Kind() SlotKind { return s.kind }
+
+// Reader wraps a reader to apply global and per-peer rate limits.
+func (s *Slot) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return LimitReader(ctx, r, s.ls...)
+}
+
+// Writer wraps a writer to apply global and per-peer rate limits.
+func (s *Slot) Writer(ctx context.Context, w io.Writer) io.Writer {
+	return LimitWriter(ctx, w, s.ls...)
+}
+
+// Release frees the slot. It's safe to call it multiple times.
+func (s *Slot) Release() {
+	s.once.Do(func() {
+		m := s.s
+		m.mu.Lock()
+		m.releasePeer(s.peer)
+		if !s.upload {
+			m.downUsed--
+			close(m.downWait)
+			m.downWait = make(chan struct{})
+			m.mu.Unlock()
+			return
+		}
+		switch s.kind {
+		case SlotNormal:
+			m.upUsed--
+			m.upChanged()
+		case SlotMini:
+			m.miniUsed--
+		}
+		var (
+			next   adc.CID
+			notify func(adc.CID)
+		)
+		if s.kind != SlotGranted && m.onFree != nil {
+			m.pruneQueue(time.Now())
+			if len(m.queue) != 0 {
+				next, notify = m.queue[0].Peer, m.onFree
+			}
+		}
+		m.mu.Unlock()
+		if notify != nil {
+			notify(next)
+		}
+	})
+}
+
+// SetSlots sets upload slots advertised to peers. The number of free slots is sent to the hub (FS)
+// and included in search results and file info responses. The hub is updated each time
+// an upload starts or finishes.
+func (c *Conn) SetSlots(s *Slots) {
+	c.slots.Lock()
+	if c.slots.stop != nil {
+		close(c.slots.stop)
+		c.slots.stop = nil
+	}
+	c.slots.s = s
+	var stop chan struct{}
+	if s != nil {
+		stop = make(chan struct{})
+		c.slots.stop = stop
+	}
+	c.slots.Unlock()
+	if s != nil {
+		go c.advertiseSlots(s, stop)
+	}
+}
+
+// freeSlots returns the number of free upload slots advertised to peers.
+func (c *Conn) freeSlots() int {
+	c.slots.RLock()
+	s := c.slots.s
+	c.slots.RUnlock()
+	if s == nil {
+		return 0
+	}
+	return s.FreeUploadSlots()
+}
+
+// advertiseSlots sends the number of upload slots to the hub each time it changes.
+func (c *Conn) advertiseSlots(s *Slots, stop <-chan struct{}) {
+	for {
+		changed := s.Changed()
+		err := c.write(context.Background(), func(w *adc.Conn) error {
+			return w.WriteBroadcast(c.SID(), adc.UserMod{
+				adc.Tag{'S', 'L'}: strconv.Itoa(s.UploadSlots()),
+				adc.Tag{'F', 'S'}: strconv.Itoa(s.FreeUploadSlots()),
+			})
+		})
+		if err != nil {
+			log.Println("failed to update slots:", err)
+			return
+		}
+		select {
+		case <-changed:
+		case <-stop:
+			return
+		case <-c.closing:
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestSlotsUpload(t *testing.T) {
+	s := NewSlots(TransferConfig{UploadSlots: 1, MiniSlots: 1, MiniSlotSize: 100})
+	bob, alice := adc.CID{1}, adc.CID{2}
+
+	s1, err := s.AcquireUpload(UploadRequest{Peer: bob, Size: 1000})
+	require.NoError(t, err)
+	require.Equal(t, SlotNormal, s1.Kind())
+	require.Equal(t, 0, s.FreeUploadSlots())
+
+	_, err = s.AcquireUpload(UploadRequest{Peer: alice, Size: 1000})
+	require.Equal(t, ErrNoSlots, err)
+
+	s2, err := s.AcquireUpload(UploadRequest{Peer: alice, FileList: true, Size: 1000})
+	require.NoError(t, err)
+	require.Equal(t, SlotMini, s2.Kind())
+
+	_, err = s.AcquireUpload(UploadRequest{Peer: alice, Size: 10})
+	require.Equal(t, ErrNoSlots, err)
+
+	s.Grant(alice, 0)
+	s3, err := s.AcquireUpload(UploadRequest{Peer: alice, Size: 1000})
+	require.NoError(t, err)
+	require.Equal(t, SlotGranted, s3.Kind())
+	s.Revoke(alice)
+	require.False(t, s.IsGranted(alice))
+
+	s.Grant(bob, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	require.False(t, s.IsGranted(bob))
+
+	s1.Release()
+	s1.Release()
+	require.Equal(t, 1, s.FreeUploadSlots())
+	s2.Release()
+	s3.Release()
+	require.Empty(t, s.peers)
+}
+
+func TestSlotsQueue(t *testing.T) {
+	s := NewSlots(TransferConfig{UploadSlots: 1, MiniSlotSize: 100})
+	bob, alice, carol := adc.CID{1}, adc.CID{2}, adc.CID{3}
+	var freed []adc.CID
+	s.OnSlotFree(func(next adc.CID) {
+		freed = append(freed, next)
+	})
+
+	s1, err := s.QueueUpload(UploadRequest{Peer: bob, Size: 1000})
+	require.NoError(t, err)
+
+	_, err = s.QueueUpload(UploadRequest{Peer: alice, Size: 1000})
+	require.Equal(t, &QueuedError{Pos: 1}, err)
+	_, err = s.QueueUpload(UploadRequest{Peer: carol, Size: 1000})
+	require.Equal(t, &QueuedError{Pos: 2}, err)
+	require.Equal(t, 2, adc.QueuePos(err.(*QueuedError).Status().Err()))
+
+	// small files don't wait in the queue
+	s2, err := s.QueueUpload(UploadRequest{Peer: carol, Size: 10})
+	require.NoError(t, err)
+	require.Equal(t, SlotMini, s2.Kind())
+	s2.Release()
+	require.Equal(t, []adc.CID{alice}, freed)
+
+	q := s.UploadQueue()
+	require.Len(t, q, 2)
+	require.Equal(t, alice, q[0].Peer)
+
+	s1.Release()
+	require.Equal(t, []adc.CID{alice, alice}, freed)
+	// the free slot is reserved for the first peer in the queue
+	_, err = s.QueueUpload(UploadRequest{Peer: carol, Size: 1000})
+	require.Equal(t, &QueuedError{Pos: 2}, err)
+	s3, err := s.QueueUpload(UploadRequest{Peer: alice, Size: 1000})
+	require.NoError(t, err)
+	require.Equal(t, SlotNormal, s3.Kind())
+	require.Len(t, s.UploadQueue(), 1)
+
+	s.Dequeue(carol)
+	require.Empty(t, s.UploadQueue())
+	s3.Release()
+	require.Len(t, freed, 2)
+}
+
+func TestAdvertiseSlots(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	hub, err := adc.NewConn(c2)
+	require.NoError(t, err)
+	c := &Conn{conn: conn, sid: adc.SID{'A', 'A', 'A', 'B'}, closing: make(chan struct{})}
+
+	expect := func(free string) {
+		p, err := hub.ReadPacket(time.Now().Add(5 * time.Second))
+		require.NoError(t, err)
+		b, ok := p.(*adc.BroadcastPacket)
+		require.True(t, ok, "%T", p)
+		var u adc.UserMod
+		require.NoError(t, adc.Unmarshal(b.Data, &u))
+		require.Equal(t, "2", u[adc.Tag{'S', 'L'}])
+		require.Equal(t, free, u[adc.Tag{'F', 'S'}])
+	}
+
+	s := NewSlots(TransferConfig{UploadSlots: 2})
+	c.SetSlots(s)
+	expect("2")
+	require.Equal(t, 2, c.freeSlots())
+
+	s1, err := s.AcquireUpload(UploadRequest{Peer: adc.CID{1}, Size: 1 << 20})
+	require.NoError(t, err)
+	expect("1")
+	s1.Release()
+	expect("2")
+
+	c.SetSlots(nil)
+	require.Equal(t, 0, c.freeSlots())
+}
+
+func TestSlotsDownload(t *testing.T) {
+	s := NewSlots(TransferConfig{DownloadSlots: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	s1, err := s.AcquireDownload(ctx, adc.CID{1})
+	require.NoError(t, err)
+
+	got := make(chan *Slot)
+	go func() {
+		s2, err := s.AcquireDownload(ctx, adc.CID{2})
+		if err != nil {
+			close(got)
+			return
+		}
+		got <- s2
+	}()
+	select {
+	case <-got:
+		t.Fatal("slot should be busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+	s1.Release()
+	s2 := <-got
+	require.NotNil(t, s2)
+	s2.Release()
+
+	ctx2, cancel2 := context.WithCancel(ctx)
+	s3, err := s.AcquireDownload(ctx2, adc.CID{1})
+	require.NoError(t, err)
+	cancel2()
+	_, err = s.AcquireDownload(ctx2, adc.CID{1})
+	require.Equal(t, context.Canceled, err)
+	s3.Release()
+}
+
+func TestLimiter(t *testing.T) {
+	const rate = 64 * 1024
+	l := NewLimiter(rate)
+	data := make([]byte, 2*rate)
+
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, LimitReader(context.Background(), bytes.NewReader(data), l, nil))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	// the first second is covered by the burst
+	dt := time.Since(start)
+	require.True(t, dt >= 900*time.Millisecond, "%v", dt)
+	require.True(t, dt < 3*time.Second, "%v", dt)
+
+	// no limits
+	buf := bytes.NewBuffer(nil)
+	_, err = LimitWriter(context.Background(), buf, NewLimiter(0)).Write(data)
+	require.NoError(t, err)
+	require.Equal(t, len(data), buf.Len())
+}
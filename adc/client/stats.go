@@ -0,0 +1,253 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// Direction of a transfer.
+type Direction int
+
+const (
+	Download = Direction(iota)
+	Upload
+)
+
+// DirStats is a set of counters for one transfer direction.
+type DirStats struct {
+	Bytes     int64         `json:"bytes"`
+	Time      time.Duration `json:"time"`
+	Transfers int           `json:"transfers"`
+	Failures  int           `json:"failures"`
+}
+
+// Speed returns an average speed in bytes per second.
+func (s DirStats) Speed() int64 {
+	if s.Time <= 0 {
+		return 0
+	}
+	return int64(float64(s.Bytes) / s.Time.Seconds())
+}
+
+func (s *DirStats) add(bytes int64, dt time.Duration, failed bool) {
+	s.Bytes += bytes
+	s.Time += dt
+	s.Transfers++
+	if failed {
+		s.Failures++
+	}
+}
+
+// PeerStats is a history of transfers with a single peer.
+type PeerStats struct {
+	CID      adc.CID   `json:"cid"`
+	Name     string    `json:"name,omitempty"`
+	Up       DirStats  `json:"up"`
+	Down     DirStats  `json:"down"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Ratio returns a ratio of uploaded to downloaded bytes.
+// It returns zero if nothing was downloaded.
+func (s PeerStats) Ratio() float64 {
+	if s.Down.Bytes == 0 {
+		return 0
+	}
+	return float64(s.Up.Bytes) / float64(s.Down.Bytes)
+}
+
+// Stats tracks transfer statistics for all peers.
+type Stats struct {
+	mu    sync.RWMutex
+	total PeerStats
+	peers map[adc.CID]*PeerStats
+}
+
+// NewStats creates an empty statistics registry.
+func NewStats() *Stats {
+	return &Stats{peers: make(map[adc.CID]*PeerStats)}
+}
+
+// Total returns statistics for all peers combined.
+func (s *Stats) Total() PeerStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.total
+}
+
+// Peer returns statistics for a given peer.
+func (s *Stats) Peer(cid adc.CID) (PeerStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.peers[cid]
+	if !ok {
+		return PeerStats{}, false
+	}
+	return *p, true
+}
+
+// Peers returns statistics for all known peers, most recently seen first.
+func (s *Stats) Peers() []PeerStats {
+	s.mu.RLock()
+	out := make([]PeerStats, 0, len(s.peers))
+	for _, p := range s.peers {
+		out = append(out, *p)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out
+}
+
+// Seen updates the name and the last seen time of the peer.
+func (s *Stats) Seen(cid adc.CID, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.peer(cid)
+	if name != "" {
+		p.Name = name
+	}
+	p.LastSeen = time.Now().UTC()
+}
+
+func (s *Stats) peer(cid adc.CID) *PeerStats {
+	p := s.peers[cid]
+	if p == nil {
+		p = &PeerStats{CID: cid}
+		s.peers[cid] = p
+	}
+	return p
+}
+
+func (s *Stats) record(cid adc.CID, dir Direction, bytes int64, dt time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.peer(cid)
+	p.LastSeen = time.Now().UTC()
+	if dir == Upload {
+		p.Up.add(bytes, dt, failed)
+		s.total.Up.add(bytes, dt, failed)
+	} else {
+		p.Down.add(bytes, dt, failed)
+		s.total.Down.add(bytes, dt, failed)
+	}
+}
+
+// Start begins tracking a new transfer with a peer.
+func (s *Stats) Start(cid adc.CID, dir Direction) *Transfer {
+	return &Transfer{s: s, cid: cid, dir: dir, start: time.Now()}
+}
+
+type statsFile struct {
+	Total PeerStats   `json:"total"`
+	Peers []PeerStats `json:"peers"`
+}
+
+// Save writes all statistics in JSON format.
+func (s *Stats) Save(w io.Writer) error {
+	f := statsFile{Total: s.Total(), Peers: s.Peers()}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(f)
+}
+
+// Load reads statistics saved with Save and replaces the current state.
+func (s *Stats) Load(r io.Reader) error {
+	var f statsFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	}
+	peers := make(map[adc.CID]*PeerStats, len(f.Peers))
+	for i := range f.Peers {
+		p := f.Peers[i]
+		peers[p.CID] = &p
+	}
+	s.mu.Lock()
+	s.total = f.Total
+	s.peers = peers
+	s.mu.Unlock()
+	return nil
+}
+
+// Transfer tracks a single transfer.
+type Transfer struct {
+	s     *Stats
+	cid   adc.CID
+	dir   Direction
+	start time.Time
+	bytes int64 // atomic
+	done  uint32
+}
+
+// Peer returns the CID of the peer.
+func (t *Transfer) Peer() adc.CID { return t.cid }
+
+// Direction returns the direction of the transfer.
+func (t *Transfer) Direction() Direction { return t.dir }
+
+// Bytes returns the number of bytes transferred so far.
+func (t *Transfer) Bytes() int64 {
+	return atomic.LoadInt64(&t.bytes)
+}
+
+// Speed returns an average speed of the transfer in bytes per second.
+func (t *Transfer) Speed() int64 {
+	dt := time.Since(t.start)
+	if dt <= 0 {
+		return 0
+	}
+	return int64(float64(t.Bytes()) / dt.Seconds())
+}
+
+// Add records n transferred bytes.
+func (t *Transfer) Add(n int64) {
+	atomic.AddInt64(&t.bytes, n)
+}
+
+// Reader wraps a reader to count transferred bytes.
+func (t *Transfer) Reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, t: t}
+}
+
+// Writer wraps a writer to count transferred bytes.
+func (t *Transfer) Writer(w io.Writer) io.Writer {
+	return &countingWriter{w: w, t: t}
+}
+
+// Done finishes the transfer and records it in peer statistics.
+// A non-nil error marks the transfer as failed. Only the first call has an effect.
+func (t *Transfer) Done(err error) {
+	if !atomic.CompareAndSwapUint32(&t.done, 0, 1) {
+		return
+	}
+	t.s.record(t.cid, t.dir, t.Bytes(), time.Since(t.start), err != nil)
+}
+
+type countingReader struct {
+	r io.Reader
+	t *Transfer
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.Add(int64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	t *Transfer
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.t.Add(int64(n))
+	return n, err
+}
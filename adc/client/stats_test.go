@@ -0,0 +1,60 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestStats(t *testing.T) {
+	s := NewStats()
+	bob, alice := adc.CID{1}, adc.CID{2}
+	s.Seen(bob, "bob")
+
+	tr := s.Start(bob, Download)
+	_, err := io.Copy(ioutil.Discard, tr.Reader(bytes.NewReader(make([]byte, 100))))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), tr.Bytes())
+	tr.Done(nil)
+	tr.Done(errors.New("ignored"))
+
+	tr = s.Start(bob, Upload)
+	_, err = tr.Writer(ioutil.Discard).Write(make([]byte, 50))
+	require.NoError(t, err)
+	tr.Done(nil)
+
+	tr = s.Start(alice, Upload)
+	tr.Add(10)
+	tr.Done(errors.New("failed"))
+
+	p, ok := s.Peer(bob)
+	require.True(t, ok)
+	require.Equal(t, "bob", p.Name)
+	require.Equal(t, int64(100), p.Down.Bytes)
+	require.Equal(t, int64(50), p.Up.Bytes)
+	require.Equal(t, 0.5, p.Ratio())
+	require.Equal(t, 0, p.Up.Failures)
+
+	p, ok = s.Peer(alice)
+	require.True(t, ok)
+	require.Equal(t, 1, p.Up.Failures)
+	require.Equal(t, alice, s.Peers()[0].CID)
+
+	total := s.Total()
+	require.Equal(t, int64(60), total.Up.Bytes)
+	require.Equal(t, 2, total.Up.Transfers)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, s.Save(buf))
+
+	s2 := NewStats()
+	require.NoError(t, s2.Load(buf))
+	require.Equal(t, s.Total(), s2.Total())
+	require.Equal(t, s.Peers(), s2.Peers())
+}
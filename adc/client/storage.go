@@ -0,0 +1,291 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+var (
+	ErrNotSeekable  = errors.New("storage doesn't support random access reads")
+	ErrFileComplete = errors.New("file is already complete")
+)
+
+// Storage creates files for downloads.
+type Storage interface {
+	// Open opens or creates a file for a queued item. Data that was already
+	// written to the file must be preserved.
+	Open(it QueueItem) (StorageFile, error)
+}
+
+// StorageFile is a file that is being downloaded.
+//
+// Segments are written with WriteAt, possibly out of order and concurrently.
+// ReadAt is used to verify written data and may return ErrNotSeekable.
+type StorageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	// Complete is called when all segments are written and verified.
+	// The file is closed after this call.
+	Complete() error
+	// Close closes the file, leaving it incomplete.
+	Close() error
+}
+
+// AllocMode controls how file storage allocates space for new files.
+type AllocMode int
+
+const (
+	// AllocNone grows files as the data is written.
+	AllocNone = AllocMode(iota)
+	// AllocSparse sets the file size in advance without allocating disk space,
+	// if the filesystem supports sparse files.
+	AllocSparse
+	// AllocFull writes zeros to allocate the whole file in advance.
+	AllocFull
+)
+
+// DefaultTempName returns a temporary file name in the target directory.
+func DefaultTempName(target string, tth adc.TTH) string {
+	return target + "." + tth.Base32() + ".dctmp"
+}
+
+// FileStorage writes downloads to temporary files and moves them to the target path on completion.
+type FileStorage struct {
+	// TempDir is a directory for temporary files. If empty, temporary files are created
+	// according to TempName only.
+	TempDir string
+	// TempName returns a name of a temporary file. DefaultTempName is used if not set.
+	TempName func(target string, tth adc.TTH) string
+	// Alloc controls space allocation for new files.
+	Alloc AllocMode
+}
+
+func (s *FileStorage) tempPath(it QueueItem) string {
+	name := DefaultTempName
+	if s.TempName != nil {
+		name = s.TempName
+	}
+	path := name(it.Target, it.TTH)
+	if s.TempDir != "" {
+		path = filepath.Join(s.TempDir, filepath.Base(path))
+	}
+	return path
+}
+
+// Open implements Storage.
+func (s *FileStorage) Open(it QueueItem) (StorageFile, error) {
+	path := s.tempPath(it)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = allocate(f, it.Size, s.Alloc); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &diskFile{File: f, temp: path, target: it.Target}, nil
+}
+
+func allocate(f *os.File, size int64, mode AllocMode) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	} else if st.Size() >= size {
+		return nil
+	}
+	switch mode {
+	case AllocSparse:
+		return f.Truncate(size)
+	case AllocFull:
+		const chunk = 64 * 1024
+		zeros := make([]byte, chunk)
+		for off := st.Size(); off < size; off += chunk {
+			n := int64(chunk)
+			if off+n > size {
+				n = size - off
+			}
+			if _, err = f.WriteAt(zeros[:n], off); err != nil {
+				return err
+			}
+		}
+		return f.Sync()
+	}
+	return nil
+}
+
+type diskFile struct {
+	*os.File
+	temp   string
+	target string
+}
+
+func (f *diskFile) Complete() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(f.temp, f.target)
+}
+
+// MemoryStorage keeps downloads in memory.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[adc.TTH]*memFile
+}
+
+// NewMemoryStorage creates an empty in-memory storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[adc.TTH]*memFile)}
+}
+
+// Open implements Storage.
+func (s *MemoryStorage) Open(it QueueItem) (StorageFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[it.TTH]
+	if f == nil {
+		f = &memFile{data: make([]byte, it.Size)}
+		s.files[it.TTH] = f
+	} else if f.complete {
+		return nil, ErrFileComplete
+	}
+	return f, nil
+}
+
+// Bytes returns the content of a completed file.
+func (s *MemoryStorage) Bytes(tth adc.TTH) ([]byte, bool) {
+	s.mu.RLock()
+	f := s.files[tth]
+	s.mu.RUnlock()
+	if f == nil {
+		return nil, false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.complete {
+		return nil, false
+	}
+	return f.data, true
+}
+
+// Remove removes a file from memory.
+func (s *MemoryStorage) Remove(tth adc.TTH) {
+	s.mu.Lock()
+	delete(s.files, tth)
+	s.mu.Unlock()
+}
+
+type memFile struct {
+	mu       sync.RWMutex
+	data     []byte
+	complete bool
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.complete {
+		return 0, ErrFileComplete
+	} else if off < 0 || off+int64(len(p)) > int64(len(f.data)) {
+		return 0, fmt.Errorf("write out of file bounds: [%d, %d)", off, off+int64(len(p)))
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memFile) Complete() error {
+	f.mu.Lock()
+	f.complete = true
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *memFile) Close() error { return nil }
+
+// WriterStorage streams downloads into writers, for example into another program.
+//
+// Segments that arrive out of order are buffered in memory until all preceding
+// data is written. Random access reads are not supported, thus the data can't be
+// verified after it's written.
+type WriterStorage struct {
+	// New creates a writer for a queued file.
+	New func(it QueueItem) (io.WriteCloser, error)
+}
+
+// Open implements Storage.
+func (s *WriterStorage) Open(it QueueItem) (StorageFile, error) {
+	w, err := s.New(it)
+	if err != nil {
+		return nil, err
+	}
+	return &streamFile{w: w, pending: make(map[int64][]byte)}, nil
+}
+
+type streamFile struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	off     int64
+	pending map[int64][]byte
+}
+
+func (f *streamFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, ErrNotSeekable
+}
+
+func (f *streamFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off < f.off {
+		return 0, fmt.Errorf("offset %d was already written", off)
+	} else if off > f.off {
+		f.pending[off] = append([]byte{}, p...)
+		return len(p), nil
+	}
+	if _, err := f.w.Write(p); err != nil {
+		return 0, err
+	}
+	f.off += int64(len(p))
+	for {
+		buf, ok := f.pending[f.off]
+		if !ok {
+			break
+		}
+		delete(f.pending, f.off)
+		if _, err := f.w.Write(buf); err != nil {
+			return 0, err
+		}
+		f.off += int64(len(buf))
+	}
+	return len(p), nil
+}
+
+func (f *streamFile) Complete() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) != 0 {
+		f.w.Close()
+		return fmt.Errorf("%d segments were not written", len(f.pending))
+	}
+	return f.w.Close()
+}
+
+func (f *streamFile) Close() error {
+	return f.w.Close()
+}
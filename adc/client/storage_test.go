@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcpp-storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	it := QueueItem{Target: filepath.Join(dir, "out", "file"), Size: 10, TTH: adc.TTH{1}}
+	s := &FileStorage{TempDir: filepath.Join(dir, "tmp"), Alloc: AllocSparse}
+	f, err := s.Open(it)
+	require.NoError(t, err)
+	temp := filepath.Join(dir, "tmp", "file."+it.TTH.Base32()+".dctmp")
+	st, err := os.Stat(temp)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), st.Size())
+
+	_, err = f.WriteAt([]byte("world"), 5)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// reopen preserves the data
+	s.Alloc = AllocFull
+	f, err = s.Open(it)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("hello"), 0)
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	_, err = f.ReadAt(buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, "helloworld", string(buf))
+	require.NoError(t, f.Complete())
+
+	data, err := ioutil.ReadFile(it.Target)
+	require.NoError(t, err)
+	require.Equal(t, "helloworld", string(data))
+	_, err = os.Stat(temp)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestMemoryStorage(t *testing.T) {
+	s := NewMemoryStorage()
+	it := QueueItem{Size: 4, TTH: adc.TTH{1}}
+	f, err := s.Open(it)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("cd"), 2)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("xyz"), 2)
+	require.Error(t, err)
+	_, ok := s.Bytes(it.TTH)
+	require.False(t, ok)
+
+	f, err = s.Open(it)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("ab"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Complete())
+	data, ok := s.Bytes(it.TTH)
+	require.True(t, ok)
+	require.Equal(t, "abcd", string(data))
+	_, err = s.Open(it)
+	require.Equal(t, ErrFileComplete, err)
+}
+
+type nopWriteCloser struct{ *bytes.Buffer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestWriterStorage(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	s := &WriterStorage{New: func(it QueueItem) (io.WriteCloser, error) {
+		return nopWriteCloser{buf}, nil
+	}}
+	f, err := s.Open(QueueItem{Size: 6})
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("ef"), 4)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("cd"), 2)
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+	_, err = f.WriteAt([]byte("ab"), 0)
+	require.NoError(t, err)
+	require.Equal(t, "abcdef", buf.String())
+	_, err = f.ReadAt(make([]byte, 1), 0)
+	require.Equal(t, ErrNotSeekable, err)
+	require.NoError(t, f.Complete())
+}
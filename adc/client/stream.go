@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const (
+	// DefaultStreamChunk is the size of a single request made by a streaming reader.
+	DefaultStreamChunk = 1024 * 1024
+	// DefaultReadahead is the number of chunks a streaming reader fetches in advance.
+	DefaultReadahead = 4
+)
+
+var errStreamClosed = errors.New("stream is closed")
+
+// OpenFile dials the peer and opens a remote file by TTH for streaming.
+// The connection is closed when the file is closed.
+func (p *Peer) OpenFile(ctx context.Context, tth adc.TTH) (File, error) {
+	c, err := p.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.openStream(ctx, tth, true)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenStream opens a remote file by TTH for streaming.
+//
+// Unlike GetFile, the file is fetched sequentially in chunks with a readahead,
+// which makes it suitable for media playback. The connection must not be used
+// for other requests until the file is closed.
+func (c *PeerConn) OpenStream(ctx context.Context, tth adc.TTH) (File, error) {
+	return c.openStream(ctx, tth, false)
+}
+
+func (c *PeerConn) openStream(ctx context.Context, tth adc.TTH, owned bool) (*remoteStream, error) {
+	path := "TTH/" + tth.Base32()
+	info, err := c.statFile(ctx, "file", path)
+	if err != nil {
+		return nil, err
+	}
+	if info.TTH != nil && *info.TTH != tth {
+		return nil, fmt.Errorf("requested %s, got %s", tth, *info.TTH)
+	}
+	return &remoteStream{
+		c: c, owned: owned, path: path, info: *info,
+		chunk: DefaultStreamChunk, ahead: DefaultReadahead,
+	}, nil
+}
+
+type streamChunk struct {
+	off  int64
+	data []byte
+	err  error
+}
+
+// streamFetch sequentially fetches chunks of a file in the background.
+type streamFetch struct {
+	stop chan struct{}
+	done chan struct{}
+	ch   chan streamChunk
+}
+
+func (s *streamFetch) close() {
+	close(s.stop)
+	<-s.done
+}
+
+type remoteStream struct {
+	c     *PeerConn
+	owned bool
+	path  string
+	info  adc.SearchResult
+	chunk int64
+	ahead int
+
+	mu     sync.Mutex
+	closed bool
+	off    int64
+	cur    streamChunk
+	fetch  *streamFetch
+}
+
+func (f *remoteStream) startFetch(off int64) *streamFetch {
+	s := &streamFetch{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		ch:   make(chan streamChunk, f.ahead),
+	}
+	go func() {
+		defer close(s.done)
+		defer close(s.ch)
+		for ; off < f.info.Size; off += f.chunk {
+			data, err := f.readChunk(off, f.chunk)
+			select {
+			case s.ch <- streamChunk{off: off, data: data, err: err}:
+			case <-s.stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (f *remoteStream) readChunk(off, size int64) ([]byte, error) {
+	if off+size > f.info.Size {
+		size = f.info.Size - off
+	}
+	rc, err := f.c.readFile(context.Background(), "file", f.path, off, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func (f *remoteStream) stopFetch() {
+	if f.fetch != nil {
+		f.fetch.close()
+		f.fetch = nil
+	}
+}
+
+func (f *remoteStream) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errStreamClosed
+	}
+	if f.off >= f.info.Size {
+		return 0, io.EOF
+	}
+	for f.off < f.cur.off || f.off >= f.cur.off+int64(len(f.cur.data)) {
+		if f.fetch == nil {
+			f.fetch = f.startFetch(f.off)
+		}
+		ch, ok := <-f.fetch.ch
+		if !ok {
+			f.stopFetch()
+			return 0, io.ErrUnexpectedEOF
+		} else if ch.err != nil {
+			f.stopFetch()
+			return 0, ch.err
+		}
+		f.cur = ch
+		if f.off < ch.off {
+			// should not happen, but restart the fetch anyway
+			f.stopFetch()
+		}
+	}
+	n := copy(p, f.cur.data[f.off-f.cur.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *remoteStream) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errStreamClosed
+	}
+	if d := f.info.Size - off; d <= 0 {
+		return 0, io.EOF
+	} else if int64(len(p)) > d {
+		p = p[:d]
+	}
+	// the connection can only serve one request at a time
+	f.stopFetch()
+	data, err := f.readChunk(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, data), nil
+}
+
+func (f *remoteStream) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.Size
+	default:
+		return 0, fmt.Errorf("wrong whence: %v", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	}
+	// keep the readahead if we stay in the current chunk or move to the next one
+	if end := f.cur.off + int64(len(f.cur.data)); offset < f.cur.off || offset > end {
+		f.stopFetch()
+		f.cur = streamChunk{}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *remoteStream) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.stopFetch()
+	if f.owned {
+		return f.c.Close()
+	}
+	return nil
+}
+
+func (f *remoteStream) Size() int64 {
+	return f.info.Size
+}
+
+func (f *remoteStream) TTH() *adc.TTH {
+	return f.info.TTH
+}
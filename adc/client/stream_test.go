@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// serveFile answers file info and GET requests for a single file on a peer connection.
+func serveFile(t *testing.T, conn *adc.Conn, raw net.Conn, tth adc.TTH, data []byte, reqs chan<- int64) {
+	for {
+		msg, err := conn.ReadClientMsg(time.Time{})
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case adc.GetInfoRequest:
+			err = conn.WriteClientMsg(adc.SearchResult{
+				Path: msg.Path, Size: int64(len(data)), TTH: &tth,
+			})
+			if err == nil {
+				err = conn.Flush()
+			}
+		case adc.GetRequest:
+			reqs <- msg.Start
+			end := int64(len(data))
+			if msg.Bytes >= 0 && msg.Start+msg.Bytes < end {
+				end = msg.Start + msg.Bytes
+			}
+			res := adc.GetResponse(msg)
+			res.Bytes = end - msg.Start
+			if err = conn.WriteClientMsg(res); err != nil {
+				return
+			}
+			if err = conn.Flush(); err != nil {
+				return
+			}
+			_, err = raw.Write(data[msg.Start:end])
+		default:
+			t.Errorf("unexpected message: %#v", msg)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestStreamFile(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	cli, err := adc.NewConn(c1)
+	require.NoError(t, err)
+	srv, err := adc.NewConn(c2)
+	require.NoError(t, err)
+
+	data := make([]byte, 10*1000+10)
+	rand.New(rand.NewSource(1)).Read(data)
+	tth := adc.TTH{1}
+	reqs := make(chan int64, 100)
+	go serveFile(t, srv, c2, tth, data, reqs)
+
+	pc := &PeerConn{conn: cli}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f, err := pc.openStream(ctx, tth, true)
+	require.NoError(t, err)
+	f.chunk = 1000
+	f.ahead = 2
+	require.Equal(t, int64(len(data)), f.Size())
+
+	got, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.Len(t, reqs, 11)
+	for i := 0; i < 11; i++ {
+		require.Equal(t, int64(i*1000), <-reqs)
+	}
+
+	// seek backward restarts the fetch
+	off, err := f.Seek(-1500, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)-1500), off)
+	buf := make([]byte, 100)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(t, err)
+	require.Equal(t, data[off:off+100], buf)
+	require.Equal(t, off, <-reqs)
+
+	_, err = f.ReadAt(buf, 5)
+	require.NoError(t, err)
+	require.Equal(t, data[5:105], buf)
+
+	require.NoError(t, f.Close())
+	_, err = f.Read(buf)
+	require.Equal(t, errStreamClosed, err)
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultRetryMinDelay is the delay before the first retry if RetryPolicy.MinDelay is not set.
+	DefaultRetryMinDelay = time.Second
+	// DefaultRetryMaxDelay is the maximal delay between retries if RetryPolicy.MaxDelay is not set.
+	DefaultRetryMaxDelay = time.Minute
+)
+
+// Timeouts configures timeouts of a hub connection and client-client connections
+// established through it.
+//
+// Context deadlines take precedence over these values.
+type Timeouts struct {
+	// Handshake is the time allowed for a single handshake step or a request to a peer.
+	// Zero value means DefaultHandshakeTimeout.
+	Handshake time.Duration
+	// ReadIdle closes the hub connection if nothing was received from the hub
+	// within this time. Zero value disables the limit.
+	ReadIdle time.Duration
+	// Write is the time allowed to write a single batch of commands.
+	// Zero value disables the limit.
+	Write time.Duration
+	// Search is the time to wait for search results.
+	// Zero value means DefaultSearchTimeout.
+	Search time.Duration
+}
+
+func (t Timeouts) handshake() time.Duration {
+	if t.Handshake <= 0 {
+		return DefaultHandshakeTimeout
+	}
+	return t.Handshake
+}
+
+func (t Timeouts) search() time.Duration {
+	if t.Search <= 0 {
+		return DefaultSearchTimeout
+	}
+	return t.Search
+}
+
+// writeDeadline returns a deadline for a write. Zero value means no deadline.
+func (t Timeouts) writeDeadline(ctx context.Context) time.Time {
+	deadline, _ := ctx.Deadline()
+	if t.Write > 0 {
+		if d := time.Now().Add(t.Write); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	return deadline
+}
+
+// RetryPolicy controls how failed dials are retried.
+//
+// Delays grow exponentially from MinDelay to MaxDelay and are randomized by Jitter,
+// so that clients that lost the connection at the same time don't reconnect all at once.
+type RetryPolicy struct {
+	// Attempts is the maximal number of attempts. Zero value means no retries.
+	Attempts int
+	// MinDelay is the delay before the first retry.
+	// Zero value means DefaultRetryMinDelay.
+	MinDelay time.Duration
+	// MaxDelay is the maximal delay between retries.
+	// Zero value means DefaultRetryMaxDelay.
+	MaxDelay time.Duration
+	// Jitter is a fraction of the delay that is randomized, in [0, 1] range.
+	Jitter float64
+}
+
+// Delay returns a delay before the n-th retry, starting from 0.
+func (p *RetryPolicy) Delay(n int) time.Duration {
+	min, max := p.MinDelay, p.MaxDelay
+	if min <= 0 {
+		min = DefaultRetryMinDelay
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+	d := min
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if j := p.Jitter; j > 0 {
+		if j > 1 {
+			j = 1
+		}
+		d -= time.Duration(rand.Float64() * j * float64(d))
+	}
+	return d
+}
+
+// Do calls the function until it succeeds, the number of attempts is exhausted
+// or the context is cancelled. It returns the last error.
+func (p *RetryPolicy) Do(ctx context.Context, fnc func(ctx context.Context) error) error {
+	attempts := 1
+	if p != nil && p.Attempts > 1 {
+		attempts = p.Attempts
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i != 0 {
+			t := time.NewTimer(p.Delay(i - 1))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+		}
+		err = fnc(ctx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
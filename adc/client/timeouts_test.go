@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{MinDelay: time.Second, MaxDelay: 10 * time.Second}
+	for i, exp := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	} {
+		require.Equal(t, exp, p.Delay(i), "%d", i)
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Delay(1)
+		require.True(t, d > time.Second && d <= 2*time.Second, "%v", d)
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	errFail := errors.New("fail")
+	p := &RetryPolicy{Attempts: 3, MinDelay: time.Millisecond}
+
+	calls := 0
+	err := p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errFail
+	})
+	require.Equal(t, errFail, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return errFail
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+
+	// nil policy makes a single attempt
+	calls = 0
+	var np *RetryPolicy
+	err = np.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errFail
+	})
+	require.Equal(t, errFail, err)
+	require.Equal(t, 1, calls)
+
+	// cancelled context stops retries
+	ctx, cancel := context.WithCancel(context.Background())
+	p = &RetryPolicy{Attempts: 10, MinDelay: time.Hour}
+	calls = 0
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = p.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return errFail
+	})
+	require.Equal(t, errFail, err)
+	require.Equal(t, 1, calls)
+}
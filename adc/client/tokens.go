@@ -0,0 +1,97 @@
+package client
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// DefaultTokenTTL is the time a connection token sent in CTM or RCM stays valid.
+const DefaultTokenTTL = time.Minute
+
+// connToken is an outstanding connection token.
+type connToken struct {
+	cid     adc.CID
+	proto   string
+	expires time.Time
+	addr    chan string    // address from CTM, for tokens sent in RCM
+	conn    chan *PeerConn // incoming connection, for tokens sent in CTM
+	errc    chan error
+}
+
+// connTokens tracks outstanding connection tokens.
+type connTokens struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	tokens map[string]*connToken
+}
+
+// add generates a new token for the peer. It also drops expired tokens.
+func (m *connTokens) add(cid adc.CID, proto string) (string, *connToken) {
+	ttl := m.ttl
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	now := time.Now()
+	t := &connToken{
+		cid: cid, proto: proto, expires: now.Add(ttl),
+		addr: make(chan string, 1),
+		conn: make(chan *PeerConn, 1),
+		errc: make(chan error, 1),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = make(map[string]*connToken)
+	}
+	m.expire(now)
+	for {
+		tok := strconv.FormatUint(uint64(rand.Uint32()), 36)
+		if _, ok := m.tokens[tok]; !ok {
+			m.tokens[tok] = t
+			return tok, t
+		}
+		// collision, pick another token
+	}
+}
+
+// expire removes expired tokens. It must be called with the lock held.
+func (m *connTokens) expire(now time.Time) {
+	for tok, t := range m.tokens {
+		if now.After(t.expires) {
+			delete(m.tokens, tok)
+		}
+	}
+}
+
+// take removes the token and returns it, if it's still valid.
+func (m *connTokens) take(tok string) (*connToken, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[tok]
+	if !ok {
+		return nil, false
+	}
+	delete(m.tokens, tok)
+	if time.Now().After(t.expires) {
+		return nil, false
+	}
+	return t, true
+}
+
+// remove drops the token.
+func (m *connTokens) remove(tok string) {
+	m.mu.Lock()
+	delete(m.tokens, tok)
+	m.mu.Unlock()
+}
+
+// len returns the number of outstanding tokens.
+func (m *connTokens) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.tokens)
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/direct-connect/go-dc/tiger"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const (
+	// tthBlock is the size of the data block hashed by each TTH leaf.
+	tthBlock = 1024
+
+	// DefaultBadDataLimit is the number of corrupted segments after which the source is blacklisted.
+	DefaultBadDataLimit = 3
+)
+
+var ErrInvalidLeaves = errors.New("tth leaves don't match the root hash")
+
+// GetLeaves fetches TTH leaves of a file from the peer and checks them against the root hash.
+func (c *PeerConn) GetLeaves(ctx context.Context, tth adc.TTH) (tiger.Leaves, error) {
+	r, err := c.get(ctx, adc.GetRequest{
+		Type: "tthl", Path: "TTH/" + tth.Base32(),
+		Start: 0, Bytes: -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLeaves(tth, data)
+}
+
+// ParseLeaves decodes concatenated TTH leaves and checks them against the root hash.
+func ParseLeaves(tth adc.TTH, data []byte) (tiger.Leaves, error) {
+	if len(data) == 0 || len(data)%tiger.Size != 0 {
+		return nil, fmt.Errorf("invalid tth leaves size: %d", len(data))
+	}
+	leaves := make(tiger.Leaves, len(data)/tiger.Size)
+	for i := range leaves {
+		copy(leaves[i][:], data[i*tiger.Size:])
+	}
+	if leaves.TreeHash() != tth {
+		return nil, ErrInvalidLeaves
+	}
+	return leaves, nil
+}
+
+// Verifier checks downloaded segments of a file against TTH leaves.
+type Verifier struct {
+	tth       adc.TTH
+	size      int64
+	blockSize int64 // size of the download segment
+	leaves    tiger.Leaves
+	leafSize  int64 // size of the data covered by one leaf
+}
+
+// NewVerifier creates a verifier for a file with a given segment size.
+// Leaves may be of any level of the hash tree, but must match the root hash.
+func NewVerifier(tth adc.TTH, size, blockSize int64, leaves tiger.Leaves) (*Verifier, error) {
+	if blockSize <= 0 || blockSize%tthBlock != 0 {
+		return nil, fmt.Errorf("invalid block size: %d", blockSize)
+	} else if len(leaves) == 0 || leaves.TreeHash() != tth {
+		return nil, ErrInvalidLeaves
+	}
+	leafSize := int64(tthBlock)
+	for (size+leafSize-1)/leafSize > int64(len(leaves)) {
+		leafSize *= 2
+	}
+	if n := (size + leafSize - 1) / leafSize; n != int64(len(leaves)) && !(size == 0 && len(leaves) == 1) {
+		return nil, fmt.Errorf("unexpected number of leaves for %d bytes: %d", size, len(leaves))
+	}
+	return &Verifier{
+		tth: tth, size: size, blockSize: blockSize,
+		leaves: leaves, leafSize: leafSize,
+	}, nil
+}
+
+// unit returns the number of segments that must be checked together.
+// It's larger than one if the leaves are coarser than segments.
+func (v *Verifier) unit() int {
+	if v.leafSize <= v.blockSize {
+		return 1
+	}
+	return int(v.leafSize / v.blockSize)
+}
+
+// VerifyRange checks segments in the [start, end) range and returns the corrupted ones.
+//
+// If leaves cover more than one segment, only groups of segments that are fully inside
+// the range are checked, and the whole group is reported as corrupted.
+func (v *Verifier) VerifyRange(r io.ReaderAt, start, end int) (adc.PartsInfo, error) {
+	unit := v.unit()
+	total := v.blocks()
+	if end > total {
+		end = total
+	}
+	var bad adc.PartsInfo
+	first := (start + unit - 1) / unit * unit
+	for b := first; b < end; b += unit {
+		e := b + unit
+		if e > total {
+			e = total
+		}
+		if e > end {
+			break
+		}
+		off := int64(b) * v.blockSize
+		n := int64(e)*v.blockSize - off
+		if off+n > v.size {
+			n = v.size - off
+		}
+		ok, err := v.verify(io.NewSectionReader(r, off, n), off, n)
+		if err != nil {
+			return bad, err
+		} else if !ok {
+			bad = bad.Add(b, e)
+		}
+	}
+	return bad, nil
+}
+
+func (v *Verifier) blocks() int {
+	return int((v.size + v.blockSize - 1) / v.blockSize)
+}
+
+// Verify checks all segments of the file and returns the corrupted ones.
+func (v *Verifier) Verify(r io.ReaderAt) (adc.PartsInfo, error) {
+	return v.VerifyRange(r, 0, v.blocks())
+}
+
+// verify checks n bytes of data at a given offset. The offset must be aligned to the leaf size.
+func (v *Verifier) verify(r io.Reader, off, n int64) (bool, error) {
+	buf := make([]byte, v.leafSize)
+	for i := off / v.leafSize; n > 0; i++ {
+		sz := v.leafSize
+		if sz > n {
+			sz = n
+		}
+		if _, err := io.ReadFull(r, buf[:sz]); err != nil {
+			return false, err
+		}
+		n -= sz
+		leaves, err := tiger.TreeLeaves(bytes.NewReader(buf[:sz]))
+		if err != nil {
+			return false, err
+		}
+		if i >= int64(len(v.leaves)) || leaves.TreeHash() != v.leaves[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Blacklist tracks sources that sent corrupted data.
+//
+// Sources are never used again for the file they corrupted, and are banned completely
+// after Limit corrupted segments.
+type Blacklist struct {
+	// Limit is the number of corrupted segments after which the source is banned.
+	Limit int
+
+	mu      sync.RWMutex
+	strikes map[adc.CID]int
+	files   map[adc.TTH]map[adc.CID]struct{}
+}
+
+// NewBlacklist creates an empty blacklist with a default limit.
+func NewBlacklist() *Blacklist {
+	return &Blacklist{
+		Limit:   DefaultBadDataLimit,
+		strikes: make(map[adc.CID]int),
+		files:   make(map[adc.TTH]map[adc.CID]struct{}),
+	}
+}
+
+// Report records that the source sent corrupted data for a file.
+// It returns true if the source is banned as a result.
+func (b *Blacklist) Report(tth adc.TTH, cid adc.CID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := b.files[tth]
+	if m == nil {
+		m = make(map[adc.CID]struct{})
+		b.files[tth] = m
+	}
+	m[cid] = struct{}{}
+	b.strikes[cid]++
+	return b.banned(cid)
+}
+
+func (b *Blacklist) banned(cid adc.CID) bool {
+	return b.Limit > 0 && b.strikes[cid] >= b.Limit
+}
+
+// Banned checks if the source is banned.
+func (b *Blacklist) Banned(cid adc.CID) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.banned(cid)
+}
+
+// Allowed checks if the file can be downloaded from a given source.
+func (b *Blacklist) Allowed(tth adc.TTH, cid adc.CID) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.banned(cid) {
+		return false
+	}
+	_, bad := b.files[tth][cid]
+	return !bad
+}
+
+// Forget removes the file from the blacklist, for example when it's downloaded.
+// Strikes of the sources are preserved.
+func (b *Blacklist) Forget(tth adc.TTH) {
+	b.mu.Lock()
+	delete(b.files, tth)
+	b.mu.Unlock()
+}
+
+// Forgive removes all strikes of the source.
+func (b *Blacklist) Forgive(cid adc.CID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.strikes, cid)
+	for _, m := range b.files {
+		delete(m, cid)
+	}
+}
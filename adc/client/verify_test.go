@@ -0,0 +1,121 @@
+package client
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// reduceLeaves builds a coarser level of the hash tree.
+func reduceLeaves(in tiger.Leaves) tiger.Leaves {
+	var out tiger.Leaves
+	for i := 0; i < len(in); i += 2 {
+		if i+1 >= len(in) {
+			out = append(out, in[i])
+			continue
+		}
+		out = append(out, tiger.Leaves{in[i], in[i+1]}.TreeHash())
+	}
+	return out
+}
+
+func TestVerifier(t *testing.T) {
+	const bs = 64 * 1024
+	data := make([]byte, 5*bs+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	leaves, err := tiger.TreeLeaves(bytes.NewReader(data))
+	require.NoError(t, err)
+	tth := leaves.TreeHash()
+
+	buf := bytes.NewBuffer(nil)
+	for _, l := range leaves {
+		buf.Write(l[:])
+	}
+	_, err = ParseLeaves(tth, buf.Bytes())
+	require.NoError(t, err)
+	_, err = ParseLeaves(adc.TTH{1}, buf.Bytes())
+	require.Equal(t, ErrInvalidLeaves, err)
+
+	corrupt := append([]byte{}, data...)
+	corrupt[2*bs+10] ^= 0xff
+	corrupt[5*bs+1] ^= 0xff
+
+	// fine leaves: one leaf per 1024 bytes
+	v, err := NewVerifier(tth, int64(len(data)), bs, leaves)
+	require.NoError(t, err)
+	bad, err := v.Verify(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Empty(t, bad)
+	bad, err = v.Verify(bytes.NewReader(corrupt))
+	require.NoError(t, err)
+	require.Equal(t, adc.PartsInfo{2, 3, 5, 6}, bad)
+
+	// coarse leaves: one leaf per 2 segments
+	for len(leaves) > 3 {
+		leaves = reduceLeaves(leaves)
+	}
+	v, err = NewVerifier(tth, int64(len(data)), bs, leaves)
+	require.NoError(t, err)
+	bad, err = v.VerifyRange(bytes.NewReader(corrupt), 1, 4)
+	require.NoError(t, err)
+	require.Equal(t, adc.PartsInfo{2, 4}, bad)
+	bad, err = v.Verify(bytes.NewReader(corrupt))
+	require.NoError(t, err)
+	require.Equal(t, adc.PartsInfo{2, 6}, bad)
+}
+
+func TestQueueVerify(t *testing.T) {
+	const bs = 64 * 1024
+	data := make([]byte, 4*bs)
+	rand.New(rand.NewSource(2)).Read(data)
+	leaves, err := tiger.TreeLeaves(bytes.NewReader(data))
+	require.NoError(t, err)
+	tth := leaves.TreeHash()
+
+	q := NewQueue()
+	_, err = q.Add("file", int64(len(data)), tth)
+	require.NoError(t, err)
+	v, err := NewVerifier(tth, int64(len(data)), bs, leaves)
+	require.NoError(t, err)
+
+	bl := NewBlacklist()
+	bl.Limit = 2
+	bob, alice := adc.CID{1}, adc.CID{2}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[bs] ^= 0xff
+	bad, err := q.MarkVerified(v, bytes.NewReader(corrupt), 0, 2, bob, bl)
+	require.NoError(t, err)
+	require.Equal(t, adc.PartsInfo{1, 2}, bad)
+	it, _ := q.Item(tth)
+	require.Equal(t, adc.PartsInfo{0, 1}, it.Done)
+	require.False(t, bl.Allowed(tth, bob))
+	require.True(t, bl.Allowed(adc.TTH{1}, bob))
+	require.True(t, bl.Allowed(tth, alice))
+
+	bad, err = q.MarkVerified(v, bytes.NewReader(data), 1, 4, alice, bl)
+	require.NoError(t, err)
+	require.Empty(t, bad)
+	_, ok := q.Item(tth)
+	require.False(t, ok, "should be complete")
+
+	require.False(t, bl.Banned(bob))
+	require.True(t, bl.Report(adc.TTH{1}, bob))
+	require.False(t, bl.Allowed(adc.TTH{2}, bob))
+	bl.Forgive(bob)
+	require.True(t, bl.Allowed(tth, bob))
+
+	q2 := NewQueue()
+	_, err = q2.Add("file", int64(len(data)), tth)
+	require.NoError(t, err)
+	require.NoError(t, q2.MarkDone(tth, 0, 3))
+	require.NoError(t, q2.Invalidate(tth, adc.PartsInfo{1, 2}))
+	it, _ = q2.Item(tth)
+	require.Equal(t, adc.PartsInfo{0, 1, 2, 3}, it.Done)
+}
@@ -59,16 +59,9 @@ func unmarshalValue(s []byte, rv reflect.Value) error {
 		case reflect.Int32, reflect.Int16:
 			bits = 32
 		}
-		sv := string(s)
-		vi, err := strconv.ParseInt(sv, 10, bits)
+		vi, err := parseInt(s, bits)
 		if err != nil {
-			vf, err2 := strconv.ParseFloat(sv, bits)
-			if err2 != nil {
-				return err
-			} else if math.Round(vf) != vf {
-				return err2
-			}
-			vi = int64(vf)
+			return err
 		}
 		rv.SetInt(vi)
 		return nil
@@ -86,18 +79,44 @@ func unmarshalValue(s []byte, rv reflect.Value) error {
 		}
 		return err
 	case reflect.Bool:
-		if len(s) == 0 {
-			rv.SetBool(false)
-			return nil
-		} else if len(s) != 1 {
-			return errors.New("invalid bool value: " + string(s))
+		v, err := parseBool(s)
+		if err != nil {
+			return err
 		}
-		rv.SetBool(s[0] != 0)
+		rv.SetBool(v)
 		return nil
 	}
 	return fmt.Errorf("unknown type: %v", rv.Type())
 }
 
+// parseInt parses an integer value. Float values are accepted as long as they have no fractional part.
+func parseInt(s []byte, bits int) (int64, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	sv := string(s)
+	vi, err := strconv.ParseInt(sv, 10, bits)
+	if err != nil {
+		vf, err2 := strconv.ParseFloat(sv, bits)
+		if err2 != nil {
+			return 0, err
+		} else if math.Round(vf) != vf {
+			return 0, err2
+		}
+		vi = int64(vf)
+	}
+	return vi, nil
+}
+
+func parseBool(s []byte) (bool, error) {
+	if len(s) == 0 {
+		return false, nil
+	} else if len(s) != 1 {
+		return false, errors.New("invalid bool value: " + string(s))
+	}
+	return s[0] != 0, nil
+}
+
 func Unmarshal(s []byte, o interface{}) error {
 	if m, ok := o.(Unmarshaler); ok {
 		return m.UnmarshalAdc(s)
@@ -110,6 +129,11 @@ func Unmarshal(s []byte, o interface{}) error {
 	if rv.Kind() != reflect.Struct {
 		return fmt.Errorf("struct expected, got: %T", o)
 	}
+	return unmarshalReflect(s, rv)
+}
+
+// unmarshalReflect decodes the message into a struct using reflection.
+func unmarshalReflect(s []byte, rv reflect.Value) error {
 	rt := rv.Type()
 
 	sub := bytes.Split(s, []byte(" "))
@@ -211,6 +235,11 @@ func Marshal(o interface{}) ([]byte, error) {
 	if rv.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("struct expected, got: %T", o)
 	}
+	return marshalReflect(rv)
+}
+
+// marshalReflect encodes the struct using reflection.
+func marshalReflect(rv reflect.Value) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
 	rt := rv.Type()
 	first := true
@@ -276,3 +305,35 @@ func MustMarshal(o interface{}) []byte {
 	}
 	return data
 }
+
+// appendEscaped appends an escaped string to the buffer. It's equivalent to escape.
+func appendEscaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case ' ':
+			buf = append(buf, '\\', 's')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// fieldWriter is used by generated marshalers to write message fields.
+type fieldWriter struct {
+	buf []byte
+	n   int
+}
+
+// field starts a new field with a given tag. Empty tag is used for positional fields.
+func (w *fieldWriter) field(tag string) {
+	if w.n != 0 {
+		w.buf = append(w.buf, ' ')
+	}
+	w.n++
+	w.buf = append(w.buf, tag...)
+}
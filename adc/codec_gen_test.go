@@ -0,0 +1,80 @@
+package adc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var casesGenerated = []struct {
+	name string
+	typ  interface{}
+	data string
+}{
+	{"user", User{}, `NIgopher SF34 FS0 SUGCON,ADC0 SS39542721391 VEGoConn\s0.01 SL3 IDHVBNEMDCTKCD4V3N54X4MMOVLJLJL6PSKVHFXHI I4172.17.42.1`},
+	{"user pid", User{}, `PDHVBNEMDCTKCD4V3N54X4MMOVLJLJL6PSKVHFXHI IDHVBNEMDCTKCD4V3N54X4MMOVLJLJL6PSKVHFXHI NIgopher`},
+	{"user dup id", User{}, `IDHVBNEMDCTKCD4V3N54X4MMOVLJLJL6PSKVHFXHI IDKAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI`},
+	{"user dup nick", User{}, `NIa NIb`},
+	{"user bad int", User{}, `SLx`},
+	{"user empty", User{}, ``},
+	{"hub info", HubInfo{}, `NIhub DEsome\sdesc VEhub\s1.0 CT32`},
+	{"search", SearchRequest{}, `TO4171511714 ANsome ANdata GR32 EXavi EXmkv`},
+	{"search result", SearchResult{}, `TOtok FNfilepath SI1234567 SL3`},
+	{"partial result", PartialResult{}, `HI127.0.0.1:411 U41234 TRKAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI PC4 PI0,5,10,12`},
+	{"partial result bad", PartialResult{}, `PI0,5,10`},
+	{"rcm", RevConnectRequest{}, `ADC/1.0 12345678`},
+	{"ctm", ConnectRequest{}, `ADC/1.0 412 12345678`},
+	{"msg", ChatMessage{}, `some\stext PMAAAB ME1`},
+	{"msg empty pm", ChatMessage{}, `text PM`},
+	{"user cmd", UserCommand{}, `ADCH++/Hub\smanagement/Reload\sscripts TTHMSG\s+reload\n CT3`},
+	{"disconnect", Disconnect{}, `AAAB IDAAAC MSbye RD1`},
+}
+
+func TestGeneratedCodec(t *testing.T) {
+	for _, c := range casesGenerated {
+		t.Run(c.name, func(t *testing.T) {
+			rt := reflect.TypeOf(c.typ)
+
+			exp := reflect.New(rt)
+			expErr := unmarshalReflect([]byte(c.data), exp.Elem())
+
+			got := reflect.New(rt)
+			gotErr := got.Interface().(Unmarshaler).UnmarshalAdc([]byte(c.data))
+			if expErr != nil {
+				require.EqualError(t, gotErr, expErr.Error())
+				return
+			}
+			require.NoError(t, gotErr)
+			require.Equal(t, exp.Interface(), got.Interface())
+
+			expData, err := marshalReflect(exp.Elem())
+			require.NoError(t, err)
+			gotData, err := got.Elem().Interface().(Marshaler).MarshalAdc()
+			require.NoError(t, err)
+			require.Equal(t, string(expData), string(gotData))
+		})
+	}
+}
+
+func BenchmarkUnmarshalUser(b *testing.B) {
+	data := []byte(casesGenerated[0].data)
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var u User
+			if err := unmarshalReflect(data, reflect.ValueOf(&u).Elem()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var u User
+			if err := u.UnmarshalAdc(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
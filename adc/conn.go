@@ -3,18 +3,17 @@ package adc
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
-	"net/url"
 	"sync"
 	"time"
 
 	"github.com/direct-connect/go-dc/lineproto"
+	"github.com/direct-connect/go-dcpp/trace"
 )
 
 var (
@@ -30,48 +29,14 @@ type Route interface {
 	Flush() error
 }
 
-var dialer = net.Dialer{}
-
-// Dial connects to a specified address.
+// Dial connects to a specified address using the default Dialer.
 func Dial(addr string) (*Conn, error) {
-	return DialContext(context.Background(), addr)
+	return defaultDialer.Dial(addr)
 }
 
-// DialContext connects to a specified address.
+// DialContext connects to a specified address using the default Dialer.
 func DialContext(ctx context.Context, addr string) (*Conn, error) {
-	u, err := url.Parse(addr)
-	if err != nil {
-		return nil, err
-	}
-	if u.Host == "" {
-		u, err = url.Parse("adc://" + addr)
-		if err != nil {
-			return nil, err
-		}
-	}
-	secure := false
-	switch u.Scheme {
-	case SchemaADC:
-		// continue
-	case SchemaADCS:
-		secure = true
-	default:
-		return nil, fmt.Errorf("unsupported protocol: %q", u.Scheme)
-	}
-	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
-	if err != nil {
-		return nil, err
-	}
-	if secure {
-		sconn := tls.Client(conn, &tls.Config{
-			InsecureSkipVerify: true,
-		})
-		if err = sconn.Handshake(); err != nil {
-			return nil, fmt.Errorf("TLS handshake failed: %v", err)
-		}
-		conn = sconn
-	}
-	return NewConn(conn)
+	return defaultDialer.DialContext(ctx, addr)
 }
 
 // NewConn runs an ADC protocol over a specified connection.
@@ -108,6 +73,33 @@ type Conn struct {
 
 	w *lineproto.Writer
 	r *lineproto.Reader
+
+	// hooks that can modify raw protocol lines
+	hooks struct {
+		r, w []trace.Hook
+	}
+}
+
+// OnLineRead registers a hook that is called for each ADC command read from the connection.
+// The hook may modify or drop the command.
+//
+// This method is not concurrent-safe and should be called before reading from the connection.
+func (c *Conn) OnLineRead(fnc trace.Hook) {
+	c.hooks.r = append(c.hooks.r, fnc)
+}
+
+// OnLineWrite registers a hook that is called for each ADC command written to the connection.
+// The hook may modify or drop the command.
+//
+// This method is not concurrent-safe and should be called before writing to the connection.
+func (c *Conn) OnLineWrite(fnc trace.Hook) {
+	c.hooks.w = append(c.hooks.w, fnc)
+}
+
+// Trace registers read and write hooks of the tracer.
+func (c *Conn) Trace(t trace.Tracer) {
+	c.OnLineRead(t.LineRead)
+	c.OnLineWrite(t.LineWrite)
 }
 
 func (c *Conn) OnLineR(fnc func(line []byte) (bool, error)) {
@@ -147,6 +139,11 @@ func (c *Conn) ZOn(lvl int) error {
 	return c.w.EnableZlibLevel(lvl)
 }
 
+// ZOff ends the compressed stream started with ZOn and flushes it.
+func (c *Conn) ZOff() error {
+	return c.w.DisableZlib()
+}
+
 // Close closes the connection.
 func (c *Conn) Close() error {
 	if c.closed != nil {
@@ -164,11 +161,15 @@ func (c *Conn) WriteKeepAlive() error {
 }
 
 // ReadPacket reads and decodes a single ADC command.
+//
+// The packet is safe to retain after the next call, for example to relay it to other peers.
 func (c *Conn) ReadPacket(deadline time.Time) (Packet, error) {
 	p, err := c.readPacket(deadline)
 	if err != nil {
 		return nil, err
 	}
+	// decoded packet references the line, which is only valid until the next read
+	p = append([]byte(nil), p...)
 	return DecodePacket(p)
 }
 
@@ -189,6 +190,14 @@ func (c *Conn) readPacket(deadline time.Time) ([]byte, error) {
 		} else if len(s) == 0 || s[len(s)-1] != lineDelim {
 			return nil, errors.New("invalid packet delimiter")
 		}
+		if len(c.hooks.r) != 0 {
+			s, err = trace.Apply(c.hooks.r, s)
+			if err != nil {
+				return nil, err
+			} else if s == nil {
+				continue
+			}
+		}
 		if len(s) > 1 {
 			return s, nil
 		}
@@ -297,6 +306,19 @@ func (c *Conn) WriteBroadcast(id SID, msg Message) error {
 	})
 }
 
+// WriteFeatureBroadcast sends a message to all peers that match the feature selectors.
+// Features set to true are required, features set to false are excluded.
+func (c *Conn) WriteFeatureBroadcast(id SID, fea map[Feature]bool, msg Message) error {
+	data, err := Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.WritePacket(&FeaturePacket{
+		ID: id, Features: fea,
+		BasePacket: BasePacket{Name: msg.Cmd(), Data: data},
+	})
+}
+
 func (c *Conn) WriteDirect(id, targ SID, msg Message) error {
 	data, err := Marshal(msg)
 	if err != nil {
@@ -332,6 +354,15 @@ func (c *Conn) writeRawPacket(s []byte) error {
 	c.bin.RLock()
 	defer c.bin.RUnlock()
 
+	if len(c.hooks.w) != 0 {
+		var err error
+		s, err = trace.Apply(c.hooks.w, s)
+		if err != nil {
+			return err
+		} else if s == nil {
+			return nil
+		}
+	}
 	return c.w.WriteLine(s)
 }
 
@@ -461,17 +492,17 @@ func (c *Conn) ClientHandshake(toHub bool, f ModFeatures) error { // TODO: ctx
 
 // ReadBinary acquires an exclusive reader lock on the connection and switches it to binary mode.
 // Reader will be limited to exactly n bytes. Unread content will be discarded on close.
-//func (c *Conn) ReadBinary(n int64) io.ReadCloser {
-//	if n <= 0 {
-//		return ioutil.NopCloser(bytes.NewReader(nil))
-//	}
-//	// acquire exclusive connection lock
-//	c.bin.Lock()
-//	if Debug {
-//		log.Printf("<- [binary data: %d bytes]", n)
-//	}
-//	return &rawReader{c: c, r: io.LimitReader(c.r.r, n)}
-//}
+func (c *Conn) ReadBinary(n int64) io.ReadCloser {
+	if n <= 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	// acquire exclusive connection lock
+	c.bin.Lock()
+	if Debug {
+		log.Printf("<- [binary data: %d bytes]", n)
+	}
+	return &rawReader{c: c, r: io.LimitReader(c.r, n)}
+}
 
 type rawReader struct {
 	c   *Conn
@@ -0,0 +1,47 @@
+package adc_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/trace"
+)
+
+func TestConnTrace(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	w, err := NewConn(c1)
+	require.NoError(t, err)
+	r, err := NewConn(c2)
+	require.NoError(t, err)
+
+	logs := bytes.NewBuffer(nil)
+	w.Trace(trace.NewLineLogger(logs, "test "))
+	w.OnLineWrite(func(line []byte) ([]byte, error) {
+		if bytes.HasPrefix(line, []byte("IMSG drop")) {
+			return nil, nil
+		}
+		return line, nil
+	})
+	r.OnLineRead(func(line []byte) ([]byte, error) {
+		return bytes.Replace(line, []byte("hello"), []byte("hi"), -1), nil
+	})
+
+	go func() {
+		_ = w.WriteInfoMsg(ChatMessage{Text: "drop"})
+		_ = w.WriteInfoMsg(ChatMessage{Text: "hello"})
+		_ = w.Flush()
+	}()
+	m, err := r.ReadInfoMsg(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, ChatMessage{Text: "hi"}, m)
+	require.Equal(t, 2, strings.Count(logs.String(), "test ->"))
+}
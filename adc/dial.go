@@ -0,0 +1,270 @@
+package adc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDialAddrTimeout is the default time allowed to connect to a single address of the hub.
+	DefaultDialAddrTimeout = 10 * time.Second
+	// DefaultDialFallbackDelay is the default delay before the next address of the hub is tried
+	// in parallel with the previous one.
+	DefaultDialFallbackDelay = 250 * time.Millisecond
+)
+
+var defaultDialer = &Dialer{}
+
+// resolver is a subset of net.Resolver used by the Dialer.
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Dialer connects to ADC hubs.
+//
+// If the hub address has no port, the hub is located using SRV records of the host
+// (_adc._tcp or _adcs._tcp, depending on the scheme). Targets are tried in the order
+// of their priority and weight, and the next one is used if the connection fails.
+//
+// All A and AAAA records of the host are tried in a "happy eyeballs" fashion:
+// addresses of both families are interleaved, and the next address is dialed
+// if the previous one doesn't connect within FallbackDelay. The first established
+// connection is used, and the rest are closed.
+type Dialer struct {
+	// AddrTimeout is the time allowed to connect to a single address.
+	// Zero value means DefaultDialAddrTimeout.
+	AddrTimeout time.Duration
+	// FallbackDelay is the time to wait before dialing the next address of the host.
+	// Zero value means DefaultDialFallbackDelay.
+	FallbackDelay time.Duration
+
+	// for tests
+	resolver resolver
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func (d *Dialer) addrTimeout() time.Duration {
+	if d.AddrTimeout <= 0 {
+		return DefaultDialAddrTimeout
+	}
+	return d.AddrTimeout
+}
+
+func (d *Dialer) fallbackDelay() time.Duration {
+	if d.FallbackDelay <= 0 {
+		return DefaultDialFallbackDelay
+	}
+	return d.FallbackDelay
+}
+
+func (d *Dialer) lookup() resolver {
+	if d.resolver != nil {
+		return d.resolver
+	}
+	return net.DefaultResolver
+}
+
+func (d *Dialer) dialAddr(ctx context.Context, addr string) (net.Conn, error) {
+	if d.dial != nil {
+		return d.dial(ctx, "tcp", addr)
+	}
+	var nd net.Dialer
+	return nd.DialContext(ctx, "tcp", addr)
+}
+
+// Dial connects to a specified address.
+func (d *Dialer) Dial(addr string) (*Conn, error) {
+	return d.DialContext(context.Background(), addr)
+}
+
+// DialContext connects to a specified address.
+func (d *Dialer) DialContext(ctx context.Context, addr string) (*Conn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		u, err = url.Parse("adc://" + addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	secure := false
+	switch u.Scheme {
+	case SchemaADC:
+		// continue
+	case SchemaADCS:
+		secure = true
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %q", u.Scheme)
+	}
+	conn, err := d.dialHost(ctx, u.Scheme, u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if secure {
+		sconn := tls.Client(conn, &tls.Config{
+			InsecureSkipVerify: true,
+		})
+		if err = sconn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %v", err)
+		}
+		conn = sconn
+	}
+	return NewConn(conn)
+}
+
+// dialHost connects to the host, using SRV records if the port is not set.
+func (d *Dialer) dialHost(ctx context.Context, scheme, host string) (net.Conn, error) {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return d.dialTarget(ctx, host)
+	}
+	_, srvs, err := d.lookup().LookupSRV(ctx, scheme, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("no port in the hub address and SRV lookup failed: %v", err)
+	}
+	var last error
+	for _, s := range srvs {
+		if s.Target == "." {
+			// the service is explicitly not available on this host
+			break
+		}
+		target := net.JoinHostPort(strings.TrimSuffix(s.Target, "."), strconv.Itoa(int(s.Port)))
+		conn, err := d.dialTarget(ctx, target)
+		if err == nil {
+			return conn, nil
+		}
+		last = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if last == nil {
+		last = fmt.Errorf("no SRV records for %q", host)
+	}
+	return nil, last
+}
+
+// dialTarget resolves the host and races connections to its addresses.
+func (d *Dialer) dialTarget(ctx context.Context, hostport string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IPAddr{{IP: ip}}
+	} else {
+		ips, err = d.lookup().LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ips = interleaveAddrs(ips)
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return d.dialParallel(ctx, addrs)
+}
+
+// interleaveAddrs alternates IPv6 and IPv4 addresses, starting with the family
+// of the first address, as described in RFC 8305.
+func interleaveAddrs(ips []net.IPAddr) []net.IPAddr {
+	if len(ips) < 2 {
+		return ips
+	}
+	var v4, v6 []net.IPAddr
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	first, second := v6, v4
+	if ips[0].IP.To4() != nil {
+		first, second = v4, v6
+	}
+	out := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialParallel dials addresses in order, starting the next one after the fallback delay
+// or as soon as the previous one fails. It returns the first established connection.
+func (d *Dialer) dialParallel(ctx context.Context, addrs []string) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to dial")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	var (
+		next, running int
+		fallback      <-chan time.Time
+	)
+	start := func() {
+		addr := addrs[next]
+		next++
+		running++
+		go func() {
+			actx, acancel := context.WithTimeout(ctx, d.addrTimeout())
+			defer acancel()
+			conn, err := d.dialAddr(actx, addr)
+			select {
+			case results <- dialResult{conn: conn, err: err}:
+			case <-ctx.Done():
+				if conn != nil {
+					_ = conn.Close()
+				}
+			}
+		}()
+		fallback = nil
+		if next < len(addrs) {
+			fallback = time.After(d.fallbackDelay())
+		}
+	}
+	start()
+	var last error
+	for running > 0 {
+		select {
+		case r := <-results:
+			running--
+			if r.err == nil {
+				return r.conn, nil
+			}
+			last = r.err
+			if next < len(addrs) && ctx.Err() == nil {
+				start()
+			}
+		case <-fallback:
+			if ctx.Err() == nil {
+				start()
+			}
+		}
+	}
+	return nil, last
+}
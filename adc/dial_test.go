@@ -0,0 +1,152 @@
+package adc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testResolver struct {
+	srv map[string][]*net.SRV
+	ips map[string][]net.IPAddr
+}
+
+func (r *testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	key := "_" + service + "._" + proto + "." + name
+	srv, ok := r.srv[key]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return key, srv, nil
+}
+
+func (r *testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return ips, nil
+}
+
+// testDial records dialed addresses. Addresses in hang block until the dial is cancelled,
+// addresses in ok connect, and the rest are refused.
+type testDial struct {
+	mu     sync.Mutex
+	dialed []string
+	hang   map[string]bool
+	ok     map[string]bool
+}
+
+func (d *testDial) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, addr)
+	d.mu.Unlock()
+	switch {
+	case d.hang[addr]:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case d.ok[addr]:
+		c1, c2 := net.Pipe()
+		_ = c2.Close()
+		return c1, nil
+	}
+	return nil, errors.New("connection refused")
+}
+
+func (d *testDial) addrs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.dialed...)
+}
+
+func TestDialSRV(t *testing.T) {
+	r := &testResolver{
+		srv: map[string][]*net.SRV{
+			"_adc._tcp.example.org": {
+				{Target: "hub1.example.org.", Port: 1511, Priority: 1},
+				{Target: "hub2.example.org.", Port: 411, Priority: 2},
+			},
+		},
+		ips: map[string][]net.IPAddr{
+			"hub1.example.org": {{IP: net.ParseIP("10.0.0.1")}},
+			"hub2.example.org": {{IP: net.ParseIP("10.0.0.2")}},
+			"example.org":      {{IP: net.ParseIP("10.0.0.3")}},
+		},
+	}
+	td := &testDial{ok: map[string]bool{"10.0.0.2:411": true}}
+	d := &Dialer{resolver: r, dial: td.dial}
+
+	c, err := d.Dial("adc://example.org")
+	require.NoError(t, err)
+	_ = c.Close()
+	require.Equal(t, []string{"10.0.0.1:1511", "10.0.0.2:411"}, td.addrs())
+
+	// the port in the address disables SRV lookup
+	td.dialed = nil
+	_, err = d.Dial("adc://example.org:411")
+	require.Error(t, err)
+	require.Equal(t, []string{"10.0.0.3:411"}, td.addrs())
+
+	// no SRV records for the secure protocol
+	_, err = d.Dial("adcs://example.org")
+	require.Error(t, err)
+}
+
+func TestDialHappyEyeballs(t *testing.T) {
+	r := &testResolver{
+		ips: map[string][]net.IPAddr{
+			"hub.example.org": {
+				{IP: net.ParseIP("2001:db8::1")},
+				{IP: net.ParseIP("2001:db8::2")},
+				{IP: net.ParseIP("10.0.0.1")},
+			},
+		},
+	}
+	td := &testDial{
+		hang: map[string]bool{"[2001:db8::1]:411": true},
+		ok:   map[string]bool{"10.0.0.1:411": true},
+	}
+	d := &Dialer{resolver: r, dial: td.dial, FallbackDelay: 10 * time.Millisecond}
+
+	start := time.Now()
+	c, err := d.Dial("hub.example.org:411")
+	require.NoError(t, err)
+	_ = c.Close()
+	require.True(t, time.Since(start) < time.Second)
+	// address families are interleaved
+	require.Equal(t, []string{"[2001:db8::1]:411", "10.0.0.1:411"}, td.addrs())
+
+	// addresses that hang are abandoned after the timeout
+	td.dialed = nil
+	td.hang["10.0.0.1:411"] = true
+	td.ok["[2001:db8::2]:411"] = true
+	d.FallbackDelay = time.Minute
+	d.AddrTimeout = 10 * time.Millisecond
+	c, err = d.Dial("hub.example.org:411")
+	require.NoError(t, err)
+	_ = c.Close()
+	require.Equal(t, []string{"[2001:db8::1]:411", "10.0.0.1:411", "[2001:db8::2]:411"}, td.addrs())
+}
+
+func TestInterleaveAddrs(t *testing.T) {
+	ips := func(s ...string) []net.IPAddr {
+		var out []net.IPAddr
+		for _, v := range s {
+			out = append(out, net.IPAddr{IP: net.ParseIP(v)})
+		}
+		return out
+	}
+	require.Equal(t,
+		ips("10.0.0.1", "::1", "10.0.0.2", "::2", "10.0.0.3"),
+		interleaveAddrs(ips("10.0.0.1", "10.0.0.2", "10.0.0.3", "::1", "::2")),
+	)
+	require.Equal(t,
+		ips("::1", "10.0.0.1", "::2"),
+		interleaveAddrs(ips("::1", "::2", "10.0.0.1")),
+	)
+}
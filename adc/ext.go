@@ -25,10 +25,13 @@ var (
 
 	FeaADC0 = Feature{'A', 'D', 'C', '0'} // ADC over TLS for C-C
 	extNAT0 = Feature{'N', 'A', 'T', '0'} // NAT traversal for C-C
-	extASCH = Feature{'A', 'S', 'C', 'H'}
+	FeaASCH = Feature{'A', 'S', 'C', 'H'} // Extended search: modification dates and result attributes
 	extSUD1 = Feature{'S', 'U', 'D', '1'}
 	extSUDP = Feature{'S', 'U', 'D', 'P'}
-	extCCPM = Feature{'C', 'C', 'P', 'M'}
+	FeaCCPM = Feature{'C', 'C', 'P', 'M'} // Direct encrypted private messages
+	FeaHBRI = Feature{'H', 'B', 'R', 'I'} // Validation of both IPv4 and IPv6 addresses of dual-stack clients
+	FeaDLTA = Feature{'D', 'L', 'T', 'A'} // Delta user list for reconnecting clients
+	FeaLINF = Feature{'L', 'I', 'N', 'F'} // Lazy user list: minimal INF on login, full INF on request
 
 	// feature markers to indicate active mode
 
@@ -37,8 +40,10 @@ var (
 	// FeaTCP6 should be set in user's INF to indicate that the client has an open TCP6 port (is active).
 	FeaTCP6 = Feature{'T', 'C', 'P', '6'}
 
-	extUDP4 = Feature{'U', 'D', 'P', '4'}
-	extUDP6 = Feature{'U', 'D', 'P', '6'}
+	// FeaUDP4 should be set in user's INF to indicate that the client has an open UDP4 port for search results.
+	FeaUDP4 = Feature{'U', 'D', 'P', '4'}
+	// FeaUDP6 should be set in user's INF to indicate that the client has an open UDP6 port for search results.
+	FeaUDP6 = Feature{'U', 'D', 'P', '6'}
 )
 
 const (
@@ -0,0 +1,151 @@
+package adc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FeatureHandler is called when an extension becomes active on a connection.
+//
+// The session is a value passed to FeatureSet.Activate. For example, the hub passes its peer,
+// while the client may pass its connection.
+type FeatureHandler func(session interface{}) error
+
+// MissingFeatureError is returned when the peer does not support one of the required features.
+type MissingFeatureError struct {
+	// Features is a list of alternatives, one of which must be supported by both sides.
+	Features []Feature
+}
+
+func (e *MissingFeatureError) Error() string {
+	names := make([]string, 0, len(e.Features))
+	for _, f := range e.Features {
+		names = append(names, f.String())
+	}
+	return "peer does not support " + strings.Join(names, " or ")
+}
+
+// FeatureSet is a registry of ADC extensions supported by one side of the connection.
+//
+// It is used to advertise features in SUP, negotiate a mutual set of features with the peer
+// and to run handlers when optional extensions become active. It is safe for concurrent use.
+type FeatureSet struct {
+	mu       sync.RWMutex
+	features map[Feature][]FeatureHandler
+	required [][]Feature
+}
+
+// NewFeatureSet creates a set with a given list of optional features.
+func NewFeatureSet(features ...Feature) *FeatureSet {
+	s := &FeatureSet{features: make(map[Feature][]FeatureHandler)}
+	for _, f := range features {
+		s.features[f] = nil
+	}
+	return s
+}
+
+// Add declares support for an optional feature. Handlers are called when the feature becomes active.
+func (s *FeatureSet) Add(f Feature, onActive ...FeatureHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features[f] = append(s.features[f], onActive...)
+}
+
+// Require declares that at least one of the features must be supported by both sides.
+// All the features are added to the set.
+func (s *FeatureSet) Require(alts ...Feature) {
+	if len(alts) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range alts {
+		if _, ok := s.features[f]; !ok {
+			s.features[f] = nil
+		}
+	}
+	s.required = append(s.required, append([]Feature{}, alts...))
+}
+
+// OnActive registers an additional handler for a feature. The feature is added to the set if necessary.
+func (s *FeatureSet) OnActive(f Feature, fnc FeatureHandler) {
+	s.Add(f, fnc)
+}
+
+// Remove removes the feature from the set, including all its handlers.
+// It does not affect the required features.
+func (s *FeatureSet) Remove(f Feature) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.features, f)
+}
+
+// Has checks if the feature is in the set.
+func (s *FeatureSet) Has(f Feature) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.features[f]
+	return ok
+}
+
+// Features returns all the features in the set. The result can be sent in SUP message.
+func (s *FeatureSet) Features() ModFeatures {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(ModFeatures, len(s.features))
+	for f := range s.features {
+		out[f] = true
+	}
+	return out
+}
+
+// Negotiate intersects the set with features supported by the peer.
+// It returns MissingFeatureError if one of the required features is not supported by the peer.
+func (s *FeatureSet) Negotiate(peer ModFeatures) (ModFeatures, error) {
+	mutual := s.Features().Intersect(peer)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, alts := range s.required {
+		ok := false
+		for _, f := range alts {
+			if mutual.IsSet(f) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, &MissingFeatureError{Features: alts}
+		}
+	}
+	return mutual, nil
+}
+
+// Activate calls handlers for all features in a mutual set. Handlers are called in the order of
+// feature names. It stops on the first error.
+func (s *FeatureSet) Activate(mutual ModFeatures, session interface{}) error {
+	type active struct {
+		fea      Feature
+		handlers []FeatureHandler
+	}
+	var list []active
+	s.mu.RLock()
+	for f, on := range mutual {
+		if h := s.features[f]; on && len(h) != 0 {
+			list = append(list, active{fea: f, handlers: append([]FeatureHandler{}, h...)})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].fea.String() < list[j].fea.String()
+	})
+	for _, a := range list {
+		for _, fnc := range a.handlers {
+			if err := fnc(session); err != nil {
+				return fmt.Errorf("cannot activate %v: %v", a.fea, err)
+			}
+		}
+	}
+	return nil
+}
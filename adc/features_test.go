@@ -0,0 +1,55 @@
+package adc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestFeatureSet(t *testing.T) {
+	var active []string
+	onActive := func(name string) FeatureHandler {
+		return func(session interface{}) error {
+			active = append(active, name+":"+session.(string))
+			return nil
+		}
+	}
+
+	s := NewFeatureSet(FeaPING)
+	s.Require(FeaBASE, FeaBAS0)
+	s.Require(FeaTIGR)
+	s.Add(FeaZLIF, onActive("zlif"))
+	s.OnActive(FeaSEGA, onActive("sega"))
+	require.True(t, s.Has(FeaSEGA))
+	require.Equal(t, ModFeatures{
+		FeaPING: true, FeaBASE: true, FeaBAS0: true,
+		FeaTIGR: true, FeaZLIF: true, FeaSEGA: true,
+	}, s.Features())
+
+	_, err := s.Negotiate(ModFeatures{FeaBASE: true, FeaZLIF: true})
+	require.Equal(t, &MissingFeatureError{Features: []Feature{FeaTIGR}}, err)
+	require.Equal(t, "peer does not support TIGR", err.Error())
+
+	_, err = s.Negotiate(ModFeatures{FeaTIGR: true})
+	require.Equal(t, "peer does not support BASE or BAS0", err.Error())
+
+	mutual, err := s.Negotiate(ModFeatures{
+		FeaBAS0: true, FeaTIGR: true, FeaSEGA: true, FeaZLIF: true, FeaTS: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, ModFeatures{FeaBAS0: true, FeaTIGR: true, FeaSEGA: true, FeaZLIF: true}, mutual)
+
+	require.NoError(t, s.Activate(mutual, "peer"))
+	require.Equal(t, []string{"sega:peer", "zlif:peer"}, active)
+
+	s.Remove(FeaSEGA)
+	require.False(t, s.Has(FeaSEGA))
+
+	s.Add(FeaZLIF, func(session interface{}) error {
+		return errors.New("failed")
+	})
+	require.EqualError(t, s.Activate(mutual, "peer"), "cannot activate ZLIF: failed")
+}
@@ -0,0 +1,367 @@
+// Command adcgen generates static MarshalAdc and UnmarshalAdc methods for ADC messages.
+//
+// The generated code follows the same rules as the reflection-based codec in the adc package,
+// but avoids reflection and most of the allocations on the hot path.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+const adcPkg = "github.com/direct-connect/go-dcpp/adc"
+
+// messages is a list of types to generate the code for.
+var messages = []interface{}{
+	adc.User{},
+	adc.HubInfo{},
+	adc.UserCommand{},
+	adc.Password{},
+	adc.RevConnectRequest{},
+	adc.ConnectRequest{},
+	adc.GetInfoRequest{},
+	adc.GetRequest{},
+	adc.GetResponse{},
+	adc.SearchRequest{},
+	adc.SearchResult{},
+	adc.PartialResult{},
+	adc.ChatMessage{},
+	adc.Disconnect{},
+	adc.HybridBridge{},
+	adc.UserListSync{},
+	adc.UserInfoRequest{},
+	adc.PM{},
+}
+
+var (
+	reflMarshaler   = reflect.TypeOf((*adc.Marshaler)(nil)).Elem()
+	reflUnmarshaler = reflect.TypeOf((*adc.Unmarshaler)(nil)).Elem()
+)
+
+func main() {
+	out := flag.String("o", "messages_gen.go", "output file")
+	flag.Parse()
+
+	g := &generator{imports: make(map[string]string)}
+	for _, m := range messages {
+		if err := g.genType(reflect.TypeOf(m)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	data, err := g.source()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type field struct {
+	Name string
+	Tag  string // empty for positional fields
+	Req  bool
+	Type reflect.Type
+}
+
+func (f field) unmarshaler() bool {
+	return reflect.PtrTo(f.Type).Implements(reflUnmarshaler)
+}
+
+func (f field) multi() bool {
+	return !f.unmarshaler() && f.Type.Kind() == reflect.Slice
+}
+
+func structFields(rt reflect.Type) (pos, named []field, _ error) {
+	for i := 0; i < rt.NumField(); i++ {
+		fld := rt.Field(i)
+		sub := strings.SplitN(fld.Tag.Get(`adc`), ",", 2)
+		tag := sub[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		f := field{Name: fld.Name, Type: fld.Type, Req: len(sub) > 1 && sub[1] == "req"}
+		if tag == "#" {
+			if len(named) != 0 {
+				return nil, nil, fmt.Errorf("%v: positional field %s should go first", rt, fld.Name)
+			}
+			pos = append(pos, f)
+			continue
+		} else if len(tag) != 2 {
+			return nil, nil, fmt.Errorf("%v: invalid tag for field %s: %q", rt, fld.Name, tag)
+		}
+		f.Tag = tag
+		named = append(named, f)
+	}
+	return pos, named, nil
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]string // path -> name
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) source() ([]byte, error) {
+	var std, ext []string
+	for p := range g.imports {
+		if strings.Contains(p, ".") {
+			ext = append(ext, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(ext)
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("// Code generated by adcgen. DO NOT EDIT.\n\npackage adc\n\nimport (\n")
+	for _, p := range std {
+		fmt.Fprintf(buf, "\t%q\n", p)
+	}
+	buf.WriteString("\n")
+	for _, p := range ext {
+		fmt.Fprintf(buf, "\t%q\n", p)
+	}
+	buf.WriteString(")\n\n")
+	buf.Write(g.buf.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+func (g *generator) use(pkg string) {
+	g.imports[pkg] = path.Base(pkg)
+}
+
+func (g *generator) typeName(t reflect.Type) string {
+	if t.Name() == "" {
+		switch t.Kind() {
+		case reflect.Ptr:
+			return "*" + g.typeName(t.Elem())
+		case reflect.Slice:
+			return "[]" + g.typeName(t.Elem())
+		}
+		panic(fmt.Errorf("unsupported type: %v", t))
+	}
+	if t.PkgPath() == "" || t.PkgPath() == adcPkg {
+		return t.Name()
+	}
+	g.use(t.PkgPath())
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func (g *generator) genType(rt reflect.Type) error {
+	pos, named, err := structFields(rt)
+	if err != nil {
+		return err
+	}
+	g.use("fmt")
+	if err := g.genUnmarshal(rt, pos, named); err != nil {
+		return err
+	}
+	return g.genMarshal(rt, pos, named)
+}
+
+func fieldErr(name string) string {
+	return "return fmt.Errorf(\"error on field %s: %s\", " + strconv.Quote(name) + ", err)\n"
+}
+
+func (g *generator) genUnmarshal(rt reflect.Type, pos, named []field) error {
+	g.use("bytes")
+	g.printf("func (m *%s) UnmarshalAdc(data []byte) error {\n", rt.Name())
+	g.printf("sub := bytes.Split(data, []byte(\" \"))\n")
+	if n := len(pos); n != 0 {
+		if n > 1 {
+			// bytes.Split always returns at least one element
+			g.printf("if len(sub) < %d {\n", n)
+			g.printf("return fmt.Errorf(\"expected %d positional fields, got %%d\", len(sub))\n}\n", n)
+		}
+		for i, f := range pos {
+			if err := g.decode(f.Type, "m."+f.Name, fmt.Sprintf("sub[%d]", i), f.Name); err != nil {
+				return err
+			}
+		}
+		g.printf("sub = sub[%d:]\n", n)
+	}
+	if len(named) == 0 {
+		g.printf("_ = sub\nreturn nil\n}\n\n")
+		return nil
+	}
+	g.printf("var (\n")
+	for _, f := range named {
+		if f.multi() {
+			g.printf("vals%s %s\n", f.Name, g.typeName(f.Type))
+		} else {
+			g.printf("seen%s bool\n", f.Name)
+		}
+	}
+	g.printf(")\n")
+	g.printf("for _, v := range sub {\nif len(v) < 2 {\ncontinue\n}\nswitch string(v[:2]) {\n")
+	for _, f := range named {
+		g.printf("case %q:\n", f.Tag)
+		if f.multi() {
+			g.printf("var e %s\n", g.typeName(f.Type.Elem()))
+			if err := g.decode(f.Type.Elem(), "e", "v[2:]", f.Name); err != nil {
+				return err
+			}
+			g.printf("vals%s = append(vals%s, e)\n", f.Name, f.Name)
+			continue
+		}
+		g.printf("if seen%s {\n", f.Name)
+		if f.unmarshaler() {
+			// only the first value is used
+			g.printf("continue\n")
+		} else {
+			g.printf("return fmt.Errorf(\"error on field %%s: expected single value\", %q)\n", f.Name)
+		}
+		g.printf("}\nseen%s = true\n", f.Name)
+		if err := g.decode(f.Type, "m."+f.Name, "v[2:]", f.Name); err != nil {
+			return err
+		}
+	}
+	g.printf("}\n}\n")
+	for _, f := range named {
+		if f.multi() {
+			g.printf("if vals%s != nil {\nm.%s = vals%s\n}\n", f.Name, f.Name, f.Name)
+		}
+	}
+	g.printf("return nil\n}\n\n")
+	return nil
+}
+
+// decode emits the code to decode a value from src expression to the target expression.
+func (g *generator) decode(t reflect.Type, target, src, name string) error {
+	if reflect.PtrTo(t).Implements(reflUnmarshaler) {
+		g.printf("if err := %s.UnmarshalAdc(%s); err != nil {\n%s}\n", target, src, fieldErr(name))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if t.Name() == "string" {
+			g.printf("%s = unescape(%s)\n", target, src)
+		} else {
+			g.printf("%s = %s(unescape(%s))\n", target, g.typeName(t), src)
+		}
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16:
+		bits := 64
+		switch t.Kind() {
+		case reflect.Int32, reflect.Int16:
+			bits = 32
+		}
+		g.printf("if iv, err := parseInt(%s, %d); err != nil {\n%s} else {\n", src, bits, fieldErr(name))
+		g.printf("%s = %s(iv)\n}\n", target, g.typeName(t))
+	case reflect.Bool:
+		g.printf("if bv, err := parseBool(%s); err != nil {\n%s} else {\n", src, fieldErr(name))
+		g.printf("%s = %s(bv)\n}\n", target, g.typeName(t))
+	case reflect.Ptr:
+		g.printf("if len(%s) == 0 {\n%s = nil\n} else {\n", src, target)
+		g.printf("var pv %s\n", g.typeName(t.Elem()))
+		if err := g.decode(t.Elem(), "pv", src, name); err != nil {
+			return err
+		}
+		g.printf("%s = &pv\n}\n", target)
+	default:
+		return fmt.Errorf("field %s: unsupported type: %v", name, t)
+	}
+	return nil
+}
+
+func (g *generator) genMarshal(rt reflect.Type, pos, named []field) error {
+	g.printf("func (m %s) MarshalAdc() ([]byte, error) {\n", rt.Name())
+	g.printf("var w fieldWriter\n")
+	for _, f := range pos {
+		g.printf("w.field(\"\")\n")
+		if err := g.encode(f.Type, "m."+f.Name, f.Name); err != nil {
+			return err
+		}
+	}
+	for _, f := range named {
+		if !f.Type.Implements(reflMarshaler) && f.Type.Kind() == reflect.Slice {
+			g.printf("for _, e := range m.%s {\n", f.Name)
+			g.printf("w.field(%q)\n", f.Tag)
+			if err := g.encode(f.Type.Elem(), "e", f.Name); err != nil {
+				return err
+			}
+			g.printf("}\n")
+			continue
+		}
+		closing := false
+		if !f.Req {
+			cond, err := g.nonZero(f.Type, "m."+f.Name)
+			if err != nil {
+				return err
+			}
+			g.printf("if %s {\n", cond)
+			closing = true
+		}
+		g.printf("w.field(%q)\n", f.Tag)
+		if err := g.encode(f.Type, "m."+f.Name, f.Name); err != nil {
+			return err
+		}
+		if closing {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return w.buf, nil\n}\n\n")
+	return nil
+}
+
+func (g *generator) nonZero(t reflect.Type, expr string) (string, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return expr + ` != ""`, nil
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16:
+		return expr + " != 0", nil
+	case reflect.Bool:
+		return expr, nil
+	case reflect.Ptr, reflect.Slice:
+		return expr + " != nil", nil
+	case reflect.Array:
+		return expr + " != (" + g.typeName(t) + "{})", nil
+	}
+	return "", fmt.Errorf("unsupported type: %v", t)
+}
+
+// encode emits the code to encode a value of the expression into the field writer.
+func (g *generator) encode(t reflect.Type, expr, name string) error {
+	if t.Implements(reflMarshaler) {
+		if t.Kind() == reflect.Ptr {
+			g.printf("if %s != nil {\n", expr)
+			defer g.printf("}\n")
+		}
+		g.printf("if data, err := %s.MarshalAdc(); err != nil {\n", expr)
+		g.printf("return nil, fmt.Errorf(\"cannot marshal field %%s: %%v\", %q, err)\n", name)
+		g.printf("} else {\nw.buf = append(w.buf, data...)\n}\n")
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		g.printf("w.buf = appendEscaped(w.buf, string(%s))\n", expr)
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16:
+		g.use("strconv")
+		g.printf("w.buf = strconv.AppendInt(w.buf, int64(%s), 10)\n", expr)
+	case reflect.Bool:
+		g.printf("if %s {\nw.buf = append(w.buf, '1')\n} else {\nw.buf = append(w.buf, '0')\n}\n", expr)
+	case reflect.Ptr:
+		g.printf("if %s != nil {\n", expr)
+		if err := g.encode(t.Elem(), "(*"+expr+")", name); err != nil {
+			return err
+		}
+		g.printf("}\n")
+	default:
+		return fmt.Errorf("field %s: unsupported type: %v", name, t)
+	}
+	return nil
+}
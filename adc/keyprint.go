@@ -0,0 +1,37 @@
+package adc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const keyprintSHA256 = "SHA256/"
+
+var kpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Keyprint returns a keyprint of a DER-encoded certificate. It is used in the KP field
+// of INF and in the "kp" parameter of ADCS URLs.
+func Keyprint(cert []byte) string {
+	h := sha256.Sum256(cert)
+	return keyprintSHA256 + kpEncoding.EncodeToString(h[:])
+}
+
+// VerifyKeyprint checks that a DER-encoded certificate matches the keyprint.
+func VerifyKeyprint(kp string, cert []byte) error {
+	if !strings.HasPrefix(kp, keyprintSHA256) {
+		return fmt.Errorf("unsupported keyprint: %q", kp)
+	}
+	exp, err := kpEncoding.DecodeString(kp[len(keyprintSHA256):])
+	if err != nil {
+		return fmt.Errorf("invalid keyprint: %v", err)
+	}
+	h := sha256.Sum256(cert)
+	if subtle.ConstantTimeCompare(exp, h[:]) != 1 {
+		return errors.New("certificate doesn't match the keyprint")
+	}
+	return nil
+}
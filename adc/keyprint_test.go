@@ -0,0 +1,19 @@
+package adc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyprint(t *testing.T) {
+	cert := []byte("certificate")
+	kp := Keyprint(cert)
+	require.True(t, strings.HasPrefix(kp, "SHA256/"))
+	require.NotContains(t, kp, "=")
+	require.NoError(t, VerifyKeyprint(kp, cert))
+	require.Error(t, VerifyKeyprint(kp, []byte("other")))
+	require.Error(t, VerifyKeyprint("TTH/"+kp[len("SHA256/"):], cert))
+	require.Error(t, VerifyKeyprint("SHA256/!!!", cert))
+}
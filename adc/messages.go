@@ -12,6 +12,8 @@ import (
 	"github.com/direct-connect/go-dc/tiger"
 )
 
+//go:generate go run ./internal/adcgen -o messages_gen.go
+
 var (
 	messages = make(map[MsgType]reflect.Type)
 )
@@ -32,8 +34,12 @@ func init() {
 	RegisterMessage(GetResponse{})
 	RegisterMessage(SearchRequest{})
 	RegisterMessage(SearchResult{})
+	RegisterMessage(PartialResult{})
 	RegisterMessage(ChatMessage{})
 	RegisterMessage(Disconnect{})
+	RegisterMessage(HybridBridge{})
+	RegisterMessage(UserListSync{})
+	RegisterMessage(UserInfoRequest{})
 }
 
 type Message interface {
@@ -165,6 +171,9 @@ type Status struct {
 	Sev  Severity
 	Code int
 	Msg  string
+
+	// QueuePos is a position in the upload queue, sent with CodeSlotsFull (QP).
+	QueuePos int
 }
 
 func (Status) Cmd() MsgType {
@@ -179,7 +188,7 @@ func (st Status) Recoverable() bool {
 }
 func (st Status) Err() error {
 	if !st.Ok() {
-		if st.Code == 51 {
+		if st.Code == CodeFileNotAvailable {
 			return os.ErrNotExist
 		}
 		return Error{st}
@@ -195,13 +204,26 @@ func (st *Status) UnmarshalAdc(s []byte) error {
 	st.Code = code % 100
 	st.Sev = Severity(code / 100)
 	st.Msg = ""
-	if len(sub) > 1 {
-		st.Msg = unescape(sub[1])
+	st.QueuePos = 0
+	if len(sub) < 2 {
+		return nil
+	}
+	sub = bytes.Split(sub[1], []byte(" "))
+	st.Msg = unescape(sub[0])
+	for _, f := range sub[1:] {
+		if bytes.HasPrefix(f, []byte("QP")) {
+			if pos, err := strconv.Atoi(string(f[2:])); err == nil {
+				st.QueuePos = pos
+			}
+		}
 	}
 	return nil
 }
 func (st Status) MarshalAdc() ([]byte, error) {
 	s := fmt.Sprintf("%d%02d %s", int(st.Sev), st.Code, escape(st.Msg))
+	if st.QueuePos > 0 {
+		s += " QP" + strconv.Itoa(st.QueuePos)
+	}
 	return []byte(s), nil
 }
 
@@ -272,6 +294,11 @@ type User struct {
 	// our extensions
 
 	Address string `adc:"EA"`
+	// Locale is a preferred language of hub messages, for example "en" or "ru-RU".
+	Locale string `adc:"LC"`
+	// ListVersion is the user list version received in the previous session (DLTA extension).
+	// It's only sent to the hub and is never broadcast.
+	ListVersion string `adc:"LV"`
 }
 
 func (User) Cmd() MsgType {
@@ -476,6 +503,9 @@ type GetRequest struct {
 	Path  string `adc:"#"`
 	Start int64  `adc:"#"`
 	Bytes int64  `adc:"#"`
+
+	// Recursive is only valid for partial file lists.
+	Recursive bool `adc:"RE"`
 }
 
 func (GetRequest) Cmd() MsgType {
@@ -518,12 +548,37 @@ type SearchRequest struct {
 	// SEGA ext
 	Group ExtGroup `adc:"GR"`
 	NoExt []string `adc:"RX"`
+
+	// ASCH ext
+	MinDate int64 `adc:"MT"` // minimal modification time, unix seconds
+	MaxDate int64 `adc:"NT"` // maximal modification time, unix seconds
 }
 
 func (SearchRequest) Cmd() MsgType {
 	return MsgType{'S', 'C', 'H'}
 }
 
+// ExpandGroups returns a copy of the request for peers that don't support SEGA.
+// Extensions of the Group that are not excluded by NoExt are added to Ext.
+func (r SearchRequest) ExpandGroups() SearchRequest {
+	if r.Group == ExtNone {
+		return r
+	}
+	exclude := make(map[string]struct{}, len(r.NoExt))
+	for _, ext := range r.NoExt {
+		exclude[strings.ToLower(ext)] = struct{}{}
+	}
+	exts := append([]string{}, r.Ext...)
+	for _, ext := range r.Group.Exts() {
+		if _, ok := exclude[ext]; !ok {
+			exts = append(exts, ext)
+		}
+	}
+	r.Ext = exts
+	r.Group, r.NoExt = ExtNone, nil
+	return r
+}
+
 var _ Message = SearchResult{}
 
 type SearchResult struct {
@@ -534,12 +589,35 @@ type SearchResult struct {
 
 	// TIGR ext
 	TTH *TTH `adc:"TR"`
+
+	// ASCH ext
+	Date  int64 `adc:"DM"` // modification time of the file, unix seconds
+	Files int   `adc:"FI"` // number of files in the directory
+	Dirs  int   `adc:"FO"` // number of subdirectories in the directory
 }
 
 func (SearchResult) Cmd() MsgType {
 	return MsgType{'R', 'E', 'S'}
 }
 
+var _ Message = PartialResult{}
+
+// PartialResult advertises which parts of a file are available from a peer
+// that is still downloading it (partial file sharing).
+type PartialResult struct {
+	HubAddr string    `adc:"HI"`
+	Udp4    int       `adc:"U4"`
+	Udp6    int       `adc:"U6"`
+	TTH     *TTH      `adc:"TR"`
+	Count   int       `adc:"PC"`
+	Parts   PartsInfo `adc:"PI"`
+	Token   string    `adc:"TO"`
+}
+
+func (PartialResult) Cmd() MsgType {
+	return MsgType{'P', 'S', 'R'}
+}
+
 var (
 	_ Message = ChatMessage{}
 )
@@ -572,6 +650,55 @@ func (Disconnect) Cmd() MsgType {
 	return MsgType{'Q', 'U', 'I'}
 }
 
+var _ Message = HybridBridge{}
+
+// HybridBridge is used by the HBRI extension to validate the second IP address of a dual-stack client.
+//
+// The hub sends it with the address and the port of the hub for the other IP version.
+// The client connects to that address, negotiates features and sends it back with the same
+// token on the secondary connection. The hub replies with a status and closes the connection.
+type HybridBridge struct {
+	Ip4   string `adc:"I4"`
+	Ip6   string `adc:"I6"`
+	Port4 int    `adc:"P4"`
+	Port6 int    `adc:"P6"`
+	Token string `adc:"TO"`
+}
+
+func (HybridBridge) Cmd() MsgType {
+	return MsgType{'T', 'C', 'P'}
+}
+
+var _ Message = UserListSync{}
+
+// UserListSync is sent by the hub before the user list to clients that support the DLTA extension.
+//
+// Version identifies the state of the user list, and should be sent in the INF of the next session.
+// If Delta is set, the list only contains users that joined or changed since the version sent by
+// the client, followed by QUI for users that left. Otherwise, the full list is sent.
+type UserListSync struct {
+	Version string `adc:"LV"`
+	Delta   bool   `adc:"DL"`
+}
+
+func (UserListSync) Cmd() MsgType {
+	return MsgType{'U', 'L', 'S'}
+}
+
+var _ Message = UserInfoRequest{}
+
+// UserInfoRequest is sent by clients that support the LINF extension to get the full INF of users.
+//
+// The user list sent on login to such clients only contains the minimal info of each user.
+// The hub replies with the full INF of each requested user that is online.
+type UserInfoRequest struct {
+	Users []SID `adc:"SI"`
+}
+
+func (UserInfoRequest) Cmd() MsgType {
+	return MsgType{'U', 'I', 'R'}
+}
+
 var _ Message = HubInfo{}
 
 type HubInfo struct {
@@ -0,0 +1,1833 @@
+// Code generated by adcgen. DO NOT EDIT.
+
+package adc
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func (m *User) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenId             bool
+		seenPid            bool
+		seenName           bool
+		seenIp4            bool
+		seenIp6            bool
+		seenUdp4           bool
+		seenUdp6           bool
+		seenShareSize      bool
+		seenShareFiles     bool
+		seenVersion        bool
+		seenApplication    bool
+		seenMaxUpload      bool
+		seenMaxDownload    bool
+		seenSlots          bool
+		seenSlotsFree      bool
+		seenAutoSlotLimit  bool
+		seenEmail          bool
+		seenDesc           bool
+		seenHubsNormal     bool
+		seenHubsRegistered bool
+		seenHubsOperator   bool
+		seenToken          bool
+		seenType           bool
+		seenAway           bool
+		seenRef            bool
+		seenFeatures       bool
+		seenKP             bool
+		seenAddress        bool
+		seenLocale         bool
+		seenListVersion    bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "ID":
+			if seenId {
+				continue
+			}
+			seenId = true
+			if err := m.Id.UnmarshalAdc(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Id", err)
+			}
+		case "PD":
+			if seenPid {
+				return fmt.Errorf("error on field %s: expected single value", "Pid")
+			}
+			seenPid = true
+			if len(v[2:]) == 0 {
+				m.Pid = nil
+			} else {
+				var pv types.CID
+				if err := pv.UnmarshalAdc(v[2:]); err != nil {
+					return fmt.Errorf("error on field %s: %s", "Pid", err)
+				}
+				m.Pid = &pv
+			}
+		case "NI":
+			if seenName {
+				return fmt.Errorf("error on field %s: expected single value", "Name")
+			}
+			seenName = true
+			m.Name = unescape(v[2:])
+		case "I4":
+			if seenIp4 {
+				return fmt.Errorf("error on field %s: expected single value", "Ip4")
+			}
+			seenIp4 = true
+			m.Ip4 = unescape(v[2:])
+		case "I6":
+			if seenIp6 {
+				return fmt.Errorf("error on field %s: expected single value", "Ip6")
+			}
+			seenIp6 = true
+			m.Ip6 = unescape(v[2:])
+		case "U4":
+			if seenUdp4 {
+				return fmt.Errorf("error on field %s: expected single value", "Udp4")
+			}
+			seenUdp4 = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Udp4", err)
+			} else {
+				m.Udp4 = int(iv)
+			}
+		case "U6":
+			if seenUdp6 {
+				return fmt.Errorf("error on field %s: expected single value", "Udp6")
+			}
+			seenUdp6 = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Udp6", err)
+			} else {
+				m.Udp6 = int(iv)
+			}
+		case "SS":
+			if seenShareSize {
+				return fmt.Errorf("error on field %s: expected single value", "ShareSize")
+			}
+			seenShareSize = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "ShareSize", err)
+			} else {
+				m.ShareSize = int64(iv)
+			}
+		case "SF":
+			if seenShareFiles {
+				return fmt.Errorf("error on field %s: expected single value", "ShareFiles")
+			}
+			seenShareFiles = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "ShareFiles", err)
+			} else {
+				m.ShareFiles = int(iv)
+			}
+		case "VE":
+			if seenVersion {
+				return fmt.Errorf("error on field %s: expected single value", "Version")
+			}
+			seenVersion = true
+			m.Version = unescape(v[2:])
+		case "AP":
+			if seenApplication {
+				return fmt.Errorf("error on field %s: expected single value", "Application")
+			}
+			seenApplication = true
+			m.Application = unescape(v[2:])
+		case "US":
+			if seenMaxUpload {
+				return fmt.Errorf("error on field %s: expected single value", "MaxUpload")
+			}
+			seenMaxUpload = true
+			m.MaxUpload = unescape(v[2:])
+		case "DS":
+			if seenMaxDownload {
+				return fmt.Errorf("error on field %s: expected single value", "MaxDownload")
+			}
+			seenMaxDownload = true
+			m.MaxDownload = unescape(v[2:])
+		case "SL":
+			if seenSlots {
+				return fmt.Errorf("error on field %s: expected single value", "Slots")
+			}
+			seenSlots = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Slots", err)
+			} else {
+				m.Slots = int(iv)
+			}
+		case "FS":
+			if seenSlotsFree {
+				return fmt.Errorf("error on field %s: expected single value", "SlotsFree")
+			}
+			seenSlotsFree = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "SlotsFree", err)
+			} else {
+				m.SlotsFree = int(iv)
+			}
+		case "AS":
+			if seenAutoSlotLimit {
+				return fmt.Errorf("error on field %s: expected single value", "AutoSlotLimit")
+			}
+			seenAutoSlotLimit = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "AutoSlotLimit", err)
+			} else {
+				m.AutoSlotLimit = int(iv)
+			}
+		case "EM":
+			if seenEmail {
+				return fmt.Errorf("error on field %s: expected single value", "Email")
+			}
+			seenEmail = true
+			m.Email = unescape(v[2:])
+		case "DE":
+			if seenDesc {
+				return fmt.Errorf("error on field %s: expected single value", "Desc")
+			}
+			seenDesc = true
+			m.Desc = unescape(v[2:])
+		case "HN":
+			if seenHubsNormal {
+				return fmt.Errorf("error on field %s: expected single value", "HubsNormal")
+			}
+			seenHubsNormal = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "HubsNormal", err)
+			} else {
+				m.HubsNormal = int(iv)
+			}
+		case "HR":
+			if seenHubsRegistered {
+				return fmt.Errorf("error on field %s: expected single value", "HubsRegistered")
+			}
+			seenHubsRegistered = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "HubsRegistered", err)
+			} else {
+				m.HubsRegistered = int(iv)
+			}
+		case "HO":
+			if seenHubsOperator {
+				return fmt.Errorf("error on field %s: expected single value", "HubsOperator")
+			}
+			seenHubsOperator = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "HubsOperator", err)
+			} else {
+				m.HubsOperator = int(iv)
+			}
+		case "TO":
+			if seenToken {
+				return fmt.Errorf("error on field %s: expected single value", "Token")
+			}
+			seenToken = true
+			m.Token = unescape(v[2:])
+		case "CT":
+			if seenType {
+				return fmt.Errorf("error on field %s: expected single value", "Type")
+			}
+			seenType = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Type", err)
+			} else {
+				m.Type = UserType(iv)
+			}
+		case "AW":
+			if seenAway {
+				return fmt.Errorf("error on field %s: expected single value", "Away")
+			}
+			seenAway = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Away", err)
+			} else {
+				m.Away = AwayType(iv)
+			}
+		case "RF":
+			if seenRef {
+				return fmt.Errorf("error on field %s: expected single value", "Ref")
+			}
+			seenRef = true
+			m.Ref = unescape(v[2:])
+		case "SU":
+			if seenFeatures {
+				continue
+			}
+			seenFeatures = true
+			if err := m.Features.UnmarshalAdc(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Features", err)
+			}
+		case "KP":
+			if seenKP {
+				return fmt.Errorf("error on field %s: expected single value", "KP")
+			}
+			seenKP = true
+			m.KP = unescape(v[2:])
+		case "EA":
+			if seenAddress {
+				return fmt.Errorf("error on field %s: expected single value", "Address")
+			}
+			seenAddress = true
+			m.Address = unescape(v[2:])
+		case "LC":
+			if seenLocale {
+				return fmt.Errorf("error on field %s: expected single value", "Locale")
+			}
+			seenLocale = true
+			m.Locale = unescape(v[2:])
+		case "LV":
+			if seenListVersion {
+				return fmt.Errorf("error on field %s: expected single value", "ListVersion")
+			}
+			seenListVersion = true
+			m.ListVersion = unescape(v[2:])
+		}
+	}
+	return nil
+}
+
+func (m User) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	if m.Id != (types.CID{}) {
+		w.field("ID")
+		if data, err := m.Id.MarshalAdc(); err != nil {
+			return nil, fmt.Errorf("cannot marshal field %s: %v", "Id", err)
+		} else {
+			w.buf = append(w.buf, data...)
+		}
+	}
+	if m.Pid != nil {
+		w.field("PD")
+		if m.Pid != nil {
+			if data, err := m.Pid.MarshalAdc(); err != nil {
+				return nil, fmt.Errorf("cannot marshal field %s: %v", "Pid", err)
+			} else {
+				w.buf = append(w.buf, data...)
+			}
+		}
+	}
+	w.field("NI")
+	w.buf = appendEscaped(w.buf, string(m.Name))
+	if m.Ip4 != "" {
+		w.field("I4")
+		w.buf = appendEscaped(w.buf, string(m.Ip4))
+	}
+	if m.Ip6 != "" {
+		w.field("I6")
+		w.buf = appendEscaped(w.buf, string(m.Ip6))
+	}
+	if m.Udp4 != 0 {
+		w.field("U4")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Udp4), 10)
+	}
+	if m.Udp6 != 0 {
+		w.field("U6")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Udp6), 10)
+	}
+	w.field("SS")
+	w.buf = strconv.AppendInt(w.buf, int64(m.ShareSize), 10)
+	w.field("SF")
+	w.buf = strconv.AppendInt(w.buf, int64(m.ShareFiles), 10)
+	w.field("VE")
+	w.buf = appendEscaped(w.buf, string(m.Version))
+	if m.Application != "" {
+		w.field("AP")
+		w.buf = appendEscaped(w.buf, string(m.Application))
+	}
+	if m.MaxUpload != "" {
+		w.field("US")
+		w.buf = appendEscaped(w.buf, string(m.MaxUpload))
+	}
+	if m.MaxDownload != "" {
+		w.field("DS")
+		w.buf = appendEscaped(w.buf, string(m.MaxDownload))
+	}
+	w.field("SL")
+	w.buf = strconv.AppendInt(w.buf, int64(m.Slots), 10)
+	w.field("FS")
+	w.buf = strconv.AppendInt(w.buf, int64(m.SlotsFree), 10)
+	if m.AutoSlotLimit != 0 {
+		w.field("AS")
+		w.buf = strconv.AppendInt(w.buf, int64(m.AutoSlotLimit), 10)
+	}
+	if m.Email != "" {
+		w.field("EM")
+		w.buf = appendEscaped(w.buf, string(m.Email))
+	}
+	if m.Desc != "" {
+		w.field("DE")
+		w.buf = appendEscaped(w.buf, string(m.Desc))
+	}
+	w.field("HN")
+	w.buf = strconv.AppendInt(w.buf, int64(m.HubsNormal), 10)
+	w.field("HR")
+	w.buf = strconv.AppendInt(w.buf, int64(m.HubsRegistered), 10)
+	w.field("HO")
+	w.buf = strconv.AppendInt(w.buf, int64(m.HubsOperator), 10)
+	if m.Token != "" {
+		w.field("TO")
+		w.buf = appendEscaped(w.buf, string(m.Token))
+	}
+	if m.Type != 0 {
+		w.field("CT")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Type), 10)
+	}
+	if m.Away != 0 {
+		w.field("AW")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Away), 10)
+	}
+	if m.Ref != "" {
+		w.field("RF")
+		w.buf = appendEscaped(w.buf, string(m.Ref))
+	}
+	w.field("SU")
+	if data, err := m.Features.MarshalAdc(); err != nil {
+		return nil, fmt.Errorf("cannot marshal field %s: %v", "Features", err)
+	} else {
+		w.buf = append(w.buf, data...)
+	}
+	if m.KP != "" {
+		w.field("KP")
+		w.buf = appendEscaped(w.buf, string(m.KP))
+	}
+	if m.Address != "" {
+		w.field("EA")
+		w.buf = appendEscaped(w.buf, string(m.Address))
+	}
+	if m.Locale != "" {
+		w.field("LC")
+		w.buf = appendEscaped(w.buf, string(m.Locale))
+	}
+	if m.ListVersion != "" {
+		w.field("LV")
+		w.buf = appendEscaped(w.buf, string(m.ListVersion))
+	}
+	return w.buf, nil
+}
+
+func (m *HubInfo) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenName        bool
+		seenVersion     bool
+		seenApplication bool
+		seenDesc        bool
+		seenType        bool
+		seenAddress     bool
+		seenWebsite     bool
+		seenNetwork     bool
+		seenOwner       bool
+		seenUsers       bool
+		seenShare       bool
+		seenFiles       bool
+		seenMinShare    bool
+		seenMaxShare    bool
+		seenMinSlots    bool
+		seenMaxSlots    bool
+		seenUsersLimit  bool
+		seenUptime      bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "NI":
+			if seenName {
+				return fmt.Errorf("error on field %s: expected single value", "Name")
+			}
+			seenName = true
+			m.Name = unescape(v[2:])
+		case "VE":
+			if seenVersion {
+				return fmt.Errorf("error on field %s: expected single value", "Version")
+			}
+			seenVersion = true
+			m.Version = unescape(v[2:])
+		case "AP":
+			if seenApplication {
+				return fmt.Errorf("error on field %s: expected single value", "Application")
+			}
+			seenApplication = true
+			m.Application = unescape(v[2:])
+		case "DE":
+			if seenDesc {
+				return fmt.Errorf("error on field %s: expected single value", "Desc")
+			}
+			seenDesc = true
+			m.Desc = unescape(v[2:])
+		case "CT":
+			if seenType {
+				return fmt.Errorf("error on field %s: expected single value", "Type")
+			}
+			seenType = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Type", err)
+			} else {
+				m.Type = UserType(iv)
+			}
+		case "HH":
+			if seenAddress {
+				return fmt.Errorf("error on field %s: expected single value", "Address")
+			}
+			seenAddress = true
+			m.Address = unescape(v[2:])
+		case "WS":
+			if seenWebsite {
+				return fmt.Errorf("error on field %s: expected single value", "Website")
+			}
+			seenWebsite = true
+			m.Website = unescape(v[2:])
+		case "NE":
+			if seenNetwork {
+				return fmt.Errorf("error on field %s: expected single value", "Network")
+			}
+			seenNetwork = true
+			m.Network = unescape(v[2:])
+		case "OW":
+			if seenOwner {
+				return fmt.Errorf("error on field %s: expected single value", "Owner")
+			}
+			seenOwner = true
+			m.Owner = unescape(v[2:])
+		case "UC":
+			if seenUsers {
+				return fmt.Errorf("error on field %s: expected single value", "Users")
+			}
+			seenUsers = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Users", err)
+			} else {
+				m.Users = int(iv)
+			}
+		case "SS":
+			if seenShare {
+				return fmt.Errorf("error on field %s: expected single value", "Share")
+			}
+			seenShare = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Share", err)
+			} else {
+				m.Share = int(iv)
+			}
+		case "SF":
+			if seenFiles {
+				return fmt.Errorf("error on field %s: expected single value", "Files")
+			}
+			seenFiles = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Files", err)
+			} else {
+				m.Files = int(iv)
+			}
+		case "MS":
+			if seenMinShare {
+				return fmt.Errorf("error on field %s: expected single value", "MinShare")
+			}
+			seenMinShare = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "MinShare", err)
+			} else {
+				m.MinShare = int(iv)
+			}
+		case "XS":
+			if seenMaxShare {
+				return fmt.Errorf("error on field %s: expected single value", "MaxShare")
+			}
+			seenMaxShare = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "MaxShare", err)
+			} else {
+				m.MaxShare = int64(iv)
+			}
+		case "ML":
+			if seenMinSlots {
+				return fmt.Errorf("error on field %s: expected single value", "MinSlots")
+			}
+			seenMinSlots = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "MinSlots", err)
+			} else {
+				m.MinSlots = int(iv)
+			}
+		case "XL":
+			if seenMaxSlots {
+				return fmt.Errorf("error on field %s: expected single value", "MaxSlots")
+			}
+			seenMaxSlots = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "MaxSlots", err)
+			} else {
+				m.MaxSlots = int(iv)
+			}
+		case "MC":
+			if seenUsersLimit {
+				return fmt.Errorf("error on field %s: expected single value", "UsersLimit")
+			}
+			seenUsersLimit = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "UsersLimit", err)
+			} else {
+				m.UsersLimit = int(iv)
+			}
+		case "UP":
+			if seenUptime {
+				return fmt.Errorf("error on field %s: expected single value", "Uptime")
+			}
+			seenUptime = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Uptime", err)
+			} else {
+				m.Uptime = int(iv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m HubInfo) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("NI")
+	w.buf = appendEscaped(w.buf, string(m.Name))
+	w.field("VE")
+	w.buf = appendEscaped(w.buf, string(m.Version))
+	if m.Application != "" {
+		w.field("AP")
+		w.buf = appendEscaped(w.buf, string(m.Application))
+	}
+	if m.Desc != "" {
+		w.field("DE")
+		w.buf = appendEscaped(w.buf, string(m.Desc))
+	}
+	if m.Type != 0 {
+		w.field("CT")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Type), 10)
+	}
+	if m.Address != "" {
+		w.field("HH")
+		w.buf = appendEscaped(w.buf, string(m.Address))
+	}
+	if m.Website != "" {
+		w.field("WS")
+		w.buf = appendEscaped(w.buf, string(m.Website))
+	}
+	if m.Network != "" {
+		w.field("NE")
+		w.buf = appendEscaped(w.buf, string(m.Network))
+	}
+	if m.Owner != "" {
+		w.field("OW")
+		w.buf = appendEscaped(w.buf, string(m.Owner))
+	}
+	if m.Users != 0 {
+		w.field("UC")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Users), 10)
+	}
+	if m.Share != 0 {
+		w.field("SS")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Share), 10)
+	}
+	if m.Files != 0 {
+		w.field("SF")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Files), 10)
+	}
+	if m.MinShare != 0 {
+		w.field("MS")
+		w.buf = strconv.AppendInt(w.buf, int64(m.MinShare), 10)
+	}
+	if m.MaxShare != 0 {
+		w.field("XS")
+		w.buf = strconv.AppendInt(w.buf, int64(m.MaxShare), 10)
+	}
+	if m.MinSlots != 0 {
+		w.field("ML")
+		w.buf = strconv.AppendInt(w.buf, int64(m.MinSlots), 10)
+	}
+	if m.MaxSlots != 0 {
+		w.field("XL")
+		w.buf = strconv.AppendInt(w.buf, int64(m.MaxSlots), 10)
+	}
+	if m.UsersLimit != 0 {
+		w.field("MC")
+		w.buf = strconv.AppendInt(w.buf, int64(m.UsersLimit), 10)
+	}
+	if m.Uptime != 0 {
+		w.field("UP")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Uptime), 10)
+	}
+	return w.buf, nil
+}
+
+func (m *UserCommand) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if err := m.Path.UnmarshalAdc(sub[0]); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Path", err)
+	}
+	sub = sub[1:]
+	var (
+		seenCommand     bool
+		seenCategory    bool
+		seenRemove      bool
+		seenConstrained bool
+		seenSeparator   bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "TT":
+			if seenCommand {
+				return fmt.Errorf("error on field %s: expected single value", "Command")
+			}
+			seenCommand = true
+			m.Command = unescape(v[2:])
+		case "CT":
+			if seenCategory {
+				return fmt.Errorf("error on field %s: expected single value", "Category")
+			}
+			seenCategory = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Category", err)
+			} else {
+				m.Category = Category(iv)
+			}
+		case "RM":
+			if seenRemove {
+				return fmt.Errorf("error on field %s: expected single value", "Remove")
+			}
+			seenRemove = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Remove", err)
+			} else {
+				m.Remove = int(iv)
+			}
+		case "CO":
+			if seenConstrained {
+				return fmt.Errorf("error on field %s: expected single value", "Constrained")
+			}
+			seenConstrained = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Constrained", err)
+			} else {
+				m.Constrained = int(iv)
+			}
+		case "SP":
+			if seenSeparator {
+				return fmt.Errorf("error on field %s: expected single value", "Separator")
+			}
+			seenSeparator = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Separator", err)
+			} else {
+				m.Separator = int(iv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m UserCommand) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	if data, err := m.Path.MarshalAdc(); err != nil {
+		return nil, fmt.Errorf("cannot marshal field %s: %v", "Path", err)
+	} else {
+		w.buf = append(w.buf, data...)
+	}
+	if m.Command != "" {
+		w.field("TT")
+		w.buf = appendEscaped(w.buf, string(m.Command))
+	}
+	if m.Category != 0 {
+		w.field("CT")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Category), 10)
+	}
+	if m.Remove != 0 {
+		w.field("RM")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Remove), 10)
+	}
+	if m.Constrained != 0 {
+		w.field("CO")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Constrained), 10)
+	}
+	if m.Separator != 0 {
+		w.field("SP")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Separator), 10)
+	}
+	return w.buf, nil
+}
+
+func (m *Password) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if err := m.Hash.UnmarshalAdc(sub[0]); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Hash", err)
+	}
+	sub = sub[1:]
+	_ = sub
+	return nil
+}
+
+func (m Password) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	if data, err := m.Hash.MarshalAdc(); err != nil {
+		return nil, fmt.Errorf("cannot marshal field %s: %v", "Hash", err)
+	} else {
+		w.buf = append(w.buf, data...)
+	}
+	return w.buf, nil
+}
+
+func (m *RevConnectRequest) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if len(sub) < 2 {
+		return fmt.Errorf("expected 2 positional fields, got %d", len(sub))
+	}
+	m.Proto = unescape(sub[0])
+	m.Token = unescape(sub[1])
+	sub = sub[2:]
+	_ = sub
+	return nil
+}
+
+func (m RevConnectRequest) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Proto))
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Token))
+	return w.buf, nil
+}
+
+func (m *ConnectRequest) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if len(sub) < 3 {
+		return fmt.Errorf("expected 3 positional fields, got %d", len(sub))
+	}
+	m.Proto = unescape(sub[0])
+	if iv, err := parseInt(sub[1], 64); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Port", err)
+	} else {
+		m.Port = int(iv)
+	}
+	m.Token = unescape(sub[2])
+	sub = sub[3:]
+	_ = sub
+	return nil
+}
+
+func (m ConnectRequest) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Proto))
+	w.field("")
+	w.buf = strconv.AppendInt(w.buf, int64(m.Port), 10)
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Token))
+	return w.buf, nil
+}
+
+func (m *GetInfoRequest) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if len(sub) < 2 {
+		return fmt.Errorf("expected 2 positional fields, got %d", len(sub))
+	}
+	m.Type = unescape(sub[0])
+	m.Path = unescape(sub[1])
+	sub = sub[2:]
+	_ = sub
+	return nil
+}
+
+func (m GetInfoRequest) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Type))
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Path))
+	return w.buf, nil
+}
+
+func (m *GetRequest) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if len(sub) < 4 {
+		return fmt.Errorf("expected 4 positional fields, got %d", len(sub))
+	}
+	m.Type = unescape(sub[0])
+	m.Path = unescape(sub[1])
+	if iv, err := parseInt(sub[2], 64); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Start", err)
+	} else {
+		m.Start = int64(iv)
+	}
+	if iv, err := parseInt(sub[3], 64); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Bytes", err)
+	} else {
+		m.Bytes = int64(iv)
+	}
+	sub = sub[4:]
+	var (
+		seenRecursive bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "RE":
+			if seenRecursive {
+				return fmt.Errorf("error on field %s: expected single value", "Recursive")
+			}
+			seenRecursive = true
+			if bv, err := parseBool(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Recursive", err)
+			} else {
+				m.Recursive = bool(bv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m GetRequest) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Type))
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Path))
+	w.field("")
+	w.buf = strconv.AppendInt(w.buf, int64(m.Start), 10)
+	w.field("")
+	w.buf = strconv.AppendInt(w.buf, int64(m.Bytes), 10)
+	if m.Recursive {
+		w.field("RE")
+		if m.Recursive {
+			w.buf = append(w.buf, '1')
+		} else {
+			w.buf = append(w.buf, '0')
+		}
+	}
+	return w.buf, nil
+}
+
+func (m *GetResponse) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if len(sub) < 4 {
+		return fmt.Errorf("expected 4 positional fields, got %d", len(sub))
+	}
+	m.Type = unescape(sub[0])
+	m.Path = unescape(sub[1])
+	if iv, err := parseInt(sub[2], 64); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Start", err)
+	} else {
+		m.Start = int64(iv)
+	}
+	if iv, err := parseInt(sub[3], 64); err != nil {
+		return fmt.Errorf("error on field %s: %s", "Bytes", err)
+	} else {
+		m.Bytes = int64(iv)
+	}
+	sub = sub[4:]
+	var (
+		seenRecursive bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "RE":
+			if seenRecursive {
+				return fmt.Errorf("error on field %s: expected single value", "Recursive")
+			}
+			seenRecursive = true
+			if bv, err := parseBool(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Recursive", err)
+			} else {
+				m.Recursive = bool(bv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m GetResponse) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Type))
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Path))
+	w.field("")
+	w.buf = strconv.AppendInt(w.buf, int64(m.Start), 10)
+	w.field("")
+	w.buf = strconv.AppendInt(w.buf, int64(m.Bytes), 10)
+	if m.Recursive {
+		w.field("RE")
+		if m.Recursive {
+			w.buf = append(w.buf, '1')
+		} else {
+			w.buf = append(w.buf, '0')
+		}
+	}
+	return w.buf, nil
+}
+
+func (m *SearchRequest) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenToken   bool
+		valsAnd     []string
+		valsNot     []string
+		valsExt     []string
+		seenLe      bool
+		seenGe      bool
+		seenEq      bool
+		seenType    bool
+		seenTTH     bool
+		seenGroup   bool
+		valsNoExt   []string
+		seenMinDate bool
+		seenMaxDate bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "TO":
+			if seenToken {
+				return fmt.Errorf("error on field %s: expected single value", "Token")
+			}
+			seenToken = true
+			m.Token = unescape(v[2:])
+		case "AN":
+			var e string
+			e = unescape(v[2:])
+			valsAnd = append(valsAnd, e)
+		case "NO":
+			var e string
+			e = unescape(v[2:])
+			valsNot = append(valsNot, e)
+		case "EX":
+			var e string
+			e = unescape(v[2:])
+			valsExt = append(valsExt, e)
+		case "LE":
+			if seenLe {
+				return fmt.Errorf("error on field %s: expected single value", "Le")
+			}
+			seenLe = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Le", err)
+			} else {
+				m.Le = int64(iv)
+			}
+		case "GE":
+			if seenGe {
+				return fmt.Errorf("error on field %s: expected single value", "Ge")
+			}
+			seenGe = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Ge", err)
+			} else {
+				m.Ge = int64(iv)
+			}
+		case "EQ":
+			if seenEq {
+				return fmt.Errorf("error on field %s: expected single value", "Eq")
+			}
+			seenEq = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Eq", err)
+			} else {
+				m.Eq = int64(iv)
+			}
+		case "TY":
+			if seenType {
+				return fmt.Errorf("error on field %s: expected single value", "Type")
+			}
+			seenType = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Type", err)
+			} else {
+				m.Type = FileType(iv)
+			}
+		case "TR":
+			if seenTTH {
+				return fmt.Errorf("error on field %s: expected single value", "TTH")
+			}
+			seenTTH = true
+			if len(v[2:]) == 0 {
+				m.TTH = nil
+			} else {
+				var pv tiger.Hash
+				if err := pv.UnmarshalAdc(v[2:]); err != nil {
+					return fmt.Errorf("error on field %s: %s", "TTH", err)
+				}
+				m.TTH = &pv
+			}
+		case "GR":
+			if seenGroup {
+				return fmt.Errorf("error on field %s: expected single value", "Group")
+			}
+			seenGroup = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Group", err)
+			} else {
+				m.Group = ExtGroup(iv)
+			}
+		case "RX":
+			var e string
+			e = unescape(v[2:])
+			valsNoExt = append(valsNoExt, e)
+		case "MT":
+			if seenMinDate {
+				return fmt.Errorf("error on field %s: expected single value", "MinDate")
+			}
+			seenMinDate = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "MinDate", err)
+			} else {
+				m.MinDate = int64(iv)
+			}
+		case "NT":
+			if seenMaxDate {
+				return fmt.Errorf("error on field %s: expected single value", "MaxDate")
+			}
+			seenMaxDate = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "MaxDate", err)
+			} else {
+				m.MaxDate = int64(iv)
+			}
+		}
+	}
+	if valsAnd != nil {
+		m.And = valsAnd
+	}
+	if valsNot != nil {
+		m.Not = valsNot
+	}
+	if valsExt != nil {
+		m.Ext = valsExt
+	}
+	if valsNoExt != nil {
+		m.NoExt = valsNoExt
+	}
+	return nil
+}
+
+func (m SearchRequest) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	if m.Token != "" {
+		w.field("TO")
+		w.buf = appendEscaped(w.buf, string(m.Token))
+	}
+	for _, e := range m.And {
+		w.field("AN")
+		w.buf = appendEscaped(w.buf, string(e))
+	}
+	for _, e := range m.Not {
+		w.field("NO")
+		w.buf = appendEscaped(w.buf, string(e))
+	}
+	for _, e := range m.Ext {
+		w.field("EX")
+		w.buf = appendEscaped(w.buf, string(e))
+	}
+	if m.Le != 0 {
+		w.field("LE")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Le), 10)
+	}
+	if m.Ge != 0 {
+		w.field("GE")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Ge), 10)
+	}
+	if m.Eq != 0 {
+		w.field("EQ")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Eq), 10)
+	}
+	if m.Type != 0 {
+		w.field("TY")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Type), 10)
+	}
+	if m.TTH != nil {
+		w.field("TR")
+		if m.TTH != nil {
+			if data, err := m.TTH.MarshalAdc(); err != nil {
+				return nil, fmt.Errorf("cannot marshal field %s: %v", "TTH", err)
+			} else {
+				w.buf = append(w.buf, data...)
+			}
+		}
+	}
+	if m.Group != 0 {
+		w.field("GR")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Group), 10)
+	}
+	for _, e := range m.NoExt {
+		w.field("RX")
+		w.buf = appendEscaped(w.buf, string(e))
+	}
+	if m.MinDate != 0 {
+		w.field("MT")
+		w.buf = strconv.AppendInt(w.buf, int64(m.MinDate), 10)
+	}
+	if m.MaxDate != 0 {
+		w.field("NT")
+		w.buf = strconv.AppendInt(w.buf, int64(m.MaxDate), 10)
+	}
+	return w.buf, nil
+}
+
+func (m *SearchResult) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenToken bool
+		seenPath  bool
+		seenSize  bool
+		seenSlots bool
+		seenTTH   bool
+		seenDate  bool
+		seenFiles bool
+		seenDirs  bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "TO":
+			if seenToken {
+				return fmt.Errorf("error on field %s: expected single value", "Token")
+			}
+			seenToken = true
+			m.Token = unescape(v[2:])
+		case "FN":
+			if seenPath {
+				return fmt.Errorf("error on field %s: expected single value", "Path")
+			}
+			seenPath = true
+			m.Path = unescape(v[2:])
+		case "SI":
+			if seenSize {
+				return fmt.Errorf("error on field %s: expected single value", "Size")
+			}
+			seenSize = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Size", err)
+			} else {
+				m.Size = int64(iv)
+			}
+		case "SL":
+			if seenSlots {
+				return fmt.Errorf("error on field %s: expected single value", "Slots")
+			}
+			seenSlots = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Slots", err)
+			} else {
+				m.Slots = int(iv)
+			}
+		case "TR":
+			if seenTTH {
+				return fmt.Errorf("error on field %s: expected single value", "TTH")
+			}
+			seenTTH = true
+			if len(v[2:]) == 0 {
+				m.TTH = nil
+			} else {
+				var pv tiger.Hash
+				if err := pv.UnmarshalAdc(v[2:]); err != nil {
+					return fmt.Errorf("error on field %s: %s", "TTH", err)
+				}
+				m.TTH = &pv
+			}
+		case "DM":
+			if seenDate {
+				return fmt.Errorf("error on field %s: expected single value", "Date")
+			}
+			seenDate = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Date", err)
+			} else {
+				m.Date = int64(iv)
+			}
+		case "FI":
+			if seenFiles {
+				return fmt.Errorf("error on field %s: expected single value", "Files")
+			}
+			seenFiles = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Files", err)
+			} else {
+				m.Files = int(iv)
+			}
+		case "FO":
+			if seenDirs {
+				return fmt.Errorf("error on field %s: expected single value", "Dirs")
+			}
+			seenDirs = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Dirs", err)
+			} else {
+				m.Dirs = int(iv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m SearchResult) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	if m.Token != "" {
+		w.field("TO")
+		w.buf = appendEscaped(w.buf, string(m.Token))
+	}
+	if m.Path != "" {
+		w.field("FN")
+		w.buf = appendEscaped(w.buf, string(m.Path))
+	}
+	if m.Size != 0 {
+		w.field("SI")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Size), 10)
+	}
+	if m.Slots != 0 {
+		w.field("SL")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Slots), 10)
+	}
+	if m.TTH != nil {
+		w.field("TR")
+		if m.TTH != nil {
+			if data, err := m.TTH.MarshalAdc(); err != nil {
+				return nil, fmt.Errorf("cannot marshal field %s: %v", "TTH", err)
+			} else {
+				w.buf = append(w.buf, data...)
+			}
+		}
+	}
+	if m.Date != 0 {
+		w.field("DM")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Date), 10)
+	}
+	if m.Files != 0 {
+		w.field("FI")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Files), 10)
+	}
+	if m.Dirs != 0 {
+		w.field("FO")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Dirs), 10)
+	}
+	return w.buf, nil
+}
+
+func (m *PartialResult) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenHubAddr bool
+		seenUdp4    bool
+		seenUdp6    bool
+		seenTTH     bool
+		seenCount   bool
+		seenParts   bool
+		seenToken   bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "HI":
+			if seenHubAddr {
+				return fmt.Errorf("error on field %s: expected single value", "HubAddr")
+			}
+			seenHubAddr = true
+			m.HubAddr = unescape(v[2:])
+		case "U4":
+			if seenUdp4 {
+				return fmt.Errorf("error on field %s: expected single value", "Udp4")
+			}
+			seenUdp4 = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Udp4", err)
+			} else {
+				m.Udp4 = int(iv)
+			}
+		case "U6":
+			if seenUdp6 {
+				return fmt.Errorf("error on field %s: expected single value", "Udp6")
+			}
+			seenUdp6 = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Udp6", err)
+			} else {
+				m.Udp6 = int(iv)
+			}
+		case "TR":
+			if seenTTH {
+				return fmt.Errorf("error on field %s: expected single value", "TTH")
+			}
+			seenTTH = true
+			if len(v[2:]) == 0 {
+				m.TTH = nil
+			} else {
+				var pv tiger.Hash
+				if err := pv.UnmarshalAdc(v[2:]); err != nil {
+					return fmt.Errorf("error on field %s: %s", "TTH", err)
+				}
+				m.TTH = &pv
+			}
+		case "PC":
+			if seenCount {
+				return fmt.Errorf("error on field %s: expected single value", "Count")
+			}
+			seenCount = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Count", err)
+			} else {
+				m.Count = int(iv)
+			}
+		case "PI":
+			if seenParts {
+				continue
+			}
+			seenParts = true
+			if err := m.Parts.UnmarshalAdc(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Parts", err)
+			}
+		case "TO":
+			if seenToken {
+				return fmt.Errorf("error on field %s: expected single value", "Token")
+			}
+			seenToken = true
+			m.Token = unescape(v[2:])
+		}
+	}
+	return nil
+}
+
+func (m PartialResult) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	if m.HubAddr != "" {
+		w.field("HI")
+		w.buf = appendEscaped(w.buf, string(m.HubAddr))
+	}
+	if m.Udp4 != 0 {
+		w.field("U4")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Udp4), 10)
+	}
+	if m.Udp6 != 0 {
+		w.field("U6")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Udp6), 10)
+	}
+	if m.TTH != nil {
+		w.field("TR")
+		if m.TTH != nil {
+			if data, err := m.TTH.MarshalAdc(); err != nil {
+				return nil, fmt.Errorf("cannot marshal field %s: %v", "TTH", err)
+			} else {
+				w.buf = append(w.buf, data...)
+			}
+		}
+	}
+	if m.Count != 0 {
+		w.field("PC")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Count), 10)
+	}
+	if m.Parts != nil {
+		w.field("PI")
+		if data, err := m.Parts.MarshalAdc(); err != nil {
+			return nil, fmt.Errorf("cannot marshal field %s: %v", "Parts", err)
+		} else {
+			w.buf = append(w.buf, data...)
+		}
+	}
+	if m.Token != "" {
+		w.field("TO")
+		w.buf = appendEscaped(w.buf, string(m.Token))
+	}
+	return w.buf, nil
+}
+
+func (m *ChatMessage) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	m.Text = unescape(sub[0])
+	sub = sub[1:]
+	var (
+		seenPM bool
+		seenMe bool
+		seenTS bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "PM":
+			if seenPM {
+				return fmt.Errorf("error on field %s: expected single value", "PM")
+			}
+			seenPM = true
+			if len(v[2:]) == 0 {
+				m.PM = nil
+			} else {
+				var pv types.SID
+				if err := pv.UnmarshalAdc(v[2:]); err != nil {
+					return fmt.Errorf("error on field %s: %s", "PM", err)
+				}
+				m.PM = &pv
+			}
+		case "ME":
+			if seenMe {
+				return fmt.Errorf("error on field %s: expected single value", "Me")
+			}
+			seenMe = true
+			if bv, err := parseBool(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Me", err)
+			} else {
+				m.Me = bool(bv)
+			}
+		case "TS":
+			if seenTS {
+				return fmt.Errorf("error on field %s: expected single value", "TS")
+			}
+			seenTS = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "TS", err)
+			} else {
+				m.TS = int64(iv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m ChatMessage) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Text))
+	if m.PM != nil {
+		w.field("PM")
+		if m.PM != nil {
+			if data, err := m.PM.MarshalAdc(); err != nil {
+				return nil, fmt.Errorf("cannot marshal field %s: %v", "PM", err)
+			} else {
+				w.buf = append(w.buf, data...)
+			}
+		}
+	}
+	if m.Me {
+		w.field("ME")
+		if m.Me {
+			w.buf = append(w.buf, '1')
+		} else {
+			w.buf = append(w.buf, '0')
+		}
+	}
+	if m.TS != 0 {
+		w.field("TS")
+		w.buf = strconv.AppendInt(w.buf, int64(m.TS), 10)
+	}
+	return w.buf, nil
+}
+
+func (m *Disconnect) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	if err := m.ID.UnmarshalAdc(sub[0]); err != nil {
+		return fmt.Errorf("error on field %s: %s", "ID", err)
+	}
+	sub = sub[1:]
+	var (
+		seenMessage  bool
+		seenBy       bool
+		seenDuration bool
+		seenRedirect bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "MS":
+			if seenMessage {
+				return fmt.Errorf("error on field %s: expected single value", "Message")
+			}
+			seenMessage = true
+			m.Message = unescape(v[2:])
+		case "ID":
+			if seenBy {
+				continue
+			}
+			seenBy = true
+			if err := m.By.UnmarshalAdc(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "By", err)
+			}
+		case "TL":
+			if seenDuration {
+				return fmt.Errorf("error on field %s: expected single value", "Duration")
+			}
+			seenDuration = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Duration", err)
+			} else {
+				m.Duration = int(iv)
+			}
+		case "RD":
+			if seenRedirect {
+				return fmt.Errorf("error on field %s: expected single value", "Redirect")
+			}
+			seenRedirect = true
+			m.Redirect = unescape(v[2:])
+		}
+	}
+	return nil
+}
+
+func (m Disconnect) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	if data, err := m.ID.MarshalAdc(); err != nil {
+		return nil, fmt.Errorf("cannot marshal field %s: %v", "ID", err)
+	} else {
+		w.buf = append(w.buf, data...)
+	}
+	if m.Message != "" {
+		w.field("MS")
+		w.buf = appendEscaped(w.buf, string(m.Message))
+	}
+	if m.By != (types.SID{}) {
+		w.field("ID")
+		if data, err := m.By.MarshalAdc(); err != nil {
+			return nil, fmt.Errorf("cannot marshal field %s: %v", "By", err)
+		} else {
+			w.buf = append(w.buf, data...)
+		}
+	}
+	if m.Duration != 0 {
+		w.field("TL")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Duration), 10)
+	}
+	if m.Redirect != "" {
+		w.field("RD")
+		w.buf = appendEscaped(w.buf, string(m.Redirect))
+	}
+	return w.buf, nil
+}
+
+func (m *HybridBridge) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenIp4   bool
+		seenIp6   bool
+		seenPort4 bool
+		seenPort6 bool
+		seenToken bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "I4":
+			if seenIp4 {
+				return fmt.Errorf("error on field %s: expected single value", "Ip4")
+			}
+			seenIp4 = true
+			m.Ip4 = unescape(v[2:])
+		case "I6":
+			if seenIp6 {
+				return fmt.Errorf("error on field %s: expected single value", "Ip6")
+			}
+			seenIp6 = true
+			m.Ip6 = unescape(v[2:])
+		case "P4":
+			if seenPort4 {
+				return fmt.Errorf("error on field %s: expected single value", "Port4")
+			}
+			seenPort4 = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Port4", err)
+			} else {
+				m.Port4 = int(iv)
+			}
+		case "P6":
+			if seenPort6 {
+				return fmt.Errorf("error on field %s: expected single value", "Port6")
+			}
+			seenPort6 = true
+			if iv, err := parseInt(v[2:], 64); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Port6", err)
+			} else {
+				m.Port6 = int(iv)
+			}
+		case "TO":
+			if seenToken {
+				return fmt.Errorf("error on field %s: expected single value", "Token")
+			}
+			seenToken = true
+			m.Token = unescape(v[2:])
+		}
+	}
+	return nil
+}
+
+func (m HybridBridge) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	if m.Ip4 != "" {
+		w.field("I4")
+		w.buf = appendEscaped(w.buf, string(m.Ip4))
+	}
+	if m.Ip6 != "" {
+		w.field("I6")
+		w.buf = appendEscaped(w.buf, string(m.Ip6))
+	}
+	if m.Port4 != 0 {
+		w.field("P4")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Port4), 10)
+	}
+	if m.Port6 != 0 {
+		w.field("P6")
+		w.buf = strconv.AppendInt(w.buf, int64(m.Port6), 10)
+	}
+	if m.Token != "" {
+		w.field("TO")
+		w.buf = appendEscaped(w.buf, string(m.Token))
+	}
+	return w.buf, nil
+}
+
+func (m *UserListSync) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		seenVersion bool
+		seenDelta   bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "LV":
+			if seenVersion {
+				return fmt.Errorf("error on field %s: expected single value", "Version")
+			}
+			seenVersion = true
+			m.Version = unescape(v[2:])
+		case "DL":
+			if seenDelta {
+				return fmt.Errorf("error on field %s: expected single value", "Delta")
+			}
+			seenDelta = true
+			if bv, err := parseBool(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Delta", err)
+			} else {
+				m.Delta = bool(bv)
+			}
+		}
+	}
+	return nil
+}
+
+func (m UserListSync) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	if m.Version != "" {
+		w.field("LV")
+		w.buf = appendEscaped(w.buf, string(m.Version))
+	}
+	if m.Delta {
+		w.field("DL")
+		if m.Delta {
+			w.buf = append(w.buf, '1')
+		} else {
+			w.buf = append(w.buf, '0')
+		}
+	}
+	return w.buf, nil
+}
+
+func (m *UserInfoRequest) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	var (
+		valsUsers []types.SID
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "SI":
+			var e types.SID
+			if err := e.UnmarshalAdc(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Users", err)
+			}
+			valsUsers = append(valsUsers, e)
+		}
+	}
+	if valsUsers != nil {
+		m.Users = valsUsers
+	}
+	return nil
+}
+
+func (m UserInfoRequest) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	for _, e := range m.Users {
+		w.field("SI")
+		if data, err := e.MarshalAdc(); err != nil {
+			return nil, fmt.Errorf("cannot marshal field %s: %v", "Users", err)
+		} else {
+			w.buf = append(w.buf, data...)
+		}
+	}
+	return w.buf, nil
+}
+
+func (m *PM) UnmarshalAdc(data []byte) error {
+	sub := bytes.Split(data, []byte(" "))
+	m.Text = unescape(sub[0])
+	sub = sub[1:]
+	var (
+		seenSrc bool
+	)
+	for _, v := range sub {
+		if len(v) < 2 {
+			continue
+		}
+		switch string(v[:2]) {
+		case "PM":
+			if seenSrc {
+				continue
+			}
+			seenSrc = true
+			if err := m.Src.UnmarshalAdc(v[2:]); err != nil {
+				return fmt.Errorf("error on field %s: %s", "Src", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m PM) MarshalAdc() ([]byte, error) {
+	var w fieldWriter
+	w.field("")
+	w.buf = appendEscaped(w.buf, string(m.Text))
+	if m.Src != (types.SID{}) {
+		w.field("PM")
+		if data, err := m.Src.MarshalAdc(); err != nil {
+			return nil, fmt.Errorf("cannot marshal field %s: %v", "Src", err)
+		} else {
+			w.buf = append(w.buf, data...)
+		}
+	}
+	return w.buf, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 )
 
 const (
@@ -485,9 +486,21 @@ func (p *FeaturePacket) MarshalPacket() ([]byte, error) {
 	id, _ := p.ID.MarshalAdc()
 	copy(buf[5:], id[:])
 	off := 9
-	for k, v := range p.Features {
+	// required features go first, each group is sorted by name
+	fea := make([]Feature, 0, len(p.Features))
+	for k := range p.Features {
+		fea = append(fea, k)
+	}
+	sort.Slice(fea, func(i, j int) bool {
+		a, b := fea[i], fea[j]
+		if p.Features[a] != p.Features[b] {
+			return p.Features[a]
+		}
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	for _, k := range fea {
 		buf[off] = ' '
-		if v {
+		if p.Features[k] {
 			buf[off+1] = '+'
 		} else {
 			buf[off+1] = '-'
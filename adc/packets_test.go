@@ -225,3 +225,26 @@ func TestEncodePacket(t *testing.T) {
 		})
 	}
 }
+
+var casesPacketsMalformed = []struct {
+	name string
+	data string
+}{
+	{"short", `USCH KAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XL`},
+	{"lower case", `USCH kay6bi76t6xfiqxznrye4wxj2y3ygxjg7um7xli`},
+	{"invalid char", `USCH KAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7X1I`},
+	{"line break", "USCH KAY6BI76T6XFIQXZNRYE4WX\rJ2Y3YGXJG7UM7XL"},
+	{"trailing bits", `USCH KAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLJ`},
+	{"no separator", `USCH KAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLIANdata`},
+}
+
+func TestDecodeUDPPacketMalformed(t *testing.T) {
+	for _, c := range casesPacketsMalformed {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := DecodePacket([]byte(c.data + delim))
+			if err == nil {
+				t.Fatalf("expected an error for %q", c.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package adc
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+var (
+	_ Marshaler   = PartsInfo{}
+	_ Unmarshaler = (*PartsInfo)(nil)
+)
+
+// PartsInfo is a sorted list of non-overlapping ranges of TTH leaf blocks
+// that are available for a partially downloaded file.
+//
+// Each range is encoded as a pair of block indexes: the first block and the block after the last one.
+type PartsInfo []int
+
+// NewPartsInfo creates a normalized parts info from a list of [start, end) block ranges.
+func NewPartsInfo(ranges ...[2]int) PartsInfo {
+	var p PartsInfo
+	for _, r := range ranges {
+		p = p.Add(r[0], r[1])
+	}
+	return p
+}
+
+func (p PartsInfo) MarshalAdc() ([]byte, error) {
+	if len(p)%2 != 0 {
+		return nil, fmt.Errorf("odd number of part indexes: %d", len(p))
+	}
+	var buf []byte
+	for i, v := range p {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(v), 10)
+	}
+	return buf, nil
+}
+
+func (p *PartsInfo) UnmarshalAdc(data []byte) error {
+	*p = nil
+	if len(data) == 0 {
+		return nil
+	}
+	sub := bytes.Split(data, []byte(","))
+	if len(sub)%2 != 0 {
+		return fmt.Errorf("odd number of part indexes: %d", len(sub))
+	}
+	out := make(PartsInfo, 0, len(sub))
+	for _, b := range sub {
+		v, err := strconv.Atoi(string(b))
+		if err != nil {
+			return err
+		} else if v < 0 {
+			return fmt.Errorf("negative part index: %d", v)
+		}
+		out = append(out, v)
+	}
+	for i := 0; i < len(out); i += 2 {
+		if out[i] >= out[i+1] || (i > 0 && out[i] < out[i-1]) {
+			return fmt.Errorf("invalid part range: [%d, %d)", out[i], out[i+1])
+		}
+	}
+	*p = out
+	return nil
+}
+
+// Add marks blocks in the [start, end) range as available and returns an updated parts info.
+func (p PartsInfo) Add(start, end int) PartsInfo {
+	if start < 0 || start >= end {
+		return p
+	}
+	type rng struct{ s, e int }
+	arr := make([]rng, 0, len(p)/2+1)
+	for i := 0; i+1 < len(p); i += 2 {
+		arr = append(arr, rng{p[i], p[i+1]})
+	}
+	arr = append(arr, rng{start, end})
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].s < arr[j].s
+	})
+	out := make(PartsInfo, 0, len(arr)*2)
+	for _, r := range arr {
+		if n := len(out); n != 0 && r.s <= out[n-1] {
+			if r.e > out[n-1] {
+				out[n-1] = r.e
+			}
+			continue
+		}
+		out = append(out, r.s, r.e)
+	}
+	return out
+}
+
+// Has checks if a given block is available.
+func (p PartsInfo) Has(block int) bool {
+	for i := 0; i+1 < len(p); i += 2 {
+		if block < p[i] {
+			return false
+		} else if block < p[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocks returns the number of available blocks.
+func (p PartsInfo) Blocks() int {
+	n := 0
+	for i := 0; i+1 < len(p); i += 2 {
+		n += p[i+1] - p[i]
+	}
+	return n
+}
+
+// Intersect returns blocks that are available in both parts infos.
+func (p PartsInfo) Intersect(p2 PartsInfo) PartsInfo {
+	var out PartsInfo
+	for i, j := 0, 0; i+1 < len(p) && j+1 < len(p2); {
+		s, e := p[i], p[i+1]
+		if p2[j] > s {
+			s = p2[j]
+		}
+		if p2[j+1] < e {
+			e = p2[j+1]
+		}
+		if s < e {
+			out = append(out, s, e)
+		}
+		if p[i+1] < p2[j+1] {
+			i += 2
+		} else {
+			j += 2
+		}
+	}
+	return out
+}
+
+// Missing returns blocks from p2 that are not available in p.
+func (p PartsInfo) Missing(p2 PartsInfo) PartsInfo {
+	var out PartsInfo
+	for j := 0; j+1 < len(p2); j += 2 {
+		s, e := p2[j], p2[j+1]
+		for i := 0; i+1 < len(p) && s < e; i += 2 {
+			if p[i+1] <= s {
+				continue
+			} else if p[i] >= e {
+				break
+			}
+			if p[i] > s {
+				out = append(out, s, p[i])
+			}
+			s = p[i+1]
+		}
+		if s < e {
+			out = append(out, s, e)
+		}
+	}
+	return out
+}
+
+// BlockRange returns a byte range for a given block. The last block might be shorter than the block size.
+func BlockRange(block int, blockSize, fileSize int64) (off, size int64) {
+	off = int64(block) * blockSize
+	size = blockSize
+	if off+size > fileSize {
+		size = fileSize - off
+	}
+	if size < 0 {
+		size = 0
+	}
+	return off, size
+}
@@ -0,0 +1,42 @@
+package adc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartsInfo(t *testing.T) {
+	p := NewPartsInfo([2]int{10, 12}, [2]int{0, 5}, [2]int{4, 7}, [2]int{12, 13})
+	require.Equal(t, PartsInfo{0, 7, 10, 13}, p)
+	require.Equal(t, 10, p.Blocks())
+	require.True(t, p.Has(0))
+	require.True(t, p.Has(6))
+	require.False(t, p.Has(7))
+	require.True(t, p.Has(12))
+	require.False(t, p.Has(13))
+
+	data, err := p.MarshalAdc()
+	require.NoError(t, err)
+	require.Equal(t, "0,7,10,13", string(data))
+
+	var p2 PartsInfo
+	require.NoError(t, p2.UnmarshalAdc(data))
+	require.Equal(t, p, p2)
+	require.Error(t, p2.UnmarshalAdc([]byte("0,7,10")))
+	require.Error(t, p2.UnmarshalAdc([]byte("5,3")))
+	require.Error(t, p2.UnmarshalAdc([]byte("0,5,3,8")))
+
+	other := PartsInfo{5, 11, 12, 20}
+	require.Equal(t, PartsInfo{5, 7, 10, 11, 12, 13}, p.Intersect(other))
+	require.Equal(t, PartsInfo{7, 10, 13, 20}, p.Missing(other))
+	require.Equal(t, other, PartsInfo(nil).Missing(other))
+}
+
+func TestBlockRange(t *testing.T) {
+	off, size := BlockRange(2, 1024, 2500)
+	require.Equal(t, int64(2048), off)
+	require.Equal(t, int64(452), size)
+	_, size = BlockRange(3, 1024, 2500)
+	require.Equal(t, int64(0), size)
+}
@@ -48,7 +48,7 @@ func Ping(ctx context.Context, addr string, conf PingConfig) (*PingHubInfo, erro
 		FeaSEGA: true,
 		FeaZLIF: true,
 		extONID: true,
-		extASCH: true,
+		FeaASCH: true,
 		extNAT0: true,
 		// TODO: anything else?
 	}
@@ -209,7 +209,7 @@ func Ping(ctx context.Context, addr string, conf PingConfig) (*PingHubInfo, erro
 				}
 				e := Error{Status{Sev: Fatal, Msg: st.Message}}
 				if strings.Contains(st.Message, "registered users only") {
-					e.Code = 26
+					e.Code = CodeRegisteredOnly
 				}
 				if e.Msg == "" {
 					e.Msg = "hub closed the connection"
@@ -3,6 +3,7 @@ package adc
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -330,9 +331,26 @@ func (t ExtGroup) Matches(ext string) bool {
 	if t == 0 {
 		return true
 	}
+	return t.Has(ExtGroupOf(ext))
+}
+
+// ExtGroupOf returns a group of the file extension. It accepts either an extension
+// or a file name. It returns ExtNone if the extension doesn't belong to any group.
+func ExtGroupOf(ext string) ExtGroup {
 	if i := strings.LastIndex(ext, "."); i >= 0 {
 		ext = ext[i+1:]
 	}
-	ext = strings.ToLower(ext)
-	return t.Has(extGroups[ext])
+	return extGroups[strings.ToLower(ext)]
+}
+
+// Exts returns a sorted list of extensions in all groups of the set.
+func (t ExtGroup) Exts() []string {
+	var out []string
+	for ext, g := range extGroups {
+		if t.Has(g) {
+			out = append(out, ext)
+		}
+	}
+	sort.Strings(out)
+	return out
 }
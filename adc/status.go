@@ -0,0 +1,169 @@
+package adc
+
+import "os"
+
+// Status codes defined by ADC specification. The code does not include the severity.
+const (
+	CodeGeneric = 0
+
+	CodeHubGeneric  = 10
+	CodeHubFull     = 11
+	CodeHubDisabled = 12
+
+	CodeLoginGeneric   = 20
+	CodeNickInvalid    = 21
+	CodeNickTaken      = 22
+	CodeBadPassword    = 23
+	CodeCIDTaken       = 24
+	CodeAccessDenied   = 25
+	CodeRegisteredOnly = 26
+	CodeInvalidPID     = 27
+
+	CodeBanGeneric = 30
+	CodeBanned     = 31
+	CodeTempBanned = 32
+
+	CodeProtocolGeneric     = 40
+	CodeUnsupportedTransfer = 41
+	CodeConnectFailed       = 42
+	CodeBadINF              = 43
+	CodeInvalidState        = 44
+	CodeFeatureMissing      = 45
+	CodeInvalidIP           = 46
+	CodeNoHashOverlapHub    = 47
+
+	CodeTransferGeneric     = 50
+	CodeFileNotAvailable    = 51
+	CodePartNotAvailable    = 52
+	CodeSlotsFull           = 53
+	CodeNoHashOverlapClient = 54
+)
+
+var statusText = map[int]string{
+	CodeGeneric: "generic error",
+
+	CodeHubGeneric:  "hub error",
+	CodeHubFull:     "hub full",
+	CodeHubDisabled: "hub disabled",
+
+	CodeLoginGeneric:   "login error",
+	CodeNickInvalid:    "nick invalid",
+	CodeNickTaken:      "nick taken",
+	CodeBadPassword:    "invalid password",
+	CodeCIDTaken:       "CID taken",
+	CodeAccessDenied:   "access denied",
+	CodeRegisteredOnly: "registered users only",
+	CodeInvalidPID:     "invalid PID supplied",
+
+	CodeBanGeneric: "disconnected",
+	CodeBanned:     "permanently banned",
+	CodeTempBanned: "temporarily banned",
+
+	CodeProtocolGeneric:     "protocol error",
+	CodeUnsupportedTransfer: "transfer protocol unsupported",
+	CodeConnectFailed:       "direct connection failed",
+	CodeBadINF:              "required INF field missing or bad",
+	CodeInvalidState:        "invalid state",
+	CodeFeatureMissing:      "required feature missing",
+	CodeInvalidIP:           "invalid IP supplied in INF",
+	CodeNoHashOverlapHub:    "no hash support overlap between client and hub",
+
+	CodeTransferGeneric:     "transfer error",
+	CodeFileNotAvailable:    "file not available",
+	CodePartNotAvailable:    "file part not available",
+	CodeSlotsFull:           "slots full",
+	CodeNoHashOverlapClient: "no hash support overlap between clients",
+}
+
+// StatusText returns a description for the status code.
+// For unknown codes, the description of the code group is returned.
+func StatusText(code int) string {
+	if s, ok := statusText[code]; ok {
+		return s
+	}
+	return statusText[code-code%10]
+}
+
+// NewError creates an error with a given severity and status code.
+// If the message is empty, a default description of the code is used.
+func NewError(sev Severity, code int, msg string) Error {
+	if msg == "" {
+		msg = StatusText(code)
+	}
+	return Error{Status{Sev: sev, Code: code, Msg: msg}}
+}
+
+// Helpers for common errors. An empty message is replaced with a default description.
+
+func ErrHubFull(msg string) Error        { return NewError(Fatal, CodeHubFull, msg) }
+func ErrHubDisabled(msg string) Error    { return NewError(Fatal, CodeHubDisabled, msg) }
+func ErrLogin(msg string) Error          { return NewError(Fatal, CodeLoginGeneric, msg) }
+func ErrNickInvalid(msg string) Error    { return NewError(Fatal, CodeNickInvalid, msg) }
+func ErrNickTaken(msg string) Error      { return NewError(Fatal, CodeNickTaken, msg) }
+func ErrBadPassword(msg string) Error    { return NewError(Fatal, CodeBadPassword, msg) }
+func ErrCIDTaken(msg string) Error       { return NewError(Fatal, CodeCIDTaken, msg) }
+func ErrAccessDenied(msg string) Error   { return NewError(Recoverable, CodeAccessDenied, msg) }
+func ErrRegisteredOnly(msg string) Error { return NewError(Fatal, CodeRegisteredOnly, msg) }
+func ErrInvalidPID(msg string) Error     { return NewError(Fatal, CodeInvalidPID, msg) }
+func ErrBanned(msg string) Error         { return NewError(Fatal, CodeBanned, msg) }
+func ErrTempBanned(msg string) Error     { return NewError(Fatal, CodeTempBanned, msg) }
+func ErrProtocol(msg string) Error       { return NewError(Fatal, CodeProtocolGeneric, msg) }
+func ErrBadINF(msg string) Error         { return NewError(Fatal, CodeBadINF, msg) }
+func ErrInvalidState(msg string) Error   { return NewError(Fatal, CodeInvalidState, msg) }
+func ErrFeatureMissing(msg string) Error { return NewError(Fatal, CodeFeatureMissing, msg) }
+func ErrInvalidIP(msg string) Error      { return NewError(Fatal, CodeInvalidIP, msg) }
+func ErrConnectFailed(msg string) Error  { return NewError(Recoverable, CodeConnectFailed, msg) }
+func ErrUnsupportedTransfer(msg string) Error {
+	return NewError(Recoverable, CodeUnsupportedTransfer, msg)
+}
+
+func ErrFileNotAvailable(msg string) Error { return NewError(Recoverable, CodeFileNotAvailable, msg) }
+func ErrPartNotAvailable(msg string) Error { return NewError(Recoverable, CodePartNotAvailable, msg) }
+func ErrSlotsFull(msg string) Error        { return NewError(Recoverable, CodeSlotsFull, msg) }
+
+// ErrQueued is sent when all upload slots are taken and the peer is put into the upload queue.
+// The position starts at 1.
+func ErrQueued(pos int) Error {
+	e := ErrSlotsFull("")
+	e.QueuePos = pos
+	return e
+}
+
+// QueuePos returns the position in the upload queue reported by the peer,
+// or zero if the error is not a slots full status.
+func QueuePos(err error) int {
+	switch e := err.(type) {
+	case Error:
+		if e.Code == CodeSlotsFull {
+			return e.QueuePos
+		}
+	case *Error:
+		if e != nil && e.Code == CodeSlotsFull {
+			return e.QueuePos
+		}
+	}
+	return 0
+}
+
+// Is reports whether the target is an ADC error with the same status code.
+// Severity and message are not compared.
+func (e Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Error:
+		return t.Code == e.Code
+	case *Error:
+		return t != nil && t.Code == e.Code
+	}
+	return false
+}
+
+// IsCode checks if the error is an ADC error with a given status code.
+func IsCode(err error, code int) bool {
+	switch e := err.(type) {
+	case Error:
+		return e.Code == code
+	case *Error:
+		return e != nil && e.Code == code
+	}
+	return code == CodeFileNotAvailable && err == os.ErrNotExist
+}
@@ -0,0 +1,58 @@
+package adc
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusErrors(t *testing.T) {
+	e := ErrNickTaken("")
+	require.Equal(t, Fatal, e.Sev)
+	require.Equal(t, CodeNickTaken, e.Code)
+	require.Equal(t, "nick taken", e.Msg)
+
+	data, err := Marshal(e.Status)
+	require.NoError(t, err)
+	require.Equal(t, `222 nick\staken`, string(data))
+
+	var st Status
+	require.NoError(t, Unmarshal([]byte(`231 you\sare\sbanned`), &st))
+	err = st.Err()
+	require.Equal(t, ErrBanned("you are banned"), err)
+	require.True(t, IsCode(err, CodeBanned))
+	require.False(t, IsCode(err, CodeTempBanned))
+	require.True(t, ErrBanned("").Is(err))
+	require.False(t, ErrNickTaken("").Is(err))
+
+	require.NoError(t, Unmarshal([]byte(`151 gone`), &st))
+	require.Equal(t, os.ErrNotExist, st.Err())
+	require.True(t, IsCode(st.Err(), CodeFileNotAvailable))
+
+	require.NoError(t, Unmarshal([]byte(`000 ok`), &st))
+	require.NoError(t, st.Err())
+	require.False(t, IsCode(nil, CodeGeneric))
+
+	require.Equal(t, "login error", StatusText(29))
+	require.Equal(t, "slots full", ErrSlotsFull("").Msg)
+	require.Equal(t, Recoverable, ErrSlotsFull("").Sev)
+}
+
+func TestStatusQueued(t *testing.T) {
+	data, err := Marshal(ErrQueued(3).Status)
+	require.NoError(t, err)
+	require.Equal(t, `153 slots\sfull QP3`, string(data))
+
+	var st Status
+	require.NoError(t, Unmarshal(data, &st))
+	require.Equal(t, "slots full", st.Msg)
+	require.Equal(t, 3, QueuePos(st.Err()))
+	require.Equal(t, 0, QueuePos(ErrSlotsFull("").Status.Err()))
+	require.Equal(t, 0, QueuePos(ErrBanned("")))
+
+	// unknown named parameters are not a part of the message
+	require.NoError(t, Unmarshal([]byte(`140 bad FCBINF`), &st))
+	require.Equal(t, "bad", st.Msg)
+	require.Equal(t, 0, st.QueuePos)
+}
@@ -2,7 +2,9 @@ package types
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding"
+	"errors"
 	"fmt"
 
 	"github.com/direct-connect/go-dc/tiger"
@@ -67,12 +69,25 @@ func MustParseCIDP(s string) *CID {
 }
 
 var (
+	_ fmt.Stringer             = CID{}
 	_ encoding.TextMarshaler   = CID{}
 	_ encoding.TextUnmarshaler = (*CID)(nil)
 )
 
 var zeroCID = CID{}
 
+// cidBase32Len is the length of base32 encoded CID without padding.
+const cidBase32Len = (len(zeroCID)*8 + 4) / 5
+
+var errZeroCID = errors.New("CID is not set")
+
+// ParseCID parses a base32 encoded CID.
+func ParseCID(s string) (CID, error) {
+	var id CID
+	err := id.FromBase32(s)
+	return id, err
+}
+
 // CID (Client ID) globally and publicly identify a unique client and underlie client to client communication.
 //
 // They are generated by hashing the (unencoded) PID with the session hash algorithm.
@@ -84,6 +99,20 @@ type CID [tiger.Size]byte
 func (id CID) IsZero() bool {
 	return id == zeroCID
 }
+
+// Equal compares two CIDs in constant time. It should be used on authentication paths.
+func (id CID) Equal(id2 CID) bool {
+	return subtle.ConstantTimeCompare(id[:], id2[:]) == 1
+}
+
+// Validate checks that the CID is set.
+func (id CID) Validate() error {
+	if id.IsZero() {
+		return errZeroCID
+	}
+	return nil
+}
+
 func (id CID) String() string {
 	return id.ToBase32()
 }
@@ -102,7 +131,22 @@ func (id CID) MarshalAdc() ([]byte, error) {
 func (id CID) ToBase32() string {
 	return tiger.Hash(id).Base32()
 }
+
+// FromBase32 decodes the CID from base32. Unlike the standard decoder, it doesn't accept
+// line breaks, padding or non-zero trailing bits, thus each CID has a single valid encoding.
 func (id *CID) FromBase32(s string) error {
+	if len(s) != cidBase32Len {
+		return fmt.Errorf("wrong CID length: %d vs %d", len(s), cidBase32Len)
+	}
+	for i := 0; i < len(s); i++ {
+		if !isBase32(s[i]) {
+			return fmt.Errorf("invalid character in CID: %q", s[i])
+		}
+	}
+	// the last character only has 2 significant bits
+	if v := base32Val(s[len(s)-1]); v&0x7 != 0 {
+		return fmt.Errorf("non-canonical CID encoding: %q", s)
+	}
 	var th tiger.Hash
 	if err := th.FromBase32(s); err != nil {
 		return err
@@ -114,6 +158,30 @@ func (id CID) Hash() CID {
 	return (CID)(tiger.HashBytes(id[:]))
 }
 
+func isBase32(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= '2' && c <= '7')
+}
+
+func base32Val(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c - 'A'
+	}
+	return c - '2' + 26
+}
+
+// CIDFromPID derives a CID from a PID.
+func CIDFromPID(pid PID) CID {
+	return pid.Hash()
+}
+
+// VerifyPID checks if the PID matches the CID. The check is done in constant time.
+func VerifyPID(pid PID, cid CID) bool {
+	if pid.IsZero() {
+		return false
+	}
+	return CIDFromPID(pid).Equal(cid)
+}
+
 // PID (Private ID) globally identify a unique client.
 //
 // They function during initial protocol negotiation to generate the CID and are invisible to other clients.
@@ -0,0 +1,59 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testCID = "KAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI"
+
+func TestParseCID(t *testing.T) {
+	id, err := ParseCID(testCID)
+	require.NoError(t, err)
+	require.Equal(t, testCID, id.String())
+	require.NoError(t, id.Validate())
+
+	text, err := id.MarshalText()
+	require.NoError(t, err)
+	var id2 CID
+	require.NoError(t, id2.UnmarshalText(text))
+	require.Equal(t, id, id2)
+	require.True(t, id.Equal(id2))
+}
+
+func TestParseCIDMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		testCID[:len(testCID)-1],
+		testCID + "A",
+		testCID + "=",
+		strings.ToLower(testCID),
+		testCID[:10] + "\n" + testCID[11:],
+		testCID[:10] + "1" + testCID[11:],
+		testCID[:len(testCID)-1] + "J", // non-zero trailing bits
+	} {
+		_, err := ParseCID(s)
+		require.Error(t, err, "%q", s)
+	}
+}
+
+func TestCIDZero(t *testing.T) {
+	var id CID
+	require.True(t, id.IsZero())
+	require.Error(t, id.Validate())
+
+	id, err := ParseCID(strings.Repeat("A", cidBase32Len))
+	require.NoError(t, err)
+	require.True(t, id.IsZero())
+}
+
+func TestVerifyPID(t *testing.T) {
+	pid := NewPID()
+	cid := CIDFromPID(pid)
+	require.True(t, VerifyPID(pid, cid))
+	require.False(t, VerifyPID(cid, cid))
+	require.False(t, VerifyPID(PID{}, CIDFromPID(PID{})))
+	require.False(t, cid.Equal(pid))
+}
@@ -0,0 +1,401 @@
+package adc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxUDPPacket is the maximal size of a single UDP datagram accepted by the server.
+	maxUDPPacket = 64 * 1024
+
+	// SUDPKeySize is the size of the SUDP encryption key, as sent in the KY field of SCH.
+	SUDPKeySize = aes.BlockSize
+
+	defaultMalformedLimit  = 10
+	defaultMalformedWindow = time.Minute
+	defaultMaxOffenders    = 4096
+)
+
+var (
+	errUDPShort   = errors.New("udp packet is too short")
+	errUDPPadding = errors.New("invalid sudp padding")
+	errUDPKind    = errors.New("expected an udp packet")
+)
+
+// UDPHandler is called for each UDP packet received by the UDPServer.
+type UDPHandler func(addr net.Addr, p *UDPPacket)
+
+// UDPStats is a set of counters for the UDPServer.
+type UDPStats struct {
+	Packets   uint64 // valid packets
+	Encrypted uint64 // valid packets encrypted with SUDP
+	Malformed uint64 // packets that cannot be decoded
+	Dropped   uint64 // packets ignored due to the malformed traffic limit
+	Unhandled uint64 // valid packets with no handler
+}
+
+type udpHandler struct {
+	id uint64
+	h  UDPHandler
+}
+
+type udpOffender struct {
+	start time.Time
+	count int
+}
+
+// UDPServer receives ADC UDP packets (URES, UINF, etc), optionally encrypted with SUDP,
+// and dispatches them to handlers by the sender's CID.
+//
+// It is used by the client's active search (see client.Config.UDP) and any hub-side UDP features.
+type UDPServer struct {
+	// MalformedLimit is the number of malformed packets accepted from a single IP
+	// within MalformedWindow. Packets from this IP are ignored after the limit is reached,
+	// until the window ends. Both fields must be set before calling Serve.
+	MalformedLimit  int
+	MalformedWindow time.Duration
+	// MaxOffenders limits the number of IPs tracked for the malformed traffic limit.
+	// New IPs are not tracked when the limit is reached. Must be set before calling Serve.
+	MaxOffenders int
+
+	conn net.PacketConn
+	done chan struct{}
+
+	mu       sync.RWMutex
+	lastID   uint64
+	handlers map[CID]udpHandler
+	fallback udpHandler
+	keys     map[[SUDPKeySize]byte]struct{}
+
+	bmu       sync.Mutex
+	offenders map[string]*udpOffender
+
+	closed uint32
+	stats  UDPStats
+}
+
+// ListenUDP binds an UDP socket on a given address and returns an UDPServer for it.
+func ListenUDP(addr string) (*UDPServer, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewUDPServer(conn), nil
+}
+
+// NewUDPServer creates an UDPServer on an existing packet connection.
+func NewUDPServer(conn net.PacketConn) *UDPServer {
+	return &UDPServer{
+		MalformedLimit:  defaultMalformedLimit,
+		MalformedWindow: defaultMalformedWindow,
+		MaxOffenders:    defaultMaxOffenders,
+		conn:            conn,
+		done:            make(chan struct{}),
+		handlers:        make(map[CID]udpHandler),
+		keys:            make(map[[SUDPKeySize]byte]struct{}),
+		offenders:       make(map[string]*udpOffender),
+	}
+}
+
+// Addr returns the local address of the server.
+func (s *UDPServer) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Handle registers a handler for packets sent by a given CID.
+// The returned function removes the handler.
+func (s *UDPServer) Handle(cid CID, h UDPHandler) func() {
+	s.mu.Lock()
+	s.lastID++
+	id := s.lastID
+	s.handlers[cid] = udpHandler{id: id, h: h}
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// the handler might have been replaced already
+		if cur, ok := s.handlers[cid]; ok && cur.id == id {
+			delete(s.handlers, cid)
+		}
+	}
+}
+
+// HandleDefault sets a handler for packets that have no CID-specific handler.
+// This is useful for search results, since the set of senders is not known in advance.
+// The returned function removes the handler.
+func (s *UDPServer) HandleDefault(h UDPHandler) func() {
+	s.mu.Lock()
+	s.lastID++
+	id := s.lastID
+	s.fallback = udpHandler{id: id, h: h}
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fallback.id == id {
+			s.fallback = udpHandler{}
+		}
+	}
+}
+
+// AddKey registers an SUDP key that will be used to decrypt incoming packets.
+// The returned function removes the key.
+func (s *UDPServer) AddKey(key [SUDPKeySize]byte) func() {
+	s.mu.Lock()
+	s.keys[key] = struct{}{}
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		delete(s.keys, key)
+		s.mu.Unlock()
+	}
+}
+
+// Stats returns current packet counters.
+func (s *UDPServer) Stats() UDPStats {
+	return UDPStats{
+		Packets:   atomic.LoadUint64(&s.stats.Packets),
+		Encrypted: atomic.LoadUint64(&s.stats.Encrypted),
+		Malformed: atomic.LoadUint64(&s.stats.Malformed),
+		Dropped:   atomic.LoadUint64(&s.stats.Dropped),
+		Unhandled: atomic.LoadUint64(&s.stats.Unhandled),
+	}
+}
+
+// WriteTo sends an UDP packet to a given address. If the key is not nil, the packet is
+// encrypted with SUDP.
+func (s *UDPServer) WriteTo(addr net.Addr, p *UDPPacket, key *[SUDPKeySize]byte) error {
+	data, err := p.MarshalPacket()
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		data, err = EncryptUDP(*key, data)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.conn.WriteTo(data, addr)
+	return err
+}
+
+// Serve reads and dispatches packets until the server is closed.
+func (s *UDPServer) Serve() error {
+	if s.MalformedLimit > 0 {
+		go s.evictOffenders()
+	}
+	buf := make([]byte, maxUDPPacket)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if atomic.LoadUint32(&s.closed) != 0 {
+				return nil
+			}
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				continue
+			}
+			return err
+		}
+		// handlers may keep the packet, so it should not reference the buffer
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		s.handlePacket(addr, data)
+	}
+}
+
+// Close stops the server and closes the socket.
+func (s *UDPServer) Close() error {
+	if !atomic.CompareAndSwapUint32(&s.closed, 0, 1) {
+		return nil
+	}
+	close(s.done)
+	return s.conn.Close()
+}
+
+func (s *UDPServer) handlePacket(addr net.Addr, data []byte) {
+	ip := udpAddrIP(addr)
+	now := time.Now()
+	if s.isLimited(ip, now) {
+		atomic.AddUint64(&s.stats.Dropped, 1)
+		return
+	}
+	p, enc, err := s.decode(data)
+	if err != nil {
+		atomic.AddUint64(&s.stats.Malformed, 1)
+		if Debug {
+			log.Printf("udp %s: %v", addr, err)
+		}
+		s.malformed(ip, now)
+		return
+	}
+	atomic.AddUint64(&s.stats.Packets, 1)
+	if enc {
+		atomic.AddUint64(&s.stats.Encrypted, 1)
+	}
+	s.mu.RLock()
+	h := s.handlers[p.ID].h
+	if h == nil {
+		h = s.fallback.h
+	}
+	s.mu.RUnlock()
+	if h == nil {
+		atomic.AddUint64(&s.stats.Unhandled, 1)
+		return
+	}
+	h(addr, p)
+}
+
+// decode parses a plain text or an SUDP-encrypted packet.
+func (s *UDPServer) decode(data []byte) (*UDPPacket, bool, error) {
+	if len(data) != 0 && data[0] == kindUDP && data[len(data)-1] == lineDelim {
+		p, err := decodeUDP(data)
+		return p, false, err
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, false, errUDPShort
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key := range s.keys {
+		plain, err := DecryptUDP(key, data)
+		if err != nil {
+			continue
+		}
+		if p, err := decodeUDP(plain); err == nil {
+			return p, true, nil
+		}
+	}
+	return nil, false, errors.New("cannot decrypt sudp packet")
+}
+
+func decodeUDP(data []byte) (*UDPPacket, error) {
+	m, err := DecodePacket(data)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := m.(*UDPPacket)
+	if !ok {
+		return nil, errUDPKind
+	}
+	return p, nil
+}
+
+func (s *UDPServer) isLimited(ip string, now time.Time) bool {
+	if s.MalformedLimit <= 0 {
+		return false
+	}
+	s.bmu.Lock()
+	defer s.bmu.Unlock()
+	o := s.offenders[ip]
+	if o == nil {
+		return false
+	}
+	if now.Sub(o.start) >= s.MalformedWindow {
+		delete(s.offenders, ip)
+		return false
+	}
+	return o.count >= s.MalformedLimit
+}
+
+func (s *UDPServer) malformed(ip string, now time.Time) {
+	if s.MalformedLimit <= 0 {
+		return
+	}
+	s.bmu.Lock()
+	defer s.bmu.Unlock()
+	o := s.offenders[ip]
+	if o == nil {
+		if s.MaxOffenders > 0 && len(s.offenders) >= s.MaxOffenders {
+			return
+		}
+		o = &udpOffender{start: now}
+		s.offenders[ip] = o
+	}
+	o.count++
+}
+
+// evictOffenders periodically removes offenders whose window has ended, until the server is closed.
+func (s *UDPServer) evictOffenders() {
+	ticker := time.NewTicker(s.MalformedWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.bmu.Lock()
+			for k, v := range s.offenders {
+				if now.Sub(v.start) >= s.MalformedWindow {
+					delete(s.offenders, k)
+				}
+			}
+			s.bmu.Unlock()
+		}
+	}
+}
+
+func udpAddrIP(addr net.Addr) string {
+	if a, ok := addr.(*net.UDPAddr); ok {
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// EncryptUDP encrypts an UDP packet according to the SUDP extension.
+//
+// The packet is encrypted with AES-128 in CBC mode with a zero IV. The first block
+// is random and the data is padded according to PKCS#5.
+func EncryptUDP(key [SUDPKeySize]byte, data []byte) ([]byte, error) {
+	b, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	out := make([]byte, aes.BlockSize+len(data)+pad)
+	if _, err = io.ReadFull(rand.Reader, out[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	n := copy(out[aes.BlockSize:], data)
+	copy(out[aes.BlockSize+n:], bytes.Repeat([]byte{byte(pad)}, pad))
+	var iv [aes.BlockSize]byte
+	cipher.NewCBCEncrypter(b, iv[:]).CryptBlocks(out, out)
+	return out, nil
+}
+
+// DecryptUDP decrypts an UDP packet encrypted with SUDP. See EncryptUDP.
+func DecryptUDP(key [SUDPKeySize]byte, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errUDPShort
+	}
+	b, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	var iv [aes.BlockSize]byte
+	cipher.NewCBCDecrypter(b, iv[:]).CryptBlocks(out, data)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errUDPPadding
+	}
+	for _, c := range out[len(out)-pad:] {
+		if int(c) != pad {
+			return nil, errUDPPadding
+		}
+	}
+	return out[aes.BlockSize : len(out)-pad], nil
+}
@@ -0,0 +1,182 @@
+package adc_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestUDPEncrypt(t *testing.T) {
+	key := [SUDPKeySize]byte{1, 2, 3}
+	for _, data := range []string{
+		"URES " + testCID1.String() + " FNfile\n",
+		"URES " + testCID1.String() + " FNfile_of_16_bytes_x\n",
+	} {
+		enc, err := EncryptUDP(key, []byte(data))
+		require.NoError(t, err)
+		require.True(t, len(enc)%16 == 0)
+
+		dec, err := DecryptUDP(key, enc)
+		require.NoError(t, err)
+		require.Equal(t, data, string(dec))
+
+		// a wrong key may still produce a valid padding by chance
+		dec, err = DecryptUDP([SUDPKeySize]byte{4}, enc)
+		if err == nil {
+			require.NotEqual(t, data, string(dec))
+		}
+	}
+}
+
+var (
+	testCID1 = CID{1}
+	testCID2 = CID{2}
+)
+
+func newTestUDPServer(t *testing.T) (*UDPServer, net.PacketConn) {
+	s, err := ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestUDPServer(t *testing.T) {
+	s, c := newTestUDPServer(t)
+	defer s.Close()
+	defer c.Close()
+	go s.Serve()
+
+	got := make(chan string, 10)
+	remove := s.Handle(testCID1, func(_ net.Addr, p *UDPPacket) {
+		got <- "cid1 " + string(p.Data)
+	})
+	s.HandleDefault(func(_ net.Addr, p *UDPPacket) {
+		got <- "default " + string(p.Data)
+	})
+	key := [SUDPKeySize]byte{5}
+	s.AddKey(key)
+
+	send := func(data []byte) {
+		_, err := c.WriteTo(data, s.Addr())
+		require.NoError(t, err)
+	}
+	expect := func(exp string) {
+		select {
+		case v := <-got:
+			require.Equal(t, exp, v)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for", exp)
+		}
+	}
+
+	send([]byte("URES " + testCID1.String() + " FNa\n"))
+	expect("cid1 FNa")
+
+	send([]byte("URES " + testCID2.String() + " FNb\n"))
+	expect("default FNb")
+
+	enc, err := EncryptUDP(key, []byte("URES "+testCID1.String()+" FNc\n"))
+	require.NoError(t, err)
+	send(enc)
+	expect("cid1 FNc")
+
+	remove()
+	send([]byte("URES " + testCID1.String() + " FNd\n"))
+	expect("default FNd")
+
+	st := s.Stats()
+	require.Equal(t, uint64(4), st.Packets)
+	require.Equal(t, uint64(1), st.Encrypted)
+	require.Equal(t, uint64(0), st.Malformed)
+}
+
+func TestUDPServerMalformed(t *testing.T) {
+	s, c := newTestUDPServer(t)
+	defer s.Close()
+	defer c.Close()
+	s.MalformedLimit = 2
+	go s.Serve()
+
+	got := make(chan struct{}, 10)
+	s.HandleDefault(func(_ net.Addr, p *UDPPacket) {
+		got <- struct{}{}
+	})
+	send := func(data string) {
+		_, err := c.WriteTo([]byte(data), s.Addr())
+		require.NoError(t, err)
+	}
+	send("garbage")
+	send("URES XXX\n")
+	send("URES " + testCID1.String() + " FNa\n")
+
+	// the last packet is valid, but the source is already blocked
+	for i := 0; i < 100; i++ {
+		if st := s.Stats(); st.Malformed+st.Dropped == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := s.Stats()
+	require.Equal(t, uint64(2), st.Malformed)
+	require.Equal(t, uint64(1), st.Dropped)
+	require.Len(t, got, 0)
+}
+
+func TestUDPServerOffenders(t *testing.T) {
+	s, c := newTestUDPServer(t)
+	defer s.Close()
+	defer c.Close()
+	c2, err := net.ListenPacket("udp", "127.0.0.2:0")
+	if err != nil {
+		t.Skip("cannot listen on the second loopback address:", err)
+	}
+	defer c2.Close()
+	s.MalformedLimit = 1
+	s.MalformedWindow = 100 * time.Millisecond
+	s.MaxOffenders = 1
+	go s.Serve()
+
+	got := make(chan struct{}, 10)
+	s.HandleDefault(func(_ net.Addr, p *UDPPacket) {
+		got <- struct{}{}
+	})
+	send := func(c net.PacketConn, data string) {
+		_, err := c.WriteTo([]byte(data), s.Addr())
+		require.NoError(t, err)
+	}
+	valid := "URES " + testCID1.String() + " FNa\n"
+	waitStats := func(n uint64) UDPStats {
+		for i := 0; i < 100; i++ {
+			if st := s.Stats(); st.Packets+st.Malformed+st.Dropped == n {
+				return st
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return s.Stats()
+	}
+
+	// the second address is not tracked while the first one occupies the only slot
+	send(c, "garbage")
+	send(c2, "garbage")
+	send(c2, valid)
+	st := waitStats(3)
+	require.Equal(t, uint64(2), st.Malformed)
+	require.Equal(t, uint64(1), st.Packets)
+
+	// expired offenders are evicted and free the slot
+	time.Sleep(3 * s.MalformedWindow)
+	send(c2, "garbage")
+	send(c2, valid)
+	st = waitStats(5)
+	require.Equal(t, uint64(3), st.Malformed)
+	require.Equal(t, uint64(1), st.Dropped)
+}
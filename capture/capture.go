@@ -0,0 +1,186 @@
+// Package capture implements recording and reading of raw ADC and NMDC protocol sessions.
+//
+// Session file starts with a magic string, followed by a JSON header line. The rest of the file
+// is a sequence of binary records, each holding a single protocol message:
+//
+//	dir   byte    - '<' for messages received from the remote peer, '>' for sent messages
+//	time  uvarint - nanoseconds since the session start
+//	size  uvarint - size of the message
+//	data  []byte  - message, including the delimiter
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const magic = "DCCAP1\n"
+
+// maxRecordSize limits the size of a single message in the session file.
+const maxRecordSize = 16 * 1024 * 1024
+
+const (
+	ProtoADC  = "adc"
+	ProtoNMDC = "nmdc"
+)
+
+// Dir is a direction of the message.
+type Dir byte
+
+const (
+	DirRecv = Dir('<') // received from the remote peer
+	DirSend = Dir('>') // sent to the remote peer
+)
+
+func (d Dir) String() string {
+	return string(d)
+}
+
+// Header describes the recorded session.
+type Header struct {
+	Proto  string    `json:"proto"`
+	Local  string    `json:"local,omitempty"`
+	Remote string    `json:"remote,omitempty"`
+	Start  time.Time `json:"start"`
+}
+
+// Delim returns a message delimiter for the session protocol.
+func (h Header) Delim() byte {
+	if h.Proto == ProtoNMDC {
+		return '|'
+	}
+	return '\n'
+}
+
+// Record is a single protocol message in the session.
+type Record struct {
+	Dir  Dir
+	Time time.Duration // since the session start
+	Data []byte        // including the delimiter
+}
+
+// Writer writes session records.
+type Writer struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	start time.Time
+	tmp   [2 * binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes a session header and returns a writer for session records.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	if h.Start.IsZero() {
+		h.Start = time.Now()
+	}
+	h.Start = h.Start.UTC()
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	bw.Write(hdr)
+	if err = bw.WriteByte('\n'); err != nil {
+		return nil, err
+	}
+	return &Writer{w: bw, start: h.Start}, nil
+}
+
+// WriteMessage writes a message with a given direction, using the current time.
+func (w *Writer) WriteMessage(dir Dir, data []byte) error {
+	return w.WriteRecord(Record{Dir: dir, Time: time.Since(w.start), Data: data})
+}
+
+// WriteRecord writes a single record to the session.
+func (w *Writer) WriteRecord(r Record) error {
+	if r.Dir != DirRecv && r.Dir != DirSend {
+		return fmt.Errorf("invalid direction: %q", byte(r.Dir))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := binary.PutUvarint(w.tmp[:], uint64(r.Time))
+	n += binary.PutUvarint(w.tmp[n:], uint64(len(r.Data)))
+	w.w.WriteByte(byte(r.Dir))
+	w.w.Write(w.tmp[:n])
+	_, err := w.w.Write(r.Data)
+	return err
+}
+
+// Flush writes all buffered records to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Flush()
+}
+
+// Reader reads session records.
+type Reader struct {
+	r   *bufio.Reader
+	hdr Header
+}
+
+// NewReader reads a session header and returns a reader for session records.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var m [len(magic)]byte
+	if _, err := io.ReadFull(br, m[:]); err != nil {
+		return nil, err
+	} else if string(m[:]) != magic {
+		return nil, errors.New("not a session file")
+	}
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	rd := &Reader{r: br}
+	if err = json.Unmarshal(line, &rd.hdr); err != nil {
+		return nil, fmt.Errorf("cannot decode session header: %v", err)
+	}
+	return rd, nil
+}
+
+// Header returns the session header.
+func (r *Reader) Header() Header {
+	return r.hdr
+}
+
+// ReadRecord reads the next record from the session. It returns io.EOF at the end of the session.
+func (r *Reader) ReadRecord() (*Record, error) {
+	dir, err := r.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	rec := &Record{Dir: Dir(dir)}
+	if rec.Dir != DirRecv && rec.Dir != DirSend {
+		return nil, fmt.Errorf("invalid direction: %q", dir)
+	}
+	t, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	rec.Time = time.Duration(t)
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	} else if size > maxRecordSize {
+		return nil, fmt.Errorf("record is too large: %d", size)
+	}
+	rec.Data = make([]byte, size)
+	if _, err = io.ReadFull(r.r, rec.Data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return rec, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
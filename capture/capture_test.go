@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestRecorder(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	rec, err := NewRecorder(nopCloser{buf}, Header{Proto: ProtoADC, Remote: "127.0.0.1:1000"})
+	require.NoError(t, err)
+
+	lines := []struct {
+		dir  Dir
+		line string
+		exp  string
+	}{
+		{DirRecv, "HSUP ADBASE ADTIGR\n", ""},
+		{DirSend, "ISID AAAB\n", ""},
+		{DirRecv, "BINF AAAB IDKAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI PDHVBNEMDCTKCD4V3N54X4MMOVLJLJL6PSKVHFXHI NIdennnn\n",
+			"BINF AAAB IDKAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI PDAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA NIdennnn\n"},
+		{DirSend, "IGPA AAAQEAYEAUDAOCAJAAAQEAYCAMCAKBQHBAEQAAI\n", ""},
+		{DirRecv, "HPAS ABZCJESSJKVMIL2BDERHSJ7RF5IYI6ZX2QAOQGI\n", "HPAS AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\n"},
+	}
+	for _, l := range lines {
+		if l.dir == DirRecv {
+			_, err = rec.OnLineR([]byte(l.line))
+		} else {
+			_, err = rec.OnLineW([]byte(l.line))
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, rec.Close())
+
+	r, err := NewReader(buf)
+	require.NoError(t, err)
+	require.Equal(t, ProtoADC, r.Header().Proto)
+	require.Equal(t, "127.0.0.1:1000", r.Header().Remote)
+	for _, l := range lines {
+		m, err := r.ReadRecord()
+		require.NoError(t, err)
+		exp := l.exp
+		if exp == "" {
+			exp = l.line
+		}
+		require.Equal(t, l.dir, m.Dir)
+		require.Equal(t, exp, string(m.Data))
+	}
+	_, err = r.ReadRecord()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestFilterNMDC(t *testing.T) {
+	require.Equal(t, "$MyPass ********|", string(FilterNMDC(DirRecv, []byte("$MyPass secret|"))))
+	require.Equal(t, "$MyINFO $ALL user|", string(FilterNMDC(DirRecv, []byte("$MyINFO $ALL user|"))))
+}
+
+func TestReaderInvalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("not a session\n")))
+	require.Error(t, err)
+
+	w := bytes.NewBuffer(nil)
+	sw, err := NewWriter(w, Header{Proto: ProtoNMDC})
+	require.NoError(t, err)
+	require.NoError(t, sw.WriteMessage(DirRecv, []byte("$Key abc|")))
+	require.NoError(t, sw.Flush())
+	data, err := ioutil.ReadAll(w)
+	require.NoError(t, err)
+
+	// truncated record
+	r, err := NewReader(bytes.NewReader(data[:len(data)-2]))
+	require.NoError(t, err)
+	require.Equal(t, byte('|'), r.Header().Delim())
+	_, err = r.ReadRecord()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
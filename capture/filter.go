@@ -0,0 +1,62 @@
+package capture
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Filter is called for each recorded message and may return a modified copy of it.
+// It must not modify the original message.
+type Filter func(dir Dir, msg []byte) []byte
+
+// FilterFor returns a default privacy filter for a given protocol.
+func FilterFor(proto string) Filter {
+	switch proto {
+	case ProtoADC:
+		return FilterADC
+	case ProtoNMDC:
+		return FilterNMDC
+	}
+	return nil
+}
+
+// redactedCID is a valid base32 encoding of a zero CID or TTH.
+var redactedCID = strings.Repeat("A", 39)
+
+const redactedPass = "********"
+
+// FilterADC removes passwords and private IDs from ADC messages.
+func FilterADC(dir Dir, msg []byte) []byte {
+	if len(msg) < 5 {
+		return msg
+	}
+	if string(msg[:5]) == "HPAS " {
+		return []byte("HPAS " + redactedCID + "\n")
+	}
+	if string(msg[1:4]) != "INF" {
+		return msg
+	}
+	i := bytes.Index(msg, []byte(" PD"))
+	if i < 0 {
+		return msg
+	}
+	i += 3
+	end := i + bytes.IndexAny(msg[i:], " \n")
+	if end < i {
+		end = len(msg)
+	}
+	out := make([]byte, 0, len(msg)-(end-i)+len(redactedCID))
+	out = append(out, msg[:i]...)
+	out = append(out, redactedCID...)
+	out = append(out, msg[end:]...)
+	return out
+}
+
+// FilterNMDC removes passwords from NMDC messages.
+func FilterNMDC(dir Dir, msg []byte) []byte {
+	const cmd = "$MyPass "
+	if !bytes.HasPrefix(msg, []byte(cmd)) {
+		return msg
+	}
+	return []byte(cmd + redactedPass + "|")
+}
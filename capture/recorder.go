@@ -0,0 +1,77 @@
+package capture
+
+import (
+	"io"
+	"sync"
+)
+
+// Recorder records protocol messages to a session file.
+//
+// OnLineR and OnLineW methods can be registered as line hooks on ADC and NMDC connections.
+type Recorder struct {
+	w      *Writer
+	f      io.Closer
+	filter Filter
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewRecorder starts recording the session to w. The default privacy filter for the protocol
+// is applied to all recorded messages. The writer is closed when the recorder is closed.
+func NewRecorder(w io.WriteCloser, h Header) (*Recorder, error) {
+	sw, err := NewWriter(w, h)
+	if err != nil {
+		return nil, err
+	}
+	if err = sw.Flush(); err != nil {
+		return nil, err
+	}
+	return &Recorder{w: sw, f: w, filter: FilterFor(h.Proto)}, nil
+}
+
+// Record writes a single message to the session.
+func (r *Recorder) Record(dir Dir, msg []byte) error {
+	if r.filter != nil {
+		msg = r.filter(dir, msg)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	if err := r.w.WriteMessage(dir, msg); err != nil {
+		return err
+	}
+	// flush each message to keep the session in case of a crash
+	return r.w.Flush()
+}
+
+// OnLineR records a message received from the remote peer.
+// Recording errors are ignored to not affect the connection.
+func (r *Recorder) OnLineR(line []byte) (bool, error) {
+	_ = r.Record(DirRecv, line)
+	return true, nil
+}
+
+// OnLineW records a message sent to the remote peer.
+// Recording errors are ignored to not affect the connection.
+func (r *Recorder) OnLineW(line []byte) (bool, error) {
+	_ = r.Record(DirSend, line)
+	return true, nil
+}
+
+// Close stops the recording and closes the session file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	err := r.w.Flush()
+	if err2 := r.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/spf13/cobra"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/client"
+	"github.com/direct-connect/go-dcpp/adc/types"
+	"github.com/direct-connect/go-dcpp/version"
+)
+
+func main() {
+	if err := Root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+var Root = &cobra.Command{
+	Use:   "dc-get <hub> <magnet|tth|user:/path>",
+	Short: "download a single file from a DC hub",
+	Long: `Connects to an ADC hub, finds the file and downloads it.
+
+The file can be specified as a magnet link, as a TTH or as a user name and a path
+to the file in the user's share (for example "bob:/music/song.mp3").`,
+	Version: version.Vers,
+}
+
+func init() {
+	flags := Root.Flags()
+	name := flags.String("name", "dc-get", "user name to use on the hub")
+	out := flags.StringP("output", "o", "", "output file name (defaults to the name of the remote file)")
+	searchTimeout := flags.Duration("search", 10*time.Second, "time to wait for search results")
+	quiet := flags.BoolP("quiet", "q", false, "don't print the progress")
+
+	Root.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("expected hub address and a file")
+		}
+		target, err := parseTarget(args[1])
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		c, err := client.DialHubContext(ctx, args[0], &client.Config{
+			PID:  types.NewPID(),
+			Name: *name,
+		})
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		log.Printf("connected to %q", c.Hub().Name)
+
+		var sources []fileSource
+		if target.User != "" {
+			p := findPeer(c, target.User)
+			if p == nil {
+				return fmt.Errorf("user %q is not online", target.User)
+			}
+			sources = append(sources, fileSource{peer: p, path: target.Path})
+		} else {
+			log.Printf("searching for %s", target.TTH.Base32())
+			sources, err = searchSources(ctx, c, target.TTH, *searchTimeout)
+			if err != nil {
+				return err
+			}
+			if len(sources) == 0 {
+				return errors.New("no sources found")
+			}
+		}
+		fname := *out
+		if fname == "" {
+			fname = target.Name
+		}
+		for _, s := range sources {
+			if fname == "" {
+				fname = path.Base(s.path)
+			}
+			err = download(ctx, s, target.TTH, fname, !*quiet)
+			if err == nil {
+				return nil
+			}
+			log.Printf("%s: %v", s.peer.Info().Name, err)
+		}
+		return err
+	}
+}
+
+// target is a file to download.
+type target struct {
+	TTH  *adc.TTH
+	Name string
+	User string
+	Path string
+}
+
+// parseTarget parses a magnet link, a TTH or a user and a path.
+func parseTarget(s string) (*target, error) {
+	if strings.HasPrefix(s, "magnet:") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		const prefix = "urn:tree:tiger:"
+		xt := q.Get("xt")
+		if !strings.HasPrefix(xt, prefix) {
+			return nil, fmt.Errorf("unsupported magnet link: %q", s)
+		}
+		var tth adc.TTH
+		if err = tth.FromBase32(strings.TrimPrefix(xt, prefix)); err != nil {
+			return nil, err
+		}
+		t := &target{TTH: &tth, Name: path.Base(q.Get("dn"))}
+		if t.Name == "." || t.Name == "/" {
+			t.Name = ""
+		}
+		return t, nil
+	}
+	if i := strings.Index(s, ":"); i > 0 {
+		return &target{User: s[:i], Path: s[i+1:]}, nil
+	}
+	var tth adc.TTH
+	if err := tth.FromBase32(s); err != nil {
+		return nil, fmt.Errorf("expected magnet link, TTH or user:/path: %v", err)
+	}
+	return &target{TTH: &tth}, nil
+}
+
+func findPeer(c *client.Conn, name string) *client.Peer {
+	for _, p := range c.OnlinePeers() {
+		if p.Info().Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+type fileSource struct {
+	peer  *client.Peer
+	path  string
+	slots int
+}
+
+// searchSources searches the hub for a TTH and returns sources with free slots first.
+func searchSources(ctx context.Context, c *client.Conn, tth *adc.TTH, dt time.Duration) ([]fileSource, error) {
+	ctx, cancel := context.WithTimeout(ctx, dt)
+	defer cancel()
+	results, err := c.Search(ctx, client.Search{TTH: tth})
+	if err != nil {
+		return nil, err
+	}
+	var out []fileSource
+	seen := make(map[adc.CID]struct{})
+	for r := range results {
+		if r.Peer == nil || r.Dir || r.TTH == nil || *r.TTH != *tth {
+			continue
+		}
+		cid := r.Peer.Info().Id
+		if _, ok := seen[cid]; ok {
+			continue
+		}
+		seen[cid] = struct{}{}
+		out = append(out, fileSource{peer: r.Peer, path: r.Path, slots: r.Slots})
+		if r.Slots > 0 && len(out) >= 5 {
+			// enough good sources
+			break
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].slots > out[j].slots
+	})
+	return out, nil
+}
+
+func download(ctx context.Context, s fileSource, tth *adc.TTH, fname string, progress bool) error {
+	log.Printf("downloading from %s", s.peer.Info().Name)
+	pc, err := s.peer.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	fpath := s.path
+	if tth != nil {
+		fpath = "TTH/" + tth.Base32()
+	}
+	f, err := pc.GetFile(ctx, fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if tth == nil {
+		tth = f.TTH()
+	}
+
+	out, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var n int64
+	stop := make(chan struct{})
+	defer close(stop)
+	if progress {
+		go printProgress(stop, &n, f.Size())
+	}
+	_, err = io.Copy(io.MultiWriter(out, counter{&n}), f)
+	if err != nil {
+		os.Remove(fname)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if tth != nil {
+		if err = verifyFile(fname, *tth); err != nil {
+			os.Remove(fname)
+			return err
+		}
+	}
+	log.Printf("saved to %s (%d bytes)", fname, atomic.LoadInt64(&n))
+	return nil
+}
+
+func verifyFile(fname string, tth adc.TTH) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	got, err := tiger.TreeHash(f)
+	if err != nil {
+		return err
+	} else if got != tth {
+		return fmt.Errorf("tth mismatch: expected %s, got %s", tth, got)
+	}
+	return nil
+}
+
+type counter struct {
+	n *int64
+}
+
+func (c counter) Write(p []byte) (int, error) {
+	atomic.AddInt64(c.n, int64(len(p)))
+	return len(p), nil
+}
+
+func printProgress(stop <-chan struct{}, n *int64, size int64) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var last int64
+	for {
+		select {
+		case <-stop:
+			fmt.Fprintln(os.Stderr)
+			return
+		case <-ticker.C:
+		}
+		cur := atomic.LoadInt64(n)
+		pct := 100.0
+		if size > 0 {
+			pct = float64(cur) * 100 / float64(size)
+		}
+		fmt.Fprintf(os.Stderr, "\r%d / %d bytes (%.1f%%), %d KB/s    ", cur, size, pct, (cur-last)/1024)
+		last = cur
+	}
+}
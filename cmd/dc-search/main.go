@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/client"
+	"github.com/direct-connect/go-dcpp/adc/types"
+	"github.com/direct-connect/go-dcpp/version"
+)
+
+func main() {
+	if err := Root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+var Root = &cobra.Command{
+	Use:   "dc-search [flags] <terms...>",
+	Short: "search for files on multiple DC hubs",
+	Long: `Connects to ADC hubs, runs a search on all of them and prints aggregated results.
+
+Hubs are read from the --hub flags and from the "hubs" list in the config file
+(dc-search.yml in the current directory by default).`,
+	Version: version.Vers,
+}
+
+// Config is a dc-search config file.
+type Config struct {
+	Name string   `yaml:"name"`
+	Hubs []string `yaml:"hubs"`
+}
+
+var fileTypes = map[string]adc.ExtGroup{
+	"audio":   adc.ExtAudio,
+	"archive": adc.ExtArch,
+	"doc":     adc.ExtDoc,
+	"exe":     adc.ExtExe,
+	"image":   adc.ExtImage,
+	"video":   adc.ExtVideo,
+}
+
+func init() {
+	flags := Root.Flags()
+	confPath := flags.String("config", "", "config file")
+	flags.String("name", "dc-search", "user name to use on hubs")
+	viper.BindPFlag("name", flags.Lookup("name"))
+	hubs := flags.StringSlice("hub", nil, "hub address (can be specified multiple times)")
+	typ := flags.String("type", "", "result type: file, dir, or a file group (audio, archive, doc, exe, image, video)")
+	exts := flags.StringSlice("ext", nil, "file extensions")
+	minSize := flags.Int64("min-size", 0, "minimal file size in bytes")
+	maxSize := flags.Int64("max-size", 0, "maximal file size in bytes")
+	tth := flags.String("tth", "", "search by TTH")
+	timeout := flags.Duration("timeout", 10*time.Second, "time to wait for results")
+	asJSON := flags.Bool("json", false, "print results as JSON")
+
+	Root.RunE = func(cmd *cobra.Command, args []string) error {
+		conf, err := readConfig(*confPath)
+		if err != nil {
+			return err
+		}
+		conf.Hubs = append(conf.Hubs, *hubs...)
+		if len(conf.Hubs) == 0 {
+			return errors.New("no hubs specified")
+		}
+		s := client.Search{
+			And: args, Ext: *exts,
+			MinSize: *minSize, MaxSize: *maxSize,
+		}
+		switch *typ {
+		case "":
+		case "file":
+			s.Type = adc.FileTypeFile
+		case "dir":
+			s.Type = adc.FileTypeDir
+		default:
+			g, ok := fileTypes[*typ]
+			if !ok {
+				return fmt.Errorf("unsupported type: %q", *typ)
+			}
+			s.Group = g
+		}
+		if *tth != "" {
+			var h adc.TTH
+			if err := h.FromBase32(*tth); err != nil {
+				return err
+			}
+			s.TTH = &h
+		} else if len(args) == 0 && len(s.Ext) == 0 {
+			return errors.New("expected search terms")
+		}
+
+		res := searchAll(conf, s, *timeout)
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			return enc.Encode(res)
+		}
+		printTable(os.Stdout, res)
+		return nil
+	}
+}
+
+func readConfig(path string) (*Config, error) {
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.AddConfigPath(".")
+		viper.SetConfigName("dc-search")
+	}
+	err := viper.ReadInConfig()
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok && path == "" {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := viper.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Source is a single user that has the file.
+type Source struct {
+	Hub   string `json:"hub"`
+	User  string `json:"user"`
+	Path  string `json:"path"`
+	Slots int    `json:"slots"`
+}
+
+// Result is a file or a directory found on one or more hubs.
+type Result struct {
+	Name    string   `json:"name"`
+	Dir     bool     `json:"dir,omitempty"`
+	Size    int64    `json:"size"`
+	TTH     *adc.TTH `json:"tth,omitempty"`
+	Sources []Source `json:"sources"`
+}
+
+// Slots returns the number of free slots on all sources.
+func (r *Result) Slots() int {
+	n := 0
+	for _, s := range r.Sources {
+		n += s.Slots
+	}
+	return n
+}
+
+// aggregator deduplicates results by TTH. Directories are deduplicated by name and size.
+type aggregator struct {
+	mu      sync.Mutex
+	results map[string]*Result
+}
+
+func (a *aggregator) add(hub string, r client.SearchResult) {
+	if r.Peer == nil {
+		return
+	}
+	name := path.Base(strings.TrimSuffix(r.Path, "/"))
+	var key string
+	if r.TTH != nil && !r.Dir {
+		key = "tth:" + r.TTH.Base32()
+	} else {
+		key = fmt.Sprintf("dir:%s:%d", name, r.Size)
+	}
+	src := Source{Hub: hub, User: r.Peer.Info().Name, Path: r.Path, Slots: r.Slots}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := a.results[key]
+	if res == nil {
+		res = &Result{Name: name, Dir: r.Dir, Size: r.Size, TTH: r.TTH}
+		a.results[key] = res
+	}
+	for _, s := range res.Sources {
+		if s == src {
+			return
+		}
+	}
+	res.Sources = append(res.Sources, src)
+}
+
+// sorted returns results with the most sources first.
+func (a *aggregator) sorted() []*Result {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]*Result, 0, len(a.results))
+	for _, r := range a.results {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i].Sources) != len(out[j].Sources) {
+			return len(out[i].Sources) > len(out[j].Sources)
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func searchAll(conf *Config, s client.Search, timeout time.Duration) []*Result {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	agg := &aggregator{results: make(map[string]*Result)}
+	var wg sync.WaitGroup
+	for _, addr := range conf.Hubs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if err := searchHub(ctx, conf.Name, addr, s, agg); err != nil {
+				log.Printf("%s: %v", addr, err)
+			}
+		}(addr)
+	}
+	wg.Wait()
+	return agg.sorted()
+}
+
+func searchHub(ctx context.Context, name, addr string, s client.Search, agg *aggregator) error {
+	c, err := client.DialHubContext(ctx, addr, &client.Config{
+		PID:  types.NewPID(),
+		Name: name,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	results, err := c.Search(ctx, s)
+	if err != nil {
+		return err
+	}
+	for r := range results {
+		agg.add(addr, r)
+	}
+	return nil
+}
+
+func printTable(w io.Writer, res []*Result) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tSOURCES\tSLOTS\tTTH")
+	for _, r := range res {
+		name, tth := r.Name, ""
+		if r.Dir {
+			name += "/"
+		}
+		if r.TTH != nil {
+			tth = r.TTH.Base32()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", name, r.Size, len(r.Sources), r.Slots(), tth)
+	}
+	tw.Flush()
+}
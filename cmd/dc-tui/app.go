@@ -0,0 +1,653 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/client"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+const (
+	userListWidth = 20
+	maxLines      = 1000
+
+	dialTimeout  = 30 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+type winKind int
+
+const (
+	winStatus = winKind(iota)
+	winHub
+	winPM
+	winSearch
+	winTransfers
+)
+
+// window is a single tab of the client.
+type window struct {
+	kind   winKind
+	title  string
+	hub    *hubConn
+	peer   *client.Peer // for PMs
+	lines  []string
+	unread bool
+	scroll int // lines from the bottom
+
+	results []client.SearchResult
+	cancel  func()
+}
+
+func (w *window) println(format string, args ...interface{}) {
+	line := time.Now().Format("15:04:05 ") + fmt.Sprintf(format, args...)
+	w.lines = append(w.lines, line)
+	if len(w.lines) > maxLines {
+		w.lines = w.lines[len(w.lines)-maxLines:]
+	}
+}
+
+type hubConn struct {
+	addr string
+	c    *client.Conn
+}
+
+func (h *hubConn) name() string {
+	if name := h.c.Hub().Name; name != "" {
+		return name
+	}
+	return h.addr
+}
+
+// transfer is a single download.
+type transfer struct {
+	name  string
+	size  int64
+	tr    *client.Transfer
+	err   error
+	done  bool
+	start time.Time
+}
+
+// app is the client state. All fields are only accessed from the main loop;
+// other goroutines post updates with app.post.
+type app struct {
+	name  string
+	term  *terminal
+	stats *client.Stats
+
+	events chan func()
+	wins   []*window
+	cur    int
+	input  []rune
+	quit   bool
+
+	transfers []*transfer
+}
+
+func newApp(name string, t *terminal) *app {
+	a := &app{
+		name: name, term: t,
+		stats:  client.NewStats(),
+		events: make(chan func(), 256),
+	}
+	st := &window{kind: winStatus, title: "status"}
+	st.println("Type /help for the list of commands.")
+	a.wins = append(a.wins, st)
+	return a
+}
+
+// post runs the function on the main loop.
+func (a *app) post(fnc func()) {
+	a.events <- fnc
+}
+
+// logWriter redirects the log output to the status window.
+type logWriter struct {
+	a *app
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	w.a.post(func() {
+		w.a.wins[0].println("%s", line)
+		w.a.markUnread(w.a.wins[0])
+	})
+	return len(p), nil
+}
+
+func (a *app) run(keys <-chan []key, resize <-chan os.Signal) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	a.draw()
+	for !a.quit {
+		select {
+		case fnc := <-a.events:
+			fnc()
+		case ks, ok := <-keys:
+			if !ok {
+				return
+			}
+			for _, k := range ks {
+				a.handleKey(k)
+			}
+		case <-resize:
+		case <-ticker.C:
+			if a.current().kind != winTransfers {
+				continue
+			}
+		}
+		a.draw()
+	}
+}
+
+func (a *app) current() *window {
+	return a.wins[a.cur]
+}
+
+func (a *app) markUnread(w *window) {
+	if w != a.current() {
+		w.unread = true
+	}
+}
+
+func (a *app) focus(i int) {
+	n := len(a.wins)
+	a.cur = ((i % n) + n) % n
+	a.current().unread = false
+}
+
+func (a *app) open(w *window) {
+	a.wins = append(a.wins, w)
+	a.focus(len(a.wins) - 1)
+}
+
+func (a *app) find(fnc func(w *window) bool) *window {
+	for _, w := range a.wins {
+		if fnc(w) {
+			return w
+		}
+	}
+	return nil
+}
+
+func (a *app) closeWindow(w *window) {
+	if w.kind == winStatus {
+		return
+	}
+	if w.cancel != nil {
+		w.cancel()
+	}
+	if w.kind == winHub {
+		_ = w.hub.c.Close()
+	}
+	for i, w2 := range a.wins {
+		if w2 == w {
+			a.wins = append(a.wins[:i], a.wins[i+1:]...)
+			break
+		}
+	}
+	if a.cur >= len(a.wins) {
+		a.cur = len(a.wins) - 1
+	}
+	a.focus(a.cur)
+}
+
+func (a *app) handleKey(k key) {
+	w := a.current()
+	switch k.kind {
+	case keyRune:
+		a.input = append(a.input, k.r)
+	case keyBackspace:
+		if len(a.input) != 0 {
+			a.input = a.input[:len(a.input)-1]
+		}
+	case keyCtrlU, keyEsc:
+		a.input = a.input[:0]
+	case keyEnter:
+		line := strings.TrimSpace(string(a.input))
+		a.input = a.input[:0]
+		if line != "" {
+			a.exec(line)
+		}
+	case keyTab, keyCtrlN, keyRight:
+		a.focus(a.cur + 1)
+	case keyBackTab, keyCtrlP, keyLeft:
+		a.focus(a.cur - 1)
+	case keyPgUp, keyUp:
+		w.scroll += 5
+		if max := len(w.lines) - 1; w.scroll > max {
+			w.scroll = max
+		}
+		if w.scroll < 0 {
+			w.scroll = 0
+		}
+	case keyPgDn, keyDown:
+		w.scroll -= 5
+		if w.scroll < 0 {
+			w.scroll = 0
+		}
+	case keyCtrlC:
+		a.quit = true
+	}
+}
+
+const helpText = `Commands:
+  /connect <adc://host:port>  connect to a hub
+  /pm <user> [text]           open a private chat
+  /search <terms>             search on the current hub
+  /get <n>                    download a search result to the current directory
+  /transfers                  show transfers
+  /close                      close the current window
+  /quit                       exit
+Keys: Tab/Ctrl-N - next window, Shift-Tab/Ctrl-P - previous, PgUp/PgDn - scroll.`
+
+func (a *app) exec(line string) {
+	w := a.current()
+	if !strings.HasPrefix(line, "/") {
+		a.say(w, line)
+		return
+	}
+	cmd, arg := line[1:], ""
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		cmd, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	switch cmd {
+	case "help":
+		for _, l := range strings.Split(helpText, "\n") {
+			w.println("%s", l)
+		}
+	case "quit", "exit":
+		a.quit = true
+	case "close":
+		a.closeWindow(w)
+	case "connect":
+		if arg == "" {
+			w.println("usage: /connect <address>")
+			return
+		}
+		a.connect(arg)
+	case "pm":
+		a.openPM(w, arg)
+	case "search":
+		a.search(w, arg)
+	case "get":
+		a.get(w, arg)
+	case "transfers":
+		if tw := a.find(func(w *window) bool { return w.kind == winTransfers }); tw != nil {
+			a.focus(a.index(tw))
+		} else {
+			a.open(&window{kind: winTransfers, title: "transfers"})
+		}
+	default:
+		w.println("unknown command: /%s", cmd)
+	}
+}
+
+func (a *app) index(w *window) int {
+	for i, w2 := range a.wins {
+		if w2 == w {
+			return i
+		}
+	}
+	return 0
+}
+
+// say sends a chat message to the hub or to the peer.
+func (a *app) say(w *window, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	var err error
+	switch w.kind {
+	case winHub:
+		err = w.hub.c.SendChat(ctx, text)
+	case winPM:
+		err = w.hub.c.SendPM(ctx, w.peer, text)
+		if err == nil {
+			w.println("<%s> %s", a.name, text)
+		}
+	default:
+		w.println("chat is not available in this window")
+		return
+	}
+	if err != nil {
+		w.println("error: %v", err)
+	}
+}
+
+func (a *app) connect(addr string) {
+	st := a.wins[0]
+	st.println("connecting to %s...", addr)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		defer cancel()
+		c, err := client.DialHubContext(ctx, addr, &client.Config{
+			PID:  types.NewPID(),
+			Name: a.name,
+		})
+		a.post(func() {
+			if err != nil {
+				st.println("%s: %v", addr, err)
+				return
+			}
+			h := &hubConn{addr: addr, c: c}
+			hw := &window{kind: winHub, hub: h, title: h.name()}
+			hw.println("connected to %s", h.name())
+			c.OnMessage(func(m client.Message) {
+				a.post(func() { a.message(h, m) })
+			})
+			a.open(hw)
+		})
+	}()
+}
+
+func (a *app) message(h *hubConn, m client.Message) {
+	var w *window
+	if m.PM && m.From != nil {
+		w = a.find(func(w *window) bool {
+			return w.kind == winPM && w.hub == h && w.peer == m.From
+		})
+		if w == nil {
+			w = &window{kind: winPM, hub: h, peer: m.From, title: m.From.Info().Name}
+			a.wins = append(a.wins, w)
+		}
+	} else {
+		w = a.find(func(w *window) bool { return w.kind == winHub && w.hub == h })
+		if w == nil {
+			return
+		}
+	}
+	from := "*hub*"
+	if m.From != nil {
+		from = m.From.Info().Name
+	} else if m.Self {
+		from = a.name
+	}
+	if m.Me {
+		w.println("* %s %s", from, m.Text)
+	} else {
+		w.println("<%s> %s", from, m.Text)
+	}
+	a.markUnread(w)
+}
+
+func (a *app) findPeer(h *hubConn, name string) *client.Peer {
+	for _, p := range h.c.OnlinePeers() {
+		if p.Info().Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (a *app) openPM(w *window, arg string) {
+	if w.hub == nil {
+		w.println("not connected to a hub")
+		return
+	}
+	name, text := arg, ""
+	if i := strings.IndexByte(arg, ' '); i >= 0 {
+		name, text = arg[:i], strings.TrimSpace(arg[i+1:])
+	}
+	p := a.findPeer(w.hub, name)
+	if p == nil {
+		w.println("user %q is not online", name)
+		return
+	}
+	pw := a.find(func(w2 *window) bool {
+		return w2.kind == winPM && w2.hub == w.hub && w2.peer == p
+	})
+	if pw == nil {
+		pw = &window{kind: winPM, hub: w.hub, peer: p, title: name}
+		a.open(pw)
+	} else {
+		a.focus(a.index(pw))
+	}
+	if text != "" {
+		a.say(pw, text)
+	}
+}
+
+func (a *app) search(w *window, arg string) {
+	if w.hub == nil {
+		w.println("not connected to a hub")
+		return
+	} else if arg == "" {
+		w.println("usage: /search <terms>")
+		return
+	}
+	s := client.Search{And: strings.Fields(arg)}
+	if len(arg) == 39 {
+		var tth adc.TTH
+		if err := tth.FromBase32(arg); err == nil {
+			s = client.Search{TTH: &tth}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := w.hub.c.Search(ctx, s)
+	if err != nil {
+		cancel()
+		w.println("search failed: %v", err)
+		return
+	}
+	sw := &window{kind: winSearch, hub: w.hub, title: "search: " + arg, cancel: cancel}
+	sw.println("searching for %q...", arg)
+	a.open(sw)
+	go func() {
+		for r := range results {
+			r := r
+			a.post(func() {
+				sw.results = append(sw.results, r)
+				name := r.Name()
+				if r.Dir {
+					name += "/"
+				}
+				user := "?"
+				if r.Peer != nil {
+					user = r.Peer.Info().Name
+				}
+				sw.println("[%d] %s (%d bytes, %s, %d slots)", len(sw.results), name, r.Size, user, r.Slots)
+				a.markUnread(sw)
+			})
+		}
+		a.post(func() {
+			sw.println("search finished: %d results", len(sw.results))
+		})
+	}()
+}
+
+func (a *app) get(w *window, arg string) {
+	if w.kind != winSearch {
+		w.println("downloads are only available in search windows")
+		return
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(w.results) {
+		w.println("usage: /get <result number>")
+		return
+	}
+	r := w.results[n-1]
+	if r.Dir || r.Peer == nil {
+		w.println("only files can be downloaded")
+		return
+	}
+	t := &transfer{
+		name: path.Base(r.Path), size: r.Size, start: time.Now(),
+		tr: a.stats.Start(r.Peer.Info().Id, client.Download),
+	}
+	a.transfers = append(a.transfers, t)
+	w.println("downloading %s, see /transfers", t.name)
+	go func() {
+		err := download(r, t)
+		t.tr.Done(err)
+		a.post(func() {
+			t.done, t.err = true, err
+			if err != nil {
+				a.wins[0].println("download of %s failed: %v", t.name, err)
+			} else {
+				a.wins[0].println("downloaded %s", t.name)
+			}
+			a.markUnread(a.wins[0])
+		})
+	}()
+}
+
+func download(r client.SearchResult, t *transfer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	pc, err := r.Peer.Dial(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	fpath := r.Path
+	if r.TTH != nil {
+		fpath = "TTH/" + r.TTH.Base32()
+	}
+	f, err := pc.GetFile(context.Background(), fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out, err := os.Create(t.name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.tr.Writer(out), f)
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// draw renders the whole screen.
+func (a *app) draw() {
+	width, height := a.term.Size()
+	s := &screen{w: width, h: height}
+	s.clear()
+	w := a.current()
+
+	// tab bar
+	col := 1
+	for i, win := range a.wins {
+		title := fmt.Sprintf(" %d:%s ", i+1, win.title)
+		if win.unread {
+			title = fmt.Sprintf(" %d:%s* ", i+1, win.title)
+		}
+		if col > width {
+			break
+		}
+		attrs := []string{attrDim}
+		if i == a.cur {
+			attrs = []string{attrReverse}
+		} else if win.unread {
+			attrs = []string{attrBold}
+		}
+		s.put(1, col, width-col+1, title, attrs...)
+		col += len([]rune(title)) + 1
+	}
+
+	// main area and the user list
+	top, bottom := 2, height-2
+	mainWidth := width
+	if w.hub != nil && w.kind != winSearch && width > 2*userListWidth {
+		mainWidth = width - userListWidth - 1
+		a.drawUsers(s, w.hub, mainWidth+1, top, bottom)
+	}
+	var lines []string
+	if w.kind == winTransfers {
+		lines = a.transferLines()
+	} else {
+		lines = w.lines
+	}
+	var wrapped []string
+	for _, l := range lines {
+		wrapped = append(wrapped, wrap(l, mainWidth)...)
+	}
+	rows := bottom - top + 1
+	end := len(wrapped) - w.scroll
+	if end < 0 {
+		end = 0
+	}
+	start := end - rows
+	if start < 0 {
+		start = 0
+	}
+	for i, l := range wrapped[start:end] {
+		s.put(top+i, 1, mainWidth, l)
+	}
+
+	// status and input lines
+	status := fmt.Sprintf(" [%s] %s", a.name, w.title)
+	if w.hub != nil {
+		status += fmt.Sprintf(" | %s, %d users", w.hub.name(), len(w.hub.c.OnlinePeers()))
+	}
+	if n := a.activeTransfers(); n != 0 {
+		status += fmt.Sprintf(" | %d transfers", n)
+	}
+	if w.scroll != 0 {
+		status += " | scrolled"
+	}
+	s.put(height-1, 1, width, status+strings.Repeat(" ", width), attrReverse)
+	input := string(a.input)
+	if r := []rune(input); len(r) > width-3 {
+		input = string(r[len(r)-(width-3):])
+	}
+	s.put(height, 1, width, "> "+input)
+	s.cursor(height, 3+len([]rune(input)))
+	a.term.draw(s)
+}
+
+func (a *app) drawUsers(s *screen, h *hubConn, col, top, bottom int) {
+	peers := h.c.OnlinePeers()
+	names := make([]string, 0, len(peers))
+	for _, p := range peers {
+		names = append(names, p.Info().Name)
+	}
+	sort.Strings(names)
+	for row := top; row <= bottom; row++ {
+		s.put(row, col, 1, "|", attrDim)
+		if i := row - top; i < len(names) {
+			s.put(row, col+1, userListWidth, names[i])
+		}
+	}
+}
+
+func (a *app) activeTransfers() int {
+	n := 0
+	for _, t := range a.transfers {
+		if !t.done {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *app) transferLines() []string {
+	lines := []string{"Transfers:"}
+	for _, t := range a.transfers {
+		state := fmt.Sprintf("%d KB/s", t.tr.Speed()/1024)
+		if t.err != nil {
+			state = "failed: " + t.err.Error()
+		} else if t.done {
+			state = "done"
+		}
+		pct := 100.0
+		if t.size > 0 {
+			pct = float64(t.tr.Bytes()) * 100 / float64(t.size)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %d/%d bytes (%.1f%%)  %s", t.name, t.tr.Bytes(), t.size, pct, state))
+	}
+	total := a.stats.Total()
+	lines = append(lines, "", fmt.Sprintf("Total downloaded: %d bytes in %d transfers", total.Down.Bytes, total.Down.Transfers))
+	return lines
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// key is a single key press. Special keys have a zero rune.
+type key struct {
+	r    rune
+	kind keyKind
+}
+
+type keyKind int
+
+const (
+	keyRune = keyKind(iota)
+	keyEnter
+	keyBackspace
+	keyTab
+	keyBackTab
+	keyCtrlC
+	keyCtrlN
+	keyCtrlP
+	keyCtrlU
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPgUp
+	keyPgDn
+	keyEsc
+)
+
+var escKeys = map[string]keyKind{
+	"\x1b[A":  keyUp,
+	"\x1b[B":  keyDown,
+	"\x1b[C":  keyRight,
+	"\x1b[D":  keyLeft,
+	"\x1b[Z":  keyBackTab,
+	"\x1b[5~": keyPgUp,
+	"\x1b[6~": keyPgDn,
+}
+
+var ctrlKeys = map[byte]keyKind{
+	'\r':   keyEnter,
+	'\n':   keyEnter,
+	0x7f:   keyBackspace,
+	0x08:   keyBackspace,
+	'\t':   keyTab,
+	0x03:   keyCtrlC,
+	0x0e:   keyCtrlN,
+	0x10:   keyCtrlP,
+	0x15:   keyCtrlU,
+	'\x1b': keyEsc,
+}
+
+// parseKeys decodes key presses from the buffer. It returns the number of bytes consumed;
+// incomplete sequences are left in the buffer.
+func parseKeys(buf []byte, out []key) ([]key, int) {
+	i := 0
+	for i < len(buf) {
+		b := buf[i]
+		if b == 0x1b && i+1 < len(buf) && buf[i+1] == '[' {
+			// CSI sequence: ends with a byte in 0x40-0x7e range
+			j := i + 2
+			for j < len(buf) && (buf[j] < 0x40 || buf[j] > 0x7e) {
+				j++
+			}
+			if j >= len(buf) {
+				break
+			}
+			if k, ok := escKeys[string(buf[i:j+1])]; ok {
+				out = append(out, key{kind: k})
+			}
+			i = j + 1
+			continue
+		}
+		if k, ok := ctrlKeys[b]; ok {
+			out = append(out, key{kind: k})
+			i++
+			continue
+		}
+		if b < ' ' {
+			// unsupported control key
+			i++
+			continue
+		}
+		if !utf8.FullRune(buf[i:]) {
+			break
+		}
+		r, n := utf8.DecodeRune(buf[i:])
+		out = append(out, key{r: r})
+		i += n
+	}
+	return out, i
+}
+
+// readKeys reads key presses from the reader and sends them to the channel.
+func readKeys(r io.Reader, ch chan<- []key) {
+	var (
+		buf  bytes.Buffer
+		data = make([]byte, 256)
+	)
+	for {
+		n, err := r.Read(data)
+		if err != nil {
+			close(ch)
+			return
+		}
+		buf.Write(data[:n])
+		keys, used := parseKeys(buf.Bytes(), nil)
+		buf.Next(used)
+		if len(keys) != 0 {
+			ch <- keys
+		}
+	}
+}
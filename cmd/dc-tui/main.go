@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/direct-connect/go-dcpp/version"
+)
+
+func main() {
+	if err := Root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+var Root = &cobra.Command{
+	Use:     "dc-tui [hubs...]",
+	Short:   "terminal DC client",
+	Version: version.Vers,
+}
+
+func init() {
+	flags := Root.Flags()
+	name := flags.String("name", "dc-tui", "user name to use on hubs")
+
+	Root.RunE = func(cmd *cobra.Command, args []string) error {
+		t, err := openTerminal()
+		if err != nil {
+			return err
+		}
+		defer t.Close()
+
+		a := newApp(*name, t)
+		log.SetFlags(0)
+		log.SetOutput(logWriter{a})
+		defer log.SetOutput(os.Stderr)
+
+		for _, addr := range args {
+			a.connect(addr)
+		}
+
+		keys := make(chan []key)
+		go readKeys(os.Stdin, keys)
+		resize := make(chan os.Signal, 1)
+		stop := notifyResize(resize)
+		defer stop()
+
+		a.run(keys, resize)
+		for _, w := range a.wins {
+			if w.kind == winHub {
+				_ = w.hub.c.Close()
+			}
+		}
+		return nil
+	}
+}
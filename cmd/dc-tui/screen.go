@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// screen accumulates a single frame.
+type screen struct {
+	w, h int
+	buf  strings.Builder
+}
+
+func (s *screen) clear() {
+	s.buf.WriteString("\x1b[?25l\x1b[H\x1b[2J")
+}
+
+// put writes the text at a given position, truncated to n columns.
+func (s *screen) put(row, col, n int, text string, attrs ...string) {
+	if row < 1 || row > s.h || n <= 0 {
+		return
+	}
+	fmt.Fprintf(&s.buf, "\x1b[%d;%dH", row, col)
+	for _, a := range attrs {
+		s.buf.WriteString(a)
+	}
+	s.buf.WriteString(truncate(text, n))
+	if len(attrs) != 0 {
+		s.buf.WriteString(attrReset)
+	}
+}
+
+func (s *screen) cursor(row, col int) {
+	fmt.Fprintf(&s.buf, "\x1b[%d;%dH\x1b[?25h", row, col)
+}
+
+const (
+	attrReset   = "\x1b[0m"
+	attrReverse = "\x1b[7m"
+	attrBold    = "\x1b[1m"
+	attrDim     = "\x1b[2m"
+)
+
+// truncate cuts the string to n runes and replaces control characters.
+func truncate(s string, n int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if n <= 0 {
+			break
+		}
+		if r < ' ' || r == 0x7f {
+			r = ' '
+		}
+		b.WriteRune(r)
+		n--
+	}
+	return b.String()
+}
+
+// wrap splits the text into lines of at most n runes.
+func wrap(s string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		for utf8.RuneCountInString(line) > n {
+			r := []rune(line)
+			out = append(out, string(r[:n]))
+			line = string(r[n:])
+		}
+		out = append(out, line)
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminal is a minimal ANSI terminal in raw mode.
+type terminal struct {
+	fd  int
+	old unix.Termios
+	out *bufio.Writer
+}
+
+func openTerminal() (*terminal, error) {
+	fd := int(os.Stdin.Fd())
+	st, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, fmt.Errorf("not a terminal: %v", err)
+	}
+	t := &terminal{fd: fd, old: *st, out: bufio.NewWriter(os.Stdout)}
+	raw := *st
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	// alternate screen
+	t.out.WriteString("\x1b[?1049h")
+	t.out.Flush()
+	return t, nil
+}
+
+// notifyResize sends a signal to the channel when the terminal is resized.
+func notifyResize(ch chan<- os.Signal) func() {
+	signal.Notify(ch, unix.SIGWINCH)
+	return func() { signal.Stop(ch) }
+}
+
+// Close restores the terminal state.
+func (t *terminal) Close() error {
+	t.out.WriteString("\x1b[?1049l\x1b[?25h")
+	t.out.Flush()
+	return unix.IoctlSetTermios(t.fd, ioctlSetTermios, &t.old)
+}
+
+// Size returns the terminal size.
+func (t *terminal) Size() (w, h int) {
+	ws, err := unix.IoctlGetWinsize(t.fd, unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+func (t *terminal) draw(s *screen) {
+	t.out.WriteString(s.buf.String())
+	t.out.Flush()
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// terminal is not implemented on this platform.
+type terminal struct{}
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("terminal is not supported on this platform")
+}
+
+func notifyResize(ch chan<- os.Signal) func() { return func() {} }
+
+func (t *terminal) Close() error     { return nil }
+func (t *terminal) Size() (w, h int) { return 80, 24 }
+func (t *terminal) draw(s *screen)   {}
@@ -68,7 +68,15 @@ func init() {
 				}
 				bans = append(bans, hub.Ban{Key: hub.MinIPKey(ip), Hard: true})
 			}
-			return hubDB.PutBans(bans)
+			if err := hubDB.PutBans(bans); err != nil {
+				return err
+			}
+			for _, ip := range args {
+				if err := auditDB(hub.AuditBan, ip, ""); err != nil {
+					return err
+				}
+			}
+			return nil
 		},
 	}
 	cmdBans.AddCommand(cmdBanIP)
@@ -89,7 +97,15 @@ func init() {
 				}
 				bans = append(bans, hub.MinIPKey(ip))
 			}
-			return hubDB.DelBans(bans)
+			if err := hubDB.DelBans(bans); err != nil {
+				return err
+			}
+			for _, ip := range args {
+				if err := auditDB(hub.AuditUnban, ip, ""); err != nil {
+					return err
+				}
+			}
+			return nil
 		},
 	}
 	cmdBans.AddCommand(cmdUnbanIP)
@@ -101,7 +117,10 @@ func init() {
 			if len(args) != 0 {
 				return errors.New("expected no arguments")
 			}
-			return hubDB.ClearBans()
+			if err := hubDB.ClearBans(); err != nil {
+				return err
+			}
+			return auditDB(hub.AuditUnban, "*", "ban list cleared")
 		},
 	}
 	cmdBans.AddCommand(cmdClear)
@@ -3,6 +3,7 @@ package cmd
 import (
 	"errors"
 	"log"
+	"time"
 
 	"github.com/direct-connect/go-dcpp/hub"
 	"github.com/direct-connect/go-dcpp/hub/hubdb"
@@ -25,6 +26,20 @@ func OpenDB() error {
 	return nil
 }
 
+// auditActor is the name recorded in the audit log for actions done from the command line.
+const auditActor = "console"
+
+// auditDB records an administrative action done from the command line.
+func auditDB(action, target, reason string) error {
+	return hubDB.AppendAudit(hub.AuditEntry{
+		Time:   time.Now().UTC(),
+		Action: action,
+		Actor:  auditActor,
+		Target: target,
+		Reason: reason,
+	})
+}
+
 func CloseDB() error {
 	if hubDB == nil {
 		return nil
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/pprof"
+	rpprof "runtime/pprof"
+
+	"github.com/direct-connect/go-dcpp/hub"
+)
+
+// pprofHandler returns a handler for pprof endpoints under hub.HTTPDebugPath. It doesn't check any credentials.
+//
+// The endpoints are mounted explicitly; the default mux of the http package is never served.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(hub.HTTPDebugPath, pprof.Index)
+	mux.HandleFunc(hub.HTTPDebugPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(hub.HTTPDebugPath+"profile", pprof.Profile)
+	mux.HandleFunc(hub.HTTPDebugPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(hub.HTTPDebugPath+"trace", pprof.Trace)
+	for _, p := range rpprof.Profiles() {
+		mux.Handle(hub.HTTPDebugPath+p.Name(), pprof.Handler(p.Name()))
+	}
+	return mux
+}
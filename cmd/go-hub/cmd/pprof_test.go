@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/hub"
+)
+
+func TestPProfHandler(t *testing.T) {
+	h := pprofHandler()
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", hub.HTTPDebugPath+path, nil))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusOK, get(""))
+	require.Equal(t, http.StatusOK, get("goroutine?debug=1"))
+	require.Equal(t, http.StatusOK, get("heap"))
+	require.Equal(t, http.StatusOK, get("symbol"))
+	require.Equal(t, http.StatusNotFound, get("unknown"))
+}
@@ -106,7 +106,10 @@ func init() {
 				}
 				m[hub.ProfileParent] = parent
 			}
-			return hubDB.PutProfile(name, m)
+			if err := hubDB.PutProfile(name, m); err != nil {
+				return err
+			}
+			return auditDB(hub.AuditProfile, name, "profile created")
 		},
 	}
 	cmdProf.AddCommand(cmdAdd)
@@ -123,7 +126,10 @@ func init() {
 			if name == "" {
 				return errors.New("name should not be empty")
 			}
-			return hubDB.DelProfile(name)
+			if err := hubDB.DelProfile(name); err != nil {
+				return err
+			}
+			return auditDB(hub.AuditProfile, name, "profile deleted")
 		},
 	}
 	cmdProf.AddCommand(cmdDel)
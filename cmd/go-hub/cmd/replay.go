@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/capture"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <session.dccap>",
+	Short: "replay a recorded protocol session",
+	Long: `Replay a session recorded with "serve --capture".
+
+By default, all messages are decoded with the protocol parser and decoding errors are printed.
+If the hub address is set, messages received from the client are sent to the hub instead.`,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	fAddr := replayCmd.Flags().String("addr", "", "hub address to replay client messages to (host:port)")
+	fReal := replayCmd.Flags().Bool("realtime", false, "keep the original timing of messages")
+	fVerbose := replayCmd.Flags().BoolP("verbose", "v", false, "print all messages")
+	Root.AddCommand(replayCmd)
+	replayCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, err := capture.NewReader(f)
+		if err != nil {
+			return err
+		}
+		h := r.Header()
+		fmt.Printf("session: %s %s -> %s at %s\n", h.Proto, h.Remote, h.Local, h.Start)
+		if *fAddr != "" {
+			return replayToHub(r, *fAddr, *fReal, *fVerbose)
+		}
+		return replayParse(r, *fVerbose)
+	}
+}
+
+func decodeRecord(proto string, data []byte) (interface{}, error) {
+	switch proto {
+	case capture.ProtoADC:
+		if len(data) == 1 && data[0] == '\n' {
+			return nil, nil // keep alive
+		}
+		p, err := adc.DecodePacket(data)
+		if err != nil {
+			return nil, err
+		}
+		return p.Decode()
+	case capture.ProtoNMDC:
+		if len(data) == 1 && data[0] == '|' {
+			return nil, nil // keep alive
+		}
+		return nmdcp.Unmarshal(nil, data)
+	}
+	return nil, fmt.Errorf("unsupported protocol: %q", proto)
+}
+
+func replayParse(r *capture.Reader, verbose bool) error {
+	proto := r.Header().Proto
+	var total, failed int
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		total++
+		m, err := decodeRecord(proto, rec.Data)
+		if err != nil {
+			failed++
+			fmt.Printf("%12v %s %q\n\terror: %v\n", rec.Time, rec.Dir, rec.Data, err)
+		} else if verbose {
+			fmt.Printf("%12v %s %q\n\t%T\n", rec.Time, rec.Dir, rec.Data, m)
+		}
+	}
+	fmt.Printf("messages: %d, errors: %d\n", total, failed)
+	return nil
+}
+
+func replayToHub(r *capture.Reader, addr string, realtime, verbose bool) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		// hub responses are not compared with the recorded ones
+		w := ioutil.Discard
+		if verbose {
+			w = os.Stdout
+		}
+		_, _ = io.Copy(w, conn)
+	}()
+
+	start := time.Now()
+	sent := 0
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if rec.Dir != capture.DirRecv {
+			continue // sent by the hub
+		}
+		if realtime {
+			if dt := rec.Time - time.Since(start); dt > 0 {
+				time.Sleep(dt)
+			}
+		}
+		if _, err = conn.Write(rec.Data); err != nil {
+			return err
+		}
+		sent++
+	}
+	log.Printf("sent %d messages", sent)
+	return nil
+}
@@ -4,22 +4,26 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	_ "github.com/direct-connect/go-dcpp/hub/plugins/all"
 
 	"github.com/direct-connect/go-dcpp/adc"
 	"github.com/direct-connect/go-dcpp/hub"
+	"github.com/direct-connect/go-dcpp/hub/hubauth"
 	"github.com/direct-connect/go-dcpp/hub/hubdb"
 	"github.com/direct-connect/go-dcpp/nmdc"
 	"github.com/direct-connect/go-dcpp/version"
@@ -53,18 +57,137 @@ type Config struct {
 	Website string `yaml:"website"`
 	Email   string `yaml:"email"`
 	MOTD    string `yaml:"motd"`
-	Serve   struct {
+	// Locale is the language of system messages.
+	Locale string `yaml:"locale"`
+	// TimeZone is the time zone of the hub used for timestamps.
+	TimeZone string `yaml:"timezone"`
+	// Texts overrides system messages, per locale and message ID.
+	Texts hub.Texts `yaml:"texts"`
+	Bot   struct {
+		Name string `yaml:"name"`
+	} `yaml:"bot"`
+	Rules struct {
+		Text    string        `yaml:"text"`
+		Timeout time.Duration `yaml:"timeout"`
+		Command string        `yaml:"command"`
+	} `yaml:"rules"`
+	Announcements []struct {
+		ID       string `yaml:"id"`
+		Schedule string `yaml:"schedule"`
+		Room     string `yaml:"room"`
+		Audience string `yaml:"audience"`
+		Text     string `yaml:"text"`
+	} `yaml:"announcements"`
+	Serve struct {
 		Host string     `yaml:"host"`
 		Port int        `yaml:"port"`
 		TLS  *TLSConfig `yaml:"tls"`
+		// UpgradeTLS allows ADC clients to switch to TLS after connecting without it.
+		UpgradeTLS bool `yaml:"upgrade_tls"`
 	} `yaml:"serve"`
 	Chat struct {
-		Encoding string `yaml:"encoding"`
-		Log      struct {
+		Encoding   string `yaml:"encoding"`
+		Timestamps bool   `yaml:"timestamps"`
+		Log        struct {
 			Max  int `yaml:"max"`
 			Join int `yaml:"join"`
 		}
 	} `yaml:"chat"`
+	NMDC struct {
+		Encoding string `yaml:"encoding"`
+	} `yaml:"nmdc"`
+	Nick struct {
+		Min         int      `yaml:"min"`
+		Max         int      `yaml:"max"`
+		Confusables bool     `yaml:"confusables"`
+		Allow       []string `yaml:"allow"`
+		Reserved    []string `yaml:"reserved"`
+	} `yaml:"nick"`
+	Login struct {
+		Multi string `yaml:"multi"` // allow, reject or replace
+		PerIP int    `yaml:"per_ip"`
+	} `yaml:"login"`
+	Users struct {
+		// UpdateDelay is a time window to coalesce user info updates.
+		UpdateDelay time.Duration `yaml:"update_delay"`
+		List        struct {
+			Batch     int           `yaml:"batch"`
+			Delay     time.Duration `yaml:"delay"`
+			ZlibBurst bool          `yaml:"zlib_burst"`
+			Lazy      bool          `yaml:"lazy"`
+		} `yaml:"list"`
+	} `yaml:"users"`
+	API struct {
+		Token string `yaml:"token"`
+		// GRPC is a local address for the gRPC API without TLS.
+		GRPC string `yaml:"grpc"`
+	} `yaml:"api"`
+	SearchStats struct {
+		Enabled   bool          `yaml:"enabled"`
+		Retention time.Duration `yaml:"retention"`
+		MaxTerms  int           `yaml:"max_terms"`
+	} `yaml:"search_stats"`
+	Authz struct {
+		URL      string        `yaml:"url"`
+		Token    string        `yaml:"token"`
+		Search   bool          `yaml:"search"`
+		Connect  bool          `yaml:"connect"`
+		Timeout  time.Duration `yaml:"timeout"`
+		FailOpen bool          `yaml:"fail_open"`
+	} `yaml:"authz"`
+	Notify struct {
+		Webhooks []struct {
+			URL         string   `yaml:"url"`
+			Events      []string `yaml:"events"`
+			Template    string   `yaml:"template"`
+			ContentType string   `yaml:"content_type"`
+			Rate        int      `yaml:"rate"`
+		} `yaml:"webhooks"`
+		OpChat string   `yaml:"op_chat"`
+		Watch  []string `yaml:"watch"`
+	} `yaml:"notify"`
+	Bridges []struct {
+		Name  string `yaml:"name"`
+		Desc  string `yaml:"desc"`
+		Token string `yaml:"token"`
+	} `yaml:"bridges"`
+	Matrix struct {
+		Listen     string            `yaml:"listen"`
+		Homeserver string            `yaml:"homeserver"`
+		Domain     string            `yaml:"domain"`
+		Name       string            `yaml:"name"`
+		ASToken    string            `yaml:"as_token"`
+		HSToken    string            `yaml:"hs_token"`
+		Prefix     string            `yaml:"prefix"`
+		Suffix     string            `yaml:"suffix"`
+		Rooms      map[string]string `yaml:"rooms"`
+	} `yaml:"matrix"`
+	XMPP struct {
+		Addr   string `yaml:"addr"`
+		Domain string `yaml:"domain"`
+		Secret string `yaml:"secret"`
+		Room   string `yaml:"room"`
+	} `yaml:"xmpp"`
+	Console struct {
+		Listen string `yaml:"listen"`
+		TLS    bool   `yaml:"tls"`
+	} `yaml:"console"`
+	History struct {
+		Retention time.Duration `yaml:"retention"`
+	} `yaml:"history"`
+	Timeouts struct {
+		Handshake time.Duration `yaml:"handshake"`
+		ReadIdle  time.Duration `yaml:"read_idle"`
+		Write     time.Duration `yaml:"write"`
+		Watchdog  time.Duration `yaml:"watchdog"`
+		// Ping is the time of inactivity after which a keepalive is sent to peers of each protocol.
+		Ping struct {
+			ADC   time.Duration `yaml:"adc"`
+			NMDC  time.Duration `yaml:"nmdc"`
+			IRC   time.Duration `yaml:"irc"`
+			Grace time.Duration `yaml:"grace"`
+		} `yaml:"ping"`
+	} `yaml:"timeouts"`
 	Database struct {
 		Type string `yaml:"type"`
 		Path string `yaml:"path"`
@@ -72,10 +195,109 @@ type Config struct {
 	Plugins struct {
 		Path string `yaml:"path"`
 	} `yaml:"plugins"`
+	Diag struct {
+		Dir string `yaml:"dir"`
+	} `yaml:"diag"`
+	// Auth is a chain of authentication providers. Only the local database is used by default.
+	Auth []AuthConfig `yaml:"auth"`
+}
+
+type AuthConfig struct {
+	Type string `yaml:"type"` // local, file, http or ldap
+	// file
+	Path string `yaml:"path"`
+	// http
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// ldap
+	Addr    string `yaml:"addr"`
+	TLS     bool   `yaml:"tls"`
+	DN      string `yaml:"dn"`
+	Profile string `yaml:"profile"`
+	Lookup  bool   `yaml:"lookup"`
+}
+
+func newAuthProvider(h *hub.Hub, c AuthConfig) (hub.AuthProvider, error) {
+	switch c.Type {
+	case "local":
+		return h.LocalAuth(), nil
+	case "file":
+		return hubauth.OpenFile(c.Path)
+	case "http":
+		return hubauth.NewHTTP(c.URL, c.Token), nil
+	case "ldap":
+		return hubauth.NewLDAP(hubauth.LDAPConfig{
+			Addr:    c.Addr,
+			TLS:     c.TLS,
+			DN:      c.DN,
+			Profile: c.Profile,
+			Lookup:  c.Lookup,
+		})
+	}
+	return nil, fmt.Errorf("unsupported auth provider: %q", c.Type)
 }
 
 const defaultConfig = "hub.yml"
 
+// serveConsole starts the admin console. The password is sent in plain text,
+// thus addresses other than localhost require TLS.
+func serveConsole(h *hub.Hub, addr string, tlsConf *tls.Config) error {
+	if tlsConf == nil {
+		if err := checkLoopback(addr); err != nil {
+			return fmt.Errorf("admin console requires TLS: %v", err)
+		}
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if tlsConf != nil {
+		l = tls.NewListener(l, tlsConf)
+	}
+	go func() {
+		defer l.Close()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Println("cannot serve admin console:", err)
+				return
+			}
+			go h.ServeConsole(conn)
+		}
+	}()
+	return nil
+}
+
+// checkLoopback returns an error if the address is not a localhost address.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%s is not a localhost address", addr)
+	}
+	return nil
+}
+
+// serveGRPC serves the gRPC API without TLS on a local address.
+func serveGRPC(h *hub.Hub, addr string) error {
+	if err := checkLoopback(addr); err != nil {
+		return fmt.Errorf("gRPC API without TLS: %v", err)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: h2c.NewHandler(h.GRPCHandler(), &http2.Server{})}
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.Println("cannot serve gRPC API:", err)
+		}
+	}()
+	return nil
+}
+
 func initConfig(path string) error {
 	return viper.WriteConfigAs(path)
 }
@@ -121,6 +343,7 @@ func init() {
 	viper.SetDefault("database.type", "bolt")
 	viper.SetDefault("database.path", "hub.db")
 	viper.SetDefault("plugins.path", "plugins")
+	viper.SetDefault("users.self_register", true)
 
 	initCmd.RunE = func(cmd *cobra.Command, args []string) error {
 		if err := initConfig(defaultConfig); err != nil {
@@ -135,6 +358,7 @@ func init() {
 
 	fDebug := flags.Bool("debug", false, "print protocol logs to stderr")
 	fPProf := flags.Bool("pprof", false, "enable profiler endpoint")
+	fCapture := flags.String("capture", "", "record all protocol sessions to a given directory")
 
 	flags.String("name", "GoHub", "name of the hub")
 	viper.BindPFlag("name", flags.Lookup("name"))
@@ -172,9 +396,88 @@ func init() {
 		host := ":" + strconv.Itoa(conf.Serve.Port)
 		addr := conf.Serve.Host + host
 
-		if conf.Chat.Encoding != "" {
+		if conf.NMDC.Encoding != "" {
+			fmt.Println("nmdc encoding:", conf.NMDC.Encoding)
+		} else if conf.Chat.Encoding != "" {
 			fmt.Println("fallback encoding:", conf.Chat.Encoding)
 		}
+		if *fCapture != "" {
+			log.Println("WARNING: recording sessions to", *fCapture)
+			if err = os.MkdirAll(*fCapture, 0755); err != nil {
+				return err
+			}
+		}
+		var multi hub.MultiLoginPolicy
+		switch conf.Login.Multi {
+		case "", "allow":
+			multi = hub.MultiLoginAllow
+		case "reject":
+			multi = hub.MultiLoginReject
+		case "replace":
+			multi = hub.MultiLoginReplace
+		default:
+			return fmt.Errorf("unsupported multi-login policy: %q", conf.Login.Multi)
+		}
+		notify := hub.NotifyConfig{
+			OpChat: conf.Notify.OpChat,
+			Watch:  conf.Notify.Watch,
+		}
+		for _, w := range conf.Notify.Webhooks {
+			notify.Webhooks = append(notify.Webhooks, hub.NotifyWebhook{
+				URL:         w.URL,
+				Events:      w.Events,
+				Template:    w.Template,
+				ContentType: w.ContentType,
+				Rate:        w.Rate,
+			})
+		}
+		var announcements []hub.Announcement
+		for _, a := range conf.Announcements {
+			announcements = append(announcements, hub.Announcement{
+				ID:       a.ID,
+				Schedule: a.Schedule,
+				Room:     a.Room,
+				Audience: a.Audience,
+				Text:     a.Text,
+			})
+		}
+		var bridges []hub.ChatBridgeConfig
+		for _, b := range conf.Bridges {
+			bridges = append(bridges, hub.ChatBridgeConfig{
+				Name:  b.Name,
+				Desc:  b.Desc,
+				Token: b.Token,
+			})
+		}
+		var matrix *hub.MatrixConfig
+		if m := conf.Matrix; m.Listen != "" {
+			rooms := make(map[string]string, len(m.Rooms))
+			for name, id := range m.Rooms {
+				if name == "main" {
+					name = ""
+				}
+				rooms[name] = id
+			}
+			matrix = &hub.MatrixConfig{
+				Homeserver: m.Homeserver,
+				Domain:     m.Domain,
+				Name:       m.Name,
+				ASToken:    m.ASToken,
+				HSToken:    m.HSToken,
+				Prefix:     m.Prefix,
+				Suffix:     m.Suffix,
+				Rooms:      rooms,
+			}
+		}
+		var xmpp *hub.XMPPConfig
+		if x := conf.XMPP; x.Addr != "" {
+			xmpp = &hub.XMPPConfig{
+				Addr:   x.Addr,
+				Domain: x.Domain,
+				Secret: x.Secret,
+				Room:   x.Room,
+			}
+		}
 		h, err := hub.NewHub(hub.Config{
 			Name:             conf.Name,
 			Desc:             conf.Desc,
@@ -182,12 +485,78 @@ func init() {
 			Website:          conf.Website,
 			Email:            conf.Email,
 			MOTD:             conf.MOTD,
+			BotName:          conf.Bot.Name,
+			Locale:           conf.Locale,
+			Texts:            conf.Texts,
 			FallbackEncoding: conf.Chat.Encoding,
+			NMDCEncoding:     conf.NMDC.Encoding,
 			ChatLog:          conf.Chat.Log.Max,
 			ChatLogJoin:      conf.Chat.Log.Join,
+			ChatTimestamps:   conf.Chat.Timestamps,
+			TimeZone:         conf.TimeZone,
 			Addr:             addr,
 			TLS:              tlsConf,
+			ADCUpgradeTLS:    conf.Serve.UpgradeTLS,
 			Keyprint:         kp,
+			CaptureDir:       *fCapture,
+			DiagDir:          conf.Diag.Dir,
+			APIToken:         conf.API.Token,
+			ReloadConfig: func() (hub.Map, error) {
+				_, m, err := readConfig(false)
+				return m, err
+			},
+			Nicks: hub.NickPolicy{
+				MinLength:   conf.Nick.Min,
+				MaxLength:   conf.Nick.Max,
+				Confusables: conf.Nick.Confusables,
+				Allow:       conf.Nick.Allow,
+				Reserved:    conf.Nick.Reserved,
+			},
+			MultiLogin:     multi,
+			MaxLoginsPerIP: conf.Login.PerIP,
+			UpdateDelay:    conf.Users.UpdateDelay,
+			UserList: hub.UserListConfig{
+				BatchSize:  conf.Users.List.Batch,
+				BatchDelay: conf.Users.List.Delay,
+				ZlibBurst:  conf.Users.List.ZlibBurst,
+				Lazy:       conf.Users.List.Lazy,
+			},
+			HistoryRetention: conf.History.Retention,
+			Notify:           notify,
+			ChatBridges:      bridges,
+			Matrix:           matrix,
+			XMPP:             xmpp,
+			Authz: hub.AuthzConfig{
+				URL:      conf.Authz.URL,
+				Token:    conf.Authz.Token,
+				Search:   conf.Authz.Search,
+				Connect:  conf.Authz.Connect,
+				Timeout:  conf.Authz.Timeout,
+				FailOpen: conf.Authz.FailOpen,
+			},
+			SearchStats: hub.SearchStatsConfig{
+				Enabled:   conf.SearchStats.Enabled,
+				Retention: conf.SearchStats.Retention,
+				MaxTerms:  conf.SearchStats.MaxTerms,
+			},
+			Welcome: hub.WelcomeConfig{
+				Rules:         conf.Rules.Text,
+				AcceptTimeout: conf.Rules.Timeout,
+				AcceptCommand: conf.Rules.Command,
+			},
+			Announcements: announcements,
+			Timeouts: hub.Timeouts{
+				Handshake: conf.Timeouts.Handshake,
+				ReadIdle:  conf.Timeouts.ReadIdle,
+				Write:     conf.Timeouts.Write,
+			},
+			WatchdogTimeout: conf.Timeouts.Watchdog,
+			Reaper: hub.ReaperConfig{
+				ADC:   conf.Timeouts.Ping.ADC,
+				NMDC:  conf.Timeouts.Ping.NMDC,
+				IRC:   conf.Timeouts.Ping.IRC,
+				Grace: conf.Timeouts.Ping.Grace,
+			},
 		})
 		if err != nil {
 			return err
@@ -200,11 +569,16 @@ func init() {
 			adc.Debug = true
 		}
 
+		// pprof is always available on the hub port with the API token
+		debug := pprofHandler()
+		h.SetDebugHandler(debug)
 		if *fPProf {
-			const pprofPort = ":6060"
+			// pprof is not authenticated here, thus it's only available locally;
+			// use the API token to access it on the hub port
+			const pprofPort = "127.0.0.1:6060"
 			log.Println("enabling profiler on", pprofPort)
 			go func() {
-				if err := http.ListenAndServe(pprofPort, nil); err != nil {
+				if err := http.ListenAndServe(pprofPort, debug); err != nil {
 					log.Println("cannot enable profiler:", err)
 				}
 			}()
@@ -212,8 +586,14 @@ func init() {
 		if true {
 			const promAddr = ":2112"
 			log.Println("serving metrics on", promAddr)
+			mux := http.NewServeMux()
+			mux.Handle("/", promhttp.Handler())
+			// health checks are also served here, since the hub port requires TLS
+			health := h.HealthHandler()
+			mux.Handle(hub.HTTPHealthPath, health)
+			mux.Handle(hub.HTTPReadyPath, health)
 			go func() {
-				if err := http.ListenAndServe(promAddr, promhttp.Handler()); err != nil {
+				if err := http.ListenAndServe(promAddr, mux); err != nil {
 					log.Println("cannot serve metrics:", err)
 				}
 			}()
@@ -229,6 +609,18 @@ func init() {
 		} else {
 			log.Println("WARNING: using in-memory database")
 		}
+		if len(conf.Auth) != 0 {
+			var list []hub.AuthProvider
+			for _, c := range conf.Auth {
+				p, err := newAuthProvider(h, c)
+				if err != nil {
+					return err
+				}
+				log.Println("using auth provider:", p.Name())
+				list = append(list, p)
+			}
+			h.SetAuthProviders(list...)
+		}
 
 		if _, err := os.Stat(conf.Plugins.Path); err == nil {
 			log.Println("loading plugins in:", conf.Plugins.Path)
@@ -242,6 +634,31 @@ func init() {
 		}
 		defer h.Close()
 
+		if conf.API.GRPC != "" {
+			if err := serveGRPC(h, conf.API.GRPC); err != nil {
+				return err
+			}
+			log.Println("serving gRPC API on", conf.API.GRPC)
+		}
+		if conf.Console.Listen != "" {
+			var ctls *tls.Config
+			if conf.Console.TLS {
+				ctls = tlsConf
+			}
+			if err := serveConsole(h, conf.Console.Listen, ctls); err != nil {
+				return err
+			}
+			log.Println("serving admin console on", conf.Console.Listen)
+		}
+		if matrix != nil {
+			log.Println("serving matrix application service on", conf.Matrix.Listen)
+			go func() {
+				if err := http.ListenAndServe(conf.Matrix.Listen, h.MatrixHandler()); err != nil {
+					log.Println("cannot serve matrix application service:", err)
+				}
+			}()
+		}
+
 		log.Println("listening on", host)
 
 		fmt.Printf(`
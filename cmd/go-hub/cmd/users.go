@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -78,11 +79,12 @@ func init() {
 			}
 			err := hubDB.CreateUser(hub.UserRecord{
 				Name: name, Pass: pass, Profile: profile,
+				Registered: time.Now().UTC(),
 			})
 			if err != nil {
 				return err
 			}
-			return nil
+			return auditDB(hub.AuditRegister, name, profile)
 		},
 	}
 	cmdUsers.AddCommand(cmdAdd)
@@ -110,7 +112,7 @@ func init() {
 					return errors.New("profile does not exist")
 				}
 			}
-			return hubDB.UpdateUser(name, func(u *hub.UserRecord) (bool, error) {
+			err := hubDB.UpdateUser(name, func(u *hub.UserRecord) (bool, error) {
 				if u == nil {
 					return false, errors.New("user does not exist")
 				}
@@ -120,6 +122,10 @@ func init() {
 				u.Profile = profile
 				return true, nil
 			})
+			if err != nil {
+				return err
+			}
+			return auditDB(hub.AuditProfile, name, "profile set to "+profile)
 		},
 	}
 	cmdUsers.AddCommand(cmdPromote)
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/cobra"
+
+	"github.com/direct-connect/go-dcpp/hub/hubpb"
+	"github.com/direct-connect/go-dcpp/version"
+)
+
+const tokenEnv = "HUBCTL_TOKEN"
+
+func main() {
+	if err := Root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+var Root = &cobra.Command{
+	Use:           "go-hubctl <command>",
+	Short:         "manages go-hub using the control plane API",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var (
+	fAddr     = Root.PersistentFlags().StringP("addr", "a", "localhost:1411", "address of the hub API")
+	fToken    = Root.PersistentFlags().String("token", "", "API token of the hub (default $"+tokenEnv+")")
+	fPlain    = Root.PersistentFlags().Bool("plain", false, "connect without TLS (for the local api.grpc listener)")
+	fInsecure = Root.PersistentFlags().BoolP("insecure", "k", false, "do not verify the TLS certificate of the hub")
+	fJSON     = Root.PersistentFlags().Bool("json", false, "print the output in JSON format")
+	fTimeout  = Root.PersistentFlags().DurationP("timeout", "t", 10*time.Second, "timeout for API calls")
+)
+
+func newClient() (*hubpb.Client, error) {
+	token := *fToken
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+	if token == "" {
+		return nil, errors.New("API token is not set")
+	}
+	var conf *tls.Config
+	if !*fPlain {
+		conf = &tls.Config{InsecureSkipVerify: *fInsecure}
+	}
+	return hubpb.NewClient(*fAddr, conf, token), nil
+}
+
+// call runs a unary API call with a timeout.
+func call(fnc func(ctx context.Context, c *hubpb.Client) error) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *fTimeout)
+	defer cancel()
+	return fnc(ctx, c)
+}
+
+// stream opens a streaming API call and prints all messages until the stream ends or is interrupted.
+func stream(open func(ctx context.Context, c *hubpb.Client) (*hubpb.ClientStream, error), newMsg func() proto.Message, table func(w io.Writer, m proto.Message)) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	s, err := open(context.Background(), c)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for {
+		m := newMsg()
+		if err = s.Recv(m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if *fJSON {
+			err = json.NewEncoder(os.Stdout).Encode(m)
+		} else {
+			table(os.Stdout, m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// output prints the value either as JSON or as a table.
+func output(v interface{}, header string, rows func(w io.Writer)) error {
+	if *fJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if header != "" {
+		fmt.Fprintln(tw, header)
+	}
+	rows(tw)
+	return tw.Flush()
+}
+
+func ok(format string, args ...interface{}) error {
+	if *fJSON {
+		return nil
+	}
+	fmt.Printf(format+"\n", args...)
+	return nil
+}
+
+func formatTime(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).Format("2006-01-02 15:04:05")
+}
+
+func flags(p *hubpb.Peer) string {
+	var f []string
+	if p.Bot {
+		f = append(f, "bot")
+	}
+	if p.Op {
+		f = append(f, "op")
+	}
+	if p.Registered {
+		f = append(f, "reg")
+	}
+	if p.Secure {
+		f = append(f, "tls")
+	}
+	if p.Away {
+		f = append(f, "away")
+	}
+	return strings.Join(f, ",")
+}
+
+func init() {
+	Root.AddCommand(&cobra.Command{
+		Use:   "version",
+		Short: "print the version",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(version.Vers)
+		},
+	})
+
+	Root.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "print general information about the hub",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				st, err := c.GetStats(ctx)
+				if err != nil {
+					return err
+				}
+				return output(st, "", func(w io.Writer) {
+					fmt.Fprintf(w, "Name:\t%s\n", st.Name)
+					fmt.Fprintf(w, "Description:\t%s\n", st.Desc)
+					fmt.Fprintf(w, "Software:\t%s\n", st.Soft)
+					fmt.Fprintf(w, "Users:\t%d\n", st.Users)
+					fmt.Fprintf(w, "Share:\t%d\n", st.Share)
+					fmt.Fprintf(w, "Uptime:\t%v\n", time.Duration(st.UptimeSec)*time.Second)
+				})
+			})
+		},
+	})
+
+	usersCmd := &cobra.Command{
+		Use:   "users",
+		Short: "manage online users",
+	}
+	Root.AddCommand(usersCmd)
+
+	usersCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "list online users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				list, err := c.ListPeers(ctx)
+				if err != nil {
+					return err
+				}
+				return output(list.Peers, "SID\tNAME\tPROTO\tIP\tSHARE\tCLIENT\tFLAGS", func(w io.Writer) {
+					for _, p := range list.Peers {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+							p.Sid, p.Name, p.Proto, p.Ip, p.Share, p.Client, flags(p))
+					}
+				})
+			})
+		},
+	})
+
+	usersCmd.AddCommand(&cobra.Command{
+		Use:   "watch",
+		Short: "print changes of the user list",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return stream(func(ctx context.Context, c *hubpb.Client) (*hubpb.ClientStream, error) {
+				list, err := c.ListPeers(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return c.WatchPeers(ctx, list.Seq)
+			}, func() proto.Message {
+				return &hubpb.PeerChange{}
+			}, func(w io.Writer, m proto.Message) {
+				ch := m.(*hubpb.PeerChange)
+				var name, ip string
+				if ch.Peer != nil {
+					name, ip = ch.Peer.Name, ch.Peer.Ip
+				}
+				fmt.Fprintf(w, "%s %-6s %s %s\n", formatTime(ch.Time), ch.Kind, name, ip)
+			})
+		},
+	})
+
+	usersCmd.AddCommand(&cobra.Command{
+		Use:   "kick <name> [reason]",
+		Short: "disconnect the user",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				if err := c.Kick(ctx, args[0], strings.Join(args[1:], " ")); err != nil {
+					return err
+				}
+				return ok("user kicked: %s", args[0])
+			})
+		},
+	})
+
+	banCmd := &cobra.Command{
+		Use:   "ban",
+		Short: "manage blocked IP addresses",
+	}
+	Root.AddCommand(banCmd)
+
+	banCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "list blocked IP addresses",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				list, err := c.ListBans(ctx)
+				if err != nil {
+					return err
+				}
+				return output(list.Ips, "IP", func(w io.Writer) {
+					for _, ip := range list.Ips {
+						fmt.Fprintln(w, ip)
+					}
+				})
+			})
+		},
+	})
+
+	banCmd.AddCommand(&cobra.Command{
+		Use:   "add <ip> [reason]",
+		Short: "block the IP address",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				if err := c.BanIP(ctx, args[0], strings.Join(args[1:], " ")); err != nil {
+					return err
+				}
+				return ok("ip blocked: %s", args[0])
+			})
+		},
+	})
+
+	banCmd.AddCommand(&cobra.Command{
+		Use:     "remove <ip> [reason]",
+		Aliases: []string{"rm"},
+		Short:   "unblock the IP address",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				if err := c.UnbanIP(ctx, args[0], strings.Join(args[1:], " ")); err != nil {
+					return err
+				}
+				return ok("ip unblocked: %s", args[0])
+			})
+		},
+	})
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "manage the hub config",
+	}
+	Root.AddCommand(configCmd)
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "get [key]",
+		Short: "print config values",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				list, err := c.GetConfig(ctx)
+				if err != nil {
+					return err
+				}
+				values := list.Values
+				if len(args) != 0 {
+					values = nil
+					for _, v := range list.Values {
+						if v.Key == args[0] {
+							values = append(values, v)
+						}
+					}
+					if len(values) == 0 {
+						return fmt.Errorf("config value is not set: %s", args[0])
+					}
+				}
+				return output(values, "KEY\tVALUE", func(w io.Writer) {
+					for _, v := range values {
+						fmt.Fprintf(w, "%s\t%s\n", v.Key, v.Value)
+					}
+				})
+			})
+		},
+	})
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "change the config value",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				v, err := c.SetConfig(ctx, args[0], strings.Join(args[1:], " "))
+				if err != nil {
+					return err
+				}
+				return output(v, "", func(w io.Writer) {
+					fmt.Fprintf(w, "%s = %s\n", v.Key, v.Value)
+				})
+			})
+		},
+	})
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "reload",
+		Short: "read the config file of the hub again",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				if err := c.ReloadConfig(ctx); err != nil {
+					return err
+				}
+				return ok("config reloaded")
+			})
+		},
+	})
+
+	chatCmd := &cobra.Command{
+		Use:   "chat",
+		Short: "read and send messages to the main chat",
+	}
+	Root.AddCommand(chatCmd)
+
+	tailCmd := &cobra.Command{
+		Use:   "tail",
+		Short: "print messages of the main chat",
+		Args:  cobra.NoArgs,
+	}
+	tailLast := tailCmd.Flags().Uint32P("num", "n", 10, "number of messages from the chat log to print")
+	tailCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return stream(func(ctx context.Context, c *hubpb.Client) (*hubpb.ClientStream, error) {
+			return c.TailChat(ctx, *tailLast)
+		}, func() proto.Message {
+			return &hubpb.ChatMessage{}
+		}, func(w io.Writer, m proto.Message) {
+			msg := m.(*hubpb.ChatMessage)
+			if msg.Me {
+				fmt.Fprintf(w, "%s * %s %s\n", formatTime(msg.Time), msg.Name, msg.Text)
+			} else {
+				fmt.Fprintf(w, "%s <%s> %s\n", formatTime(msg.Time), msg.Name, msg.Text)
+			}
+		})
+	}
+	chatCmd.AddCommand(tailCmd)
+
+	chatCmd.AddCommand(&cobra.Command{
+		Use:   "send <text>",
+		Short: "send a message to the main chat on behalf of the hub",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return call(func(ctx context.Context, c *hubpb.Client) error {
+				return c.SendChat(ctx, strings.Join(args, " "))
+			})
+		},
+	})
+}
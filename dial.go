@@ -0,0 +1,185 @@
+package dc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/nmdc"
+)
+
+// DefaultDialProtocols is the default order of protocols tried for hub addresses without a scheme.
+var DefaultDialProtocols = []string{adcsSchema, adcSchema, nmdcSchema}
+
+var defaultDialer = &Dialer{}
+
+// Conn is a hub connection established by Dial. Only one of ADC or NMDC fields is set.
+type Conn struct {
+	// URL is the hub address with the protocol that was used.
+	URL  *url.URL
+	ADC  *adc.Conn
+	NMDC *nmdc.Conn
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	if c.ADC != nil {
+		return c.ADC.Close()
+	}
+	return c.NMDC.Close()
+}
+
+// Dialer connects to hubs that may be specified without the protocol.
+//
+// For addresses without a scheme, the hub is probed for the protocols in preference order,
+// and the first one the hub speaks is used. The protocol is remembered for the address,
+// so reconnects dial it directly. If the remembered protocol stops working, the hub is probed again.
+type Dialer struct {
+	// Protocols is a list of URL schemes to try, in preference order.
+	// If not set, DefaultDialProtocols is used.
+	Protocols []string
+	// ProbeTimeout is the time allowed for each protocol probe. Zero value means 5 seconds.
+	ProbeTimeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]string // address -> scheme
+}
+
+// Dial connects to the hub using the default Dialer.
+func Dial(addr string) (*Conn, error) {
+	return defaultDialer.DialContext(context.Background(), addr)
+}
+
+// DialContext connects to the hub using the default Dialer.
+func DialContext(ctx context.Context, addr string) (*Conn, error) {
+	return defaultDialer.DialContext(ctx, addr)
+}
+
+// Dial connects to the hub.
+func (d *Dialer) Dial(addr string) (*Conn, error) {
+	return d.DialContext(context.Background(), addr)
+}
+
+// DialContext connects to the hub. If the address has no scheme, the protocol is detected first.
+func (d *Dialer) DialContext(ctx context.Context, addr string) (*Conn, error) {
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		return dialURL(ctx, u)
+	}
+	host := addr
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host += ":411"
+	}
+	if scheme := d.cached(addr); scheme != "" {
+		c, err := dialURL(ctx, &url.URL{Scheme: scheme, Host: host})
+		if err == nil {
+			return c, nil
+		}
+		d.setCached(addr, "")
+	}
+	scheme, err := d.probe(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c, err := dialURL(ctx, &url.URL{Scheme: scheme, Host: host})
+	if err != nil {
+		return nil, err
+	}
+	d.setCached(addr, scheme)
+	return c, nil
+}
+
+func (d *Dialer) cached(addr string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cache[addr]
+}
+
+func (d *Dialer) setCached(addr, scheme string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if scheme == "" {
+		delete(d.cache, addr)
+		return
+	}
+	if d.cache == nil {
+		d.cache = make(map[string]string)
+	}
+	d.cache[addr] = scheme
+}
+
+// probe returns the first protocol from the preference list that the hub speaks.
+// Each kind of connection (TLS or plaintext) is probed at most once.
+func (d *Dialer) probe(ctx context.Context, host string) (string, error) {
+	protos := d.Protocols
+	if len(protos) == 0 {
+		protos = DefaultDialProtocols
+	}
+	timeout := d.ProbeTimeout
+	if timeout <= 0 {
+		timeout = probeTimeout
+	}
+	type result struct {
+		done   bool
+		scheme string
+		err    error
+	}
+	var plain, secure result
+	run := func(r *result, fnc func(ctx context.Context, addr string) (string, error)) {
+		if r.done {
+			return
+		}
+		pctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		r.scheme, r.err = fnc(pctx, host)
+		r.done = true
+	}
+	var last error
+	for _, proto := range protos {
+		var r *result
+		switch proto {
+		case adcsSchema, nmdcsSchema:
+			run(&secure, probeTLS)
+			r = &secure
+		case adcSchema, nmdcSchema:
+			run(&plain, probePlain)
+			r = &plain
+		default:
+			return "", fmt.Errorf("unsupported protocol: %q", proto)
+		}
+		if r.err == nil && r.scheme == proto {
+			return proto, nil
+		}
+		if r.err != nil && r.err != ErrUnsupportedProtocol {
+			last = r.err
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+	}
+	if last == nil {
+		last = ErrUnsupportedProtocol
+	}
+	return "", last
+}
+
+func dialURL(ctx context.Context, u *url.URL) (*Conn, error) {
+	switch u.Scheme {
+	case adcSchema, adcsSchema:
+		c, err := adc.DialContext(ctx, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &Conn{URL: u, ADC: c}, nil
+	case nmdcSchema, nmdcsSchema:
+		c, err := nmdc.DialContext(ctx, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &Conn{URL: u, NMDC: c}, nil
+	}
+	return nil, fmt.Errorf("unsupported protocol: %q", u.Scheme)
+}
@@ -0,0 +1,102 @@
+package dc
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveTestHub accepts connections and answers as a hub of a given protocol.
+// It returns the address and the number of accepted connections.
+func serveTestHub(t *testing.T, scheme string) (string, *int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	var conns int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func() {
+				defer c.Close()
+				if scheme == nmdcSchema {
+					_, _ = c.Write([]byte("$Lock EXTENDEDPROTOCOL_test Pk=test|"))
+				}
+				line, err := bufio.NewReader(c).ReadString('\n')
+				if err != nil {
+					return
+				}
+				if scheme == adcSchema && line == adcHandshake {
+					_, _ = c.Write([]byte("ISUP ADBASE ADTIGR\n"))
+					time.Sleep(time.Second)
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), &conns
+}
+
+func TestDialFallback(t *testing.T) {
+	addr, conns := serveTestHub(t, nmdcSchema)
+	d := &Dialer{ProbeTimeout: 200 * time.Millisecond}
+	ctx := context.Background()
+
+	c, err := d.DialContext(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.URL.Scheme != nmdcSchema || c.NMDC == nil {
+		t.Fatal("unexpected protocol:", c.URL)
+	}
+	// make sure the hub accepted the connection before counting
+	if _, err = c.NMDC.ReadMsg(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+	probed := atomic.LoadInt32(conns)
+
+	// the protocol is remembered for reconnects
+	c, err = d.DialContext(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.URL.Scheme != nmdcSchema {
+		t.Fatal("unexpected protocol:", c.URL)
+	}
+	if _, err = c.NMDC.ReadMsg(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+	if n := atomic.LoadInt32(conns); n != probed+1 {
+		t.Fatal("expected a single connection, got:", n-probed)
+	}
+
+	// protocols not in the list are not used
+	d = &Dialer{Protocols: []string{adcsSchema, adcSchema}, ProbeTimeout: 200 * time.Millisecond}
+	_, err = d.DialContext(ctx, addr)
+	if err != ErrUnsupportedProtocol {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestDialFallbackADC(t *testing.T) {
+	addr, _ := serveTestHub(t, adcSchema)
+	d := &Dialer{ProbeTimeout: 200 * time.Millisecond}
+
+	c, err := d.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+	if c.URL.Scheme != adcSchema || c.ADC == nil {
+		t.Fatal("unexpected protocol:", c.URL)
+	}
+}
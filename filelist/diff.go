@@ -0,0 +1,92 @@
+package filelist
+
+import "sort"
+
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota + 1
+	Removed
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// Change is a single difference between two file lists.
+//
+// Added and removed directories are reported as a single change, without listing their contents.
+type Change struct {
+	Kind ChangeKind
+	Path string
+	Dir  bool
+	Old  *File // set for removed and modified files
+	New  *File // set for added and modified files
+}
+
+// Diff compares two file lists and returns a list of changes required to transform a to b.
+// Changes are sorted by path.
+//
+// Contents of incomplete directories (from partial lists) are not compared.
+func Diff(a, b *FileList) []Change {
+	var out []Change
+	diffDir(&out, "", a.Root(), b.Root())
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out
+}
+
+func diffDir(out *[]Change, prefix string, a, b *Dir) {
+	if a.IsIncomplete() || b.IsIncomplete() {
+		return
+	}
+	bDirs := make(map[string]*Dir, len(b.Dirs))
+	for i := range b.Dirs {
+		bDirs[b.Dirs[i].Name] = &b.Dirs[i]
+	}
+	for i := range a.Dirs {
+		d := &a.Dirs[i]
+		if d2 := bDirs[d.Name]; d2 != nil {
+			delete(bDirs, d.Name)
+			diffDir(out, prefix+d.Name+"/", d, d2)
+		} else {
+			*out = append(*out, Change{Kind: Removed, Path: prefix + d.Name, Dir: true})
+		}
+	}
+	for name := range bDirs {
+		*out = append(*out, Change{Kind: Added, Path: prefix + name, Dir: true})
+	}
+
+	bFiles := make(map[string]*File, len(b.Files))
+	for i := range b.Files {
+		bFiles[b.Files[i].Name] = &b.Files[i]
+	}
+	for i := range a.Files {
+		f := &a.Files[i]
+		f2 := bFiles[f.Name]
+		if f2 == nil {
+			*out = append(*out, Change{Kind: Removed, Path: prefix + f.Name, Old: f})
+			continue
+		}
+		delete(bFiles, f.Name)
+		if f.Size != f2.Size || f.TTH != f2.TTH {
+			*out = append(*out, Change{Kind: Modified, Path: prefix + f.Name, Old: f, New: f2})
+		}
+	}
+	for name, f := range bFiles {
+		*out = append(*out, Change{Kind: Added, Path: prefix + name, New: f})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"compress/bzip2"
 	"encoding/xml"
 	"io"
+	"strings"
 
 	"github.com/direct-connect/go-dc/tiger"
 	"github.com/direct-connect/go-dcpp/adc/types"
@@ -11,7 +12,7 @@ import (
 
 type Dir struct {
 	Name       string `xml:"Name,attr"`
-	Incomplete int    `xml:"Incomplete,attr"`
+	Incomplete int    `xml:"Incomplete,attr,omitempty"`
 	Dirs       []Dir  `xml:"Directory"`
 	Files      []File `xml:"File"`
 }
@@ -20,9 +21,12 @@ type File struct {
 	Name string     `xml:"Name,attr"`
 	Size int64      `xml:"Size,attr"`
 	TTH  tiger.Hash `xml:"TTH,attr"`
+	// Date is the modification time of the file in unix seconds, if known.
+	Date int64 `xml:"Date,attr,omitempty"`
 }
 
 type FileList struct {
+	XMLName   xml.Name  `xml:"FileListing"`
 	Version   int       `xml:"Version,attr"`
 	CID       types.CID `xml:"CID,attr"`
 	Base      string    `xml:"Base,attr"`
@@ -43,3 +47,134 @@ func Decode(r io.Reader) (*FileList, error) {
 func DecodeBZIP(r io.Reader) (*FileList, error) {
 	return Decode(bzip2.NewReader(r))
 }
+
+// Encode writes the file list in XML format. The caller is responsible for compressing it.
+func Encode(w io.Writer, list *FileList) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(list); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// IsIncomplete checks if the contents of the directory were not included in a partial file list.
+func (d *Dir) IsIncomplete() bool {
+	return d.Incomplete != 0
+}
+
+// Dir returns a subdirectory with a given name, or nil if it doesn't exist.
+func (d *Dir) Dir(name string) *Dir {
+	for i := range d.Dirs {
+		if d.Dirs[i].Name == name {
+			return &d.Dirs[i]
+		}
+	}
+	return nil
+}
+
+// File returns a file with a given name in this directory, or nil if it doesn't exist.
+func (d *Dir) File(name string) *File {
+	for i := range d.Files {
+		if d.Files[i].Name == name {
+			return &d.Files[i]
+		}
+	}
+	return nil
+}
+
+// Size returns the total size of all files in the directory, including subdirectories.
+func (d *Dir) Size() int64 {
+	var n int64
+	for _, f := range d.Files {
+		n += f.Size
+	}
+	for i := range d.Dirs {
+		n += d.Dirs[i].Size()
+	}
+	return n
+}
+
+// Count returns the total number of files in the directory, including subdirectories.
+func (d *Dir) Count() int {
+	n := len(d.Files)
+	for i := range d.Dirs {
+		n += d.Dirs[i].Count()
+	}
+	return n
+}
+
+// WalkFunc is called for each directory and file. Exactly one of d or f is set.
+// Returning SkipDir for a directory skips its contents.
+type WalkFunc func(path string, d *Dir, f *File) error
+
+// SkipDir can be returned from WalkFunc to skip the directory.
+var SkipDir = errSkipDir{}
+
+type errSkipDir struct{}
+
+func (errSkipDir) Error() string { return "skip this directory" }
+
+// Walk calls fn for each subdirectory and file in this directory, recursively.
+// Paths are slash-separated and relative to d.
+func (d *Dir) Walk(fn WalkFunc) error {
+	return d.walk("", fn)
+}
+
+func (d *Dir) walk(prefix string, fn WalkFunc) error {
+	for i := range d.Dirs {
+		sub := &d.Dirs[i]
+		path := prefix + sub.Name
+		if err := fn(path, sub, nil); err == SkipDir {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := sub.walk(path+"/", fn); err != nil {
+			return err
+		}
+	}
+	for i := range d.Files {
+		f := &d.Files[i]
+		if err := fn(prefix+f.Name, nil, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Root returns the root directory of the file list. It shares the contents with the list.
+func (l *FileList) Root() *Dir {
+	return &Dir{Dirs: l.Dirs, Files: l.Files}
+}
+
+// Lookup finds a directory or a file by a slash-separated path.
+// It returns nil for both if the path does not exist.
+func (l *FileList) Lookup(path string) (*Dir, *File) {
+	d := l.Root()
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return d, nil
+	}
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		if i == len(names)-1 {
+			if f := d.File(name); f != nil {
+				return nil, f
+			}
+		}
+		if d = d.Dir(name); d == nil {
+			return nil, nil
+		}
+	}
+	return d, nil
+}
+
+// Walk calls fn for each directory and file in the list.
+func (l *FileList) Walk(fn WalkFunc) error {
+	return l.Root().Walk(fn)
+}
@@ -0,0 +1,138 @@
+package filelist
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/stretchr/testify/require"
+)
+
+const testList = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<FileListing Version="1" CID="KAY6BI76T6XFIQXZNRYE4WXJ2Y3YGXJG7UM7XLI" Base="/" Generator="test">
+	<Directory Name="music">
+		<Directory Name="album">
+			<File Name="01.mp3" Size="100" TTH="LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ"/>
+			<File Name="02.mp3" Size="200" TTH="QX5Z5H7OG3WQMJS5KTV6IVXD2YQNTRGQUNUAGVA"/>
+		</Directory>
+	</Directory>
+	<Directory Name="video" Incomplete="1"/>
+	<File Name="readme.txt" Size="10" TTH="UDRJ6EGCH3CGWIIU2V6CH7VLFN4N2PCZKSPTBQA"/>
+</FileListing>
+`
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(testList))
+	var got []Entry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, *e)
+	}
+	require.Equal(t, "test", r.Header().Generator)
+	require.Equal(t, 1, r.Header().Version)
+
+	var paths []string
+	for _, e := range got {
+		paths = append(paths, e.Path)
+	}
+	require.Equal(t, []string{
+		"music", "music/album", "music/album/01.mp3", "music/album/02.mp3",
+		"video", "readme.txt",
+	}, paths)
+	require.True(t, got[4].Incomplete)
+	require.Equal(t, int64(200), got[3].Size)
+}
+
+func TestReadAllTruncated(t *testing.T) {
+	data := testList[:strings.Index(testList, `<File Name="02.mp3"`)]
+	list, err := ReadAll(strings.NewReader(data))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	_, f := list.Lookup("music/album/01.mp3")
+	require.NotNil(t, f)
+	_, f = list.Lookup("music/album/02.mp3")
+	require.Nil(t, f)
+}
+
+func TestTree(t *testing.T) {
+	list, err := ReadAll(strings.NewReader(testList))
+	require.NoError(t, err)
+
+	exp, err := Decode(strings.NewReader(testList))
+	require.NoError(t, err)
+	require.Equal(t, exp, list)
+
+	root := list.Root()
+	require.Equal(t, int64(310), root.Size())
+	require.Equal(t, 3, root.Count())
+
+	d, f := list.Lookup("/music/album/")
+	require.NotNil(t, d)
+	require.Nil(t, f)
+	require.Equal(t, "album", d.Name)
+
+	d, _ = list.Lookup("video")
+	require.True(t, d.IsIncomplete())
+
+	d, f = list.Lookup("music/none")
+	require.Nil(t, d)
+	require.Nil(t, f)
+
+	var paths []string
+	err = list.Walk(func(path string, d *Dir, f *File) error {
+		paths = append(paths, path)
+		if d != nil && d.Name == "album" {
+			return SkipDir
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"music", "music/album", "video", "readme.txt"}, paths)
+}
+
+func TestEncode(t *testing.T) {
+	list, err := Decode(strings.NewReader(testList))
+	require.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, Encode(buf, list))
+
+	list2, err := Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, list, list2)
+}
+
+func TestDiff(t *testing.T) {
+	a, err := Decode(strings.NewReader(testList))
+	require.NoError(t, err)
+	b, err := Decode(strings.NewReader(testList))
+	require.NoError(t, err)
+	require.Empty(t, Diff(a, b))
+
+	album, _ := b.Lookup("music/album")
+	album.Files = album.Files[1:]
+	album.Files[0].TTH = tiger.Hash{1}
+	album.Files = append(album.Files, File{Name: "03.mp3", Size: 5})
+	b.Dirs = append(b.Dirs, Dir{Name: "docs", Files: []File{{Name: "a.pdf"}}})
+	b.Files = nil
+	// contents of incomplete dirs are ignored
+	video, _ := b.Lookup("video")
+	video.Files = []File{{Name: "movie.mkv"}}
+
+	var got []string
+	for _, c := range Diff(a, b) {
+		got = append(got, c.Kind.String()+" "+c.Path)
+	}
+	require.Equal(t, []string{
+		"added docs",
+		"removed music/album/01.mp3",
+		"modified music/album/02.mp3",
+		"added music/album/03.mp3",
+		"removed readme.txt",
+	}, got)
+}
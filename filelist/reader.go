@@ -0,0 +1,196 @@
+package filelist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// Entry is a single directory or file returned by the Reader.
+type Entry struct {
+	// Path is a slash-separated path relative to the list root.
+	Path string
+	Dir  bool
+	// Incomplete is set for directories with contents omitted from a partial list.
+	Incomplete bool
+	Size       int64
+	TTH        tiger.Hash
+}
+
+// Reader parses a file list as a stream of entries, without building the whole tree in memory.
+//
+// Directories are returned before their contents.
+type Reader struct {
+	dec    *xml.Decoder
+	header *FileList
+	path   []string
+	done   bool
+}
+
+// NewReader creates a streaming file list parser.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: xml.NewDecoder(r)}
+}
+
+// Header returns file list attributes. It's only available after the first call to Next.
+func (r *Reader) Header() *FileList {
+	return r.header
+}
+
+func attrs(e xml.StartElement) map[string]string {
+	m := make(map[string]string, len(e.Attr))
+	for _, a := range e.Attr {
+		m[a.Name.Local] = a.Value
+	}
+	return m
+}
+
+// Next returns the next entry. It returns io.EOF at the end of the list,
+// and io.ErrUnexpectedEOF if the list is truncated.
+func (r *Reader) Next() (*Entry, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if r.header == nil {
+				if tok.Name.Local != "FileListing" {
+					return nil, fmt.Errorf("expected file listing, got %q", tok.Name.Local)
+				}
+				if err := r.readHeader(tok); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			a := attrs(tok)
+			name := a["Name"]
+			if name == "" || strings.Contains(name, "/") {
+				return nil, fmt.Errorf("invalid name: %q", name)
+			}
+			path := strings.Join(append(r.path, name), "/")
+			switch tok.Name.Local {
+			case "Directory":
+				r.path = append(r.path, name)
+				e := &Entry{Path: path, Dir: true}
+				if v := a["Incomplete"]; v != "" && v != "0" {
+					e.Incomplete = true
+				}
+				return e, nil
+			case "File":
+				e := &Entry{Path: path}
+				if v := a["Size"]; v != "" {
+					if e.Size, err = strconv.ParseInt(v, 10, 64); err != nil {
+						return nil, fmt.Errorf("invalid size for %q: %v", path, err)
+					}
+				}
+				if v := a["TTH"]; v != "" {
+					if err = e.TTH.FromBase32(v); err != nil {
+						return nil, fmt.Errorf("invalid TTH for %q: %v", path, err)
+					}
+				}
+				if err = r.dec.Skip(); err != nil {
+					return nil, truncated(err)
+				}
+				return e, nil
+			default:
+				// unknown element, ignore
+				if err = r.dec.Skip(); err != nil {
+					return nil, truncated(err)
+				}
+			}
+		case xml.EndElement:
+			if len(r.path) != 0 {
+				r.path = r.path[:len(r.path)-1]
+				continue
+			}
+			// end of the listing
+			r.done = true
+			return nil, io.EOF
+		}
+	}
+}
+
+// truncated converts errors caused by a truncated input to io.ErrUnexpectedEOF.
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if e, ok := err.(*xml.SyntaxError); ok && e.Msg == "unexpected EOF" {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *Reader) readHeader(e xml.StartElement) error {
+	h := &FileList{XMLName: e.Name}
+	a := attrs(e)
+	if v := a["Version"]; v != "" {
+		ver, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid version: %v", err)
+		}
+		h.Version = ver
+	}
+	if v := a["CID"]; v != "" {
+		if err := h.CID.FromBase32(v); err != nil {
+			return fmt.Errorf("invalid CID: %v", err)
+		}
+	}
+	h.Base = a["Base"]
+	h.Generator = a["Generator"]
+	r.header = h
+	return nil
+}
+
+// ReadAll builds a file list from the stream. If the list is truncated, it returns
+// all entries that were read before the error, together with the error.
+func ReadAll(rd io.Reader) (*FileList, error) {
+	r := NewReader(rd)
+	var (
+		list  *FileList
+		stack []*Dir
+	)
+	root := &Dir{}
+	for {
+		e, err := r.Next()
+		if list == nil && r.header != nil {
+			list = r.header
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if list != nil {
+				list.Dirs, list.Files = root.Dirs, root.Files
+			}
+			return list, err
+		}
+		// find the parent for this entry
+		depth := strings.Count(e.Path, "/")
+		stack = stack[:depth]
+		parent := root
+		if depth > 0 {
+			parent = stack[depth-1]
+		}
+		name := e.Path[strings.LastIndexByte(e.Path, '/')+1:]
+		if e.Dir {
+			d := Dir{Name: name}
+			if e.Incomplete {
+				d.Incomplete = 1
+			}
+			parent.Dirs = append(parent.Dirs, d)
+			stack = append(stack, &parent.Dirs[len(parent.Dirs)-1])
+		} else {
+			parent.Files = append(parent.Files, File{Name: name, Size: e.Size, TTH: e.TTH})
+		}
+	}
+	list.Dirs, list.Files = root.Dirs, root.Files
+	return list, nil
+}
@@ -7,6 +7,7 @@ require (
 	github.com/beorn7/perks v1.0.0 // indirect
 	github.com/direct-connect/go-dc v0.8.1
 	github.com/go-irc/irc v2.1.0+incompatible
+	github.com/golang/protobuf v1.3.1
 	github.com/hidal-go/hidalgo v0.0.0-20190420191634-c112d74960ad
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/pelletier/go-toml v1.3.0 // indirect
@@ -23,7 +24,7 @@ require (
 	github.com/stretchr/testify v1.3.0
 	golang.org/x/crypto v0.0.0-20190426145343-a29dc8fdc734 // indirect
 	golang.org/x/net v0.0.0-20190503192946-f4e77d36d62c
-	golang.org/x/sys v0.0.0-20190502175342-a43fa875dd82 // indirect
+	golang.org/x/sys v0.0.0-20190502175342-a43fa875dd82
 	golang.org/x/text v0.3.2
 	golang.org/x/tools v0.0.0-20190503185657-3b6f9c0030f7 // indirect
 )
@@ -0,0 +1,69 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newSecureTestPeer adds a test peer that is connected via TLS.
+func newSecureTestPeer(t testing.TB, h *Hub, name string) *adcPeer {
+	p := newTestADCPeer(t, h, name)
+	p.ConnInfo().Secure = true
+	return p
+}
+
+func TestAccountCommands(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	p := newSecureTestPeer(t, h, "user")
+	require.True(t, h.isCommand(p, "!regme short"))
+	ok, err := h.IsRegistered("user")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.True(t, h.isCommand(p, "!regme secret"))
+	rec, err := h.db.GetUser("user")
+	require.NoError(t, err)
+	require.Equal(t, "secret", rec.Pass)
+	require.False(t, rec.Registered.IsZero())
+
+	// reconnect as a registered user
+	_ = p.Close()
+	p = newSecureTestPeer(t, h, "user")
+	u, _, err := h.getUser("user")
+	require.NoError(t, err)
+	p.setUser(u)
+	h.userLoggedIn(p)
+
+	require.True(t, h.isCommand(p, "!passwd wrong secret2"))
+	rec, err = h.db.GetUser("user")
+	require.NoError(t, err)
+	require.Equal(t, "secret", rec.Pass)
+
+	require.True(t, h.isCommand(p, "!passwd secret secret2"))
+	rec, err = h.db.GetUser("user")
+	require.NoError(t, err)
+	require.Equal(t, "secret2", rec.Pass)
+	require.False(t, rec.LastLogin.IsZero())
+
+	sentADC(p)
+	require.True(t, h.isCommand(p, "!info"))
+	require.Len(t, sentADC(p), 1)
+}
+
+func TestAccountSelfRegDisabled(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	h.SetConfigBool(ConfigUsersSelfReg, false)
+
+	p := newSecureTestPeer(t, h, "user")
+	require.True(t, h.isCommand(p, "!regme secret"))
+	ok, err := h.IsRegistered("user")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,423 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PermAnnounce allows managing scheduled announcements.
+const PermAnnounce = "hub.announce"
+
+// Audiences of announcements.
+const (
+	AudienceAll          = "all"
+	AudienceUnregistered = "unregistered"
+	AudienceRegistered   = "registered"
+)
+
+// announceTick is the resolution of the announcement scheduler.
+const announceTick = time.Second
+
+// Announcement is a message posted by the hub bot on a schedule.
+type Announcement struct {
+	// ID is a unique name of the announcement.
+	ID string `json:"id"`
+	// Schedule is either a cron expression with 5 fields (minute, hour, day of month, month, day of week),
+	// or one of @hourly, @daily, @weekly, @every <duration>. Cron expressions use the hub time zone.
+	Schedule string `json:"schedule"`
+	// Room to post the message to. Zero value means the main chat.
+	Room string `json:"room,omitempty"`
+	// Audience selects users that receive the message. Zero value means AudienceAll.
+	Audience string `json:"audience,omitempty"`
+	Text     string `json:"text"`
+	// Paused announcements are not posted.
+	Paused bool `json:"paused,omitempty"`
+}
+
+func (a Announcement) String() string {
+	s := fmt.Sprintf("%s [%s]", a.ID, a.Schedule)
+	if a.Room != "" {
+		s += " " + a.Room
+	}
+	if a.Audience != "" && a.Audience != AudienceAll {
+		s += " to " + a.Audience
+	}
+	if a.Paused {
+		s += " (paused)"
+	}
+	return s + ": " + a.Text
+}
+
+type announceJob struct {
+	Announcement
+	sched schedule
+	next  time.Time
+}
+
+// announcer holds scheduled announcements. Announcements added at runtime are not persisted.
+type announcer struct {
+	sync.Mutex
+	jobs map[string]*announceJob
+}
+
+// schedule returns the next activation time after t.
+type schedule interface {
+	Next(t time.Time) time.Time
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule is a parsed cron expression. Each field is a bit set of allowed values.
+type cronSchedule struct {
+	min, hour, dom, month, dow uint64
+	// domAny and dowAny are set if the field is '*'. If both day fields are restricted,
+	// either of them may match, as in the classic cron.
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	// give up if the expression never matches, for example "0 0 31 2 *"
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.min&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// parseCronField parses a single field of a cron expression: '*', 'a', 'a-b', with an optional '/step', or a list of them.
+func parseCronField(s string, min, max int) (uint64, bool, error) {
+	if s == "*" {
+		var bits uint64
+		for i := min; i <= max; i++ {
+			bits |= 1 << uint(i)
+		}
+		return bits, true, nil
+	}
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			v, err := strconv.Atoi(part[i+1:])
+			if err != nil || v <= 0 {
+				return 0, false, fmt.Errorf("invalid step: %q", part)
+			}
+			step, part = v, part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			if i := strings.IndexByte(part, '-'); i >= 0 {
+				a, err1 := strconv.Atoi(part[:i])
+				b, err2 := strconv.Atoi(part[i+1:])
+				if err1 != nil || err2 != nil {
+					return 0, false, fmt.Errorf("invalid range: %q", part)
+				}
+				lo, hi = a, b
+			} else {
+				v, err := strconv.Atoi(part)
+				if err != nil {
+					return 0, false, fmt.Errorf("invalid value: %q", part)
+				}
+				lo, hi = v, v
+				if step != 1 {
+					hi = max
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, false, fmt.Errorf("value out of range [%d, %d]: %q", min, max, part)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, false, nil
+}
+
+// parseSchedule parses a schedule of an announcement. Cron expressions are evaluated in a given time zone.
+func parseSchedule(s string, loc *time.Location) (schedule, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "@hourly":
+		s = "0 * * * *"
+	case "@daily":
+		s = "0 0 * * *"
+	case "@weekly":
+		s = "0 0 * * 0"
+	}
+	if strings.HasPrefix(s, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(s, "@every ")))
+		if err != nil {
+			return nil, err
+		} else if d < time.Minute {
+			return nil, errors.New("interval must be at least a minute")
+		}
+		return everySchedule(d), nil
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in a cron expression, got: %q", s)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	c := &cronSchedule{loc: loc}
+	var err error
+	if c.min, _, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, _, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, c.domAny, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, _, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, c.dowAny, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		// both 0 and 7 mean Sunday
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func (h *Hub) newAnnounceJob(a Announcement, now time.Time) (*announceJob, error) {
+	if a.ID == "" {
+		return nil, errors.New("announcement id must be set")
+	} else if a.Text == "" {
+		return nil, errors.New("announcement text must be set")
+	}
+	switch a.Audience {
+	case "":
+		a.Audience = AudienceAll
+	case AudienceAll, AudienceUnregistered, AudienceRegistered:
+	default:
+		return nil, fmt.Errorf("unsupported audience: %q", a.Audience)
+	}
+	if a.Room != "" && !strings.HasPrefix(a.Room, "#") {
+		return nil, errors.New("room name should start with '#'")
+	}
+	sched, err := parseSchedule(a.Schedule, h.getTimeZone())
+	if err != nil {
+		return nil, err
+	}
+	return &announceJob{Announcement: a, sched: sched, next: sched.Next(now)}, nil
+}
+
+// SetAnnouncement adds or replaces a scheduled announcement.
+func (h *Hub) SetAnnouncement(a Announcement) error {
+	job, err := h.newAnnounceJob(a, time.Now())
+	if err != nil {
+		return err
+	}
+	h.announce.Lock()
+	defer h.announce.Unlock()
+	if h.announce.jobs == nil {
+		h.announce.jobs = make(map[string]*announceJob)
+	}
+	h.announce.jobs[a.ID] = job
+	return nil
+}
+
+// DelAnnouncement removes a scheduled announcement. It returns false if it doesn't exist.
+func (h *Hub) DelAnnouncement(id string) bool {
+	h.announce.Lock()
+	defer h.announce.Unlock()
+	_, ok := h.announce.jobs[id]
+	delete(h.announce.jobs, id)
+	return ok
+}
+
+// Announcements returns all scheduled announcements, sorted by ID.
+func (h *Hub) Announcements() []Announcement {
+	h.announce.Lock()
+	list := make([]Announcement, 0, len(h.announce.jobs))
+	for _, j := range h.announce.jobs {
+		list = append(list, j.Announcement)
+	}
+	h.announce.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (h *Hub) announcement(id string) (Announcement, bool) {
+	h.announce.Lock()
+	defer h.announce.Unlock()
+	j, ok := h.announce.jobs[id]
+	if !ok {
+		return Announcement{}, false
+	}
+	return j.Announcement, true
+}
+
+// postAnnouncement sends the announcement to its audience.
+func (h *Hub) postAnnouncement(a Announcement) {
+	r := h.globalChat
+	if a.Room != "" {
+		if r = h.Room(a.Room); r == nil {
+			log.Printf("announcement %q: no such room: %s", a.ID, a.Room)
+			return
+		}
+	}
+	if a.Audience == "" || a.Audience == AudienceAll {
+		r.SendChat(h.hubUser.p, Message{Name: h.hubUser.Name(), Text: a.Text})
+		return
+	}
+	m := Message{Time: time.Now().UTC(), Name: h.hubUser.Name(), Text: a.Text}
+	reg := a.Audience == AudienceRegistered
+	for _, p := range r.Peers() {
+		if PeerProtocol(p) != ProtoBot && p.User().IsRegistered() == reg {
+			_ = p.ChatMsg(r, h.hubUser.p, m)
+		}
+	}
+}
+
+// runAnnouncements posts announcements that are due.
+func (h *Hub) runAnnouncements(now time.Time) {
+	var due []Announcement
+	h.announce.Lock()
+	for _, j := range h.announce.jobs {
+		if j.next.IsZero() || now.Before(j.next) {
+			continue
+		}
+		j.next = j.sched.Next(now)
+		if !j.Paused {
+			due = append(due, j.Announcement)
+		}
+	}
+	h.announce.Unlock()
+	for _, a := range due {
+		h.postAnnouncement(a)
+	}
+}
+
+func (h *Hub) runAnnouncer() {
+	ticker := time.NewTicker(announceTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.closed:
+			return
+		case now := <-ticker.C:
+			h.runAnnouncements(now)
+		}
+	}
+}
+
+func (h *Hub) cmdAnnounce(p Peer, args string) error {
+	sub, args := cutReason(strings.TrimSpace(args))
+	id, arg := cutReason(args)
+	switch sub {
+	case "", "list", "ls":
+		list := h.Announcements()
+		if len(list) == 0 {
+			h.cmdOutput(p, "no announcements")
+			return nil
+		}
+		var buf strings.Builder
+		buf.WriteString("announcements:")
+		for _, a := range list {
+			buf.WriteString("\n" + a.String())
+		}
+		h.cmdOutput(p, buf.String())
+		return nil
+	case "add":
+		i := strings.IndexByte(arg, '|')
+		if id == "" || i < 0 {
+			return errors.New("usage: announce add <id> <schedule> | <text>")
+		}
+		a := Announcement{
+			ID:       id,
+			Schedule: strings.TrimSpace(arg[:i]),
+			Text:     strings.TrimSpace(arg[i+1:]),
+		}
+		if old, ok := h.announcement(id); ok {
+			a.Room, a.Audience, a.Paused = old.Room, old.Audience, old.Paused
+		}
+		if err := h.SetAnnouncement(a); err != nil {
+			return err
+		}
+		h.audit(AuditConfig, p, "announce "+id, a.Schedule+" | "+a.Text)
+		h.cmdOutput(p, "announcement added: "+id)
+		return nil
+	case "del", "rm":
+		if !h.DelAnnouncement(id) {
+			return errors.New("no such announcement: " + id)
+		}
+		h.audit(AuditConfig, p, "announce "+id, "delete")
+		h.cmdOutput(p, "announcement removed: "+id)
+		return nil
+	}
+	a, ok := h.announcement(id)
+	if !ok {
+		return errors.New("no such announcement: " + id)
+	}
+	switch sub {
+	case "run":
+		h.postAnnouncement(a)
+		return nil
+	case "pause":
+		a.Paused = true
+	case "resume":
+		a.Paused = false
+	case "room":
+		a.Room = arg
+	case "audience":
+		a.Audience = arg
+	default:
+		return fmt.Errorf("usage: announce list|add|del|run|pause|resume|room|audience")
+	}
+	if err := h.SetAnnouncement(a); err != nil {
+		return err
+	}
+	h.audit(AuditConfig, p, "announce "+id, strings.TrimSpace(sub+" "+arg))
+	h.cmdOutput(p, "announcement updated: "+id)
+	return nil
+}
@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var scheduleCases = []struct {
+	sched string
+	from  string
+	next  string
+}{
+	{"*/15 * * * *", "2019-05-01T10:07:30Z", "2019-05-01T10:15:00Z"},
+	{"0 9 * * 1-5", "2019-05-03T09:00:00Z", "2019-05-06T09:00:00Z"}, // Friday -> Monday
+	{"30 18 1 * *", "2019-05-02T00:00:00Z", "2019-06-01T18:30:00Z"},
+	{"0 0 * * 7", "2019-05-01T00:00:00Z", "2019-05-05T00:00:00Z"},
+	{"0,30 12 * * *", "2019-05-01T12:00:00Z", "2019-05-01T12:30:00Z"},
+	{"@daily", "2019-12-31T23:59:00Z", "2020-01-01T00:00:00Z"},
+	{"@every 90m", "2019-05-01T10:00:00Z", "2019-05-01T11:30:00Z"},
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, c := range scheduleCases {
+		t.Run(c.sched, func(t *testing.T) {
+			s, err := parseSchedule(c.sched, time.UTC)
+			require.NoError(t, err)
+			from, err := time.Parse(time.RFC3339, c.from)
+			require.NoError(t, err)
+			next, err := time.Parse(time.RFC3339, c.next)
+			require.NoError(t, err)
+			require.True(t, next.Equal(s.Next(from)), "%v", s.Next(from))
+		})
+	}
+	for _, s := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "@every 1s"} {
+		_, err := parseSchedule(s, time.UTC)
+		require.Error(t, err, "%q", s)
+	}
+	s, err := parseSchedule("0 0 31 2 *", time.UTC)
+	require.NoError(t, err)
+	require.True(t, s.Next(time.Now()).IsZero())
+}
+
+func TestAnnouncements(t *testing.T) {
+	h, err := NewHub(Config{
+		Announcements: []Announcement{
+			{ID: "rules", Schedule: "@hourly", Text: "read the rules", Audience: AudienceUnregistered},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, h.loadProfiles())
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	guest := newTestADCPeer(t, h, "guest")
+
+	sentADC(op)
+	sentADC(guest)
+	h.runAnnouncements(time.Now().Add(time.Hour + time.Minute))
+	require.Contains(t, lastChat(t, guest), `read\sthe\srules`)
+	require.Empty(t, sentADC(op))
+
+	// not posted again until the next activation
+	h.runAnnouncements(time.Now().Add(time.Hour + time.Minute))
+	require.Empty(t, sentADC(guest))
+
+	require.True(t, h.isCommand(op, "!announce add event @every 2h | party tonight"))
+	require.True(t, h.isCommand(op, "!announce pause rules"))
+	list := h.Announcements()
+	require.Len(t, list, 2)
+	require.Equal(t, "event", list[0].ID)
+	require.True(t, list[1].Paused)
+
+	sentADC(op)
+	sentADC(guest)
+	h.runAnnouncements(time.Now().Add(3 * time.Hour))
+	require.Contains(t, lastChat(t, op), `party\stonight`)
+	require.Contains(t, lastChat(t, guest), `party\stonight`)
+
+	require.True(t, h.isCommand(op, "!announce del event"))
+	require.Len(t, h.Announcements(), 1)
+
+	_, err = NewHub(Config{
+		Announcements: []Announcement{{ID: "bad", Schedule: "@often", Text: "x"}},
+	})
+	require.Error(t, err)
+}
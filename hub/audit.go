@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// PermAudit allows reading the audit log.
+const PermAudit = "audit.read"
+
+// Actions recorded in the audit log.
+const (
+	AuditKick     = "kick"
+	AuditBan      = "ban"
+	AuditUnban    = "unban"
+	AuditRegister = "register"
+	AuditProfile  = "profile"
+	AuditConfig   = "config"
+)
+
+// AuditEntry is a record of an administrative action.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor,omitempty"`
+	Target string    `json:"target,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func (e AuditEntry) String() string {
+	s := fmt.Sprintf("%s %s: %s -> %s", e.Time.Format(time.RFC3339), e.Action, e.Actor, e.Target)
+	if e.Reason != "" {
+		s += " (" + e.Reason + ")"
+	}
+	return s
+}
+
+// AuditQuery selects entries of the audit log. Zero fields match any entry.
+type AuditQuery struct {
+	Action string
+	Actor  string
+	Target string
+	Since  time.Time
+	// Limit is the maximal number of entries to return. Zero means no limit.
+	Limit int
+}
+
+// Match checks if the entry matches the query. Limit is not checked.
+func (q AuditQuery) Match(e AuditEntry) bool {
+	if q.Action != "" && q.Action != e.Action {
+		return false
+	}
+	if q.Actor != "" && q.Actor != e.Actor {
+		return false
+	}
+	if q.Target != "" && q.Target != e.Target {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	return true
+}
+
+type AuditDatabase interface {
+	// AppendAudit adds an entry to the audit log. Entries are never changed or removed.
+	AppendAudit(e AuditEntry) error
+	// QueryAudit returns audit log entries matching the query, starting from the most recent one.
+	QueryAudit(q AuditQuery) ([]AuditEntry, error)
+}
+
+// audit records an administrative action. The action is logged even if the hub has no database.
+func (h *Hub) audit(action string, actor Peer, target, reason string) {
+	e := AuditEntry{
+		Time:   time.Now().UTC(),
+		Action: action,
+		Target: target,
+		Reason: reason,
+	}
+	if actor != nil {
+		e.Actor = actor.Name()
+	}
+	log.Println("audit:", e)
+	if h.db == nil {
+		return
+	}
+	if err := h.db.AppendAudit(e); err != nil {
+		h.hubError("cannot write the audit log: %v", err)
+	}
+}
+
+// Audit returns entries of the audit log, starting from the most recent one.
+func (h *Hub) Audit(q AuditQuery) ([]AuditEntry, error) {
+	if h.db == nil {
+		return nil, nil
+	}
+	return h.db.QueryAudit(q)
+}
+
+func (h *Hub) cmdAudit(p Peer, action RawCmd) error {
+	list, err := h.Audit(AuditQuery{Action: string(action), Limit: 20})
+	if err != nil {
+		return err
+	} else if len(list) == 0 {
+		h.cmdOutput(p, "audit log is empty")
+		return nil
+	}
+	var buf strings.Builder
+	buf.WriteString("audit log:")
+	// print in chronological order
+	for i := len(list) - 1; i >= 0; i-- {
+		buf.WriteString("\n" + list[i].String())
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
@@ -0,0 +1,89 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditCommands(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	victim := newTestADCPeer(t, h, "victim")
+
+	require.True(t, h.isCommand(op, "!drop victim"))
+	require.False(t, victim.Online())
+	require.True(t, h.isCommand(op, "!banip 10.0.0.1 spam bot"))
+	require.True(t, h.isCommand(op, "!unbanip 10.0.0.1"))
+
+	list, err := h.Audit(AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	for i := range list {
+		require.Equal(t, "op", list[i].Actor)
+		require.False(t, list[i].Time.IsZero())
+		list[i].Time, list[i].Actor = time.Time{}, ""
+	}
+	require.Equal(t, []AuditEntry{
+		{Action: AuditUnban, Target: "10.0.0.1"},
+		{Action: AuditBan, Target: "10.0.0.1", Reason: "spam bot"},
+		{Action: AuditKick, Target: "victim"},
+	}, list)
+
+	list, err = h.Audit(AuditQuery{Action: AuditBan})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	sentADC(op)
+	require.True(t, h.isCommand(op, "!audit"))
+	require.Contains(t, lastChat(t, op), "spam")
+
+	// regular users cannot read the audit log
+	user := newTestADCPeer(t, h, "user")
+	sentADC(user)
+	require.True(t, h.isCommand(user, "!audit"))
+	require.Contains(t, lastChat(t, user), "unsupported")
+}
+
+func TestAuditHTTP(t *testing.T) {
+	h, err := NewHub(Config{APIToken: "secret"})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	h.audit(AuditKick, nil, "a", "")
+	h.audit(AuditBan, nil, "b", "")
+
+	get := func(url, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", url, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.serveV0Audit(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, get(HTTPAuditPathV0, "").Code)
+	require.Equal(t, http.StatusUnauthorized, get(HTTPAuditPathV0, "wrong").Code)
+
+	w := get(HTTPAuditPathV0+"?action=ban", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []AuditEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list, 1)
+	require.Equal(t, "b", list[0].Target)
+
+	require.Equal(t, http.StatusBadRequest, get(HTTPAuditPathV0+"?limit=x", "secret").Code)
+
+	// disabled without a token
+	h.conf.APIToken = ""
+	require.Equal(t, http.StatusNotFound, get(HTTPAuditPathV0, "secret").Code)
+}
@@ -0,0 +1,172 @@
+package hub
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+)
+
+var (
+	// ErrAuthUnknownUser is returned by AuthProvider if the user is not known to the provider.
+	ErrAuthUnknownUser = errors.New("unknown user")
+	// ErrAuthWrongPassword is returned by AuthProvider if the password doesn't match.
+	ErrAuthWrongPassword = errors.New("wrong password")
+)
+
+// AuthProvider authenticates users against an account system.
+//
+// Providers are chained: the first provider that knows the user decides if the login succeeds.
+// Users that are not known to any of the providers log in as unregistered users.
+type AuthProvider interface {
+	// Name returns a short name of the provider, used in logs.
+	Name() string
+	// Authenticate checks the password of the user and returns the name of the user profile.
+	// Empty profile name means the default profile of registered users.
+	//
+	// It must return ErrAuthUnknownUser if the user is not known to the provider,
+	// and ErrAuthWrongPassword if the password doesn't match.
+	// An empty password must never be accepted for known users.
+	Authenticate(name, pass string) (profile string, err error)
+}
+
+// UserChecker is an optional interface for providers that can check if the user exists
+// without the password.
+//
+// Providers that implement neither UserLookup nor UserChecker are assumed to know all users,
+// thus the providers after them in the chain are never used.
+type UserChecker interface {
+	// HasUser reports if the user is known to the provider.
+	HasUser(name string) (bool, error)
+}
+
+// UserLookup is an optional interface for providers that know passwords of users.
+//
+// ADC clients never send the password itself, only a salted hash of it. Thus, only providers
+// that implement this interface are able to authenticate ADC users.
+type UserLookup interface {
+	// LookupUser returns a user record, or nil if the user is not known to the provider.
+	LookupUser(name string) (*UserRecord, error)
+}
+
+// SetAuthProviders sets a chain of authentication providers for the hub.
+// By default, only the local users database is used (see LocalAuth).
+func (h *Hub) SetAuthProviders(list ...AuthProvider) {
+	h.auth = list
+}
+
+// LocalAuth returns an authentication provider that uses the hub's users database.
+func (h *Hub) LocalAuth() AuthProvider {
+	return localAuth{h: h}
+}
+
+func (h *Hub) authProviders() []AuthProvider {
+	if h.auth == nil {
+		return []AuthProvider{h.LocalAuth()}
+	}
+	return h.auth
+}
+
+// findUser returns the first provider in the chain that knows the user, and the user record
+// if the provider implements UserLookup. It returns nil if no providers know the user.
+func (h *Hub) findUser(name string) (AuthProvider, *UserRecord, error) {
+	for _, p := range h.authProviders() {
+		if l, ok := p.(UserLookup); ok {
+			rec, err := l.LookupUser(name)
+			if err != nil {
+				return nil, nil, err
+			} else if rec != nil {
+				return p, rec, nil
+			}
+			continue
+		}
+		c, ok := p.(UserChecker)
+		if !ok {
+			// the provider cannot tell, the password is required
+			return p, nil, nil
+		}
+		ok, err := c.HasUser(name)
+		if err != nil {
+			log.Printf("auth %s: %q: %v", p.Name(), name, err)
+			return nil, nil, err
+		} else if ok {
+			return p, nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// authUser checks the password of the user with the chain of providers.
+// It returns nil if the user is not known to any of the providers.
+// Known users must provide a valid password, empty passwords are always rejected.
+func (h *Hub) authUser(name, pass string) (*User, error) {
+	p, rec, err := h.findUser(name)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return h.authUserWith(p, rec, name, pass)
+}
+
+// authUserWith checks the password of the user known to a given provider.
+func (h *Hub) authUserWith(p AuthProvider, rec *UserRecord, name, pass string) (*User, error) {
+	if pass == "" {
+		// some providers (LDAP) treat it as an anonymous login
+		return nil, ErrAuthWrongPassword
+	}
+	if rec != nil {
+		if !checkPassword(rec.Pass, pass) {
+			return nil, ErrAuthWrongPassword
+		}
+		return h.newAuthUser(name, rec.Profile), nil
+	}
+	profile, err := p.Authenticate(name, pass)
+	if err == ErrAuthUnknownUser {
+		// the user was removed after the lookup
+		err = ErrAuthWrongPassword
+	}
+	if err == ErrAuthWrongPassword {
+		return nil, err
+	} else if err != nil {
+		log.Printf("auth %s: %q: %v", p.Name(), name, err)
+		return nil, err
+	}
+	return h.newAuthUser(name, profile), nil
+}
+
+// checkPassword compares passwords in constant time.
+func checkPassword(exp, pass string) bool {
+	return subtle.ConstantTimeCompare([]byte(exp), []byte(pass)) == 1
+}
+
+func (h *Hub) newAuthUser(name, profile string) *User {
+	u := &User{profile: h.Profile(profile)}
+	if u.profile == nil {
+		u.profile = h.Profile(ProfileNameRegistered)
+	}
+	u.setName(name)
+	return u
+}
+
+type localAuth struct {
+	h *Hub
+}
+
+func (localAuth) Name() string {
+	return "local"
+}
+
+func (a localAuth) LookupUser(name string) (*UserRecord, error) {
+	_, rec, err := a.h.getUser(name)
+	return rec, err
+}
+
+func (a localAuth) Authenticate(name, pass string) (string, error) {
+	rec, err := a.LookupUser(name)
+	if err != nil {
+		return "", err
+	} else if rec == nil {
+		return "", ErrAuthUnknownUser
+	} else if pass == "" || !checkPassword(rec.Pass, pass) {
+		return "", ErrAuthWrongPassword
+	}
+	return rec.Profile, nil
+}
@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+// verifyAuth is a test provider that can verify passwords, but cannot look them up.
+type verifyAuth map[string]string
+
+func (verifyAuth) Name() string {
+	return "verify"
+}
+
+func (a verifyAuth) Authenticate(name, pass string) (string, error) {
+	exp, ok := a[name]
+	if !ok {
+		return "", ErrAuthUnknownUser
+	} else if exp != pass {
+		return "", ErrAuthWrongPassword
+	}
+	return ProfileNameOperator, nil
+}
+
+func (a verifyAuth) HasUser(name string) (bool, error) {
+	_, ok := a[name]
+	return ok, nil
+}
+
+// blindAuth is a test provider that cannot check if the user exists.
+type blindAuth struct {
+	a verifyAuth
+}
+
+func (blindAuth) Name() string {
+	return "blind"
+}
+
+func (b blindAuth) Authenticate(name, pass string) (string, error) {
+	return b.a.Authenticate(name, pass)
+}
+
+func TestAuthChain(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("local", "secret"))
+
+	p, rec, err := h.findUser("local")
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	require.Equal(t, "secret", rec.Pass)
+
+	ext := verifyAuth{"ext": "pass", "local": "other"}
+	h.SetAuthProviders(h.LocalAuth(), ext)
+
+	// external users are known, but cannot be looked up
+	p, rec, err = h.findUser("ext")
+	require.NoError(t, err)
+	require.Equal(t, ext, p)
+	require.Nil(t, rec)
+	p, _, err = h.findUser("guest")
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	u, err := h.authUser("ext", "pass")
+	require.NoError(t, err)
+	require.NotNil(t, u)
+	require.True(t, u.HasPerm(PermBanIP))
+
+	_, err = h.authUser("ext", "wrong")
+	require.Equal(t, ErrAuthWrongPassword, err)
+
+	// the first provider that knows the user decides
+	_, err = h.authUser("local", "other")
+	require.Equal(t, ErrAuthWrongPassword, err)
+	u, err = h.authUser("local", "secret")
+	require.NoError(t, err)
+	require.NotNil(t, u)
+
+	// unknown users are treated as guests
+	u, err = h.authUser("guest", "pass")
+	require.NoError(t, err)
+	require.Nil(t, u)
+
+	// known users must provide a password
+	_, err = h.authUser("ext", "")
+	require.Equal(t, ErrAuthWrongPassword, err)
+	_, err = h.authUser("local", "")
+	require.Equal(t, ErrAuthWrongPassword, err)
+
+	// providers that cannot check users know all of them
+	blind := blindAuth{ext}
+	h.SetAuthProviders(blind, h.LocalAuth())
+	p, _, err = h.findUser("guest")
+	require.NoError(t, err)
+	require.Equal(t, blind, p)
+}
+
+func TestAuthExternalNMDC(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	h.SetAuthProviders(h.LocalAuth(), verifyAuth{"ext": "pass"})
+
+	// users not known to providers are not asked for a password
+	guest := loginNMDC(t, h, 1, "guest", loginDCPP)
+	guest.join(loginDCPP)
+	require.Nil(t, h.PeerByName("guest").User())
+
+	// empty password doesn't log in as an unregistered user
+	login := loginDCPP
+	login.secure = true
+	c := loginNMDC(t, h, 2, "ext", login)
+	c.expect("GetPass")
+	c.send("$MyPass |")
+	c.expect("BadPass")
+	require.Nil(t, h.PeerByName("ext"))
+
+	c = loginNMDC(t, h, 3, "ext", login)
+	c.expect("GetPass")
+	c.send("$MyPass pass|")
+	c.join(login)
+	u := h.PeerByName("ext").User()
+	require.NotNil(t, u)
+	require.True(t, u.IsOp())
+}
+
+func TestAuthExternalADC(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+	th.h.SetDatabase(NewDatabase())
+	require.NoError(t, th.h.loadProfiles())
+	th.h.SetAuthProviders(th.h.LocalAuth(), verifyAuth{"ext": "pass"})
+
+	// ADC clients cannot log in as external users, since the provider needs the password
+	c := th.Dial()
+	c.Send("HSUP ADBASE ADTIGR")
+	p := c.Expect("SID", nil)
+	var sid adc.SIDAssign
+	require.NoError(t, adc.Unmarshal(p.Message().Data, &sid))
+	pid := types.NewPID()
+	c.SendMsg("BINF "+sid.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: "ext",
+		Slots: 1, SlotsFree: 1, HubsNormal: 1,
+	})
+	p = c.Expect("STA", nil)
+	var st adc.Status
+	require.NoError(t, adc.Unmarshal(p.Message().Data, &st))
+	require.Equal(t, adc.CodeBadPassword, st.Code)
+	require.Nil(t, th.h.PeerByName("ext"))
+
+	th.JoinADC("guest")
+}
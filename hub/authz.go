@@ -0,0 +1,231 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// DefaultAuthzTimeout is the default timeout for requests to the authorization webhook.
+const DefaultAuthzTimeout = 5 * time.Second
+
+// Actions checked by the authorization webhook.
+const (
+	AuthzJoin    = "join"
+	AuthzSearch  = "search"
+	AuthzConnect = "connect"
+)
+
+// Decisions of the authorization webhook.
+const (
+	AuthzAllow    = "allow"
+	AuthzDeny     = "deny"
+	AuthzRedirect = "redirect"
+)
+
+// AuthzConfig configures an external authorization webhook.
+//
+// The webhook receives a POST request with AuthzRequest encoded as JSON and must respond
+// with AuthzDecision. Joins are always checked, searches and connection requests are opt-in.
+type AuthzConfig struct {
+	// URL of the webhook. Empty value disables it.
+	URL string
+	// Token is sent in the Authorization header as a bearer token.
+	Token string
+	// Search enables checks of search requests.
+	Search bool
+	// Connect enables checks of connection requests.
+	Connect bool
+	// Timeout of the webhook request. Zero value means DefaultAuthzTimeout.
+	Timeout time.Duration
+	// FailOpen allows actions if the webhook is not available. By default, they are denied.
+	FailOpen bool
+}
+
+// AuthzRequest is sent to the authorization webhook.
+type AuthzRequest struct {
+	Action   string      `json:"action"`
+	Name     string      `json:"name"`
+	Protocol string      `json:"protocol"`
+	IP       string      `json:"ip"`
+	CID      string      `json:"cid,omitempty"`
+	Profile  string      `json:"profile,omitempty"`
+	App      dc.Software `json:"app"`
+	Share    uint64      `json:"share"`
+	Secure   bool        `json:"secure"`
+	// Query is set for search requests.
+	Query string `json:"query,omitempty"`
+	// Target is set for connection requests.
+	Target string `json:"target,omitempty"`
+}
+
+// AuthzDecision is a response of the authorization webhook.
+type AuthzDecision struct {
+	// Decision is one of: allow, deny or redirect.
+	Decision string `json:"decision"`
+	// Reason is shown to the user if the action is denied.
+	Reason string `json:"reason,omitempty"`
+	// Redirect is an address of the hub to redirect the user to.
+	Redirect string `json:"redirect,omitempty"`
+}
+
+type authzClient struct {
+	conf AuthzConfig
+	cli  *http.Client
+}
+
+func newAuthzClient(conf AuthzConfig) *authzClient {
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultAuthzTimeout
+	}
+	return &authzClient{conf: conf, cli: &http.Client{Timeout: conf.Timeout}}
+}
+
+func (c *authzClient) call(req *AuthzRequest) (*AuthzDecision, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequest("POST", c.conf.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if c.conf.Token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.conf.Token)
+	}
+	resp, err := c.cli.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	var d AuthzDecision
+	if err = json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("cannot decode response: %v", err)
+	}
+	switch d.Decision {
+	case AuthzAllow, AuthzDeny:
+	case AuthzRedirect:
+		if d.Redirect == "" {
+			return nil, fmt.Errorf("redirect address is not set")
+		}
+	default:
+		return nil, fmt.Errorf("unexpected decision: %q", d.Decision)
+	}
+	return &d, nil
+}
+
+// authorize asks the webhook if the action is allowed for the peer.
+// It returns nil if the webhook is disabled.
+func (h *Hub) authorize(peer Peer, req AuthzRequest) *AuthzDecision {
+	if h.authz == nil {
+		return nil
+	}
+	info := peer.UserInfo()
+	req.Name = peer.Name()
+	req.Protocol = PeerProtocol(peer)
+	req.IP = addrString(peer.RemoteAddr())
+	req.Profile = peer.User().Profile().ID()
+	req.App = info.App
+	req.Share = info.Share
+	if c := peer.ConnInfo(); c != nil {
+		req.Secure = c.Secure
+	}
+	if cid := peer.CID(); !cid.IsZero() {
+		req.CID = cid.String()
+	}
+	d, err := h.authz.call(&req)
+	if err != nil {
+		log.Printf("authz: %s %q: %v", req.Action, req.Name, err)
+		if h.authz.conf.FailOpen {
+			return nil
+		}
+		return &AuthzDecision{Decision: AuthzDeny, Reason: "authorization is not available"}
+	}
+	return d
+}
+
+// authzJoin checks if the peer is allowed to join the hub. Denied peers are disconnected.
+//
+// It must be called during the handshake, before the peer is accepted on the hub.
+func (h *Hub) authzJoin(peer Peer) bool {
+	if h.authz == nil || PeerProtocol(peer) == ProtoBot {
+		return true
+	}
+	d := h.authorize(peer, AuthzRequest{Action: AuthzJoin})
+	if d == nil || d.Decision == AuthzAllow {
+		return true
+	}
+	reason := d.Reason
+	if reason == "" {
+		reason = errAccessDenied.Error()
+	}
+	switch p := peer.(type) {
+	case *adcPeer:
+		_ = p.sendInfoNow(&adc.Disconnect{ID: p.sid, Message: reason, Redirect: d.Redirect})
+	case *nmdcPeer:
+		_ = p.c.WriteOneMsg(&nmdcp.ChatMessage{Text: reason})
+		if d.Redirect != "" {
+			_ = p.c.WriteOneMsg(&nmdcp.ForceMove{Address: d.Redirect})
+		}
+	}
+	_ = peer.Close()
+	return false
+}
+
+// authzAction checks if the peer is allowed to perform an action after joining the hub.
+//
+// The peer cannot be redirected at this point, thus the redirect decision disconnects the peer.
+func (h *Hub) authzAction(peer Peer, req AuthzRequest) bool {
+	d := h.authorize(peer, req)
+	if d == nil || d.Decision == AuthzAllow {
+		return true
+	}
+	if d.Decision == AuthzRedirect {
+		_ = peer.Close()
+		return false
+	}
+	if d.Reason != "" {
+		_ = peer.HubChatMsg(Message{Text: d.Reason})
+	}
+	return false
+}
+
+// authzSearch checks if the search request is allowed by the webhook.
+func (h *Hub) authzSearch(peer Peer, req SearchRequest) bool {
+	if h.authz == nil || !h.authz.conf.Search {
+		return true
+	}
+	var q string
+	switch req := req.(type) {
+	case TTHSearch:
+		q = "TTH:" + TTH(req).Base32()
+	case NameSearch:
+		q = strings.Join(req.And, " ")
+	case FileSearch:
+		q = strings.Join(req.And, " ")
+	case DirSearch:
+		q = strings.Join(req.And, " ")
+	}
+	return h.authzAction(peer, AuthzRequest{Action: AuthzSearch, Query: q})
+}
+
+// authzConnect checks if the connection request is allowed by the webhook.
+func (h *Hub) authzConnect(from, to Peer) bool {
+	if h.authz == nil || !h.authz.conf.Connect {
+		return true
+	}
+	return h.authzAction(from, AuthzRequest{Action: AuthzConnect, Target: to.Name()})
+}
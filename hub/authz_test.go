@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func TestAuthzWebhook(t *testing.T) {
+	var last AuthzRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		last = AuthzRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&last))
+		var d AuthzDecision
+		switch {
+		case last.Name == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case last.Name == "spammer":
+			d = AuthzDecision{Decision: AuthzRedirect, Redirect: "adc://other.hub:411"}
+		case last.Query == "bad words" || last.Target == "victim":
+			d = AuthzDecision{Decision: AuthzDeny, Reason: "not allowed"}
+		default:
+			d = AuthzDecision{Decision: AuthzAllow}
+		}
+		_ = json.NewEncoder(w).Encode(d)
+	}))
+	defer srv.Close()
+
+	h, err := NewHub(Config{
+		Authz: AuthzConfig{URL: srv.URL, Token: "token", Search: true, Connect: true},
+	})
+	require.NoError(t, err)
+
+	p := newTestADCPeer(t, h, "user")
+	require.True(t, h.authzJoin(p))
+	require.Equal(t, AuthzJoin, last.Action)
+	require.Equal(t, "user", last.Name)
+	require.Equal(t, ProtoADC, last.Protocol)
+	require.Equal(t, "127.0.0.1", last.IP)
+
+	require.True(t, h.authzSearch(p, NameSearch{And: []string{"good"}}))
+	require.Equal(t, AuthzSearch, last.Action)
+	require.Equal(t, "good", last.Query)
+
+	sentADC(p)
+	require.False(t, h.authzSearch(p, NameSearch{And: []string{"bad", "words"}}))
+	require.Contains(t, lastChat(t, p), `not\sallowed`)
+
+	victim := newTestADCPeer(t, h, "victim")
+	require.False(t, h.authzConnect(p, victim))
+	require.True(t, h.authzConnect(victim, p))
+	require.True(t, p.Online())
+
+	s := newTestADCPeer(t, h, "spammer")
+	require.False(t, h.authzJoin(s))
+	require.False(t, s.Online())
+
+	// fail closed by default
+	b := newTestADCPeer(t, h, "broken")
+	require.False(t, h.authzJoin(b))
+	require.False(t, b.Online())
+
+	h.authz.conf.FailOpen = true
+	b = newTestADCPeer(t, h, "broken")
+	require.True(t, h.authzJoin(b))
+}
+
+func TestAuthzJoinHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AuthzRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		d := AuthzDecision{Decision: AuthzAllow}
+		if req.Name == "spammer" {
+			d = AuthzDecision{Decision: AuthzDeny, Reason: "not allowed"}
+		}
+		_ = json.NewEncoder(w).Encode(d)
+	}))
+	defer srv.Close()
+
+	th := newTestHarness(t, Config{Authz: AuthzConfig{URL: srv.URL}})
+	defer th.Close()
+	a := th.JoinADC("alice")
+
+	// denied peers are rejected before other users can see them
+	c := th.Dial()
+	c.Name = "spammer"
+	c.Send("HSUP ADBASE ADTIGR")
+	p := c.Expect("SID", nil)
+	var sid adc.SIDAssign
+	require.NoError(t, adc.Unmarshal(p.Message().Data, &sid))
+	c.SID = sid.SID
+	pid := types.NewPID()
+	c.SendMsg("BINF "+c.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: c.Name,
+		Slots: 1, SlotsFree: 1, HubsNormal: 1, ShareSize: 1,
+	})
+	c.Expect("QUI", nil)
+	c.ExpectClosed()
+
+	th.Sync(a)
+	require.Empty(t, a.Received("INF"))
+	require.Nil(t, th.h.PeerByName("spammer"))
+}
@@ -0,0 +1,58 @@
+package hub
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// discardConn is a connection that discards all writes.
+type discardConn struct{}
+
+func (discardConn) Read(p []byte) (int, error)         { return 0, io.EOF }
+func (discardConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (discardConn) Close() error                       { return nil }
+func (discardConn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: localhostIP, Port: 411} }
+func (discardConn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: localhostIP, Port: 1000} }
+func (discardConn) SetDeadline(t time.Time) error      { return nil }
+func (discardConn) SetReadDeadline(t time.Time) error  { return nil }
+func (discardConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func BenchmarkBroadcastChat(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			h, err := NewHub(Config{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer h.Close()
+
+			for i := 0; i < n; i++ {
+				c, err := adc.NewConn(discardConn{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				p, err := newADC(h, nil, c, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				p.setName("user" + strconv.Itoa(i))
+				go p.writer(time.Minute)
+				h.globalChat.Join(p)
+				defer p.closeWith(p)
+			}
+			from := h.HubUser().p
+			m := Message{Text: "some message that is sent to everyone on the hub"}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.globalChat.SendChat(from, m)
+			}
+		})
+	}
+}
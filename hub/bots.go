@@ -42,42 +42,58 @@ func (b *Bot) SendPrivate(to Peer, m Message) error {
 	return nil
 }
 
+// Close removes the bot from the hub.
 func (b *Bot) Close() error {
-	return b.p.closeWith(b.p)
+	return b.p.closeWith(b.p, func() error {
+		b.h.leave(b.p, b.p.SID(), nil)
+		return nil
+	})
 }
 
 func (h *Hub) newBot(name, desc, email string, kind UserKind, soft dc.Software) (*Bot, error) {
-	if err := h.validateUserName(name); err != nil {
-		return nil, err
-	} else if !h.nameAvailable(name, nil) {
-		return nil, errNickTaken
-	}
-	if _, ok := h.reserveName(name, nil, nil); !ok {
-		return nil, errNickTaken
-	}
 	if soft.Name == "" {
 		soft = h.getSoft()
 	}
-
 	p := &botPeer{kind: kind, soft: soft, desc: desc, email: email}
+	if err := h.addVirtualPeer(p, name); err != nil {
+		return nil, err
+	}
+	b := &Bot{h: h, p: p}
+	return b, nil
+}
+
+// addVirtualPeer adds a peer without a network connection to the hub.
+// The BasePeer of the peer is initialized by this function.
+func (h *Hub) addVirtualPeer(p Peer, name string) error {
+	if err := h.validateUserName(name); err != nil {
+		return err
+	} else if !h.nameAvailable(name, nil) {
+		return errNickTaken
+	}
+	unbind, ok := h.reserveName(name, nil, nil)
+	if !ok {
+		return errNickTaken
+	}
 	addr := &net.TCPAddr{
 		IP: localhostIP,
 	}
-	h.newBasePeer(&p.BasePeer, &ConnInfo{
+	err := h.newBasePeer(p.base(), &ConnInfo{
 		Remote: addr,
 		Local:  addr,
 		Secure: true,
 	})
-	p.setName(name)
+	if err != nil {
+		unbind()
+		return err
+	}
+	p.base().setName(name)
 
 	var list []Peer
 	h.acceptPeer(p, func() {
 		list = h.listPeers()
 	}, nil)
 	h.broadcastUserJoin(p, list)
-
-	b := &Bot{h: h, p: p}
-	return b, nil
+	return nil
 }
 
 func (h *Hub) NewBot(name string, soft dc.Software) (*Bot, error) {
@@ -96,8 +112,12 @@ type botPeer struct {
 	soft  dc.Software
 }
 
-func (*botPeer) Searchable() bool {
-	return false
+func (*botPeer) protocol() string {
+	return ProtoBot
+}
+
+func (*botPeer) Capabilities() PeerCaps {
+	return 0
 }
 
 func (p *botPeer) UserInfo() UserInfo {
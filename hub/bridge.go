@@ -0,0 +1,121 @@
+package hub
+
+import (
+	"strings"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// Conversions of search results between ADC and NMDC.
+//
+// Both protocols are bridged through SearchResult and UserInfo, but some details are lost:
+//
+//   - NMDC has no exclusion terms in searches. Those are dropped from $Search, but the results
+//     are still filtered by the hub with SearchRequest.Match.
+//   - ADC RES only reports free slots. The total number of slots is taken from the user info.
+//   - TTH searches are bridged between the "TTH:" prefix of NMDC $Search and the TR field of ADC SCH.
+//   - Directories are marked by a trailing slash in ADC results. NMDC file results without TTH
+//     are reported to ADC without the TR field.
+//   - Operator status (CT in ADC, $OpList in NMDC) is derived from the hub profile of the user,
+//     not from the peer's own claims.
+//   - ADC extended away (AW2) is reported to NMDC as a regular away flag.
+//   - NMDC has no file count in $MyINFO; ADC peers see zero shared files for NMDC users.
+//   - SOCKS5 mode of NMDC users is reported to ADC as passive.
+
+const (
+	// defaultSlots is reported to peers when the slots of the result source are unknown.
+	defaultSlots = 3
+)
+
+// nmdcToResult converts NMDC search result received from the peer.
+func nmdcToResult(peer Peer, msg *nmdcp.SR) SearchResult {
+	path := strings.Join(msg.Path, "/")
+	if msg.IsDir {
+		return Dir{
+			Peer: peer, Path: path,
+			FreeSlots: msg.FreeSlots, TotalSlots: msg.TotalSlots,
+		}
+	}
+	return File{
+		Peer: peer, Path: path, Size: msg.Size, TTH: msg.TTH,
+		FreeSlots: msg.FreeSlots, TotalSlots: msg.TotalSlots,
+	}
+}
+
+// adcToResult converts ADC search result received from the peer.
+func adcToResult(peer Peer, res *adc.SearchResult) SearchResult {
+	path := strings.TrimPrefix(res.Path, "/")
+	total := peer.UserInfo().Slots
+	if total < res.Slots {
+		total = res.Slots
+	}
+	if strings.HasSuffix(path, "/") {
+		path = strings.TrimSuffix(path, "/")
+		return Dir{
+			Peer: peer, Path: path,
+			FreeSlots: res.Slots, TotalSlots: total,
+		}
+	}
+	return File{
+		Peer: peer, Path: path, Size: uint64(res.Size), TTH: res.TTH,
+		FreeSlots: res.Slots, TotalSlots: total,
+	}
+}
+
+// resultToNMDC converts a search result to NMDC. It returns nil if the result cannot be converted.
+// Hub name and address are not set.
+func resultToNMDC(r SearchResult) *nmdcp.SR {
+	sr := &nmdcp.SR{
+		From:      r.From().Name(),
+		FreeSlots: defaultSlots, TotalSlots: defaultSlots,
+	}
+	setSlots := func(free, total int) {
+		if total != 0 {
+			sr.FreeSlots, sr.TotalSlots = free, total
+		}
+	}
+	switch r := r.(type) {
+	case File:
+		sr.Path = strings.Split(r.Path, "/")
+		sr.Size = r.Size
+		sr.TTH = r.TTH
+		setSlots(r.FreeSlots, r.TotalSlots)
+	case Dir:
+		sr.Path = strings.Split(r.Path, "/")
+		sr.IsDir = true
+		setSlots(r.FreeSlots, r.TotalSlots)
+	default:
+		return nil
+	}
+	return sr
+}
+
+// resultToADC converts a search result to ADC. The token is not set.
+func resultToADC(r SearchResult) (adc.SearchResult, bool) {
+	sr := adc.SearchResult{Slots: defaultSlots}
+	switch r := r.(type) {
+	case File:
+		sr.Path = r.Path
+		sr.Size = int64(r.Size)
+		sr.TTH = r.TTH
+		if r.TotalSlots != 0 {
+			sr.Slots = r.FreeSlots
+		}
+	case Dir:
+		sr.Path = r.Path
+		if !strings.HasSuffix(sr.Path, "/") {
+			sr.Path += "/"
+		}
+		if r.TotalSlots != 0 {
+			sr.Slots = r.FreeSlots
+		}
+	default:
+		return sr, false
+	}
+	if !strings.HasPrefix(sr.Path, "/") {
+		sr.Path = "/" + sr.Path
+	}
+	return sr, true
+}
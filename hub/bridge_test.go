@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"testing"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestBridgeUserInfo(t *testing.T) {
+	u := UserInfo{Name: "user", IPv4: true, Away: true, Passive: true}
+
+	m := u.toNMDC()
+	require.True(t, m.Flag.IsSet(nmdcp.FlagStatusAway))
+	require.True(t, m.Flag.IsSet(nmdcp.FlagIPv4))
+	require.Equal(t, nmdcp.UserModePassive, m.Mode)
+
+	a := u.toADC(CID{}, nil)
+	require.Equal(t, adc.AwayTypeNormal, a.Away)
+	require.False(t, a.Features.Has(adc.FeaTCP4), "passive user must not advertise TCP4")
+
+	u.Away, u.Passive = false, false
+	m = u.toNMDC()
+	require.False(t, m.Flag.IsSet(nmdcp.FlagStatusAway))
+	require.Equal(t, nmdcp.UserModeActive, m.Mode)
+
+	a = u.toADC(CID{}, nil)
+	require.Equal(t, adc.AwayTypeNone, a.Away)
+	require.True(t, a.Features.Has(adc.FeaTCP4))
+}
+
+func TestBridgeSearchResult(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	p := newTestADCPeer(t, h, "user")
+	p.info.user.Slots = 5
+	tth := TTH{1, 2, 3}
+
+	// ADC -> NMDC
+	r := adcToResult(p, &adc.SearchResult{Path: "/dir/file.txt", Size: 10, TTH: &tth, Slots: 2})
+	require.Equal(t, File{
+		Peer: p, Path: "dir/file.txt", Size: 10, TTH: &tth,
+		FreeSlots: 2, TotalSlots: 5,
+	}, r)
+	sr := resultToNMDC(r)
+	require.Equal(t, &nmdcp.SR{
+		From: "user", Path: []string{"dir", "file.txt"}, Size: 10, TTH: &tth,
+		FreeSlots: 2, TotalSlots: 5,
+	}, sr)
+
+	// NMDC -> ADC
+	r = nmdcToResult(p, &nmdcp.SR{
+		From: "user", Path: []string{"dir", "sub"}, IsDir: true,
+		FreeSlots: 0, TotalSlots: 4,
+	})
+	require.Equal(t, Dir{Peer: p, Path: "dir/sub", TotalSlots: 4}, r)
+	ar, ok := resultToADC(r)
+	require.True(t, ok)
+	require.Equal(t, adc.SearchResult{Path: "/dir/sub/", Slots: 0}, ar)
+
+	// NMDC files without TTH are still files
+	r = nmdcToResult(p, &nmdcp.SR{From: "user", Path: []string{"file.txt"}, Size: 3})
+	ar, ok = resultToADC(r)
+	require.True(t, ok)
+	require.Equal(t, adc.SearchResult{Path: "/file.txt", Size: 3, Slots: defaultSlots}, ar)
+
+	// ADC directories are marked with a trailing slash
+	r = adcToResult(p, &adc.SearchResult{Path: "/dir/sub/", Slots: 1})
+	require.Equal(t, Dir{Peer: p, Path: "dir/sub", FreeSlots: 1, TotalSlots: 5}, r)
+	sr = resultToNMDC(r)
+	require.Equal(t, &nmdcp.SR{
+		From: "user", Path: []string{"dir", "sub"}, IsDir: true,
+		FreeSlots: 1, TotalSlots: 5,
+	}, sr)
+	r = adcToResult(p, &adc.SearchResult{Path: "/file.txt", Size: 3, Slots: 1})
+	require.Equal(t, File{Peer: p, Path: "file.txt", Size: 3, FreeSlots: 1, TotalSlots: 5}, r)
+
+	// unknown slots
+	ar, ok = resultToADC(File{Peer: p, Path: "file", TTH: &tth})
+	require.True(t, ok)
+	require.Equal(t, defaultSlots, ar.Slots)
+	sr = resultToNMDC(Dir{Peer: p, Path: "dir"})
+	require.Equal(t, defaultSlots, sr.FreeSlots)
+	require.Equal(t, defaultSlots, sr.TotalSlots)
+}
@@ -0,0 +1,48 @@
+package hub
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/capture"
+)
+
+var captureNameReplacer = strings.NewReplacer(":", "_", "[", "", "]", "")
+
+// startCapture starts recording the protocol session if the capture is enabled in the config.
+// It returns nil if the capture is disabled or cannot be started.
+func (h *Hub) startCapture(conn net.Conn, proto string) *capture.Recorder {
+	dir := h.conf.CaptureDir
+	if dir == "" {
+		return nil
+	}
+	start := time.Now().UTC()
+	remote := conn.RemoteAddr().String()
+	name := fmt.Sprintf("%s_%s.%s.dccap",
+		start.Format("20060102T150405.000000000"),
+		captureNameReplacer.Replace(remote), proto,
+	)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		log.Printf("%s: cannot start capture: %v", remote, err)
+		return nil
+	}
+	rec, err := capture.NewRecorder(f, capture.Header{
+		Proto:  proto,
+		Local:  conn.LocalAddr().String(),
+		Remote: remote,
+		Start:  start,
+	})
+	if err != nil {
+		_ = f.Close()
+		log.Printf("%s: cannot start capture: %v", remote, err)
+		return nil
+	}
+	log.Printf("%s: capturing session to %s", remote, f.Name())
+	return rec
+}
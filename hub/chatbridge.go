@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	HTTPBridgePathV0   = "/api/v0/bridge"
+	HTTPBridgeWSPathV0 = "/api/v0/bridge/ws"
+
+	// maxBridgeMessage is the maximal length of the text of a bridged message.
+	maxBridgeMessage = 4096
+)
+
+var errBridgeEmpty = errors.New("user and text must be set")
+
+// ChatBridgeConfig configures a virtual user that injects messages from an external chat network.
+type ChatBridgeConfig struct {
+	// Name of the virtual user.
+	Name string
+	// Desc is a description of the virtual user.
+	Desc string
+	// Token authorizes the bridge on the HTTP and WebSocket endpoints.
+	Token string
+}
+
+// BridgeMessage is a message from an external chat network.
+type BridgeMessage struct {
+	// User is the name of the sender in the external network.
+	User string `json:"user"`
+	Text string `json:"text"`
+	Me   bool   `json:"me,omitempty"`
+	// To is the name of the recipient of a private message. Empty value means the main chat.
+	To string `json:"to,omitempty"`
+}
+
+// ChatBridge is a virtual user that injects messages from an external chat network into the hub.
+type ChatBridge struct {
+	h     *Hub
+	bot   *Bot
+	token string
+}
+
+// NewChatBridge creates a virtual user that injects messages from an external chat network.
+func (h *Hub) NewChatBridge(name, desc string) (*ChatBridge, error) {
+	bot, err := h.NewBotDesc(name, desc, "", h.getSoft())
+	if err != nil {
+		return nil, err
+	}
+	return &ChatBridge{h: h, bot: bot}, nil
+}
+
+// Name returns the name of the virtual user.
+func (b *ChatBridge) Name() string {
+	return b.bot.Name()
+}
+
+// Send injects a message from the external network. The sender name is added to the text,
+// since the message is sent on behalf of the virtual user.
+func (b *ChatBridge) Send(m BridgeMessage) error {
+	if m.User == "" || m.Text == "" {
+		return errBridgeEmpty
+	} else if len(m.Text) > maxBridgeMessage {
+		return errors.New("message is too long")
+	}
+	msg := Message{Me: m.Me}
+	if m.Me {
+		msg.Text = m.User + " " + m.Text
+	} else {
+		msg.Text = "<" + m.User + "> " + m.Text
+	}
+	if m.To == "" {
+		return b.bot.SendGlobal(msg)
+	}
+	to := b.h.PeerByName(m.To)
+	if to == nil {
+		return errors.New("user is offline: " + m.To)
+	}
+	return b.bot.SendPrivate(to, msg)
+}
+
+// Close removes the virtual user from the hub.
+func (b *ChatBridge) Close() error {
+	return b.bot.Close()
+}
+
+type chatBridges struct {
+	sync.RWMutex
+	list []*ChatBridge
+}
+
+// addChatBridge creates a bridge that is accessible via the HTTP API.
+func (h *Hub) addChatBridge(conf ChatBridgeConfig) error {
+	if conf.Token == "" {
+		return errors.New("bridge token must be set: " + conf.Name)
+	}
+	b, err := h.NewChatBridge(conf.Name, conf.Desc)
+	if err != nil {
+		return err
+	}
+	b.token = conf.Token
+	h.bridges.Lock()
+	h.bridges.list = append(h.bridges.list, b)
+	h.bridges.Unlock()
+	return nil
+}
+
+// httpBridge finds a bridge by the bearer token of the request. It writes an error response if it's not found.
+func (h *Hub) httpBridge(w http.ResponseWriter, r *http.Request) *ChatBridge {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, prefix) {
+		token := []byte(auth[len(prefix):])
+		h.bridges.RLock()
+		defer h.bridges.RUnlock()
+		for _, b := range h.bridges.list {
+			if subtle.ConstantTimeCompare(token, []byte(b.token)) == 1 {
+				return b
+			}
+		}
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return nil
+}
+
+func (h *Hub) serveV0Bridge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b := h.httpBridge(w, r)
+	if b == nil {
+		return
+	}
+	var m BridgeMessage
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := b.Send(m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bridgeWSError is sent to the WebSocket client if the message cannot be delivered.
+type bridgeWSError struct {
+	Error string `json:"error"`
+}
+
+// serveV0BridgeWS accepts a stream of messages over WebSocket. Each frame is a JSON-encoded BridgeMessage.
+func (h *Hub) serveV0BridgeWS(w http.ResponseWriter, r *http.Request) {
+	b := h.httpBridge(w, r)
+	if b == nil {
+		return
+	}
+	websocket.Server{Handler: func(c *websocket.Conn) {
+		defer c.Close()
+		for {
+			var m BridgeMessage
+			if err := websocket.JSON.Receive(c, &m); err != nil {
+				return
+			}
+			if err := b.Send(m); err != nil {
+				if err = websocket.JSON.Send(c, bridgeWSError{Error: err.Error()}); err != nil {
+					return
+				}
+			}
+		}
+	}}.ServeHTTP(w, r)
+}
@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestChatBridge(t *testing.T) {
+	h, err := NewHub(Config{
+		ChatBridges: []ChatBridgeConfig{{Name: "matrix", Token: "secret"}},
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(HTTPBridgePathV0, h.serveV0Bridge)
+	mux.HandleFunc(HTTPBridgeWSPathV0, h.serveV0BridgeWS)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	require.NotNil(t, h.PeerByName("matrix"))
+	p := newTestADCPeer(t, h, "user")
+	sentADC(p)
+
+	post := func(token, body string) int {
+		req, err := http.NewRequest("POST", srv.URL+HTTPBridgePathV0, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusUnauthorized, post("wrong", `{"user":"alice","text":"hello"}`))
+	require.Equal(t, http.StatusBadRequest, post("secret", `{"user":"alice"}`))
+	require.Equal(t, http.StatusNoContent, post("secret", `{"user":"alice","text":"hello"}`))
+	require.Contains(t, lastChat(t, p), `<alice>\shello`)
+
+	conf, err := websocket.NewConfig("ws"+srv.URL[4:]+HTTPBridgeWSPathV0, srv.URL)
+	require.NoError(t, err)
+	conf.Header.Set("Authorization", "Bearer secret")
+	ws, err := websocket.DialConfig(conf)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	require.NoError(t, websocket.JSON.Send(ws, BridgeMessage{User: "bob", Text: "hi", To: "user"}))
+	require.NoError(t, websocket.JSON.Send(ws, BridgeMessage{User: "bob", Text: "hi", To: "nobody"}))
+	var e bridgeWSError
+	require.NoError(t, websocket.JSON.Receive(ws, &e))
+	require.Equal(t, "user is offline: nobody", e.Error)
+	require.Contains(t, lastChat(t, p), `<bob>\shi`)
+}
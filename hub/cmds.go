@@ -66,18 +66,66 @@ func (h *Hub) initCommands() {
 		Func:  h.cmdChatLog,
 	})
 	h.RegisterCommand(Command{
-		Name: "reg", Aliases: []string{"register", "passwd", "regme"},
-		Short: "registers a user or change a password",
+		Name:  "ghost",
+		Short: "drops your stale session with a given name; usage: !ghost <name> <password>",
+		Func:  h.cmdGhost,
+	})
+	h.RegisterCommand(Command{
+		Name:  h.conf.Welcome.command(),
+		Short: "accept the hub rules",
+		Func:  h.cmdAcceptRules,
+	})
+	h.RegisterCommand(Command{
+		Name: "regme", Aliases: []string{"reg", "register"},
+		Short: "registers yourself on the hub with a given password",
 		Func:  h.cmdRegister,
 	})
+	h.RegisterCommand(Command{
+		Name:  "passwd",
+		Short: "changes your password; accepts an old and a new password",
+		Func:  h.cmdPasswd,
+	})
+	h.RegisterCommand(Command{
+		Name:  "tz",
+		Short: "sets your time zone offset for timestamps, for example: tz +3; tz hub resets it",
+		Func:  h.cmdTimeZone,
+	})
+	h.RegisterCommand(Command{
+		Name:  "seen",
+		Short: "shows when a registered user was last seen on the hub",
+		Func:  h.cmdSeen,
+	})
+	h.RegisterCommand(Command{
+		Name:  "info",
+		Short: "shows information about your account",
+		Menu:  []string{"My info"},
+		Func:  h.cmdInfo,
+	})
 
 	// Rooms
 	h.RegisterCommand(Command{
 		Name:    "join",
-		Short:   "join a room",
+		Short:   "join a room; for example: join #room [password]",
 		Require: PermRoomsJoin,
 		Func:    h.cmdJoin,
 	})
+	h.RegisterCommand(Command{
+		Name:    "room",
+		Short:   "manage persistent rooms; for example: room create #room [topic], room info #room",
+		Require: PermRoomsJoin,
+		Func:    h.cmdRoom,
+	})
+	h.RegisterCommand(Command{
+		Name:    "invite",
+		Short:   "invite a user to a room; for example: invite #room nick [duration]",
+		Require: PermRoomsJoin,
+		Func:    h.cmdInvite,
+	})
+	h.RegisterCommand(Command{
+		Name:  "accept",
+		Short: "accept the hub rules or an invitation to a room",
+		Func:  h.cmdAccept,
+	})
 	h.RegisterCommand(Command{
 		Name: "leave", Aliases: []string{"part"},
 		Short:   "leave a room",
@@ -112,6 +160,30 @@ func (h *Hub) initCommands() {
 		Require: PermTopic,
 		Func:    h.cmdTopic,
 	})
+	h.RegisterCommand(Command{
+		Name:    "slowmode",
+		Short:   "sets a minimal interval between messages of each user; for example: slowmode 10s, slowmode #room off",
+		Require: PermSlowMode,
+		Func:    h.cmdSlowMode,
+	})
+	h.RegisterCommand(Command{
+		Name:    "announce",
+		Short:   "manage scheduled announcements; for example: announce add rules @every 2h | please read the rules",
+		Require: PermAnnounce,
+		Func:    h.cmdAnnounce,
+	})
+	h.RegisterCommand(Command{
+		Name:    "dump",
+		Short:   "writes diagnostic dumps to files; for example: dump goroutines, dump all",
+		Require: PermDiag,
+		Func:    h.cmdDump,
+	})
+	h.RegisterCommand(Command{
+		Name:    "throttle",
+		Short:   "shows the traffic of a user or limits the rate of data received from the user; for example: throttle nick 16K, throttle nick off",
+		Require: PermThrottle,
+		Func:    h.cmdThrottle,
+	})
 	h.RegisterCommand(Command{
 		Name: "broadcast", Aliases: []string{"hub"},
 		Short:   "broadcast a chat message to all users",
@@ -125,6 +197,89 @@ func (h *Hub) initCommands() {
 		Require: PermIP,
 		Func:    h.cmdUserIP,
 	})
+	h.RegisterCommand(Command{
+		Name:    "trace",
+		Short:   "shows the login history of a registered user",
+		Require: PermIP,
+		Func:    h.cmdTrace,
+	})
+	h.RegisterCommand(Command{
+		Name:    "audit",
+		Short:   "shows recent administrative actions; accepts an optional action name",
+		Require: PermAudit,
+		Func:    h.cmdAudit,
+	})
+	h.RegisterCommand(Command{
+		Name:    "searchstats",
+		Short:   "shows search statistics; accepts an optional period, for example 30m",
+		Require: PermSearchStats,
+		Func:    h.cmdSearchStats,
+	})
+	h.RegisterCommand(Command{
+		Name:  "sharefiles",
+		Short: "shares your file list with the hub search; accepts on or off",
+		Func:  h.cmdShareFiles,
+	})
+	h.RegisterCommand(Command{
+		Name:  "find",
+		Short: "searches file lists shared with the hub; for example: find linux iso",
+		Func:  h.cmdFind,
+	})
+	h.RegisterCommand(Command{
+		Name:  "report",
+		Short: "reports a user to operators; for example: report nick spamming in chat",
+		Func:  h.cmdReport,
+	})
+	h.RegisterCommand(Command{
+		Name:    "history",
+		Short:   "shows the connection history for an IP, CID or nick; for example: history ip 1.2.3.4",
+		Require: PermIP,
+		Func:    h.cmdHistory,
+	})
+	h.RegisterCommand(Command{
+		Name:    "whois",
+		Short:   "shows information about a user, including notes",
+		Menu:    []string{"Whois"},
+		Require: PermIP,
+		Func:    h.cmdWhois,
+	})
+	h.RegisterCommand(Command{
+		Name:    "note",
+		Short:   "manages notes about users; for example: note add nick text, note tag nick spammer, note list nick, note del nick 1",
+		Require: PermNotes,
+		Func:    h.cmdNote,
+	})
+	h.RegisterCommand(Command{
+		Name:    "watch",
+		Short:   "manages the watchlist; for example: watch add 10.0.0.0/8 mute spammers, watch del nick, watch list",
+		Long:    "Patterns are nicks, CIDs, IPs or CIDR ranges. Actions: alert (default), mute, pm.",
+		Require: PermWatch,
+		Func:    h.cmdWatch,
+	})
+	h.RegisterCommand(Command{
+		Name:    "gag",
+		Short:   "silently drops chat messages and PMs of a user; for example: gag nick 30m spam",
+		Require: PermGag,
+		Func:    h.cmdGag,
+	})
+	h.RegisterCommand(Command{
+		Name:    "ungag",
+		Short:   "removes a gag from a user",
+		Require: PermGag,
+		Func:    h.cmdUngag,
+	})
+	h.RegisterCommand(Command{
+		Name:    "gags",
+		Short:   "lists gagged users",
+		Require: PermGag,
+		Func:    h.cmdGags,
+	})
+	h.RegisterCommand(Command{
+		Name:    "whoip",
+		Short:   "lists users connected from a given IP",
+		Require: PermIP,
+		Func:    h.cmdWhoIP,
+	})
 
 	// Bans
 	h.RegisterCommand(Command{
@@ -143,7 +298,7 @@ func (h *Hub) initCommands() {
 	})
 	h.RegisterCommand(Command{
 		Name:    "banip",
-		Short:   "ban a specific IP",
+		Short:   "ban a specific IP; accepts an optional reason",
 		Require: PermBanIP,
 		Func:    h.cmdBanIP,
 	})
@@ -162,6 +317,18 @@ func (h *Hub) initCommands() {
 	})
 
 	// Low-level commands
+	h.RegisterCommand(Command{
+		Name:    "op",
+		Short:   "grants the operator status to a registered user",
+		Require: PermOwner,
+		Func:    h.cmdOp,
+	})
+	h.RegisterCommand(Command{
+		Name:    "deop",
+		Short:   "revokes the operator status of a user",
+		Require: PermOwner,
+		Func:    h.cmdDeop,
+	})
 	h.RegisterCommand(Command{
 		Name:    "sample",
 		Short:   "samples N commands received by the hub",
@@ -232,55 +399,96 @@ func (h *Hub) cmdChatLog(p Peer, args string) error {
 }
 
 func (h *Hub) cmdRegister(p Peer, args string) error {
+	if !h.selfRegEnabled() {
+		return ErrUserRegDisabled
+	}
 	if c := p.ConnInfo(); c != nil && !c.Secure {
 		return errConnInsecure
 	}
-	if len(args) < 6 {
-		h.cmdOutput(p, "password should be at least 6 characters")
+	if len(args) < minPassLen {
+		h.cmdOutputf(p, "password should be at least %d characters", minPassLen)
 		return nil
 	}
 	name := p.Name()
-	pass := args
 	ok, err := h.IsRegistered(name)
-	if ok {
-		err = h.UpdateUser(name, func(u *UserRecord) (bool, error) {
-			if pass == u.Pass {
-				return false, nil
-			}
-			u.Pass = pass
-			return true, nil
-		})
-		if err != nil {
-			return err
-		}
-		h.cmdOutputf(p, "password changed")
+	if err != nil {
+		return err
+	} else if ok {
+		h.cmdOutput(p, "you are already registered, use !passwd to change the password")
 		return nil
 	}
 	err = h.RegisterUser(name, args)
 	if err != nil {
 		return err
 	}
+	h.audit(AuditRegister, p, name, "")
 	h.cmdOutputf(p, "user %s registered, please reconnect", name)
 	return nil
 }
 
-func (h *Hub) cmdJoin(p Peer, args string) error {
-	name := args
-	if !strings.HasPrefix(name, "#") {
-		return errors.New("room name should start with '#'")
+func (h *Hub) cmdPasswd(p Peer, old, pass string) error {
+	if c := p.ConnInfo(); c != nil && !c.Secure {
+		return errConnInsecure
 	}
-	r := h.Room(name)
-	if r == nil {
-		var err error
-		r, err = h.NewRoom(name)
+	if len(pass) < minPassLen {
+		h.cmdOutputf(p, "password should be at least %d characters", minPassLen)
+		return nil
+	}
+	name := p.Name()
+	_, rec, err := h.getUser(name)
+	if err != nil {
+		return err
+	} else if rec == nil || !p.User().IsRegistered() {
+		return errors.New("you are not registered")
+	} else if !checkPassword(rec.Pass, old) {
+		return errors.New("wrong password")
+	}
+	err = h.UpdateUser(name, func(u *UserRecord) (bool, error) {
+		if pass == u.Pass {
+			return false, nil
+		}
+		u.Pass = pass
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	h.cmdOutput(p, "password changed")
+	return nil
+}
+
+func (h *Hub) cmdInfo(p Peer) error {
+	u := p.UserInfo()
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "name: %s\n", p.Name())
+	if prof := p.User().Profile(); prof != nil {
+		fmt.Fprintf(&buf, "profile: %s\n", prof.ID())
+	}
+	if p.User().IsRegistered() {
+		_, rec, err := h.getUser(p.Name())
 		if err != nil {
 			return err
 		}
+		if rec != nil && !rec.Registered.IsZero() {
+			fmt.Fprintf(&buf, "registered: %s\n", rec.Registered.Format(time.RFC1123))
+		}
+		if rec != nil && !rec.LastLogin.IsZero() {
+			fmt.Fprintf(&buf, "last login: %s\n", rec.LastLogin.Format(time.RFC1123))
+		}
+	} else {
+		buf.WriteString("not registered\n")
 	}
-	r.Join(p)
+	fmt.Fprintf(&buf, "share: %d MB in %d files", u.Share/shareDiv, u.ShareFiles)
+	h.cmdOutput(p, buf.String())
 	return nil
 }
 
+func (h *Hub) cmdJoin(p Peer, args string) error {
+	name, pass := cutReason(strings.TrimSpace(args))
+	_, err := h.JoinRoom(p, name, pass)
+	return err
+}
+
 func (h *Hub) cmdLeave(p Peer, args string) error {
 	name := args
 	if !strings.HasPrefix(name, "#") {
@@ -298,9 +506,17 @@ func (h *Hub) cmdRooms(p Peer, args string) error {
 	list := h.Rooms()
 	buf := bytes.NewBuffer(nil)
 	buf.WriteString("available chat rooms:\n")
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
 	for _, r := range list {
-		buf.WriteString(r.Name() + "\n")
+		buf.WriteString(r.Name())
+		if topic := r.Topic(); topic != "" {
+			buf.WriteString(" - " + topic)
+		}
+		buf.WriteString("\n")
 	}
+	h.cmdOutput(p, buf.String())
 	return nil
 }
 
@@ -328,43 +544,12 @@ func (h *Hub) cmdBroadcast(p Peer, args string) error {
 }
 
 func (h *Hub) cmdConfigSet(p Peer, key, val string) error {
-	pv, _ := h.GetConfig(key)
-	switch pv.(type) {
-	case string:
-		h.SetConfigString(key, val)
-		h.cmdConfigEcho(p, key, val)
-	case int64:
-		v, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return err
-		}
-		h.SetConfigInt(key, v)
-		h.cmdConfigEcho(p, key, v)
-	case uint64:
-		v, err := strconv.ParseUint(val, 10, 64)
-		if err != nil {
-			return err
-		}
-		h.SetConfigUint(key, v)
-		h.cmdConfigEcho(p, key, v)
-	case bool:
-		v, err := strconv.ParseBool(val)
-		if err != nil {
-			return err
-		}
-		h.SetConfigBool(key, v)
-		h.cmdConfigEcho(p, key, v)
-	case float64:
-		v, err := strconv.ParseFloat(val, 64)
-		if err != nil {
-			return err
-		}
-		h.SetConfigFloat(key, v)
-		h.cmdConfigEcho(p, key, v)
-	default:
-		h.SetConfig(key, val)
-		h.cmdConfigEcho(p, key, val)
+	v, err := h.setConfigText(key, val)
+	if err != nil {
+		return err
 	}
+	h.cmdConfigEcho(p, key, v)
+	h.audit(AuditConfig, p, key, val)
 	return nil
 }
 
@@ -404,13 +589,34 @@ func (h *Hub) cmdUserIP(p, p2 Peer) error {
 	return nil
 }
 
+func (h *Hub) cmdWhoIP(p Peer, args string) error {
+	ip := net.ParseIP(args)
+	if ip == nil {
+		return errors.New("invalid IP format")
+	}
+	peers := h.PeersByIP(ip)
+	if len(peers) == 0 {
+		h.cmdOutput(p, "no users from this IP")
+		return nil
+	}
+	names := make([]string, 0, len(peers))
+	for _, p2 := range peers {
+		names = append(names, p2.Name())
+	}
+	sort.Strings(names)
+	h.cmdOutput(p, "users from "+ip.String()+":\n"+strings.Join(names, "\n"))
+	return nil
+}
+
 func (h *Hub) cmdDrop(p, p2 Peer) error {
+	_ = p2.HubChatMsg(Message{Text: h.text(p2, TextKicked, textArgs{"By": p.Name()})})
 	_ = p2.Close()
+	h.audit(AuditKick, p, p2.Name(), "")
 	h.cmdOutput(p, "user dropped")
 	return nil
 }
 
-func (h *Hub) cmdBanIPa(p Peer, ip net.IP) error {
+func (h *Hub) cmdBanIPa(p Peer, ip net.IP, reason string) error {
 	if ip == nil {
 		return errors.New("invalid IP format")
 	} else if h.IsHardBlockedIP(ip) {
@@ -418,6 +624,7 @@ func (h *Hub) cmdBanIPa(p Peer, ip net.IP) error {
 		return nil
 	}
 	h.HardBlockIP(ip)
+	h.audit(AuditBan, p, ip.String(), reason)
 	h.cmdOutput(p, "ip blocked")
 	return nil
 }
@@ -427,20 +634,30 @@ func (h *Hub) cmdBanUserIP(p, p2 Peer) error {
 	if !ok {
 		return errors.New("user is not using IP")
 	}
-	if err := h.cmdBanIPa(p, addr.IP); err != nil {
+	if err := h.cmdBanIPa(p, addr.IP, "user "+p2.Name()); err != nil {
 		return err
 	}
 	_ = p2.Close()
 	return nil
 }
 
+// cutReason splits command arguments into the first argument and an optional reason.
+func cutReason(args string) (string, string) {
+	if i := strings.IndexByte(args, ' '); i >= 0 {
+		return args[:i], strings.TrimSpace(args[i+1:])
+	}
+	return args, ""
+}
+
 func (h *Hub) cmdBanIP(p Peer, args string) error {
-	ip := net.ParseIP(args)
-	return h.cmdBanIPa(p, ip)
+	addr, reason := cutReason(args)
+	ip := net.ParseIP(addr)
+	return h.cmdBanIPa(p, ip, reason)
 }
 
 func (h *Hub) cmdUnBanIP(p Peer, args string) error {
-	ip := net.ParseIP(args)
+	addr, reason := cutReason(args)
+	ip := net.ParseIP(addr)
 	if ip == nil {
 		return errors.New("invalid IP format")
 	} else if !h.IsHardBlockedIP(ip) {
@@ -448,6 +665,7 @@ func (h *Hub) cmdUnBanIP(p Peer, args string) error {
 		return nil
 	}
 	h.HardUnBlockIP(ip)
+	h.audit(AuditUnban, p, ip.String(), reason)
 	h.cmdOutput(p, "ip unblocked")
 	return nil
 }
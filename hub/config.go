@@ -1,9 +1,11 @@
 package hub
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -14,10 +16,20 @@ const (
 	ConfigHubWebsite = "hub.website"
 	ConfigHubEmail   = "hub.email"
 	ConfigHubMOTD    = "hub.motd"
+	ConfigHubRules   = "hub.rules"
+	ConfigHubLocale  = "hub.locale"
+	// ConfigHubTimeZone is the time zone used for timestamps, for example "Europe/Moscow".
+	ConfigHubTimeZone = "hub.timezone"
 )
 
 const (
 	ConfigZlibLevel = "zlib.level"
+	// ConfigUsersSelfReg allows users to register themselves with a command.
+	ConfigUsersSelfReg = "users.self_register"
+	// ConfigChatTimestamps prefixes relayed main chat messages with timestamps.
+	ConfigChatTimestamps = "chat.timestamps"
+	// ConfigBandwidthOut limits the outbound traffic of the hub, in bytes per second. Zero means no limit.
+	ConfigBandwidthOut = "bandwidth.out"
 )
 
 var configAliases = map[string]string{
@@ -28,20 +40,51 @@ var configAliases = map[string]string{
 	"website": ConfigHubWebsite,
 	"email":   ConfigHubEmail,
 	"motd":    ConfigHubMOTD,
+	"rules":   ConfigHubRules,
+	"locale":  ConfigHubLocale,
+	"tz":      ConfigHubTimeZone,
 }
 
 // configIgnored is a list of ignored config keys that can only be set in the config file.
 var configIgnored = map[string]struct{}{
-	"chat.encoding":  {},
-	"chat.log.join":  {},
-	"chat.log.max":   {},
-	"database.path":  {},
-	"database.type":  {},
-	"plugins.path":   {},
-	"serve.host":     {},
-	"serve.port":     {},
-	"serve.tls.cert": {},
-	"serve.tls.key":  {},
+	"api.grpc":        {},
+	"api.token":       {},
+	"auth":            {},
+	"authz.token":     {},
+	"bot.name":        {},
+	"bridges":         {},
+	"chat.encoding":   {},
+	"chat.log.join":   {},
+	"chat.log.max":    {},
+	"console.listen":  {},
+	"console.tls":     {},
+	"database.path":   {},
+	"database.type":   {},
+	"matrix.as_token": {},
+	"matrix.hs_token": {},
+	"matrix.rooms":    {},
+	"xmpp.secret":     {},
+	"notify.webhooks": {},
+	"plugins.path":    {},
+	"serve.host":      {},
+	"serve.port":      {},
+	"serve.tls.cert":  {},
+	"serve.tls.key":   {},
+	"texts":           {},
+}
+
+// isConfigIgnored checks if the key or any of its parent keys is ignored.
+func isConfigIgnored(key string) bool {
+	for {
+		if _, ok := configIgnored[key]; ok {
+			return true
+		}
+		i := strings.LastIndexByte(key, '.')
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
 }
 
 func (h *Hub) MergeConfig(m Map) {
@@ -65,14 +108,14 @@ func (h *Hub) MergeConfigPath(path string, m Map) {
 }
 
 func (h *Hub) saveConfig(key string, val interface{}) {
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	// TODO: persist config
 }
 
 func (h *Hub) setConfigMap(key string, val interface{}) {
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	h.conf.Lock()
@@ -91,7 +134,7 @@ func (h *Hub) getConfigMap(key string) (interface{}, bool) {
 }
 
 func (h *Hub) setConfig(key string, val interface{}, save bool) {
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	switch val := val.(type) {
@@ -127,20 +170,80 @@ func (h *Hub) SetConfig(key string, val interface{}) {
 	h.setConfig(key, val, true)
 }
 
+// setConfigText parses the value according to the type of the current one and sets it.
+// It returns the parsed value.
+func (h *Hub) setConfigText(key, val string) (interface{}, error) {
+	pv, _ := h.GetConfig(key)
+	switch pv.(type) {
+	case string:
+		h.SetConfigString(key, val)
+		return val, nil
+	case int64:
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		h.SetConfigInt(key, v)
+		return v, nil
+	case uint64:
+		v, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		h.SetConfigUint(key, v)
+		return v, nil
+	case bool:
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, err
+		}
+		h.SetConfigBool(key, v)
+		return v, nil
+	case float64:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, err
+		}
+		h.SetConfigFloat(key, v)
+		return v, nil
+	default:
+		h.SetConfig(key, val)
+		return val, nil
+	}
+}
+
+// ReloadConfig reads the config again using Config.ReloadConfig and merges it into the current one.
+func (h *Hub) ReloadConfig() error {
+	if h.conf.ReloadConfig == nil {
+		return errors.New("config reload is not supported")
+	}
+	m, err := h.conf.ReloadConfig()
+	if err != nil {
+		return err
+	}
+	h.MergeConfig(m)
+	return nil
+}
+
 func (h *Hub) ConfigKeys() []string {
 	keys := []string{
 		ConfigHubName,
 		ConfigHubDesc,
 		ConfigHubTopic,
 		ConfigHubMOTD,
+		ConfigHubRules,
 		ConfigHubOwner,
 		ConfigHubWebsite,
 		ConfigHubEmail,
+		ConfigHubLocale,
+		ConfigHubTimeZone,
 		ConfigZlibLevel,
+		ConfigChatTimestamps,
+		ConfigBandwidthOut,
 	}
 	h.conf.RLock()
 	for k := range h.conf.m {
-		if _, ok := configIgnored[k]; ok {
+		if isConfigIgnored(k) {
 			continue
 		}
 		keys = append(keys, k)
@@ -159,20 +262,29 @@ func (h *Hub) GetConfig(key string) (interface{}, bool) {
 		ConfigHubDesc,
 		ConfigHubTopic,
 		ConfigHubMOTD,
+		ConfigHubRules,
 		ConfigHubOwner,
 		ConfigHubWebsite,
-		ConfigHubEmail:
+		ConfigHubEmail,
+		ConfigHubLocale,
+		ConfigHubTimeZone:
 		v, ok := h.GetConfigString(key)
 		if !ok {
 			return nil, false
 		}
 		return v, true
-	case ConfigZlibLevel:
+	case ConfigZlibLevel, ConfigBandwidthOut:
 		v, ok := h.GetConfigInt(key)
 		if !ok {
 			return nil, false
 		}
 		return v, true
+	case ConfigChatTimestamps:
+		v, ok := h.GetConfigBool(key)
+		if !ok {
+			return nil, false
+		}
+		return v, true
 	}
 	h.conf.RLock()
 	v, ok := h.conf.m[key]
@@ -193,6 +305,8 @@ func (h *Hub) setConfigString(key string, val string) {
 		h.setTopic(val)
 	case ConfigHubMOTD:
 		h.setMOTD(val)
+	case ConfigHubRules:
+		h.setRules(val)
 	case ConfigHubOwner:
 		h.conf.Lock()
 		h.conf.Owner = val
@@ -205,6 +319,12 @@ func (h *Hub) setConfigString(key string, val string) {
 		h.conf.Lock()
 		h.conf.Email = val
 		h.conf.Unlock()
+	case ConfigHubLocale:
+		h.setLocale(val)
+	case ConfigHubTimeZone:
+		if err := h.setTimeZone(val); err != nil {
+			h.hubError("cannot set time zone: %v", err)
+		}
 	default:
 		h.setConfigMap(key, val)
 	}
@@ -237,6 +357,8 @@ func (h *Hub) GetConfigString(key string) (string, bool) {
 		v := h.conf.MOTD
 		h.conf.RUnlock()
 		return v, true
+	case ConfigHubRules:
+		return h.getRules(), true
 	case ConfigHubOwner:
 		h.conf.RLock()
 		v := h.conf.Owner
@@ -252,6 +374,10 @@ func (h *Hub) GetConfigString(key string) (string, bool) {
 		v := h.conf.Email
 		h.conf.RUnlock()
 		return v, true
+	case ConfigHubLocale:
+		return h.getLocale(), true
+	case ConfigHubTimeZone:
+		return h.getTimeZone().String(), true
 	default:
 		v, ok := h.getConfigMap(key)
 		if !ok || v == nil {
@@ -270,10 +396,12 @@ func (h *Hub) setConfigBool(key string, val bool) {
 	if alias, ok := configAliases[key]; ok {
 		key = alias
 	}
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	switch key {
+	case ConfigChatTimestamps:
+		h.setChatTimestamps(val)
 	default:
 		h.setConfigMap(key, val)
 	}
@@ -289,6 +417,8 @@ func (h *Hub) GetConfigBool(key string) (bool, bool) {
 		key = alias
 	}
 	switch key {
+	case ConfigChatTimestamps:
+		return h.chatTimestamps(), true
 	default:
 		v, ok := h.getConfigMap(key)
 		if !ok || v == nil {
@@ -316,12 +446,14 @@ func (h *Hub) setConfigInt(key string, val int64) {
 	if alias, ok := configAliases[key]; ok {
 		key = alias
 	}
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	switch key {
 	case ConfigZlibLevel:
 		h.setZlibLevel(int(val))
+	case ConfigBandwidthOut:
+		h.setOutRate(val)
 	default:
 		h.setConfigMap(key, val)
 	}
@@ -339,6 +471,8 @@ func (h *Hub) GetConfigInt(key string) (int64, bool) {
 	switch key {
 	case ConfigZlibLevel:
 		return int64(h.zlibLevel()), true
+	case ConfigBandwidthOut:
+		return h.stats.out.getRate(), true
 	default:
 		v, ok := h.getConfigMap(key)
 		if !ok || v == nil {
@@ -369,7 +503,7 @@ func (h *Hub) setConfigUint(key string, val uint64) {
 	if alias, ok := configAliases[key]; ok {
 		key = alias
 	}
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	switch key {
@@ -418,7 +552,7 @@ func (h *Hub) setConfigFloat(key string, val float64) {
 	if alias, ok := configAliases[key]; ok {
 		key = alias
 	}
-	if _, ok := configIgnored[key]; ok {
+	if isConfigIgnored(key) {
 		return
 	}
 	switch key {
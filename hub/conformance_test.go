@@ -0,0 +1,43 @@
+package hub
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc/adctest"
+)
+
+func TestADCConformance(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	h, err := NewHub(Config{
+		Timeouts: Timeouts{Handshake: timeout},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = h.Serve(conn)
+			}()
+		}
+	}()
+
+	adctest.Conformance{
+		Dial: func() (net.Conn, error) {
+			return net.Dial("tcp", l.Addr().String())
+		},
+		HandshakeTimeout: timeout,
+	}.Run(t)
+}
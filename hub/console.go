@@ -0,0 +1,284 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Admin console is a line-based text protocol for operators, that can be used with telnet,
+// netcat or from scripts. After the login, each line is a command from the operator command
+// set, without the "!" prefix. The console also supports a few commands of its own:
+//
+//	users              - list online users
+//	stats              - show hub stats as JSON
+//	kick <name>        - disconnect the user
+//	ban <ip> [reason]  - ban the IP address
+//	config get [key]   - show the config
+//	config set <k> <v> - change the config
+//	quit               - close the console
+//
+// The password is sent in plain text, thus the console must only be exposed on localhost or over TLS.
+
+const (
+	consolePrompt      = "> "
+	consoleIdleTimeout = 10 * time.Minute
+	consoleLoginDelay  = time.Second
+	// consoleMaxLine is the maximal length of a line sent to the console.
+	consoleMaxLine = 4096
+)
+
+var (
+	errConsoleAuth     = errors.New("invalid login or password")
+	errConsoleLineSize = errors.New("line is too long")
+)
+
+var _ Peer = (*consolePeer)(nil)
+
+// consolePeer is an operator connected to the admin console. It's not visible to other users.
+type consolePeer struct {
+	BasePeer
+	conn net.Conn
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+}
+
+func (p *consolePeer) writeLine(s string) error {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	s = strings.TrimRight(s, "\n")
+	s = strings.Replace(s, "\n", "\r\n", -1)
+	if _, err := p.w.WriteString(s + "\r\n"); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (p *consolePeer) prompt() error {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if _, err := p.w.WriteString(consolePrompt); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (*consolePeer) Capabilities() PeerCaps {
+	return 0
+}
+
+func (p *consolePeer) UserInfo() UserInfo {
+	return UserInfo{Name: p.Name()}
+}
+
+func (p *consolePeer) Close() error {
+	return p.closeWith(p,
+		p.conn.Close,
+		func() error {
+			p.hub.leaveRooms(p)
+			p.releaseSID()
+			return nil
+		},
+	)
+}
+
+func (p *consolePeer) PeersJoin(e *PeersJoinEvent) error {
+	return nil
+}
+
+func (p *consolePeer) PeersUpdate(e *PeersUpdateEvent) error {
+	return nil
+}
+
+func (p *consolePeer) PeersLeave(e *PeersLeaveEvent) error {
+	return nil
+}
+
+func (p *consolePeer) JoinRoom(room *Room) error {
+	return nil
+}
+
+func (p *consolePeer) LeaveRoom(room *Room) error {
+	return nil
+}
+
+func (p *consolePeer) ChatMsg(room *Room, from Peer, msg Message) error {
+	return nil
+}
+
+func (p *consolePeer) PrivateMsg(from Peer, msg Message) error {
+	return nil
+}
+
+func (p *consolePeer) HubChatMsg(m Message) error {
+	return p.writeLine(m.Text)
+}
+
+func (p *consolePeer) ConnectTo(peer Peer, addr string, token string, secure bool) error {
+	return nil
+}
+
+func (p *consolePeer) RevConnectTo(peer Peer, token string, secure bool) error {
+	return nil
+}
+
+func (p *consolePeer) Search(ctx context.Context, req SearchRequest, out Search) error {
+	return nil
+}
+
+// newConsoleScanner returns a line scanner that fails on lines longer than consoleMaxLine.
+func newConsoleScanner(conn net.Conn) *bufio.Scanner {
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 0, 512), consoleMaxLine)
+	return sc
+}
+
+// consoleReadLine reads the next line from the console connection.
+func consoleReadLine(conn net.Conn, sc *bufio.Scanner) (string, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(consoleIdleTimeout))
+	if !sc.Scan() {
+		err := sc.Err()
+		if err == bufio.ErrTooLong {
+			err = errConsoleLineSize
+		} else if err == nil {
+			err = io.EOF
+		}
+		return "", err
+	}
+	return sc.Text(), nil
+}
+
+// consoleLogin asks for the operator credentials.
+func (h *Hub) consoleLogin(conn net.Conn, sc *bufio.Scanner, w *bufio.Writer) (*User, error) {
+	readLine := func(prompt string) (string, error) {
+		if _, err := w.WriteString(prompt); err != nil {
+			return "", err
+		} else if err = w.Flush(); err != nil {
+			return "", err
+		}
+		return consoleReadLine(conn, sc)
+	}
+	name, err := readLine("login: ")
+	if err != nil {
+		return nil, err
+	}
+	pass, err := readLine("password: ")
+	if err != nil {
+		return nil, err
+	}
+	u, err := h.authUser(name, pass)
+	if err != nil || u == nil || !u.IsOp() {
+		time.Sleep(consoleLoginDelay)
+		return nil, errConsoleAuth
+	}
+	return u, nil
+}
+
+// ServeConsole serves the admin console on the connection.
+func (h *Hub) ServeConsole(conn net.Conn) error {
+	defer conn.Close()
+	sc := newConsoleScanner(conn)
+	w := bufio.NewWriter(conn)
+	_, _ = fmt.Fprintf(w, "%s admin console\r\n", h.getName())
+
+	u, err := h.consoleLogin(conn, sc, w)
+	if err != nil {
+		log.Printf("console: %s: %v", conn.RemoteAddr(), err)
+		_, _ = w.WriteString(err.Error() + "\r\n")
+		_ = w.Flush()
+		return err
+	}
+	p := &consolePeer{conn: conn, w: w}
+	err = h.newBasePeer(&p.BasePeer, &ConnInfo{
+		Remote: conn.RemoteAddr(),
+		Local:  conn.LocalAddr(),
+	})
+	if err != nil {
+		return err
+	}
+	p.setName(u.Name())
+	p.setUser(u)
+	defer p.Close()
+	log.Printf("console: %s logged in from %s", u.Name(), conn.RemoteAddr())
+
+	for {
+		if err = p.prompt(); err != nil {
+			return err
+		}
+		line, err := consoleReadLine(conn, sc)
+		if err == errConsoleLineSize {
+			_ = p.writeLine(err.Error())
+			return err
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !h.consoleCommand(p, line) {
+			return nil
+		}
+	}
+}
+
+// consoleCommand runs a console command. It returns false if the console should be closed.
+func (h *Hub) consoleCommand(p *consolePeer, line string) bool {
+	line = strings.TrimLeft(line, "!+/")
+	cmd, args := line, ""
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		cmd, args = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch cmd {
+	case "quit", "exit":
+		return false
+	case "users":
+		h.consoleUsers(p)
+	case "stats":
+		h.cmdOutputJSON(p, h.Stats())
+	case "kick":
+		h.command(p, "drop", args)
+	case "ban":
+		h.command(p, "banip", args)
+	case "config":
+		sub, rest := args, ""
+		if i := strings.IndexByte(args, ' '); i > 0 {
+			sub, rest = args[:i], strings.TrimSpace(args[i+1:])
+		}
+		switch sub {
+		case "get":
+			h.command(p, "config", rest)
+		case "set":
+			h.command(p, "set", rest)
+		default:
+			h.command(p, "config", args)
+		}
+	default:
+		h.command(p, cmd, args)
+	}
+	return true
+}
+
+// consoleUsers lists online users, one per line.
+func (h *Hub) consoleUsers(p *consolePeer) {
+	list := h.Peers()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	var buf strings.Builder
+	for _, p2 := range list {
+		u := p2.UserInfo()
+		fmt.Fprintf(&buf, "%s\t%s\t%s\t%d\n", p2.Name(), PeerProtocol(p2), addrString(p2.RemoteAddr()), u.Share)
+	}
+	fmt.Fprintf(&buf, "%d users", len(list))
+	h.cmdOutput(p, buf.String())
+}
@@ -0,0 +1,106 @@
+package hub
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type consoleTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// readUntil reads the console output until the given prompt.
+func (c *consoleTestClient) readUntil(prompt string) string {
+	var buf strings.Builder
+	for !strings.HasSuffix(buf.String(), prompt) {
+		b, err := c.r.ReadByte()
+		require.NoError(c.t, err)
+		buf.WriteByte(b)
+	}
+	return strings.TrimSuffix(buf.String(), prompt)
+}
+
+func (c *consoleTestClient) send(line string) {
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	require.NoError(c.t, err)
+}
+
+func newConsoleTestClient(t *testing.T, h *Hub) (*consoleTestClient, <-chan error) {
+	c1, c2 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.ServeConsole(c2)
+	}()
+	return &consoleTestClient{t: t, conn: c1, r: bufio.NewReader(c1)}, errc
+}
+
+func TestConsole(t *testing.T) {
+	h, err := NewHub(Config{Name: "test"})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	h.loadProfiles()
+	require.NoError(t, h.db.CreateUser(UserRecord{Name: "op", Pass: "secret", Profile: ProfileNameRoot}))
+	require.NoError(t, h.db.CreateUser(UserRecord{Name: "reg", Pass: "secret", Profile: ProfileNameRegistered}))
+
+	p := newTestADCPeer(t, h, "user")
+	sentADC(p)
+
+	// regular users are not allowed
+	c, errc := newConsoleTestClient(t, h)
+	require.Contains(t, c.readUntil("login: "), "test admin console")
+	c.send("reg")
+	c.readUntil("password: ")
+	c.send("secret")
+	c.readUntil(errConsoleAuth.Error() + "\r\n")
+	require.Equal(t, errConsoleAuth, <-errc)
+	c.conn.Close()
+
+	c, errc = newConsoleTestClient(t, h)
+	c.readUntil("login: ")
+	c.send("op")
+	c.readUntil("password: ")
+	c.send("secret")
+	c.readUntil(consolePrompt)
+
+	c.send("users")
+	out := c.readUntil(consolePrompt)
+	require.Contains(t, out, "user\tadc\t127.0.0.1\t")
+	require.Contains(t, out, "2 users")
+
+	c.send("config set hub.topic hello")
+	require.Equal(t, "hub.topic = \"hello\"\r\n", c.readUntil(consolePrompt))
+	c.send("config get hub.topic")
+	require.Equal(t, "hub.topic = \"hello\"\r\n", c.readUntil(consolePrompt))
+
+	c.send("unknown")
+	require.Equal(t, "unsupported command: unknown\r\n", c.readUntil(consolePrompt))
+
+	c.send("kick user")
+	require.Equal(t, "user dropped\r\n", c.readUntil(consolePrompt))
+	require.Nil(t, h.PeerByName("user"))
+
+	c.send("quit")
+	require.NoError(t, <-errc)
+	c.conn.Close()
+}
+
+func TestConsoleLongLine(t *testing.T) {
+	h, err := NewHub(Config{Name: "test"})
+	require.NoError(t, err)
+
+	// overlong lines are rejected before the login
+	c, errc := newConsoleTestClient(t, h)
+	c.readUntil("login: ")
+	go func() {
+		_, _ = c.conn.Write([]byte(strings.Repeat("a", 2*consoleMaxLine)))
+	}()
+	c.readUntil(errConsoleLineSize.Error() + "\r\n")
+	require.Equal(t, errConsoleLineSize, <-errc)
+	c.conn.Close()
+}
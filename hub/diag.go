@@ -0,0 +1,151 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+)
+
+// PermDiag allows writing diagnostic dumps.
+const PermDiag = "hub.diag"
+
+// AuditDump is recorded in the audit log when a diagnostic dump is written.
+const AuditDump = "dump"
+
+// HTTPDebugPath is a prefix for pprof endpoints. They require the API token.
+const HTTPDebugPath = "/debug/pprof/"
+
+// DefaultDiagDir is a directory for diagnostic dumps used if none is set in the config.
+const DefaultDiagDir = "diag"
+
+// Kinds of diagnostic dumps.
+const (
+	DumpGoroutines = "goroutines"
+	DumpHeap       = "heap"
+	DumpPeers      = "peers"
+)
+
+var dumpKinds = []string{DumpGoroutines, DumpHeap, DumpPeers}
+
+func (h *Hub) diagDir() string {
+	if h.conf.DiagDir != "" {
+		return h.conf.DiagDir
+	}
+	return DefaultDiagDir
+}
+
+// peersDump is written by DumpPeers.
+type peersDump struct {
+	Snapshot
+	Goroutines int         `json:"goroutines"`
+	Rooms      []roomsDump `json:"rooms"`
+	Stats      Stats       `json:"stats"`
+}
+
+type roomsDump struct {
+	Name  string `json:"name"`
+	Users int    `json:"users"`
+}
+
+func (h *Hub) writePeersDump(f *os.File) error {
+	d := peersDump{
+		Snapshot:   h.Snapshot(),
+		Goroutines: runtime.NumGoroutine(),
+		Stats:      h.Stats(),
+	}
+	for _, r := range h.Rooms() {
+		d.Rooms = append(d.Rooms, roomsDump{Name: r.Name(), Users: r.Users()})
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	return enc.Encode(d)
+}
+
+// WriteDump writes a diagnostic dump of a given kind to the diagnostics directory.
+// It returns the path of the written file.
+func (h *Hub) WriteDump(kind string) (string, error) {
+	ext := ".txt"
+	switch kind {
+	case DumpGoroutines:
+	case DumpHeap:
+		ext = ".pprof"
+	case DumpPeers:
+		ext = ".json"
+	default:
+		return "", fmt.Errorf("unsupported dump: %q, expected one of: %s", kind, strings.Join(dumpKinds, ", "))
+	}
+	dir := h.diagDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s_%s%s", time.Now().UTC().Format("20060102T150405.000000000"), kind, ext)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	switch kind {
+	case DumpGoroutines:
+		err = rpprof.Lookup("goroutine").WriteTo(f, 2)
+	case DumpHeap:
+		runtime.GC()
+		err = rpprof.WriteHeapProfile(f)
+	case DumpPeers:
+		err = h.writePeersDump(f)
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// SetDebugHandler sets a handler for debug endpoints under HTTPDebugPath, usually pprof.
+// The hub only serves it to requests with the API token.
+//
+// The hub doesn't import net/http/pprof itself, since it registers handlers on the default mux.
+func (h *Hub) SetDebugHandler(handler http.Handler) {
+	h.debug = handler
+}
+
+// serveDebug serves debug endpoints. They are only available with the API token.
+func (h *Hub) serveDebug(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	if h.debug == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.debug.ServeHTTP(w, r)
+}
+
+func (h *Hub) cmdDump(p Peer, args string) error {
+	kinds := strings.Fields(args)
+	if len(kinds) == 0 {
+		return errors.New("usage: dump all|" + strings.Join(dumpKinds, "|"))
+	} else if len(kinds) == 1 && kinds[0] == "all" {
+		kinds = dumpKinds
+	}
+	var files []string
+	for _, kind := range kinds {
+		path, err := h.WriteDump(kind)
+		if err != nil {
+			return err
+		}
+		h.audit(AuditDump, p, kind, path)
+		files = append(files, path)
+	}
+	h.cmdOutput(p, "written:\n"+strings.Join(files, "\n"))
+	return nil
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hub-diag-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	h, err := NewHub(Config{DiagDir: filepath.Join(dir, "diag")})
+	require.NoError(t, err)
+	require.NoError(t, h.loadProfiles())
+	newTestADCPeer(t, h, "user")
+
+	path, err := h.WriteDump(DumpPeers)
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var d peersDump
+	require.NoError(t, json.Unmarshal(data, &d))
+	require.NotEmpty(t, d.Peers)
+	require.NotZero(t, d.Goroutines)
+
+	path, err = h.WriteDump(DumpGoroutines)
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "goroutine")
+
+	_, err = h.WriteDump("cpu")
+	require.Error(t, err)
+
+	// only the hub owner can write dumps
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	require.True(t, h.isCommand(op, "!dump all"))
+	files, err := ioutil.ReadDir(filepath.Join(dir, "diag"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	op.setUser(&User{profile: h.Profile(ProfileNameRoot)})
+	require.True(t, h.isCommand(op, "!dump all"))
+	files, err = ioutil.ReadDir(filepath.Join(dir, "diag"))
+	require.NoError(t, err)
+	require.Len(t, files, 5)
+}
+
+func TestDebugAuth(t *testing.T) {
+	h, err := NewHub(Config{APIToken: "secret"})
+	require.NoError(t, err)
+
+	get := func(token string) int {
+		req := httptest.NewRequest("GET", HTTPDebugPath+"cmdline", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.serveDebug(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusUnauthorized, get(""))
+	// no debug handler is set by default
+	require.Equal(t, http.StatusNotFound, get("secret"))
+
+	h.SetDebugHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	require.Equal(t, http.StatusUnauthorized, get(""))
+	require.Equal(t, http.StatusOK, get("secret"))
+}
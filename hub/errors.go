@@ -15,6 +15,7 @@ var (
 	errNickTaken     = errors.New("nick taken")
 	errConnInsecure  = errors.New("connection is insecure")
 	errCmdInvalidArg = errors.New("invalid argument")
+	errAccessDenied  = errors.New("access denied")
 )
 
 type ErrUnknownProtocol struct {
@@ -0,0 +1,96 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// ExtensionPolicy is an action taken for ADC clients that don't support a required extension.
+type ExtensionPolicy string
+
+const (
+	// ExtensionReject rejects the client during the login.
+	ExtensionReject = ExtensionPolicy("reject")
+	// ExtensionRestrict allows the client to join and chat, but it cannot search
+	// or initiate connections to other users.
+	ExtensionRestrict = ExtensionPolicy("restrict")
+)
+
+var errExtRestricted = errors.New("client does not support a required extension")
+
+// RequiredExtension is an ADC extension that clients must support to use the hub.
+// The requirement does not apply to NMDC clients.
+type RequiredExtension struct {
+	// Feature is the name of the extension announced by the client in SUP, for example "BLOM".
+	// The name "ADCS" requires a TLS connection to the hub.
+	Feature string
+	// Policy for clients without the extension. Zero value means ExtensionReject.
+	Policy ExtensionPolicy
+	// Message explains the requirement to the user. Zero value means a default text.
+	Message string
+}
+
+type requiredExt struct {
+	RequiredExtension
+	fea adc.Feature
+}
+
+func (h *Hub) initExtensions() error {
+	for _, r := range h.conf.RequireExtensions {
+		if len(r.Feature) != 4 {
+			return fmt.Errorf("invalid extension name: %q", r.Feature)
+		}
+		switch r.Policy {
+		case "":
+			r.Policy = ExtensionReject
+		case ExtensionReject, ExtensionRestrict:
+		default:
+			return fmt.Errorf("invalid policy for extension %s: %q", r.Feature, r.Policy)
+		}
+		e := requiredExt{RequiredExtension: r}
+		copy(e.fea[:], r.Feature)
+		h.requiredExt = append(h.requiredExt, e)
+	}
+	return nil
+}
+
+// missingExtensions returns the first required extension the client lacks for each of the policies.
+func (h *Hub) missingExtensions(sup adc.ModFeatures, secure bool) (reject, restrict *requiredExt) {
+	for i := range h.requiredExt {
+		e := &h.requiredExt[i]
+		if e.fea == adc.FeaADCS {
+			if secure {
+				continue
+			}
+		} else if sup.IsSet(e.fea) {
+			continue
+		}
+		if e.Policy == ExtensionRestrict {
+			if restrict == nil {
+				restrict = e
+			}
+		} else if reject == nil {
+			reject = e
+		}
+	}
+	return reject, restrict
+}
+
+// extText returns a message that explains the extension requirement to the user.
+func (h *Hub) extText(peer Peer, e *requiredExt, id string) string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return h.text(peer, id, textArgs{"Feature": e.Feature})
+}
+
+// checkExtensions returns an error if the peer is not allowed to search or connect to other users
+// because its client lacks a required extension.
+func (h *Hub) checkExtensions(peer Peer) error {
+	if peer.base().restricted != nil {
+		return errExtRestricted
+	}
+	return nil
+}
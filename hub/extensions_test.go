@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func TestRequiredExtensions(t *testing.T) {
+	_, err := NewHub(Config{RequireExtensions: []RequiredExtension{{Feature: "BLOOM"}}})
+	require.Error(t, err)
+	_, err = NewHub(Config{RequireExtensions: []RequiredExtension{{Feature: "BLOM", Policy: "ignore"}}})
+	require.Error(t, err)
+
+	th := newTestHarness(t, Config{RequireExtensions: []RequiredExtension{
+		{Feature: "SEGA", Message: "please upgrade your client"},
+		{Feature: "BLOM", Policy: ExtensionRestrict},
+	}})
+	defer th.Close()
+
+	// rejected at login
+	c := th.Dial()
+	c.Send("HSUP ADBASE ADTIGR ADBLOM")
+	var st adc.Status
+	require.NoError(t, adc.Unmarshal(c.Expect("STA", nil).Message().Data, &st))
+	require.Equal(t, adc.Fatal, st.Sev)
+	require.Equal(t, adc.CodeFeatureMissing, st.Code)
+	require.Equal(t, "please upgrade your client", st.Msg)
+	c.ExpectClosed()
+
+	full := th.JoinADC("full", adc.Feature{'S', 'E', 'G', 'A'}, adc.Feature{'B', 'L', 'O', 'M'})
+
+	// restricted clients can join, but cannot search
+	lite := th.Dial()
+	lite.Name = "lite"
+	lite.Send("HSUP ADBASE ADTIGR ADSEGA")
+	var sid adc.SIDAssign
+	require.NoError(t, adc.Unmarshal(lite.Expect("SID", nil).Message().Data, &sid))
+	lite.SID = sid.SID
+	pid := types.NewPID()
+	lite.SendMsg("BINF "+lite.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: "lite",
+		Slots: 1, SlotsFree: 1, HubsNormal: 1, ShareSize: 1,
+	})
+	lite.ExpectJoin(lite)
+	full.ExpectJoin(lite)
+	lite.Expect("MSG", func(p adc.Packet) bool {
+		var msg adc.ChatMessage
+		require.NoError(t, adc.Unmarshal(p.Message().Data, &msg))
+		return strings.Contains(msg.Text, "does not support BLOM")
+	})
+
+	lite.Sendf("BSCH %s ANlinux TOlite", lite.SID)
+	th.Sync(lite)
+	require.Empty(t, full.Received("SCH"))
+
+	full.Sendf("BSCH %s ANlinux TOfull", full.SID)
+	lite.Expect("SCH", nil)
+}
@@ -0,0 +1,170 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PermGag allows gagging users.
+const PermGag = "user.gag"
+
+// Actions recorded in the audit log for gags.
+const (
+	AuditGag   = "gag"
+	AuditUngag = "ungag"
+)
+
+// ConfigGagOps makes messages of gagged users visible to operators. It's enabled by default.
+const ConfigGagOps = "chat.gag.ops"
+
+// DefaultGagTTL is the default duration of a gag.
+const DefaultGagTTL = time.Hour
+
+// Gag silently drops chat messages and PMs of a user. The user still sees own messages.
+type Gag struct {
+	Name   string    `json:"name"`
+	Until  time.Time `json:"until"`
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func (g Gag) String() string {
+	s := fmt.Sprintf("%s until %s", g.Name, g.Until.Format(time.RFC1123))
+	if g.By != "" {
+		s += " by " + g.By
+	}
+	if g.Reason != "" {
+		s += ": " + g.Reason
+	}
+	return s
+}
+
+// gags holds active gags, indexed by user name. Gags are kept when the user reconnects.
+type gags struct {
+	sync.RWMutex
+	byName map[nameKey]Gag
+}
+
+// GagUser silently drops messages of the user for a given duration. Zero duration means DefaultGagTTL.
+func (h *Hub) GagUser(name string, ttl time.Duration, by, reason string) Gag {
+	if ttl <= 0 {
+		ttl = DefaultGagTTL
+	}
+	g := Gag{Name: name, Until: time.Now().UTC().Add(ttl), By: by, Reason: reason}
+	key := h.toNameKey(name)
+	h.gags.Lock()
+	if h.gags.byName == nil {
+		h.gags.byName = make(map[nameKey]Gag)
+	}
+	h.gags.byName[key] = g
+	h.gags.Unlock()
+	return g
+}
+
+// UngagUser removes the gag of the user. It returns false if the user is not gagged.
+func (h *Hub) UngagUser(name string) bool {
+	key := h.toNameKey(name)
+	h.gags.Lock()
+	defer h.gags.Unlock()
+	g, ok := h.gags.byName[key]
+	delete(h.gags.byName, key)
+	return ok && time.Now().Before(g.Until)
+}
+
+// Gags returns all active gags, sorted by expiration time.
+func (h *Hub) Gags() []Gag {
+	now := time.Now()
+	h.gags.Lock()
+	list := make([]Gag, 0, len(h.gags.byName))
+	for k, g := range h.gags.byName {
+		if !now.Before(g.Until) {
+			delete(h.gags.byName, k)
+			continue
+		}
+		list = append(list, g)
+	}
+	h.gags.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.Before(list[j].Until)
+	})
+	return list
+}
+
+// isGagged checks if messages of the peer must be dropped, either because of a gag
+// or because of the watchlist.
+func (h *Hub) isGagged(p Peer) bool {
+	if p.base().muted.Get() {
+		return true
+	}
+	key := h.toNameKey(p.Name())
+	h.gags.RLock()
+	g, ok := h.gags.byName[key]
+	h.gags.RUnlock()
+	if !ok {
+		return false
+	} else if time.Now().Before(g.Until) {
+		return true
+	}
+	h.gags.Lock()
+	if g2, ok := h.gags.byName[key]; ok && !time.Now().Before(g2.Until) {
+		delete(h.gags.byName, key)
+	}
+	h.gags.Unlock()
+	return false
+}
+
+// seesGagged checks if the peer can see messages of gagged users.
+func (h *Hub) seesGagged(p Peer) bool {
+	if v, ok := h.GetConfigBool(ConfigGagOps); ok && !v {
+		return false
+	}
+	return p.User().HasPerm(PermBanIP)
+}
+
+func (h *Hub) cmdGag(p Peer, args string) error {
+	name, rest := cutReason(strings.TrimSpace(args))
+	if name == "" {
+		return errors.New("usage: gag <nick> [duration] [reason]")
+	}
+	ttl := DefaultGagTTL
+	if s, reason := cutReason(rest); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			ttl, rest = d, reason
+		}
+	}
+	if ttl <= 0 {
+		return errors.New("duration must be positive")
+	}
+	g := h.GagUser(name, ttl, p.Name(), rest)
+	h.audit(AuditGag, p, name, strings.TrimSpace(ttl.String()+" "+rest))
+	h.cmdOutput(p, "gagged "+g.String())
+	return nil
+}
+
+func (h *Hub) cmdUngag(p Peer, name string) error {
+	if !h.UngagUser(name) {
+		return errors.New("user is not gagged: " + name)
+	}
+	h.audit(AuditUngag, p, name, "")
+	h.cmdOutput(p, "ungagged "+name)
+	return nil
+}
+
+func (h *Hub) cmdGags(p Peer) error {
+	list := h.Gags()
+	if len(list) == 0 {
+		h.cmdOutput(p, "no users are gagged")
+		return nil
+	}
+	var buf strings.Builder
+	buf.WriteString("gagged users:")
+	for _, g := range list {
+		buf.WriteString("\n" + g.String())
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
@@ -0,0 +1,61 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGag(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	other := newTestADCPeer(t, h, "other")
+	spammer := newTestADCPeer(t, h, "spammer")
+
+	require.True(t, h.isCommand(op, "!gag Spammer 10m buys stuff"))
+	list := h.Gags()
+	require.Len(t, list, 1)
+	require.Equal(t, "op", list[0].By)
+	require.Equal(t, "buys stuff", list[0].Reason)
+	require.True(t, list[0].Until.After(time.Now().Add(9*time.Minute)))
+	require.True(t, h.isGagged(spammer))
+
+	audit, err := h.Audit(AuditQuery{Action: AuditGag})
+	require.NoError(t, err)
+	require.Len(t, audit, 1)
+	require.Equal(t, "Spammer", audit[0].Target)
+
+	sentADC(op)
+	sentADC(other)
+	sentADC(spammer)
+	h.globalChat.SendChat(spammer, Message{Text: "buy"})
+	require.Empty(t, sentADC(other))
+	require.NotEmpty(t, sentADC(op))
+	require.NotEmpty(t, sentADC(spammer))
+
+	h.privateChat(spammer, other, Message{Text: "buy"})
+	require.Empty(t, sentADC(other))
+
+	// operators may choose to not see gagged messages
+	h.SetConfigBool(ConfigGagOps, false)
+	h.globalChat.SendChat(spammer, Message{Text: "buy"})
+	require.Empty(t, sentADC(op))
+	h.SetConfigBool(ConfigGagOps, true)
+
+	require.True(t, h.isCommand(op, "!ungag spammer"))
+	require.False(t, h.isGagged(spammer))
+	h.globalChat.SendChat(spammer, Message{Text: "hi"})
+	require.NotEmpty(t, sentADC(other))
+
+	// gags expire
+	h.GagUser("spammer", time.Nanosecond, "", "")
+	time.Sleep(time.Millisecond)
+	require.False(t, h.isGagged(spammer))
+	require.Empty(t, h.Gags())
+}
@@ -0,0 +1,366 @@
+package hub
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+// harnessTimeout is the time the harness waits for packets from the hub.
+const harnessTimeout = 5 * time.Second
+
+// testHarness runs a hub with in-memory ADC clients connected over net.Pipe.
+//
+// Clients read all packets from the hub in the background, so the hub never blocks on writes.
+// Delivery can be checked deterministically with Sync: all packets sent by the hub as a result
+// of the client's actions are received before the sync marker.
+type testHarness struct {
+	t       testing.TB
+	h       *Hub
+	clients []*testClient
+	n       int // number of connections
+	seq     int // sync markers
+}
+
+func newTestHarness(t testing.TB, conf Config) *testHarness {
+	h, err := NewHub(conf)
+	require.NoError(t, err)
+	return &testHarness{t: t, h: h}
+}
+
+// Close disconnects all clients and closes the hub.
+func (th *testHarness) Close() {
+	for _, c := range th.clients {
+		_ = c.conn.Close()
+	}
+	_ = th.h.Close()
+}
+
+// Dial connects a new client to the hub without starting the handshake.
+// Each client gets a unique IP address.
+func (th *testHarness) Dial() *testClient {
+	th.n++
+	return th.DialFrom(&net.TCPAddr{IP: net.IPv4(10, 0, byte(th.n>>8), byte(th.n)), Port: 1000 + th.n})
+}
+
+// DialFrom connects a new client from a given address to the hub without starting the handshake.
+func (th *testHarness) DialFrom(ca *net.TCPAddr) *testClient {
+	hc, cc := net.Pipe()
+	ha := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 411}
+	hconn := addrOverride{Conn: hc, local: ha, remote: ca}
+	cconn := addrOverride{Conn: cc, local: ca, remote: ha}
+	go func() {
+		defer hconn.Close()
+		// same as ListenAndServe
+		if th.h.IsHardBlocked(hconn.RemoteAddr()) {
+			return
+		}
+		_ = th.h.Serve(hconn)
+	}()
+	c, err := adc.NewConn(cconn)
+	require.NoError(th.t, err)
+	tc := &testClient{
+		t: th.t, conn: cconn, c: c,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go tc.reader()
+	return tc
+}
+
+// JoinADC connects a new ADC client and waits until all other clients see it.
+func (th *testHarness) JoinADC(name string, fea ...adc.Feature) *testClient {
+	c := th.Dial()
+	c.Name = name
+	sup := "HSUP ADBASE ADTIGR"
+	for _, f := range fea {
+		sup += " AD" + f.String()
+	}
+	c.Send(sup)
+	p := c.Expect("SID", nil)
+	var sid adc.SIDAssign
+	require.NoError(th.t, adc.Unmarshal(p.Message().Data, &sid))
+	c.SID = sid.SID
+
+	pid := types.NewPID()
+	c.SendMsg("BINF "+c.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: name,
+		Slots: 1, SlotsFree: 1, HubsNormal: 1, ShareSize: 1,
+		Features: fea,
+	})
+	c.ExpectJoin(c)
+	for _, c2 := range th.clients {
+		if c2.Online() {
+			c2.ExpectJoin(c)
+		}
+	}
+	th.clients = append(th.clients, c)
+	c.Clear()
+	return c
+}
+
+// Sync waits until all online clients receive all packets sent by the hub in response
+// to the packets from a given client.
+func (th *testHarness) Sync(from *testClient) {
+	th.seq++
+	token := fmt.Sprintf("sync%d", th.seq)
+	// unknown broadcast messages are relayed to all ADC peers in order
+	from.Sendf("BTST %s %s", from.SID, token)
+	for _, c := range th.clients {
+		if !c.Online() {
+			continue
+		}
+		c.Expect("TST", func(p adc.Packet) bool {
+			return string(p.Message().Data) == token
+		})
+	}
+}
+
+// ExpectDelivered checks that only given clients received packets with a given command since
+// the last check. All packets with this command are removed from the queues.
+func (th *testHarness) ExpectDelivered(cmd string, want ...*testClient) {
+	th.t.Helper()
+	var exp, got []string
+	for _, c := range want {
+		exp = append(exp, c.Name)
+	}
+	for _, c := range th.clients {
+		if len(c.Received(cmd)) != 0 {
+			got = append(got, c.Name)
+		}
+	}
+	sort.Strings(exp)
+	sort.Strings(got)
+	require.Equal(th.t, exp, got, "delivery of %s", cmd)
+}
+
+// testClient is a client side of an in-memory connection to the hub.
+type testClient struct {
+	t    testing.TB
+	conn net.Conn
+	c    *adc.Conn
+
+	SID  adc.SID
+	Name string
+
+	mu   sync.Mutex
+	recv []adc.Packet
+	err  error
+	wake chan struct{}
+	done chan struct{}
+}
+
+func (c *testClient) reader() {
+	defer close(c.done)
+	for {
+		p, err := c.c.ReadPacket(time.Time{})
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+		} else {
+			c.recv = append(c.recv, p)
+		}
+		c.mu.Unlock()
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Online checks if the hub hasn't closed the connection yet.
+func (c *testClient) Online() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close disconnects the client.
+func (c *testClient) Close() {
+	_ = c.conn.Close()
+	<-c.done
+}
+
+// Send writes a raw line to the hub.
+func (c *testClient) Send(line string) {
+	c.t.Helper()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(harnessTimeout))
+	_, err := c.conn.Write([]byte(line + "\n"))
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) Sendf(format string, args ...interface{}) {
+	c.t.Helper()
+	c.Send(fmt.Sprintf(format, args...))
+}
+
+// SendMsg encodes the message and sends it with a given packet header, for example "BMSG AAAB".
+func (c *testClient) SendMsg(header string, m adc.Message) {
+	c.t.Helper()
+	data, err := adc.Marshal(m)
+	require.NoError(c.t, err)
+	c.Sendf("%s %s", header, data)
+}
+
+// Chat sends a message to the main chat.
+func (c *testClient) Chat(text string) {
+	c.t.Helper()
+	c.SendMsg("BMSG "+c.SID.String(), adc.ChatMessage{Text: text})
+}
+
+// PM sends a private message to another client.
+func (c *testClient) PM(to *testClient, text string) {
+	c.t.Helper()
+	c.SendMsg("EMSG "+c.SID.String()+" "+to.SID.String(), adc.ChatMessage{Text: text, PM: &c.SID})
+}
+
+// Search sends a search request for a given term.
+func (c *testClient) Search(term string) {
+	c.t.Helper()
+	c.SendMsg("BSCH "+c.SID.String(), adc.SearchRequest{Token: "token", And: []string{term}})
+}
+
+// Clear removes all received packets.
+func (c *testClient) Clear() {
+	c.mu.Lock()
+	c.recv = nil
+	c.mu.Unlock()
+}
+
+// Received returns and removes all received packets with a given command.
+func (c *testClient) Received(cmd string) []adc.Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []adc.Packet
+	rest := c.recv[:0]
+	for _, p := range c.recv {
+		if p.Message().Type.String() == cmd {
+			out = append(out, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	c.recv = rest
+	return out
+}
+
+// Expect waits for a packet with a given command that matches the filter, and removes it from the queue.
+// Filter may be nil.
+func (c *testClient) Expect(cmd string, filter func(p adc.Packet) bool) adc.Packet {
+	c.t.Helper()
+	timeout := time.NewTimer(harnessTimeout)
+	defer timeout.Stop()
+	for {
+		c.mu.Lock()
+		for i, p := range c.recv {
+			if p.Message().Type.String() == cmd && (filter == nil || filter(p)) {
+				c.recv = append(c.recv[:i], c.recv[i+1:]...)
+				c.mu.Unlock()
+				return p
+			}
+		}
+		err := c.err
+		c.mu.Unlock()
+		if err != nil {
+			c.t.Fatalf("%s: waiting for %s: %v", c.Name, cmd, err)
+		}
+		select {
+		case <-c.wake:
+		case <-timeout.C:
+			c.t.Fatalf("%s: timeout waiting for %s", c.Name, cmd)
+		}
+	}
+}
+
+// ExpectJoin waits for the user info of a given client.
+func (c *testClient) ExpectJoin(c2 *testClient) {
+	c.t.Helper()
+	c.Expect("INF", func(p adc.Packet) bool {
+		b, ok := p.(*adc.BroadcastPacket)
+		return ok && b.ID == c2.SID
+	})
+}
+
+// ExpectQuit waits for the hub to announce that a given client left.
+func (c *testClient) ExpectQuit(c2 *testClient) {
+	c.t.Helper()
+	c.Expect("QUI", func(p adc.Packet) bool {
+		var q adc.Disconnect
+		return adc.Unmarshal(p.Message().Data, &q) == nil && q.ID == c2.SID
+	})
+}
+
+// ExpectClosed waits until the hub closes the connection.
+func (c *testClient) ExpectClosed() {
+	c.t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(harnessTimeout):
+		c.t.Fatalf("%s: expected the hub to close the connection", c.Name)
+	}
+}
+
+func TestHarnessChat(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	a := th.JoinADC("alice")
+	b := th.JoinADC("bob")
+	c := th.JoinADC("carol")
+
+	a.Chat("hello all")
+	th.Sync(a)
+	th.ExpectDelivered("MSG", a, b, c)
+
+	a.PM(c, "hello c")
+	th.Sync(a)
+	th.ExpectDelivered("MSG", a, c)
+}
+
+func TestHarnessSearch(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	a := th.JoinADC("alice")
+	b := th.JoinADC("bob")
+	c := th.JoinADC("carol")
+
+	c.Sendf("BINF %s SL5", c.SID)
+	th.Sync(c)
+	th.ExpectDelivered("INF", a, b, c)
+
+	a.Search("file")
+	th.Sync(a)
+	th.ExpectDelivered("SCH", b, c)
+}
+
+func TestHarnessBanIP(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	a := th.JoinADC("alice")
+	b := th.JoinADC("bob")
+
+	th.h.HardBlock(b.conn.LocalAddr())
+	require.NoError(t, th.h.PeerByName("bob").Close())
+	b.ExpectClosed()
+	a.ExpectQuit(b)
+
+	// reconnect from the same address
+	c := th.DialFrom(b.conn.LocalAddr().(*net.TCPAddr))
+	c.ExpectClosed()
+}
@@ -0,0 +1,211 @@
+package hub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// DefaultHybridTimeout is the default time the hub waits for the secondary HBRI connection.
+const DefaultHybridTimeout = 10 * time.Second
+
+// errHybridDone is returned by the handshake after serving a secondary HBRI connection.
+var errHybridDone = errors.New("hbri: address validated")
+
+// HybridConfig configures the HBRI extension, which allows dual-stack ADC clients to validate
+// both their IPv4 and IPv6 addresses.
+//
+// A client connected over one IP version that advertises an address of the other version
+// is asked to make a secondary connection to the hub over that version. The address is only
+// advertised to other peers if the connection succeeds.
+type HybridConfig struct {
+	// Addr4 is the IPv4 address of the hub in the "host:port" form.
+	Addr4 string
+	// Addr6 is the IPv6 address of the hub in the "host:port" form.
+	Addr6 string
+	// Timeout is the time the hub waits for the secondary connection.
+	// Zero value means DefaultHybridTimeout.
+	Timeout time.Duration
+}
+
+func (c HybridConfig) enabled() bool {
+	return c.Addr4 != "" || c.Addr6 != ""
+}
+
+func (c HybridConfig) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultHybridTimeout
+	}
+	return c.Timeout
+}
+
+type hybridState struct {
+	sync.Mutex
+	// pending maps tokens to validations of the IP version
+	pending map[string]*hybridCheck
+}
+
+type hybridCheck struct {
+	ipv6 bool
+	done chan net.IP
+}
+
+func splitHybridAddr(addr string) (string, int, error) {
+	host, sport, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(sport)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port: %q", sport)
+	}
+	return host, port, nil
+}
+
+func (h *Hub) initHybrid() error {
+	conf := h.conf.Hybrid
+	for _, addr := range []string{conf.Addr4, conf.Addr6} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := splitHybridAddr(addr); err != nil {
+			return fmt.Errorf("hbri: %v", err)
+		}
+	}
+	if conf.enabled() {
+		h.hybrid.pending = make(map[string]*hybridCheck)
+		h.adcFea.Add(adc.FeaHBRI)
+	}
+	return nil
+}
+
+// adcStageHybrid validates the address of the other IP version advertised in the user info.
+// The address is removed from the info if the validation fails.
+func (h *Hub) adcStageHybrid(peer *adcPeer, u *adc.User) error {
+	if !peer.fea.IsSet(adc.FeaHBRI) {
+		return nil
+	}
+	t, ok := peer.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	ipv6 := t.IP.To4() != nil
+	var addr string
+	if ipv6 {
+		if u.Ip6 == "" && !u.Features.Has(adc.FeaTCP6) && !u.Features.Has(adc.FeaUDP6) {
+			return nil
+		}
+		addr = h.conf.Hybrid.Addr6
+	} else {
+		if u.Ip4 == "" && !u.Features.Has(adc.FeaTCP4) && !u.Features.Has(adc.FeaUDP4) {
+			return nil
+		}
+		addr = h.conf.Hybrid.Addr4
+	}
+	if addr == "" {
+		return nil
+	}
+	host, port, _ := splitHybridAddr(addr)
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b[:])
+	check := &hybridCheck{ipv6: ipv6, done: make(chan net.IP, 1)}
+	h.hybrid.Lock()
+	h.hybrid.pending[token] = check
+	h.hybrid.Unlock()
+	defer func() {
+		h.hybrid.Lock()
+		delete(h.hybrid.pending, token)
+		h.hybrid.Unlock()
+	}()
+
+	msg := adc.HybridBridge{Token: token}
+	if ipv6 {
+		msg.Ip6, msg.Port6 = host, port
+	} else {
+		msg.Ip4, msg.Port4 = host, port
+	}
+	if err := peer.c.WriteInfoMsg(msg); err != nil {
+		return err
+	}
+	if err := peer.c.Flush(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(h.conf.Hybrid.timeout())
+	defer timer.Stop()
+	select {
+	case ip := <-check.done:
+		if ipv6 {
+			u.Ip6 = ip.String()
+		} else {
+			u.Ip4 = ip.String()
+		}
+	case <-timer.C:
+		removeHybridAddr(u, ipv6)
+	}
+	return nil
+}
+
+// removeHybridAddr removes the address and ports of a given IP version from the user info.
+func removeHybridAddr(u *adc.User, ipv6 bool) {
+	var drop [2]adc.Feature
+	if ipv6 {
+		u.Ip6, u.Udp6 = "", 0
+		drop = [2]adc.Feature{adc.FeaTCP6, adc.FeaUDP6}
+	} else {
+		u.Ip4, u.Udp4 = "", 0
+		drop = [2]adc.Feature{adc.FeaTCP4, adc.FeaUDP4}
+	}
+	fea := make(adc.ExtFeatures, 0, len(u.Features))
+	for _, f := range u.Features {
+		if f != drop[0] && f != drop[1] {
+			fea = append(fea, f)
+		}
+	}
+	u.Features = fea
+}
+
+// adcHybridConn serves a secondary HBRI connection, which sends the token instead of the user info.
+func (h *Hub) adcHybridConn(peer *adcPeer, hp *adc.HubPacket) error {
+	var msg adc.HybridBridge
+	if err := adc.Unmarshal(hp.Data, &msg); err != nil {
+		return err
+	}
+	h.hybrid.Lock()
+	check := h.hybrid.pending[msg.Token]
+	h.hybrid.Unlock()
+	var ip net.IP
+	if t, ok := peer.RemoteAddr().(*net.TCPAddr); ok {
+		ip = t.IP
+	}
+	switch {
+	case check == nil:
+		_ = peer.sendErrorNow(adc.NewError(adc.Fatal, adc.CodeProtocolGeneric, "invalid token"))
+		return errors.New("hbri: invalid token")
+	case ip == nil || (ip.To4() == nil) != check.ipv6:
+		_ = peer.sendErrorNow(adc.NewError(adc.Fatal, adc.CodeProtocolGeneric, "wrong IP version"))
+		return errors.New("hbri: wrong IP version")
+	}
+	select {
+	case check.done <- ip:
+	default:
+		// already validated
+	}
+	if err := peer.c.WriteInfoMsg(adc.Status{Sev: adc.Success}); err != nil {
+		return err
+	}
+	if err := peer.c.Flush(); err != nil {
+		return err
+	}
+	return errHybridDone
+}
@@ -0,0 +1,90 @@
+package hub
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+// hybridLogin starts the login of a dual-stack client connected over IPv4 and returns the hub request.
+func hybridLogin(th *testHarness, name string, ip net.IP) (*testClient, adc.HybridBridge) {
+	c := th.DialFrom(&net.TCPAddr{IP: ip, Port: 1000})
+	c.Name = name
+	c.Send("HSUP ADBASE ADTIGR ADHBRI")
+	var sid adc.SIDAssign
+	require.NoError(th.t, adc.Unmarshal(c.Expect("SID", nil).Message().Data, &sid))
+	c.SID = sid.SID
+
+	pid := types.NewPID()
+	c.SendMsg("BINF "+c.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: name,
+		Ip4: "0.0.0.0", Ip6: "::", Udp6: 4000,
+		Slots: 1, SlotsFree: 1, HubsNormal: 1, ShareSize: 1,
+		Features: adc.ExtFeatures{adc.FeaTCP4, adc.FeaTCP6, adc.FeaUDP6},
+	})
+	var req adc.HybridBridge
+	require.NoError(th.t, adc.Unmarshal(c.Expect("TCP", nil).Message().Data, &req))
+	return c, req
+}
+
+func expectSelfInfo(c *testClient) adc.User {
+	p := c.Expect("INF", func(p adc.Packet) bool {
+		b, ok := p.(*adc.BroadcastPacket)
+		return ok && b.ID == c.SID
+	})
+	var u adc.User
+	require.NoError(c.t, adc.Unmarshal(p.Message().Data, &u))
+	return u
+}
+
+func TestHybridBridge(t *testing.T) {
+	_, err := NewHub(Config{Hybrid: HybridConfig{Addr6: "2001:db8::1"}})
+	require.Error(t, err)
+
+	th := newTestHarness(t, Config{Hybrid: HybridConfig{
+		Addr6:   "[2001:db8::1]:411",
+		Timeout: 200 * time.Millisecond,
+	}})
+	defer th.Close()
+
+	c, req := hybridLogin(th, "dual", net.IPv4(10, 0, 0, 1))
+	require.Equal(t, "2001:db8::1", req.Ip6)
+	require.Equal(t, 411, req.Port6)
+	require.NotEmpty(t, req.Token)
+
+	// wrong IP version
+	b := th.DialFrom(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1001})
+	b.Send("HSUP ADBASE ADTIGR ADHBRI")
+	b.Expect("SID", nil)
+	b.SendMsg("HTCP", adc.HybridBridge{Token: req.Token})
+	b.ExpectClosed()
+
+	b = th.DialFrom(&net.TCPAddr{IP: net.ParseIP("2001:db8::5"), Port: 1002})
+	b.Send("HSUP ADBASE ADTIGR ADHBRI")
+	b.Expect("SID", nil)
+	b.SendMsg("HTCP", adc.HybridBridge{Token: req.Token})
+	var st adc.Status
+	require.NoError(t, adc.Unmarshal(b.Expect("STA", nil).Message().Data, &st))
+	require.True(t, st.Ok())
+	b.ExpectClosed()
+
+	u := expectSelfInfo(c)
+	require.Equal(t, "10.0.0.1", u.Ip4)
+	require.Equal(t, "2001:db8::5", u.Ip6)
+	require.Equal(t, 4000, u.Udp6)
+	require.True(t, u.Features.Has(adc.FeaTCP6))
+
+	// the address is not advertised without validation
+	c, _ = hybridLogin(th, "other", net.IPv4(10, 0, 0, 2))
+	u = expectSelfInfo(c)
+	require.Equal(t, "10.0.0.2", u.Ip4)
+	require.Equal(t, "", u.Ip6)
+	require.Equal(t, 0, u.Udp6)
+	require.False(t, u.Features.Has(adc.FeaTCP6))
+	require.True(t, u.Features.Has(adc.FeaTCP4))
+}
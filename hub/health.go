@@ -0,0 +1,188 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HTTPHealthPath = "/healthz"
+	HTTPReadyPath  = "/readyz"
+)
+
+const (
+	// DefaultWatchdogInterval is the interval between watchdog probes.
+	DefaultWatchdogInterval = 5 * time.Second
+	// DefaultWatchdogTimeout is the time after which a stalled probe marks the hub as degraded.
+	DefaultWatchdogTimeout = 30 * time.Second
+)
+
+// Health statuses reported by the health endpoints.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthStarting = "starting"
+	HealthStopped  = "stopped"
+)
+
+// health tracks heartbeats of hub components. All fields are accessed atomically.
+type health struct {
+	started int32 // set once Start completes
+	// listeners is the number of running accept loops.
+	listeners int32
+	// acceptBusy is the time the accept loop returned from Accept (unix nano),
+	// or zero if it's waiting for connections.
+	acceptBusy int64
+	// lastBeat is the time the last lock probe completed (unix nano).
+	lastBeat int64
+	// probing is set while the lock probe is in progress.
+	probing int32
+}
+
+// HealthCheck is a state of a single component checked by the watchdog.
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthStatus is a result of a health check.
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+func (h *Hub) watchdogTimeout() time.Duration {
+	if h.conf.WatchdogTimeout > 0 {
+		return h.conf.WatchdogTimeout
+	}
+	return DefaultWatchdogTimeout
+}
+
+// probeLocks acquires locks used by the broadcast path. If any of them is deadlocked,
+// the probe never completes and the heartbeat stops.
+func (h *Hub) probeLocks() {
+	defer atomic.StoreInt32(&h.health.probing, 0)
+	h.conf.RLock()
+	h.conf.RUnlock()
+	h.peers.RLock()
+	h.peers.RUnlock()
+	h.rooms.RLock()
+	h.rooms.RUnlock()
+	_ = h.globalChat.Users()
+	_ = h.Peers()
+	atomic.StoreInt64(&h.health.lastBeat, time.Now().UnixNano())
+}
+
+func (h *Hub) runWatchdog() {
+	atomic.StoreInt64(&h.health.lastBeat, time.Now().UnixNano())
+	ticker := time.NewTicker(DefaultWatchdogInterval)
+	defer ticker.Stop()
+	for {
+		// don't pile up probes if the previous one is stuck
+		if atomic.CompareAndSwapInt32(&h.health.probing, 0, 1) {
+			go h.probeLocks()
+		}
+		if h.Health().Status == HealthOK {
+			gaugeHealthy.Set(1)
+		} else {
+			gaugeHealthy.Set(0)
+		}
+		select {
+		case <-h.closed:
+			gaugeHealthy.Set(0)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// acceptStarted marks the accept loop as busy processing a new connection.
+func (h *Hub) acceptStarted() {
+	atomic.StoreInt64(&h.health.acceptBusy, time.Now().UnixNano())
+}
+
+// acceptDone marks the accept loop as waiting for new connections.
+func (h *Hub) acceptDone() {
+	atomic.StoreInt64(&h.health.acceptBusy, 0)
+}
+
+// Health runs health checks and returns the current state of the hub.
+func (h *Hub) Health() HealthStatus {
+	now := time.Now()
+	st := HealthStatus{
+		Status: HealthOK,
+		Uptime: now.Sub(h.created).Round(time.Second).String(),
+		Checks: make(map[string]HealthCheck),
+	}
+	select {
+	case <-h.closed:
+		st.Status = HealthStopped
+		return st
+	default:
+	}
+	if atomic.LoadInt32(&h.health.started) == 0 {
+		st.Status = HealthStarting
+		return st
+	}
+	timeout := h.watchdogTimeout()
+	check := func(name string, stalled bool, err string) {
+		if !stalled {
+			st.Checks[name] = HealthCheck{Status: HealthOK}
+			return
+		}
+		st.Status = HealthDegraded
+		st.Checks[name] = HealthCheck{Status: HealthDegraded, Error: err}
+	}
+	if atomic.LoadInt32(&h.health.listeners) != 0 {
+		busy := atomic.LoadInt64(&h.health.acceptBusy)
+		check("accept", busy != 0 && now.Sub(time.Unix(0, busy)) > timeout,
+			"accept loop is stalled")
+	}
+	last := atomic.LoadInt64(&h.health.lastBeat)
+	check("locks", last != 0 && now.Sub(time.Unix(0, last)) > timeout,
+		"broadcast path is not responding")
+	return st
+}
+
+// HealthHandler returns an HTTP handler that serves the health and readiness endpoints.
+func (h *Hub) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(HTTPHealthPath, h.serveHealth)
+	mux.HandleFunc(HTTPReadyPath, h.serveReady)
+	return mux
+}
+
+func (h *Hub) writeHealth(w http.ResponseWriter, st HealthStatus, code int) {
+	hd := w.Header()
+	hd.Set("Content-Type", "application/json")
+	hd.Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// serveHealth reports if the hub is alive. Only stalled components make it fail,
+// so orchestrators can restart the hub.
+func (h *Hub) serveHealth(w http.ResponseWriter, r *http.Request) {
+	st := h.Health()
+	code := http.StatusOK
+	if st.Status == HealthDegraded || st.Status == HealthStopped {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeHealth(w, st, code)
+}
+
+// serveReady reports if the hub accepts users.
+func (h *Hub) serveReady(w http.ResponseWriter, r *http.Request) {
+	st := h.Health()
+	code := http.StatusOK
+	if st.Status != HealthOK {
+		code = http.StatusServiceUnavailable
+	} else if atomic.LoadInt32(&h.health.listeners) == 0 {
+		st.Status = HealthStarting
+		code = http.StatusServiceUnavailable
+	}
+	h.writeHealth(w, st, code)
+}
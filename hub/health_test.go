@@ -0,0 +1,59 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	h, err := NewHub(Config{WatchdogTimeout: time.Minute})
+	require.NoError(t, err)
+	srv := h.HealthHandler()
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+
+	require.Equal(t, HealthStarting, h.Health().Status)
+	require.Equal(t, http.StatusOK, get(HTTPHealthPath))
+	require.Equal(t, http.StatusServiceUnavailable, get(HTTPReadyPath))
+
+	atomic.StoreInt32(&h.health.started, 1)
+	h.probeLocks()
+	require.Equal(t, HealthOK, h.Health().Status)
+	// no listeners yet
+	require.Equal(t, http.StatusServiceUnavailable, get(HTTPReadyPath))
+
+	atomic.AddInt32(&h.health.listeners, 1)
+	h.acceptStarted()
+	require.Equal(t, http.StatusOK, get(HTTPHealthPath))
+	require.Equal(t, http.StatusOK, get(HTTPReadyPath))
+
+	// accept loop is stuck
+	atomic.StoreInt64(&h.health.acceptBusy, time.Now().Add(-2*time.Minute).UnixNano())
+	st := h.Health()
+	require.Equal(t, HealthDegraded, st.Status)
+	require.Equal(t, HealthDegraded, st.Checks["accept"].Status)
+	require.Equal(t, http.StatusServiceUnavailable, get(HTTPHealthPath))
+	h.acceptDone()
+	require.Equal(t, HealthOK, h.Health().Status)
+
+	// broadcast path is deadlocked
+	h.peers.Lock()
+	atomic.StoreInt64(&h.health.lastBeat, time.Now().Add(-2*time.Minute).UnixNano())
+	st = h.Health()
+	require.Equal(t, HealthDegraded, st.Checks["locks"].Status)
+	h.peers.Unlock()
+	h.probeLocks()
+	require.Equal(t, HealthOK, h.Health().Status)
+
+	require.NoError(t, h.Close())
+	require.Equal(t, http.StatusServiceUnavailable, get(HTTPHealthPath))
+}
@@ -0,0 +1,197 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryRetention is the default time the connection history is kept.
+const DefaultHistoryRetention = 90 * 24 * time.Hour
+
+// ConnRecord links a nick, IP and CID of a single connection to the hub.
+type ConnRecord struct {
+	Name string
+	IP   string
+	// CID of the user. Empty for NMDC and IRC users.
+	CID string
+	// Join is the time when the user joined the hub. Together with the name it identifies the record.
+	Join time.Time
+	// Leave is the time when the user left the hub. It is zero if the user is still online.
+	Leave time.Time
+}
+
+// ConnQuery selects records of the connection history. Zero fields match any record.
+type ConnQuery struct {
+	Name string
+	IP   string
+	CID  string
+	// Limit is the maximal number of records to return. Zero means no limit.
+	Limit int
+}
+
+// Match checks if the record matches the query. Limit is not checked.
+func (q ConnQuery) Match(r ConnRecord) bool {
+	if q.Name != "" && q.Name != r.Name {
+		return false
+	}
+	if q.IP != "" && q.IP != r.IP {
+		return false
+	}
+	if q.CID != "" && q.CID != r.CID {
+		return false
+	}
+	return true
+}
+
+type HistoryDatabase interface {
+	// PutConn creates or updates a record of the connection history.
+	PutConn(rec ConnRecord) error
+	// QueryConns returns records of the connection history, starting from the most recent one.
+	QueryConns(q ConnQuery) ([]ConnRecord, error)
+	// ExpireConns removes records of connections that were started before a given time.
+	ExpireConns(before time.Time) error
+}
+
+// connRecord returns a connection history record for the current session of the peer.
+func (h *Hub) connRecord(peer Peer) ConnRecord {
+	rec := ConnRecord{
+		Name: peer.Name(),
+		IP:   addrString(peer.RemoteAddr()),
+		Join: peer.base().joined,
+	}
+	if cid := peer.CID(); !cid.IsZero() {
+		rec.CID = cid.String()
+	}
+	return rec
+}
+
+// historyJoin adds the peer to the connection history and checks if it may be evading a ban.
+func (h *Hub) historyJoin(peer Peer) {
+	if h.db == nil || PeerProtocol(peer) == ProtoBot {
+		return
+	}
+	peer.base().joined = time.Now().UTC()
+	rec := h.connRecord(peer)
+	if err := h.db.PutConn(rec); err != nil {
+		h.hubError("cannot save connection history: %v", err)
+		return
+	}
+	if rec.CID != "" {
+		h.checkBanEvasion(rec)
+	}
+}
+
+// historyLeave records the time when the peer left the hub.
+func (h *Hub) historyLeave(peer Peer) {
+	if h.db == nil || peer.base().joined.IsZero() {
+		return
+	}
+	rec := h.connRecord(peer)
+	rec.Leave = time.Now().UTC()
+	if err := h.db.PutConn(rec); err != nil {
+		h.hubError("cannot save connection history: %v", err)
+	}
+}
+
+// checkBanEvasion alerts operators if the CID was seen before from an IP that is now banned.
+func (h *Hub) checkBanEvasion(rec ConnRecord) {
+	list, err := h.db.QueryConns(ConnQuery{CID: rec.CID})
+	if err != nil {
+		h.hubError("cannot check connection history: %v", err)
+		return
+	}
+	for _, r := range list {
+		if r.IP == rec.IP {
+			continue
+		}
+		ip := net.ParseIP(r.IP)
+		if ip == nil || !h.IsHardBlockedIP(ip) {
+			continue
+		}
+		text := fmt.Sprintf("possible ban evasion: %s (%s) joined from %s, the CID was used by %s from banned IP %s",
+			rec.Name, rec.CID, rec.IP, r.Name, r.IP)
+		h.alertOps(text)
+		return
+	}
+}
+
+// sendToOps sends a message to all operators that can ban users.
+func (h *Hub) sendToOps(text string) {
+	for _, p := range h.Peers() {
+		if p.User().HasPerm(PermBanIP) {
+			_ = p.HubChatMsg(Message{Text: text})
+		}
+	}
+}
+
+// alertOps logs an automatic alert, sends it to operators and forwards it to notification webhooks.
+func (h *Hub) alertOps(text string) {
+	log.Println(text)
+	h.sendToOps(text)
+	h.notify(NotifyAlert, "", text)
+}
+
+// runHistoryExpiry periodically removes old records of the connection history.
+func (h *Hub) runHistoryExpiry(retention time.Duration) {
+	if retention <= 0 {
+		retention = DefaultHistoryRetention
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := h.db.ExpireConns(time.Now().Add(-retention)); err != nil {
+			h.hubError("cannot expire connection history: %v", err)
+		}
+		select {
+		case <-h.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) cmdHistory(p Peer, kind, value string) error {
+	if h.db == nil {
+		return errors.New("connection history is disabled")
+	}
+	q := ConnQuery{Limit: 20}
+	switch kind {
+	case "ip":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return errors.New("invalid IP format")
+		}
+		q.IP = ip.String()
+	case "cid":
+		q.CID = value
+	case "nick", "name":
+		q.Name = value
+	default:
+		return fmt.Errorf("expected ip, cid or nick, got: %q", kind)
+	}
+	list, err := h.db.QueryConns(q)
+	if err != nil {
+		return err
+	} else if len(list) == 0 {
+		h.cmdOutput(p, "no connections found")
+		return nil
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "connections with %s %s:", kind, value)
+	for _, r := range list {
+		leave := "online"
+		if !r.Leave.IsZero() {
+			leave = r.Leave.Format(time.RFC1123)
+		}
+		fmt.Fprintf(&buf, "\n%s - %s: %s, IP: %s", r.Join.Format(time.RFC1123), leave, r.Name, r.IP)
+		if r.CID != "" {
+			fmt.Fprintf(&buf, ", CID: %s", r.CID)
+		}
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
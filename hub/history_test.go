@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	p := newTestADCPeer(t, h, "user")
+	list, err := h.db.QueryConns(ConnQuery{Name: "user"})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "127.0.0.1", list[0].IP)
+	require.True(t, list[0].Leave.IsZero())
+
+	require.NoError(t, p.Close())
+	list, err = h.db.QueryConns(ConnQuery{IP: "127.0.0.1"})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.False(t, list[0].Leave.IsZero())
+
+	other := newTestADCPeer(t, h, "other")
+	sentADC(other)
+	require.True(t, h.isCommand(other, "!history ip 127.0.0.1"))
+	require.Contains(t, lastChat(t, other), "unsupported")
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	sentADC(op)
+	require.True(t, h.isCommand(op, "!history ip 127.0.0.1"))
+	out := lastChat(t, op)
+	require.Contains(t, out, `user,\sIP:\s127.0.0.1`)
+	require.Contains(t, out, `other,\sIP:\s127.0.0.1`)
+
+	require.True(t, h.isCommand(op, "!history nick user"))
+	out = lastChat(t, op)
+	require.Contains(t, out, "user")
+	require.NotContains(t, out, "other")
+
+	require.NoError(t, h.db.ExpireConns(time.Now().Add(time.Minute)))
+	list, err = h.db.QueryConns(ConnQuery{})
+	require.NoError(t, err)
+	require.Empty(t, list)
+}
+
+func TestHistoryBanEvasion(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	sentADC(op)
+
+	cid := CID{1}
+	require.NoError(t, h.db.PutConn(ConnRecord{
+		Name: "bad", IP: "10.0.0.1", CID: cid.String(),
+		Join: time.Now().Add(-time.Hour), Leave: time.Now().Add(-time.Minute),
+	}))
+
+	p := newTestADCPeer(t, h, "good")
+	setTestCID(h, p, cid)
+	h.historyJoin(p)
+	require.Empty(t, sentADC(op))
+
+	h.HardBlockIP(net.ParseIP("10.0.0.1"))
+	h.historyJoin(p)
+	require.Contains(t, lastChat(t, op), `possible\sban\sevasion`)
+
+	h.HardUnBlockIP(net.ParseIP("10.0.0.1"))
+	require.False(t, h.IsHardBlockedIP(net.ParseIP("10.0.0.1")))
+}
@@ -12,27 +12,107 @@ import (
 	"time"
 
 	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/htmlindex"
 
 	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dcpp/nmdc"
 	"github.com/direct-connect/go-dcpp/version"
 )
 
 type Config struct {
-	Name             string
-	Desc             string
-	Topic            string
-	Addr             string
-	Owner            string
-	Website          string
-	Email            string
+	Name    string
+	Desc    string
+	Topic   string
+	Addr    string
+	Owner   string
+	Website string
+	Email   string
+	// BotName is the name of the hub bot that sends system messages. Zero value means the hub name.
+	BotName string
+	// Locale selects the language of system messages. Users may override it with the LC field of their INF.
+	// Zero value means DefaultLocale.
+	Locale string
+	// Texts overrides system messages from DefaultTexts or adds new locales.
+	Texts            Texts
 	Keyprint         string
 	Soft             dc.Software
 	MOTD             string
 	ChatLog          int
 	ChatLogJoin      int
 	FallbackEncoding string
-	TLS              *tls.Config
+	// NMDCEncoding forces a text encoding for all NMDC connections, instead of detecting it.
+	// If set, it is also used as a fallback encoding.
+	NMDCEncoding string
+	// NMDCCompat configures support for legacy NMDC clients.
+	NMDCCompat NMDCCompatConfig
+	// ChatTimestamps prefixes relayed main chat messages with the time they were sent.
+	ChatTimestamps bool
+	// TimeZone is the name of the hub time zone used for timestamps, for example "Europe/Moscow".
+	// Users may override it with a fixed offset. Zero value means UTC.
+	TimeZone string
+	// Nicks is a policy for user names.
+	Nicks NickPolicy
+	// MultiLogin is a policy for users that log in multiple times.
+	MultiLogin MultiLoginPolicy
+	// MaxLoginsPerIP limits the number of users connected from the same IP.
+	// Zero means no limit.
+	MaxLoginsPerIP int
+	// UpdateDelay enables coalescing of user info updates. Updates of the same user that
+	// happen within the delay are sent to other peers as a single update.
+	// Zero value means that updates are sent immediately.
+	UpdateDelay time.Duration
+	// SIDQuarantine is the time before a session ID of a departed user can be reused.
+	// Zero value means the default of one minute.
+	SIDQuarantine time.Duration
+	// UserList controls delivery of the user list on login.
+	UserList UserListConfig
+	// Timeouts configures handshake, idle and write timeouts for connections.
+	Timeouts Timeouts
+	// WatchdogTimeout is the time after which a stalled accept loop or broadcast path
+	// marks the hub as degraded. Zero value means DefaultWatchdogTimeout.
+	WatchdogTimeout time.Duration
+	// Welcome configures the hub rules that users must accept after joining.
+	Welcome WelcomeConfig
+	// Announcements are messages posted by the hub bot on a schedule.
+	Announcements []Announcement
+	// HistoryRetention is the time the connection history is kept.
+	// Zero value means DefaultHistoryRetention.
+	HistoryRetention time.Duration
+	// Authz configures an external authorization webhook.
+	Authz AuthzConfig
+	// Notify configures forwarding of hub events to external services.
+	Notify NotifyConfig
+	// ChatBridges are virtual users that inject messages from external chat networks.
+	ChatBridges []ChatBridgeConfig
+	// Matrix configures a bridge to Matrix rooms. Nil value disables it.
+	Matrix *MatrixConfig
+	// XMPP configures a gateway that exposes the hub chat as an XMPP multi-user chat service. Nil value disables it.
+	XMPP *XMPPConfig
+	// SearchStats configures collection of anonymized search statistics.
+	SearchStats SearchStatsConfig
+	// SearchSchedule configures spreading of large search broadcasts over time.
+	SearchSchedule SearchScheduleConfig
+	// Reaper configures keepalives and disconnection of idle peers.
+	Reaper ReaperConfig
+	// SharedFiles configures the hub-wide index of file lists uploaded by users.
+	SharedFiles SharedFilesConfig
+	// Hybrid configures validation of both IPv4 and IPv6 addresses of ADC clients (HBRI).
+	Hybrid HybridConfig
+	// RequireExtensions lists ADC extensions that clients must support to log in or to use the hub fully.
+	RequireExtensions []RequiredExtension
+	// APIToken enables administrative HTTP API endpoints, such as the audit log.
+	// Requests must pass the token in the Authorization header as a bearer token.
+	APIToken string
+	// ReloadConfig reads the config file again. Nil value disables config reloading.
+	ReloadConfig func() (Map, error)
+	TLS          *tls.Config
+	// ADCUpgradeTLS allows ADC clients on plaintext connections to switch to TLS by sending ADCS in SUP.
+	// The hub confirms it with ADCS in its own SUP, and the TLS handshake starts right after it.
+	ADCUpgradeTLS bool
+	// CaptureDir enables recording of all ADC and NMDC sessions to a given directory.
+	// Should only be used for debugging.
+	CaptureDir string
+	// DiagDir is a directory for diagnostic dumps. Zero value means DefaultDiagDir.
+	DiagDir string
 }
 
 func NewHub(conf Config) (*Hub, error) {
@@ -60,33 +140,118 @@ func NewHub(conf Config) (*Hub, error) {
 	if conf.MOTD == "" {
 		conf.MOTD = "Welcome!"
 	}
+	if conf.BotName == "" {
+		conf.BotName = conf.Name
+	}
+	if conf.Locale == "" {
+		conf.Locale = DefaultLocale
+	}
+	texts, err := newTextCatalog(conf.Texts)
+	if err != nil {
+		return nil, err
+	}
 	h := &Hub{
 		created: time.Now(),
 		closed:  make(chan struct{}),
 		tls:     conf.TLS,
+		texts:   texts,
 	}
 	h.conf.Config = conf
+	if conf.TimeZone != "" {
+		if err := h.setTimeZone(conf.TimeZone); err != nil {
+			return nil, err
+		}
+	}
 	h.setZlibLevel(-1)
 	if conf.FallbackEncoding != "" {
-		enc, err := htmlindex.Get(conf.FallbackEncoding)
+		enc, err := nmdc.ParseEncoding(conf.FallbackEncoding)
 		if err != nil {
 			return nil, err
 		}
 		h.fallback = enc
 	}
-	h.peers.reserved = make(map[nameKey]struct{})
-	h.peers.byName = make(map[nameKey]Peer)
-	h.peers.bySID = make(map[SID]Peer)
+	if conf.NMDCEncoding != "" {
+		enc, err := nmdc.ParseEncoding(conf.NMDCEncoding)
+		if err != nil {
+			return nil, err
+		}
+		h.nmdcEnc = enc
+		if enc != nil {
+			// only one legacy encoding is supported at a time
+			h.fallback = enc
+		}
+	}
+	if err := h.setNickPolicy(conf.Nicks); err != nil {
+		return nil, err
+	}
+	for _, a := range conf.Announcements {
+		if err := h.SetAnnouncement(a); err != nil {
+			return nil, fmt.Errorf("announcement %q: %v", a.ID, err)
+		}
+	}
+	h.peers.index.init()
+	h.feed.epoch = newListEpoch()
+	h.sids.quarantine = conf.SIDQuarantine
+	if h.sids.quarantine == 0 {
+		h.sids.quarantine = defaultSIDQuarantine
+	}
 	h.rooms.init()
-	h.globalChat = h.newRoom("")
+	if conf.SearchStats.Enabled {
+		h.searchStats = newSearchStats(conf.SearchStats)
+	}
+	if conf.SearchSchedule.Enabled {
+		h.searchSched = newSearchScheduler(conf.SearchSchedule)
+	}
+	if conf.Reaper.enabled() {
+		h.reaper = newIdleReaper(h, conf.Reaper)
+	}
+	if conf.SharedFiles.Enabled {
+		h.sharedFiles = newSharedFiles(conf.SharedFiles)
+	}
+	if conf.Authz.URL != "" {
+		h.authz = newAuthzClient(conf.Authz)
+	}
+	if len(conf.Notify.Webhooks) != 0 {
+		n, err := newNotifier(conf.Notify)
+		if err != nil {
+			return nil, err
+		}
+		h.notifier = n
+	}
 
-	var err error
-	h.hubUser, err = h.newBot(conf.Name, conf.Desc, conf.Email, UserHub, conf.Soft)
+	h.globalChat, err = h.newRoom("")
+	if err != nil {
+		return nil, err
+	}
+	h.hubUser, err = h.newBot(conf.BotName, conf.Desc, conf.Email, UserHub, conf.Soft)
 	if err != nil {
 		return nil, err
 	}
+	for _, c := range conf.ChatBridges {
+		if err = h.addChatBridge(c); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Matrix != nil {
+		h.matrix, err = h.newMatrixBridge(*conf.Matrix)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.XMPP != nil {
+		h.xmpp, err = h.newXMPPComponent(*conf.XMPP)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	h.initADC()
+	if err := h.initHybrid(); err != nil {
+		return nil, err
+	}
+	if err := h.initExtensions(); err != nil {
+		return nil, err
+	}
 	if err := h.initHTTP(); err != nil {
 		return nil, err
 	}
@@ -100,10 +265,6 @@ const shareDiv = 1024 * 1024
 // nameKey is a lowercase name.
 type nameKey string
 
-func toNameKey(name string) nameKey {
-	return nameKey(strings.ToLower(name))
-}
-
 type Hub struct {
 	created time.Time
 	closed  chan struct{}
@@ -111,35 +272,73 @@ type Hub struct {
 	conf struct {
 		sync.RWMutex
 		Config
-		m Map
+		m  Map
+		tz *time.Location // parsed TimeZone; nil means UTC
 	}
 	addrs []string
 	tls   *tls.Config
 	httpData
 
 	db Database
+	// auth is a chain of authentication providers; nil means LocalAuth only
+	auth []AuthProvider
 
-	lastSID uint32
+	sids    sidPool
 	hubUser *Bot
 
-	fallback encoding.Encoding
+	nicks nickPolicy
+	texts textCatalog
 
-	sampler sampler
+	fallback encoding.Encoding
+	nmdcEnc  encoding.Encoding // forced encoding for NMDC
+
+	sampler  sampler
+	adcState // ADC specific
+	hybrid   hybridState
+	// requiredExt are extensions clients must support, see Config.RequireExtensions
+	requiredExt []requiredExt
+	stats       hubStats
+	feed        changeFeed
+
+	// searchStats is nil if search statistics are disabled
+	searchStats *searchStats
+	// searchSched is nil if searches are sent to all peers at once
+	searchSched *searchScheduler
+	// reaper is nil if idle peers are not checked
+	reaper *idleReaper
+	// sharedFiles is nil if the shared files index is disabled
+	sharedFiles *sharedFiles
+	// authz is nil if the authorization webhook is disabled
+	authz *authzClient
+	// notifier is nil if no notification webhooks are configured
+	notifier *notifier
+	bridges  chatBridges
+	services serviceUsers
+	// matrix is nil if the Matrix bridge is disabled
+	matrix *matrixBridge
+	// xmpp is nil if the XMPP gateway is disabled
+	xmpp *xmppComponent
 
 	peers struct {
 		curList atomic.Value // []Peer
 		share   int64        // atomic, MB
+		files   int64        // atomic
+		sharers int64        // atomic
 
+		// RWMutex serializes joins and leaves with snapshots of the peer list,
+		// so all peers observe them in the same order. Registration of names
+		// and CIDs only uses the locks of the index.
 		sync.RWMutex
-		// reserved map is used to temporary bind a username.
-		// The name should be removed from this map as soon as a byName entry is added.
-		reserved map[nameKey]struct{}
 
-		// byName tracks peers by their name.
-		byName map[nameKey]Peer
-		bySID  map[SID]Peer
+		// index tracks peers by their name, SID and CID.
+		index peerIndex
+	}
 
-		adcPeers // ADC specific
+	// updates holds the timers of user info updates delayed for coalescing.
+	updates struct {
+		sync.Mutex
+		closed  bool
+		pending map[Peer]*time.Timer
 	}
 
 	cmds struct {
@@ -155,7 +354,11 @@ type Hub struct {
 	plugins    plugins
 	hooks      hooks
 	bans       bans
+	watch      watchlist
+	gags       gags
+	announce   announcer
 	profiles   profiles
+	health     health
 }
 
 func (h *Hub) SetDatabase(db Database) {
@@ -166,14 +369,41 @@ func (h *Hub) AddAddress(addr string) {
 	h.addrs = append(h.addrs, addr)
 }
 
-func (h *Hub) incShare(v uint64) {
-	atomic.AddInt64(&h.peers.share, int64(v/shareDiv))
-	cntShare.Add(float64(v))
+func (h *Hub) incShare(u *UserInfo) {
+	atomic.AddInt64(&h.peers.share, int64(u.Share/shareDiv))
+	atomic.AddInt64(&h.peers.files, int64(u.ShareFiles))
+	if u.Share >= shareDiv {
+		atomic.AddInt64(&h.peers.sharers, 1)
+	}
+	cntShare.Add(float64(u.Share))
 }
 
-func (h *Hub) decShare(v uint64) {
-	atomic.AddInt64(&h.peers.share, -int64(v/shareDiv))
-	cntShare.Add(-float64(v))
+func (h *Hub) decShare(u *UserInfo) {
+	atomic.AddInt64(&h.peers.share, -int64(u.Share/shareDiv))
+	atomic.AddInt64(&h.peers.files, -int64(u.ShareFiles))
+	if u.Share >= shareDiv {
+		atomic.AddInt64(&h.peers.sharers, -1)
+	}
+	cntShare.Add(-float64(u.Share))
+}
+
+// updateShare recalculates hub totals when the user info changes.
+func (h *Hub) updateShare(old, cur *UserInfo) {
+	if old.Share == cur.Share && old.ShareFiles == cur.ShareFiles {
+		return
+	}
+	h.decShare(old)
+	h.incShare(cur)
+}
+
+// avgShare returns an average share size (in MB) of users that share files.
+// Users that share less than 1 MB are not counted, since they add nothing to the total.
+func (h *Hub) avgShare() uint64 {
+	n := atomic.LoadInt64(&h.peers.sharers)
+	if n <= 0 {
+		return 0
+	}
+	return uint64(atomic.LoadInt64(&h.peers.share) / n)
 }
 
 func (h *Hub) zlibLevel() int {
@@ -202,10 +432,16 @@ type Stats struct {
 	MaxUsers int         `json:"max-users,omitempty"`
 	Share    uint64      `json:"share"`               // MB
 	MaxShare uint64      `json:"max-share,omitempty"` // MB
+	Files    uint64      `json:"files,omitempty"`
+	AvgShare uint64      `json:"avg-share,omitempty"` // MB
 	Enc      string      `json:"encoding,omitempty"`
 	Soft     dc.Software `json:"soft"`
 	Uptime   uint64      `json:"uptime,omitempty"`
 	Keyprint string      `json:"-"`
+
+	PeakUsers int            `json:"peak-users,omitempty"`
+	Protocols map[string]int `json:"protocols,omitempty"` // users by protocol
+	Traffic   *TrafficStats  `json:"traffic,omitempty"`
 }
 
 func (st *Stats) DefaultAddr() string {
@@ -220,9 +456,7 @@ func (h *Hub) Uptime() time.Duration {
 }
 
 func (h *Hub) Stats() Stats {
-	h.peers.RLock()
-	users := len(h.peers.byName)
-	h.peers.RUnlock()
+	users := h.peers.index.Len()
 	h.conf.RLock()
 	st := Stats{
 		Name:     h.conf.Name,
@@ -233,10 +467,16 @@ func (h *Hub) Stats() Stats {
 		Icon:     "icon.png",
 		Users:    users,
 		Share:    uint64(atomic.LoadInt64(&h.peers.share)),
-		Enc:      "utf-8",
+		Files:    uint64(atomic.LoadInt64(&h.peers.files)),
+		AvgShare: h.avgShare(),
+		Enc:      h.nmdcEncodingName(),
 		Soft:     h.conf.Soft,
 		Keyprint: h.conf.Keyprint,
 		Uptime:   uint64(h.Uptime().Seconds()),
+
+		PeakUsers: int(atomic.LoadInt64(&h.stats.peak)),
+		Protocols: h.stats.protocols(),
+		Traffic:   h.stats.traffic(),
 	}
 	if h.conf.Addr != "" {
 		st.Addr = append(st.Addr, h.conf.Addr)
@@ -246,12 +486,6 @@ func (h *Hub) Stats() Stats {
 	return st
 }
 
-func (h *Hub) nextSID() SID {
-	// TODO: reuse SIDs
-	v := atomic.AddUint32(&h.lastSID, 1)
-	return sidFromInt(v)
-}
-
 func (h *Hub) HubUser() *Bot {
 	return h.hubUser
 }
@@ -350,7 +584,10 @@ func (h *Hub) ListenAndServe(addr string) error {
 			}
 		}
 	}()
+	atomic.AddInt32(&h.health.listeners, 1)
+	defer atomic.AddInt32(&h.health.listeners, -1)
 	for {
+		h.acceptDone()
 		conn, err := lis.Accept()
 		if err != nil {
 			if isTooManyFDs(err) {
@@ -358,6 +595,7 @@ func (h *Hub) ListenAndServe(addr string) error {
 			}
 			return err
 		}
+		h.acceptStarted()
 		remote := conn.RemoteAddr()
 		if h.IsHardBlocked(remote) {
 			_ = conn.Close()
@@ -391,10 +629,38 @@ func (h *Hub) Start() error {
 	if err := h.loadBans(); err != nil {
 		return err
 	}
+	if err := h.loadWatchlist(); err != nil {
+		return err
+	}
+	if err := h.loadRooms(); err != nil {
+		return err
+	}
 	if err := h.initPlugins(); err != nil {
 		return err
 	}
 	go h.bans.run(h.closed)
+	go h.stats.run(h.closed)
+	go h.runAnnouncer()
+	go h.runWatchdog()
+	if h.db != nil {
+		go h.runHistoryExpiry(h.conf.HistoryRetention)
+	}
+	if h.notifier != nil {
+		h.notifier.start(h.closed)
+	}
+	if h.searchSched != nil {
+		go h.searchSched.run(h.closed)
+	}
+	if h.reaper != nil {
+		go h.reaper.run(h.closed)
+	}
+	if h.matrix != nil {
+		go h.matrix.run(h.closed)
+	}
+	if h.xmpp != nil {
+		go h.xmpp.run(h.closed)
+	}
+	atomic.StoreInt32(&h.health.started, 1)
 	return nil
 }
 
@@ -405,6 +671,7 @@ func (h *Hub) Close() error {
 	default:
 		close(h.closed)
 	}
+	h.stopUserUpdates()
 	h.stopPlugins()
 	return nil
 }
@@ -413,10 +680,7 @@ type timeoutErr interface {
 	Timeout() bool
 }
 
-const (
-	peekTimeout  = 650 * time.Millisecond
-	writeTimeout = 10 * time.Second
-)
+const peekTimeout = 650 * time.Millisecond
 
 // serve automatically detects the protocol and start the hub-client handshake.
 func (h *Hub) serve(conn net.Conn, cinfo *ConnInfo) error {
@@ -511,9 +775,11 @@ func (h *Hub) Serve(conn net.Conn) error {
 		return nil
 	}
 	defer h.callOnDisconnected(conn)
-	return h.serve(conn, &ConnInfo{
-		Local:  conn.LocalAddr(),
-		Remote: conn.RemoteAddr(),
+	sconn, traffic := h.stats.wrapConn(conn)
+	return h.serve(h.wrapIdle(sconn), &ConnInfo{
+		Local:   conn.LocalAddr(),
+		Remote:  conn.RemoteAddr(),
+		traffic: traffic,
 	})
 }
 
@@ -543,46 +809,29 @@ func (h *Hub) listPeers() []Peer {
 	if l := h.cachedList(); l != nil {
 		return l
 	}
-	list := make([]Peer, 0, len(h.peers.byName))
-	for _, p := range h.peers.byName {
-		list = append(list, p)
-	}
+	list := h.peers.index.List()
 	h.cacheList(list)
 	return list
 }
 
 func (h *Hub) PeerByName(name string) Peer {
-	key := toNameKey(name)
-	h.peers.RLock()
-	p := h.peers.byName[key]
-	h.peers.RUnlock()
-	return p
+	key := h.toNameKey(name)
+	return h.peers.index.ByName(key)
 }
 
 func (h *Hub) peerBySID(sid SID) Peer {
-	h.peers.RLock()
-	p := h.peers.bySID[sid]
-	h.peers.RUnlock()
-	return p
+	return h.peers.index.BySID(sid)
 }
 
 // nameAvailable checks if a name can be bound. Returns false if a name is already in use.
-// The callback can be passed to be executed under peers read lock.
+// The callback can be passed to be executed under the read lock of the name shard.
 func (h *Hub) nameAvailable(name string, fnc func()) bool {
-	key := toNameKey(name)
-	h.peers.RLock()
-	_, sameName1 := h.peers.reserved[key]
-	_, sameName2 := h.peers.byName[key]
-	if fnc != nil {
-		fnc()
-	}
-	h.peers.RUnlock()
-	return !sameName1 && !sameName2
+	return h.peers.index.NameAvailable(h.toNameKey(name), fnc)
 }
 
 // reserveName bind a provided name or return false otherwise.
 //
-// A pair of callbacks can be passed to be executed under peers write lock.
+// A pair of callbacks can be passed to be executed under the write lock of the name shard.
 //
 // The first callback is executed when the name can be bound and can provide additional
 // checks or bind any other identifier. If callback returns false the name won't be bound
@@ -590,27 +839,12 @@ func (h *Hub) nameAvailable(name string, fnc func()) bool {
 //
 // The second callback is executed after the name is unbound.
 func (h *Hub) reserveName(name string, bind func() bool, unbind func()) (func(), bool) {
-	key := toNameKey(name)
-	h.peers.Lock()
-	_, sameName1 := h.peers.reserved[key]
-	_, sameName2 := h.peers.byName[key]
-	if sameName1 || sameName2 {
-		h.peers.Unlock()
-		return nil, false
-	}
-	if bind != nil && !bind() {
-		h.peers.Unlock()
+	key := h.toNameKey(name)
+	if !h.peers.index.Reserve(key, bind) {
 		return nil, false
 	}
-	h.peers.reserved[key] = struct{}{}
-	h.peers.Unlock()
 	return func() {
-		h.peers.Lock()
-		delete(h.peers.reserved, key)
-		if unbind != nil {
-			unbind()
-		}
-		h.peers.Unlock()
+		h.peers.index.Unreserve(key, unbind)
 	}, true
 }
 
@@ -622,31 +856,34 @@ func (h *Hub) acceptPeer(peer Peer, pre, post func()) {
 	sid := peer.SID()
 	u := peer.UserInfo()
 
-	key := toNameKey(u.Name)
+	key := h.toNameKey(u.Name)
 	h.peers.Lock()
-	defer h.peers.Unlock()
-	// cleanup temporary bindings
-	delete(h.peers.reserved, key)
-
 	if pre != nil {
 		pre()
 	}
 
-	// add user to the hub
-	h.peers.bySID[sid] = peer
-	h.peers.byName[key] = peer
+	// add user to the hub; this also removes the temporary name binding
+	h.peers.index.Add(key, sid, peer)
 	h.invalidateList()
 	h.globalChat.Join(peer)
 	cntPeers.Add(1)
-	h.incShare(u.Share)
+	h.stats.peerJoined(peer, h.peers.index.Len())
+	h.feed.emit(ChangeJoin, peer)
+	h.incShare(&u)
 
 	if post != nil {
 		post()
 	}
+	h.peers.Unlock()
+
+	h.historyJoin(peer)
+	if !h.watchJoin(peer) {
+		h.notifyJoin(peer)
+	}
 }
 
-func topicMsg(topic string) Message {
-	return Message{Text: "topic: " + topic, Me: true}
+func (h *Hub) topicMsg(peer Peer, topic string) Message {
+	return Message{Text: h.text(peer, TextTopic, textArgs{"Topic": topic}), Me: true}
 }
 
 func (h *Hub) broadcastTopic(topic string) {
@@ -654,7 +891,7 @@ func (h *Hub) broadcastTopic(topic string) {
 		if pt, ok := p2.(PeerTopic); ok {
 			_ = pt.Topic(topic)
 		} else {
-			_ = p2.HubChatMsg(topicMsg(topic))
+			_ = p2.HubChatMsg(h.topicMsg(p2, topic))
 		}
 	}
 }
@@ -671,10 +908,85 @@ func (h *Hub) broadcastUserJoin(peer Peer, notify []Peer) {
 }
 
 func (h *Hub) broadcastUserUpdate(peer Peer, notify []Peer) {
+	delay := h.conf.UpdateDelay
+	if delay <= 0 || notify != nil {
+		h.sendUserUpdate(peer, notify)
+		return
+	}
+	h.updates.Lock()
+	defer h.updates.Unlock()
+	if h.updates.closed {
+		return
+	}
+	if _, ok := h.updates.pending[peer]; ok {
+		// the update will be sent with the current info when the timer fires
+		cntInfoUpdatesCoalesced.Add(1)
+		return
+	}
+	if h.updates.pending == nil {
+		h.updates.pending = make(map[Peer]*time.Timer)
+	}
+	h.updates.pending[peer] = time.AfterFunc(delay, func() {
+		h.flushUserUpdate(peer)
+	})
+}
+
+// flushUserUpdate sends a delayed info update of the peer, if there is one.
+func (h *Hub) flushUserUpdate(peer Peer) {
+	h.updates.Lock()
+	t, ok := h.updates.pending[peer]
+	delete(h.updates.pending, peer)
+	h.updates.Unlock()
+	if !ok {
+		return
+	}
+	t.Stop()
+	if peer.Online() {
+		h.sendUserUpdate(peer, nil)
+	}
+}
+
+// flushUserUpdates sends all delayed info updates. It must be called before sending
+// the user list to a new peer, since the following updates only contain changed fields.
+func (h *Hub) flushUserUpdates() {
+	h.updates.Lock()
+	peers := make([]Peer, 0, len(h.updates.pending))
+	for p := range h.updates.pending {
+		peers = append(peers, p)
+	}
+	h.updates.Unlock()
+	for _, p := range peers {
+		h.flushUserUpdate(p)
+	}
+}
+
+// stopUserUpdates drops all delayed info updates when the hub is closed.
+func (h *Hub) stopUserUpdates() {
+	h.updates.Lock()
+	defer h.updates.Unlock()
+	h.updates.closed = true
+	for p, t := range h.updates.pending {
+		t.Stop()
+		delete(h.updates.pending, p)
+	}
+}
+
+func (h *Hub) sendUserUpdate(peer Peer, notify []Peer) {
+	// updates only carry the changed fields, thus concurrent updates
+	// of the same peer must be delivered in the same order to everyone
+	pb := peer.base()
+	pb.adcInfo.Lock()
+	defer pb.adcInfo.Unlock()
+
+	h.feed.emit(ChangeUpdate, peer)
 	if notify == nil {
 		notify = h.Peers()
 	}
 	e := &PeersUpdateEvent{Peers: []Peer{peer}}
+	if err := e.adcInfoUpdate(peer); err != nil {
+		log.Printf("%s: cannot encode info update: %v", peer.Name(), err)
+		return
+	}
 	for _, p2 := range notify {
 		_ = p2.PeersUpdate(e)
 	}
@@ -692,44 +1004,69 @@ func (h *Hub) broadcastUserLeave(peer Peer, notify []Peer) {
 }
 
 func (h *Hub) privateChat(from, to Peer, m Message) {
+	if err := h.checkRules(from); err != nil {
+		cntChatMsgDropped.Add(1)
+		_ = from.HubChatMsg(Message{Text: h.errText(from, err)})
+		return
+	}
+	if !to.Capabilities().Has(CapPrivate) {
+		cntChatMsgDropped.Add(1)
+		_ = from.HubChatMsg(Message{Text: h.text(from, TextPMUnsupported, textArgs{"Name": to.Name()})})
+		return
+	}
+	if h.isGagged(from) && !h.seesGagged(to) {
+		// shadow mute: pretend that the message was sent
+		cntChatMsgDropped.Add(1)
+		return
+	}
 	cntChatMsgPM.Add(1)
+	h.stats.message()
 	m.Time = time.Now().UTC()
 	_ = to.PrivateMsg(from, m)
-}
-
-func (h *Hub) sendMOTD(peer Peer) error {
-	return peer.HubChatMsg(Message{Text: h.getMOTD()})
+	h.forwardPM(from, to, m)
 }
 
 func (h *Hub) leave(peer Peer, sid SID, notify []Peer) {
-	key := toNameKey(peer.Name())
+	key := h.toNameKey(peer.Name())
 	h.peers.Lock()
-	delete(h.peers.byName, key)
-	delete(h.peers.bySID, sid)
+	h.peers.index.Remove(key, sid)
 	h.invalidateList()
+	peer.base().releaseSID()
 	if notify == nil {
 		notify = h.listPeers()
 	}
 	h.leaveRooms(peer)
+	h.feed.emit(ChangeLeave, peer)
 	h.peers.Unlock()
 	cntPeers.Add(-1)
-	h.decShare(peer.UserInfo().Share)
+	h.stats.peerLeft(peer)
+	u := peer.UserInfo()
+	h.decShare(&u)
+	h.userLoggedOut(peer)
+	h.historyLeave(peer)
+	h.sharedFilesLeave(peer)
 
 	h.broadcastUserLeave(peer, notify)
 }
 
 func (h *Hub) leaveCID(peer Peer, sid SID, cid CID) {
-	key := toNameKey(peer.Name())
+	key := h.toNameKey(peer.Name())
 	h.peers.Lock()
-	delete(h.peers.byName, key)
-	delete(h.peers.bySID, sid)
-	delete(h.peers.byCID, cid)
+	h.peers.index.Remove(key, sid)
+	h.peers.index.RemoveCID(cid)
 	h.invalidateList()
+	peer.base().releaseSID()
 	notify := h.listPeers()
 	h.leaveRooms(peer)
+	h.feed.emit(ChangeLeave, peer)
 	h.peers.Unlock()
 	cntPeers.Add(-1)
-	h.decShare(peer.UserInfo().Share)
+	h.stats.peerLeft(peer)
+	u := peer.UserInfo()
+	h.decShare(&u)
+	h.userLoggedOut(peer)
+	h.historyLeave(peer)
+	h.sharedFilesLeave(peer)
 
 	h.broadcastUserLeave(peer, notify)
 }
@@ -746,10 +1083,24 @@ func (h *Hub) leaveRooms(peer Peer) {
 }
 
 func (h *Hub) connectReq(from, to Peer, addr, token string, secure bool) {
+	if !to.Capabilities().Has(CapConnect) {
+		return
+	} else if h.checkExtensions(from) != nil {
+		return
+	} else if !h.authzConnect(from, to) {
+		return
+	}
 	_ = to.ConnectTo(from, addr, token, secure)
 }
 
 func (h *Hub) revConnectReq(from, to Peer, token string, secure bool) {
+	if !to.Capabilities().Has(CapConnect) {
+		return
+	} else if h.checkExtensions(from) != nil {
+		return
+	} else if !h.authzConnect(from, to) {
+		return
+	}
 	_ = to.RevConnectTo(from, token, secure)
 }
 
@@ -778,8 +1129,11 @@ type UserInfo struct {
 	HubsOperator   int
 	Slots          int
 	Share          uint64
+	ShareFiles     int
 	Email          string
 	IPv4           bool
 	IPv6           bool
 	TLS            bool
+	Away           bool
+	Passive        bool // cannot accept incoming connections
 }
@@ -1,13 +1,14 @@
 package hub
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +18,7 @@ import (
 	"github.com/direct-connect/go-dc/tiger"
 	"github.com/direct-connect/go-dcpp/adc"
 	"github.com/direct-connect/go-dcpp/adc/types"
+	"github.com/direct-connect/go-dcpp/capture"
 	"github.com/direct-connect/go-dcpp/internal/safe"
 )
 
@@ -30,14 +32,48 @@ func sidFromInt(v uint32) SID {
 	return types.SIDFromInt(v)
 }
 
-type adcPeers struct {
-	loggingCID map[adc.CID]struct{}
-	byCID      map[adc.CID]*adcPeer
+type adcState struct {
+	adcFea *adc.FeatureSet // ADC extensions supported by the hub
 }
 
 func (h *Hub) initADC() {
-	h.peers.loggingCID = make(map[adc.CID]struct{})
-	h.peers.byCID = make(map[adc.CID]*adcPeer)
+	h.adcFea = adc.NewFeatureSet(
+		// extensions
+		adc.FeaPING,
+		adc.FeaUCMD,
+		adc.FeaUCM0,
+	)
+	if h.conf.UserList.Delta {
+		h.adcFea.Add(adc.FeaDLTA)
+	}
+	if h.conf.UserList.Lazy {
+		h.adcFea.Add(adc.FeaLINF)
+	}
+	// should always be set for ADC
+	h.adcFea.Require(adc.FeaBASE, adc.FeaBAS0)
+	h.adcFea.Require(adc.FeaTIGR)
+	h.adcFea.Add(adc.FeaZLIF, h.adcActivateZlib)
+}
+
+// ADCFeatures returns a set of ADC extensions supported by the hub.
+//
+// Plugins may add new extensions to the set, or register handlers that are called when
+// the extension becomes active for the peer. The session argument of the handler is a Peer.
+func (h *Hub) ADCFeatures() *adc.FeatureSet {
+	return h.adcFea
+}
+
+func (h *Hub) adcActivateZlib(session interface{}) error {
+	peer := session.(*adcPeer)
+	lvl := h.zlibLevel()
+	if lvl == 0 || h.conf.UserList.ZlibBurst {
+		// compression is disabled, or only used for the user list
+		return nil
+	}
+	if err := peer.c.WriteInfoMsg(adc.ZOn{}); err != nil {
+		return err
+	}
+	return peer.c.ZOn(lvl)
 }
 
 func (h *Hub) ServeADC(conn net.Conn, cinfo *ConnInfo) error {
@@ -52,12 +88,24 @@ func (h *Hub) ServeADC(conn net.Conn, cinfo *ConnInfo) error {
 	}
 
 	log.Printf("%s: using ADC", conn.RemoteAddr())
+	if h.adcCanUpgrade(cinfo) {
+		cinfo.upgrade = &upgradeConn{Conn: conn}
+		conn = cinfo.upgrade
+	}
 	c, err := adc.NewConn(conn)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
-	c.SetWriteTimeout(writeTimeout)
+	if cinfo.upgrade != nil {
+		c.OnLineR(cinfo.upgrade.onLine)
+	}
+	if rec := h.startCapture(conn, capture.ProtoADC); rec != nil {
+		defer rec.Close()
+		c.OnLineR(rec.OnLineR)
+		c.OnLineW(rec.OnLineW)
+	}
+	c.SetWriteTimeout(h.conf.Timeouts.write())
 	c.OnLineR(func(line []byte) (bool, error) {
 		sizeADCLinesR.Observe(float64(len(line)))
 		if h.sampler.enabled() {
@@ -71,7 +119,9 @@ func (h *Hub) ServeADC(conn net.Conn, cinfo *ConnInfo) error {
 	})
 
 	peer, err := h.adcHandshake(c, cinfo)
-	if err != nil {
+	if err == errHybridDone {
+		return nil
+	} else if err != nil {
 		return err
 	}
 	defer peer.Close()
@@ -87,21 +137,30 @@ func (h *Hub) adcHandshake(c *adc.Conn, cinfo *ConnInfo) (*adcPeer, error) {
 	}
 	// connection is not yet valid and we haven't added the client to the hub yet
 	if err = h.adcStageIdentity(peer); err != nil {
+		h.abortPeer(peer)
 		return nil, err
 	}
 	// TODO: identify pingers
 	// peer registered, now we can start serving things
-	if err = peer.HubChatMsg(topicMsg(h.getTopic())); err != nil {
+	if err = peer.HubChatMsg(h.topicMsg(peer, h.getTopic())); err != nil {
 		_ = peer.Close()
 		return nil, err
 	}
-	if err = h.sendMOTD(peer); err != nil {
+	if err = h.sendWelcome(peer); err != nil {
 		_ = peer.Close()
 		return nil, err
 	}
+	if peer.restricted != nil {
+		err = peer.HubChatMsg(Message{Text: h.extText(peer, peer.restricted, TextExtRestricted)})
+		if err != nil {
+			_ = peer.Close()
+			return nil, err
+		}
+	}
 	if h.conf.ChatLogJoin != 0 {
 		h.globalChat.ReplayChat(peer, h.conf.ChatLogJoin)
 	}
+	h.autoJoinRooms(peer)
 	return peer, nil
 }
 
@@ -112,7 +171,9 @@ func (h *Hub) adcServePeer(peer *adcPeer) error {
 	// looks like we are disabling the timeout, but we are not
 	// the timeout will be set manually by the writer goroutine
 	peer.c.SetWriteTimeout(-1)
-	go peer.writer(writeTimeout)
+	peer.spawn(peer, func() {
+		peer.writer(h.conf.Timeouts.write())
+	})
 	for {
 		p, err := peer.c.ReadPacket(time.Time{})
 		if err == io.EOF {
@@ -124,11 +185,21 @@ func (h *Hub) adcServePeer(peer *adcPeer) error {
 			return err
 		}
 		if err = h.adcHandlePacket(peer, p); err != nil {
+			if e, ok := err.(adc.Error); ok {
+				_ = peer.sendErrorLast(e)
+			}
 			return err
 		}
 	}
 }
 
+// adcClientOnly is a set of commands that are only valid on client-client connections (C context).
+var adcClientOnly = map[adc.MsgType]bool{
+	(adc.GetInfoRequest{}).Cmd(): true,
+	(adc.GetRequest{}).Cmd():     true,
+	(adc.GetResponse{}).Cmd():    true,
+}
+
 func (h *Hub) adcHandlePacket(peer *adcPeer, p adc.Packet) error {
 	skind := string(p.Kind())
 	cntADCPackets.WithLabelValues(skind).Add(1)
@@ -138,32 +209,35 @@ func (h *Hub) adcHandlePacket(peer *adcPeer, p adc.Packet) error {
 	cntADCCommands.WithLabelValues(cmd).Add(1)
 	defer measure(durADCHandleCommand.WithLabelValues(cmd))()
 
+	if _, ok := p.(*adc.ClientPacket); !ok && adcClientOnly[p.Message().Type] {
+		// peers never expect these commands from the hub, so they are not relayed
+		return peer.SendADCInfo(adc.NewError(adc.Recoverable, adc.CodeProtocolGeneric, cmd+" is only valid between clients").Status)
+	}
+
 	switch p := p.(type) {
 	case *adc.BroadcastPacket:
-		if peer.sid != p.ID {
-			return errors.New("malformed broadcast")
+		if err := peer.checkSource(p.ID, "broadcast"); err != nil {
+			return err
+		}
+		if p.Name == (adc.User{}).Cmd() {
+			return h.adcUpdateInfo(peer, p)
 		}
 		h.adcBroadcast(p, peer)
 		return nil
 	case *adc.FeaturePacket:
-		if peer.sid != p.ID {
-			return errors.New("malformed features broadcast")
+		if err := peer.checkSource(p.ID, "features broadcast"); err != nil {
+			return err
 		}
-		// TODO: we ignore feature selectors for now
-		h.adcBroadcast(&adc.BroadcastPacket{BasePacket: p.BasePacket, ID: p.ID}, peer)
+		h.adcFeatureBroadcast(p, peer)
 		return nil
 	case *adc.EchoPacket:
-		if peer.sid != p.ID {
-			return errors.New("malformed echo packet")
-		}
-		if err := peer.SendADC(p); err != nil {
+		if err := peer.checkSource(p.ID, "echo packet"); err != nil {
 			return err
 		}
-		h.adcDirect((*adc.DirectPacket)(p), peer)
-		return nil
+		return h.adcEcho(p, peer)
 	case *adc.DirectPacket:
-		if peer.sid != p.ID {
-			return errors.New("malformed direct packet")
+		if err := peer.checkSource(p.ID, "direct packet"); err != nil {
+			return err
 		}
 		h.adcDirect(p, peer)
 		return nil
@@ -171,7 +245,7 @@ func (h *Hub) adcHandlePacket(peer *adcPeer, p adc.Packet) error {
 		h.adcHub(p, peer)
 		return nil
 	case *adc.ClientPacket, *adc.UDPPacket:
-		return errors.New("invalid packet kind")
+		return adc.ErrProtocol("invalid packet kind")
 	default:
 		data, _ := p.MarshalPacket()
 		log.Printf("%s: adc: %s", peer.RemoteAddr(), string(data))
@@ -180,7 +254,7 @@ func (h *Hub) adcHandlePacket(peer *adcPeer, p adc.Packet) error {
 }
 
 func (h *Hub) adcStageProtocol(c *adc.Conn, cinfo *ConnInfo) (*adcPeer, error) {
-	deadline := time.Now().Add(time.Second * 5)
+	deadline := h.handshakeDeadline()
 	// Expect features from the client
 	p, err := c.ReadPacket(deadline)
 	if err != nil {
@@ -202,72 +276,88 @@ func (h *Hub) adcStageProtocol(c *adc.Conn, cinfo *ConnInfo) (*adcPeer, error) {
 		}
 		cntADCExtensions.WithLabelValues(ext.String()).Add(1)
 	}
-	hubFeatures := adc.ModFeatures{
-		// should always be set for ADC
-		adc.FeaBASE: true,
-		adc.FeaBAS0: true,
-		adc.FeaTIGR: true,
-		// extensions
-		adc.FeaPING: true,
-		adc.FeaUCMD: true,
-		adc.FeaUCM0: true,
-		adc.FeaZLIF: true,
-	}
-
-	mutual := hubFeatures.Intersect(sup.Features)
-	if !mutual.IsSet(adc.FeaBASE) && !mutual.IsSet(adc.FeaBAS0) {
-		return nil, fmt.Errorf("client does not support BASE")
-	} else if !mutual.IsSet(adc.FeaTIGR) {
-		return nil, fmt.Errorf("client does not support TIGR")
-	}
-
-	if lvl := h.zlibLevel(); lvl != 0 && mutual.IsSet(adc.FeaZLIF) {
-		err = c.WriteInfoMsg(adc.ZOn{})
-		if err != nil {
-			return nil, err
+	mutual, err := h.adcFea.Negotiate(sup.Features)
+	if err != nil {
+		e := adc.ErrFeatureMissing(err.Error())
+		if err2 := c.WriteInfoMsg(e.Status); err2 == nil {
+			_ = c.Flush()
 		}
-		err = c.ZOn(lvl)
-		if err != nil {
-			return nil, err
+		return nil, e
+	}
+	secure := cinfo != nil && cinfo.Secure
+	// the client asks to switch to TLS
+	upgrade := !secure && cinfo != nil && cinfo.upgrade != nil && sup.Features.IsSet(adc.FeaADCS)
+	reject, restrict := h.missingExtensions(sup.Features, secure || upgrade)
+	if reject != nil {
+		e := adc.ErrFeatureMissing(h.extText(nil, reject, TextExtRequired))
+		if err2 := c.WriteInfoMsg(e.Status); err2 == nil {
+			_ = c.Flush()
 		}
+		return nil, e
 	}
 
 	// send features supported by the hub
+	features := h.adcFea.Features()
+	if upgrade {
+		features[adc.FeaADCS] = true
+	}
 	err = c.WriteInfoMsg(adc.Supported{
-		Features: hubFeatures,
+		Features: features,
 	})
+	if err == nil && upgrade {
+		err = h.adcUpgradeTLS(c, cinfo, deadline)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	peer := newADC(h, cinfo, c, mutual)
+	peer, err := newADC(h, cinfo, c, mutual)
+	if err != nil {
+		e := adc.ErrHubFull(h.text(nil, TextHubFull, nil))
+		if err2 := c.WriteInfoMsg(e.Status); err2 == nil {
+			_ = c.Flush()
+		}
+		return nil, e
+	}
+	peer.restricted = restrict
 
 	err = c.WriteInfoMsg(adc.SIDAssign{
 		SID: peer.SID(),
 	})
-	if err != nil {
-		return nil, err
+	if err == nil {
+		err = h.adcFea.Activate(mutual, peer)
+	}
+	if err == nil {
+		err = c.Flush()
 	}
-	err = c.Flush()
 	if err != nil {
+		peer.releaseSID()
 		return nil, err
 	}
 	return peer, nil
 }
 
 func (h *Hub) adcStageIdentity(peer *adcPeer) error {
-	deadline := time.Now().Add(time.Second * 5)
+	deadline := h.handshakeDeadline()
 	// client should send INF with ID and PID set
 	p, err := peer.c.ReadPacket(deadline)
 	if err != nil {
 		return err
 	}
+	if hp, ok := p.(*adc.HubPacket); ok && hp.Name == (adc.HybridBridge{}).Cmd() && h.conf.Hybrid.enabled() {
+		// secondary connection to validate the address
+		return h.adcHybridConn(peer, hp)
+	}
 	b, ok := p.(*adc.BroadcastPacket)
 	if !ok {
 		return fmt.Errorf("expected user info broadcast, got %#v", p)
 	} else if b.Name != (adc.User{}).Cmd() {
 		return fmt.Errorf("expected user info message, got %v", b.Name)
 	}
+	if err := peer.checkSource(b.ID, "user info"); err != nil {
+		_ = peer.sendErrorNow(err.(adc.Error))
+		return err
+	}
 	var u adc.User
 	if err := adc.Unmarshal(b.Data, &u); err != nil {
 		return err
@@ -277,64 +367,87 @@ func (h *Hub) adcStageIdentity(peer *adcPeer) error {
 	for _, ext := range u.Features {
 		cntADCExtensions.WithLabelValues(ext.String()).Add(1)
 	}
-	if u.Id != u.Pid.Hash() {
-		err = errors.New("invalid pid supplied")
-		_ = peer.sendErrorNow(adc.Fatal, 27, err)
-		return err
+	if err := u.Id.Validate(); err != nil {
+		e := adc.ErrBadINF(err.Error())
+		_ = peer.sendErrorNow(e)
+		return e
+	}
+	if u.Pid == nil || !types.VerifyPID(*u.Pid, u.Id) {
+		e := adc.ErrInvalidPID("invalid pid supplied")
+		_ = peer.sendErrorNow(e)
+		return e
 	}
 	u.Pid = nil
+	listVersion := u.ListVersion
+	u.ListVersion = ""
 
-	err = h.validateUserName(u.Name)
-	if err != nil {
-		_ = peer.sendErrorNow(adc.Fatal, 21, err)
+	err = h.validatePeerName(u.Name)
+	if err == errNameReserved {
+		_ = peer.sendErrorNow(adc.ErrRegisteredOnly(h.errText(peer, err)))
+		return err
+	} else if err != nil {
+		_ = peer.sendErrorNow(adc.ErrNickInvalid(err.Error()))
+		return err
+	}
+
+	// authenticate the user before applying the multi-login policy,
+	// otherwise anyone could drop the session of a registered user
+	peer.setName(u.Name)
+	peer.info.cid = u.Id
+	if err := h.adcStageVerify(peer); err != nil {
+		return err
+	}
+
+	if err = h.checkMultiLogin(u.Name, peer.RemoteAddr(), &u.Id); err != nil {
+		_ = peer.sendErrorNow(adc.ErrLogin(err.Error()))
 		return err
 	}
 
 	// do not lock for writes first
 	sameCID := false
 	sameName := !h.nameAvailable(u.Name, func() {
-		_, sameCID1 := h.peers.loggingCID[u.Id]
-		_, sameCID2 := h.peers.byCID[u.Id]
-		sameCID = sameCID1 || sameCID2
+		sameCID = !h.peers.index.CIDAvailable(u.Id)
 	})
 
 	if sameName {
-		err = errNickTaken
-		_ = peer.sendErrorNow(adc.Fatal, 22, err)
-		return err
+		e := adc.ErrNickTaken(h.errText(peer, errNickTaken))
+		_ = peer.sendErrorNow(e)
+		return e
 	}
 	if sameCID {
-		err = errors.New("CID taken")
-		_ = peer.sendErrorNow(adc.Fatal, 24, err)
-		return err
+		e := adc.ErrCIDTaken("")
+		_ = peer.sendErrorNow(e)
+		return e
 	}
 
 	// ok, now lock for writes and try to bind nick and CID
 	// still, no one will see the user yet
 	unbind, ok := h.reserveName(u.Name, func() bool {
-		_, sameCID1 := h.peers.loggingCID[u.Id]
-		_, sameCID2 := h.peers.byCID[u.Id]
-		if sameCID1 || sameCID2 {
+		if !h.peers.index.ReserveCID(u.Id) {
 			sameCID = true
 			return false
 		}
-		h.peers.loggingCID[u.Id] = struct{}{}
 		return true
 	}, func() {
-		delete(h.peers.loggingCID, u.Id)
+		h.peers.index.UnreserveCID(u.Id)
 	})
 	if !ok {
 		if sameCID {
-			err = errors.New("CID taken")
-			_ = peer.sendErrorNow(adc.Fatal, 24, err)
-			return err
+			e := adc.ErrCIDTaken("")
+			_ = peer.sendErrorNow(e)
+			return e
 		}
-		err = errNickTaken
-		_ = peer.sendErrorNow(adc.Fatal, 22, err)
-		return err
+		e := adc.ErrNickTaken(h.errText(peer, errNickTaken))
+		_ = peer.sendErrorNow(e)
+		return e
 	}
 
+	if err = h.adcStageHybrid(peer, &u); err != nil {
+		unbind()
+		return err
+	}
 	if u.Ip4 == "0.0.0.0" {
+		u.Ip4 = ""
 		if t, ok := peer.RemoteAddr().(*net.TCPAddr); ok {
 			if ip4 := t.IP.To4(); ip4 != nil {
 				u.Ip4 = ip4.String()
@@ -342,33 +455,42 @@ func (h *Hub) adcStageIdentity(peer *adcPeer) error {
 		}
 	}
 	if u.Ip6 == "::" {
-		if t, ok := peer.RemoteAddr().(*net.TCPAddr); ok {
-			if ip6 := t.IP.To16(); ip6 != nil {
-				u.Ip6 = ip6.String()
-			}
+		u.Ip6 = ""
+		if t, ok := peer.RemoteAddr().(*net.TCPAddr); ok && t.IP.To4() == nil {
+			u.Ip6 = t.IP.String()
 		}
 	}
+	peer.hideUnreachableUDP(&u)
 	u.Normalize()
 	peer.setName(u.Name)
 	peer.info.cid = u.Id
 	peer.info.user = u
 
-	st := h.Stats()
-	if err := h.adcStageVerify(peer); err != nil {
+	if !h.authzJoin(peer) {
 		unbind()
-		return err
+		return errAccessDenied
 	}
-	deadline = time.Now().Add(time.Second * 5)
+
+	st := h.Stats()
+	deadline = h.handshakeDeadline()
 
 	// send hub info
-	err = peer.c.WriteInfoMsg(adc.HubInfo{
+	hinfo := adc.HubInfo{
 		Name:        st.Name,
 		Desc:        st.Desc,
 		Application: st.Soft.Name,
 		Version:     st.Soft.Version,
 		Address:     st.DefaultAddr(),
 		Users:       st.Users,
-	})
+	}
+	if peer.fea.IsSet(adc.FeaPING) {
+		hinfo.Website = st.Website
+		hinfo.Owner = st.Owner
+		hinfo.Share = int(st.Share * shareDiv)
+		hinfo.Files = int(st.Files)
+		hinfo.Uptime = int(st.Uptime)
+	}
+	err = peer.c.WriteInfoMsg(hinfo)
 	if err != nil {
 		unbind()
 		return err
@@ -380,8 +502,24 @@ func (h *Hub) adcStageIdentity(peer *adcPeer) error {
 		Msg:  h.poweredBy(),
 	})
 
+	// compress the user list, if the session is not compressed already
+	lvl := h.zlibLevel()
+	burst := lvl != 0 && h.conf.UserList.ZlibBurst && peer.fea.IsSet(adc.FeaZLIF)
+	if burst {
+		err = peer.c.WriteInfoMsg(adc.ZOn{})
+		if err == nil {
+			err = peer.c.ZOn(lvl)
+		}
+		if err != nil {
+			unbind()
+			return err
+		}
+		cntUserListZlib.Add(1)
+	}
+
 	// send user list (except his own info)
-	err = peer.peersJoin(&PeersJoinEvent{Peers: h.Peers()}, true)
+	h.flushUserUpdates()
+	err = h.adcSendUserList(peer, listVersion)
 	if err != nil {
 		unbind()
 		return err
@@ -393,6 +531,13 @@ func (h *Hub) adcStageIdentity(peer *adcPeer) error {
 		unbind()
 		return err
 	}
+	if burst {
+		err = peer.c.ZOff()
+		if err != nil {
+			unbind()
+			return err
+		}
+	}
 
 	if peer.fea.IsSet(adc.FeaUCMD) || peer.fea.IsSet(adc.FeaUCM0) {
 		err = h.adcSendUserCommand(peer)
@@ -405,8 +550,7 @@ func (h *Hub) adcStageIdentity(peer *adcPeer) error {
 	var list []Peer
 	// finally accept the user on the hub
 	h.acceptPeer(peer, func() {
-		delete(h.peers.loggingCID, u.Id)
-		h.peers.byCID[u.Id] = peer
+		h.peers.index.AddCID(u.Id, peer)
 		// make a snapshot of peers to send info to
 		list = h.listPeers()
 	}, nil)
@@ -416,13 +560,19 @@ func (h *Hub) adcStageIdentity(peer *adcPeer) error {
 }
 
 func (h *Hub) adcStageVerify(peer *adcPeer) error {
-	user, rec, err := h.getUser(peer.Name())
+	prov, rec, err := h.findUser(peer.Name())
 	if err != nil {
 		return err
-	} else if user == nil || rec == nil {
+	} else if prov == nil {
 		return nil
+	} else if rec == nil {
+		// ADC clients only send a salted hash, while the provider needs the password itself
+		e := adc.ErrBadPassword(h.text(peer, TextAuthUnsupported, nil))
+		_ = peer.sendErrorNow(e)
+		return e
 	}
 	if c := peer.ConnInfo(); c != nil && !c.Secure {
+		_ = peer.sendErrorNow(adc.ErrLogin(h.errText(peer, errConnInsecure)))
 		return errConnInsecure
 	}
 	// give the user a minute to enter a password
@@ -459,18 +609,16 @@ func (h *Hub) adcStageVerify(peer *adcPeer) error {
 	if err != nil {
 		return err
 	} else if !ok {
-		err = errors.New("wrong password")
-		_ = peer.sendErrorNow(adc.Fatal, 23, err)
-		return err
+		e := adc.ErrBadPassword(h.text(peer, TextBadPassword, nil))
+		_ = peer.sendErrorNow(e)
+		return e
 	}
-	peer.setUser(user)
+	peer.setUser(h.newAuthUser(peer.Name(), rec.Profile))
+	h.userLoggedIn(peer)
 	return nil
 }
 
 func (h *Hub) adcCheckUserPass(rec *UserRecord, salt []byte, hash tiger.Hash) (bool, error) {
-	if h.db == nil {
-		return false, nil
-	}
 	check := make([]byte, len(rec.Pass)+len(salt))
 	i := copy(check, rec.Pass)
 	copy(check[i:], salt)
@@ -492,6 +640,10 @@ func (h *Hub) adcHub(p *adc.HubPacket, from Peer) {
 			return
 		}
 		// ignore
+	case adc.UserInfoRequest:
+		if p, ok := from.(*adcPeer); ok {
+			_ = h.adcUserInfoRequest(p, msg)
+		}
 	default:
 		// TODO: decode other packets
 	}
@@ -518,6 +670,36 @@ func (h *Hub) adcSendUserCommand(peer *adcPeer) error {
 	return nil
 }
 
+// adcUpdateInfo applies a partial INF update sent by the peer and notifies other peers.
+func (h *Hub) adcUpdateInfo(peer *adcPeer, p *adc.BroadcastPacket) error {
+	old := peer.UserInfo()
+	peer.info.Lock()
+	u := peer.info.user
+	if err := adc.Unmarshal(p.Data, &u); err != nil {
+		peer.info.Unlock()
+		return err
+	}
+	// PID is only sent once and should never be broadcasted
+	u.Pid = nil
+	if u.Id != peer.info.user.Id {
+		peer.info.Unlock()
+		return adc.ErrBadINF("changing CID is not allowed")
+	} else if u.Name != peer.info.user.Name {
+		// TODO: support nick changes
+		peer.info.Unlock()
+		return adc.ErrBadINF("changing nick is not allowed")
+	}
+	peer.hideUnreachableUDP(&u)
+	u.Normalize()
+	peer.info.user = u
+	peer.info.Unlock()
+
+	cur := peer.UserInfo()
+	h.updateShare(&old, &cur)
+	h.broadcastUserUpdate(peer, nil)
+	return nil
+}
+
 func (h *Hub) adcBroadcast(p *adc.BroadcastPacket, from *adcPeer) {
 	msg, err := p.Decode()
 	if err != nil {
@@ -538,6 +720,9 @@ func (h *Hub) adcBroadcast(p *adc.BroadcastPacket, from *adcPeer) {
 		})
 	case adc.SearchRequest:
 		h.adcHandleSearch(from, &msg, nil)
+	case adc.SearchResult:
+		// results must be addressed to the searcher
+		cntSearchResultsDropped.Add(1)
 	default:
 		// TODO: decode other packets
 		for _, peer := range h.Peers() {
@@ -548,6 +733,76 @@ func (h *Hub) adcBroadcast(p *adc.BroadcastPacket, from *adcPeer) {
 	}
 }
 
+// adcFeatureMatch checks if the peer matches feature selectors of the F-type packet.
+// Non-ADC peers are considered to have no ADC features.
+func adcFeatureMatch(p Peer, sel map[adc.Feature]bool) bool {
+	isADC := PeerProtocol(p) == ProtoADC
+	for f, required := range sel {
+		has := isADC && p.HasFeature(f.String())
+		if has != required {
+			return false
+		}
+	}
+	return true
+}
+
+// adcFeatureBroadcast delivers the F-type packet only to peers that match its feature selectors.
+// Chat messages are converted for non-ADC peers, the same way as for B-type packets.
+func (h *Hub) adcFeatureBroadcast(p *adc.FeaturePacket, from *adcPeer) {
+	msg, err := p.Decode()
+	if err != nil {
+		log.Printf("cannot parse ADC message: %v", err)
+		return
+	}
+	all := h.Peers()
+	peers := make([]Peer, 0, len(all))
+	for _, peer := range all {
+		if adcFeatureMatch(peer, p.Features) {
+			peers = append(peers, peer)
+		}
+	}
+	switch msg := msg.(type) {
+	case adc.ChatMessage:
+		if h.isCommand(from, msg.Text) {
+			return
+		}
+		h.globalChat.sendChat(from, Message{
+			Text: msg.Text,
+			Me:   msg.Me,
+		}, func(peer Peer) bool {
+			return adcFeatureMatch(peer, p.Features)
+		})
+	case adc.SearchRequest:
+		h.adcHandleSearch(from, &msg, peers)
+	case adc.SearchResult:
+		// results must be addressed to the searcher
+		cntSearchResultsDropped.Add(1)
+	default:
+		// deliver as a regular broadcast; the selectors were already applied
+		bp := &adc.BroadcastPacket{BasePacket: p.BasePacket, ID: p.ID}
+		for _, peer := range peers {
+			if p2, ok := peer.(*adcPeer); ok {
+				_ = p2.SendADC(bp)
+			}
+		}
+	}
+}
+
+// adcEcho delivers the packet to the target and echoes it back to the sender.
+//
+// The packet is echoed unchanged, with both source and target SIDs, and only if the target exists.
+// Rooms already deliver messages to all members, including the sender, so they are never echoed.
+func (h *Hub) adcEcho(p *adc.EchoPacket, from *adcPeer) error {
+	if h.peerBySID(p.Targ) == nil {
+		if h.roomBySID(p.Targ) != nil {
+			h.adcDirect((*adc.DirectPacket)(p), from)
+		}
+		return nil
+	}
+	h.adcDirect((*adc.DirectPacket)(p), from)
+	return from.SendADC(p)
+}
+
 func (h *Hub) adcDirect(p *adc.DirectPacket, from *adcPeer) {
 	// TODO: disallow INF, STA and some others
 	peer := h.peerBySID(p.Targ)
@@ -608,6 +863,7 @@ func (h *Hub) adcDirect(p *adc.DirectPacket, from *adcPeer) {
 }
 
 func (h *Hub) adcHandleSearch(peer *adcPeer, req *adc.SearchRequest, peers []Peer) {
+	peer.expectResults(req.Token)
 	s := peer.newSearch(req.Token)
 	if req.TTH != nil {
 		// ignore other parameters
@@ -622,7 +878,8 @@ func (h *Hub) adcHandleSearch(peer *adcPeer, req *adc.SearchRequest, peers []Pee
 	if req.Type == adc.FileTypeFile ||
 		req.Eq != 0 || req.Le != 0 || req.Ge != 0 ||
 		len(req.Ext) != 0 || len(req.NoExt) != 0 ||
-		req.Group != adc.ExtNone {
+		req.Group != adc.ExtNone ||
+		req.MinDate != 0 || req.MaxDate != 0 {
 		freq := FileSearch{
 			NameSearch: name,
 			MinSize:    uint64(req.Ge),
@@ -634,7 +891,14 @@ func (h *Hub) adcHandleSearch(peer *adcPeer, req *adc.SearchRequest, peers []Pee
 			freq.MinSize = uint64(req.Eq)
 			freq.MaxSize = uint64(req.Eq)
 		}
+		if req.MinDate != 0 {
+			freq.MinDate = time.Unix(req.MinDate, 0)
+		}
+		if req.MaxDate != 0 {
+			freq.MaxDate = time.Unix(req.MaxDate, 0)
+		}
 		switch req.Group {
+		case adc.ExtNone:
 		case adc.ExtAudio:
 			freq.FileType = FileTypeAudio
 		case adc.ExtArch:
@@ -647,30 +911,41 @@ func (h *Hub) adcHandleSearch(peer *adcPeer, req *adc.SearchRequest, peers []Pee
 			freq.FileType = FileTypePicture
 		case adc.ExtVideo:
 			freq.FileType = FileTypeVideo
+		default:
+			// multiple groups cannot be expressed with a single file type
+			exp := req.ExpandGroups()
+			freq.Ext, freq.NoExt = exp.Ext, nil
 		}
 		sr = freq
 	}
 	h.Search(sr, s, peers)
 }
 
+// adcHandleResult relays a search result (DRES) sent through the hub.
+//
+// Results are only relayed to peers that sent a search with the same token. This is the only
+// way for passive peers to receive results, since they cannot receive them via UDP.
+// The source of the result is always set to the sender, as checked by adcHandlePacket.
 func (h *Hub) adcHandleResult(peer *adcPeer, to Peer, res *adc.SearchResult) {
 	if to, ok := to.(*adcPeer); ok {
-		_ = to.SendADCDirect(peer.SID(), *res)
+		if !to.expectsResult(res.Token) {
+			cntSearchResultsDropped.Add(1)
+			return
+		}
+		if to.SendADCDirect(peer.SID(), *res) == nil {
+			cntSearchResultsRelayed.Add(1)
+		}
 		return
 	}
 	peer.search.RLock()
 	s := peer.search.tokens[res.Token]
 	peer.search.RUnlock()
 	if s == nil {
+		cntSearchResultsDropped.Add(1)
 		return
 	}
-	res.Path = strings.TrimPrefix(res.Path, "/")
-	var sr SearchResult
-	if res.TTH != nil {
-		sr = File{Peer: peer, Path: res.Path, Size: uint64(res.Size), TTH: res.TTH}
-	} else {
-		sr = Dir{Peer: peer, Path: res.Path}
-	}
+	cntSearchResultsBridged.Add(1)
+	sr := adcToResult(peer, res)
 	if err := s.s.SendResult(sr); err != nil {
 		_ = s.s.Close()
 		peer.search.Lock()
@@ -683,7 +958,7 @@ func (h *Hub) adcHandleResult(peer *adcPeer, to Peer, res *adc.SearchResult) {
 
 var _ Peer = (*adcPeer)(nil)
 
-func newADC(h *Hub, cinfo *ConnInfo, c *adc.Conn, fea adc.ModFeatures) *adcPeer {
+func newADC(h *Hub, cinfo *ConnInfo, c *adc.Conn, fea adc.ModFeatures) (*adcPeer, error) {
 	if cinfo == nil {
 		cinfo = &ConnInfo{Local: c.LocalAddr(), Remote: c.RemoteAddr()}
 	}
@@ -691,9 +966,12 @@ func newADC(h *Hub, cinfo *ConnInfo, c *adc.Conn, fea adc.ModFeatures) *adcPeer
 		c:   c,
 		fea: fea,
 	}
-	h.newBasePeer(&peer.BasePeer, cinfo)
+	if err := h.newBasePeer(&peer.BasePeer, cinfo); err != nil {
+		return nil, err
+	}
 	peer.write.wake = make(chan struct{}, 1)
-	return peer
+	peer.write.ping = make(chan struct{}, 1)
+	return peer, nil
 }
 
 type adcPeer struct {
@@ -704,6 +982,10 @@ type adcPeer struct {
 
 	write struct {
 		wake chan struct{}
+		// ping requests an immediate keepalive, see idleReaper
+		ping chan struct{}
+		// conn serializes writes of the writer with sendErrorLast
+		conn sync.Mutex
 		sync.Mutex
 		buf []adc.Packet
 	}
@@ -718,13 +1000,48 @@ type adcPeer struct {
 		sync.RWMutex
 		tokens map[string]*adcSearchToken
 	}
+
+	// tokens of searches sent by the peer; only results for these searches are relayed to it
+	results struct {
+		sync.Mutex
+		tokens map[string]time.Time
+	}
 }
 
-func (p *adcPeer) Searchable() bool {
+// HasFeature checks if an ADC extension is active for the peer,
+// either negotiated in SUP or advertised in the SU field of INF.
+func (p *adcPeer) HasFeature(name string) bool {
+	if len(name) != 4 {
+		return false
+	}
+	var f adc.Feature
+	copy(f[:], name)
+	if p.fea.IsSet(f) {
+		return true
+	}
+	p.info.RLock()
+	defer p.info.RUnlock()
+	return p.info.user.Features.Has(f)
+}
+
+func (p *adcPeer) protocol() string {
+	return ProtoADC
+}
+
+// CID implements Peer.
+func (p *adcPeer) CID() CID {
+	return p.info.cid
+}
+
+func (p *adcPeer) Capabilities() PeerCaps {
+	caps := CapConnect | CapRooms | CapPrivate
 	p.info.RLock()
 	share := p.info.user.ShareSize
 	p.info.RUnlock()
-	return share > 0
+	if share > 0 {
+		caps |= CapSearch
+	}
+	return caps
 }
 
 type adcSearchToken struct {
@@ -762,13 +1079,22 @@ func (p *adcPeer) Info() adc.User {
 	return u
 }
 
+// Locale returns the preferred locale of the user, as set by the LC field of INF.
+func (p *adcPeer) Locale() string {
+	p.info.RLock()
+	loc := p.info.user.Locale
+	p.info.RUnlock()
+	return loc
+}
+
 func (p *adcPeer) UserInfo() UserInfo {
 	u := p.Info()
 	return UserInfo{
-		Name:  u.Name,
-		Share: uint64(u.ShareSize),
-		Email: u.Email,
-		Desc:  u.Desc,
+		Name:       u.Name,
+		Share:      uint64(u.ShareSize),
+		ShareFiles: u.ShareFiles,
+		Email:      u.Email,
+		Desc:       u.Desc,
 		App: dc.Software{
 			Name:    u.Application,
 			Version: u.Version,
@@ -777,14 +1103,16 @@ func (p *adcPeer) UserInfo() UserInfo {
 		HubsRegistered: u.HubsRegistered,
 		HubsOperator:   u.HubsOperator,
 		Slots:          u.Slots,
-		IPv4:           u.Features.Has(adc.FeaTCP4),
-		IPv6:           u.Features.Has(adc.FeaTCP6),
+		IPv4:           u.Ip4 != "" || u.Features.Has(adc.FeaTCP4),
+		IPv6:           u.Ip6 != "" || u.Features.Has(adc.FeaTCP6),
 		TLS:            u.Features.Has(adc.FeaADC0),
+		Away:           u.Away != adc.AwayTypeNone,
+		Passive:        !u.Features.Has(adc.FeaTCP4) && !u.Features.Has(adc.FeaTCP6),
 	}
 }
 
+// writer sends queued messages to the connection. It runs as a background task of the peer, see spawn.
 func (p *adcPeer) writer(timeout time.Duration) {
-	defer p.Close()
 	ticker := time.NewTicker(time.Minute / 2)
 	defer ticker.Stop()
 
@@ -796,6 +1124,11 @@ func (p *adcPeer) writer(timeout time.Duration) {
 			return
 		case <-ticker.C:
 			// keep alive
+			p.write.conn.Lock()
+			_ = p.c.SetWriteDeadline(time.Now().Add(timeout))
+			err = p.c.WriteKeepAlive()
+		case <-p.write.ping:
+			p.write.conn.Lock()
 			_ = p.c.SetWriteDeadline(time.Now().Add(timeout))
 			err = p.c.WriteKeepAlive()
 		case <-p.write.wake:
@@ -807,6 +1140,7 @@ func (p *adcPeer) writer(timeout time.Duration) {
 				buf2 = buf[:0]
 				continue
 			}
+			p.write.conn.Lock()
 			_ = p.c.SetWriteDeadline(time.Now().Add(timeout))
 			for i, m := range buf {
 				err = p.c.WritePacket(m)
@@ -821,6 +1155,7 @@ func (p *adcPeer) writer(timeout time.Duration) {
 			err = p.c.Flush()
 		}
 		_ = p.c.SetWriteDeadline(time.Time{})
+		p.write.conn.Unlock()
 		if err != nil {
 			if p.Online() {
 				log.Printf("%s: write: %v", p.c.RemoteAddr(), err)
@@ -888,10 +1223,26 @@ func (p *adcPeer) sendInfoNow(m adc.Message) error {
 	return p.c.Flush()
 }
 
-func (p *adcPeer) sendErrorNow(sev adc.Severity, code int, err error) error {
-	return p.sendInfoNow(adc.Status{
-		Sev: sev, Code: code, Msg: err.Error(),
-	})
+// checkSource verifies that the source SID of the packet matches the SID of the peer.
+// Spoofed packets are rejected with a protocol error, which is sent to the peer by adcServePeer.
+func (p *adcPeer) checkSource(id adc.SID, kind string) error {
+	if p.sid == id {
+		return nil
+	}
+	return adc.ErrProtocol(fmt.Sprintf("malformed %s: source SID %v doesn't match %v", kind, id, p.sid))
+}
+
+func (p *adcPeer) sendErrorNow(e adc.Error) error {
+	return p.sendInfoNow(e.Status)
+}
+
+// sendErrorLast sends the error to the peer before disconnecting it.
+// Unlike sendErrorNow, it's safe to call while the writer is running.
+func (p *adcPeer) sendErrorLast(e adc.Error) error {
+	p.write.conn.Lock()
+	defer p.write.conn.Unlock()
+	_ = p.c.SetWriteDeadline(time.Now().Add(p.hub.conf.Timeouts.write()))
+	return p.sendErrorNow(e)
 }
 
 func (p *adcPeer) Close() error {
@@ -909,7 +1260,6 @@ func (p *adcPeer) PeersJoin(e *PeersJoinEvent) error {
 }
 
 func (p *adcPeer) PeersUpdate(e *PeersUpdateEvent) error {
-	// TODO: diff infos
 	return p.peersUpdate(e)
 }
 
@@ -924,13 +1274,21 @@ func (u UserInfo) toADC(cid CID, user *User) adc.User {
 		HubsOperator:   u.HubsOperator,
 		Slots:          u.Slots,
 		ShareSize:      int64(u.Share),
+		ShareFiles:     u.ShareFiles,
 		Email:          u.Email,
 		Desc:           u.Desc,
 	}
 	adcUserType(&out, user, &u)
+	if u.Away {
+		out.Away = adc.AwayTypeNormal
+	}
 	if u.TLS {
 		out.Features = append(out.Features, adc.FeaADC0)
 	}
+	if u.Passive {
+		// TCP4 and TCP6 mean that the user accepts incoming connections
+		return out
+	}
 	if u.IPv4 {
 		out.Features = append(out.Features, adc.FeaTCP4)
 	}
@@ -940,17 +1298,143 @@ func (u UserInfo) toADC(cid CID, user *User) adc.User {
 	return out
 }
 
+// hideUnreachableUDP removes the UDP port advertised by a peer behind NAT.
+//
+// If the IPv4 address in INF doesn't match the address of the connection, search results
+// sent via UDP won't reach the peer. Without the port, other clients consider the peer
+// passive and send results through the hub instead.
+func (p *adcPeer) hideUnreachableUDP(u *adc.User) {
+	if u.Udp4 == 0 && !u.Features.Has(adc.FeaUDP4) {
+		return
+	}
+	t, ok := p.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	ip4 := t.IP.To4()
+	if ip4 == nil || u.Ip4 == "" || u.Ip4 == ip4.String() {
+		return
+	}
+	u.Udp4 = 0
+	fea := make(adc.ExtFeatures, 0, len(u.Features))
+	for _, f := range u.Features {
+		if f != adc.FeaUDP4 {
+			fea = append(fea, f)
+		}
+	}
+	u.Features = fea
+}
+
 func (p *adcPeer) fixUserInfo(u *adc.User) {
-	if u.Application != "" && p.Info().Application == "" {
-		// doesn't support AP field
+	p.infoVariant().fix(u)
+}
+
+// adcInfoVariant is a variant of INF encoding that depends on the receiving peer.
+type adcInfoVariant int
+
+const (
+	adcInfoNormal = adcInfoVariant(iota)
+	adcInfoNoAP   // client doesn't support AP field
+)
+
+func (v adcInfoVariant) fix(u *adc.User) {
+	if v == adcInfoNoAP && u.Application != "" {
 		u.Application, u.Version = "", u.Application+" "+u.Version
 	}
 }
 
+func (p *adcPeer) infoVariant() adcInfoVariant {
+	if p.Info().Application == "" {
+		return adcInfoNoAP
+	}
+	return adcInfoNormal
+}
+
+type adcInfoKey struct {
+	sid SID
+	v   adcInfoVariant
+}
+
+// adcInfoUpdate stores INF fields of the peer that were changed since the last update
+// in the event, for each encoding variant. If there were no previous updates, all fields are stored.
+//
+// It must be called once per event, before the event is delivered, with the adcInfo lock
+// of the peer held.
+func (e *PeersUpdateEvent) adcInfoUpdate(peer Peer) error {
+	var u adc.User
+	if p2, ok := peer.(*adcPeer); ok {
+		u = p2.Info()
+	} else {
+		u = peer.UserInfo().toADC(CID{}, peer.User())
+	}
+	pb := peer.base()
+	for i, prev := range pb.adcInfo.last {
+		v := adcInfoVariant(i)
+		uv := u
+		v.fix(&uv)
+		cur, err := adc.Marshal(&uv)
+		if err != nil {
+			return err
+		}
+		pb.adcInfo.last[v] = cur
+
+		data := cur
+		if prev != nil {
+			data = adcInfoDiff(prev, cur)
+		}
+		if e.adcInfos == nil {
+			e.adcInfos = make(map[adcInfoKey][]byte)
+		}
+		e.adcInfos[adcInfoKey{sid: peer.SID(), v: v}] = data
+	}
+	return nil
+}
+
+// adcInfoDiff returns INF fields from cur that differ from the ones in prev.
+// Fields that are missing in cur are returned with an empty value, which
+// means that the field should be removed.
+func adcInfoDiff(prev, cur []byte) []byte {
+	sp := []byte(" ")
+	old := adcInfoFields(prev)
+	var out [][]byte
+	for name, vals := range adcInfoFields(cur) {
+		if ovals, ok := old[name]; !ok || !bytes.Equal(bytes.Join(ovals, sp), bytes.Join(vals, sp)) {
+			out = append(out, vals...)
+		}
+		delete(old, name)
+	}
+	for name := range old {
+		out = append(out, []byte(name))
+	}
+	// map iteration order is random
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i][:2], out[j][:2]) < 0
+	})
+	return bytes.Join(out, sp)
+}
+
+// adcInfoFields splits encoded INF into fields grouped by name.
+func adcInfoFields(data []byte) map[string][][]byte {
+	m := make(map[string][][]byte)
+	for _, f := range bytes.Split(data, []byte{' '}) {
+		if len(f) < 2 {
+			continue
+		}
+		name := string(f[:2])
+		m[name] = append(m[name], f)
+	}
+	return m
+}
+
 func (p *adcPeer) peersJoin(e *PeersJoinEvent, initial bool) error {
 	if !p.Online() {
 		return errConnectionClosed
 	}
+	var pacer *listPacer
+	if initial {
+		pacer = p.hub.newListPacer()
+	}
+	lazy := initial && p.fea.IsSet(adc.FeaLINF)
 	for _, peer := range e.Peers {
 		var u adc.User
 		if p2, ok := peer.(*adcPeer); ok {
@@ -971,12 +1455,18 @@ func (p *adcPeer) peersJoin(e *PeersJoinEvent, initial bool) error {
 			}
 		}
 		p.fixUserInfo(&u)
+		if lazy && peer != p {
+			u = adcLazyInfo(u)
+		}
 		if !p.Online() {
 			return errConnectionClosed
 		}
 		var err error
 		if initial {
 			err = p.c.WriteBroadcast(peer.SID(), &u)
+			if err == nil {
+				err = pacer.next(p.c.Flush)
+			}
 		} else {
 			err = p.SendADCBroadcast(peer.SID(), &u)
 		}
@@ -991,18 +1481,19 @@ func (p *adcPeer) peersUpdate(e *PeersUpdateEvent) error {
 	if !p.Online() {
 		return errConnectionClosed
 	}
+	v := p.infoVariant()
 	for _, peer := range e.Peers {
-		var u adc.User
-		if p2, ok := peer.(*adcPeer); ok {
-			u = p2.Info()
-		} else {
-			u = peer.UserInfo().toADC(CID{}, peer.User())
+		data := e.adcInfos[adcInfoKey{sid: peer.SID(), v: v}]
+		if len(data) == 0 {
+			continue // nothing changed
 		}
-		p.fixUserInfo(&u)
 		if !p.Online() {
 			return errConnectionClosed
 		}
-		err := p.SendADCBroadcast(peer.SID(), &u)
+		err := p.SendADC(&adc.BroadcastPacket{
+			ID:         peer.SID(),
+			BasePacket: adc.BasePacket{Name: (adc.User{}).Cmd(), Data: data},
+		})
 		if err != nil {
 			return err
 		}
@@ -1051,7 +1542,7 @@ func (p *adcPeer) JoinRoom(room *Room) error {
 		return err
 	}
 	err = p.SendADCDirect(rsid, adc.ChatMessage{
-		Text: "joined", PM: &rsid, Me: true,
+		Text: p.hub.text(p, TextRoomJoined, nil), PM: &rsid, Me: true,
 	})
 	if err != nil {
 		return err
@@ -1068,7 +1559,7 @@ func (p *adcPeer) LeaveRoom(room *Room) error {
 	}
 	rsid := room.SID()
 	err := p.SendADCDirect(rsid, adc.ChatMessage{
-		Text: "parted", PM: &rsid, Me: true,
+		Text: p.hub.text(p, TextRoomParted, nil), PM: &rsid, Me: true,
 		TS: time.Now().Unix(),
 	})
 	if err != nil {
@@ -1205,26 +1696,11 @@ func (s *adcSearch) SendResult(r SearchResult) error {
 	if !s.p.Online() {
 		return errConnectionClosed
 	}
-	sr := adc.SearchResult{
-		Token: s.token,
-		Slots: 1, // TODO
-	}
-	switch r := r.(type) {
-	case Dir:
-		if !strings.HasPrefix(r.Path, "/") {
-			r.Path = "/" + r.Path
-		}
-		sr.Path = r.Path
-	case File:
-		if !strings.HasPrefix(r.Path, "/") {
-			r.Path = "/" + r.Path
-		}
-		sr.Path = r.Path
-		sr.Size = int64(r.Size)
-		sr.TTH = r.TTH
-	default:
+	sr, ok := resultToADC(r)
+	if !ok {
 		return nil // ignore
 	}
+	sr.Token = s.token
 	return s.p.SendADCDirect(r.From().SID(), sr)
 }
 
@@ -1232,6 +1708,30 @@ func (s *adcSearch) Close() error {
 	return nil // TODO: block new results
 }
 
+// expectResults remembers the token of a search sent by the peer.
+func (p *adcPeer) expectResults(token string) {
+	now := time.Now()
+	p.results.Lock()
+	defer p.results.Unlock()
+	if p.results.tokens == nil {
+		p.results.tokens = make(map[string]time.Time)
+	}
+	for tok, last := range p.results.tokens {
+		if now.Sub(last) > searchTimeout {
+			delete(p.results.tokens, tok)
+		}
+	}
+	p.results.tokens[token] = now
+}
+
+// expectsResult checks if the peer sent a search with a given token recently.
+func (p *adcPeer) expectsResult(token string) bool {
+	p.results.Lock()
+	defer p.results.Unlock()
+	last, ok := p.results.tokens[token]
+	return ok && time.Since(last) <= searchTimeout
+}
+
 // gcTokens removes unused search tokens.
 // Should be called under the search write lock.
 func (p *adcPeer) gcTokens() {
@@ -1297,6 +1797,12 @@ func (p *adcPeer) Search(ctx context.Context, req SearchRequest, out Search) err
 			}
 			msg.Ext = r.Ext
 			msg.NoExt = r.NoExt
+			if !r.MinDate.IsZero() {
+				msg.MinDate = r.MinDate.Unix()
+			}
+			if !r.MaxDate.IsZero() {
+				msg.MaxDate = r.MaxDate.Unix()
+			}
 			switch r.FileType {
 			case FileTypeAudio:
 				msg.Group = adc.ExtAudio
@@ -1317,5 +1823,8 @@ func (p *adcPeer) Search(ctx context.Context, req SearchRequest, out Search) err
 		msg.And = name.And
 		msg.Not = name.Not
 	}
+	if msg.Group != adc.ExtNone && !p.HasFeature(adc.FeaSEGA.String()) {
+		msg = msg.ExpandGroups()
+	}
 	return p.SendADCBroadcast(out.Peer().SID(), msg)
 }
@@ -0,0 +1,591 @@
+package hub
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+// newTestADCPeer adds an ADC peer to the hub. All packets sent to it are buffered.
+func newTestADCPeer(t testing.TB, h *Hub, name string, fea ...adc.Feature) *adcPeer {
+	c, err := adc.NewConn(discardConn{})
+	require.NoError(t, err)
+	p, err := newADC(h, nil, c, adc.ModFeatures{adc.FeaBASE: true, adc.FeaTIGR: true})
+	require.NoError(t, err)
+	p.setName(name)
+	p.info.user = adc.User{Name: name, ShareSize: 1, Features: fea}
+	h.acceptPeer(p, nil, nil)
+	return p
+}
+
+// setTestCID sets the CID of a test peer and adds it to the CID index.
+func setTestCID(h *Hub, p *adcPeer, cid CID) {
+	p.info.cid = cid
+	h.peers.index.AddCID(cid, p)
+}
+
+// sentADC returns all packets buffered for the peer and clears the buffer.
+func sentADC(p *adcPeer) []adc.Packet {
+	p.write.Lock()
+	defer p.write.Unlock()
+	buf := p.write.buf
+	p.write.buf = nil
+	return buf
+}
+
+func TestADCFeatureRouting(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from", adc.FeaSEGA)
+	peers := []*adcPeer{
+		newTestADCPeer(t, h, "sega_tcp4", adc.FeaSEGA, adc.FeaTCP4),
+		newTestADCPeer(t, h, "sega", adc.FeaSEGA),
+		newTestADCPeer(t, h, "tcp4", adc.FeaTCP4),
+		newTestADCPeer(t, h, "none"),
+	}
+
+	var cases = []struct {
+		name string
+		data string
+		cmd  string
+		exp  []string
+	}{
+		{
+			name: "required",
+			data: "FSCH AAAB +SEGA TOtok ANdata",
+			cmd:  "SCH", exp: []string{"sega", "sega_tcp4"},
+		},
+		{
+			name: "excluded",
+			data: "FSCH AAAB -SEGA TOtok ANdata",
+			cmd:  "SCH", exp: []string{"none", "tcp4"},
+		},
+		{
+			name: "required and excluded",
+			data: "FSCH AAAB +SEGA -TCP4 TOtok ANdata",
+			cmd:  "SCH", exp: []string{"sega"},
+		},
+		{
+			name: "two required",
+			data: "FSCH AAAB +TCP4 +SEGA TOtok ANdata",
+			cmd:  "SCH", exp: []string{"sega_tcp4"},
+		},
+		{
+			name: "no match",
+			data: "FSCH AAAB +NAT0 TOtok ANdata",
+			cmd:  "SCH", exp: nil,
+		},
+		{
+			name: "other message",
+			data: "FXYZ AAAB +SEGA some\\sdata",
+			cmd:  "XYZ", exp: []string{"from", "sega", "sega_tcp4"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := adc.DecodePacket([]byte(c.data + "\n"))
+			require.NoError(t, err)
+			fp := p.(*adc.FeaturePacket)
+			fp.ID = from.SID()
+
+			sentADC(from)
+			for _, p := range peers {
+				sentADC(p)
+			}
+			require.NoError(t, h.adcHandlePacket(from, fp))
+
+			var got []string
+			for _, p := range append([]*adcPeer{from}, peers...) {
+				for _, m := range sentADC(p) {
+					require.Equal(t, c.cmd, m.Message().Type.String())
+					got = append(got, p.Name())
+				}
+			}
+			sort.Strings(got)
+			require.Equal(t, c.exp, got)
+		})
+	}
+}
+
+func TestADCFeatureChat(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from", adc.FeaSEGA)
+	sega := newTestADCPeer(t, h, "sega", adc.FeaSEGA)
+	none := newTestADCPeer(t, h, "none")
+	_, ircBuf := newTestIRCPeer(t, h, "irc")
+
+	send := func(data string) {
+		sentADC(from)
+		sentADC(sega)
+		sentADC(none)
+		sentIRC(t, ircBuf)
+		p, err := adc.DecodePacket([]byte(data + "\n"))
+		require.NoError(t, err)
+		fp := p.(*adc.FeaturePacket)
+		fp.ID = from.SID()
+		require.NoError(t, h.adcHandlePacket(from, fp))
+	}
+
+	// non-ADC peers have no features, but still receive converted chat messages
+	send("FMSG AAAB -SEGA hello")
+	require.Len(t, sentADC(from), 1)
+	require.Len(t, sentADC(none), 1)
+	require.Empty(t, sentADC(sega))
+	msgs := sentIRC(t, ircBuf)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "PRIVMSG", msgs[0].Command)
+	require.Equal(t, "hello", msgs[0].Trailing())
+
+	send("FMSG AAAB +SEGA hello")
+	require.Len(t, sentADC(from), 1)
+	require.Len(t, sentADC(sega), 1)
+	require.Empty(t, sentADC(none))
+	require.Empty(t, sentIRC(t, ircBuf))
+}
+
+func TestADCSearchGroups(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from", adc.FeaSEGA)
+	sega := newTestADCPeer(t, h, "sega", adc.FeaSEGA)
+	old := newTestADCPeer(t, h, "old")
+
+	search := func(data string) (adc.SearchRequest, adc.SearchRequest) {
+		sentADC(sega)
+		sentADC(old)
+		p, err := adc.DecodePacket([]byte(data + "\n"))
+		require.NoError(t, err)
+		p.(*adc.BroadcastPacket).ID = from.SID()
+		require.NoError(t, h.adcHandlePacket(from, p))
+
+		var reqs []adc.SearchRequest
+		for _, p := range []*adcPeer{sega, old} {
+			sent := sentADC(p)
+			require.Len(t, sent, 1)
+			var req adc.SearchRequest
+			require.NoError(t, adc.Unmarshal(sent[0].Message().Data, &req))
+			reqs = append(reqs, req)
+		}
+		return reqs[0], reqs[1]
+	}
+
+	r1, r2 := search("BSCH AAAB TOtok ANdata GR32 RXmkv")
+	require.Equal(t, adc.ExtVideo, r1.Group)
+	require.Equal(t, []string{"mkv"}, r1.NoExt)
+	require.Equal(t, adc.ExtNone, r2.Group)
+	require.Contains(t, r2.Ext, "avi")
+	require.NotContains(t, r2.Ext, "mkv")
+
+	// multiple groups are expanded for all peers
+	r1, r2 = search("BSCH AAAB TOtok ANdata GR33")
+	require.Equal(t, adc.ExtNone, r1.Group)
+	require.Contains(t, r1.Ext, "mp3")
+	require.Contains(t, r1.Ext, "avi")
+	require.Equal(t, r1.Ext, r2.Ext)
+
+	// ASCH date range is preserved
+	r1, r2 = search("BSCH AAAB TOtok ANdata MT100 NT200")
+	require.Equal(t, int64(100), r1.MinDate)
+	require.Equal(t, int64(200), r2.MaxDate)
+}
+
+func TestADCEcho(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from")
+	to := newTestADCPeer(t, h, "to")
+	other := newTestADCPeer(t, h, "other")
+	sentADC(from)
+	sentADC(to)
+	sentADC(other)
+
+	send := func(id, targ adc.SID) error {
+		return h.adcHandlePacket(from, &adc.EchoPacket{
+			ID: id, Targ: targ,
+			BasePacket: adc.BasePacket{
+				Name: adc.MsgType{'M', 'S', 'G'},
+				Data: []byte(`hello PM` + from.SID().String()),
+			},
+		})
+	}
+
+	t.Run("deliver and echo", func(t *testing.T) {
+		require.NoError(t, send(from.SID(), to.SID()))
+
+		got := sentADC(to)
+		require.Len(t, got, 1)
+		d, ok := got[0].(*adc.DirectPacket)
+		require.True(t, ok, "%T", got[0])
+		require.Equal(t, from.SID(), d.ID)
+		require.Equal(t, to.SID(), d.Targ)
+
+		got = sentADC(from)
+		require.Len(t, got, 1)
+		e, ok := got[0].(*adc.EchoPacket)
+		require.True(t, ok, "%T", got[0])
+		require.Equal(t, from.SID(), e.ID)
+		require.Equal(t, to.SID(), e.Targ)
+
+		require.Empty(t, sentADC(other))
+	})
+
+	t.Run("unknown target", func(t *testing.T) {
+		require.NoError(t, send(from.SID(), adc.SID{'Z', 'Z', 'Z', 'Z'}))
+		require.Empty(t, sentADC(from))
+		require.Empty(t, sentADC(to))
+	})
+
+	t.Run("spoofed source", func(t *testing.T) {
+		err := send(other.SID(), to.SID())
+		require.True(t, adc.IsCode(err, adc.CodeProtocolGeneric), "%v", err)
+		require.Empty(t, sentADC(from))
+		require.Empty(t, sentADC(to))
+	})
+}
+
+func TestADCEchoSpoofed(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	from := th.JoinADC("alice")
+	to := th.JoinADC("bob")
+	other := th.JoinADC("carol")
+
+	// the error returned by the handler is sent to the peer before disconnecting it
+	from.SendMsg("EMSG "+other.SID.String()+" "+to.SID.String(), adc.ChatMessage{Text: "spoofed"})
+	p := from.Expect("STA", nil)
+	_, ok := p.(*adc.InfoPacket)
+	require.True(t, ok, "%T", p)
+	require.True(t, strings.HasPrefix(string(p.Message().Data), "240 "), "ISTA %s", p.Message().Data)
+	var st adc.Status
+	require.NoError(t, adc.Unmarshal(p.Message().Data, &st))
+	require.Equal(t, adc.Fatal, st.Sev)
+	require.Equal(t, adc.CodeProtocolGeneric, st.Code)
+	from.ExpectClosed()
+
+	to.ExpectQuit(from)
+	for _, p := range to.Received("MSG") {
+		_, ok := p.(*adc.DirectPacket)
+		require.False(t, ok, "spoofed message delivered")
+	}
+}
+
+func TestADCZeroCID(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	c := th.Dial()
+	c.Send("HSUP ADBASE ADTIGR")
+	p := c.Expect("SID", nil)
+	var sid adc.SIDAssign
+	require.NoError(t, adc.Unmarshal(p.Message().Data, &sid))
+	pid := types.NewPID()
+	c.SendMsg("BINF "+sid.SID.String(), adc.User{
+		Pid: &pid, Name: "zero",
+		Slots: 1, SlotsFree: 1, HubsNormal: 1,
+	})
+	p = c.Expect("STA", nil)
+	var st adc.Status
+	require.NoError(t, adc.Unmarshal(p.Message().Data, &st))
+	require.Equal(t, adc.CodeBadINF, st.Code)
+	c.ExpectClosed()
+	require.Nil(t, th.h.PeerByName("zero"))
+}
+
+func TestADCInfoDiff(t *testing.T) {
+	cases := []struct {
+		name      string
+		prev, cur string
+		exp       string
+	}{
+		{name: "same", prev: "IDxxx NIuser SS10", cur: "IDxxx NIuser SS10", exp: ""},
+		{name: "changed", prev: "IDxxx NIuser SS10", cur: "IDxxx NIuser SS20", exp: "SS20"},
+		{name: "added", prev: "NIuser SS10", cur: "NIuser SS10 AW1 DEsome\\sdesc", exp: "AW1 DEsome\\sdesc"},
+		{name: "removed", prev: "NIuser AW1 SS10", cur: "NIuser SS10", exp: "AW"},
+		{name: "multi", prev: "NIuser SUTCP4,ADC0", cur: "NIuser SUTCP4", exp: "SUTCP4"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := adcInfoDiff([]byte(c.prev), []byte(c.cur))
+			require.Equal(t, c.exp, string(got))
+		})
+	}
+}
+
+func TestADCInfoUpdate(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from")
+	to := newTestADCPeer(t, h, "to")
+	sentADC(to)
+
+	update := func(data string) {
+		err := h.adcUpdateInfo(from, &adc.BroadcastPacket{
+			ID:         from.SID(),
+			BasePacket: adc.BasePacket{Name: (adc.User{}).Cmd(), Data: []byte(data)},
+		})
+		require.NoError(t, err)
+	}
+	recv := func() string {
+		got := sentADC(to)
+		if len(got) == 0 {
+			return ""
+		}
+		require.Len(t, got, 1)
+		b, ok := got[0].(*adc.BroadcastPacket)
+		require.True(t, ok, "%T", got[0])
+		require.Equal(t, from.SID(), b.ID)
+		return string(b.Data)
+	}
+
+	// the first update is sent in full
+	update("SS10")
+	require.Contains(t, recv(), "NIfrom")
+
+	update("SS20")
+	require.Equal(t, "SS20", recv())
+
+	update("SS20 DEdesc")
+	require.Equal(t, "DEdesc", recv())
+
+	// nothing changed
+	update("SS20")
+	require.Equal(t, "", recv())
+}
+
+func TestADCInfoUpdateConcurrent(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from")
+	to := newTestADCPeer(t, h, "to")
+	sentADC(to)
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 100)
+	for i := 1; i <= cap(errc); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errc <- h.adcUpdateInfo(from, &adc.BroadcastPacket{
+				ID:         from.SID(),
+				BasePacket: adc.BasePacket{Name: (adc.User{}).Cmd(), Data: []byte("SS" + strconv.Itoa(i))},
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		require.NoError(t, err)
+	}
+
+	// diffs applied in the order of delivery must result in the current info
+	var share string
+	for _, p := range sentADC(to) {
+		for _, f := range bytes.Split(p.Message().Data, []byte(" ")) {
+			if bytes.HasPrefix(f, []byte("SS")) {
+				share = string(f[2:])
+			}
+		}
+	}
+	require.Equal(t, strconv.FormatInt(from.Info().ShareSize, 10), share)
+}
+
+func TestADCInfoUpdateCoalesce(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	h, err := NewHub(Config{UpdateDelay: delay})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from")
+	to := newTestADCPeer(t, h, "to")
+	sentADC(to)
+
+	for _, data := range []string{"SS10", "SS20", "SS30 DEdesc"} {
+		err := h.adcUpdateInfo(from, &adc.BroadcastPacket{
+			ID:         from.SID(),
+			BasePacket: adc.BasePacket{Name: (adc.User{}).Cmd(), Data: []byte(data)},
+		})
+		require.NoError(t, err)
+	}
+	require.Empty(t, sentADC(to))
+
+	var got []adc.Packet
+	for deadline := time.Now().Add(time.Second); len(got) == 0 && time.Now().Before(deadline); {
+		time.Sleep(delay / 5)
+		got = sentADC(to)
+	}
+	require.Len(t, got, 1)
+	data := string(got[0].(*adc.BroadcastPacket).Data)
+	require.Contains(t, data, "SS30")
+	require.Contains(t, data, "DEdesc")
+}
+
+func TestADCInfoUpdateFlushOnJoin(t *testing.T) {
+	th := newTestHarness(t, Config{UpdateDelay: time.Minute})
+	defer th.Close()
+
+	alice := th.JoinADC("alice")
+	bob := th.JoinADC("bob")
+	bob.Sendf("BINF %s DEaway", bob.SID)
+	th.Sync(bob)
+	require.Empty(t, alice.Received("INF"))
+
+	// pending updates are sent before the user list, so later diffs apply to the new peer
+	th.JoinADC("carol")
+	alice.Expect("INF", func(p adc.Packet) bool {
+		b, ok := p.(*adc.BroadcastPacket)
+		return ok && b.ID == bob.SID && strings.Contains(string(b.Data), "DEaway")
+	})
+}
+
+func TestADCInfoUpdateClose(t *testing.T) {
+	h, err := NewHub(Config{UpdateDelay: time.Minute})
+	require.NoError(t, err)
+
+	from := newTestADCPeer(t, h, "from")
+	update := func() {
+		err := h.adcUpdateInfo(from, &adc.BroadcastPacket{
+			ID:         from.SID(),
+			BasePacket: adc.BasePacket{Name: (adc.User{}).Cmd(), Data: []byte("SS10")},
+		})
+		require.NoError(t, err)
+	}
+	update()
+	h.updates.Lock()
+	require.Len(t, h.updates.pending, 1)
+	h.updates.Unlock()
+
+	// timers are stopped when the hub is closed
+	require.NoError(t, h.Close())
+	update()
+	h.updates.Lock()
+	require.Empty(t, h.updates.pending)
+	h.updates.Unlock()
+}
+
+func TestADCResultRelay(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	searcher := newTestADCPeer(t, h, "searcher")
+	responder := newTestADCPeer(t, h, "responder")
+	other := newTestADCPeer(t, h, "other")
+
+	handle := func(from *adcPeer, data string) {
+		p, err := adc.DecodePacket([]byte(data + "\n"))
+		require.NoError(t, err)
+		switch p := p.(type) {
+		case *adc.BroadcastPacket:
+			p.ID = from.SID()
+		case *adc.DirectPacket:
+			p.ID = from.SID()
+			if p.Targ == (adc.SID{'S', 'S', 'S', 'S'}) {
+				p.Targ = searcher.SID()
+			}
+		}
+		require.NoError(t, h.adcHandlePacket(from, p))
+	}
+
+	handle(searcher, "BSCH AAAA TOtok ANdata")
+	require.Len(t, sentADC(responder), 1)
+	sentADC(other)
+
+	t.Run("relay", func(t *testing.T) {
+		handle(responder, `DRES AAAB SSSS FN/data SI10 SL1 TOtok`)
+		got := sentADC(searcher)
+		require.Len(t, got, 1)
+		d, ok := got[0].(*adc.DirectPacket)
+		require.True(t, ok, "%T", got[0])
+		require.Equal(t, responder.SID(), d.ID)
+		require.Equal(t, searcher.SID(), d.Targ)
+		require.Contains(t, string(d.Data), "TOtok")
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		handle(responder, `DRES AAAB SSSS FN/data SI10 SL1 TOother`)
+		require.Empty(t, sentADC(searcher))
+	})
+
+	t.Run("no search", func(t *testing.T) {
+		p, err := adc.DecodePacket([]byte("DRES AAAB AAAC FN/data SI10 SL1 TOtok\n"))
+		require.NoError(t, err)
+		d := p.(*adc.DirectPacket)
+		d.ID, d.Targ = searcher.SID(), other.SID()
+		require.NoError(t, h.adcHandlePacket(searcher, d))
+		require.Empty(t, sentADC(other))
+	})
+
+	t.Run("broadcast", func(t *testing.T) {
+		handle(responder, `BRES AAAB FN/data SI10 SL1 TOtok`)
+		require.Empty(t, sentADC(searcher))
+		require.Empty(t, sentADC(other))
+	})
+}
+
+func TestADCHideUnreachableUDP(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	p := newTestADCPeer(t, h, "peer")
+
+	u := adc.User{Ip4: localhostIP.String(), Udp4: 3000, Features: adc.ExtFeatures{adc.FeaTCP4, adc.FeaUDP4}}
+	p.hideUnreachableUDP(&u)
+	require.Equal(t, 3000, u.Udp4)
+	require.True(t, u.Features.Has(adc.FeaUDP4))
+
+	// behind NAT
+	u.Ip4 = "192.168.1.2"
+	p.hideUnreachableUDP(&u)
+	require.Equal(t, 0, u.Udp4)
+	require.Equal(t, adc.ExtFeatures{adc.FeaTCP4}, u.Features)
+}
+
+func TestADCClientOnly(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	from := newTestADCPeer(t, h, "from")
+	to := newTestADCPeer(t, h, "to")
+
+	for _, data := range []string{
+		"DGFI AAAB AAAC file TTH/AAAA",
+		"EGET AAAB AAAC file TTH/AAAA 0 -1",
+		"BGFI AAAB file /a",
+		"DXYZ AAAB AAAC some\\sdata",
+	} {
+		p, err := adc.DecodePacket([]byte(data + "\n"))
+		require.NoError(t, err)
+		switch p := p.(type) {
+		case *adc.BroadcastPacket:
+			p.ID = from.SID()
+		case *adc.DirectPacket:
+			p.ID, p.Targ = from.SID(), to.SID()
+		case *adc.EchoPacket:
+			p.ID, p.Targ = from.SID(), to.SID()
+		}
+		sentADC(from)
+		require.NoError(t, h.adcHandlePacket(from, p))
+		got := sentADC(to)
+		if p.Message().Type.String() == "XYZ" {
+			require.Len(t, got, 1, data)
+			continue
+		}
+		require.Empty(t, got, data)
+		resp := sentADC(from)
+		require.Len(t, resp, 1, data)
+		require.Equal(t, "STA", resp[0].Message().Type.String())
+	}
+}
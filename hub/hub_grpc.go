@@ -0,0 +1,283 @@
+package hub
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/direct-connect/go-dcpp/hub/hubpb"
+)
+
+// grpcChatBuffer is the number of chat messages buffered for each TailChat stream.
+const grpcChatBuffer = 100
+
+// GRPCHandler returns an HTTP/2 handler for the control plane API. See hubpb package for details.
+//
+// The handler is served on the hub port for TLS connections, and can be served on a separate
+// address with h2c for local integrations. All methods require the API token.
+func (h *Hub) GRPCHandler() http.Handler {
+	return &hubpb.Server{
+		Auth: h.grpcAuth,
+		Methods: map[string]hubpb.Method{
+			hubpb.MethodGetStats: {
+				New:   func() proto.Message { return &hubpb.Empty{} },
+				Unary: h.grpcGetStats,
+			},
+			hubpb.MethodListPeers: {
+				New:   func() proto.Message { return &hubpb.Empty{} },
+				Unary: h.grpcListPeers,
+			},
+			hubpb.MethodWatchPeers: {
+				New:    func() proto.Message { return &hubpb.WatchPeersRequest{} },
+				Stream: h.grpcWatchPeers,
+			},
+			hubpb.MethodTailChat: {
+				New:    func() proto.Message { return &hubpb.TailChatRequest{} },
+				Stream: h.grpcTailChat,
+			},
+			hubpb.MethodSendChat: {
+				New:   func() proto.Message { return &hubpb.SendChatRequest{} },
+				Unary: h.grpcSendChat,
+			},
+			hubpb.MethodKick: {
+				New:   func() proto.Message { return &hubpb.KickRequest{} },
+				Unary: h.grpcKick,
+			},
+			hubpb.MethodBanIP: {
+				New:   func() proto.Message { return &hubpb.BanIPRequest{} },
+				Unary: h.grpcBanIP,
+			},
+			hubpb.MethodUnbanIP: {
+				New:   func() proto.Message { return &hubpb.BanIPRequest{} },
+				Unary: h.grpcUnbanIP,
+			},
+			hubpb.MethodListBans: {
+				New:   func() proto.Message { return &hubpb.Empty{} },
+				Unary: h.grpcListBans,
+			},
+			hubpb.MethodGetConfig: {
+				New:   func() proto.Message { return &hubpb.Empty{} },
+				Unary: h.grpcGetConfig,
+			},
+			hubpb.MethodSetConfig: {
+				New:   func() proto.Message { return &hubpb.ConfigValue{} },
+				Unary: h.grpcSetConfig,
+			},
+			hubpb.MethodReloadConfig: {
+				New:   func() proto.Message { return &hubpb.Empty{} },
+				Unary: h.grpcReloadConfig,
+			},
+		},
+	}
+}
+
+// grpcAuth checks the API token of the request. The API is disabled if the token is not set.
+func (h *Hub) grpcAuth(r *http.Request) bool {
+	token := h.conf.APIToken
+	if token == "" {
+		return false
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	return strings.HasPrefix(auth, prefix) &&
+		subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) == 1
+}
+
+func grpcPeer(s PeerSnapshot) *hubpb.Peer {
+	return &hubpb.Peer{
+		Sid:        s.SID,
+		Name:       s.Name,
+		Proto:      s.Proto,
+		Ip:         s.IP,
+		Cid:        s.CID,
+		Share:      s.Share,
+		ShareFiles: uint64(s.ShareFiles),
+		Client:     s.Client.Name + " " + s.Client.Version,
+		Bot:        s.Bot,
+		Op:         s.Op,
+		Registered: s.Registered,
+		Secure:     s.Secure,
+		Away:       s.Away,
+	}
+}
+
+func (h *Hub) grpcGetStats(ctx context.Context, _ proto.Message) (proto.Message, error) {
+	st := h.Stats()
+	return &hubpb.Stats{
+		Name:      st.Name,
+		Desc:      st.Desc,
+		Soft:      st.Soft.Name + " " + st.Soft.Version,
+		Users:     uint32(st.Users),
+		Share:     st.Share,
+		UptimeSec: int64(h.Uptime().Seconds()),
+	}, nil
+}
+
+func (h *Hub) grpcListPeers(ctx context.Context, _ proto.Message) (proto.Message, error) {
+	s := h.Snapshot()
+	resp := &hubpb.PeerList{Seq: s.Seq, Peers: make([]*hubpb.Peer, 0, len(s.Peers))}
+	for _, p := range s.Peers {
+		resp.Peers = append(resp.Peers, grpcPeer(p))
+	}
+	return resp, nil
+}
+
+func (h *Hub) grpcWatchPeers(ctx context.Context, req proto.Message, send func(proto.Message) error) error {
+	seq := req.(*hubpb.WatchPeersRequest).Seq
+	ch, cancel := h.SubscribeChanges(seq, 0)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return hubpb.Errorf(hubpb.CodeCanceled, "%v", ctx.Err())
+		case <-h.closed:
+			return hubpb.Errorf(hubpb.CodeUnavailable, "hub is shutting down")
+		case c, ok := <-ch:
+			if !ok {
+				return hubpb.Errorf(hubpb.CodeUnavailable, "changes are not available, list peers again")
+			}
+			err := send(&hubpb.PeerChange{
+				Seq:  c.Seq,
+				Kind: string(c.Kind),
+				Time: c.Time.UnixNano() / 1e6,
+				Peer: grpcPeer(c.Peer),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func grpcChat(m Message) *hubpb.ChatMessage {
+	return &hubpb.ChatMessage{
+		Time: m.Time.UnixNano() / 1e6,
+		Name: m.Name,
+		Text: m.Text,
+		Me:   m.Me,
+	}
+}
+
+func (h *Hub) grpcTailChat(ctx context.Context, req proto.Message, send func(proto.Message) error) error {
+	r := h.globalChat
+	// subscribe first to not miss messages sent while the log is replayed
+	ch, cancel := r.Subscribe(grpcChatBuffer)
+	defer cancel()
+	if n := req.(*hubpb.TailChatRequest).Last; n != 0 {
+		for _, m := range r.Log(int(n)) {
+			if err := send(grpcChat(m)); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return hubpb.Errorf(hubpb.CodeCanceled, "%v", ctx.Err())
+		case <-h.closed:
+			return hubpb.Errorf(hubpb.CodeUnavailable, "hub is shutting down")
+		case m, ok := <-ch:
+			if !ok {
+				return hubpb.Errorf(hubpb.CodeUnavailable, "client is too slow")
+			}
+			if err := send(grpcChat(m)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (h *Hub) grpcSendChat(ctx context.Context, req proto.Message) (proto.Message, error) {
+	text := req.(*hubpb.SendChatRequest).Text
+	if text == "" {
+		return nil, hubpb.Errorf(hubpb.CodeInvalidArgument, "text must be set")
+	}
+	if err := h.hubUser.SendGlobal(Message{Text: text}); err != nil {
+		return nil, err
+	}
+	return &hubpb.Empty{}, nil
+}
+
+func (h *Hub) grpcKick(ctx context.Context, req proto.Message) (proto.Message, error) {
+	r := req.(*hubpb.KickRequest)
+	p := h.PeerByName(r.Name)
+	if p == nil {
+		return nil, hubpb.Errorf(hubpb.CodeNotFound, "user is offline: %s", r.Name)
+	}
+	_ = p.Close()
+	h.audit(AuditKick, nil, r.Name, r.Reason)
+	return &hubpb.Empty{}, nil
+}
+
+func (h *Hub) grpcBanIP(ctx context.Context, req proto.Message) (proto.Message, error) {
+	r := req.(*hubpb.BanIPRequest)
+	ip := net.ParseIP(r.Ip)
+	if ip == nil {
+		return nil, hubpb.Errorf(hubpb.CodeInvalidArgument, "invalid IP: %q", r.Ip)
+	}
+	h.HardBlockIP(ip)
+	h.audit(AuditBan, nil, ip.String(), r.Reason)
+	return &hubpb.Empty{}, nil
+}
+
+func (h *Hub) grpcUnbanIP(ctx context.Context, req proto.Message) (proto.Message, error) {
+	r := req.(*hubpb.BanIPRequest)
+	ip := net.ParseIP(r.Ip)
+	if ip == nil {
+		return nil, hubpb.Errorf(hubpb.CodeInvalidArgument, "invalid IP: %q", r.Ip)
+	} else if !h.IsHardBlockedIP(ip) {
+		return nil, hubpb.Errorf(hubpb.CodeNotFound, "IP is not blocked: %s", ip)
+	}
+	h.HardUnBlockIP(ip)
+	h.audit(AuditUnban, nil, ip.String(), r.Reason)
+	return &hubpb.Empty{}, nil
+}
+
+func (h *Hub) grpcListBans(ctx context.Context, _ proto.Message) (proto.Message, error) {
+	resp := &hubpb.BanList{}
+	h.EachHardBlockedIP(func(ip net.IP) bool {
+		resp.Ips = append(resp.Ips, ip.String())
+		return true
+	})
+	return resp, nil
+}
+
+func (h *Hub) grpcGetConfig(ctx context.Context, _ proto.Message) (proto.Message, error) {
+	resp := &hubpb.ConfigList{}
+	for _, k := range h.ConfigKeys() {
+		v, _ := h.GetConfig(k)
+		resp.Values = append(resp.Values, &hubpb.ConfigValue{Key: k, Value: fmt.Sprint(v)})
+	}
+	return resp, nil
+}
+
+func (h *Hub) grpcSetConfig(ctx context.Context, req proto.Message) (proto.Message, error) {
+	r := req.(*hubpb.ConfigValue)
+	if r.Key == "" {
+		return nil, hubpb.Errorf(hubpb.CodeInvalidArgument, "key must be set")
+	} else if isConfigIgnored(r.Key) {
+		return nil, hubpb.Errorf(hubpb.CodePermissionDenied, "key can only be set in the config file: %s", r.Key)
+	}
+	v, err := h.setConfigText(r.Key, r.Value)
+	if err != nil {
+		return nil, hubpb.Errorf(hubpb.CodeInvalidArgument, "%v", err)
+	}
+	h.audit(AuditConfig, nil, r.Key, r.Value)
+	return &hubpb.ConfigValue{Key: r.Key, Value: fmt.Sprint(v)}, nil
+}
+
+func (h *Hub) grpcReloadConfig(ctx context.Context, _ proto.Message) (proto.Message, error) {
+	if h.conf.ReloadConfig == nil {
+		return nil, hubpb.Errorf(hubpb.CodeUnimplemented, "config reload is not supported")
+	}
+	if err := h.ReloadConfig(); err != nil {
+		return nil, hubpb.Errorf(hubpb.CodeInternal, "cannot reload config: %v", err)
+	}
+	h.audit(AuditConfig, nil, "", "reload")
+	return &hubpb.Empty{}, nil
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/direct-connect/go-dcpp/hub/hubpb"
+)
+
+func TestGRPC(t *testing.T) {
+	h, err := NewHub(Config{Name: "test", APIToken: "secret", ChatLog: 10})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(h2c.NewHandler(h.GRPCHandler(), &http2.Server{}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	ctx := context.Background()
+
+	_, err = hubpb.NewClient(addr, nil, "wrong").GetStats(ctx)
+	st, ok := err.(*hubpb.Status)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, hubpb.CodeUnauthenticated, st.Code)
+
+	c := hubpb.NewClient(addr, nil, "secret")
+	stats, err := c.GetStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "test", stats.Name)
+
+	list, err := c.ListPeers(ctx)
+	require.NoError(t, err)
+	require.Len(t, list.Peers, 1) // hub bot
+
+	changes, err := c.WatchPeers(ctx, list.Seq)
+	require.NoError(t, err)
+	defer changes.Close()
+
+	p := newTestADCPeer(t, h, "user")
+	sentADC(p)
+
+	var ch hubpb.PeerChange
+	require.NoError(t, changes.Recv(&ch))
+	require.Equal(t, "join", ch.Kind)
+	require.Equal(t, "user", ch.Peer.Name)
+
+	h.globalChat.SendChat(p, Message{Text: "before"})
+	chat, err := c.TailChat(ctx, 1)
+	require.NoError(t, err)
+	defer chat.Close()
+	var m hubpb.ChatMessage
+	require.NoError(t, chat.Recv(&m))
+	require.Equal(t, "before", m.Text)
+
+	require.NoError(t, c.SendChat(ctx, "hello"))
+	require.NoError(t, chat.Recv(&m))
+	require.Equal(t, "hello", m.Text)
+	require.Contains(t, lastChat(t, p), "hello")
+
+	err = c.Kick(ctx, "nobody", "")
+	st, ok = err.(*hubpb.Status)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, hubpb.CodeNotFound, st.Code)
+
+	require.NoError(t, c.Kick(ctx, "user", "test"))
+	require.NoError(t, changes.Recv(&ch))
+	require.Equal(t, "leave", ch.Kind)
+	require.Nil(t, h.PeerByName("user"))
+
+	err = c.BanIP(ctx, "bad", "")
+	require.Error(t, err)
+	require.NoError(t, c.BanIP(ctx, "10.0.0.1", "test"))
+	require.True(t, h.IsHardBlockedIP([]byte{10, 0, 0, 1}))
+	bans, err := c.ListBans(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1"}, bans.Ips)
+	require.NoError(t, c.UnbanIP(ctx, "10.0.0.1", ""))
+	require.False(t, h.IsHardBlockedIP([]byte{10, 0, 0, 1}))
+
+	v, err := c.SetConfig(ctx, ConfigHubTopic, "new topic")
+	require.NoError(t, err)
+	require.Equal(t, "new topic", v.Value)
+	_, err = c.SetConfig(ctx, ConfigZlibLevel, "bad")
+	require.Error(t, err)
+	_, err = c.SetConfig(ctx, "api.token", "x")
+	require.Error(t, err)
+	conf, err := c.GetConfig(ctx)
+	require.NoError(t, err)
+	require.Contains(t, conf.Values, &hubpb.ConfigValue{Key: ConfigHubTopic, Value: "new topic"})
+
+	err = c.ReloadConfig(ctx)
+	st, ok = err.(*hubpb.Status)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, hubpb.CodeUnimplemented, st.Code)
+	h.conf.ReloadConfig = func() (Map, error) {
+		return Map{"hub": Map{"topic": "reloaded"}}, nil
+	}
+	require.NoError(t, c.ReloadConfig(ctx))
+	topic, _ := h.GetConfigString(ConfigHubTopic)
+	require.Equal(t, "reloaded", topic)
+
+	// stream ends when the hub is closed
+	require.NoError(t, h.Close())
+	err = changes.Recv(&ch)
+	require.True(t, err != nil && err != io.EOF)
+}
@@ -1,27 +1,46 @@
 package hub
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rakyll/statik/fs"
 	"golang.org/x/net/http2"
+
+	"github.com/direct-connect/go-dcpp/hub/hubpb"
 )
 
 //go:generate statik -src static -p hub -f -c ""
 //go:generate mv hub/statik.go static.go
 //go:generate rm -r hub
 
-const HTTPInfoPathV0 = "/api/v0/hubinfo.json"
+const (
+	HTTPInfoPathV0     = "/api/v0/hubinfo.json"
+	HTTPSnapshotPathV0 = "/api/v0/snapshot.json"
+	HTTPChangesPathV0  = "/api/v0/changes"
+	HTTPAuditPathV0    = "/api/v0/audit.json"
+	HTTPNotesPathV0    = "/api/v0/notes.json"
+	HTTPWatchPathV0    = "/api/v0/watch.json"
+
+	HTTPSearchStatsPathV0 = "/api/v0/search_stats.json"
+)
 
 type httpData struct {
 	h1     *http.Server
 	h2     *http2.Server
 	h2conf *http2.ServeConnOpts
+	// debug serves HTTPDebugPath, see SetDebugHandler
+	debug http.Handler
 }
 
 func (h *Hub) initHTTP() error {
@@ -40,6 +59,23 @@ func (h *Hub) initHTTP() error {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(HTTPInfoPathV0, h.serveV0Stats)
+	mux.HandleFunc(HTTPSnapshotPathV0, h.serveV0Snapshot)
+	mux.HandleFunc(HTTPChangesPathV0, h.serveV0Changes)
+	mux.HandleFunc(HTTPAuditPathV0, h.serveV0Audit)
+	mux.HandleFunc(HTTPNotesPathV0, h.serveV0Notes)
+	mux.HandleFunc(HTTPWatchPathV0, h.serveV0Watch)
+	mux.HandleFunc(HTTPOpsPathV0, h.serveV0Ops)
+	mux.HandleFunc(HTTPServicesPathV0, h.serveV0Services)
+	mux.HandleFunc(HTTPSearchStatsPathV0, h.serveV0SearchStats)
+	mux.HandleFunc(HTTPFilesPathV0, h.serveV0Files)
+	mux.HandleFunc(HTTPFileListPathV0, h.serveV0FileList)
+	mux.HandleFunc(HTTPFilesPath, h.serveFiles)
+	mux.HandleFunc(HTTPBridgePathV0, h.serveV0Bridge)
+	mux.HandleFunc(HTTPBridgeWSPathV0, h.serveV0BridgeWS)
+	mux.HandleFunc(HTTPHealthPath, h.serveHealth)
+	mux.HandleFunc(HTTPReadyPath, h.serveReady)
+	mux.HandleFunc(HTTPDebugPath, h.serveDebug)
+	mux.Handle(hubpb.PathPrefix, h.GRPCHandler())
 	mux.Handle("/", http.FileServer(statikFS))
 	root := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s: http: %s %s (%s)\n",
@@ -127,11 +163,18 @@ func (h *Hub) serveV0Stats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	q, err := httpPeerQuery(qu)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	peers, total := h.QueryPeers(q)
 	resp := struct {
 		Stats
-		UserList []userStats `json:"user_list,omitempty"`
-	}{Stats: st}
-	for _, p := range h.Peers() {
+		UserList  []userStats `json:"user_list,omitempty"`
+		UserTotal int         `json:"user_total"`
+	}{Stats: st, UserTotal: total}
+	for _, p := range peers {
 		u := p.UserInfo()
 		resp.UserList = append(resp.UserList, userStats{
 			Name: u.Name, Share: u.Share,
@@ -140,6 +183,395 @@ func (h *Hub) serveV0Stats(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// httpPeerQuery parses user list parameters: "offset", "limit" and "sort" (by "name" or "share").
+func httpPeerQuery(qu url.Values) (PeerQuery, error) {
+	var q PeerQuery
+	for _, k := range []string{"offset", "limit"} {
+		s := qu.Get(k)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return q, fmt.Errorf("invalid %s: %q", k, s)
+		}
+		if k == "offset" {
+			q.Offset = v
+		} else {
+			q.Limit = v
+		}
+	}
+	switch s := qu.Get("sort"); s {
+	case "":
+	case "name":
+		q.Order = OrderName
+	case "share":
+		q.Order = OrderShare
+	default:
+		return q, fmt.Errorf("unsupported sort order: %q", s)
+	}
+	return q, nil
+}
+
+func (h *Hub) serveV0Snapshot(w http.ResponseWriter, r *http.Request) {
+	hd := w.Header()
+	hd.Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Snapshot())
+}
+
+// serveV0Changes streams user list changes as newline-delimited JSON.
+// The stream starts after the sequence number passed in the "since" parameter.
+func (h *Hub) serveV0Changes(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = v
+	}
+	changes, cancel := h.SubscribeChanges(since, 0)
+	defer cancel()
+
+	hd := w.Header()
+	hd.Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.closed:
+			return
+		case c, ok := <-changes:
+			if !ok {
+				// subscriber is too slow, or the changes are no longer available
+				return
+			}
+			if err := enc.Encode(c); err != nil {
+				return
+			}
+			if flusher != nil && len(changes) == 0 {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// httpAdmin checks if the request is allowed to use administrative endpoints.
+// It writes an error response if it's not.
+func (h *Hub) httpAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := h.conf.APIToken
+	if token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) ||
+		subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// httpAuditQuery parses audit log filters: "action", "actor", "target", "since" (RFC 3339) and "limit".
+func httpAuditQuery(qu url.Values) (AuditQuery, error) {
+	q := AuditQuery{
+		Action: qu.Get("action"),
+		Actor:  qu.Get("actor"),
+		Target: qu.Get("target"),
+		Limit:  100,
+	}
+	if s := qu.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, fmt.Errorf("invalid since: %q", s)
+		}
+		q.Since = t
+	}
+	if s := qu.Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return q, fmt.Errorf("invalid limit: %q", s)
+		}
+		q.Limit = v
+	}
+	return q, nil
+}
+
+// serveV0Audit returns entries of the audit log, starting from the most recent one.
+func (h *Hub) serveV0Audit(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	q, err := httpAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := h.Audit(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []AuditEntry{}
+	}
+	hd := w.Header()
+	hd.Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// serveV0Notes manages notes about users. GET returns notes about the "target", POST adds a note
+// from the JSON body, and DELETE removes the note with a given "target" and "time" (RFC 3339).
+func (h *Hub) serveV0Notes(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	qu := r.URL.Query()
+	switch r.Method {
+	case "GET":
+		list, err := h.Notes(qu.Get("target"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []UserNote{}
+		}
+		hd := w.Header()
+		hd.Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	case "POST":
+		var n UserNote
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n.Time = time.Time{}
+		if err := h.AddNote(n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.audit(AuditNote, nil, n.Target, "add "+n.Tag+n.Text)
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		t, err := time.Parse(time.RFC3339Nano, qu.Get("time"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid time: %q", qu.Get("time")), http.StatusBadRequest)
+			return
+		}
+		target := qu.Get("target")
+		if err := h.DelNote(target, t); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.audit(AuditNote, nil, target, "del")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveV0Watch manages the watchlist. GET returns all entries, POST adds an entry from the JSON body,
+// and DELETE removes the entry with a given "pattern".
+func (h *Hub) serveV0Watch(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		hd := w.Header()
+		hd.Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Watchlist())
+	case "POST":
+		var e WatchEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.Added = time.Time{}
+		if err := h.AddWatch(e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.audit(AuditWatch, nil, e.Pattern, strings.TrimSpace("add "+e.Action+" "+e.Reason))
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		pattern := r.URL.Query().Get("pattern")
+		if err := h.DelWatch(pattern); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.audit(AuditWatch, nil, pattern, "del")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveV0SearchStats returns search statistics. It accepts the "period" (for example, "1h")
+// and the number of "top" search terms to return.
+func (h *Hub) serveV0SearchStats(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	qu := r.URL.Query()
+	period, top := time.Hour, 10
+	if s := qu.Get("period"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid period: %q", s), http.StatusBadRequest)
+			return
+		}
+		period = d
+	}
+	if s := qu.Get("top"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			http.Error(w, fmt.Sprintf("invalid top: %q", s), http.StatusBadRequest)
+			return
+		}
+		top = v
+	}
+	st, ok := h.SearchStats(period, top)
+	if !ok {
+		http.Error(w, "search statistics are disabled", http.StatusNotFound)
+		return
+	}
+	hd := w.Header()
+	hd.Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// sharedFileResult is a single result of the shared files search.
+type sharedFileResult struct {
+	User string `json:"user"`
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+	Size uint64 `json:"size,omitempty"`
+	TTH  *TTH   `json:"tth,omitempty"`
+}
+
+// httpSharedSearch runs the shared files search for "q" and "limit" query parameters.
+func (h *Hub) httpSharedSearch(w http.ResponseWriter, r *http.Request) ([]sharedFileResult, bool) {
+	if h.sharedFiles == nil {
+		http.Error(w, errSharedFilesDisabled.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	qu := r.URL.Query()
+	limit := 0
+	if s := qu.Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %q", s), http.StatusBadRequest)
+			return nil, false
+		}
+		limit = v
+	}
+	terms := strings.Fields(qu.Get("q"))
+	if len(terms) == 0 {
+		return []sharedFileResult{}, true
+	}
+	res, _ := h.SearchSharedFiles(NameSearch{And: terms}, limit)
+	out := make([]sharedFileResult, 0, len(res))
+	for _, r := range res {
+		switch r := r.(type) {
+		case File:
+			out = append(out, sharedFileResult{User: r.Peer.Name(), Path: r.Path, Size: r.Size, TTH: r.TTH})
+		case Dir:
+			out = append(out, sharedFileResult{User: r.Peer.Name(), Path: r.Path, Dir: true})
+		}
+	}
+	return out, true
+}
+
+func (h *Hub) serveV0Files(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.httpSharedSearch(w, r)
+	if !ok {
+		return
+	}
+	hd := w.Header()
+	hd.Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Hub) serveFiles(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.httpSharedSearch(w, r)
+	if !ok {
+		return
+	}
+	st, _ := h.SharedFilesStats()
+	hd := w.Header()
+	hd.Set("Content-Type", "text/html")
+	_ = filesTmpl.Execute(w, struct {
+		Name    string
+		Query   string
+		Stats   SharedFilesStats
+		Results []sharedFileResult
+	}{
+		Name: h.Stats().Name, Query: r.URL.Query().Get("q"),
+		Stats: st, Results: res,
+	})
+}
+
+// serveV0FileList accepts file lists of users that opted in to the shared files index.
+// The user is identified by the token given by the "sharefiles" command.
+func (h *Hub) serveV0FileList(w http.ResponseWriter, r *http.Request) {
+	if h.sharedFiles == nil {
+		http.Error(w, errSharedFilesDisabled.Error(), http.StatusNotFound)
+		return
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	token := auth[len(prefix):]
+	switch r.Method {
+	case "PUT", "POST":
+		body := http.MaxBytesReader(w, r.Body, h.sharedFiles.conf.MaxListSize)
+		list, err := decodeSharedList(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l, err := h.sharedFiles.upload(token, list)
+		switch err {
+		case nil:
+		case errSharedFilesToken:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case errSharedFilesBase:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		hd := w.Header()
+		hd.Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SharedFilesStats{Users: 1, Files: l.files, Size: l.size})
+	case "DELETE":
+		if err := h.sharedFiles.clear(token); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "PUT, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 var errHTTPStop = errors.New("http: stopping after a single connection")
 
 var _ net.Listener = (*singleListen)(nil)
@@ -228,3 +660,40 @@ const indexTemplate = `<!DOCTYPE html>
 	</div>
 </body>
 </html>`
+
+var filesTmpl = template.Must(template.New("").Parse(filesTemplate))
+
+const filesTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>{{ .Name }}: files</title>
+	<style>
+		td {
+			padding-right: 10px;
+		}
+	</style>
+</head>
+<body>
+	<h2>{{ .Name }}</h2>
+	<p>Files shared by {{ .Stats.Users }} users: {{ .Stats.Files }}</p>
+	<form action="" method="get">
+		<input type="text" name="q" value="{{ .Query }}" autofocus>
+		<input type="submit" value="Search">
+	</form>
+	{{ if .Query }}
+	<table>
+	{{ range .Results }}
+		<tr>
+			<td>{{ .User }}</td>
+			<td>{{ .Path }}</td>
+			<td>{{ if not .Dir }}{{ .Size }}{{ end }}</td>
+			<td>{{ if .TTH }}<a href="magnet:?xt=urn:tree:tiger:{{ .TTH }}&xl={{ .Size }}">magnet</a>{{ end }}</td>
+		</tr>
+	{{ else }}
+		<tr><td>Nothing found</td></tr>
+	{{ end }}
+	</table>
+	{{ end }}
+</body>
+</html>`
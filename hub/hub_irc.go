@@ -6,6 +6,9 @@ import (
 	"io"
 	"log"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -66,14 +69,105 @@ func (h *Hub) ServeIRC(conn net.Conn, cinfo *ConnInfo) error {
 			dst, msg := m.Params[0], m.Params[1]
 			if dst == ircHubChan {
 				h.globalChat.SendChat(peer, Message{Text: msg})
+			} else if strings.HasPrefix(dst, "#") {
+				if r := h.Room(dst); r != nil && r.InRoom(peer) {
+					r.SendChat(peer, Message{Text: msg})
+				} else {
+					err = peer.writeMessage(&irc.Message{
+						Prefix:  peer.hostPref,
+						Command: "404",
+						Params:  []string{peer.Name(), dst, "Cannot send to channel"},
+					})
+					if err != nil {
+						return err
+					}
+				}
 			} else if dst := h.PeerByName(dst); dst != nil {
 				h.privateChat(peer, dst, Message{
 					Name: peer.Name(),
 					Text: msg,
 				})
+				err = h.ircSendAway(peer, dst)
+				if err != nil {
+					return err
+				}
+			}
+		case "JOIN":
+			if len(m.Params) == 0 {
+				continue
+			}
+			err = h.ircJoin(peer, m.Params)
+			if err != nil {
+				return err
+			}
+		case "PART":
+			if len(m.Params) == 0 {
+				continue
+			}
+			for _, name := range strings.Split(m.Params[0], ",") {
+				if name == ircHubChan {
+					continue
+				}
+				if r := h.Room(name); r != nil {
+					r.Leave(peer)
+				}
+			}
+		case "INVITE":
+			if len(m.Params) < 2 {
+				continue
+			}
+			err = h.ircInvite(peer, m.Params[0], m.Params[1])
+			if err != nil {
+				return err
+			}
+		case "KICK":
+			if len(m.Params) < 2 {
+				continue
+			}
+			reason := ""
+			if len(m.Params) > 2 {
+				reason = m.Params[2]
+			}
+			err = h.ircKick(peer, m.Params[0], m.Params[1], reason)
+			if err != nil {
+				return err
+			}
+		case "AWAY":
+			msg := ""
+			if len(m.Params) != 0 {
+				msg = m.Params[0]
+			}
+			err = h.ircSetAway(peer, msg)
+			if err != nil {
+				return err
+			}
+		case "WHOIS":
+			if len(m.Params) == 0 {
+				continue
+			}
+			// the first parameter may be a server name
+			err = h.ircWhois(peer, m.Params[len(m.Params)-1])
+			if err != nil {
+				return err
+			}
+		case "WHO":
+			mask := ""
+			if len(m.Params) != 0 {
+				mask = m.Params[0]
+			}
+			err = h.ircWho(peer, mask)
+			if err != nil {
+				return err
+			}
+		case "LIST":
+			err = h.ircList(peer)
+			if err != nil {
+				return err
 			}
 		case "QUIT":
 			return nil
+		case "PONG":
+			// reply to a keepalive, see idleReaper
 		default:
 			// TODO
 			log.Printf("%s: irc: %s", peer.RemoteAddr(), m)
@@ -97,7 +191,7 @@ func (h *Hub) ircHandshake(conn net.Conn, cinfo *ConnInfo) (*ircPeer, error) {
 		unbind func()
 	)
 	for {
-		deadline := time.Now().Add(time.Second * 5)
+		deadline := h.handshakeDeadline()
 		_ = conn.SetReadDeadline(deadline)
 
 		m, err := c.ReadMessage()
@@ -121,16 +215,30 @@ func (h *Hub) ircHandshake(conn net.Conn, cinfo *ConnInfo) (*ircPeer, error) {
 			user = m.Params[0]
 		}
 		name = tname
-		err = h.validateUserName(name)
+		err = h.validatePeerName(name)
 		if err != nil {
 			return nil, err
 		}
+		// IRC users cannot authenticate, thus registered names are not available to them
+		if prov, _, err := h.findUser(name); err != nil {
+			return nil, err
+		} else if prov != nil {
+			_ = c.WriteMessage(&irc.Message{
+				Prefix:  pref,
+				Command: "433",
+				Params:  []string{"*", name, h.errText(nil, errNameReserved)},
+			})
+			continue
+		}
+		if err = h.checkMultiLogin(name, conn.RemoteAddr(), nil); err != nil {
+			return nil, err
+		}
 
 		if !h.nameAvailable(name, nil) {
 			_ = c.WriteMessage(&irc.Message{
 				Prefix:  pref,
 				Command: "433",
-				Params:  []string{"*", name, errNickTaken.Error()},
+				Params:  []string{"*", name, h.errText(nil, errNickTaken)},
 			})
 			continue
 		}
@@ -143,7 +251,7 @@ func (h *Hub) ircHandshake(conn net.Conn, cinfo *ConnInfo) (*ircPeer, error) {
 		_ = c.WriteMessage(&irc.Message{
 			Prefix:  pref,
 			Command: "433",
-			Params:  []string{"*", name, errNickTaken.Error()},
+			Params:  []string{"*", name, h.errText(nil, errNickTaken)},
 		})
 	}
 	conn.SetReadDeadline(time.Time{})
@@ -158,12 +266,16 @@ func (h *Hub) ircHandshake(conn net.Conn, cinfo *ConnInfo) (*ircPeer, error) {
 		c:    c,
 		conn: conn,
 	}
-	h.newBasePeer(&peer.BasePeer, cinfo)
+	if err := h.newBasePeer(&peer.BasePeer, cinfo); err != nil {
+		unbind()
+		return nil, err
+	}
 	peer.setName(name)
 
 	err := h.ircAccept(peer)
 	if err != nil {
 		unbind()
+		h.abortPeer(peer)
 		return nil, err
 	}
 
@@ -171,6 +283,9 @@ func (h *Hub) ircHandshake(conn net.Conn, cinfo *ConnInfo) (*ircPeer, error) {
 }
 
 func (h *Hub) ircAccept(peer *ircPeer) error {
+	if !h.authzJoin(peer) {
+		return errAccessDenied
+	}
 	err := peer.writeMessage(&irc.Message{
 		Prefix:  peer.hostPref,
 		Command: "001",
@@ -295,9 +410,291 @@ waitJoin:
 	return nil
 }
 
+// ircJoin joins the user to rooms given in the JOIN command. The hub channel is always joined.
+func (h *Hub) ircJoin(peer *ircPeer, params []string) error {
+	var keys []string
+	if len(params) > 1 {
+		keys = strings.Split(params[1], ",")
+	}
+	for i, name := range strings.Split(params[0], ",") {
+		if name == ircHubChan {
+			continue
+		}
+		key := ""
+		if i < len(keys) {
+			key = keys[i]
+		}
+		_, err := h.JoinRoom(peer, name, key)
+		if err == nil {
+			continue
+		}
+		code, text := "403", "No such channel"
+		switch err {
+		case errRoomInviteOnly:
+			code, text = "473", "Cannot join channel (+i)"
+		case errRoomForbidden:
+			code, text = "474", "Cannot join channel (+b)"
+		case errRoomPassword:
+			code, text = "475", "Cannot join channel (+k)"
+		}
+		err = peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: code,
+			Params:  []string{peer.Name(), name, text},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ircRoomError sends an error numeric related to a room command.
+func (h *Hub) ircRoomError(peer *ircPeer, channel string, err error) error {
+	code, text := "403", "No such channel"
+	switch err {
+	case errRoomNotMod, errRoomNotOwner:
+		code, text = "482", "You're not channel operator"
+	case errRoomNotInRoom:
+		code, text = "441", "They aren't on that channel"
+	case nil:
+	default:
+		code, text = "400", err.Error()
+	}
+	return peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: code,
+		Params:  []string{peer.Name(), channel, text},
+	})
+}
+
+// ircInvite handles the INVITE command of an IRC user.
+func (h *Hub) ircInvite(peer *ircPeer, nick, channel string) error {
+	r := h.Room(channel)
+	if r == nil {
+		return h.ircRoomError(peer, channel, nil)
+	}
+	to := h.PeerByName(nick)
+	if to == nil {
+		return peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "401",
+			Params:  []string{peer.Name(), nick, "No such nick/channel"},
+		})
+	}
+	if err := h.InviteToRoom(peer, r, to, 0); err != nil {
+		return h.ircRoomError(peer, channel, err)
+	}
+	return peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "341",
+		Params:  []string{peer.Name(), to.Name(), channel},
+	})
+}
+
+// ircKick handles the KICK command of an IRC user. Users are only removed from the room.
+func (h *Hub) ircKick(peer *ircPeer, channel, nick, reason string) error {
+	r := h.Room(channel)
+	if r == nil {
+		return h.ircRoomError(peer, channel, nil)
+	}
+	to := h.PeerByName(nick)
+	if to == nil {
+		return peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "401",
+			Params:  []string{peer.Name(), nick, "No such nick/channel"},
+		})
+	}
+	if err := h.KickFromRoom(peer, r, to, reason); err != nil {
+		return h.ircRoomError(peer, channel, err)
+	}
+	h.audit(AuditRoom, peer, channel, strings.TrimSpace("kick "+to.Name()+" "+reason))
+	return nil
+}
+
+func (h *Hub) ircWhois(peer *ircPeer, name string) error {
+	p2 := h.PeerByName(name)
+	if p2 == nil {
+		return peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "401",
+			Params:  []string{peer.Name(), name, "No such nick/channel"},
+		})
+	}
+	u := p2.UserInfo()
+	user := peer.prefixOf(p2, u.Name).User
+	err := peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "311",
+		Params:  []string{peer.Name(), u.Name, user, peer.hostPref.Name, "*", u.Desc},
+	})
+	if err != nil {
+		return err
+	}
+	err = peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "312",
+		Params:  []string{peer.Name(), u.Name, peer.hostPref.Name, h.getName()},
+	})
+	if err != nil {
+		return err
+	}
+	err = h.ircSendAway(peer, p2)
+	if err != nil {
+		return err
+	}
+	err = peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "320",
+		Params: []string{peer.Name(), u.Name, fmt.Sprintf(
+			"shares %d MB (%d files), client %s %s",
+			u.Share/shareDiv, u.ShareFiles, u.App.Name, u.App.Version,
+		)},
+	})
+	if err != nil {
+		return err
+	}
+	return peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "318",
+		Params:  []string{peer.Name(), u.Name, "End of /WHOIS list"},
+	})
+}
+
+// ircAwayDefault is sent to IRC users for away peers that did not set an away message.
+// DC protocols only have an away flag, thus it is used for all DC peers.
+const ircAwayDefault = "Away"
+
+// ircSetAway sets or clears (if the message is empty) the away status of an IRC user
+// and notifies other peers about the change.
+func (h *Hub) ircSetAway(peer *ircPeer, msg string) error {
+	peer.amu.Lock()
+	changed := (peer.away == "") != (msg == "")
+	peer.away = msg
+	peer.amu.Unlock()
+
+	var err error
+	if msg == "" {
+		err = peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "305",
+			Params:  []string{peer.Name(), "You are no longer marked as being away"},
+		})
+	} else {
+		err = peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "306",
+			Params:  []string{peer.Name(), "You have been marked as being away"},
+		})
+	}
+	if changed {
+		h.broadcastUserUpdate(peer, nil)
+	}
+	return err
+}
+
+// ircSendAway sends the away message of the peer (RPL_AWAY), if it's away.
+func (h *Hub) ircSendAway(peer *ircPeer, p2 Peer) error {
+	var msg string
+	if a, ok := p2.(ircUser); ok {
+		msg = a.awayMsg()
+	} else if p2.UserInfo().Away {
+		msg = ircAwayDefault
+	}
+	if msg == "" {
+		return nil
+	}
+	return peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "301",
+		Params:  []string{peer.Name(), p2.Name(), msg},
+	})
+}
+
+// ircWho lists users with names matching the mask. An empty mask or a channel name lists all users.
+func (h *Hub) ircWho(peer *ircPeer, mask string) error {
+	var filter PeerFilter
+	if mask != "" && mask != "*" && mask != "0" && mask != ircHubChan {
+		filter = h.PeerNameMatch(mask)
+	}
+	peers, _ := h.QueryPeers(PeerQuery{Filter: filter, Order: OrderName})
+	for _, p2 := range peers {
+		u := p2.UserInfo()
+		user := peer.prefixOf(p2, u.Name).User
+		flags := "H"
+		if u.Away {
+			flags = "G"
+		}
+		if pu := p2.User(); pu != nil && pu.IsOp() {
+			flags += "@"
+		}
+		if u.Kind == UserBot || u.Kind == UserHub {
+			flags += "B"
+		}
+		err := peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "352",
+			Params: []string{
+				peer.Name(), ircHubChan, user, peer.hostPref.Name, peer.hostPref.Name,
+				u.Name, flags, "0 " + u.Desc,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if mask == "" {
+		mask = "*"
+	}
+	return peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "315",
+		Params:  []string{peer.Name(), mask, "End of WHO list"},
+	})
+}
+
+// ircList lists available channels: the hub channel and chat rooms.
+func (h *Hub) ircList(peer *ircPeer) error {
+	err := peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "321",
+		Params:  []string{peer.Name(), "Channel", "Users  Name"},
+	})
+	if err != nil {
+		return err
+	}
+	err = peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "322",
+		Params:  []string{peer.Name(), ircHubChan, strconv.Itoa(len(h.Peers())), h.getTopic()},
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range h.Rooms() {
+		err = peer.writeMessage(&irc.Message{
+			Prefix:  peer.hostPref,
+			Command: "322",
+			Params:  []string{peer.Name(), r.Name(), strconv.Itoa(r.Users()), r.Topic()},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return peer.writeMessage(&irc.Message{
+		Prefix:  peer.hostPref,
+		Command: "323",
+		Params:  []string{peer.Name(), "End of /LIST"},
+	})
+}
+
 type ircPeer struct {
 	BasePeer
 
+	amu  sync.Mutex
+	away string // away message; empty if the user is not away
+
 	hostPref *irc.Prefix
 	ownPref  *irc.Prefix
 
@@ -308,13 +705,22 @@ type ircPeer struct {
 	c   *irc.Conn
 }
 
-func (*ircPeer) Searchable() bool {
-	return false
+func (*ircPeer) protocol() string {
+	return ProtoIRC
+}
+
+func (*ircPeer) Capabilities() PeerCaps {
+	return CapRooms | CapPrivate
 }
 
+// writeMessage writes the message to the connection. IRC peers write synchronously,
+// so the write lock is also used by Close to make sure no writes happen after it returns.
 func (p *ircPeer) writeMessage(m *irc.Message) error {
 	p.wmu.Lock()
 	defer p.wmu.Unlock()
+	if !p.Online() {
+		return errConnectionClosed
+	}
 	return p.c.WriteMessage(m)
 }
 
@@ -324,9 +730,35 @@ func (p *ircPeer) readMessage() (*irc.Message, error) {
 	return p.c.ReadMessage()
 }
 
+// ircUser is implemented by peers that have their own IRC identity.
+type ircUser interface {
+	ircPrefix() *irc.Prefix
+	awayMsg() string
+}
+
+func (p *ircPeer) ircPrefix() *irc.Prefix {
+	return p.ownPref
+}
+
+func (p *ircPeer) awayMsg() string {
+	p.amu.Lock()
+	defer p.amu.Unlock()
+	return p.away
+}
+
+// prefixOf returns the IRC prefix of the peer. Peers without an IRC identity use the name
+// as a user name.
+func (p *ircPeer) prefixOf(peer Peer, name string) *irc.Prefix {
+	if u, ok := peer.(ircUser); ok {
+		return u.ircPrefix()
+	}
+	return &irc.Prefix{Name: name, User: name, Host: p.hostPref.Name}
+}
+
 func (p *ircPeer) UserInfo() UserInfo {
 	return UserInfo{
 		Name: p.Name(),
+		Away: p.awayMsg() != "",
 		App: dc.Software{
 			// TODO: propagate the real IRC client version
 			Name:    "DC-IRC bridge",
@@ -338,6 +770,12 @@ func (p *ircPeer) UserInfo() UserInfo {
 func (p *ircPeer) Close() error {
 	return p.closeWith(p,
 		p.conn.Close,
+		func() error {
+			// wait for the write in progress, if any; it was unblocked by closing the connection
+			p.wmu.Lock()
+			p.wmu.Unlock()
+			return nil
+		},
 		func() error {
 			p.hub.leave(p, p.sid, nil)
 			return nil
@@ -351,16 +789,7 @@ func (p *ircPeer) PeersJoin(e *PeersJoinEvent) error {
 			Command: "JOIN",
 			Params:  []string{ircHubChan},
 		}
-		if p2, ok := peer.(*ircPeer); ok {
-			m.Prefix = p2.ownPref
-		} else {
-			name := peer.Name()
-			m.Prefix = &irc.Prefix{
-				Name: name,
-				User: name,
-				Host: p.hostPref.Name,
-			}
-		}
+		m.Prefix = p.prefixOf(peer, peer.Name())
 		if err := p.writeMessage(m); err != nil {
 			return err
 		}
@@ -378,16 +807,7 @@ func (p *ircPeer) PeersLeave(e *PeersLeaveEvent) error {
 			Command: "PART",
 			Params:  []string{ircHubChan, "disconnect"},
 		}
-		if p2, ok := peer.(*ircPeer); ok {
-			m.Prefix = p2.ownPref
-		} else {
-			name := peer.Name()
-			m.Prefix = &irc.Prefix{
-				Name: name,
-				User: name,
-				Host: p.hostPref.Name,
-			}
-		}
+		m.Prefix = p.prefixOf(peer, peer.Name())
 		if err := p.writeMessage(m); err != nil {
 			return err
 		}
@@ -396,11 +816,67 @@ func (p *ircPeer) PeersLeave(e *PeersLeaveEvent) error {
 }
 
 func (p *ircPeer) JoinRoom(room *Room) error {
-	return nil // FIXME
+	name := room.Name()
+	if name == "" {
+		return nil
+	}
+	err := p.writeMessage(&irc.Message{
+		Prefix:  p.ownPref,
+		Command: "JOIN",
+		Params:  []string{name},
+	})
+	if err != nil {
+		return err
+	}
+	if topic := room.Topic(); topic != "" {
+		err = p.writeMessage(&irc.Message{
+			Prefix:  p.hostPref,
+			Command: "332",
+			Params:  []string{p.Name(), name, topic},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	var names []string
+	for _, p2 := range room.Peers() {
+		names = append(names, p2.Name())
+	}
+	sort.Strings(names)
+	err = p.writeMessage(&irc.Message{
+		Prefix:  p.hostPref,
+		Command: "353",
+		Params:  []string{p.Name(), "=", name, strings.Join(names, " ")},
+	})
+	if err != nil {
+		return err
+	}
+	return p.writeMessage(&irc.Message{
+		Prefix:  p.hostPref,
+		Command: "366",
+		Params:  []string{p.Name(), name, "End of /NAMES list"},
+	})
+}
+
+func (p *ircPeer) RoomInvite(from Peer, room *Room) error {
+	m := &irc.Message{
+		Command: "INVITE",
+		Params:  []string{p.Name(), room.Name()},
+	}
+	m.Prefix = p.prefixOf(from, from.Name())
+	return p.writeMessage(m)
 }
 
 func (p *ircPeer) LeaveRoom(room *Room) error {
-	return nil // FIXME
+	name := room.Name()
+	if name == "" {
+		return nil
+	}
+	return p.writeMessage(&irc.Message{
+		Prefix:  p.ownPref,
+		Command: "PART",
+		Params:  []string{name},
+	})
 }
 
 func (p *ircPeer) ChatMsg(room *Room, from Peer, msg Message) error {
@@ -408,23 +884,15 @@ func (p *ircPeer) ChatMsg(room *Room, from Peer, msg Message) error {
 		// no echo
 		return nil
 	}
+	channel := ircHubChan
 	if room != nil && room.Name() != "" {
-		return nil // FIXME
+		channel = room.Name()
 	}
 	m := &irc.Message{
 		Command: "PRIVMSG",
-		Params:  []string{ircHubChan, msg.Text},
-	}
-	if p2, ok := from.(*ircPeer); ok {
-		m.Prefix = p2.ownPref
-	} else {
-		name := msg.Name
-		m.Prefix = &irc.Prefix{
-			Name: name,
-			User: name,
-			Host: p.hostPref.Name,
-		}
+		Params:  []string{channel, msg.Text},
 	}
+	m.Prefix = p.prefixOf(from, msg.Name)
 	return p.writeMessage(m)
 }
 
@@ -433,16 +901,7 @@ func (p *ircPeer) PrivateMsg(from Peer, msg Message) error {
 		Command: "PRIVMSG",
 		Params:  []string{p.Name(), msg.Text},
 	}
-	if p2, ok := from.(*ircPeer); ok {
-		m.Prefix = p2.ownPref
-	} else {
-		name := msg.Name
-		m.Prefix = &irc.Prefix{
-			Name: name,
-			User: name,
-			Host: p.hostPref.Name,
-		}
-	}
+	m.Prefix = p.prefixOf(from, msg.Name)
 	return p.writeMessage(m)
 }
 
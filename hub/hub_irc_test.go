@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/go-irc/irc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func newTestIRCPeer(t testing.TB, h *Hub, name string) (*ircPeer, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	p := &ircPeer{
+		hostPref: &irc.Prefix{Name: "localhost"},
+		ownPref:  &irc.Prefix{Name: name, User: name, Host: "localhost"},
+		conn:     discardConn{},
+		c:        irc.NewConn(buf),
+	}
+	err := h.newBasePeer(&p.BasePeer, &ConnInfo{Local: discardConn{}.LocalAddr(), Remote: discardConn{}.RemoteAddr()})
+	require.NoError(t, err)
+	p.setName(name)
+	h.acceptPeer(p, nil, nil)
+	return p, buf
+}
+
+// sentIRC parses all messages written to the buffer and clears it.
+func sentIRC(t testing.TB, buf *bytes.Buffer) []*irc.Message {
+	var out []*irc.Message
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		m, err := irc.ParseMessage(sc.Text())
+		require.NoError(t, err)
+		out = append(out, m)
+	}
+	buf.Reset()
+	return out
+}
+
+func TestIRCAway(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	p, buf := newTestIRCPeer(t, h, "irc")
+	p2, buf2 := newTestIRCPeer(t, h, "irc2")
+	dc := newTestADCPeer(t, h, "adc")
+	sentADC(dc)
+
+	require.NoError(t, h.ircSetAway(p, "gone fishing"))
+	got := sentIRC(t, buf)
+	require.Len(t, got, 1)
+	require.Equal(t, "306", got[0].Command)
+	require.True(t, p.UserInfo().Away)
+	require.True(t, peerSnapshot(p).Away)
+
+	// DC peers see the IRC user as away
+	pkts := sentADC(dc)
+	require.Len(t, pkts, 1)
+	b, ok := pkts[0].(*adc.BroadcastPacket)
+	require.True(t, ok, "%T", pkts[0])
+	require.Equal(t, p.SID(), b.ID)
+	require.Contains(t, string(b.Data), "AW1")
+
+	// other IRC users get the away message
+	require.NoError(t, h.ircSendAway(p2, p))
+	got = sentIRC(t, buf2)
+	require.Len(t, got, 1)
+	require.Equal(t, "301", got[0].Command)
+	require.Equal(t, []string{"irc2", "irc", "gone fishing"}, got[0].Params)
+
+	// and a default one for away DC peers
+	dc.info.Lock()
+	dc.info.user.Away = adc.AwayTypeNormal
+	dc.info.Unlock()
+	require.NoError(t, h.ircSendAway(p2, dc))
+	got = sentIRC(t, buf2)
+	require.Len(t, got, 1)
+	require.Equal(t, []string{"irc2", "adc", ircAwayDefault}, got[0].Params)
+
+	require.NoError(t, h.ircSetAway(p, ""))
+	got = sentIRC(t, buf)
+	require.Len(t, got, 1)
+	require.Equal(t, "305", got[0].Command)
+	require.False(t, p.UserInfo().Away)
+	require.Len(t, sentADC(dc), 1)
+
+	// not away - nothing is sent
+	require.NoError(t, h.ircSendAway(p2, p))
+	require.Empty(t, sentIRC(t, buf2))
+}
+
+func TestIRCWho(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	p, buf := newTestIRCPeer(t, h, "irc")
+	dc := newTestADCPeer(t, h, "adc")
+	dc.info.user.Away = adc.AwayTypeNormal
+	buf.Reset()
+
+	require.NoError(t, h.ircWho(p, "A*"))
+	got := sentIRC(t, buf)
+	require.Len(t, got, 2)
+	require.Equal(t, "352", got[0].Command)
+	require.Equal(t, "adc", got[0].Params[5])
+	require.Equal(t, "G", got[0].Params[6])
+	require.Equal(t, "315", got[1].Command)
+	require.Equal(t, "A*", got[1].Params[1])
+}
+
+func TestIRCWhois(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	p, buf := newTestIRCPeer(t, h, "irc")
+	dc := newTestADCPeer(t, h, "adc")
+	dc.info.user.Desc = "some desc"
+	dc.info.user.ShareSize = 3 << 20
+	dc.info.user.ShareFiles = 7
+	dc.info.user.Application = "app"
+	dc.info.user.Version = "1.0"
+	buf.Reset()
+
+	require.NoError(t, h.ircWhois(p, "adc"))
+	got := sentIRC(t, buf)
+	require.Len(t, got, 4)
+	require.Equal(t, "311", got[0].Command)
+	require.Equal(t, []string{"irc", "adc", "adc", "localhost", "*", "some desc"}, got[0].Params)
+	require.Equal(t, "312", got[1].Command)
+	require.Equal(t, "320", got[2].Command)
+	require.Equal(t, "shares 3 MB (7 files), client app 1.0", got[2].Params[2])
+	require.Equal(t, "318", got[3].Command)
+
+	require.NoError(t, h.ircWhois(p, "missing"))
+	got = sentIRC(t, buf)
+	require.Len(t, got, 1)
+	require.Equal(t, "401", got[0].Command)
+	require.Equal(t, "missing", got[0].Params[1])
+}
@@ -0,0 +1,583 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dcpp/version"
+)
+
+// Matrix bridge is implemented as an application service (AS): the homeserver pushes room events
+// to the hub, and the hub sends messages of DC users on behalf of puppet Matrix users.
+//
+// Matrix users are represented in the hub by virtual peers, similar to IRC users. DC users are
+// represented in Matrix by puppets named "@<prefix><nick>:<domain>", that are registered and
+// joined to the bridged rooms on the first message. Private messages are not bridged.
+
+const (
+	matrixDebug = false
+
+	// MatrixTransactionsPath is a path of the application service API that receives events from the homeserver.
+	MatrixTransactionsPath = "/_matrix/app/v1/transactions/"
+
+	matrixClientPath = "/_matrix/client/r0"
+
+	// DefaultMatrixPrefix is the default prefix of Matrix puppets for DC users.
+	DefaultMatrixPrefix = "dc_"
+	// DefaultMatrixSuffix is the default suffix of names of Matrix users in the hub.
+	DefaultMatrixSuffix = "[m]"
+
+	matrixQueueSize = 256
+	matrixTimeout   = 30 * time.Second
+	matrixMaxTxns   = 1024
+)
+
+// MatrixConfig configures a bridge to Matrix.
+type MatrixConfig struct {
+	// Homeserver is the URL of the client-server API of the homeserver, for example https://matrix.example.org.
+	Homeserver string
+	// Domain is the server name of the homeserver, for example example.org.
+	Domain string
+	// Name of the relay user in the hub. Zero value means "Matrix".
+	Name string
+	// ASToken authorizes the hub on the homeserver.
+	ASToken string
+	// HSToken authorizes the homeserver on the hub.
+	HSToken string
+	// Prefix of Matrix puppets for DC users. Zero value means DefaultMatrixPrefix.
+	// The prefix must match the user namespace of the application service registration.
+	Prefix string
+	// Suffix is added to names of Matrix users in the hub. Zero value means DefaultMatrixSuffix.
+	Suffix string
+	// Rooms maps hub rooms to Matrix room IDs. Empty name is the main chat.
+	Rooms map[string]string
+}
+
+var _ Peer = (*matrixPeer)(nil)
+
+// matrixPeer is a Matrix user in the hub. The relay peer forwards hub messages to Matrix.
+type matrixPeer struct {
+	BasePeer
+	b     *matrixBridge
+	mxid  string // empty for the relay
+	relay bool
+}
+
+func (p *matrixPeer) protocol() string {
+	if p.relay {
+		return ProtoBot
+	}
+	return ProtoMatrix
+}
+
+func (*matrixPeer) Capabilities() PeerCaps {
+	return 0 // only the main chat is bridged
+}
+
+func (p *matrixPeer) UserInfo() UserInfo {
+	info := UserInfo{
+		Name:           p.Name(),
+		HubsNormal:     1,
+		HubsRegistered: 1,
+		App: dc.Software{
+			Name:    "DC-Matrix bridge",
+			Version: version.Vers,
+		},
+	}
+	if p.relay {
+		info.Kind = UserBot
+	} else {
+		info.Desc = p.mxid
+	}
+	return info
+}
+
+func (p *matrixPeer) Close() error {
+	return p.closeWith(p,
+		func() error {
+			p.hub.leave(p, p.sid, nil)
+			return nil
+		},
+	)
+}
+
+func (p *matrixPeer) PeersJoin(e *PeersJoinEvent) error {
+	return nil
+}
+
+func (p *matrixPeer) PeersUpdate(e *PeersUpdateEvent) error {
+	return nil
+}
+
+func (p *matrixPeer) PeersLeave(e *PeersLeaveEvent) error {
+	return nil
+}
+
+func (p *matrixPeer) JoinRoom(room *Room) error {
+	return nil
+}
+
+func (p *matrixPeer) LeaveRoom(room *Room) error {
+	return nil
+}
+
+func (p *matrixPeer) ChatMsg(room *Room, from Peer, msg Message) error {
+	if !p.relay {
+		return nil
+	}
+	if _, ok := from.(*matrixPeer); ok {
+		// no echo
+		return nil
+	}
+	name := ""
+	if room != nil && room != p.hub.globalChat {
+		name = room.Name()
+	}
+	p.b.forward(name, from.Name(), msg)
+	return nil
+}
+
+func (p *matrixPeer) PrivateMsg(from Peer, msg Message) error {
+	return nil // not bridged
+}
+
+func (p *matrixPeer) HubChatMsg(m Message) error {
+	return nil
+}
+
+func (p *matrixPeer) ConnectTo(peer Peer, addr string, token string, secure bool) error {
+	return nil
+}
+
+func (p *matrixPeer) RevConnectTo(peer Peer, token string, secure bool) error {
+	return nil
+}
+
+func (p *matrixPeer) Search(ctx context.Context, req SearchRequest, out Search) error {
+	return nil
+}
+
+// matrixOut is a message that is sent to Matrix on behalf of a DC user.
+type matrixOut struct {
+	room string // Matrix room ID
+	name string // DC user name
+	msg  Message
+}
+
+type matrixBridge struct {
+	h     *Hub
+	conf  MatrixConfig
+	cli   *http.Client
+	relay *matrixPeer
+	txn   uint64 // atomic
+
+	// byRoom maps Matrix room IDs to hub rooms; the main chat is an empty string
+	byRoom map[string]string
+	queue  chan matrixOut
+
+	mu    sync.Mutex
+	peers map[string]*matrixPeer // by Matrix user ID
+	txns  map[string]struct{}
+
+	// accessed only by the sender goroutine
+	puppets map[string]struct{} // registered puppets
+	joined  map[string]struct{} // puppet and room pairs
+}
+
+func (h *Hub) newMatrixBridge(conf MatrixConfig) (*matrixBridge, error) {
+	if conf.Homeserver == "" || conf.Domain == "" {
+		return nil, errors.New("matrix homeserver and domain must be set")
+	} else if conf.ASToken == "" || conf.HSToken == "" {
+		return nil, errors.New("matrix tokens must be set")
+	}
+	conf.Homeserver = strings.TrimSuffix(conf.Homeserver, "/")
+	if conf.Name == "" {
+		conf.Name = "Matrix"
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = DefaultMatrixPrefix
+	}
+	if conf.Suffix == "" {
+		conf.Suffix = DefaultMatrixSuffix
+	}
+	b := &matrixBridge{
+		h: h, conf: conf,
+		cli:     &http.Client{Timeout: matrixTimeout},
+		byRoom:  make(map[string]string),
+		queue:   make(chan matrixOut, matrixQueueSize),
+		peers:   make(map[string]*matrixPeer),
+		txns:    make(map[string]struct{}),
+		puppets: make(map[string]struct{}),
+		joined:  make(map[string]struct{}),
+	}
+	for name, id := range conf.Rooms {
+		b.byRoom[id] = name
+	}
+	relay, err := b.newPeer(conf.Name, "")
+	if err != nil {
+		return nil, err
+	}
+	b.relay = relay
+	for name := range conf.Rooms {
+		if name == "" {
+			continue
+		}
+		r, err := b.room(name)
+		if err != nil {
+			return nil, err
+		}
+		r.Join(relay)
+	}
+	return b, nil
+}
+
+// room returns a hub room with a given name, creating it if necessary.
+func (b *matrixBridge) room(name string) (*Room, error) {
+	if name == "" {
+		return b.h.globalChat, nil
+	}
+	if r := b.h.Room(name); r != nil {
+		return r, nil
+	}
+	r, err := b.h.NewRoom(name)
+	if err == ErrRoomExists {
+		return b.h.Room(name), nil
+	}
+	return r, err
+}
+
+// newPeer adds a virtual Matrix user to the hub. Empty mxid creates the relay peer.
+func (b *matrixBridge) newPeer(name, mxid string) (*matrixPeer, error) {
+	p := &matrixPeer{b: b, mxid: mxid, relay: mxid == ""}
+	if err := b.h.addVirtualPeer(p, name); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// matrixLocalpart returns a localpart of the Matrix user ID.
+func matrixLocalpart(mxid string) string {
+	s := strings.TrimPrefix(mxid, "@")
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// matrixEscape maps a DC user name to a valid localpart of a Matrix user ID,
+// as recommended by the Matrix specification.
+func matrixEscape(name string) string {
+	var buf strings.Builder
+	for _, c := range []byte(name) {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			buf.WriteByte('_')
+			buf.WriteByte(c - 'A' + 'a')
+		case c == '_':
+			buf.WriteString("__")
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '-', c == '/':
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "=%02x", c)
+		}
+	}
+	return buf.String()
+}
+
+func (b *matrixBridge) puppetID(name string) string {
+	return "@" + b.conf.Prefix + matrixEscape(name) + ":" + b.conf.Domain
+}
+
+// isPuppet checks if the Matrix user is controlled by the bridge.
+func (b *matrixBridge) isPuppet(mxid string) bool {
+	return strings.HasPrefix(mxid, "@"+b.conf.Prefix) && strings.HasSuffix(mxid, ":"+b.conf.Domain)
+}
+
+// peer returns a hub peer for the Matrix user, creating it if necessary.
+func (b *matrixBridge) peer(mxid string) (*matrixPeer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p := b.peers[mxid]; p != nil && p.Online() {
+		return p, nil
+	}
+	p, err := b.newPeer(matrixLocalpart(mxid)+b.conf.Suffix, mxid)
+	if err != nil {
+		return nil, err
+	}
+	b.peers[mxid] = p
+	return p, nil
+}
+
+// removePeer removes a Matrix user from the hub.
+func (b *matrixBridge) removePeer(mxid string) {
+	b.mu.Lock()
+	p := b.peers[mxid]
+	delete(b.peers, mxid)
+	b.mu.Unlock()
+	if p != nil {
+		_ = p.Close()
+	}
+}
+
+type matrixEvent struct {
+	Type     string `json:"type"`
+	RoomID   string `json:"room_id"`
+	Sender   string `json:"sender"`
+	StateKey string `json:"state_key"`
+	Content  struct {
+		MsgType    string `json:"msgtype"`
+		Body       string `json:"body"`
+		Membership string `json:"membership"`
+	} `json:"content"`
+}
+
+// handleEvent handles an event received from the homeserver.
+func (b *matrixBridge) handleEvent(e *matrixEvent) error {
+	name, ok := b.byRoom[e.RoomID]
+	if !ok || b.isPuppet(e.Sender) {
+		return nil
+	}
+	switch e.Type {
+	case "m.room.message":
+		if e.Content.Body == "" {
+			return nil
+		}
+		p, err := b.peer(e.Sender)
+		if err != nil {
+			return err
+		}
+		r, err := b.room(name)
+		if err != nil {
+			return err
+		}
+		if !r.InRoom(p) {
+			if err := b.h.checkRoomAccess(p, r, ""); err != nil {
+				log.Printf("matrix: %s: %s: %v", e.Sender, name, err)
+				return nil
+			}
+			r.Join(p)
+		}
+		r.SendChat(p, Message{
+			Text: e.Content.Body,
+			Me:   e.Content.MsgType == "m.emote",
+		})
+	case "m.room.member":
+		switch e.Content.Membership {
+		case "leave", "ban":
+			b.removePeer(e.StateKey)
+		}
+	}
+	return nil
+}
+
+// checkToken checks the homeserver token of the request.
+func (b *matrixBridge) checkToken(r *http.Request) bool {
+	token := r.URL.Query().Get("access_token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = auth[len("Bearer "):]
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(b.conf.HSToken)) == 1
+}
+
+func matrixError(w http.ResponseWriter, code int, errcode, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"errcode": errcode, "error": msg})
+}
+
+// seenTxn remembers the transaction and reports if it was already processed.
+func (b *matrixBridge) seenTxn(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.txns[id]; ok {
+		return true
+	}
+	if len(b.txns) >= matrixMaxTxns {
+		b.txns = make(map[string]struct{})
+	}
+	b.txns[id] = struct{}{}
+	return false
+}
+
+func (b *matrixBridge) serveTransaction(w http.ResponseWriter, r *http.Request) {
+	if !b.checkToken(r) {
+		matrixError(w, http.StatusForbidden, "M_FORBIDDEN", "invalid token")
+		return
+	} else if r.Method != "PUT" {
+		matrixError(w, http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "method not allowed")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, MatrixTransactionsPath)
+	var txn struct {
+		Events []matrixEvent `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+		matrixError(w, http.StatusBadRequest, "M_NOT_JSON", err.Error())
+		return
+	}
+	if !b.seenTxn(id) {
+		for i := range txn.Events {
+			if err := b.handleEvent(&txn.Events[i]); err != nil {
+				log.Printf("matrix: %s: %v", txn.Events[i].Sender, err)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+// forward queues a message of a DC user to be sent to Matrix.
+func (b *matrixBridge) forward(room, name string, m Message) {
+	id, ok := b.conf.Rooms[room]
+	if !ok {
+		return
+	}
+	select {
+	case b.queue <- matrixOut{room: id, name: name, msg: m}:
+	default:
+		log.Printf("matrix: queue is full, message from %q dropped", name)
+	}
+}
+
+// call sends a request to the client-server API on behalf of the user.
+func (b *matrixBridge) call(method, path, user string, req, resp interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	qu := url.Values{}
+	if user != "" {
+		qu.Set("user_id", user)
+	}
+	u := b.conf.Homeserver + matrixClientPath + path
+	if len(qu) != 0 {
+		u += "?" + qu.Encode()
+	}
+	hreq, err := http.NewRequest(method, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("Authorization", "Bearer "+b.conf.ASToken)
+	if matrixDebug {
+		log.Printf("matrix: %s %s %s", method, u, data)
+	}
+	hresp, err := b.cli.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		var e struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		_ = json.NewDecoder(hresp.Body).Decode(&e)
+		return &matrixAPIError{Status: hresp.StatusCode, ErrCode: e.ErrCode, Msg: e.Error}
+	}
+	if resp != nil {
+		return json.NewDecoder(hresp.Body).Decode(resp)
+	}
+	return nil
+}
+
+type matrixAPIError struct {
+	Status  int
+	ErrCode string
+	Msg     string
+}
+
+func (e *matrixAPIError) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.ErrCode, e.Msg)
+}
+
+// ensurePuppet registers a puppet for the DC user and joins it to the room.
+func (b *matrixBridge) ensurePuppet(name, mxid, room string) error {
+	if _, ok := b.puppets[mxid]; !ok {
+		err := b.call("POST", "/register", "", map[string]string{
+			"type":     "m.login.application_service",
+			"username": matrixLocalpart(mxid),
+		}, nil)
+		if e, ok := err.(*matrixAPIError); ok && e.ErrCode == "M_USER_IN_USE" {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		err = b.call("PUT", "/profile/"+url.PathEscape(mxid)+"/displayname", mxid,
+			map[string]string{"displayname": name}, nil)
+		if err != nil {
+			return err
+		}
+		b.puppets[mxid] = struct{}{}
+	}
+	key := mxid + " " + room
+	if _, ok := b.joined[key]; !ok {
+		err := b.call("POST", "/join/"+url.PathEscape(room), mxid, struct{}{}, nil)
+		if err != nil {
+			return err
+		}
+		b.joined[key] = struct{}{}
+	}
+	return nil
+}
+
+func (b *matrixBridge) send(m matrixOut) error {
+	mxid := b.puppetID(m.name)
+	if err := b.ensurePuppet(m.name, mxid, m.room); err != nil {
+		return err
+	}
+	typ := "m.text"
+	if m.msg.Me {
+		typ = "m.emote"
+	}
+	txn := strconv.FormatUint(atomic.AddUint64(&b.txn, 1), 10) + "." + strconv.FormatInt(time.Now().UnixNano(), 36)
+	return b.call("PUT", "/rooms/"+url.PathEscape(m.room)+"/send/m.room.message/"+txn, mxid,
+		map[string]string{"msgtype": typ, "body": m.msg.Text}, nil)
+}
+
+func (b *matrixBridge) run(closed <-chan struct{}) {
+	for {
+		select {
+		case <-closed:
+			return
+		case m := <-b.queue:
+			if err := b.send(m); err != nil {
+				log.Printf("matrix: cannot send message from %q: %v", m.name, err)
+			}
+		}
+	}
+}
+
+// MatrixHandler returns an HTTP handler for the application service API of the Matrix bridge.
+// It returns nil if the bridge is not configured.
+func (h *Hub) MatrixHandler() http.Handler {
+	if h.matrix == nil {
+		return nil
+	}
+	b := h.matrix
+	mux := http.NewServeMux()
+	mux.HandleFunc(MatrixTransactionsPath, b.serveTransaction)
+	mux.HandleFunc("/_matrix/app/v1/", func(w http.ResponseWriter, r *http.Request) {
+		if !b.checkToken(r) {
+			matrixError(w, http.StatusForbidden, "M_FORBIDDEN", "invalid token")
+			return
+		}
+		// users and room aliases are not provisioned on demand
+		matrixError(w, http.StatusNotFound, "M_NOT_FOUND", "not found")
+	})
+	return mux
+}
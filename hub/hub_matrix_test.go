@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatrixEscape(t *testing.T) {
+	require.Equal(t, "alice", matrixEscape("alice"))
+	require.Equal(t, "_alice__1", matrixEscape("Alice_1"))
+	require.Equal(t, "a=20b", matrixEscape("a b"))
+}
+
+type fakeHomeserver struct {
+	mu   sync.Mutex
+	reqs []string
+	body []string
+}
+
+func (s *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	s.reqs = append(s.reqs, r.Method+" "+r.URL.Path+" "+r.URL.Query().Get("user_id"))
+	s.body = append(s.body, string(data))
+	s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer as" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	_, _ = w.Write([]byte("{}"))
+}
+
+func (s *fakeHomeserver) requests() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.reqs...), append([]string{}, s.body...)
+}
+
+func TestMatrixBridge(t *testing.T) {
+	hs := &fakeHomeserver{}
+	hsrv := httptest.NewServer(hs)
+	defer hsrv.Close()
+
+	h, err := NewHub(Config{
+		Matrix: &MatrixConfig{
+			Homeserver: hsrv.URL,
+			Domain:     "example.org",
+			ASToken:    "as",
+			HSToken:    "hs",
+			Rooms:      map[string]string{"": "!main:example.org"},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, h.Start())
+	defer h.Close()
+
+	srv := httptest.NewServer(h.MatrixHandler())
+	defer srv.Close()
+
+	require.NotNil(t, h.PeerByName("Matrix"))
+	p := newTestADCPeer(t, h, "user")
+	sentADC(p)
+
+	put := func(token, txn, body string) int {
+		req, err := http.NewRequest("PUT", srv.URL+MatrixTransactionsPath+txn+"?access_token="+token, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	const msg = `{"events":[{"type":"m.room.message","room_id":"!main:example.org","sender":"@alice:example.org",
+		"content":{"msgtype":"m.text","body":"hello"}}]}`
+	require.Equal(t, http.StatusForbidden, put("wrong", "1", msg))
+	require.Equal(t, http.StatusOK, put("hs", "1", msg))
+	require.Contains(t, lastChat(t, p), `hello`)
+
+	ghost := h.PeerByName("alice[m]")
+	require.NotNil(t, ghost)
+	require.Equal(t, ProtoMatrix, PeerProtocol(ghost))
+
+	// repeated transactions are ignored, messages from puppets are not echoed
+	require.Equal(t, http.StatusOK, put("hs", "1", msg))
+	require.Equal(t, http.StatusOK, put("hs", "2", `{"events":[{"type":"m.room.message","room_id":"!main:example.org",
+		"sender":"@dc_user:example.org","content":{"msgtype":"m.text","body":"echo"}}]}`))
+	sentADC(p)
+
+	h.globalChat.SendChat(p, Message{Text: "hi"})
+	var reqs, body []string
+	for i := 0; i < 100; i++ {
+		reqs, body = hs.requests()
+		if len(reqs) >= 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Len(t, reqs, 4)
+	require.Equal(t, "POST /_matrix/client/r0/register ", reqs[0])
+	require.Contains(t, body[0], `"username":"dc_user"`)
+	require.Equal(t, "PUT /_matrix/client/r0/profile/@dc_user:example.org/displayname @dc_user:example.org", reqs[1])
+	require.Equal(t, "POST /_matrix/client/r0/join/!main:example.org @dc_user:example.org", reqs[2])
+	require.True(t, strings.HasPrefix(reqs[3], "PUT /_matrix/client/r0/rooms/!main:example.org/send/m.room.message/"))
+	require.Equal(t, `{"body":"hi","msgtype":"m.text"}`, body[3])
+
+	require.Equal(t, http.StatusOK, put("hs", "3", `{"events":[{"type":"m.room.member","room_id":"!main:example.org",
+		"sender":"@alice:example.org","state_key":"@alice:example.org","content":{"membership":"leave"}}]}`))
+	require.Nil(t, h.PeerByName("alice[m]"))
+}
@@ -17,6 +17,7 @@ import (
 	"golang.org/x/text/encoding"
 
 	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dcpp/capture"
 	"github.com/direct-connect/go-dcpp/nmdc"
 )
 
@@ -44,15 +45,15 @@ func (h *Hub) ServeNMDC(conn net.Conn, cinfo *ConnInfo) error {
 	cntConnNMDCOpen.Add(1)
 	defer cntConnNMDCOpen.Add(-1)
 
+	if cinfo == nil {
+		cinfo = &ConnInfo{Local: conn.LocalAddr(), Remote: conn.RemoteAddr()}
+	}
 	if cinfo.TLSVers != 0 {
 		cntConnNMDCS.Add(1)
 	}
 	if cinfo.ALPN != "" {
 		cntConnAlpnNMDC.Add(1)
 	}
-	if cinfo == nil {
-		cinfo = &ConnInfo{Local: conn.LocalAddr(), Remote: conn.RemoteAddr()}
-	}
 
 	log.Printf("%s: using NMDC", conn.RemoteAddr())
 
@@ -61,8 +62,16 @@ func (h *Hub) ServeNMDC(conn net.Conn, cinfo *ConnInfo) error {
 		return err
 	}
 	defer c.Close()
-	_ = c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if rec := h.startCapture(conn, capture.ProtoNMDC); rec != nil {
+		defer rec.Close()
+		c.OnLineR(rec.OnLineR)
+		c.OnLineW(rec.OnLineW)
+	}
+	_ = c.SetWriteDeadline(time.Now().Add(h.conf.Timeouts.write()))
 	c.SetFallbackEncoding(h.fallback)
+	if h.nmdcEnc != nil {
+		c.SetEncoding(h.nmdcEnc)
+	}
 	c.OnLineR(func(line []byte) (bool, error) {
 		sizeNMDCLinesR.Observe(float64(len(line)))
 		if h.sampler.enabled() {
@@ -114,6 +123,11 @@ func (h *Hub) ServeNMDC(conn net.Conn, cinfo *ConnInfo) error {
 	return h.nmdcServePeer(peer)
 }
 
+// nmdcEncodingName returns the canonical name of the text encoding used for NMDC connections.
+func (h *Hub) nmdcEncodingName() string {
+	return nmdc.EncodingName(h.nmdcEnc)
+}
+
 func (h *Hub) nmdcLock(deadline time.Time, c *nmdc.Conn) (nmdcp.Extensions, string, error) {
 	soft := h.getSoft()
 	lock := &nmdcp.Lock{
@@ -125,36 +139,43 @@ func (h *Hub) nmdcLock(deadline time.Time, c *nmdc.Conn) (nmdcp.Extensions, stri
 		return nil, "", err
 	}
 
-	var sup nmdcp.Supports
-	err = c.ReadMsgTo(deadline, &sup)
+	var (
+		sup nmdcp.Supports
+		key nmdcp.Key
+	)
+	// legacy clients may skip $Supports
+	m, err := c.ReadMsgToAny(deadline, &sup, &key)
 	if err != nil {
 		return nil, "", fmt.Errorf("expected supports: %v", err)
 	}
-	for _, ext := range sup.Ext {
-		cntNMDCExtensions.WithLabelValues(ext).Add(1)
+	_, hasSup := m.(*nmdcp.Supports)
+	if hasSup {
+		for _, ext := range sup.Ext {
+			cntNMDCExtensions.WithLabelValues(ext).Add(1)
+		}
+		err = c.ReadMsgTo(deadline, &key)
+		if err != nil {
+			return nil, "", fmt.Errorf("expected key: %v", err)
+		}
 	}
-	var key nmdcp.Key
-	err = c.ReadMsgTo(deadline, &key)
-	if err != nil {
-		return nil, "", fmt.Errorf("expected key: %v", err)
-	} else if key.Key != lock.Key().Key {
+	if key.Key != lock.Key().Key {
 		return nil, "", errors.New("wrong key")
 	}
 	fea := make(nmdcp.Extensions, len(sup.Ext))
 	for _, f := range sup.Ext {
 		fea[f] = struct{}{}
 	}
-	if !fea.Has(nmdcp.ExtNoHello) {
-		return nil, "", errors.New("NoHello is not supported")
-	} else if !fea.Has(nmdcp.ExtNoGetINFO) {
-		return nil, "", errors.New("NoGetINFO is not supported")
+	if err = h.nmdcCheckSupports(fea); err != nil {
+		return nil, "", err
 	}
 
-	err = c.WriteOneMsg(&nmdcp.Supports{
-		Ext: nmdcFeatures.List(),
-	})
-	if err != nil {
-		return nil, "", err
+	if hasSup {
+		err = c.WriteOneMsg(&nmdcp.Supports{
+			Ext: nmdcFeatures.List(),
+		})
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
 	nick, err := c.ReadValidateNick(deadline)
@@ -178,7 +199,7 @@ var nmdcFeatures = nmdcp.Extensions{
 
 func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 	defer measure(durNMDCHandshake)()
-	deadline := time.Now().Add(time.Second * 5)
+	deadline := h.handshakeDeadline()
 
 	fea, nick, err := h.nmdcLock(deadline, c)
 	if err != nil {
@@ -192,13 +213,23 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 		return nil, err
 	}
 	name := string(nick)
-	err = h.validateUserName(name)
+	err = h.validatePeerName(name)
 	if err != nil {
 		_ = c.WriteOneMsg(&nmdcp.ChatMessage{Text: err.Error()})
 		return nil, err
 	}
 
-	peer := newNMDC(h, cinfo, c, fea, nick, addr.IP)
+	peer, err := newNMDC(h, cinfo, c, fea, nick, addr.IP)
+	if err != nil {
+		_ = c.WriteOneMsg(&nmdcp.ChatMessage{Text: err.Error()})
+		return nil, err
+	}
+	accepted := false
+	defer func() {
+		if !accepted {
+			peer.releaseSID()
+		}
+	}()
 
 	if peer.fea.Has(nmdcp.ExtBotINFO) {
 		cntPings.Add(1)
@@ -206,7 +237,7 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 		// it's a pinger - don't bother binding the nickname
 		peer.fea.Set(nmdcp.ExtHubINFO)
 
-		err = h.nmdcAccept(peer)
+		err = h.nmdcAccept(peer, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -220,7 +251,7 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 			Desc:     st.Desc,
 			Host:     st.DefaultAddr(),
 			Soft:     st.Soft,
-			Encoding: "UTF8",
+			Encoding: h.nmdcEncodingName(),
 		})
 		if err == nil {
 			err = c.Flush()
@@ -228,29 +259,41 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 		return nil, err
 	}
 
-	// do not lock for writes first
-	if !h.nameAvailable(name, nil) {
+	// do not lock for writes first; with the replace policy the name
+	// may be taken by a session that will be dropped after the login
+	if h.conf.MultiLogin != MultiLoginReplace && !h.nameAvailable(name, nil) {
 		_ = peer.c.WriteOneMsg(&nmdcp.ValidateDenide{nmdcp.Name(nick)})
 		return nil, errNickTaken
 	}
 
-	// ok, now lock for writes and try to bind nick
-	// still, no one will see the user yet
-	unbind, ok := h.reserveName(name, nil, nil)
-	if !ok {
-		_ = peer.c.WriteOneMsg(&nmdcp.ValidateDenide{nmdcp.Name(nick)})
-		return nil, errNickTaken
+	unbind := func() {}
+	// bind is called after the password is verified, otherwise anyone
+	// could drop the session of a registered user
+	bind := func() error {
+		if err := h.checkMultiLogin(name, c.RemoteAddr(), nil); err != nil {
+			_ = c.WriteOneMsg(&nmdcp.ChatMessage{Text: err.Error()})
+			return err
+		}
+		// ok, now lock for writes and try to bind nick
+		// still, no one will see the user yet
+		release, ok := h.reserveName(name, nil, nil)
+		if !ok {
+			_ = peer.c.WriteOneMsg(&nmdcp.ValidateDenide{nmdcp.Name(nick)})
+			return errNickTaken
+		}
+		unbind = release
+		return nil
 	}
 
-	err = h.nmdcAccept(peer)
+	err = h.nmdcAccept(peer, bind)
 	if err != nil || !peer.Online() {
 		unbind()
 
-		str := "connection is closed"
+		str := errConnectionClosed.Error()
 		if err != nil {
-			str = err.Error()
+			str = h.errText(peer, err)
 		}
-		_ = peer.c.WriteOneMsg(&nmdcp.ChatMessage{Text: "handshake failed: " + str})
+		_ = peer.c.WriteOneMsg(&nmdcp.ChatMessage{Text: h.text(peer, TextLoginFailed, textArgs{"Reason": str})})
 		return nil, err
 	}
 
@@ -260,6 +303,7 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 		// make a snapshot of peers to send info to
 		list = h.listPeers()
 	}, nil)
+	accepted = true
 
 	// notify other users about the new one
 	h.broadcastUserJoin(peer, list)
@@ -267,6 +311,7 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 	if h.conf.ChatLogJoin != 0 {
 		h.globalChat.ReplayChat(peer, h.conf.ChatLogJoin)
 	}
+	h.autoJoinRooms(peer)
 
 	if err := peer.c.Flush(); err != nil {
 		_ = peer.closeOn(list)
@@ -276,8 +321,10 @@ func (h *Hub) nmdcHandshake(c *nmdc.Conn, cinfo *ConnInfo) (*nmdcPeer, error) {
 	return peer, nil
 }
 
-func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
-	deadline := time.Now().Add(time.Second * 5)
+// nmdcAccept runs the login handshake. The bind function, if set, is called
+// after the user is authenticated, to reserve the name.
+func (h *Hub) nmdcAccept(peer *nmdcPeer, bind func() error) error {
+	deadline := h.handshakeDeadline()
 
 	c := peer.c
 	err := c.WriteMsg(&nmdcp.HubName{
@@ -287,11 +334,12 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 		return err
 	}
 
-	user, rec, err := h.getUser(peer.Name())
+	prov, rec, err := h.findUser(peer.Name())
 	if err != nil {
 		return err
 	}
-	if user != nil && rec != nil {
+	// ask for a password if the user is known to one of the providers
+	if prov != nil {
 		if c := peer.ConnInfo(); c != nil && !c.Secure {
 			return errConnInsecure
 		}
@@ -308,18 +356,24 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 			return fmt.Errorf("expected password got: %v", err)
 		}
 
-		ok, err := h.nmdcCheckUserPass(rec, string(pass.String))
-		if err != nil {
-			return err
-		} else if !ok {
+		user, err := h.authUserWith(prov, rec, peer.Name(), string(pass.String))
+		if err == ErrAuthWrongPassword {
 			err = c.WriteOneMsg(&nmdcp.BadPass{})
 			if err != nil {
 				return err
 			}
 			return errors.New("wrong password")
+		} else if err != nil {
+			return err
 		}
 		peer.setUser(user)
-		deadline = time.Now().Add(time.Second * 5)
+		h.userLoggedIn(peer)
+		deadline = h.handshakeDeadline()
+	}
+	if bind != nil {
+		if err = bind(); err != nil {
+			return err
+		}
 	}
 
 	_ = c.SetWriteDeadline(deadline)
@@ -372,6 +426,10 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 
 	peer.setUserInfo(&peer.info.user)
 
+	if !h.authzJoin(peer) {
+		return errAccessDenied
+	}
+
 	err = c.WriteMsg(&nmdcp.HubTopic{
 		Text: h.getTopic(),
 	})
@@ -382,7 +440,7 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 	if err != nil {
 		return err
 	}
-	err = h.sendMOTD(peer)
+	err = h.sendWelcome(peer)
 	if err != nil {
 		return err
 	}
@@ -394,7 +452,7 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 		}
 	}
 
-	_ = c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_ = c.SetWriteDeadline(time.Now().Add(h.conf.Timeouts.write()))
 	// send user list (except his own info)
 	peers := h.Peers()
 	err = peer.peersJoin(&PeersJoinEvent{Peers: peers}, true)
@@ -407,6 +465,17 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 	if err != nil {
 		return err
 	}
+	if !peer.ext.nohello {
+		names := make(nmdcp.Names, 0, len(peers)+1)
+		for _, p := range peers {
+			names = append(names, p.Name())
+		}
+		names = append(names, peer.Name())
+		err = c.WriteMsg(&nmdcNickList{Names: names})
+		if err != nil {
+			return err
+		}
+	}
 	var ops, bots nmdcp.Names
 	if u := peer.User(); u != nil && u.Has(FlagOpIcon) {
 		ops = append(ops, peer.Name())
@@ -442,36 +511,16 @@ func (h *Hub) nmdcAccept(peer *nmdcPeer) error {
 			return err
 		}
 		if peer.User().HasPerm(PermIP) {
-			var ips []nmdcp.UserAddress
-			for _, p := range peers {
-				addr, ok := p.RemoteAddr().(*net.TCPAddr)
-				if !ok {
-					continue
-				}
-				ips = append(ips, nmdcp.UserAddress{
-					Name: p.Name(),
-					IP:   addr.IP.String(),
-				})
-			}
-			if len(ips) != 0 {
-				err = c.WriteMsg(&nmdcp.UserIP{List: ips})
-				if err != nil {
-					return err
-				}
+			err = c.WriteMsg(nmdcPeersIPCmds(peers)...)
+			if err != nil {
+				return err
 			}
 		}
 	}
-	_ = c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_ = c.SetWriteDeadline(time.Now().Add(h.conf.Timeouts.write()))
 	return c.Flush()
 }
 
-func (h *Hub) nmdcCheckUserPass(rec *UserRecord, pass string) (bool, error) {
-	if h.db == nil {
-		return false, nil
-	}
-	return rec.Pass == pass, nil
-}
-
 func (h *Hub) nmdcServePeer(peer *nmdcPeer) error {
 	if !h.callOnJoined(peer) {
 		return nil // TODO: eny errors?
@@ -479,7 +528,9 @@ func (h *Hub) nmdcServePeer(peer *nmdcPeer) error {
 	// looks like we are disabling the timeout, but we are not
 	// the timeout will be set manually by the writer goroutine
 	peer.c.SetWriteTimeout(-1)
-	go peer.writer(writeTimeout)
+	peer.spawn(peer, func() {
+		peer.writer(h.conf.Timeouts.write())
+	})
 
 	cnt := make(map[string]uint)
 	ticker := time.NewTicker(time.Minute)
@@ -556,8 +607,30 @@ func (h *Hub) nmdcHandle(peer *nmdcPeer, msg nmdcp.Message) error {
 		return nil
 	case *nmdcp.GetNickList:
 		list := h.Peers()
-		_ = peer.PeersJoin(&PeersJoinEvent{Peers: list})
+		_ = peer.peersJoin(&PeersJoinEvent{Peers: list}, false)
 		return nil
+	case *nmdcp.UserIP:
+		// request for addresses of given users
+		names := make([]string, 0, len(msg.List))
+		for _, a := range msg.List {
+			names = append(names, a.Name)
+		}
+		ips := h.userIPs(peer, names)
+		if len(ips) == 0 {
+			countM(cntNMDCCommandsDrop, typ, 1)
+			return nil
+		}
+		return peer.SendNMDC(&nmdcp.UserIP{List: ips})
+	case *nmdcGetINFO:
+		if msg.From != peer.Name() {
+			return errors.New("invalid name in GetINFO")
+		}
+		targ := h.PeerByName(msg.Target)
+		if targ == nil {
+			countM(cntNMDCCommandsDrop, typ, 1)
+			return nil
+		}
+		return peer.SendNMDC(nmdcPeersJoinCmds(peer.c.TextEncoder(), []Peer{targ})...)
 	case *nmdcp.ConnectToMe:
 		targ := h.PeerByName(string(msg.Targ))
 		if targ == nil || targ == peer {
@@ -668,7 +741,10 @@ func (h *Hub) nmdcHandle(peer *nmdcPeer, msg nmdcp.Message) error {
 		} else if u := peer.Info(); u.Client != msg.Client {
 			return errors.New("client masquerade is not allowed")
 		}
+		old := peer.UserInfo()
 		peer.SetInfo(msg)
+		cur := peer.UserInfo()
+		h.updateShare(&old, &cur)
 		h.broadcastUserUpdate(peer, nil)
 		return nil
 	default:
@@ -741,13 +817,7 @@ func (h *Hub) nmdcHandleResult(peer *nmdcPeer, to Peer, msg *nmdcp.SR) {
 		return
 	}
 	atomic.StoreInt64(&cur.last, time.Now().Unix())
-	var res SearchResult
-	path := strings.Join(msg.Path, "/")
-	if msg.IsDir {
-		res = Dir{Peer: peer, Path: path}
-	} else {
-		res = File{Peer: peer, Path: path, Size: msg.Size, TTH: msg.TTH}
-	}
+	res := nmdcToResult(peer, msg)
 	if !cur.req.Match(res) {
 		return
 	}
@@ -815,7 +885,7 @@ var (
 	_ PeerTopic = (*nmdcPeer)(nil)
 )
 
-func newNMDC(h *Hub, cinfo *ConnInfo, c *nmdc.Conn, fea nmdcp.Extensions, nick string, ip net.IP) *nmdcPeer {
+func newNMDC(h *Hub, cinfo *ConnInfo, c *nmdc.Conn, fea nmdcp.Extensions, nick string, ip net.IP) (*nmdcPeer, error) {
 	if cinfo == nil {
 		cinfo = &ConnInfo{Local: c.LocalAddr(), Remote: c.RemoteAddr()}
 	}
@@ -826,10 +896,15 @@ func newNMDC(h *Hub, cinfo *ConnInfo, c *nmdc.Conn, fea nmdcp.Extensions, nick s
 	peer.ext.userip2 = fea.Has(nmdcp.ExtUserIP2)
 	peer.ext.botlist = fea.Has(nmdcp.ExtBotList)
 	peer.ext.tths = fea.Has(nmdcp.ExtTTHS)
-	h.newBasePeer(&peer.BasePeer, cinfo)
+	peer.ext.tthsearch = fea.Has(nmdcp.ExtTTHSearch)
+	peer.ext.nohello = fea.Has(nmdcp.ExtNoHello)
+	if err := h.newBasePeer(&peer.BasePeer, cinfo); err != nil {
+		return nil, err
+	}
 	peer.write.wake = make(chan struct{}, 1)
+	peer.write.ping = make(chan struct{}, 1)
 	peer.info.user.Name = nick
-	return peer
+	return peer, nil
 }
 
 type nmdcPeer struct {
@@ -841,6 +916,8 @@ type nmdcPeer struct {
 
 	write struct {
 		wake chan struct{}
+		// ping requests an immediate keepalive, see idleReaper
+		ping chan struct{}
 		cnt  uint32 // atomic
 		sync.Mutex
 		buf []nmdcp.Message
@@ -853,9 +930,11 @@ type nmdcPeer struct {
 		raw  *nmdcp.RawMessage
 	}
 	ext struct {
-		userip2 bool
-		botlist bool
-		tths    bool
+		userip2   bool
+		botlist   bool
+		tths      bool
+		tthsearch bool
+		nohello   bool
 	}
 
 	search struct {
@@ -865,8 +944,21 @@ type nmdcPeer struct {
 	}
 }
 
-func (p *nmdcPeer) Searchable() bool {
-	return atomic.LoadUint64(&p.info.share) > 0
+// HasFeature checks if an NMDC extension is active for the peer.
+func (p *nmdcPeer) HasFeature(name string) bool {
+	return p.fea.Has(name)
+}
+
+func (p *nmdcPeer) protocol() string {
+	return ProtoNMDC
+}
+
+func (p *nmdcPeer) Capabilities() PeerCaps {
+	caps := CapConnect | CapRooms | CapPrivate
+	if atomic.LoadUint64(&p.info.share) > 0 {
+		caps |= CapSearch
+	}
+	return caps
 }
 
 type nmdcSearchRun struct {
@@ -913,6 +1005,8 @@ func (p *nmdcPeer) UserInfo() UserInfo {
 		IPv4:           u.Flag.IsSet(nmdcp.FlagIPv4),
 		IPv6:           u.Flag.IsSet(nmdcp.FlagIPv6),
 		TLS:            u.Flag.IsSet(nmdcp.FlagTLS),
+		Away:           u.Flag.IsSet(nmdcp.FlagStatusAway),
+		Passive:        u.Mode == nmdcp.UserModePassive || u.Mode == nmdcp.UserModeSOCKS5,
 	}
 }
 
@@ -952,8 +1046,8 @@ func (p *nmdcPeer) Close() error {
 	return p.closeOn(nil)
 }
 
+// writer sends queued messages to the connection. It runs as a background task of the peer, see spawn.
 func (p *nmdcPeer) writer(timeout time.Duration) {
-	defer p.Close()
 	ticker := time.NewTicker(time.Minute / 2)
 	defer ticker.Stop()
 
@@ -971,25 +1065,30 @@ func (p *nmdcPeer) writer(timeout time.Duration) {
 		}
 		return
 	}
+	keepAlive := func() error {
+		_ = p.c.SetWriteDeadline(time.Now().Add(timeout))
+		err := p.c.WriteLine([]byte("|"))
+		if err == nil {
+			err = p.c.Flush()
+		}
+		_ = p.c.SetWriteDeadline(time.Time{})
+		return err
+	}
 	var deadline time.Time
 	for {
 		select {
 		case <-p.close.done:
 			return
 		case <-ticker.C:
-			// keep alive
-			_ = p.c.SetWriteDeadline(time.Now().Add(timeout))
-			err := p.c.WriteLine([]byte("|"))
-			if err != nil {
+			if err := keepAlive(); err != nil {
 				logErr(err)
 				return
 			}
-			err = p.c.Flush()
-			if err != nil {
+		case <-p.write.ping:
+			if err := keepAlive(); err != nil {
 				logErr(err)
 				return
 			}
-			_ = p.c.SetWriteDeadline(time.Time{})
 		case <-p.write.wake:
 			p.write.Lock()
 			buf := p.write.buf
@@ -1069,12 +1168,18 @@ func (p *nmdcPeer) Topic(topic string) error {
 }
 
 func (p *nmdcPeer) PeersJoin(e *PeersJoinEvent) error {
+	if !p.ext.nohello {
+		// legacy clients expect $Hello for each user that joins
+		if err := p.SendNMDC(nmdcHelloCmds(e.Peers)...); err != nil {
+			return err
+		}
+	}
 	return p.peersJoin(e, false)
 }
 
 func (p *nmdcPeer) PeersUpdate(e *PeersUpdateEvent) error {
 	// same as join
-	return p.PeersJoin((*PeersJoinEvent)(e))
+	return p.sendPeers(e.Peers, &e.nmdcPeersRaw, false)
 }
 
 func NMDCUserInfo(p Peer) nmdcp.MyINFO {
@@ -1096,8 +1201,14 @@ func (u UserInfo) toNMDC() nmdcp.MyINFO {
 	if u.TLS {
 		flag |= nmdcp.FlagTLS
 	}
-	conn := "100"                // TODO
-	mode := nmdcp.UserModeActive // TODO
+	if u.Away {
+		flag |= nmdcp.FlagStatusAway
+	}
+	conn := "100" // TODO
+	mode := nmdcp.UserModeActive
+	if u.Passive {
+		mode = nmdcp.UserModePassive
+	}
 	if u.Kind == UserBot || u.Kind == UserHub {
 		conn = "" // empty conn indicates a bot
 	}
@@ -1222,10 +1333,10 @@ func nmdcPeersBotsCmds(peers []Peer) []nmdcp.Message {
 func nmdcPeersIPCmds(peers []Peer) []nmdcp.Message {
 	var ips []nmdcp.UserAddress
 	for _, p2 := range peers {
-		if addr, ok := p2.RemoteAddr().(*net.TCPAddr); ok {
+		if ip := reportedIP(p2); ip != "" {
 			ips = append(ips, nmdcp.UserAddress{
 				Name: p2.Name(),
-				IP:   addr.IP.String(),
+				IP:   ip,
 			})
 		}
 	}
@@ -1236,23 +1347,36 @@ func nmdcPeersIPCmds(peers []Peer) []nmdcp.Message {
 }
 
 func (p *nmdcPeer) peersJoin(e *PeersJoinEvent, initial bool) error {
+	return p.sendPeers(e.Peers, &e.nmdcPeersRaw, initial)
+}
+
+func (p *nmdcPeer) sendPeers(peers []Peer, e *nmdcPeersRaw, initial bool) error {
 	enc := p.c.TextEncoder()
 
 	cmds, err := e.nmdcInfos.Encode(enc, func() []nmdcp.Message {
-		return nmdcPeersJoinCmds(enc, e.Peers)
+		return nmdcPeersJoinCmds(enc, peers)
 	})
 	if err != nil {
 		return err
 	}
 	if initial {
 		// will send ips, ops and bots manually
-		return p.c.WriteMsg(cmds...)
+		pacer := p.hub.newListPacer()
+		for _, m := range cmds {
+			if err := p.c.WriteMsg(m); err != nil {
+				return err
+			}
+			if err := pacer.next(p.c.Flush); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 	cmds = cmds[:len(cmds):len(cmds)] // realloc on append
 
 	// operators flag is a separate command
 	opsCmd, err := e.nmdcOps.Encode(enc, func() []nmdcp.Message {
-		return nmdcPeersOpCmds(e.Peers)
+		return nmdcPeersOpCmds(peers)
 	})
 	if err != nil {
 		return err
@@ -1262,7 +1386,7 @@ func (p *nmdcPeer) peersJoin(e *PeersJoinEvent, initial bool) error {
 	// if supported, send a bot list
 	if p.ext.botlist {
 		botsCmd, err := e.nmdcBots.Encode(enc, func() []nmdcp.Message {
-			return nmdcPeersBotsCmds(e.Peers)
+			return nmdcPeersBotsCmds(peers)
 		})
 		if err != nil {
 			return err
@@ -1273,7 +1397,7 @@ func (p *nmdcPeer) peersJoin(e *PeersJoinEvent, initial bool) error {
 	// send IPs if the user is an operator
 	if p.ext.userip2 && p.User().HasPerm(PermIP) {
 		ipsCmd, err := e.nmdcIPs.Encode(enc, func() []nmdcp.Message {
-			return nmdcPeersIPCmds(e.Peers)
+			return nmdcPeersIPCmds(peers)
 		})
 		if err != nil {
 			return err
@@ -1333,7 +1457,7 @@ func (p *nmdcPeer) JoinRoom(room *Room) error {
 		&nmdcp.PrivateMessage{
 			From: rname, Name: rname,
 			To:   p.Name(),
-			Text: "/me joined",
+			Text: "/me " + p.hub.text(p, TextRoomJoined, nil),
 		},
 	)
 }
@@ -1350,7 +1474,7 @@ func (p *nmdcPeer) LeaveRoom(room *Room) error {
 		&nmdcp.PrivateMessage{
 			From: rname, Name: rname,
 			To:   p.Name(),
-			Text: "/me parted",
+			Text: "/me " + p.hub.text(p, TextRoomParted, nil),
 		},
 		&nmdcp.Quit{
 			Name: nmdcp.Name(rname),
@@ -1462,26 +1586,14 @@ func (s *nmdcSearch) SendResult(r SearchResult) error {
 	}
 	h := s.p.hub
 	// TODO: additional filtering?
-	sr := &nmdcp.SR{
-		From:      r.From().Name(),
-		FreeSlots: 3, TotalSlots: 3, // TODO
-		HubName:    h.Stats().Name,
-		HubAddress: s.p.LocalAddr().String(),
-	}
-	switch r := r.(type) {
-	case File:
-		sr.Path = strings.Split(r.Path, "/")
-		sr.Size = r.Size
-		if r.TTH != nil {
-			sr.HubName = ""
-			sr.TTH = r.TTH
-		}
-	case Dir:
-		sr.Path = strings.Split(r.Path, "/")
-		sr.IsDir = true
-	default:
+	sr := resultToNMDC(r)
+	if sr == nil {
 		return nil // ignore
 	}
+	if sr.TTH == nil {
+		sr.HubName = h.Stats().Name
+	}
+	sr.HubAddress = s.p.LocalAddr().String()
 	return s.p.SendNMDC(sr)
 }
 
@@ -1596,6 +1708,10 @@ func (p *nmdcPeer) Search(ctx context.Context, req SearchRequest, out Search) er
 	if !p.Online() {
 		return errConnectionClosed
 	}
+	if _, ok := req.(TTHSearch); ok && !p.ext.tthsearch && !p.ext.tths {
+		// legacy clients would search for the hash as a file name
+		return nil
+	}
 	p.setActiveSearch(out, req)
 	if req, ok := req.(TTHSearch); ok {
 		if ns, ok := out.(*nmdcSearch); ok {
@@ -0,0 +1,701 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dcpp/version"
+)
+
+// XMPP gateway connects to an XMPP server as an external component (XEP-0114) and acts as
+// a multi-user chat service (XEP-0045): the main chat and hub rooms are exposed as MUC rooms,
+// DC users are occupants of those rooms, and XMPP users that join a room become hub peers.
+//
+// Occupants of the main room are kept in sync with the hub. For other rooms, the list of
+// occupants is only sent when the XMPP user joins the room.
+
+const (
+	xmppDebug = false
+
+	// DefaultXMPPRoom is the default name of the MUC room for the main chat.
+	DefaultXMPPRoom = "hub"
+
+	xmppNSComponent = "jabber:component:accept"
+	xmppNSStream    = "http://etherx.jabber.org/streams"
+	xmppNSStanza    = "urn:ietf:params:xml:ns:xmpp-stanzas"
+	xmppNSMUC       = "http://jabber.org/protocol/muc"
+	xmppNSDiscoInfo = "http://jabber.org/protocol/disco#info"
+
+	xmppRetry        = 5 * time.Second
+	xmppWriteTimeout = 10 * time.Second
+
+	// xmppStatusSelf is a MUC status code of the presence that refers to the occupant itself.
+	xmppStatusSelf = 110
+)
+
+// XMPPConfig configures the XMPP gateway.
+type XMPPConfig struct {
+	// Addr is the address of the component port of the XMPP server.
+	Addr string
+	// Domain is the JID of the component, for example dc.example.org.
+	Domain string
+	// Secret is the shared secret of the component.
+	Secret string
+	// Room is the name of the MUC room for the main chat. Zero value means DefaultXMPPRoom.
+	Room string
+}
+
+type xmppMUCItem struct {
+	Affiliation string `xml:"affiliation,attr"`
+	Role        string `xml:"role,attr"`
+}
+
+type xmppStatus struct {
+	Code int `xml:"code,attr"`
+}
+
+type xmppMUCUser struct {
+	XMLName xml.Name     `xml:"http://jabber.org/protocol/muc#user x"`
+	Item    xmppMUCItem  `xml:"item"`
+	Status  []xmppStatus `xml:"status"`
+}
+
+type xmppErrorCond struct {
+	XMLName xml.Name
+}
+
+type xmppError struct {
+	Type string        `xml:"type,attr"`
+	Cond xmppErrorCond `xml:",any"`
+	Text string        `xml:"urn:ietf:params:xml:ns:xmpp-stanzas text,omitempty"`
+}
+
+func newXMPPError(typ, cond, text string) *xmppError {
+	return &xmppError{
+		Type: typ,
+		Cond: xmppErrorCond{XMLName: xml.Name{Space: xmppNSStanza, Local: cond}},
+		Text: text,
+	}
+}
+
+type xmppPresence struct {
+	XMLName xml.Name     `xml:"presence"`
+	From    string       `xml:"from,attr,omitempty"`
+	To      string       `xml:"to,attr,omitempty"`
+	ID      string       `xml:"id,attr,omitempty"`
+	Type    string       `xml:"type,attr,omitempty"`
+	MUC     *xmppMUCUser `xml:",omitempty"`
+	Error   *xmppError   `xml:"error,omitempty"`
+}
+
+type xmppMessage struct {
+	XMLName xml.Name   `xml:"message"`
+	From    string     `xml:"from,attr,omitempty"`
+	To      string     `xml:"to,attr,omitempty"`
+	ID      string     `xml:"id,attr,omitempty"`
+	Type    string     `xml:"type,attr,omitempty"`
+	Body    string     `xml:"body,omitempty"`
+	Error   *xmppError `xml:"error,omitempty"`
+}
+
+type xmppIdentity struct {
+	Category string `xml:"category,attr"`
+	Type     string `xml:"type,attr"`
+	Name     string `xml:"name,attr,omitempty"`
+}
+
+type xmppFeature struct {
+	Var string `xml:"var,attr"`
+}
+
+type xmppDiscoInfo struct {
+	XMLName  xml.Name       `xml:"http://jabber.org/protocol/disco#info query"`
+	Identity []xmppIdentity `xml:"identity"`
+	Feature  []xmppFeature  `xml:"feature"`
+}
+
+type xmppIQ struct {
+	XMLName xml.Name       `xml:"iq"`
+	From    string         `xml:"from,attr,omitempty"`
+	To      string         `xml:"to,attr,omitempty"`
+	ID      string         `xml:"id,attr,omitempty"`
+	Type    string         `xml:"type,attr"`
+	Disco   *xmppDiscoInfo `xml:",omitempty"`
+	Error   *xmppError     `xml:"error,omitempty"`
+}
+
+// xmppStanza is a generic stanza received from the server.
+type xmppStanza struct {
+	XMLName xml.Name
+	From    string `xml:"from,attr"`
+	To      string `xml:"to,attr"`
+	ID      string `xml:"id,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:"body"`
+	Query   *struct {
+		XMLName xml.Name
+	} `xml:"query"`
+}
+
+// splitJID splits the JID into a node (local) part, domain and resource.
+func splitJID(jid string) (node, domain, res string) {
+	if i := strings.IndexByte(jid, '/'); i >= 0 {
+		jid, res = jid[:i], jid[i+1:]
+	}
+	if i := strings.IndexByte(jid, '@'); i >= 0 {
+		node, jid = jid[:i], jid[i+1:]
+	}
+	return node, jid, res
+}
+
+var _ Peer = (*xmppPeer)(nil)
+
+// xmppPeer is an XMPP user that joined one of the MUC rooms.
+type xmppPeer struct {
+	BasePeer
+	c   *xmppComponent
+	jid string // full JID
+
+	mu     sync.Mutex
+	joined map[*Room]struct{}
+}
+
+func (*xmppPeer) protocol() string {
+	return ProtoXMPP
+}
+
+func (*xmppPeer) Capabilities() PeerCaps {
+	return CapPrivate
+}
+
+func (p *xmppPeer) UserInfo() UserInfo {
+	return UserInfo{
+		Name: p.Name(),
+		App: dc.Software{
+			Name:    "DC-XMPP gateway",
+			Version: version.Vers,
+		},
+	}
+}
+
+func (p *xmppPeer) inRoom(r *Room) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.joined[r]
+	return ok
+}
+
+// setJoined marks the MUC room as joined or left by the XMPP user and reports if the state changed.
+func (p *xmppPeer) setJoined(r *Room, joined bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.joined[r]
+	if joined {
+		p.joined[r] = struct{}{}
+	} else {
+		delete(p.joined, r)
+	}
+	return ok != joined
+}
+
+func (p *xmppPeer) Close() error {
+	return p.closeWith(p,
+		func() error {
+			p.c.removePeer(p)
+			p.hub.leave(p, p.sid, nil)
+			return nil
+		},
+	)
+}
+
+// occupant sends a presence of the occupant of the room.
+func (p *xmppPeer) occupant(r *Room, name string, online, self bool) error {
+	pr := &xmppPresence{
+		From: p.c.roomJID(r) + "/" + name,
+		To:   p.jid,
+		MUC:  &xmppMUCUser{Item: xmppMUCItem{Affiliation: "none", Role: "participant"}},
+	}
+	if !online {
+		pr.Type = "unavailable"
+		pr.MUC.Item.Role = "none"
+	}
+	if self {
+		pr.MUC.Status = []xmppStatus{{Code: xmppStatusSelf}}
+	}
+	return p.c.send(pr)
+}
+
+func (p *xmppPeer) PeersJoin(e *PeersJoinEvent) error {
+	r := p.hub.globalChat
+	if !p.inRoom(r) {
+		return nil
+	}
+	for _, peer := range e.Peers {
+		if peer == p {
+			continue
+		}
+		if err := p.occupant(r, peer.Name(), true, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *xmppPeer) PeersUpdate(e *PeersUpdateEvent) error {
+	return nil // no updates
+}
+
+func (p *xmppPeer) PeersLeave(e *PeersLeaveEvent) error {
+	r := p.hub.globalChat
+	if !p.inRoom(r) {
+		return nil
+	}
+	for _, peer := range e.Peers {
+		if peer == p {
+			continue
+		}
+		if err := p.occupant(r, peer.Name(), false, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *xmppPeer) JoinRoom(room *Room) error {
+	return nil
+}
+
+func (p *xmppPeer) LeaveRoom(room *Room) error {
+	return nil
+}
+
+func (p *xmppPeer) ChatMsg(room *Room, from Peer, msg Message) error {
+	if room == nil {
+		room = p.hub.globalChat
+	}
+	if !p.inRoom(room) {
+		return nil
+	}
+	// MUC reflects messages to the sender as well
+	text := msg.Text
+	if msg.Me {
+		text = "/me " + text
+	}
+	return p.c.send(&xmppMessage{
+		From: p.c.roomJID(room) + "/" + msg.Name,
+		To:   p.jid,
+		Type: "groupchat",
+		Body: text,
+	})
+}
+
+func (p *xmppPeer) PrivateMsg(from Peer, msg Message) error {
+	text := msg.Text
+	if msg.Me {
+		text = "/me " + text
+	}
+	return p.c.send(&xmppMessage{
+		From: p.c.roomJID(p.hub.globalChat) + "/" + from.Name(),
+		To:   p.jid,
+		Type: "chat",
+		Body: text,
+	})
+}
+
+func (p *xmppPeer) HubChatMsg(m Message) error {
+	return p.c.send(&xmppMessage{
+		From: p.c.conf.Domain,
+		To:   p.jid,
+		Type: "chat",
+		Body: m.Text,
+	})
+}
+
+func (p *xmppPeer) ConnectTo(peer Peer, addr string, token string, secure bool) error {
+	return nil
+}
+
+func (p *xmppPeer) RevConnectTo(peer Peer, token string, secure bool) error {
+	return nil
+}
+
+func (p *xmppPeer) Search(ctx context.Context, req SearchRequest, out Search) error {
+	return nil
+}
+
+// xmppComponent is a connection of the hub to the XMPP server.
+type xmppComponent struct {
+	h    *Hub
+	conf XMPPConfig
+
+	wmu  sync.Mutex
+	conn net.Conn
+
+	mu    sync.Mutex
+	peers map[string]*xmppPeer // by full JID
+}
+
+func (h *Hub) newXMPPComponent(conf XMPPConfig) (*xmppComponent, error) {
+	if conf.Addr == "" || conf.Domain == "" {
+		return nil, errors.New("xmpp address and domain must be set")
+	} else if conf.Secret == "" {
+		return nil, errors.New("xmpp component secret must be set")
+	}
+	if conf.Room == "" {
+		conf.Room = DefaultXMPPRoom
+	}
+	return &xmppComponent{
+		h: h, conf: conf,
+		peers: make(map[string]*xmppPeer),
+	}, nil
+}
+
+// roomJID returns a bare JID of the MUC room for a hub room.
+func (c *xmppComponent) roomJID(r *Room) string {
+	if r == c.h.globalChat {
+		return c.conf.Room + "@" + c.conf.Domain
+	}
+	return strings.TrimPrefix(r.Name(), "#") + "@" + c.conf.Domain
+}
+
+// roomByNode returns a hub room for the node part of the MUC room JID.
+func (c *xmppComponent) roomByNode(node string) *Room {
+	if node == c.conf.Room {
+		return c.h.globalChat
+	}
+	return c.h.Room("#" + node)
+}
+
+func (c *xmppComponent) send(v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if xmppDebug {
+		log.Printf("xmpp: > %s", data)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.conn == nil {
+		return errConnectionClosed
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(xmppWriteTimeout))
+	_, err = c.conn.Write(data)
+	return err
+}
+
+func (c *xmppComponent) peer(jid string) *xmppPeer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peers[jid]
+}
+
+func (c *xmppComponent) removePeer(p *xmppPeer) {
+	c.mu.Lock()
+	if c.peers[p.jid] == p {
+		delete(c.peers, p.jid)
+	}
+	c.mu.Unlock()
+}
+
+// closePeers removes all XMPP users from the hub.
+func (c *xmppComponent) closePeers() {
+	c.mu.Lock()
+	list := make([]*xmppPeer, 0, len(c.peers))
+	for _, p := range c.peers {
+		list = append(list, p)
+	}
+	c.mu.Unlock()
+	for _, p := range list {
+		_ = p.Close()
+	}
+}
+
+// handshake opens the component stream and authenticates with the shared secret.
+func (c *xmppComponent) handshake(conn net.Conn) (*xml.Decoder, error) {
+	_, err := fmt.Fprintf(conn, `<?xml version='1.0'?><stream:stream xmlns='%s' xmlns:stream='%s' to='%s'>`,
+		xmppNSComponent, xmppNSStream, c.conf.Domain)
+	if err != nil {
+		return nil, err
+	}
+	dec := xml.NewDecoder(conn)
+	var id string
+	for id == "" {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			if se.Name.Local != "stream" {
+				return nil, fmt.Errorf("expected stream header, got %q", se.Name.Local)
+			}
+			for _, a := range se.Attr {
+				if a.Name.Local == "id" {
+					id = a.Value
+				}
+			}
+			if id == "" {
+				return nil, errors.New("stream id is not set")
+			}
+		}
+	}
+	sum := sha1.Sum([]byte(id + c.conf.Secret))
+	if _, err = fmt.Fprintf(conn, "<handshake>%s</handshake>", hex.EncodeToString(sum[:])); err != nil {
+		return nil, err
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "handshake":
+			if err = dec.Skip(); err != nil {
+				return nil, err
+			}
+			return dec, nil
+		case "error":
+			return nil, errors.New("handshake failed")
+		default:
+			return nil, fmt.Errorf("unexpected element during handshake: %q", se.Name.Local)
+		}
+	}
+}
+
+// serve handles stanzas until the connection is closed.
+func (c *xmppComponent) serve(conn net.Conn) error {
+	dec, err := c.handshake(conn)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	c.conn = conn
+	c.wmu.Unlock()
+	defer func() {
+		c.wmu.Lock()
+		c.conn = nil
+		c.wmu.Unlock()
+		c.closePeers()
+	}()
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			// end of the stream
+			return io.EOF
+		case xml.StartElement:
+			var st xmppStanza
+			if err = dec.DecodeElement(&st, &tok); err != nil {
+				return err
+			}
+			if err = c.handleStanza(&st); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *xmppComponent) handleStanza(st *xmppStanza) error {
+	switch st.XMLName.Local {
+	case "presence":
+		return c.handlePresence(st)
+	case "message":
+		return c.handleMessage(st)
+	case "iq":
+		return c.handleIQ(st)
+	case "error":
+		return errors.New("stream error")
+	}
+	return nil
+}
+
+func (c *xmppComponent) handlePresence(st *xmppStanza) error {
+	node, _, nick := splitJID(st.To)
+	r := c.roomByNode(node)
+	p := c.peer(st.From)
+	if st.Type == "unavailable" {
+		if p == nil || r == nil || !p.setJoined(r, false) {
+			return nil
+		}
+		if err := p.occupant(r, p.Name(), false, true); err != nil {
+			return err
+		}
+		if r == c.h.globalChat {
+			// leaving the main chat means leaving the hub
+			return p.Close()
+		}
+		r.Leave(p)
+		return nil
+	} else if st.Type != "" {
+		return nil // probes, subscriptions, etc
+	}
+	if r == nil {
+		return c.send(&xmppPresence{
+			From: st.To, To: st.From, ID: st.ID, Type: "error",
+			Error: newXMPPError("cancel", "item-not-found", ""),
+		})
+	}
+	created := false
+	if p == nil {
+		created = true
+		p = &xmppPeer{c: c, jid: st.From, joined: make(map[*Room]struct{})}
+		if err := c.h.addVirtualPeer(p, nick); err != nil {
+			cond := "not-acceptable"
+			if err == errNickTaken {
+				cond = "conflict"
+			}
+			return c.send(&xmppPresence{
+				From: st.To, To: st.From, ID: st.ID, Type: "error",
+				Error: newXMPPError("cancel", cond, err.Error()),
+			})
+		}
+		c.mu.Lock()
+		c.peers[p.jid] = p
+		c.mu.Unlock()
+	}
+	if r != c.h.globalChat {
+		if err := c.h.checkRoomAccess(p, r, ""); err != nil {
+			if created {
+				_ = p.Close()
+			}
+			cond := "forbidden"
+			switch err {
+			case errRoomInviteOnly:
+				cond = "registration-required"
+			case errRoomPassword:
+				cond = "not-authorized"
+			}
+			return c.send(&xmppPresence{
+				From: st.To, To: st.From, ID: st.ID, Type: "error",
+				Error: newXMPPError("auth", cond, err.Error()),
+			})
+		}
+	}
+	if !p.setJoined(r, true) {
+		return nil
+	}
+	if r != c.h.globalChat {
+		r.Join(p)
+	}
+	for _, p2 := range r.Peers() {
+		if p2 == Peer(p) {
+			continue
+		}
+		if err := p.occupant(r, p2.Name(), true, false); err != nil {
+			return err
+		}
+	}
+	return p.occupant(r, p.Name(), true, true)
+}
+
+func (c *xmppComponent) handleMessage(st *xmppStanza) error {
+	if st.Body == "" {
+		return nil
+	}
+	p := c.peer(st.From)
+	if p == nil {
+		return c.send(&xmppMessage{
+			From: st.To, To: st.From, ID: st.ID, Type: "error",
+			Error: newXMPPError("cancel", "not-acceptable", "not in the room"),
+		})
+	}
+	msg := Message{Text: st.Body}
+	if strings.HasPrefix(msg.Text, "/me ") {
+		msg.Text, msg.Me = msg.Text[4:], true
+	}
+	node, _, nick := splitJID(st.To)
+	switch st.Type {
+	case "groupchat":
+		r := c.roomByNode(node)
+		if r == nil || !p.inRoom(r) {
+			return nil
+		}
+		r.SendChat(p, msg)
+	case "chat", "":
+		to := c.h.PeerByName(nick)
+		if to == nil {
+			return c.send(&xmppMessage{
+				From: st.To, To: st.From, ID: st.ID, Type: "error",
+				Error: newXMPPError("cancel", "item-not-found", ""),
+			})
+		}
+		c.h.privateChat(p, to, msg)
+	}
+	return nil
+}
+
+func (c *xmppComponent) handleIQ(st *xmppStanza) error {
+	if st.Type != "get" && st.Type != "set" {
+		return nil
+	}
+	resp := &xmppIQ{From: st.To, To: st.From, ID: st.ID, Type: "result"}
+	if st.Type == "get" && st.Query != nil && st.Query.XMLName.Space == xmppNSDiscoInfo {
+		node, _, _ := splitJID(st.To)
+		disco := &xmppDiscoInfo{Feature: []xmppFeature{{Var: xmppNSDiscoInfo}, {Var: xmppNSMUC}}}
+		if node == "" {
+			disco.Identity = []xmppIdentity{{Category: "conference", Type: "text", Name: c.h.getName()}}
+		} else if r := c.roomByNode(node); r != nil {
+			name := r.Name()
+			if r == c.h.globalChat {
+				name = c.h.getName()
+			}
+			disco.Identity = []xmppIdentity{{Category: "conference", Type: "text", Name: name}}
+		} else {
+			resp.Type = "error"
+			resp.Error = newXMPPError("cancel", "item-not-found", "")
+			return c.send(resp)
+		}
+		resp.Disco = disco
+		return c.send(resp)
+	}
+	resp.Type = "error"
+	resp.Error = newXMPPError("cancel", "service-unavailable", "")
+	return c.send(resp)
+}
+
+func (c *xmppComponent) run(closed <-chan struct{}) {
+	for {
+		conn, err := net.Dial("tcp", c.conf.Addr)
+		if err == nil {
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-closed:
+				case <-done:
+				}
+				_ = conn.Close()
+			}()
+			err = c.serve(conn)
+			close(done)
+		}
+		select {
+		case <-closed:
+			return
+		default:
+		}
+		log.Printf("xmpp: %s: %v, reconnecting", c.conf.Addr, err)
+		select {
+		case <-closed:
+			return
+		case <-time.After(xmppRetry):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package hub
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitJID(t *testing.T) {
+	node, domain, res := splitJID("hub@dc.example.org/alice")
+	require.Equal(t, "hub", node)
+	require.Equal(t, "dc.example.org", domain)
+	require.Equal(t, "alice", res)
+
+	node, domain, res = splitJID("dc.example.org")
+	require.Equal(t, "", node)
+	require.Equal(t, "dc.example.org", domain)
+	require.Equal(t, "", res)
+}
+
+// xmppTestServer accepts a single component connection.
+type xmppTestServer struct {
+	t    *testing.T
+	conn net.Conn
+	dec  *xml.Decoder
+}
+
+func (s *xmppTestServer) write(format string, args ...interface{}) {
+	_, err := fmt.Fprintf(s.conn, format, args...)
+	require.NoError(s.t, err)
+}
+
+// next reads the next stanza sent by the component.
+func (s *xmppTestServer) next() xmppStanza {
+	_ = s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		tok, err := s.dec.Token()
+		require.NoError(s.t, err)
+		if se, ok := tok.(xml.StartElement); ok {
+			var st xmppStanza
+			require.NoError(s.t, s.dec.DecodeElement(&st, &se))
+			return st
+		}
+	}
+}
+
+func TestXMPPGateway(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	h, err := NewHub(Config{
+		XMPP: &XMPPConfig{
+			Addr:   l.Addr().String(),
+			Domain: "dc.example.org",
+			Secret: "secret",
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, h.Start())
+	defer h.Close()
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	s := &xmppTestServer{t: t, conn: conn, dec: xml.NewDecoder(bufio.NewReader(conn))}
+
+	// handshake
+	tok, err := s.dec.Token()
+	require.NoError(t, err)
+	if _, ok := tok.(xml.ProcInst); ok {
+		tok, err = s.dec.Token()
+		require.NoError(t, err)
+	}
+	require.Equal(t, "stream", tok.(xml.StartElement).Name.Local)
+	s.write(`<stream:stream xmlns='jabber:component:accept' xmlns:stream='http://etherx.jabber.org/streams' id='s1' from='dc.example.org'>`)
+	var hs struct {
+		XMLName xml.Name
+		Text    string `xml:",chardata"`
+	}
+	for {
+		tok, err = s.dec.Token()
+		require.NoError(t, err)
+		if se, ok := tok.(xml.StartElement); ok {
+			require.NoError(t, s.dec.DecodeElement(&hs, &se))
+			break
+		}
+	}
+	sum := sha1.Sum([]byte("s1secret"))
+	require.Equal(t, "handshake", hs.XMLName.Local)
+	require.Equal(t, hex.EncodeToString(sum[:]), hs.Text)
+	s.write(`<handshake/>`)
+
+	p := newTestADCPeer(t, h, "user")
+	sentADC(p)
+
+	// join the main room
+	s.write(`<presence from='alice@example.org/res' to='hub@dc.example.org/alice'><x xmlns='http://jabber.org/protocol/muc'/></presence>`)
+	var (
+		st        xmppStanza
+		self      bool
+		occupants []string
+	)
+	for !self {
+		st = s.next()
+		require.Equal(t, "presence", st.XMLName.Local)
+		require.Equal(t, "alice@example.org/res", st.To)
+		_, _, nick := splitJID(st.From)
+		if nick == "alice" {
+			self = true
+		} else {
+			occupants = append(occupants, nick)
+		}
+	}
+	require.Contains(t, occupants, "user")
+	require.NotNil(t, h.PeerByName("alice"))
+	require.Equal(t, ProtoXMPP, PeerProtocol(h.PeerByName("alice")))
+
+	// XMPP -> DC
+	s.write(`<message from='alice@example.org/res' to='hub@dc.example.org' type='groupchat'><body>hello</body></message>`)
+	st = s.next()
+	require.Equal(t, "groupchat", st.Type)
+	require.Equal(t, "hub@dc.example.org/alice", st.From)
+	require.Equal(t, "hello", st.Body)
+	require.Contains(t, lastChat(t, p), "hello")
+
+	// DC -> XMPP
+	h.globalChat.SendChat(p, Message{Text: "hi"})
+	st = s.next()
+	require.Equal(t, "hub@dc.example.org/user", st.From)
+	require.Equal(t, "hi", st.Body)
+
+	// duplicate nick
+	s.write(`<presence from='bob@example.org/res' to='hub@dc.example.org/user'/>`)
+	st = s.next()
+	require.Equal(t, "error", st.Type)
+
+	// leave
+	s.write(`<presence from='alice@example.org/res' to='hub@dc.example.org/alice' type='unavailable'/>`)
+	st = s.next()
+	require.Equal(t, "unavailable", st.Type)
+	for i := 0; i < 100 && h.PeerByName("alice") != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Nil(t, h.PeerByName("alice"))
+}
@@ -0,0 +1,108 @@
+// Package hubauth implements authentication providers for the hub.
+package hubauth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/hub"
+)
+
+var (
+	_ hub.AuthProvider = (*File)(nil)
+	_ hub.UserLookup   = (*File)(nil)
+)
+
+// OpenFile opens a static file with user accounts.
+//
+// Each line of the file has a form of "name:password[:profile]". Empty lines and lines starting
+// with '#' are ignored. The file is reloaded automatically when it changes.
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// File is an authentication provider that reads user accounts from a static file.
+type File struct {
+	path string
+
+	mu    sync.Mutex
+	mtime time.Time
+	users map[string]hub.UserRecord
+}
+
+func (f *File) Name() string {
+	return "file"
+}
+
+// reload reads the file if it was modified. Must be called with the lock held, or before the provider is used.
+func (f *File) reload() error {
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	} else if f.users != nil && st.ModTime().Equal(f.mtime) {
+		return nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string]hub.UserRecord)
+	sc := bufio.NewScanner(file)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		sub := strings.SplitN(line, ":", 3)
+		if len(sub) < 2 || sub[0] == "" {
+			return fmt.Errorf("%s:%d: expected name:password[:profile]", f.path, n)
+		}
+		rec := hub.UserRecord{Name: sub[0], Pass: sub[1]}
+		if len(sub) > 2 {
+			rec.Profile = sub[2]
+		}
+		users[rec.Name] = rec
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	f.users = users
+	f.mtime = st.ModTime()
+	return nil
+}
+
+func (f *File) LookupUser(name string) (*hub.UserRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	rec, ok := f.users[name]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (f *File) Authenticate(name, pass string) (string, error) {
+	rec, err := f.LookupUser(name)
+	if err != nil {
+		return "", err
+	} else if rec == nil {
+		return "", hub.ErrAuthUnknownUser
+	} else if pass == "" || subtle.ConstantTimeCompare([]byte(rec.Pass), []byte(pass)) != 1 {
+		return "", hub.ErrAuthWrongPassword
+	}
+	return rec.Profile, nil
+}
@@ -0,0 +1,107 @@
+package hubauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/hub"
+)
+
+var (
+	_ hub.AuthProvider = (*HTTP)(nil)
+	_ hub.UserChecker  = (*HTTP)(nil)
+)
+
+// DefaultHTTPTimeout is the default timeout for requests to the authentication webhook.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// NewHTTP creates an authentication provider that calls an external HTTP webhook.
+//
+// The webhook receives a POST request with "nick" and "password" form values. It must respond with:
+//
+//	200 - the password is correct; the body may contain a JSON object: {"profile": "name"}
+//	401 or 403 - the password is wrong
+//	404 - the user is not known
+//
+// To check if the user is known, the hub sends a request without the password. The webhook
+// must respond with 404 for unknown users and 401 or 403 for known ones in this case.
+//
+// If the token is set, it is sent in the Authorization header as a bearer token.
+func NewHTTP(url, token string) *HTTP {
+	return &HTTP{
+		url:   url,
+		token: token,
+		cli:   &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+}
+
+// HTTP is an authentication provider that calls an external HTTP webhook.
+type HTTP struct {
+	url   string
+	token string
+	cli   *http.Client
+}
+
+func (p *HTTP) Name() string {
+	return "http"
+}
+
+// HasUser implements hub.UserChecker.
+func (p *HTTP) HasUser(name string) (bool, error) {
+	_, err := p.call(url.Values{"nick": {name}})
+	switch err {
+	case hub.ErrAuthUnknownUser:
+		return false, nil
+	case nil, hub.ErrAuthWrongPassword:
+		return true, nil
+	}
+	return false, err
+}
+
+func (p *HTTP) Authenticate(name, pass string) (string, error) {
+	if pass == "" {
+		return "", hub.ErrAuthWrongPassword
+	}
+	return p.call(url.Values{
+		"nick":     {name},
+		"password": {pass},
+	})
+}
+
+func (p *HTTP) call(form url.Values) (string, error) {
+	req, err := http.NewRequest("POST", p.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.cli.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", hub.ErrAuthWrongPassword
+	case http.StatusNotFound:
+		return "", hub.ErrAuthUnknownUser
+	default:
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	var out struct {
+		Profile string `json:"profile"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil && err != io.EOF {
+		return "", fmt.Errorf("cannot decode response: %v", err)
+	}
+	return out.Profile, nil
+}
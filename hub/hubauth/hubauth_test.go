@@ -0,0 +1,216 @@
+package hubauth
+
+import (
+	"bufio"
+	"encoding/asn1"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/hub"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hubauth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "users.txt")
+	err = ioutil.WriteFile(path, []byte("# accounts\nalice:secret\n\nbob:pass:op\n"), 0600)
+	require.NoError(t, err)
+
+	f, err := OpenFile(path)
+	require.NoError(t, err)
+
+	rec, err := f.LookupUser("bob")
+	require.NoError(t, err)
+	require.Equal(t, &hub.UserRecord{Name: "bob", Pass: "pass", Profile: "op"}, rec)
+
+	profile, err := f.Authenticate("alice", "secret")
+	require.NoError(t, err)
+	require.Equal(t, "", profile)
+
+	_, err = f.Authenticate("alice", "wrong")
+	require.Equal(t, hub.ErrAuthWrongPassword, err)
+
+	_, err = f.Authenticate("carol", "secret")
+	require.Equal(t, hub.ErrAuthUnknownUser, err)
+
+	_, err = f.Authenticate("alice", "")
+	require.Equal(t, hub.ErrAuthWrongPassword, err)
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch {
+		case r.FormValue("nick") != "alice":
+			w.WriteHeader(http.StatusNotFound)
+		case r.FormValue("password") != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.Write([]byte(`{"profile":"op"}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHTTP(srv.URL, "token")
+
+	profile, err := p.Authenticate("alice", "secret")
+	require.NoError(t, err)
+	require.Equal(t, "op", profile)
+
+	_, err = p.Authenticate("alice", "wrong")
+	require.Equal(t, hub.ErrAuthWrongPassword, err)
+
+	_, err = p.Authenticate("bob", "secret")
+	require.Equal(t, hub.ErrAuthUnknownUser, err)
+
+	_, err = p.Authenticate("alice", "")
+	require.Equal(t, hub.ErrAuthWrongPassword, err)
+
+	ok, err := p.HasUser("alice")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = p.HasUser("bob")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// serveLDAP accepts a single connection and responds to a bind request.
+func serveLDAP(t *testing.T, l net.Listener, dn, pass string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	data, err := readBER(bufio.NewReader(conn))
+	require.NoError(t, err)
+	var m ldapMessage
+	_, err = asn1.Unmarshal(data, &m)
+	require.NoError(t, err)
+
+	var (
+		vers       int
+		gotDN      []byte
+		simpleAuth asn1.RawValue
+	)
+	rest, err := asn1.Unmarshal(m.Op.Bytes, &vers)
+	require.NoError(t, err)
+	rest, err = asn1.Unmarshal(rest, &gotDN)
+	require.NoError(t, err)
+	_, err = asn1.Unmarshal(rest, &simpleAuth)
+	require.NoError(t, err)
+
+	code := ldapSuccess
+	if string(gotDN) != dn || string(simpleAuth.Bytes) != pass {
+		code = ldapInvalidCredentials
+	}
+	var body []byte
+	for _, v := range []interface{}{asn1.Enumerated(code), []byte{}, []byte{}} {
+		b, err := asn1.Marshal(v)
+		require.NoError(t, err)
+		body = append(body, b...)
+	}
+	resp, err := asn1.Marshal(ldapMessage{
+		ID: m.ID,
+		Op: asn1.RawValue{Class: asn1.ClassApplication, Tag: 1, IsCompound: true, Bytes: body},
+	})
+	require.NoError(t, err)
+	_, err = conn.Write(resp)
+	require.NoError(t, err)
+}
+
+func TestLDAP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	p, err := NewLDAP(LDAPConfig{
+		Addr:    l.Addr().String(),
+		DN:      "uid=%s,dc=example,dc=org",
+		Profile: "user",
+	})
+	require.NoError(t, err)
+
+	go serveLDAP(t, l, `uid=a\,b,dc=example,dc=org`, "secret")
+	profile, err := p.Authenticate("a,b", "secret")
+	require.NoError(t, err)
+	require.Equal(t, "user", profile)
+
+	go serveLDAP(t, l, `uid=a\,b,dc=example,dc=org`, "secret")
+	_, err = p.Authenticate("a,b", "wrong")
+	require.Equal(t, hub.ErrAuthWrongPassword, err)
+
+	// empty password is rejected without asking the server
+	_, err = p.Authenticate("a,b", "")
+	require.Equal(t, hub.ErrAuthWrongPassword, err)
+
+	// all users exist unless the lookup is enabled
+	ok, err := p.HasUser("c")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	p.conf.Lookup = true
+	go serveLDAPSearch(t, l, `uid=a\,b,dc=example,dc=org`)
+	ok, err = p.HasUser("a,b")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	go serveLDAPSearch(t, l, `uid=a\,b,dc=example,dc=org`)
+	ok, err = p.HasUser("c")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// serveLDAPSearch accepts a single connection and responds to a base object search.
+func serveLDAPSearch(t *testing.T, l net.Listener, dn string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	data, err := readBER(bufio.NewReader(conn))
+	require.NoError(t, err)
+	var m ldapMessage
+	_, err = asn1.Unmarshal(data, &m)
+	require.NoError(t, err)
+	require.Equal(t, 3, m.Op.Tag)
+	var base []byte
+	_, err = asn1.Unmarshal(m.Op.Bytes, &base)
+	require.NoError(t, err)
+
+	write := func(tag int, body []byte) {
+		resp, err := asn1.Marshal(ldapMessage{
+			ID: m.ID,
+			Op: asn1.RawValue{Class: asn1.ClassApplication, Tag: tag, IsCompound: true, Bytes: body},
+		})
+		require.NoError(t, err)
+		_, err = conn.Write(resp)
+		require.NoError(t, err)
+	}
+	code := ldapNoSuchObject
+	if string(base) == dn {
+		code = ldapSuccess
+		entry, err := asn1.Marshal(base)
+		require.NoError(t, err)
+		attrs, err := asn1.Marshal([][]byte{})
+		require.NoError(t, err)
+		write(4, append(entry, attrs...))
+	}
+	var body []byte
+	for _, v := range []interface{}{asn1.Enumerated(code), []byte{}, []byte{}} {
+		b, err := asn1.Marshal(v)
+		require.NoError(t, err)
+		body = append(body, b...)
+	}
+	write(5, body)
+}
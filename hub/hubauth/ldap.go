@@ -0,0 +1,328 @@
+package hubauth
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/hub"
+)
+
+var (
+	_ hub.AuthProvider = (*LDAP)(nil)
+	_ hub.UserChecker  = (*LDAP)(nil)
+)
+
+// DefaultLDAPTimeout is the default timeout for a bind request to the LDAP server.
+const DefaultLDAPTimeout = 10 * time.Second
+
+// LDAP result codes, see RFC 4511.
+const (
+	ldapSuccess            = 0
+	ldapNoSuchObject       = 32
+	ldapInvalidCredentials = 49
+)
+
+// LDAPConfig configures an LDAP authentication provider.
+type LDAPConfig struct {
+	// Addr of the LDAP server (host:port).
+	Addr string
+	// TLS enables LDAPS.
+	TLS bool
+	// DN is a template of the user's distinguished name. The "%s" is replaced with an escaped nick.
+	// For example: "uid=%s,ou=people,dc=example,dc=org".
+	DN string
+	// Profile assigned to authenticated users. Empty means the default profile of registered users.
+	Profile string
+	// Timeout of the bind request. Zero value means DefaultLDAPTimeout.
+	Timeout time.Duration
+	// Lookup enables an anonymous search for the user entry to check if the user exists.
+	// A missing entry means an unknown user, thus the server must allow anonymous reads
+	// of all user entries. By default, all users are assumed to exist.
+	Lookup bool
+}
+
+// NewLDAP creates an authentication provider that performs an LDAP simple bind with user's credentials.
+//
+// A bind cannot distinguish unknown users from wrong passwords, thus this provider never
+// passes the user to the next provider in the chain, unless LDAPConfig.Lookup is set.
+func NewLDAP(conf LDAPConfig) (*LDAP, error) {
+	if conf.Addr == "" {
+		return nil, errors.New("LDAP server address must be set")
+	} else if strings.Count(conf.DN, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP DN template must contain exactly one %%s: %q", conf.DN)
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultLDAPTimeout
+	}
+	return &LDAP{conf: conf}, nil
+}
+
+// LDAP is an authentication provider that performs an LDAP simple bind with user's credentials.
+type LDAP struct {
+	conf LDAPConfig
+}
+
+func (p *LDAP) Name() string {
+	return "ldap"
+}
+
+func (p *LDAP) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: p.conf.Timeout}
+	if p.conf.TLS {
+		host, _, _ := net.SplitHostPort(p.conf.Addr)
+		return tls.DialWithDialer(d, "tcp", p.conf.Addr, &tls.Config{ServerName: host})
+	}
+	return d.Dial("tcp", p.conf.Addr)
+}
+
+// HasUser implements hub.UserChecker.
+func (p *LDAP) HasUser(name string) (bool, error) {
+	if !p.conf.Lookup {
+		return true, nil
+	}
+	return p.lookup(name)
+}
+
+func (p *LDAP) Authenticate(name, pass string) (string, error) {
+	if pass == "" {
+		// empty password is an unauthenticated bind, which always succeeds
+		return "", hub.ErrAuthWrongPassword
+	}
+	conn, err := p.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(p.conf.Timeout))
+
+	dn := fmt.Sprintf(p.conf.DN, escapeDN(name))
+	req, err := ldapBindRequest(1, dn, pass)
+	if err != nil {
+		return "", err
+	}
+	if _, err = conn.Write(req); err != nil {
+		return "", err
+	}
+	code, msg, err := readBindResponse(bufio.NewReader(conn))
+	if err != nil {
+		return "", err
+	}
+	if req, err := ldapUnbindRequest(2); err == nil {
+		_, _ = conn.Write(req)
+	}
+	switch code {
+	case ldapSuccess:
+		return p.conf.Profile, nil
+	case ldapInvalidCredentials:
+		return "", hub.ErrAuthWrongPassword
+	}
+	return "", fmt.Errorf("LDAP bind failed with code %d: %s", code, msg)
+}
+
+// lookup checks if the user entry exists. The user is assumed to exist if the server refuses to tell.
+func (p *LDAP) lookup(name string) (bool, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(p.conf.Timeout))
+
+	dn := fmt.Sprintf(p.conf.DN, escapeDN(name))
+	req, err := ldapSearchRequest(1, dn, p.conf.Timeout)
+	if err != nil {
+		return false, err
+	}
+	if _, err = conn.Write(req); err != nil {
+		return false, err
+	}
+	found, code, _, err := readSearchResult(bufio.NewReader(conn))
+	if err != nil {
+		return false, err
+	}
+	if req, err := ldapUnbindRequest(2); err == nil {
+		_, _ = conn.Write(req)
+	}
+	if code == ldapNoSuchObject || (code == ldapSuccess && !found) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// escapeDN escapes a value of an attribute in a distinguished name, see RFC 4514.
+func escapeDN(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			i == 0 && (c == '#' || c == ' '),
+			i == len(s)-1 && c == ' ':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == 0:
+			buf.WriteString(`\00`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+type ldapMessage struct {
+	ID int
+	Op asn1.RawValue
+}
+
+func ldapBindRequest(id int, dn, pass string) ([]byte, error) {
+	var body []byte
+	for _, v := range []interface{}{
+		3, // protocol version
+		[]byte(dn),
+		asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte(pass)}, // simple auth
+	} {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, b...)
+	}
+	return asn1.Marshal(ldapMessage{
+		ID: id,
+		Op: asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: body},
+	})
+}
+
+// ldapSearchRequest builds a request that reads the entry with a given DN, without any attributes.
+func ldapSearchRequest(id int, dn string, timeout time.Duration) ([]byte, error) {
+	var body []byte
+	for _, v := range []interface{}{
+		[]byte(dn),
+		asn1.Enumerated(0), // scope: base object
+		asn1.Enumerated(0), // never dereference aliases
+		0,                  // no size limit
+		int(timeout / time.Second),
+		false, // types only
+		asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: []byte("objectClass")}, // (objectClass=*)
+		[][]byte{[]byte("1.1")}, // no attributes
+	} {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, b...)
+	}
+	return asn1.Marshal(ldapMessage{
+		ID: id,
+		Op: asn1.RawValue{Class: asn1.ClassApplication, Tag: 3, IsCompound: true, Bytes: body},
+	})
+}
+
+func ldapUnbindRequest(id int) ([]byte, error) {
+	return asn1.Marshal(ldapMessage{
+		ID: id,
+		Op: asn1.RawValue{Class: asn1.ClassApplication, Tag: 2, Bytes: []byte{}},
+	})
+}
+
+// readBindResponse reads an LDAP bind response and returns the result code and the diagnostic message.
+func readBindResponse(r *bufio.Reader) (int, string, error) {
+	data, err := readBER(r)
+	if err != nil {
+		return 0, "", err
+	}
+	var m ldapMessage
+	if _, err = asn1.Unmarshal(data, &m); err != nil {
+		return 0, "", err
+	} else if m.Op.Class != asn1.ClassApplication || m.Op.Tag != 1 {
+		return 0, "", fmt.Errorf("expected LDAP bind response, got tag %d", m.Op.Tag)
+	}
+	return parseResult(m.Op.Bytes)
+}
+
+// readSearchResult reads LDAP search responses until the search is done. It returns true
+// if an entry was found, the result code and the diagnostic message.
+func readSearchResult(r *bufio.Reader) (bool, int, string, error) {
+	found := false
+	for {
+		data, err := readBER(r)
+		if err != nil {
+			return false, 0, "", err
+		}
+		var m ldapMessage
+		if _, err = asn1.Unmarshal(data, &m); err != nil {
+			return false, 0, "", err
+		} else if m.Op.Class != asn1.ClassApplication {
+			return false, 0, "", fmt.Errorf("unexpected LDAP message class %d", m.Op.Class)
+		}
+		switch m.Op.Tag {
+		case 4: // entry
+			found = true
+		case 19: // reference
+		case 5: // done
+			code, msg, err := parseResult(m.Op.Bytes)
+			return found, code, msg, err
+		default:
+			return false, 0, "", fmt.Errorf("expected LDAP search response, got tag %d", m.Op.Tag)
+		}
+	}
+}
+
+// parseResult parses an LDAP result and returns the result code and the diagnostic message.
+func parseResult(data []byte) (int, string, error) {
+	var code asn1.Enumerated
+	rest, err := asn1.Unmarshal(data, &code)
+	if err != nil {
+		return 0, "", err
+	}
+	var dn, msg []byte
+	if rest, err = asn1.Unmarshal(rest, &dn); err != nil {
+		return 0, "", err
+	}
+	if _, err = asn1.Unmarshal(rest, &msg); err != nil {
+		return 0, "", err
+	}
+	return int(code), string(msg), nil
+}
+
+// maxBERSize limits the size of LDAP messages accepted from the server.
+const maxBERSize = 64 * 1024
+
+// readBER reads a single BER element with a definite length.
+func readBER(r *bufio.Reader) ([]byte, error) {
+	var hdr [6]byte
+	if _, err := io.ReadFull(r, hdr[:2]); err != nil {
+		return nil, err
+	}
+	n, size := int(hdr[1]), 2
+	if n&0x80 != 0 {
+		cnt := n & 0x7f
+		if cnt == 0 || cnt > 4 {
+			return nil, errors.New("unsupported BER length")
+		}
+		if _, err := io.ReadFull(r, hdr[2:2+cnt]); err != nil {
+			return nil, err
+		}
+		n = 0
+		for _, b := range hdr[2 : 2+cnt] {
+			n = n<<8 | int(b)
+		}
+		size += cnt
+	}
+	if n > maxBERSize {
+		return nil, fmt.Errorf("LDAP message is too large: %d", n)
+	}
+	buf := make([]byte, size+n)
+	copy(buf, hdr[:size])
+	if _, err := io.ReadFull(r, buf[size:]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -6,12 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/direct-connect/go-dcpp/hub"
 
 	_ "github.com/hidal-go/hidalgo/kv/all"
 
+	"github.com/hidal-go/hidalgo/filter"
 	"github.com/hidal-go/hidalgo/kv"
 	"github.com/hidal-go/hidalgo/kv/kvdebug"
 	"github.com/hidal-go/hidalgo/tuple"
@@ -26,6 +28,12 @@ const (
 	tableUsersByName = "usersByName" // TODO: replace with secondary index once it's supported
 	tableProfiles    = "profiles"
 	tableBans        = "bans"
+	tableLogins      = "logins"
+	tableAudit       = "audit"
+	tableHistory     = "history"
+	tableNotes       = "notes"
+	tableWatch       = "watch"
+	tableRooms       = "rooms"
 )
 
 func Open(typ, path string) (hub.Database, error) {
@@ -57,6 +65,12 @@ type tupleDatabase struct {
 	usersByName tuple.TableInfo
 	profiles    tuple.TableInfo
 	bans        tuple.TableInfo
+	logins      tuple.TableInfo
+	audit       tuple.TableInfo
+	history     tuple.TableInfo
+	notes       tuple.TableInfo
+	watch       tuple.TableInfo
+	rooms       tuple.TableInfo
 }
 
 func (db *tupleDatabase) Close() error {
@@ -77,6 +91,24 @@ func (db *tupleDatabase) openTables() error {
 	if err := db.openBans(ctx); err != nil {
 		return err
 	}
+	if err := db.openLogins(ctx); err != nil {
+		return err
+	}
+	if err := db.openAudit(ctx); err != nil {
+		return err
+	}
+	if err := db.openHistory(ctx); err != nil {
+		return err
+	}
+	if err := db.openNotes(ctx); err != nil {
+		return err
+	}
+	if err := db.openWatch(ctx); err != nil {
+		return err
+	}
+	if err := db.openRooms(ctx); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -94,6 +126,11 @@ func (db *tupleDatabase) upgradeUsers(ctx context.Context) error {
 		if err := db.migrateUsersV2(ctx); err != nil {
 			return err
 		}
+	} else if len(h.Data) < 7 {
+		// no rules acceptance, registration or login time, or the previous profile
+		if err := db.migrateUsersV5(ctx); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -147,7 +184,7 @@ func (db *tupleDatabase) migrateUsersV2(ctx context.Context) error {
 	if err = tbl.Drop(ctx); err != nil {
 		return err
 	}
-	if err = db.createUsersV2(ctx, tx); err != nil {
+	if err = db.createUsersV5(ctx, tx); err != nil {
 		return err
 	}
 	if err = db.createUsersIndexV2(ctx, tx); err != nil {
@@ -165,7 +202,7 @@ func (db *tupleDatabase) migrateUsersV2(ctx context.Context) error {
 		name, pass := u[0], u[1]
 		key, err := tbl.InsertTuple(ctx, tuple.Tuple{
 			Key:  tuple.AutoKey(),
-			Data: tuple.Data{name, pass, values.String("")},
+			Data: fromUserRec(&hub.UserRecord{Name: string(name), Pass: string(pass)}),
 		})
 		if err != nil {
 			return err
@@ -181,7 +218,92 @@ func (db *tupleDatabase) migrateUsersV2(ctx context.Context) error {
 	return tx.Commit(ctx)
 }
 
-func (db *tupleDatabase) createUsersV2(ctx context.Context, tx tuple.Tx) error {
+func (db *tupleDatabase) migrateUsersV5(ctx context.Context) error {
+	log.Println("migrating users table to v5")
+	// read all users
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.users.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	it := tbl.Scan(nil)
+	defer it.Close()
+
+	var users []*hub.UserRecord
+	for it.Next(ctx) {
+		rec, err := asUserRec(it.Data())
+		if err != nil {
+			return err
+		}
+		users = append(users, rec)
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	_ = it.Close()
+	_ = tx.Close()
+
+	// drop old tables, create new ones
+	tx, err = db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err = db.users.Open(tx)
+	if err != nil {
+		return err
+	}
+	if err = tbl.Drop(ctx); err != nil {
+		return err
+	}
+	index, err := tx.Table(ctx, tableUsersByName)
+	if err != nil {
+		return err
+	}
+	if err = index.Drop(ctx); err != nil {
+		return err
+	}
+	if err = db.createUsersV5(ctx, tx); err != nil {
+		return err
+	}
+	if err = db.createUsersIndexV2(ctx, tx); err != nil {
+		return err
+	}
+	tbl, err = tx.Table(ctx, tableUsers)
+	if err != nil {
+		return err
+	}
+	index, err = tx.Table(ctx, tableUsersByName)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		key, err := tbl.InsertTuple(ctx, tuple.Tuple{
+			Key:  tuple.AutoKey(),
+			Data: fromUserRec(u),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = index.InsertTuple(ctx, tuple.Tuple{
+			Key:  tuple.SKey(u.Name),
+			Data: tuple.Data{key[0]},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) createUsersV5(ctx context.Context, tx tuple.Tx) error {
 	return db.createTable(ctx, tx, tuple.Header{
 		Name: tableUsers,
 		Key: []tuple.KeyField{
@@ -193,6 +315,10 @@ func (db *tupleDatabase) createUsersV2(ctx context.Context, tx tuple.Tx) error {
 			//       due to the protocol limitations
 			{Name: "pass", Type: values.StringType{}},
 			{Name: "profile", Type: values.StringType{}},
+			{Name: "rules", Type: values.TimeType{}},
+			{Name: "registered", Type: values.TimeType{}},
+			{Name: "last_login", Type: values.TimeType{}},
+			{Name: "prev_profile", Type: values.StringType{}},
 		},
 	})
 }
@@ -266,7 +392,7 @@ func (db *tupleDatabase) openUsers(ctx context.Context) error {
 	} else if err != tuple.ErrTableNotFound {
 		return err
 	}
-	if err := db.inTx(ctx, true, db.createUsersV2); err != nil {
+	if err := db.inTx(ctx, true, db.createUsersV5); err != nil {
 		return err
 	}
 	if err := db.inTx(ctx, true, db.createUsersIndexV2); err != nil {
@@ -327,6 +453,208 @@ func (db *tupleDatabase) openBans(ctx context.Context) error {
 	return nil
 }
 
+func (db *tupleDatabase) createLoginsV1(ctx context.Context, tx tuple.Tx) error {
+	return db.createTable(ctx, tx, tuple.Header{
+		Name: tableLogins,
+		Key: []tuple.KeyField{
+			{Name: "name", Type: values.StringType{}},
+			{Name: "login", Type: values.TimeType{}},
+		},
+		Data: []tuple.Field{
+			{Name: "logout", Type: values.TimeType{}},
+			{Name: "ip", Type: values.StringType{}},
+			{Name: "cid", Type: values.StringType{}},
+		},
+	})
+}
+
+func (db *tupleDatabase) openLogins(ctx context.Context) error {
+	logins, err := db.db.Table(ctx, tableLogins)
+	if err == nil {
+		db.logins = logins
+		return nil
+	} else if err != tuple.ErrTableNotFound {
+		return err
+	}
+	if err := db.inTx(ctx, true, db.createLoginsV1); err != nil {
+		return err
+	}
+	logins, err = db.db.Table(ctx, tableLogins)
+	if err != nil {
+		return err
+	}
+	db.logins = logins
+	return nil
+}
+
+func (db *tupleDatabase) createAuditV1(ctx context.Context, tx tuple.Tx) error {
+	return db.createTable(ctx, tx, tuple.Header{
+		Name: tableAudit,
+		Key: []tuple.KeyField{
+			{Name: "id", Type: values.UIntType{}, Auto: true},
+		},
+		Data: []tuple.Field{
+			{Name: "time", Type: values.TimeType{}},
+			{Name: "action", Type: values.StringType{}},
+			{Name: "actor", Type: values.StringType{}},
+			{Name: "target", Type: values.StringType{}},
+			{Name: "reason", Type: values.StringType{}},
+		},
+	})
+}
+
+func (db *tupleDatabase) openAudit(ctx context.Context) error {
+	audit, err := db.db.Table(ctx, tableAudit)
+	if err == nil {
+		db.audit = audit
+		return nil
+	} else if err != tuple.ErrTableNotFound {
+		return err
+	}
+	if err := db.inTx(ctx, true, db.createAuditV1); err != nil {
+		return err
+	}
+	audit, err = db.db.Table(ctx, tableAudit)
+	if err != nil {
+		return err
+	}
+	db.audit = audit
+	return nil
+}
+
+func (db *tupleDatabase) createHistoryV1(ctx context.Context, tx tuple.Tx) error {
+	return db.createTable(ctx, tx, tuple.Header{
+		Name: tableHistory,
+		Key: []tuple.KeyField{
+			{Name: "join", Type: values.TimeType{}},
+			{Name: "name", Type: values.StringType{}},
+		},
+		Data: []tuple.Field{
+			{Name: "leave", Type: values.TimeType{}},
+			{Name: "ip", Type: values.StringType{}},
+			{Name: "cid", Type: values.StringType{}},
+		},
+	})
+}
+
+func (db *tupleDatabase) openHistory(ctx context.Context) error {
+	history, err := db.db.Table(ctx, tableHistory)
+	if err == nil {
+		db.history = history
+		return nil
+	} else if err != tuple.ErrTableNotFound {
+		return err
+	}
+	if err := db.inTx(ctx, true, db.createHistoryV1); err != nil {
+		return err
+	}
+	history, err = db.db.Table(ctx, tableHistory)
+	if err != nil {
+		return err
+	}
+	db.history = history
+	return nil
+}
+
+func (db *tupleDatabase) createNotesV1(ctx context.Context, tx tuple.Tx) error {
+	return db.createTable(ctx, tx, tuple.Header{
+		Name: tableNotes,
+		Key: []tuple.KeyField{
+			{Name: "target", Type: values.StringType{}},
+			{Name: "time", Type: values.TimeType{}},
+		},
+		Data: []tuple.Field{
+			{Name: "author", Type: values.StringType{}},
+			{Name: "tag", Type: values.StringType{}},
+			{Name: "text", Type: values.StringType{}},
+		},
+	})
+}
+
+func (db *tupleDatabase) openNotes(ctx context.Context) error {
+	notes, err := db.db.Table(ctx, tableNotes)
+	if err == nil {
+		db.notes = notes
+		return nil
+	} else if err != tuple.ErrTableNotFound {
+		return err
+	}
+	if err := db.inTx(ctx, true, db.createNotesV1); err != nil {
+		return err
+	}
+	notes, err = db.db.Table(ctx, tableNotes)
+	if err != nil {
+		return err
+	}
+	db.notes = notes
+	return nil
+}
+
+func (db *tupleDatabase) createWatchV1(ctx context.Context, tx tuple.Tx) error {
+	return db.createTable(ctx, tx, tuple.Header{
+		Name: tableWatch,
+		Key: []tuple.KeyField{
+			{Name: "pattern", Type: values.StringType{}},
+		},
+		Data: []tuple.Field{
+			{Name: "action", Type: values.StringType{}},
+			{Name: "reason", Type: values.StringType{}},
+			{Name: "added", Type: values.TimeType{}},
+			{Name: "by", Type: values.StringType{}},
+		},
+	})
+}
+
+func (db *tupleDatabase) openWatch(ctx context.Context) error {
+	watch, err := db.db.Table(ctx, tableWatch)
+	if err == nil {
+		db.watch = watch
+		return nil
+	} else if err != tuple.ErrTableNotFound {
+		return err
+	}
+	if err := db.inTx(ctx, true, db.createWatchV1); err != nil {
+		return err
+	}
+	watch, err = db.db.Table(ctx, tableWatch)
+	if err != nil {
+		return err
+	}
+	db.watch = watch
+	return nil
+}
+
+func (db *tupleDatabase) createRoomsV1(ctx context.Context, tx tuple.Tx) error {
+	return db.createTable(ctx, tx, tuple.Header{
+		Name: tableRooms,
+		Key: []tuple.KeyField{
+			{Name: "name", Type: values.StringType{}},
+		},
+		Data: []tuple.Field{
+			{Name: "info", Type: values.StringType{}},
+		},
+	})
+}
+
+func (db *tupleDatabase) openRooms(ctx context.Context) error {
+	rooms, err := db.db.Table(ctx, tableRooms)
+	if err == nil {
+		db.rooms = rooms
+		return nil
+	} else if err != tuple.ErrTableNotFound {
+		return err
+	}
+	if err := db.inTx(ctx, true, db.createRoomsV1); err != nil {
+		return err
+	}
+	rooms, err = db.db.Table(ctx, tableRooms)
+	if err != nil {
+		return err
+	}
+	db.rooms = rooms
+	return nil
+}
+
 func (db *tupleDatabase) lookupUser(ctx context.Context, tx tuple.Tx, name string) (tuple.Key, error) {
 	index, err := db.usersByName.Open(tx)
 	if err != nil {
@@ -371,15 +699,45 @@ func asUserRec(data tuple.Data) (*hub.UserRecord, error) {
 	if !ok {
 		return nil, fmt.Errorf("expected string pass, got: %T", data[2])
 	}
-	return &hub.UserRecord{
+	rec := &hub.UserRecord{
 		Name:    string(rname),
 		Pass:    string(pass),
 		Profile: string(prof),
-	}, nil
+	}
+	// time columns were added in v4
+	for i, t := range []*time.Time{&rec.RulesAccepted, &rec.Registered, &rec.LastLogin} {
+		if len(data) <= 3+i {
+			break
+		}
+		v, ok := data[3+i].(values.Time)
+		if !ok {
+			return nil, fmt.Errorf("expected time, got: %T", data[3+i])
+		}
+		if tv := time.Time(v); tv.Unix() > 0 {
+			*t = tv
+		}
+	}
+	// previous profile was added in v5
+	if len(data) > 6 {
+		prev, ok := data[6].(values.String)
+		if !ok {
+			return nil, fmt.Errorf("expected string profile, got: %T", data[6])
+		}
+		rec.PrevProfile = string(prev)
+	}
+	return rec, nil
 }
 
 func fromUserRec(u *hub.UserRecord) tuple.Data {
-	return tuple.SData(u.Name, u.Pass, u.Profile)
+	return tuple.Data{
+		values.String(u.Name),
+		values.String(u.Pass),
+		values.String(u.Profile),
+		values.Time(u.RulesAccepted),
+		values.Time(u.Registered),
+		values.Time(u.LastLogin),
+		values.String(u.PrevProfile),
+	}
 }
 
 func (db *tupleDatabase) GetUser(name string) (*hub.UserRecord, error) {
@@ -433,7 +791,7 @@ func (db *tupleDatabase) ListUsers() ([]hub.UserRecord, error) {
 	var out []hub.UserRecord
 	for it.Next(ctx) {
 		data := it.Data()
-		if len(data) != 3 {
+		if len(data) != 6 {
 			if err = it.Err(); err != nil {
 				return nil, err
 			}
@@ -861,3 +1219,690 @@ func (db *tupleDatabase) ClearBans() error {
 	}
 	return tx.Commit(ctx)
 }
+
+func decodeLogin(key tuple.Key, data tuple.Data) (*hub.LoginRecord, error) {
+	if len(key) != 2 || len(data) != 3 {
+		return nil, fmt.Errorf("unexpected login record: %v, %v", key, data)
+	}
+	name, ok := key[0].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string name, got: %T", key[0])
+	}
+	login, ok := key[1].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected login time, got: %T", key[1])
+	}
+	logout, ok := data[0].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected logout time, got: %T", data[0])
+	}
+	ip, ok := data[1].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string IP, got: %T", data[1])
+	}
+	cid, ok := data[2].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string CID, got: %T", data[2])
+	}
+	rec := &hub.LoginRecord{
+		Name:  string(name),
+		Login: time.Time(login),
+		IP:    string(ip),
+		CID:   string(cid),
+	}
+	if t := time.Time(logout); t.Unix() > 0 {
+		rec.Logout = t
+	}
+	return rec, nil
+}
+
+// listLogins returns keys and records of all logins of the user, starting from the most recent one.
+func listLogins(ctx context.Context, tbl tuple.Table, name string) ([]tuple.Key, []hub.LoginRecord, error) {
+	it := tbl.Scan(&tuple.ScanOptions{
+		Filter: &tuple.Filter{
+			KeyFilter: tuple.KeyFilters{filter.EQ(values.String(name))},
+		},
+	})
+	defer it.Close()
+
+	var (
+		keys []tuple.Key
+		list []hub.LoginRecord
+	)
+	for it.Next(ctx) {
+		r, err := decodeLogin(it.Key(), it.Data())
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, it.Key())
+		list = append(list, *r)
+	}
+	if err := it.Err(); err != nil {
+		return nil, nil, err
+	}
+	sort.Sort(loginsByTime{keys: keys, list: list})
+	return keys, list, nil
+}
+
+type loginsByTime struct {
+	keys []tuple.Key
+	list []hub.LoginRecord
+}
+
+func (s loginsByTime) Len() int {
+	return len(s.list)
+}
+
+func (s loginsByTime) Less(i, j int) bool {
+	return s.list[i].Login.After(s.list[j].Login)
+}
+
+func (s loginsByTime) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.list[i], s.list[j] = s.list[j], s.list[i]
+}
+
+func (db *tupleDatabase) PutLogin(rec hub.LoginRecord) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.logins.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.UpdateTuple(ctx, tuple.Tuple{
+		Key: tuple.Key{values.String(rec.Name), values.Time(rec.Login)},
+		Data: tuple.Data{
+			values.Time(rec.Logout),
+			values.String(rec.IP),
+			values.String(rec.CID),
+		},
+	}, &tuple.UpdateOpt{Upsert: true})
+	if err != nil {
+		return err
+	}
+	// remove old records
+	keys, _, err := listLogins(ctx, tbl, rec.Name)
+	if err != nil {
+		return err
+	}
+	if len(keys) > hub.LoginHistorySize {
+		err = tbl.DeleteTuples(ctx, &tuple.Filter{
+			KeyFilter: tuple.Keys(keys[hub.LoginHistorySize:]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) ListLogins(name string) ([]hub.LoginRecord, error) {
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	tbl, err := db.logins.Open(tx)
+	if err != nil {
+		return nil, err
+	}
+	_, list, err := listLogins(context.TODO(), tbl, name)
+	return list, err
+}
+
+func decodeAudit(data tuple.Data) (*hub.AuditEntry, error) {
+	if len(data) != 5 {
+		return nil, fmt.Errorf("unexpected audit entry: %v", data)
+	}
+	t, ok := data[0].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected time, got: %T", data[0])
+	}
+	var str [4]string
+	for i := range str {
+		s, ok := data[1+i].(values.String)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got: %T", data[1+i])
+		}
+		str[i] = string(s)
+	}
+	return &hub.AuditEntry{
+		Time:   time.Time(t),
+		Action: str[0],
+		Actor:  str[1],
+		Target: str[2],
+		Reason: str[3],
+	}, nil
+}
+
+func (db *tupleDatabase) AppendAudit(e hub.AuditEntry) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.audit.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	_, err = tbl.InsertTuple(ctx, tuple.Tuple{
+		Key: tuple.AutoKey(),
+		Data: tuple.Data{
+			values.Time(e.Time),
+			values.String(e.Action),
+			values.String(e.Actor),
+			values.String(e.Target),
+			values.String(e.Reason),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) QueryAudit(q hub.AuditQuery) ([]hub.AuditEntry, error) {
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	tbl, err := db.audit.Open(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+
+	it := tbl.Scan(nil)
+	defer it.Close()
+
+	var list []hub.AuditEntry
+	for it.Next(ctx) {
+		e, err := decodeAudit(it.Data())
+		if err != nil {
+			return nil, err
+		}
+		if q.Match(*e) {
+			list = append(list, *e)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	// entries are inserted in order, but the order of the scan is not guaranteed
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.After(list[j].Time)
+	})
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+	}
+	return list, nil
+}
+
+func decodeConn(key tuple.Key, data tuple.Data) (*hub.ConnRecord, error) {
+	if len(key) != 2 || len(data) != 3 {
+		return nil, fmt.Errorf("unexpected connection record: %v, %v", key, data)
+	}
+	join, ok := key[0].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected time, got: %T", key[0])
+	}
+	name, ok := key[1].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", key[1])
+	}
+	leave, ok := data[0].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected time, got: %T", data[0])
+	}
+	ip, ok := data[1].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", data[1])
+	}
+	cid, ok := data[2].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", data[2])
+	}
+	rec := &hub.ConnRecord{
+		Name: string(name),
+		IP:   string(ip),
+		CID:  string(cid),
+		Join: time.Time(join),
+	}
+	if t := time.Time(leave); t.Unix() > 0 {
+		rec.Leave = t
+	}
+	return rec, nil
+}
+
+func (db *tupleDatabase) PutConn(rec hub.ConnRecord) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.history.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.UpdateTuple(ctx, tuple.Tuple{
+		Key: tuple.Key{values.Time(rec.Join), values.String(rec.Name)},
+		Data: tuple.Data{
+			values.Time(rec.Leave),
+			values.String(rec.IP),
+			values.String(rec.CID),
+		},
+	}, &tuple.UpdateOpt{Upsert: true})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) QueryConns(q hub.ConnQuery) ([]hub.ConnRecord, error) {
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	tbl, err := db.history.Open(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+
+	it := tbl.Scan(nil)
+	defer it.Close()
+
+	var list []hub.ConnRecord
+	for it.Next(ctx) {
+		r, err := decodeConn(it.Key(), it.Data())
+		if err != nil {
+			return nil, err
+		}
+		if q.Match(*r) {
+			list = append(list, *r)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Join.After(list[j].Join)
+	})
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+	}
+	return list, nil
+}
+
+func (db *tupleDatabase) ExpireConns(before time.Time) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.history.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	it := tbl.Scan(&tuple.ScanOptions{KeysOnly: true})
+	defer it.Close()
+
+	var keys []tuple.Key
+	for it.Next(ctx) {
+		key := it.Key()
+		if t, ok := key[0].(values.Time); ok && time.Time(t).Before(before) {
+			keys = append(keys, key)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	err = tbl.DeleteTuples(ctx, &tuple.Filter{KeyFilter: tuple.Keys(keys)})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func decodeNote(key tuple.Key, data tuple.Data) (*hub.UserNote, error) {
+	if len(key) != 2 || len(data) != 3 {
+		return nil, fmt.Errorf("unexpected note: %v, %v", key, data)
+	}
+	target, ok := key[0].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", key[0])
+	}
+	t, ok := key[1].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected time, got: %T", key[1])
+	}
+	var str [3]string
+	for i := range str {
+		s, ok := data[i].(values.String)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got: %T", data[i])
+		}
+		str[i] = string(s)
+	}
+	return &hub.UserNote{
+		Target: string(target),
+		Time:   time.Time(t),
+		Author: str[0],
+		Tag:    str[1],
+		Text:   str[2],
+	}, nil
+}
+
+func (db *tupleDatabase) PutNote(n hub.UserNote) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.notes.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.UpdateTuple(ctx, tuple.Tuple{
+		Key: tuple.Key{values.String(n.Target), values.Time(n.Time)},
+		Data: tuple.Data{
+			values.String(n.Author),
+			values.String(n.Tag),
+			values.String(n.Text),
+		},
+	}, &tuple.UpdateOpt{Upsert: true})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) ListNotes(target string) ([]hub.UserNote, error) {
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	tbl, err := db.notes.Open(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+
+	it := tbl.Scan(&tuple.ScanOptions{
+		Filter: &tuple.Filter{
+			KeyFilter: tuple.KeyFilters{filter.EQ(values.String(target))},
+		},
+	})
+	defer it.Close()
+
+	var list []hub.UserNote
+	for it.Next(ctx) {
+		n, err := decodeNote(it.Key(), it.Data())
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *n)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list, nil
+}
+
+func (db *tupleDatabase) DelNote(target string, t time.Time) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.notes.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.DeleteTuples(ctx, &tuple.Filter{KeyFilter: tuple.Keys{
+		{values.String(target), values.Time(t)},
+	}})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func decodeWatch(key tuple.Key, data tuple.Data) (*hub.WatchEntry, error) {
+	if len(key) != 1 || len(data) != 4 {
+		return nil, fmt.Errorf("unexpected watchlist entry: %v, %v", key, data)
+	}
+	pattern, ok := key[0].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", key[0])
+	}
+	action, ok := data[0].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", data[0])
+	}
+	reason, ok := data[1].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", data[1])
+	}
+	added, ok := data[2].(values.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected time, got: %T", data[2])
+	}
+	by, ok := data[3].(values.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got: %T", data[3])
+	}
+	return &hub.WatchEntry{
+		Pattern: string(pattern),
+		Action:  string(action),
+		Reason:  string(reason),
+		Added:   time.Time(added),
+		By:      string(by),
+	}, nil
+}
+
+func (db *tupleDatabase) PutWatch(e hub.WatchEntry) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.watch.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.UpdateTuple(ctx, tuple.Tuple{
+		Key: tuple.SKey(e.Pattern),
+		Data: tuple.Data{
+			values.String(e.Action),
+			values.String(e.Reason),
+			values.Time(e.Added),
+			values.String(e.By),
+		},
+	}, &tuple.UpdateOpt{Upsert: true})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) DelWatch(pattern string) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.watch.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.DeleteTuples(ctx, &tuple.Filter{
+		KeyFilter: tuple.Keys{tuple.SKey(pattern)},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) ListWatch() ([]hub.WatchEntry, error) {
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	tbl, err := db.watch.Open(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+
+	it := tbl.Scan(nil)
+	defer it.Close()
+
+	var list []hub.WatchEntry
+	for it.Next(ctx) {
+		e, err := decodeWatch(it.Key(), it.Data())
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
+	}
+	return list, it.Err()
+}
+
+func (db *tupleDatabase) PutRoom(r hub.RoomInfo) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.rooms.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.UpdateTuple(ctx, tuple.Tuple{
+		Key:  tuple.SKey(r.Name),
+		Data: tuple.SData(string(data)),
+	}, &tuple.UpdateOpt{Upsert: true})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) DelRoom(name string) error {
+	tx, err := db.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	tbl, err := db.rooms.Open(tx)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	err = tbl.DeleteTuples(ctx, &tuple.Filter{
+		KeyFilter: tuple.Keys{tuple.SKey(name)},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *tupleDatabase) ListRooms() ([]hub.RoomInfo, error) {
+	tx, err := db.db.Tx(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	tbl, err := db.rooms.Open(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+
+	it := tbl.Scan(nil)
+	defer it.Close()
+
+	var list []hub.RoomInfo
+	for it.Next(ctx) {
+		s, ok := it.Data()[0].(values.String)
+		if !ok {
+			return nil, fmt.Errorf("expected string room data, got: %T", it.Data()[0])
+		}
+		var r hub.RoomInfo
+		if err := json.Unmarshal([]byte(s), &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, it.Err()
+}
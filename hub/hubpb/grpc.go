@@ -0,0 +1,390 @@
+package hubpb
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/http2"
+)
+
+// Status codes of gRPC used by the hub.
+const (
+	CodeOK               = 0
+	CodeCanceled         = 1
+	CodeInvalidArgument  = 3
+	CodeNotFound         = 5
+	CodePermissionDenied = 7
+	CodeUnimplemented    = 12
+	CodeInternal         = 13
+	CodeUnavailable      = 14
+	CodeUnauthenticated  = 16
+)
+
+const (
+	contentType = "application/grpc"
+	// maxMessage is the maximal size of a single message.
+	maxMessage = 4 << 20
+)
+
+// Status is an error returned by a gRPC method.
+type Status struct {
+	Code    int
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", s.Code, s.Message)
+}
+
+// Errorf creates a gRPC error with a given status code.
+func Errorf(code int, format string, args ...interface{}) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WriteMsg writes a length-prefixed message.
+func WriteMsg(w io.Writer, m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err = w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadMsg reads a length-prefixed message. Compressed messages are not supported.
+func ReadMsg(r io.Reader, m proto.Message) error {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != 0 {
+		return Errorf(CodeUnimplemented, "compression is not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxMessage {
+		return Errorf(CodeInvalidArgument, "message is too large: %d", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// encodeMessage percent-encodes the status message, as required by the gRPC protocol.
+func encodeMessage(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func decodeMessage(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				buf.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// Method is a handler of a single gRPC method. Only one of Unary or Stream must be set.
+type Method struct {
+	// New returns an empty request message.
+	New func() proto.Message
+	// Unary handles the request and returns a single response.
+	Unary func(ctx context.Context, req proto.Message) (proto.Message, error)
+	// Stream handles the request and sends a stream of responses.
+	Stream func(ctx context.Context, req proto.Message, send func(proto.Message) error) error
+}
+
+// Server serves gRPC methods over HTTP/2.
+type Server struct {
+	// Auth checks if the request is allowed. Nil value allows all requests.
+	Auth func(r *http.Request) bool
+	// Methods by their names.
+	Methods map[string]Method
+}
+
+func writeStatus(w http.ResponseWriter, err error) {
+	code, msg := CodeOK, ""
+	if err != nil {
+		code, msg = CodeInternal, err.Error()
+		if st, ok := err.(*Status); ok {
+			code, msg = st.Code, st.Message
+		}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(msg))
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), contentType) {
+		http.Error(w, "gRPC requires HTTP/2 and "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	hdr := w.Header()
+	hdr.Set("Content-Type", contentType)
+	hdr.Set("Trailer", "Grpc-Status, Grpc-Message")
+	m, ok := s.Methods[strings.TrimPrefix(r.URL.Path, PathPrefix)]
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		writeStatus(w, Errorf(CodeUnimplemented, "unknown method: %s", r.URL.Path))
+		return
+	}
+	if s.Auth != nil && !s.Auth(r) {
+		w.WriteHeader(http.StatusOK)
+		writeStatus(w, Errorf(CodeUnauthenticated, "invalid token"))
+		return
+	}
+	req := m.New()
+	err := ReadMsg(r.Body, req)
+	w.WriteHeader(http.StatusOK)
+	if err != nil {
+		if _, ok := err.(*Status); !ok {
+			err = Errorf(CodeInvalidArgument, "cannot read request: %v", err)
+		}
+		writeStatus(w, err)
+		return
+	}
+	ctx := r.Context()
+	if m.Unary != nil {
+		var resp proto.Message
+		resp, err = m.Unary(ctx, req)
+		if err == nil {
+			err = WriteMsg(w, resp)
+		}
+		writeStatus(w, err)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	err = m.Stream(ctx, req, func(resp proto.Message) error {
+		if err := WriteMsg(w, resp); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	writeStatus(w, err)
+}
+
+// Client is a gRPC client for the control plane API of the hub.
+type Client struct {
+	base  string
+	token string
+	cli   *http.Client
+}
+
+// NewClient creates a client for the hub at a given address. If TLS config is nil,
+// the client uses HTTP/2 without TLS (h2c), which is only suitable for local connections.
+func NewClient(addr string, conf *tls.Config, token string) *Client {
+	tr := &http2.Transport{TLSClientConfig: conf}
+	base := "https://" + addr
+	if conf == nil {
+		base = "http://" + addr
+		tr.AllowHTTP = true
+		tr.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+	return &Client{base: base, token: token, cli: &http.Client{Transport: tr}}
+}
+
+// status returns the gRPC status of the response. Trailers are only available after the body is read.
+func status(resp *http.Response) error {
+	s := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if s == "" {
+		// trailers-only response
+		s = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	if s == "" {
+		return Errorf(CodeInternal, "status is not set")
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return Errorf(CodeInternal, "invalid status: %q", s)
+	} else if code == CodeOK {
+		return nil
+	}
+	return &Status{Code: code, Message: decodeMessage(msg)}
+}
+
+func (c *Client) open(ctx context.Context, method string, req proto.Message) (*http.Response, error) {
+	var buf bytes.Buffer
+	if err := WriteMsg(&buf, req); err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequest("POST", c.base+PathPrefix+method, &buf)
+	if err != nil {
+		return nil, err
+	}
+	hreq = hreq.WithContext(ctx)
+	hreq.Header.Set("Content-Type", contentType)
+	hreq.Header.Set("Te", "trailers")
+	if c.token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.cli.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, Errorf(CodeUnavailable, "unexpected HTTP status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// Invoke calls a unary method.
+func (c *Client) Invoke(ctx context.Context, method string, req, resp proto.Message) error {
+	hresp, err := c.open(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+	rerr := ReadMsg(hresp.Body, resp)
+	_, _ = io.Copy(ioutil.Discard, hresp.Body)
+	if err = status(hresp); err != nil {
+		return err
+	}
+	return rerr
+}
+
+// Stream calls a server-streaming method.
+func (c *Client) Stream(ctx context.Context, method string, req proto.Message) (*ClientStream, error) {
+	resp, err := c.open(ctx, method, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientStream{resp: resp}, nil
+}
+
+// ClientStream is a stream of responses of a server-streaming method.
+type ClientStream struct {
+	resp *http.Response
+}
+
+// Recv reads the next message. It returns io.EOF when the stream ends successfully.
+func (s *ClientStream) Recv(m proto.Message) error {
+	err := ReadMsg(s.resp.Body, m)
+	if err == io.EOF {
+		if err = status(s.resp); err == nil {
+			err = io.EOF
+		}
+	}
+	return err
+}
+
+// Close stops the stream.
+func (s *ClientStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+func (c *Client) GetStats(ctx context.Context) (*Stats, error) {
+	var resp Stats
+	if err := c.Invoke(ctx, MethodGetStats, &Empty{}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListPeers(ctx context.Context) (*PeerList, error) {
+	var resp PeerList
+	if err := c.Invoke(ctx, MethodListPeers, &Empty{}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WatchPeers streams PeerChange messages.
+func (c *Client) WatchPeers(ctx context.Context, seq uint64) (*ClientStream, error) {
+	return c.Stream(ctx, MethodWatchPeers, &WatchPeersRequest{Seq: seq})
+}
+
+// TailChat streams ChatMessage messages.
+func (c *Client) TailChat(ctx context.Context, last uint32) (*ClientStream, error) {
+	return c.Stream(ctx, MethodTailChat, &TailChatRequest{Last: last})
+}
+
+func (c *Client) SendChat(ctx context.Context, text string) error {
+	return c.Invoke(ctx, MethodSendChat, &SendChatRequest{Text: text}, &Empty{})
+}
+
+func (c *Client) Kick(ctx context.Context, name, reason string) error {
+	return c.Invoke(ctx, MethodKick, &KickRequest{Name: name, Reason: reason}, &Empty{})
+}
+
+func (c *Client) BanIP(ctx context.Context, ip, reason string) error {
+	return c.Invoke(ctx, MethodBanIP, &BanIPRequest{Ip: ip, Reason: reason}, &Empty{})
+}
+
+func (c *Client) UnbanIP(ctx context.Context, ip, reason string) error {
+	return c.Invoke(ctx, MethodUnbanIP, &BanIPRequest{Ip: ip, Reason: reason}, &Empty{})
+}
+
+func (c *Client) ListBans(ctx context.Context) (*BanList, error) {
+	var resp BanList
+	if err := c.Invoke(ctx, MethodListBans, &Empty{}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetConfig(ctx context.Context) (*ConfigList, error) {
+	var resp ConfigList
+	if err := c.Invoke(ctx, MethodGetConfig, &Empty{}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetConfig changes the config value and returns the new value, as interpreted by the hub.
+func (c *Client) SetConfig(ctx context.Context, key, val string) (*ConfigValue, error) {
+	var resp ConfigValue
+	if err := c.Invoke(ctx, MethodSetConfig, &ConfigValue{Key: key, Value: val}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ReloadConfig(ctx context.Context) error {
+	return c.Invoke(ctx, MethodReloadConfig, &Empty{}, &Empty{})
+}
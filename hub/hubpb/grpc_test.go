@@ -0,0 +1,238 @@
+package hubpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestMsgRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	in := &PeerList{Seq: 3, Peers: []*Peer{{Sid: "AAAB", Name: "user", Share: 10, Bot: true}}}
+	require.NoError(t, WriteMsg(&buf, in))
+	require.NoError(t, WriteMsg(&buf, &Empty{}))
+
+	var out PeerList
+	require.NoError(t, ReadMsg(&buf, &out))
+	require.Equal(t, in.String(), out.String())
+	require.NoError(t, ReadMsg(&buf, &Empty{}))
+
+	// compressed flag
+	buf.Write([]byte{1, 0, 0, 0, 0})
+	err := ReadMsg(&buf, &Empty{})
+	st, ok := err.(*Status)
+	require.True(t, ok)
+	require.Equal(t, CodeUnimplemented, st.Code)
+}
+
+func TestStatusMessage(t *testing.T) {
+	const s = "100% done: привет"
+	enc := encodeMessage(s)
+	require.Equal(t, "100%25 done: %D0%BF%D1%80%D0%B8%D0%B2%D0%B5%D1%82", enc)
+	require.Equal(t, s, decodeMessage(enc))
+}
+
+func TestReadMsgErrors(t *testing.T) {
+	// too large
+	err := ReadMsg(bytes.NewReader([]byte{0, 0xff, 0xff, 0xff, 0xff}), &Empty{})
+	st, ok := err.(*Status)
+	require.True(t, ok)
+	require.Equal(t, CodeInvalidArgument, st.Code)
+
+	// truncated body
+	err = ReadMsg(bytes.NewReader([]byte{0, 0, 0, 0, 10, 1}), &Empty{})
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// truncated header
+	err = ReadMsg(bytes.NewReader([]byte{0, 0}), &Empty{})
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// clean end of stream
+	err = ReadMsg(bytes.NewReader(nil), &Empty{})
+	require.Equal(t, io.EOF, err)
+}
+
+func TestResponseStatus(t *testing.T) {
+	resp := func(hdr, trailer http.Header) *http.Response {
+		return &http.Response{Header: hdr, Trailer: trailer}
+	}
+	// status in trailers
+	err := status(resp(http.Header{}, http.Header{
+		"Grpc-Status":  {"5"},
+		"Grpc-Message": {"not%20found"},
+	}))
+	require.Equal(t, &Status{Code: CodeNotFound, Message: "not found"}, err)
+
+	// trailers-only response
+	err = status(resp(http.Header{"Grpc-Status": {"7"}}, http.Header{}))
+	require.Equal(t, &Status{Code: CodePermissionDenied}, err)
+
+	require.NoError(t, status(resp(http.Header{}, http.Header{"Grpc-Status": {"0"}})))
+
+	err = status(resp(http.Header{}, http.Header{}))
+	require.Equal(t, CodeInternal, err.(*Status).Code)
+	err = status(resp(http.Header{}, http.Header{"Grpc-Status": {"x"}}))
+	require.Equal(t, CodeInternal, err.(*Status).Code)
+}
+
+// newTestServer serves gRPC methods with h2c and returns a client for them.
+func newTestServer(t *testing.T, s *Server) (*Client, func()) {
+	srv := httptest.NewServer(h2c.NewHandler(s, &http2.Server{}))
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	return NewClient(addr, nil, "token"), srv.Close
+}
+
+func TestServerUnary(t *testing.T) {
+	var auth string
+	c, closeSrv := newTestServer(t, &Server{
+		Auth: func(r *http.Request) bool {
+			auth = r.Header.Get("Authorization")
+			return auth == "Bearer token"
+		},
+		Methods: map[string]Method{
+			MethodGetStats: {
+				New: func() proto.Message { return &Empty{} },
+				Unary: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+					return &Stats{Name: "hub", Users: 3}, nil
+				},
+			},
+			MethodKick: {
+				New: func() proto.Message { return &KickRequest{} },
+				Unary: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+					r := req.(*KickRequest)
+					if r.Name != "user" {
+						return nil, Errorf(CodeNotFound, "no user: %s", r.Name)
+					}
+					return nil, errors.New("cannot kick")
+				},
+			},
+		},
+	})
+	defer closeSrv()
+	ctx := context.Background()
+
+	st, err := c.GetStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Bearer token", auth)
+	require.Equal(t, "hub", st.Name)
+	require.Equal(t, uint32(3), st.Users)
+
+	// status code and an encoded message are sent in trailers
+	err = c.Kick(ctx, "пользователь", "")
+	require.Equal(t, &Status{Code: CodeNotFound, Message: "no user: пользователь"}, err)
+
+	// other errors are internal
+	err = c.Kick(ctx, "user", "")
+	require.Equal(t, &Status{Code: CodeInternal, Message: "cannot kick"}, err)
+
+	err = c.SendChat(ctx, "hello")
+	require.Equal(t, CodeUnimplemented, err.(*Status).Code)
+
+	c.token = "wrong"
+	_, err = c.GetStats(ctx)
+	require.Equal(t, &Status{Code: CodeUnauthenticated, Message: "invalid token"}, err)
+}
+
+func TestServerBadRequest(t *testing.T) {
+	c, closeSrv := newTestServer(t, &Server{
+		Methods: map[string]Method{
+			MethodSendChat: {
+				New: func() proto.Message { return &SendChatRequest{} },
+				Unary: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+					return &Empty{}, nil
+				},
+			},
+		},
+	})
+	defer closeSrv()
+
+	// only HTTP/2 requests are accepted
+	resp, err := http.Post(c.base+PathPrefix+MethodSendChat, contentType, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	// truncated request
+	req, err := http.NewRequest("POST", c.base+PathPrefix+MethodSendChat, bytes.NewReader([]byte{0, 0, 0, 0, 10}))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	resp, err = c.cli.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, io.EOF, ReadMsg(resp.Body, &Empty{}))
+	err = status(resp)
+	require.Equal(t, CodeInvalidArgument, err.(*Status).Code)
+}
+
+func TestServerStream(t *testing.T) {
+	stopped := make(chan struct{})
+	c, closeSrv := newTestServer(t, &Server{
+		Methods: map[string]Method{
+			MethodTailChat: {
+				New: func() proto.Message { return &TailChatRequest{} },
+				Stream: func(ctx context.Context, req proto.Message, send func(proto.Message) error) error {
+					n := int(req.(*TailChatRequest).Last)
+					for i := 0; i < n; i++ {
+						if err := send(&ChatMessage{Time: int64(i), Text: "msg"}); err != nil {
+							return err
+						}
+					}
+					switch n {
+					case 0:
+						// wait for the client to go away
+						<-ctx.Done()
+						close(stopped)
+						return ctx.Err()
+					case 1:
+						return Errorf(CodeUnavailable, "too slow")
+					}
+					return nil
+				},
+			},
+		},
+	})
+	defer closeSrv()
+	ctx := context.Background()
+
+	// messages are followed by the OK status
+	s, err := c.TailChat(ctx, 3)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		var m ChatMessage
+		require.NoError(t, s.Recv(&m))
+		require.Equal(t, int64(i), m.Time)
+	}
+	require.Equal(t, io.EOF, s.Recv(&ChatMessage{}))
+	require.NoError(t, s.Close())
+
+	// the error is returned after the messages that were sent
+	s, err = c.TailChat(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, s.Recv(&ChatMessage{}))
+	require.Equal(t, &Status{Code: CodeUnavailable, Message: "too slow"}, s.Recv(&ChatMessage{}))
+	require.NoError(t, s.Close())
+
+	// canceling the client context stops the handler
+	cctx, cancel := context.WithCancel(ctx)
+	s, err = c.TailChat(cctx, 0)
+	require.NoError(t, err)
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream handler is still running")
+	}
+	_ = s.Close()
+}
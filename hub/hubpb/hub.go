@@ -0,0 +1,31 @@
+// Package hubpb implements the control plane API of the hub over gRPC.
+//
+// Messages are generated from hub.proto, but the gRPC transport is implemented directly
+// on top of HTTP/2 to avoid pulling the gRPC runtime.
+// Any gRPC client generated from hub.proto can talk to the hub.
+package hubpb
+
+//go:generate protoc --go_out=. hub.proto
+
+const (
+	// ServiceName is the full name of the gRPC service.
+	ServiceName = "dcpp.hub.v1.Hub"
+	// PathPrefix is the HTTP path prefix of all methods of the service.
+	PathPrefix = "/" + ServiceName + "/"
+)
+
+// Methods of the service.
+const (
+	MethodGetStats     = "GetStats"
+	MethodListPeers    = "ListPeers"
+	MethodWatchPeers   = "WatchPeers"
+	MethodTailChat     = "TailChat"
+	MethodSendChat     = "SendChat"
+	MethodKick         = "Kick"
+	MethodBanIP        = "BanIP"
+	MethodUnbanIP      = "UnbanIP"
+	MethodListBans     = "ListBans"
+	MethodGetConfig    = "GetConfig"
+	MethodSetConfig    = "SetConfig"
+	MethodReloadConfig = "ReloadConfig"
+)
@@ -0,0 +1,853 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: hub.proto
+
+package hubpb
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{0}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+type Stats struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Desc                 string   `protobuf:"bytes,2,opt,name=desc,proto3" json:"desc,omitempty"`
+	Soft                 string   `protobuf:"bytes,3,opt,name=soft,proto3" json:"soft,omitempty"`
+	Users                uint32   `protobuf:"varint,4,opt,name=users,proto3" json:"users,omitempty"`
+	Share                uint64   `protobuf:"varint,5,opt,name=share,proto3" json:"share,omitempty"`
+	UptimeSec            int64    `protobuf:"varint,6,opt,name=uptime_sec,json=uptimeSec,proto3" json:"uptime_sec,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Stats) Reset()         { *m = Stats{} }
+func (m *Stats) String() string { return proto.CompactTextString(m) }
+func (*Stats) ProtoMessage()    {}
+func (*Stats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{1}
+}
+
+func (m *Stats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Stats.Unmarshal(m, b)
+}
+func (m *Stats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Stats.Marshal(b, m, deterministic)
+}
+func (m *Stats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Stats.Merge(m, src)
+}
+func (m *Stats) XXX_Size() int {
+	return xxx_messageInfo_Stats.Size(m)
+}
+func (m *Stats) XXX_DiscardUnknown() {
+	xxx_messageInfo_Stats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Stats proto.InternalMessageInfo
+
+func (m *Stats) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Stats) GetDesc() string {
+	if m != nil {
+		return m.Desc
+	}
+	return ""
+}
+
+func (m *Stats) GetSoft() string {
+	if m != nil {
+		return m.Soft
+	}
+	return ""
+}
+
+func (m *Stats) GetUsers() uint32 {
+	if m != nil {
+		return m.Users
+	}
+	return 0
+}
+
+func (m *Stats) GetShare() uint64 {
+	if m != nil {
+		return m.Share
+	}
+	return 0
+}
+
+func (m *Stats) GetUptimeSec() int64 {
+	if m != nil {
+		return m.UptimeSec
+	}
+	return 0
+}
+
+type Peer struct {
+	Sid                  string   `protobuf:"bytes,1,opt,name=sid,proto3" json:"sid,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Proto                string   `protobuf:"bytes,3,opt,name=proto,proto3" json:"proto,omitempty"`
+	Ip                   string   `protobuf:"bytes,4,opt,name=ip,proto3" json:"ip,omitempty"`
+	Cid                  string   `protobuf:"bytes,5,opt,name=cid,proto3" json:"cid,omitempty"`
+	Share                uint64   `protobuf:"varint,6,opt,name=share,proto3" json:"share,omitempty"`
+	ShareFiles           uint64   `protobuf:"varint,7,opt,name=share_files,json=shareFiles,proto3" json:"share_files,omitempty"`
+	Client               string   `protobuf:"bytes,8,opt,name=client,proto3" json:"client,omitempty"`
+	Bot                  bool     `protobuf:"varint,9,opt,name=bot,proto3" json:"bot,omitempty"`
+	Op                   bool     `protobuf:"varint,10,opt,name=op,proto3" json:"op,omitempty"`
+	Registered           bool     `protobuf:"varint,11,opt,name=registered,proto3" json:"registered,omitempty"`
+	Secure               bool     `protobuf:"varint,12,opt,name=secure,proto3" json:"secure,omitempty"`
+	Away                 bool     `protobuf:"varint,13,opt,name=away,proto3" json:"away,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Peer) Reset()         { *m = Peer{} }
+func (m *Peer) String() string { return proto.CompactTextString(m) }
+func (*Peer) ProtoMessage()    {}
+func (*Peer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{2}
+}
+
+func (m *Peer) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Peer.Unmarshal(m, b)
+}
+func (m *Peer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Peer.Marshal(b, m, deterministic)
+}
+func (m *Peer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Peer.Merge(m, src)
+}
+func (m *Peer) XXX_Size() int {
+	return xxx_messageInfo_Peer.Size(m)
+}
+func (m *Peer) XXX_DiscardUnknown() {
+	xxx_messageInfo_Peer.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Peer proto.InternalMessageInfo
+
+func (m *Peer) GetSid() string {
+	if m != nil {
+		return m.Sid
+	}
+	return ""
+}
+
+func (m *Peer) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Peer) GetProto() string {
+	if m != nil {
+		return m.Proto
+	}
+	return ""
+}
+
+func (m *Peer) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *Peer) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+func (m *Peer) GetShare() uint64 {
+	if m != nil {
+		return m.Share
+	}
+	return 0
+}
+
+func (m *Peer) GetShareFiles() uint64 {
+	if m != nil {
+		return m.ShareFiles
+	}
+	return 0
+}
+
+func (m *Peer) GetClient() string {
+	if m != nil {
+		return m.Client
+	}
+	return ""
+}
+
+func (m *Peer) GetBot() bool {
+	if m != nil {
+		return m.Bot
+	}
+	return false
+}
+
+func (m *Peer) GetOp() bool {
+	if m != nil {
+		return m.Op
+	}
+	return false
+}
+
+func (m *Peer) GetRegistered() bool {
+	if m != nil {
+		return m.Registered
+	}
+	return false
+}
+
+func (m *Peer) GetSecure() bool {
+	if m != nil {
+		return m.Secure
+	}
+	return false
+}
+
+func (m *Peer) GetAway() bool {
+	if m != nil {
+		return m.Away
+	}
+	return false
+}
+
+type PeerList struct {
+	Seq                  uint64   `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Peers                []*Peer  `protobuf:"bytes,2,rep,name=peers,proto3" json:"peers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerList) Reset()         { *m = PeerList{} }
+func (m *PeerList) String() string { return proto.CompactTextString(m) }
+func (*PeerList) ProtoMessage()    {}
+func (*PeerList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{3}
+}
+
+func (m *PeerList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerList.Unmarshal(m, b)
+}
+func (m *PeerList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerList.Marshal(b, m, deterministic)
+}
+func (m *PeerList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerList.Merge(m, src)
+}
+func (m *PeerList) XXX_Size() int {
+	return xxx_messageInfo_PeerList.Size(m)
+}
+func (m *PeerList) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerList proto.InternalMessageInfo
+
+func (m *PeerList) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *PeerList) GetPeers() []*Peer {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type WatchPeersRequest struct {
+	// Seq is the sequence number returned by ListPeers.
+	Seq                  uint64   `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchPeersRequest) Reset()         { *m = WatchPeersRequest{} }
+func (m *WatchPeersRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchPeersRequest) ProtoMessage()    {}
+func (*WatchPeersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{4}
+}
+
+func (m *WatchPeersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchPeersRequest.Unmarshal(m, b)
+}
+func (m *WatchPeersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchPeersRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchPeersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchPeersRequest.Merge(m, src)
+}
+func (m *WatchPeersRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchPeersRequest.Size(m)
+}
+func (m *WatchPeersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchPeersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchPeersRequest proto.InternalMessageInfo
+
+func (m *WatchPeersRequest) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+type PeerChange struct {
+	Seq uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Kind is one of: join, update, leave.
+	Kind string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	// Time in Unix milliseconds.
+	Time                 int64    `protobuf:"varint,3,opt,name=time,proto3" json:"time,omitempty"`
+	Peer                 *Peer    `protobuf:"bytes,4,opt,name=peer,proto3" json:"peer,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerChange) Reset()         { *m = PeerChange{} }
+func (m *PeerChange) String() string { return proto.CompactTextString(m) }
+func (*PeerChange) ProtoMessage()    {}
+func (*PeerChange) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{5}
+}
+
+func (m *PeerChange) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerChange.Unmarshal(m, b)
+}
+func (m *PeerChange) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerChange.Marshal(b, m, deterministic)
+}
+func (m *PeerChange) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerChange.Merge(m, src)
+}
+func (m *PeerChange) XXX_Size() int {
+	return xxx_messageInfo_PeerChange.Size(m)
+}
+func (m *PeerChange) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerChange.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerChange proto.InternalMessageInfo
+
+func (m *PeerChange) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *PeerChange) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *PeerChange) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *PeerChange) GetPeer() *Peer {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+type TailChatRequest struct {
+	// Last is the number of messages from the chat log to send before new ones.
+	Last                 uint32   `protobuf:"varint,1,opt,name=last,proto3" json:"last,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TailChatRequest) Reset()         { *m = TailChatRequest{} }
+func (m *TailChatRequest) String() string { return proto.CompactTextString(m) }
+func (*TailChatRequest) ProtoMessage()    {}
+func (*TailChatRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{6}
+}
+
+func (m *TailChatRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TailChatRequest.Unmarshal(m, b)
+}
+func (m *TailChatRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TailChatRequest.Marshal(b, m, deterministic)
+}
+func (m *TailChatRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TailChatRequest.Merge(m, src)
+}
+func (m *TailChatRequest) XXX_Size() int {
+	return xxx_messageInfo_TailChatRequest.Size(m)
+}
+func (m *TailChatRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TailChatRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TailChatRequest proto.InternalMessageInfo
+
+func (m *TailChatRequest) GetLast() uint32 {
+	if m != nil {
+		return m.Last
+	}
+	return 0
+}
+
+type ChatMessage struct {
+	// Time in Unix milliseconds.
+	Time                 int64    `protobuf:"varint,1,opt,name=time,proto3" json:"time,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Text                 string   `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	Me                   bool     `protobuf:"varint,4,opt,name=me,proto3" json:"me,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ChatMessage) Reset()         { *m = ChatMessage{} }
+func (m *ChatMessage) String() string { return proto.CompactTextString(m) }
+func (*ChatMessage) ProtoMessage()    {}
+func (*ChatMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{7}
+}
+
+func (m *ChatMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChatMessage.Unmarshal(m, b)
+}
+func (m *ChatMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChatMessage.Marshal(b, m, deterministic)
+}
+func (m *ChatMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChatMessage.Merge(m, src)
+}
+func (m *ChatMessage) XXX_Size() int {
+	return xxx_messageInfo_ChatMessage.Size(m)
+}
+func (m *ChatMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChatMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChatMessage proto.InternalMessageInfo
+
+func (m *ChatMessage) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *ChatMessage) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ChatMessage) GetText() string {
+	if m != nil {
+		return m.Text
+	}
+	return ""
+}
+
+func (m *ChatMessage) GetMe() bool {
+	if m != nil {
+		return m.Me
+	}
+	return false
+}
+
+type SendChatRequest struct {
+	Text                 string   `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SendChatRequest) Reset()         { *m = SendChatRequest{} }
+func (m *SendChatRequest) String() string { return proto.CompactTextString(m) }
+func (*SendChatRequest) ProtoMessage()    {}
+func (*SendChatRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{8}
+}
+
+func (m *SendChatRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SendChatRequest.Unmarshal(m, b)
+}
+func (m *SendChatRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SendChatRequest.Marshal(b, m, deterministic)
+}
+func (m *SendChatRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SendChatRequest.Merge(m, src)
+}
+func (m *SendChatRequest) XXX_Size() int {
+	return xxx_messageInfo_SendChatRequest.Size(m)
+}
+func (m *SendChatRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SendChatRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SendChatRequest proto.InternalMessageInfo
+
+func (m *SendChatRequest) GetText() string {
+	if m != nil {
+		return m.Text
+	}
+	return ""
+}
+
+type KickRequest struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Reason               string   `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KickRequest) Reset()         { *m = KickRequest{} }
+func (m *KickRequest) String() string { return proto.CompactTextString(m) }
+func (*KickRequest) ProtoMessage()    {}
+func (*KickRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{9}
+}
+
+func (m *KickRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KickRequest.Unmarshal(m, b)
+}
+func (m *KickRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KickRequest.Marshal(b, m, deterministic)
+}
+func (m *KickRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KickRequest.Merge(m, src)
+}
+func (m *KickRequest) XXX_Size() int {
+	return xxx_messageInfo_KickRequest.Size(m)
+}
+func (m *KickRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_KickRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KickRequest proto.InternalMessageInfo
+
+func (m *KickRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *KickRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type BanIPRequest struct {
+	Ip                   string   `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Reason               string   `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BanIPRequest) Reset()         { *m = BanIPRequest{} }
+func (m *BanIPRequest) String() string { return proto.CompactTextString(m) }
+func (*BanIPRequest) ProtoMessage()    {}
+func (*BanIPRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{10}
+}
+
+func (m *BanIPRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BanIPRequest.Unmarshal(m, b)
+}
+func (m *BanIPRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BanIPRequest.Marshal(b, m, deterministic)
+}
+func (m *BanIPRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BanIPRequest.Merge(m, src)
+}
+func (m *BanIPRequest) XXX_Size() int {
+	return xxx_messageInfo_BanIPRequest.Size(m)
+}
+func (m *BanIPRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BanIPRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BanIPRequest proto.InternalMessageInfo
+
+func (m *BanIPRequest) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *BanIPRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type BanList struct {
+	Ips                  []string `protobuf:"bytes,1,rep,name=ips,proto3" json:"ips,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BanList) Reset()         { *m = BanList{} }
+func (m *BanList) String() string { return proto.CompactTextString(m) }
+func (*BanList) ProtoMessage()    {}
+func (*BanList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{11}
+}
+
+func (m *BanList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BanList.Unmarshal(m, b)
+}
+func (m *BanList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BanList.Marshal(b, m, deterministic)
+}
+func (m *BanList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BanList.Merge(m, src)
+}
+func (m *BanList) XXX_Size() int {
+	return xxx_messageInfo_BanList.Size(m)
+}
+func (m *BanList) XXX_DiscardUnknown() {
+	xxx_messageInfo_BanList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BanList proto.InternalMessageInfo
+
+func (m *BanList) GetIps() []string {
+	if m != nil {
+		return m.Ips
+	}
+	return nil
+}
+
+type ConfigValue struct {
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Value is formatted as text.
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ConfigValue) Reset()         { *m = ConfigValue{} }
+func (m *ConfigValue) String() string { return proto.CompactTextString(m) }
+func (*ConfigValue) ProtoMessage()    {}
+func (*ConfigValue) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{12}
+}
+
+func (m *ConfigValue) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConfigValue.Unmarshal(m, b)
+}
+func (m *ConfigValue) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConfigValue.Marshal(b, m, deterministic)
+}
+func (m *ConfigValue) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConfigValue.Merge(m, src)
+}
+func (m *ConfigValue) XXX_Size() int {
+	return xxx_messageInfo_ConfigValue.Size(m)
+}
+func (m *ConfigValue) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConfigValue.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConfigValue proto.InternalMessageInfo
+
+func (m *ConfigValue) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *ConfigValue) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type ConfigList struct {
+	Values               []*ConfigValue `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ConfigList) Reset()         { *m = ConfigList{} }
+func (m *ConfigList) String() string { return proto.CompactTextString(m) }
+func (*ConfigList) ProtoMessage()    {}
+func (*ConfigList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b3103f8d3056b01c, []int{13}
+}
+
+func (m *ConfigList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConfigList.Unmarshal(m, b)
+}
+func (m *ConfigList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConfigList.Marshal(b, m, deterministic)
+}
+func (m *ConfigList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConfigList.Merge(m, src)
+}
+func (m *ConfigList) XXX_Size() int {
+	return xxx_messageInfo_ConfigList.Size(m)
+}
+func (m *ConfigList) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConfigList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConfigList proto.InternalMessageInfo
+
+func (m *ConfigList) GetValues() []*ConfigValue {
+	if m != nil {
+		return m.Values
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Empty)(nil), "dcpp.hub.v1.Empty")
+	proto.RegisterType((*Stats)(nil), "dcpp.hub.v1.Stats")
+	proto.RegisterType((*Peer)(nil), "dcpp.hub.v1.Peer")
+	proto.RegisterType((*PeerList)(nil), "dcpp.hub.v1.PeerList")
+	proto.RegisterType((*WatchPeersRequest)(nil), "dcpp.hub.v1.WatchPeersRequest")
+	proto.RegisterType((*PeerChange)(nil), "dcpp.hub.v1.PeerChange")
+	proto.RegisterType((*TailChatRequest)(nil), "dcpp.hub.v1.TailChatRequest")
+	proto.RegisterType((*ChatMessage)(nil), "dcpp.hub.v1.ChatMessage")
+	proto.RegisterType((*SendChatRequest)(nil), "dcpp.hub.v1.SendChatRequest")
+	proto.RegisterType((*KickRequest)(nil), "dcpp.hub.v1.KickRequest")
+	proto.RegisterType((*BanIPRequest)(nil), "dcpp.hub.v1.BanIPRequest")
+	proto.RegisterType((*BanList)(nil), "dcpp.hub.v1.BanList")
+	proto.RegisterType((*ConfigValue)(nil), "dcpp.hub.v1.ConfigValue")
+	proto.RegisterType((*ConfigList)(nil), "dcpp.hub.v1.ConfigList")
+}
+
+func init() { proto.RegisterFile("hub.proto", fileDescriptor_b3103f8d3056b01c) }
+
+var fileDescriptor_b3103f8d3056b01c = []byte{
+	// 769 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xdf, 0x6e, 0xf3, 0x74,
+	0x0c, 0x55, 0xd2, 0xa4, 0x4d, 0x9c, 0x0d, 0xf8, 0x7e, 0x1a, 0xdf, 0x17, 0x0a, 0x8c, 0x2a, 0xd2,
+	0x44, 0xaf, 0xaa, 0x51, 0x46, 0x35, 0x24, 0x04, 0x52, 0xc7, 0x18, 0x08, 0x90, 0xa6, 0x94, 0x3f,
+	0x82, 0x9b, 0xe9, 0xd7, 0xc4, 0x6b, 0xa3, 0xb6, 0x49, 0x96, 0x5f, 0x32, 0xe8, 0x4b, 0xf0, 0x0e,
+	0x3c, 0x11, 0xaf, 0x84, 0xec, 0xa4, 0x6d, 0xda, 0x66, 0x5c, 0x70, 0x67, 0x1f, 0xfb, 0xd8, 0x27,
+	0xf1, 0x69, 0x0a, 0xf6, 0xbc, 0x98, 0x0e, 0xd2, 0x2c, 0xc9, 0x13, 0xe1, 0x84, 0x41, 0x9a, 0x0e,
+	0x28, 0x7f, 0xfe, 0xc4, 0xeb, 0x80, 0x79, 0xbb, 0x4a, 0xf3, 0xb5, 0xf7, 0x97, 0x06, 0xe6, 0x24,
+	0x97, 0xb9, 0x12, 0x02, 0x8c, 0x58, 0xae, 0xd0, 0xd5, 0x7a, 0x5a, 0xdf, 0xf6, 0x39, 0x26, 0x2c,
+	0x44, 0x15, 0xb8, 0x7a, 0x89, 0x51, 0x4c, 0x98, 0x4a, 0x1e, 0x73, 0xb7, 0x55, 0x62, 0x14, 0x8b,
+	0x33, 0x30, 0x0b, 0x85, 0x99, 0x72, 0x8d, 0x9e, 0xd6, 0x3f, 0xf5, 0xcb, 0x84, 0x50, 0x35, 0x97,
+	0x19, 0xba, 0x66, 0x4f, 0xeb, 0x1b, 0x7e, 0x99, 0x88, 0x0f, 0x01, 0x8a, 0x34, 0x8f, 0x56, 0xf8,
+	0xa0, 0x30, 0x70, 0xdb, 0x3d, 0xad, 0xdf, 0xf2, 0xed, 0x12, 0x99, 0x60, 0xe0, 0xfd, 0xad, 0x83,
+	0x71, 0x8f, 0x98, 0x89, 0x77, 0xa0, 0xa5, 0xa2, 0xb0, 0x92, 0x43, 0xe1, 0x56, 0xa1, 0x5e, 0x53,
+	0x78, 0x06, 0x26, 0x3f, 0x5e, 0x25, 0xa7, 0x4c, 0xc4, 0x5b, 0xa0, 0x47, 0x29, 0x8b, 0xb1, 0x7d,
+	0x3d, 0x4a, 0x69, 0x56, 0x10, 0x85, 0xac, 0xc3, 0xf6, 0x29, 0xdc, 0x69, 0x6b, 0xd7, 0xb5, 0x7d,
+	0x04, 0x0e, 0x07, 0x0f, 0x8f, 0xd1, 0x12, 0x95, 0xdb, 0xe1, 0x1a, 0x30, 0xf4, 0x0d, 0x21, 0xe2,
+	0x35, 0xb4, 0x83, 0x65, 0x84, 0x71, 0xee, 0x5a, 0x3c, 0xab, 0xca, 0x68, 0xc1, 0x34, 0xc9, 0x5d,
+	0xbb, 0xa7, 0xf5, 0x2d, 0x9f, 0x42, 0x92, 0x90, 0xa4, 0x2e, 0x30, 0xa0, 0x27, 0xa9, 0x38, 0x07,
+	0xc8, 0x70, 0x16, 0xa9, 0x1c, 0x33, 0x0c, 0x5d, 0x87, 0xf1, 0x1a, 0x42, 0x93, 0x15, 0x06, 0x45,
+	0x86, 0xee, 0x09, 0xd7, 0xaa, 0x8c, 0x1e, 0x5a, 0xfe, 0x21, 0xd7, 0xee, 0x29, 0xa3, 0x1c, 0x7b,
+	0xb7, 0x60, 0xd1, 0x2b, 0xfa, 0x21, 0x52, 0xbc, 0x59, 0xe1, 0x13, 0xbf, 0x26, 0xc3, 0xa7, 0x50,
+	0x7c, 0x0c, 0x66, 0x8a, 0x74, 0x0c, 0xbd, 0xd7, 0xea, 0x3b, 0xc3, 0x57, 0x83, 0xda, 0xe1, 0x07,
+	0xc4, 0xf3, 0xcb, 0xba, 0x77, 0x01, 0xaf, 0x7e, 0x95, 0x79, 0x30, 0x27, 0x4c, 0xf9, 0xf8, 0x54,
+	0x60, 0xd3, 0x3c, 0x6f, 0x05, 0x40, 0x1d, 0x37, 0x73, 0x19, 0xcf, 0xb0, 0x61, 0x9f, 0x00, 0x63,
+	0x11, 0xc5, 0xe1, 0xe6, 0x2c, 0x14, 0x13, 0x46, 0x07, 0xe5, 0xab, 0xb4, 0x7c, 0x8e, 0xc5, 0x05,
+	0x18, 0xb4, 0x97, 0xcf, 0xd2, 0x28, 0x8b, 0xcb, 0xde, 0x05, 0xbc, 0xfd, 0x93, 0x8c, 0x96, 0x37,
+	0x73, 0x99, 0x6f, 0x34, 0x09, 0x30, 0x96, 0x52, 0xe5, 0xbc, 0xf4, 0xd4, 0xe7, 0xd8, 0xfb, 0x0d,
+	0x1c, 0x6a, 0xf9, 0x11, 0x95, 0x92, 0x33, 0xdc, 0x2e, 0xd4, 0x6a, 0x0b, 0x9b, 0xfc, 0x42, 0x7d,
+	0xf8, 0xe7, 0xd6, 0xbd, 0x14, 0xd3, 0xa9, 0x56, 0xc8, 0xb2, 0x2c, 0x5f, 0x5f, 0x21, 0x29, 0x98,
+	0x60, 0x1c, 0x1e, 0x28, 0x60, 0x9a, 0xb6, 0xa3, 0x79, 0x9f, 0x83, 0xf3, 0x7d, 0x14, 0x2c, 0x6a,
+	0x2d, 0x47, 0xbf, 0x9f, 0xd7, 0xd0, 0xce, 0x50, 0xaa, 0x24, 0xae, 0x34, 0x54, 0x99, 0x37, 0x82,
+	0x93, 0xb1, 0x8c, 0xbf, 0xbb, 0xdf, 0x70, 0x4b, 0xbf, 0x6a, 0x5b, 0xbf, 0xbe, 0xc4, 0x7b, 0x1f,
+	0x3a, 0x63, 0x19, 0x6f, 0xee, 0x1e, 0xa5, 0xca, 0xd5, 0x7a, 0x2d, 0xb2, 0x74, 0x94, 0x2a, 0xef,
+	0x33, 0x70, 0x6e, 0x92, 0xf8, 0x31, 0x9a, 0xfd, 0x22, 0x97, 0x05, 0x1f, 0x6a, 0x81, 0xeb, 0xcd,
+	0xef, 0x67, 0x81, 0x6b, 0xf2, 0xfc, 0x33, 0x95, 0xaa, 0xa1, 0x65, 0xe2, 0x7d, 0x09, 0x50, 0xd2,
+	0x78, 0xec, 0x25, 0xb4, 0x19, 0x2e, 0x27, 0x3b, 0x43, 0x77, 0xef, 0x4c, 0xb5, 0xf9, 0x7e, 0xd5,
+	0x37, 0xfc, 0xc7, 0x84, 0xd6, 0xb7, 0xc5, 0x54, 0x0c, 0xc1, 0xba, 0xc3, 0xbc, 0xfa, 0x96, 0xec,
+	0xb1, 0xf8, 0x4b, 0xd3, 0xdd, 0xc7, 0xca, 0xbe, 0x11, 0xd8, 0xb4, 0x95, 0x0d, 0xd8, 0x48, 0x7a,
+	0xf7, 0xc8, 0x25, 0xac, 0xf2, 0x0e, 0x60, 0xe7, 0x5c, 0x71, 0xbe, 0xd7, 0x74, 0x64, 0xe9, 0xee,
+	0x9b, 0xa3, 0x21, 0xa5, 0x97, 0x2f, 0x35, 0xf1, 0x35, 0x58, 0x1b, 0xb3, 0x89, 0x0f, 0xf6, 0xda,
+	0x0e, 0x3c, 0xd8, 0x3d, 0x78, 0x11, 0x3b, 0xeb, 0x5d, 0x6a, 0xe2, 0x0b, 0xb0, 0x36, 0x86, 0x39,
+	0x98, 0x72, 0xe0, 0xa3, 0x6e, 0xc3, 0x33, 0x8a, 0x2b, 0x30, 0xc8, 0x47, 0x62, 0x7f, 0x43, 0xcd,
+	0x5a, 0x8d, 0xac, 0x11, 0x98, 0x6c, 0x21, 0xf1, 0xde, 0x5e, 0xb1, 0x6e, 0xab, 0x46, 0xde, 0x35,
+	0x74, 0x7e, 0x8e, 0xa7, 0xff, 0x87, 0x79, 0x05, 0x16, 0xbd, 0xfc, 0xb1, 0x8c, 0x9b, 0x6f, 0x75,
+	0x76, 0x38, 0x8e, 0x4f, 0x75, 0x0d, 0xf6, 0x1d, 0xe6, 0xa5, 0x71, 0x1a, 0x69, 0x6f, 0x1a, 0x1c,
+	0xc6, 0xcc, 0xaf, 0xc0, 0x9e, 0x6c, 0x99, 0x2f, 0xfa, 0xb0, 0xfb, 0x62, 0x45, 0x8c, 0xe0, 0xc4,
+	0xc7, 0x65, 0x22, 0xc3, 0xff, 0xd8, 0xde, 0x80, 0x8d, 0x3b, 0xbf, 0x9b, 0xf3, 0x62, 0x9a, 0x4e,
+	0xa7, 0x6d, 0xfe, 0x37, 0xf9, 0xf4, 0xdf, 0x01, 0x00, 0xd1, 0x50, 0x77, 0xd4, 0x46, 0x07, 0x00,
+	0x00,
+}
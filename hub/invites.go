@@ -0,0 +1,287 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInviteTTL is the default time an invitation to a room stays valid.
+const DefaultInviteTTL = 24 * time.Hour
+
+var (
+	errRoomBanned    = errors.New("you are banned from this room")
+	errRoomNoInvite  = errors.New("you have no invitation to this room")
+	errRoomNotInRoom = errors.New("user is not in the room")
+)
+
+// RoomBan prevents a user from joining a single room.
+type RoomBan struct {
+	Name   string    `json:"name"`
+	Until  time.Time `json:"until,omitempty"` // zero means forever
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func (b RoomBan) expired(now time.Time) bool {
+	return !b.Until.IsZero() && !now.Before(b.Until)
+}
+
+// roomACL holds pending invitations and bans of a room. It is not persisted.
+type roomACL struct {
+	sync.Mutex
+	invites map[nameKey]time.Time // expiration time
+	bans    map[nameKey]RoomBan
+}
+
+// invite allows the user to join the room until a given time.
+func (r *Room) invite(key nameKey, until time.Time) {
+	r.acl.Lock()
+	defer r.acl.Unlock()
+	if r.acl.invites == nil {
+		r.acl.invites = make(map[nameKey]time.Time)
+	}
+	r.acl.invites[key] = until
+}
+
+// isInvited checks if the user has a valid invitation to the room.
+func (r *Room) isInvited(key nameKey, now time.Time) bool {
+	r.acl.Lock()
+	defer r.acl.Unlock()
+	until, ok := r.acl.invites[key]
+	if ok && !now.Before(until) {
+		delete(r.acl.invites, key)
+		return false
+	}
+	return ok
+}
+
+// useInvite removes the invitation once the user joined the room.
+func (r *Room) useInvite(key nameKey) {
+	r.acl.Lock()
+	delete(r.acl.invites, key)
+	r.acl.Unlock()
+}
+
+// ban prevents the user from joining the room.
+func (r *Room) ban(key nameKey, b RoomBan) {
+	r.acl.Lock()
+	defer r.acl.Unlock()
+	if r.acl.bans == nil {
+		r.acl.bans = make(map[nameKey]RoomBan)
+	}
+	r.acl.bans[key] = b
+	delete(r.acl.invites, key)
+}
+
+// unban removes the ban of the user. It returns false if the user is not banned.
+func (r *Room) unban(key nameKey) bool {
+	r.acl.Lock()
+	defer r.acl.Unlock()
+	b, ok := r.acl.bans[key]
+	delete(r.acl.bans, key)
+	return ok && !b.expired(time.Now())
+}
+
+// isBanned checks if the user is banned from the room.
+func (r *Room) isBanned(key nameKey, now time.Time) bool {
+	r.acl.Lock()
+	defer r.acl.Unlock()
+	b, ok := r.acl.bans[key]
+	if ok && b.expired(now) {
+		delete(r.acl.bans, key)
+		return false
+	}
+	return ok
+}
+
+// Bans returns active bans of the room.
+func (r *Room) Bans() []RoomBan {
+	now := time.Now()
+	r.acl.Lock()
+	defer r.acl.Unlock()
+	list := make([]RoomBan, 0, len(r.acl.bans))
+	for k, b := range r.acl.bans {
+		if b.expired(now) {
+			delete(r.acl.bans, k)
+			continue
+		}
+		list = append(list, b)
+	}
+	return list
+}
+
+// canInvite checks if the peer is allowed to invite users to the room.
+// Restricted rooms require moderators, in other rooms it's enough to be in the room.
+func (r *Room) canInvite(p Peer) bool {
+	if r.role(p) >= roomModerator {
+		return true
+	}
+	info := r.Info()
+	if info != nil && (info.InviteOnly || info.Password != "" || len(info.Profiles) != 0) {
+		return false
+	}
+	return r.InRoom(p)
+}
+
+// PeerInvite is implemented by peers that support room invitations natively.
+type PeerInvite interface {
+	Peer
+	// RoomInvite notifies the peer that it was invited to the room.
+	RoomInvite(from Peer, room *Room) error
+}
+
+// InviteToRoom invites the user to the room and notifies the user about it. Zero TTL means DefaultInviteTTL.
+func (h *Hub) InviteToRoom(from Peer, r *Room, to Peer, ttl time.Duration) error {
+	if !r.canInvite(from) {
+		return errRoomNotMod
+	}
+	if r.InRoom(to) {
+		return errors.New("user is already in the room: " + to.Name())
+	}
+	if ttl <= 0 {
+		ttl = DefaultInviteTTL
+	}
+	key := h.toNameKey(to.Name())
+	if r.isBanned(key, time.Now()) {
+		return errors.New("user is banned from the room: " + to.Name())
+	}
+	r.invite(key, time.Now().Add(ttl))
+	if pi, ok := to.(PeerInvite); ok {
+		return pi.RoomInvite(from, r)
+	}
+	return h.hubUser.SendPrivate(to, Message{
+		Text: h.text(to, TextRoomInvite, textArgs{
+			"From":    from.Name(),
+			"Room":    r.Name(),
+			"Command": "accept " + r.Name(),
+			"Expires": ttl,
+		}),
+	})
+}
+
+// KickFromRoom removes the user from the room, but not from the hub.
+func (h *Hub) KickFromRoom(by Peer, r *Room, p Peer, reason string) error {
+	if r.role(by) < roomModerator {
+		return errRoomNotMod
+	} else if !r.InRoom(p) {
+		return errRoomNotInRoom
+	}
+	r.Leave(p)
+	_ = p.HubChatMsg(Message{Text: h.text(p, TextRoomKicked, textArgs{
+		"Room":   r.Name(),
+		"By":     by.Name(),
+		"Reason": reason,
+	})})
+	return nil
+}
+
+// BanFromRoom removes the user from the room and prevents the user from joining it again.
+// Zero duration means a permanent ban, which lasts until the hub restarts.
+func (h *Hub) BanFromRoom(by Peer, r *Room, name string, dur time.Duration, reason string) error {
+	if r.role(by) < roomModerator {
+		return errRoomNotMod
+	}
+	b := RoomBan{Name: name, By: by.Name(), Reason: reason}
+	if dur > 0 {
+		b.Until = time.Now().UTC().Add(dur)
+	}
+	r.ban(h.toNameKey(name), b)
+	if p := h.PeerByName(name); p != nil && r.InRoom(p) {
+		return h.KickFromRoom(by, r, p, reason)
+	}
+	return nil
+}
+
+func (h *Hub) cmdInvite(p Peer, args string) error {
+	name, rest := cutReason(strings.TrimSpace(args))
+	nick, rest := cutReason(rest)
+	if !strings.HasPrefix(name, "#") || nick == "" {
+		return errors.New("usage: invite <#room> <nick> [duration]")
+	}
+	r := h.Room(name)
+	if r == nil {
+		return errors.New("no such room: " + name)
+	}
+	to := h.PeerByName(nick)
+	if to == nil {
+		return errors.New("no such user: " + nick)
+	}
+	var ttl time.Duration
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			return err
+		}
+		ttl = d
+	}
+	if err := h.InviteToRoom(p, r, to, ttl); err != nil {
+		return err
+	}
+	h.cmdOutput(p, fmt.Sprintf("invited %s to %s", to.Name(), r.Name()))
+	return nil
+}
+
+func (h *Hub) cmdAccept(p Peer, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		// shares the name with the default command to accept the rules
+		return h.cmdAcceptRules(p, "")
+	}
+	r := h.Room(name)
+	if r == nil {
+		return errors.New("no such room: " + name)
+	}
+	if !r.isInvited(h.toNameKey(p.Name()), time.Now()) {
+		return errRoomNoInvite
+	}
+	_, err := h.JoinRoom(p, name, "")
+	return err
+}
+
+func (h *Hub) cmdRoomKick(p Peer, r *Room, args string) error {
+	nick, reason := cutReason(args)
+	to := h.PeerByName(nick)
+	if to == nil {
+		return errors.New("no such user: " + nick)
+	}
+	if err := h.KickFromRoom(p, r, to, reason); err != nil {
+		return err
+	}
+	h.audit(AuditRoom, p, r.Name(), strings.TrimSpace("kick "+to.Name()+" "+reason))
+	h.cmdOutput(p, fmt.Sprintf("kicked %s from %s", to.Name(), r.Name()))
+	return nil
+}
+
+func (h *Hub) cmdRoomBan(p Peer, r *Room, args string) error {
+	nick, rest := cutReason(args)
+	if nick == "" {
+		return errors.New("user name must be set")
+	}
+	var dur time.Duration
+	if s, reason := cutReason(rest); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			dur, rest = d, reason
+		}
+	}
+	if err := h.BanFromRoom(p, r, nick, dur, rest); err != nil {
+		return err
+	}
+	h.audit(AuditRoom, p, r.Name(), strings.TrimSpace("ban "+nick+" "+rest))
+	h.cmdOutput(p, fmt.Sprintf("banned %s from %s", nick, r.Name()))
+	return nil
+}
+
+func (h *Hub) cmdRoomUnban(p Peer, r *Room, nick string) error {
+	if r.role(p) < roomModerator {
+		return errRoomNotMod
+	}
+	if !r.unban(h.toNameKey(nick)) {
+		return errors.New("user is not banned: " + nick)
+	}
+	h.audit(AuditRoom, p, r.Name(), "unban "+nick)
+	h.cmdOutput(p, fmt.Sprintf("unbanned %s from %s", nick, r.Name()))
+	return nil
+}
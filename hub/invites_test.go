@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomInvites(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	owner := newTestADCPeer(t, h, "owner")
+	owner.setUser(&User{profile: h.Profile(ProfileNameRegistered)})
+	guest := newTestADCPeer(t, h, "guest")
+	other := newTestADCPeer(t, h, "other")
+
+	require.True(t, h.isCommand(owner, "!room create #club"))
+	require.True(t, h.isCommand(owner, "!room inviteonly #club on"))
+	r := h.Room("#club")
+
+	// regular users cannot invite to restricted rooms
+	_, err = h.JoinRoom(other, "#club", "")
+	require.Equal(t, errRoomInviteOnly, err)
+	require.Equal(t, errRoomNotMod, h.InviteToRoom(other, r, guest, 0))
+
+	sentADC(guest)
+	require.True(t, h.isCommand(owner, "!invite #club guest"))
+	require.Contains(t, lastChat(t, guest), `!accept\s#club`)
+
+	require.True(t, h.isCommand(guest, "!accept #club"))
+	require.True(t, r.InRoom(guest))
+
+	// invitations are used once
+	r.Leave(guest)
+	_, err = h.JoinRoom(guest, "#club", "")
+	require.Equal(t, errRoomInviteOnly, err)
+
+	// invitations expire
+	require.NoError(t, h.InviteToRoom(owner, r, guest, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	_, err = h.JoinRoom(guest, "#club", "")
+	require.Equal(t, errRoomInviteOnly, err)
+
+	// moderators can kick and ban within the room
+	require.NoError(t, h.InviteToRoom(owner, r, guest, 0))
+	_, err = h.JoinRoom(guest, "#club", "")
+	require.NoError(t, err)
+
+	require.True(t, h.isCommand(owner, "!room kick #club guest flood"))
+	require.False(t, r.InRoom(guest))
+	require.True(t, h.globalChat.InRoom(guest))
+
+	require.True(t, h.isCommand(owner, "!room ban #club guest 1h spam"))
+	require.Len(t, r.Bans(), 1)
+	require.True(t, h.isCommand(owner, "!room inviteonly #club off"))
+	_, err = h.JoinRoom(guest, "#club", "")
+	require.Equal(t, errRoomBanned, err)
+	require.Error(t, h.InviteToRoom(owner, r, guest, 0))
+
+	require.True(t, h.isCommand(owner, "!room unban #club guest"))
+	_, err = h.JoinRoom(guest, "#club", "")
+	require.NoError(t, err)
+}
@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"sync"
@@ -129,8 +130,8 @@ func (h *Hub) HardBlockIP(ip net.IP) {
 
 func (h *Hub) HardUnBlockIP(ip net.IP) {
 	key := MinIPKey(ip)
-	h.bans.blockKey(key)
-	h.saveBan(Ban{Key: key, Hard: true})
+	h.bans.unblockKey(key)
+	h.deleteBan(key)
 }
 
 func (h *Hub) hardBlockKey(k BanKey) {
@@ -144,8 +145,16 @@ func (h *Hub) saveBan(b Ban) {
 	_ = h.db.PutBans([]Ban{b})
 }
 
+func (h *Hub) deleteBan(k BanKey) {
+	if h.db == nil {
+		return
+	}
+	_ = h.db.DelBans([]BanKey{k})
+}
+
 func (h *Hub) reportAutoBlock(a net.Addr, reason error) {
 	log.Println("blocked:", addrString(a), "reason:", reason)
+	h.notify(NotifyAlert, "", fmt.Sprintf("blocked %s: %v", addrString(a), reason))
 }
 
 func (h *Hub) probableAttack(a net.Addr, reason error) {
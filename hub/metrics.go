@@ -57,6 +57,14 @@ var (
 		Name: "dc_conn_error",
 		Help: "The total number of connections failed with an error",
 	})
+	cntConnBytesR = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_conn_read_bytes",
+		Help: "The total number of bytes received by the hub",
+	})
+	cntConnBytesW = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_conn_write_bytes",
+		Help: "The total number of bytes sent by the hub",
+	})
 	cntConnOpen = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "dc_conn_open",
 		Help: "The number of open connections",
@@ -125,6 +133,10 @@ var (
 		Name: "dc_conn_tls_adc",
 		Help: "The total number of secure ADC connections",
 	})
+	cntConnADCUpgrade = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_conn_tls_adc_upgrade",
+		Help: "The total number of ADC connections switched to TLS after the handshake has started",
+	})
 	cntConnIRCS = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "dc_conn_tls_irc",
 		Help: "The total number of secure IRC connections",
@@ -151,6 +163,46 @@ var (
 		Help: "The total number of accepted HTTP connections that support ALPN",
 	})
 
+	cntMultiLoginReplaced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_multi_login_replaced",
+		Help: "The total number of sessions dropped because the same user logged in again",
+	})
+
+	cntInfoUpdatesCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_info_updates_coalesced",
+		Help: "The total number of user info updates merged with a pending update",
+	})
+
+	cntUserListBatches = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_user_list_batches",
+		Help: "The total number of user list batches flushed during login",
+	})
+
+	cntUserInfoRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_user_info_requests",
+		Help: "The total number of requests for the full user info from clients with the lazy user list",
+	})
+
+	cntUserListZlib = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_user_list_zlib",
+		Help: "The total number of user lists sent as a compressed burst",
+	})
+
+	cntUserListDelta = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_user_list_delta",
+		Help: "The total number of user lists sent as a delta to reconnecting clients",
+	})
+
+	cntSIDsInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dc_sids_in_use",
+		Help: "The number of allocated session IDs",
+	})
+
+	cntSIDExhausted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_sids_exhausted",
+		Help: "The total number of failed session ID allocations",
+	})
+
 	cntPings = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "dc_pings",
 		Help: "The total number of pings",
@@ -198,6 +250,20 @@ var (
 		Name: "dc_search_dur",
 		Help: "The time to send the search request",
 	})
+	cntSearchResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dc_search_results",
+		Help: "The total number of search results sent through the hub",
+	}, []string{"status"})
+	cntSearchResultsRelayed = cntSearchResults.WithLabelValues("relayed")
+	cntSearchResultsBridged = cntSearchResults.WithLabelValues("bridged")
+	cntSearchResultsDropped = cntSearchResults.WithLabelValues("dropped")
+
+	cntSearchScheduled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dc_search_scheduled",
+		Help: "The total number of search requests queued for delivery to peers",
+	}, []string{"status"})
+	cntSearchQueued  = cntSearchScheduled.WithLabelValues("queued")
+	cntSearchDropped = cntSearchScheduled.WithLabelValues("dropped")
 
 	sizeNMDCLinesR = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name: "dc_nmdc_lines_read",
@@ -265,10 +331,37 @@ var (
 		Name: "dc_peers",
 		Help: "The number of active peers",
 	})
+	cntPeersPeak = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dc_peers_peak",
+		Help: "The peak number of active peers",
+	})
 	cntShare = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "dc_share",
 		Help: "Total share size",
 	})
+
+	cntConnThrottled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_conn_throttled_seconds",
+		Help: "The total time connections were delayed by throttling",
+	})
+	cntHubOutThrottled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_hub_out_throttled_seconds",
+		Help: "The total time writes were delayed by the outbound bandwidth limit of the hub",
+	})
+
+	cntReaperPings = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_reaper_pings",
+		Help: "The total number of keepalives sent to idle peers",
+	})
+	cntReaperClosed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dc_reaper_closed",
+		Help: "The total number of idle peers disconnected by the hub",
+	})
+
+	gaugeHealthy = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dc_hub_healthy",
+		Help: "Set to 1 if the hub watchdog reports no stalled components",
+	})
 )
 
 var (
@@ -0,0 +1,129 @@
+package hub
+
+import (
+	"errors"
+	"net"
+	"sort"
+)
+
+// MultiLoginPolicy controls what happens when the same user logs in to the hub multiple times.
+type MultiLoginPolicy int
+
+const (
+	// MultiLoginAllow allows multiple logins from the same IP.
+	// Logins with a name or CID that is already online are still rejected.
+	MultiLoginAllow = MultiLoginPolicy(iota)
+	// MultiLoginReject rejects a new login if the same user is already online.
+	MultiLoginReject
+	// MultiLoginReplace disconnects the older session of the same user (ghost kill).
+	MultiLoginReplace
+)
+
+var errMultiLogin = errors.New("already logged in from this address")
+
+func peerIP(p Peer) net.IP {
+	if addr, ok := p.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// checkMultiLogin checks if a new login conflicts with users that are already online and
+// applies the multi-login policy of the hub.
+//
+// The user is considered the same if it has the same CID (ADC only) or the same name and IP.
+// In addition, all users from the same IP are counted against the per-IP limit.
+//
+// It must only be called after the user is authenticated, since it may drop other sessions.
+func (h *Hub) checkMultiLogin(name string, addr net.Addr, cid *CID) error {
+	policy := h.conf.MultiLogin
+	limit := h.conf.MaxLoginsPerIP
+	var ip net.IP
+	if a, ok := addr.(*net.TCPAddr); ok {
+		ip = a.IP
+	}
+	key := h.toNameKey(name)
+
+	var ghosts, fromIP []Peer
+	for _, p := range h.PeersByIP(ip) {
+		if p.UserInfo().Kind != UserNormal {
+			continue
+		}
+		fromIP = append(fromIP, p)
+		if h.toNameKey(p.Name()) == key {
+			ghosts = append(ghosts, p)
+		}
+	}
+	if cid != nil {
+		if p := h.PeerByCID(*cid); p != nil && !(ip.Equal(peerIP(p)) && h.toNameKey(p.Name()) == key) {
+			ghosts = append(ghosts, p)
+		}
+	}
+	switch policy {
+	case MultiLoginAllow:
+		if limit > 0 && len(fromIP) >= limit {
+			return errMultiLogin
+		}
+		return nil
+	case MultiLoginReject:
+		if len(ghosts) != 0 || (limit > 0 && len(fromIP) >= limit) {
+			return errMultiLogin
+		}
+		return nil
+	}
+	// replace older sessions
+	dropped := make(map[Peer]struct{}, len(ghosts))
+	for _, p := range ghosts {
+		cntMultiLoginReplaced.Add(1)
+		_ = p.Close()
+		dropped[p] = struct{}{}
+	}
+	if limit <= 0 || len(fromIP)-len(dropped) < limit {
+		return nil
+	}
+	sort.Slice(fromIP, func(i, j int) bool {
+		return fromIP[i].base().created.Before(fromIP[j].base().created)
+	})
+	n := len(fromIP) - len(dropped)
+	for _, p := range fromIP {
+		if n < limit {
+			break
+		}
+		if _, ok := dropped[p]; ok {
+			continue
+		}
+		cntMultiLoginReplaced.Add(1)
+		_ = p.Close()
+		n--
+	}
+	return nil
+}
+
+// cmdGhost drops a session of a registered user. The password of the account must be provided,
+// since users behind the same NAT share the address.
+func (h *Hub) cmdGhost(p Peer, name, pass string) error {
+	if c := p.ConnInfo(); c != nil && !c.Secure {
+		return errConnInsecure
+	}
+	if name == "" || pass == "" {
+		return errors.New("user name and password should be set")
+	}
+	p2 := h.PeerByName(name)
+	if p2 == nil || p2.UserInfo().Kind != UserNormal {
+		return errors.New("no such user")
+	} else if p2 == p {
+		return errors.New("cannot drop the current session")
+	}
+	u, err := h.authUser(p2.Name(), pass)
+	if err == ErrAuthWrongPassword {
+		return errors.New("wrong password")
+	} else if err != nil {
+		return err
+	} else if u == nil {
+		return errors.New("only sessions of registered users can be dropped")
+	}
+	cntMultiLoginReplaced.Add(1)
+	_ = p2.Close()
+	h.cmdOutput(p, "ghost session dropped")
+	return nil
+}
@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testLocalAddr  = &net.TCPAddr{IP: localhostIP, Port: 2000}
+	testRemoteAddr = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2000}
+)
+
+func TestMultiLogin(t *testing.T) {
+	newHub := func(t *testing.T, policy MultiLoginPolicy, limit int) *Hub {
+		h, err := NewHub(Config{MultiLogin: policy, MaxLoginsPerIP: limit})
+		require.NoError(t, err)
+		return h
+	}
+	t.Run("allow", func(t *testing.T) {
+		h := newHub(t, MultiLoginAllow, 0)
+		newTestADCPeer(t, h, "bob")
+		newTestADCPeer(t, h, "alice")
+		require.NoError(t, h.checkMultiLogin("bob2", testLocalAddr, nil))
+	})
+	t.Run("allow limit", func(t *testing.T) {
+		h := newHub(t, MultiLoginAllow, 2)
+		newTestADCPeer(t, h, "bob")
+		require.NoError(t, h.checkMultiLogin("bob2", testLocalAddr, nil))
+		newTestADCPeer(t, h, "alice")
+		require.Equal(t, errMultiLogin, h.checkMultiLogin("bob2", testLocalAddr, nil))
+		require.NoError(t, h.checkMultiLogin("bob2", testRemoteAddr, nil))
+	})
+	t.Run("reject unlimited", func(t *testing.T) {
+		h := newHub(t, MultiLoginReject, 0)
+		p := newTestADCPeer(t, h, "bob")
+		setTestCID(h, p, CID{1})
+		// users behind the same NAT are not affected
+		require.NoError(t, h.checkMultiLogin("alice", testLocalAddr, nil))
+		require.Equal(t, errMultiLogin, h.checkMultiLogin("bob", testLocalAddr, nil))
+		require.Equal(t, errMultiLogin, h.checkMultiLogin("alice", testRemoteAddr, &CID{1}))
+	})
+	t.Run("reject", func(t *testing.T) {
+		h := newHub(t, MultiLoginReject, 1)
+		require.NoError(t, h.checkMultiLogin("bob", testLocalAddr, nil))
+		p := newTestADCPeer(t, h, "bob")
+		setTestCID(h, p, CID{1})
+		require.Equal(t, errMultiLogin, h.checkMultiLogin("alice", testLocalAddr, nil))
+		require.Equal(t, errMultiLogin, h.checkMultiLogin("alice", testRemoteAddr, &CID{1}))
+		require.NoError(t, h.checkMultiLogin("alice", testRemoteAddr, &CID{2}))
+	})
+	t.Run("replace", func(t *testing.T) {
+		h := newHub(t, MultiLoginReplace, 3)
+		newTestADCPeer(t, h, "bob")
+		newTestADCPeer(t, h, "alice")
+		p := newTestADCPeer(t, h, "eve")
+		setTestCID(h, p, CID{1})
+
+		// same name
+		require.NoError(t, h.checkMultiLogin("BOB", testLocalAddr, nil))
+		require.Nil(t, h.PeerByName("bob"))
+		require.NotNil(t, h.PeerByName("alice"))
+
+		// same CID
+		require.NoError(t, h.checkMultiLogin("eve2", testRemoteAddr, &CID{1}))
+		require.Nil(t, h.PeerByName("eve"))
+		require.NotNil(t, h.PeerByName("alice"))
+
+		// limit reached, the oldest session is dropped
+		newTestADCPeer(t, h, "mallory")
+		newTestADCPeer(t, h, "oscar")
+		require.NoError(t, h.checkMultiLogin("trent", testLocalAddr, nil))
+		require.Nil(t, h.PeerByName("alice"))
+		require.NotNil(t, h.PeerByName("mallory"))
+	})
+	t.Run("replace unlimited", func(t *testing.T) {
+		h := newHub(t, MultiLoginReplace, 0)
+		newTestADCPeer(t, h, "bob")
+		newTestADCPeer(t, h, "alice")
+		require.NoError(t, h.checkMultiLogin("eve", testLocalAddr, nil))
+		require.NotNil(t, h.PeerByName("bob"))
+		require.NotNil(t, h.PeerByName("alice"))
+	})
+}
+
+func TestCmdGhost(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("bob", "secret"))
+	p1 := newTestADCPeer(t, h, "bob")
+	require.Equal(t, errConnInsecure, h.cmdGhost(newTestADCPeer(t, h, "eve"), "bob", "secret"))
+	p2 := newSecureTestPeer(t, h, "bob2")
+	newTestADCPeer(t, h, "alice")
+
+	require.Error(t, h.cmdGhost(p2, "bob2", "secret"))
+	require.Error(t, h.cmdGhost(p2, "unknown", "secret"))
+	require.Error(t, h.cmdGhost(p2, h.HubUser().Name(), "secret"))
+	// users from the same address cannot drop each other without the password
+	require.Error(t, h.cmdGhost(p2, "alice", "secret"))
+	require.Error(t, h.cmdGhost(p2, "bob", ""))
+	require.Error(t, h.cmdGhost(p2, "bob", "wrong"))
+	require.True(t, p1.Online())
+
+	require.NoError(t, h.cmdGhost(p2, "bob", "secret"))
+	require.Nil(t, h.PeerByName("bob"))
+	require.False(t, p1.Online())
+}
+
+func TestMultiLoginReplaceAuth(t *testing.T) {
+	h, err := NewHub(Config{MultiLogin: MultiLoginReplace})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("bob", "secret"))
+
+	login := loginDCPP
+	login.secure = true
+	c := loginNMDC(t, h, 1, "bob", login)
+	c.expect("GetPass")
+	c.send("$MyPass secret|")
+	c.join(login)
+	p := h.PeerByName("bob")
+	require.NotNil(t, p)
+
+	// the session is not replaced until the password is verified
+	c2 := loginNMDC(t, h, 2, "bob", login)
+	c2.expect("GetPass")
+	require.True(t, p.Online())
+	c2.send("$MyPass wrong|")
+	c2.expect("BadPass")
+	require.True(t, p.Online())
+	require.Equal(t, p, h.PeerByName("bob"))
+
+	c3 := loginNMDC(t, h, 3, "bob", login)
+	c3.expect("GetPass")
+	c3.send("$MyPass secret|")
+	c3.join(login)
+	require.False(t, p.Online())
+	require.NotEqual(t, p, h.PeerByName("bob"))
+}
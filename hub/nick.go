@@ -0,0 +1,216 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NickPolicy controls which user names are accepted by the hub.
+// The policy is shared by all protocols.
+type NickPolicy struct {
+	// MinLength and MaxLength limit the length of the name in characters.
+	// Zero values mean the default limits.
+	MinLength int
+	MaxLength int
+	// Confusables enables comparison of names by their visual skeleton. For example,
+	// "Аdmin" with a Cyrillic "А" cannot join if "Admin" is already online.
+	Confusables bool
+	// Allow is a list of allowed character classes: either Unicode scripts ("Latin", "Cyrillic")
+	// or general categories ("N" for numbers, "P" for punctuation, "S" for symbols, etc).
+	// Empty list allows all printable characters.
+	Allow []string
+	// Reserved is a list of name patterns that can only be used by registered users.
+	// Patterns are case-insensitive and support '*' and '?' wildcards, for example "[OP]*".
+	Reserved []string
+}
+
+type nickPolicy struct {
+	min, max    int
+	confusables bool
+	allow       []*unicode.RangeTable
+	reserved    []string // name keys
+}
+
+func (h *Hub) setNickPolicy(p NickPolicy) error {
+	np := nickPolicy{
+		min: userNameMin, max: userNameMax,
+		confusables: p.Confusables,
+	}
+	if p.MinLength > 0 {
+		np.min = p.MinLength
+	}
+	if p.MaxLength > 0 {
+		np.max = p.MaxLength
+	}
+	if np.min > np.max {
+		return fmt.Errorf("invalid nick length limits: %d > %d", np.min, np.max)
+	}
+	for _, name := range p.Allow {
+		if t := unicode.Scripts[name]; t != nil {
+			np.allow = append(np.allow, t)
+		} else if t = unicode.Categories[name]; t != nil {
+			np.allow = append(np.allow, t)
+		} else {
+			return fmt.Errorf("unknown character class: %q", name)
+		}
+	}
+	h.nicks = np
+	for _, pat := range p.Reserved {
+		if pat = strings.TrimSpace(pat); pat == "" {
+			return errors.New("empty reserved nick pattern")
+		}
+		h.nicks.reserved = append(h.nicks.reserved, string(h.toNameKey(pat)))
+	}
+	return nil
+}
+
+// isReservedName checks if the name matches one of the reserved patterns.
+func (h *Hub) isReservedName(name string) bool {
+	if len(h.nicks.reserved) == 0 {
+		return false
+	}
+	key := string(h.toNameKey(name))
+	for _, pat := range h.nicks.reserved {
+		if matchNickPattern(pat, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePeerName checks if the name can be used by a connecting user.
+// Unlike validateUserName, it also checks reserved names.
+func (h *Hub) validatePeerName(name string) error {
+	if err := h.validateUserName(name); err != nil {
+		return err
+	}
+	if !h.isReservedName(name) {
+		return nil
+	}
+	u, _, err := h.getUser(name)
+	if err != nil {
+		return err
+	} else if u == nil {
+		return errNameReserved
+	}
+	return nil
+}
+
+// matchNickPattern matches the name against a pattern with '*' (any number of characters)
+// and '?' (a single character) wildcards. All other characters are matched literally.
+func matchNickPattern(pat, name string) bool {
+	p, s := []rune(pat), []rune(name)
+	// position of the last '*' in the pattern and the matching position in the name
+	star, next := -1, 0
+	i, j := 0, 0
+	for j < len(s) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == s[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, next = i, j
+			i++
+		case star >= 0:
+			// backtrack: let the last '*' consume one more character
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// checkChars checks that all characters of the name belong to one of the allowed classes.
+func (p *nickPolicy) checkChars(name string) error {
+	if len(p.allow) == 0 {
+		return nil
+	}
+	for _, r := range name {
+		if !unicode.In(r, p.allow...) {
+			return fmt.Errorf("name contains a character that is not allowed: %q", r)
+		}
+	}
+	return nil
+}
+
+// toNameKey returns a key used to compare user names.
+//
+// Names are compared case-insensitively, after NFC normalization. If confusables protection
+// is enabled, names with the same visual skeleton are considered equal as well.
+func (h *Hub) toNameKey(name string) nameKey {
+	if h.nicks.confusables {
+		return nameKey(nickSkeleton(name))
+	}
+	return nameKey(strings.ToLower(norm.NFC.String(name)))
+}
+
+// nickSkeleton returns a simplified form of the name where characters that look the same
+// are replaced with a single representative. It is a simplified version of the skeleton
+// algorithm from Unicode TR39, covering the most common Cyrillic and Greek homoglyphs.
+func nickSkeleton(name string) string {
+	name = norm.NFKC.String(name)
+	name = strings.Map(func(r rune) rune {
+		if c, ok := confusablesUpper[r]; ok {
+			return c
+		}
+		return r
+	}, name)
+	name = strings.ToLower(name)
+	return strings.Map(func(r rune) rune {
+		if c, ok := confusablesLower[r]; ok {
+			return c
+		}
+		return r
+	}, name)
+}
+
+// confusablesUpper maps upper case letters to a Latin letters they look like.
+// It is applied before converting the name to lower case.
+var confusablesUpper = map[rune]rune{
+	// Latin upper case I looks like a lower case l
+	'I': 'l',
+	// Cyrillic
+	'А': 'A', 'В': 'B', 'Е': 'E', 'Ѕ': 'S', 'І': 'l', 'Ј': 'J', 'К': 'K', 'М': 'M',
+	'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X', 'Ү': 'Y',
+	'Һ': 'H', 'Ӏ': 'l', 'Ԛ': 'Q', 'Ԝ': 'W',
+	// Greek
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'l', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// confusablesLower maps lower case letters to a Latin letters they look like.
+//
+// Since names are compared case-insensitively and an upper case I looks like a lower case l,
+// the whole i/I/l/L group is folded into l.
+var confusablesLower = map[rune]rune{
+	'i': 'l',
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'ѕ': 's', 'і': 'l', 'ј': 'j', 'о': 'o', 'р': 'p', 'с': 'c',
+	'у': 'y', 'х': 'x', 'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y',
+	// Greek
+	'ο': 'o', 'ρ': 'p', 'ν': 'v',
+}
+
+func (p *nickPolicy) checkLength(name string) error {
+	// a character takes at most utf8.UTFMax bytes, thus longer names are rejected without decoding them
+	if len(name) > p.max*utf8.UTFMax {
+		return errNameTooLong
+	}
+	n := utf8.RuneCountInString(name)
+	if n > p.max {
+		return errNameTooLong
+	} else if n < p.min {
+		return errNameTooShort
+	}
+	return nil
+}
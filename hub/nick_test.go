@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNickSkeleton(t *testing.T) {
+	var cases = []struct {
+		a, b string
+		same bool
+	}{
+		{"Admin", "admin", true},
+		{"Admin", "Аdmin", true}, // Cyrillic А
+		{"admin", "аdmin", true}, // Cyrillic а
+		{"Hello", "Ηellο", true}, // Greek Η and ο
+		{"Ivan", "lvan", true},   // upper case I and lower case l
+		{"lvan", "Ivan", true},
+		{"Ivan", "Іvan", true},  // Cyrillic І
+		{"ivan", "Ӏvan", true},  // Cyrillic palochka
+		{"root", "r00t", false}, // digits are not homoglyphs
+		{"noob", "n00b", false},
+		{"lol", "1o1", false},
+		{"Ａdmin", "Admin", true}, // full width
+		{"Admin", "Admins", false},
+		{"Пётр", "Петр", false},
+	}
+	for _, c := range cases {
+		if c.same {
+			require.Equal(t, nickSkeleton(c.a), nickSkeleton(c.b), "%q vs %q", c.a, c.b)
+		} else {
+			require.NotEqual(t, nickSkeleton(c.a), nickSkeleton(c.b), "%q vs %q", c.a, c.b)
+		}
+	}
+}
+
+func TestNickPolicy(t *testing.T) {
+	h, err := NewHub(Config{Nicks: NickPolicy{
+		MinLength: 2, MaxLength: 5,
+		Allow: []string{"Latin", "Nd"},
+	}})
+	require.NoError(t, err)
+
+	require.NoError(t, h.validateUserName("ab"))
+	require.NoError(t, h.validateUserName("bob42"))
+	require.Equal(t, errNameTooShort, h.validateUserName("a"))
+	require.Equal(t, errNameTooLong, h.validateUserName("abcdef"))
+	require.NoError(t, h.validateUserName("ëlëna"), "length is in characters")
+	require.Error(t, h.validateUserName("b_b"))
+
+	// the byte limit follows the configured length in characters
+	h, err = NewHub(Config{Nicks: NickPolicy{MaxLength: 300}})
+	require.NoError(t, err)
+	require.NoError(t, h.validateUserName(strings.Repeat("ж", 300)))
+	require.Equal(t, errNameTooLong, h.validateUserName(strings.Repeat("ж", 301)))
+	h, err = NewHub(Config{})
+	require.NoError(t, err)
+	require.NoError(t, h.validateUserName(strings.Repeat("ж", userNameMax)))
+	require.Equal(t, errNameTooLong, h.validateUserName(strings.Repeat("a", 5*userNameMax)))
+
+	_, err = NewHub(Config{Nicks: NickPolicy{Allow: []string{"Klingon"}}})
+	require.Error(t, err)
+	_, err = NewHub(Config{Nicks: NickPolicy{MinLength: 10, MaxLength: 5}})
+	require.Error(t, err)
+}
+
+func TestNickNormalization(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	// "é" as a single code point and as "e" with a combining accent
+	unbind, ok := h.reserveName("José", nil, nil)
+	require.True(t, ok)
+	require.False(t, h.nameAvailable("JOSÉ", nil))
+	require.True(t, h.nameAvailable("Jоsé", nil), "confusables are allowed by default")
+	unbind()
+
+	h, err = NewHub(Config{Nicks: NickPolicy{Confusables: true}})
+	require.NoError(t, err)
+	unbind, ok = h.reserveName("Admin", nil, nil)
+	require.True(t, ok)
+	defer unbind()
+	require.False(t, h.nameAvailable("Аdmin", nil))
+	require.True(t, h.nameAvailable("Admins", nil))
+}
+
+func TestMatchNickPattern(t *testing.T) {
+	var cases = []struct {
+		pat, name string
+		exp       bool
+	}{
+		{"[op]*", "[op]admin", true},
+		{"[op]*", "[op]", true},
+		{"[op]*", "op_admin", false},
+		{"*bot", "hubbot", true},
+		{"*bot", "bots", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*a*b*", "xaxxbx", true},
+		{"*a*b*", "xbxxax", false},
+		{"admin", "admin", true},
+		{"admin", "admin2", false},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.exp, matchNickPattern(c.pat, c.name), "%q vs %q", c.pat, c.name)
+	}
+}
+
+func TestNickReserved(t *testing.T) {
+	h, err := NewHub(Config{Nicks: NickPolicy{
+		Reserved: []string{"[OP]*", "Admin"},
+	}})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.RegisterUser("[OP]bob", "pass"))
+
+	require.Equal(t, errNameReserved, h.validatePeerName("[OP]alice"))
+	require.Equal(t, errNameReserved, h.validatePeerName("ADMIN"))
+	require.NoError(t, h.validatePeerName("[OP]bob"), "registered users can use reserved names")
+	require.NoError(t, h.validatePeerName("OPalice"))
+	require.NoError(t, h.validateUserName("[OP]alice"), "bots are not restricted")
+
+	_, err = NewHub(Config{Nicks: NickPolicy{Reserved: []string{" "}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package hub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+)
+
+func init() {
+	nmdcp.RegisterMessage(&nmdcGetINFO{})
+	nmdcp.RegisterMessage(&nmdcNickList{})
+}
+
+// NMDCCompatConfig configures compatibility with legacy NMDC clients.
+type NMDCCompatConfig struct {
+	// Legacy allows clients that don't support NoHello and NoGetINFO extensions.
+	// The hub sends them $Hello for each user that joins and answers their $GetINFO requests.
+	Legacy bool
+	// Require lists extensions that clients must announce in $Supports, for example "TTHSearch".
+	Require []string
+}
+
+// required returns all the extensions clients must support.
+func (c NMDCCompatConfig) required() []string {
+	var exts []string
+	if !c.Legacy {
+		exts = append(exts, nmdcp.ExtNoHello, nmdcp.ExtNoGetINFO)
+	}
+	return append(exts, c.Require...)
+}
+
+// nmdcCompatExt are the extensions that change the behavior of the hub for legacy clients.
+var nmdcCompatExt = []string{
+	nmdcp.ExtNoHello,
+	nmdcp.ExtNoGetINFO,
+	nmdcp.ExtUserIP2,
+	nmdcp.ExtTTHSearch,
+}
+
+// NMDCClientCompat describes the support of NMDC extensions by users of one client application.
+type NMDCClientCompat struct {
+	// Client is the name and the version of the client.
+	Client string `json:"client"`
+	// Users is the number of online users with this client.
+	Users int `json:"users"`
+	// Extensions maps extension names to the number of users that support them.
+	Extensions map[string]int `json:"ext"`
+}
+
+// nmdcCheckSupports returns an error if the client lacks one of the required extensions.
+func (h *Hub) nmdcCheckSupports(fea nmdcp.Extensions) error {
+	for _, ext := range h.conf.NMDCCompat.required() {
+		if !fea.Has(ext) {
+			return fmt.Errorf("%s is not supported", ext)
+		}
+	}
+	return nil
+}
+
+// NMDCCompat returns a compatibility matrix of NMDC clients that are currently online,
+// ordered by the number of users.
+func (h *Hub) NMDCCompat() []NMDCClientCompat {
+	byClient := make(map[string]*NMDCClientCompat)
+	for _, p := range h.Peers() {
+		np, ok := p.(*nmdcPeer)
+		if !ok {
+			continue
+		}
+		cli := np.Info().Client
+		name := cli.Name
+		if cli.Version != "" {
+			name += " " + cli.Version
+		}
+		c := byClient[name]
+		if c == nil {
+			c = &NMDCClientCompat{Client: name, Extensions: make(map[string]int)}
+			byClient[name] = c
+		}
+		c.Users++
+		for _, ext := range nmdcCompatExt {
+			if np.fea.Has(ext) {
+				c.Extensions[ext]++
+			}
+		}
+	}
+	out := make([]NMDCClientCompat, 0, len(byClient))
+	for _, c := range byClient {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Users != out[j].Users {
+			return out[i].Users > out[j].Users
+		}
+		return out[i].Client < out[j].Client
+	})
+	return out
+}
+
+// nmdcHelloCmds returns $Hello commands for users that joined the hub.
+// They are only sent to clients without NoHello extension.
+func nmdcHelloCmds(peers []Peer) []nmdcp.Message {
+	cmds := make([]nmdcp.Message, 0, len(peers))
+	for _, p2 := range peers {
+		cmds = append(cmds, &nmdcp.Hello{Name: nmdcp.Name(p2.Name())})
+	}
+	return cmds
+}
+
+// nmdcNickList is a list of online users. It is sent to clients without NoHello extension.
+type nmdcNickList struct {
+	nmdcp.Names
+}
+
+func (*nmdcNickList) Type() string {
+	return "NickList"
+}
+
+// nmdcGetINFO is sent by clients without NoGetINFO extension to request the info of a given user.
+type nmdcGetINFO struct {
+	Target string
+	From   string
+}
+
+func (*nmdcGetINFO) Type() string {
+	return "GetINFO"
+}
+
+func (m *nmdcGetINFO) MarshalNMDC(enc *nmdcp.TextEncoder, buf *bytes.Buffer) error {
+	if err := nmdcp.Name(m.Target).MarshalNMDC(enc, buf); err != nil {
+		return err
+	}
+	buf.WriteByte(' ')
+	return nmdcp.Name(m.From).MarshalNMDC(enc, buf)
+}
+
+func (m *nmdcGetINFO) UnmarshalNMDC(dec *nmdcp.TextDecoder, data []byte) error {
+	i := bytes.IndexByte(data, ' ')
+	if i < 0 {
+		return errors.New("invalid GetINFO command")
+	}
+	var target, from nmdcp.Name
+	if err := target.UnmarshalNMDC(dec, data[:i]); err != nil {
+		return err
+	}
+	if err := from.UnmarshalNMDC(dec, data[i+1:]); err != nil {
+		return err
+	}
+	m.Target, m.From = string(target), string(from)
+	return nil
+}
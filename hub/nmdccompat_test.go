@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/nmdc"
+)
+
+// nmdcLogin is a login sequence of an NMDC client. The key is computed from the lock sent by the hub.
+type nmdcLogin struct {
+	// supports is the $Supports command; legacy clients don't send it
+	supports string
+	// tag is the client tag in $MyINFO
+	tag string
+	// secure marks the connection as encrypted
+	secure bool
+}
+
+var (
+	loginDCPP = nmdcLogin{
+		supports: "$Supports UserCommand NoGetINFO NoHello UserIP2 TTHSearch ZPipe0 |",
+		tag:      "<++ V:0.868,M:A,H:1/0/0,S:3>",
+	}
+	loginNeoModus = nmdcLogin{
+		tag: "<DC V:2.02,M:A,H:1/0/0,S:3>",
+	}
+	loginDCGUI = nmdcLogin{
+		supports: "$Supports BZList |",
+		tag:      "<DCGUI V:0.3.3,M:A,H:1/0/0,S:3>",
+	}
+)
+
+type testNMDCClient struct {
+	t    *testing.T
+	h    *Hub
+	name string
+	c    *nmdc.Conn
+	recv chan nmdcp.Message
+}
+
+// loginNMDC replays the login sequence of the client on a new connection to the hub.
+func loginNMDC(t *testing.T, h *Hub, i int, name string, l nmdcLogin) *testNMDCClient {
+	hc, cc := newPipe(i)
+	var cinfo *ConnInfo
+	if l.secure {
+		cinfo = &ConnInfo{Local: hc.LocalAddr(), Remote: hc.RemoteAddr(), Secure: true}
+	}
+	go func() {
+		defer hc.Close()
+		_ = h.ServeNMDC(hc, cinfo)
+	}()
+	c, err := nmdc.NewConn(cc)
+	require.NoError(t, err)
+	tc := &testNMDCClient{t: t, h: h, name: name, c: c, recv: make(chan nmdcp.Message, 100)}
+	go func() {
+		defer close(tc.recv)
+		for {
+			m, err := c.ReadMsg(time.Time{})
+			if err != nil {
+				return
+			}
+			tc.recv <- m
+		}
+	}()
+	lock, ok := tc.expect("Lock").(*nmdcp.Lock)
+	require.True(t, ok)
+	if l.supports != "" {
+		require.NoError(t, c.WriteOneLine([]byte(l.supports)))
+	}
+	require.NoError(t, c.WriteOneMsg(lock.Key()))
+	// the hub may already close the connection if the client lacks required extensions
+	_ = c.WriteOneLine([]byte("$ValidateNick " + name + "|"))
+	return tc
+}
+
+// join completes the login after the hub accepted the name and waits until the user is added to the hub.
+func (c *testNMDCClient) join(l nmdcLogin) {
+	c.t.Helper()
+	c.expect("Hello")
+	c.send("$Version 1,0091|$GetNickList|$MyINFO $ALL " + c.name + " " + l.tag + "$ $100\x01$$1$|")
+	deadline := time.Now().Add(harnessTimeout)
+	for c.h.PeerByName(c.name) == nil {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("%s: timeout waiting for the user to join", c.name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *testNMDCClient) send(lines string) {
+	require.NoError(c.t, c.c.WriteOneLine([]byte(lines)))
+}
+
+// expect waits for a message of a given type and returns it.
+func (c *testNMDCClient) expect(typ string) nmdcp.Message {
+	c.t.Helper()
+	m, _ := c.expectAfter(typ)
+	return m
+}
+
+// expectAfter is like expect, but also returns messages received before the expected one.
+func (c *testNMDCClient) expectAfter(typ string) (nmdcp.Message, []nmdcp.Message) {
+	c.t.Helper()
+	timeout := time.NewTimer(harnessTimeout)
+	defer timeout.Stop()
+	var skipped []nmdcp.Message
+	for {
+		select {
+		case m, ok := <-c.recv:
+			if !ok {
+				c.t.Fatalf("%s: connection closed while waiting for %s", c.name, typ)
+			}
+			if m.Type() == typ {
+				return m, skipped
+			}
+			skipped = append(skipped, m)
+		case <-timeout.C:
+			c.t.Fatalf("%s: timeout waiting for %s", c.name, typ)
+		}
+	}
+}
+
+// expectClosed waits until the hub closes the connection and returns the last chat message.
+func (c *testNMDCClient) expectClosed() string {
+	c.t.Helper()
+	var last string
+	for m := range c.recv {
+		if chat, ok := m.(*nmdcp.ChatMessage); ok {
+			last = string(chat.Text)
+		}
+	}
+	return last
+}
+
+func myINFOName(m nmdcp.Message) string {
+	if u, ok := m.(*nmdcp.MyINFO); ok {
+		return u.Name
+	}
+	return ""
+}
+
+func TestNMDCCompat(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	c := loginNMDC(t, h, 1, "legacy", loginNeoModus)
+	require.Contains(t, c.expectClosed(), "NoHello is not supported")
+
+	h, err = NewHub(Config{NMDCCompat: NMDCCompatConfig{Legacy: true}})
+	require.NoError(t, err)
+
+	modern := loginNMDC(t, h, 2, "modern", loginDCPP)
+	modern.expect("Supports")
+	modern.join(loginDCPP)
+	modern.expect("OpList")
+
+	legacy := loginNMDC(t, h, 3, "legacy", loginNeoModus)
+	legacy.join(loginNeoModus)
+	list, ok := legacy.expect("NickList").(*nmdcNickList)
+	require.True(t, ok)
+	require.Contains(t, list.Names, "modern")
+	require.Contains(t, list.Names, "legacy")
+	legacy.expect("OpList")
+
+	// legacy clients are notified about new users with $Hello
+	other := loginNMDC(t, h, 4, "other", loginDCPP)
+	other.join(loginDCPP)
+	hello, ok := legacy.expect("Hello").(*nmdcp.Hello)
+	require.True(t, ok)
+	require.Equal(t, "other", string(hello.Name))
+	require.Equal(t, "other", myINFOName(legacy.expect("MyINFO")))
+
+	// and can request the user info
+	legacy.send("$GetINFO modern legacy|")
+	require.Equal(t, "modern", myINFOName(legacy.expect("MyINFO")))
+
+	// TTH searches are not sent to clients without TTHSearch
+	modern.send("$Search Hub:modern F?T?0?9?TTH:LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ|<modern> done|")
+	other.expect("Search")
+	_, skipped := legacy.expectAfter("")
+	for _, m := range skipped {
+		require.NotEqual(t, "Search", m.Type())
+	}
+
+	matrix := h.NMDCCompat()
+	require.Len(t, matrix, 2)
+	require.Equal(t, 2, matrix[0].Users)
+	require.True(t, strings.HasSuffix(matrix[0].Client, "0.868"), matrix[0].Client)
+	require.Equal(t, map[string]int{
+		nmdcp.ExtNoHello: 2, nmdcp.ExtNoGetINFO: 2, nmdcp.ExtUserIP2: 2, nmdcp.ExtTTHSearch: 2,
+	}, matrix[0].Extensions)
+	require.Equal(t, 1, matrix[1].Users)
+	require.Empty(t, matrix[1].Extensions)
+
+	h, err = NewHub(Config{NMDCCompat: NMDCCompatConfig{Legacy: true, Require: []string{nmdcp.ExtTTHSearch}}})
+	require.NoError(t, err)
+	c = loginNMDC(t, h, 5, "gui", loginDCGUI)
+	require.Contains(t, c.expectClosed(), "TTHSearch is not supported")
+}
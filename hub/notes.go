@@ -0,0 +1,257 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PermNotes allows reading and writing notes about users.
+const PermNotes = "user.notes"
+
+// AuditNote is recorded in the audit log when a note is added or removed.
+const AuditNote = "note"
+
+// UserNote is a note or a tag attached to a registered user or a CID by an operator.
+type UserNote struct {
+	// Target is the name of a registered user or a CID.
+	Target string `json:"target"`
+	// Time when the note was added. Together with the target it identifies the note.
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+	// Tag is a short label, like "spammer". Tags have no text.
+	Tag  string `json:"tag,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+func (n UserNote) String() string {
+	s := n.Time.Format(time.RFC1123)
+	if n.Author != "" {
+		s += " by " + n.Author
+	}
+	if n.Tag != "" {
+		return s + ": #" + n.Tag
+	}
+	return s + ": " + n.Text
+}
+
+type NoteDatabase interface {
+	// PutNote adds a note or replaces the note with the same target and time.
+	PutNote(n UserNote) error
+	// ListNotes returns notes about the target, starting from the oldest one.
+	ListNotes(target string) ([]UserNote, error)
+	// DelNote removes the note with a given target and time.
+	DelNote(target string, t time.Time) error
+}
+
+var errNotesDisabled = errors.New("notes require a database")
+
+// noteTarget checks that the name is a CID or a registered user and returns the note target for it.
+func (h *Hub) noteTarget(name string) (string, error) {
+	var cid CID
+	if err := cid.FromBase32(name); err == nil {
+		return cid.String(), nil
+	}
+	ok, err := h.IsRegistered(name)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("not a registered user or a CID: %q", name)
+	}
+	return name, nil
+}
+
+// AddNote attaches a note or a tag to a registered user or a CID. Time is set if it's zero.
+func (h *Hub) AddNote(n UserNote) error {
+	if h.db == nil {
+		return errNotesDisabled
+	}
+	n.Tag = strings.TrimPrefix(strings.TrimSpace(n.Tag), "#")
+	n.Text = strings.TrimSpace(n.Text)
+	if (n.Tag == "") == (n.Text == "") {
+		return errors.New("either a text or a tag must be set")
+	} else if strings.ContainsAny(n.Tag, " \n") {
+		return errors.New("tag cannot contain spaces")
+	}
+	target, err := h.noteTarget(n.Target)
+	if err != nil {
+		return err
+	}
+	n.Target = target
+	if n.Tag != "" {
+		list, err := h.db.ListNotes(target)
+		if err != nil {
+			return err
+		}
+		for _, n2 := range list {
+			if strings.EqualFold(n2.Tag, n.Tag) {
+				return nil
+			}
+		}
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now().UTC()
+	}
+	return h.db.PutNote(n)
+}
+
+// Notes returns notes about a registered user or a CID, starting from the oldest one.
+func (h *Hub) Notes(target string) ([]UserNote, error) {
+	if h.db == nil {
+		return nil, nil
+	}
+	return h.db.ListNotes(target)
+}
+
+// DelNote removes a note about the target added at a given time.
+func (h *Hub) DelNote(target string, t time.Time) error {
+	if h.db == nil {
+		return errNotesDisabled
+	}
+	return h.db.DelNote(target, t)
+}
+
+// peerNotes returns notes about the peer, both by name and by CID.
+func (h *Hub) peerNotes(peer Peer) ([]UserNote, error) {
+	var list []UserNote
+	if peer.User().IsRegistered() {
+		notes, err := h.Notes(peer.Name())
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, notes...)
+	}
+	if cid := peer.CID(); !cid.IsZero() {
+		notes, err := h.Notes(cid.String())
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, notes...)
+	}
+	return list, nil
+}
+
+// writeNotes formats notes for the command output. Tags are written on a single line.
+func writeNotes(buf *strings.Builder, list []UserNote) {
+	var tags []string
+	for _, n := range list {
+		if n.Tag != "" {
+			tags = append(tags, "#"+n.Tag)
+		}
+	}
+	if len(tags) != 0 {
+		fmt.Fprintf(buf, "\ntags: %s", strings.Join(tags, " "))
+	}
+	for _, n := range list {
+		if n.Tag == "" {
+			fmt.Fprintf(buf, "\nnote: %s", n)
+		}
+	}
+}
+
+func (h *Hub) cmdNote(p Peer, args string) error {
+	sub, args := cutReason(strings.TrimSpace(args))
+	name, rest := cutReason(args)
+	if name == "" {
+		return errors.New("usage: note add|tag|del|list <nick or CID> [text, tag or number]")
+	}
+	switch sub {
+	case "add", "tag":
+		if rest == "" {
+			return errors.New("text or tag is not set")
+		}
+		n := UserNote{Target: name, Author: p.Name()}
+		if sub == "tag" {
+			n.Tag = rest
+		} else {
+			n.Text = rest
+		}
+		if err := h.AddNote(n); err != nil {
+			return err
+		}
+		h.audit(AuditNote, p, name, sub+" "+rest)
+		h.cmdOutput(p, "note added")
+		return nil
+	case "del", "rm":
+		target, err := h.noteTarget(name)
+		if err != nil {
+			return err
+		}
+		i, err := strconv.Atoi(rest)
+		if err != nil {
+			return errors.New("expected a note number")
+		}
+		list, err := h.Notes(target)
+		if err != nil {
+			return err
+		} else if i <= 0 || i > len(list) {
+			return fmt.Errorf("no such note: %d", i)
+		}
+		n := list[i-1]
+		if err := h.DelNote(target, n.Time); err != nil {
+			return err
+		}
+		h.audit(AuditNote, p, target, "del "+n.Tag+n.Text)
+		h.cmdOutput(p, "note removed")
+		return nil
+	case "list", "ls":
+		target, err := h.noteTarget(name)
+		if err != nil {
+			return err
+		}
+		list, err := h.Notes(target)
+		if err != nil {
+			return err
+		} else if len(list) == 0 {
+			h.cmdOutput(p, "no notes about "+target)
+			return nil
+		}
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "notes about %s:", target)
+		for i, n := range list {
+			fmt.Fprintf(&buf, "\n%d. %s", i+1, n)
+		}
+		h.cmdOutput(p, buf.String())
+		return nil
+	default:
+		return fmt.Errorf("expected add, tag, del or list, got: %q", sub)
+	}
+}
+
+func (h *Hub) cmdWhois(p, peer Peer) error {
+	u := peer.UserInfo()
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "name: %s", peer.Name())
+	fmt.Fprintf(&buf, "\nprotocol: %s", PeerProtocol(peer))
+	if prof := peer.User().Profile(); prof != nil {
+		fmt.Fprintf(&buf, "\nprofile: %s", prof.ID())
+	}
+	if !peer.User().IsRegistered() {
+		buf.WriteString("\nnot registered")
+	}
+	fmt.Fprintf(&buf, "\nIP: %s", addrString(peer.RemoteAddr()))
+	if cid := peer.CID(); !cid.IsZero() {
+		fmt.Fprintf(&buf, "\nCID: %s", cid)
+	}
+	if u.App.Name != "" {
+		fmt.Fprintf(&buf, "\nclient: %s %s", u.App.Name, u.App.Version)
+	}
+	fmt.Fprintf(&buf, "\nshare: %d MB in %d files", u.Share/shareDiv, u.ShareFiles)
+	if rx, tx := PeerTraffic(peer); rx != 0 || tx != 0 {
+		fmt.Fprintf(&buf, "\ntraffic: received %s, sent %s", formatBytes(rx), formatBytes(tx))
+	}
+	if rate := peerThrottle(peer); rate > 0 {
+		fmt.Fprintf(&buf, "\nthrottled: %s/s", formatBytes(uint64(rate)))
+	}
+	if p.User().HasPerm(PermNotes) {
+		list, err := h.peerNotes(peer)
+		if err != nil {
+			return err
+		}
+		writeNotes(&buf, list)
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
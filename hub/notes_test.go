@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoteCommands(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("alice", "secret"))
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	user := newTestADCPeer(t, h, "user")
+	var cid CID
+	cid[0] = 1
+	setTestCID(h, user, cid)
+
+	require.True(t, h.isCommand(op, "!note add alice warned about spamming"))
+	require.True(t, h.isCommand(op, "!note tag alice #spammer"))
+	require.True(t, h.isCommand(op, "!note tag alice spammer"))
+	require.True(t, h.isCommand(op, "!note tag "+cid.String()+" bot"))
+
+	list, err := h.Notes("alice")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "op", list[0].Author)
+	require.Equal(t, "warned about spamming", list[0].Text)
+	require.Equal(t, "spammer", list[1].Tag)
+
+	sentADC(op)
+	require.True(t, h.isCommand(op, "!note add nobody text"))
+	require.Contains(t, lastChat(t, op), "error")
+
+	require.True(t, h.isCommand(op, "!whois user"))
+	require.Contains(t, lastChat(t, op), "#bot")
+
+	require.True(t, h.isCommand(op, "!note del alice 1"))
+	list, err = h.Notes("alice")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	audit, err := h.Audit(AuditQuery{Action: AuditNote})
+	require.NoError(t, err)
+	require.Len(t, audit, 5)
+
+	// regular users cannot manage notes
+	sentADC(user)
+	require.True(t, h.isCommand(user, "!note list alice"))
+	require.Contains(t, lastChat(t, user), "unsupported")
+}
+
+func TestNotesHTTP(t *testing.T) {
+	h, err := NewHub(Config{APIToken: "secret"})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.RegisterUser("alice", "secret"))
+
+	do := func(method, url string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, bytes.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		h.serveV0Notes(w, r)
+		return w
+	}
+
+	body, err := json.Marshal(UserNote{Target: "alice", Text: "hello"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, do("POST", HTTPNotesPathV0, body).Code)
+
+	body, err = json.Marshal(UserNote{Target: "bob", Text: "hello"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, do("POST", HTTPNotesPathV0, body).Code)
+
+	w := do("GET", HTTPNotesPathV0+"?target=alice", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []UserNote
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list, 1)
+	require.Equal(t, "hello", list[0].Text)
+
+	ts, err := list[0].Time.MarshalText()
+	require.NoError(t, err)
+	w = do("DELETE", HTTPNotesPathV0+"?target=alice&time="+string(ts), nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	list, err = h.Notes("alice")
+	require.NoError(t, err)
+	require.Empty(t, list)
+}
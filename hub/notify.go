@@ -0,0 +1,301 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Events that can be forwarded to notification webhooks.
+const (
+	// NotifyOpChat is a message in the operator chat room.
+	NotifyOpChat = "opchat"
+	// NotifyReport is a report sent by a user with the report command.
+	NotifyReport = "report"
+	// NotifyJoin is a join of a user that matches the watchlist.
+	NotifyJoin = "join"
+	// NotifyAlert is an automatic alert for operators, for example a ban evasion or an IP block.
+	NotifyAlert = "alert"
+	// NotifyError is an internal error of the hub.
+	NotifyError = "error"
+)
+
+const (
+	// DefaultOpChatRoom is the default name of the operator chat room.
+	DefaultOpChatRoom = "#op"
+	// DefaultNotifyRate is the default limit of notifications per minute for each webhook.
+	DefaultNotifyRate = 20
+
+	notifyQueueSize = 100
+	notifyTimeout   = 10 * time.Second
+)
+
+// NotifyConfig configures forwarding of hub events to external services.
+type NotifyConfig struct {
+	// Webhooks receive selected events.
+	Webhooks []NotifyWebhook
+	// OpChat is the name of the room forwarded as the operator chat.
+	// Zero value means DefaultOpChatRoom.
+	OpChat string
+	// Watch is a list of nicks, IPs or CIDR ranges. Joins of matching users are forwarded.
+	Watch []string
+}
+
+// NotifyWebhook is an HTTP endpoint that receives notifications.
+type NotifyWebhook struct {
+	// URL of the webhook. The notification is sent as a body of a POST request.
+	URL string
+	// Events is a list of events to forward. Empty list means all events.
+	Events []string
+	// Template of the request body, in text/template format. It is executed with the Notification.
+	// A "json" function is available to quote strings. By default, the notification is encoded as JSON.
+	//
+	// For example, for Discord: {"content": {{json .Text}}}
+	Template string
+	// ContentType of the request body. Zero value means "application/json".
+	ContentType string
+	// Rate limits the number of notifications per minute. Zero value means DefaultNotifyRate.
+	Rate int
+}
+
+// Notification is an event sent to webhooks.
+type Notification struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Hub   string    `json:"hub"`
+	User  string    `json:"user,omitempty"`
+	Text  string    `json:"text"`
+}
+
+var notifyFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+type notifyHook struct {
+	conf   NotifyWebhook
+	events map[string]struct{}
+	tmpl   *template.Template
+	queue  chan Notification
+
+	// accessed only by the sender goroutine
+	window  time.Time
+	sent    int
+	dropped int
+}
+
+func (w *notifyHook) accepts(event string) bool {
+	if len(w.events) == 0 {
+		return true
+	}
+	_, ok := w.events[event]
+	return ok
+}
+
+// allow checks the rate limit for the webhook.
+func (w *notifyHook) allow(now time.Time) bool {
+	if now.Sub(w.window) >= time.Minute {
+		if w.dropped != 0 {
+			log.Printf("notify: %d notifications to %s were dropped by the rate limit", w.dropped, w.conf.URL)
+		}
+		w.window, w.sent, w.dropped = now, 0, 0
+	}
+	if w.sent >= w.conf.Rate {
+		w.dropped++
+		return false
+	}
+	w.sent++
+	return true
+}
+
+func (w *notifyHook) body(n Notification) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(n)
+	}
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, n); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *notifyHook) send(cli *http.Client, n Notification) error {
+	data, err := w.body(n)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Post(w.conf.URL, w.conf.ContentType, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *notifyHook) run(cli *http.Client, closed <-chan struct{}) {
+	for {
+		select {
+		case <-closed:
+			return
+		case n := <-w.queue:
+			if !w.allow(time.Now()) {
+				continue
+			}
+			if err := w.send(cli, n); err != nil {
+				log.Printf("notify: %s: %v", w.conf.URL, err)
+			}
+		}
+	}
+}
+
+type notifier struct {
+	hooks  []*notifyHook
+	opChat string
+	names  map[string]struct{}
+	nets   []*net.IPNet
+	cli    *http.Client
+}
+
+func newNotifier(conf NotifyConfig) (*notifier, error) {
+	n := &notifier{
+		opChat: conf.OpChat,
+		names:  make(map[string]struct{}),
+		cli:    &http.Client{Timeout: notifyTimeout},
+	}
+	if n.opChat == "" {
+		n.opChat = DefaultOpChatRoom
+	}
+	for _, c := range conf.Webhooks {
+		if c.URL == "" {
+			return nil, errors.New("notification webhook URL must be set")
+		}
+		if c.ContentType == "" {
+			c.ContentType = "application/json"
+		}
+		if c.Rate <= 0 {
+			c.Rate = DefaultNotifyRate
+		}
+		w := &notifyHook{
+			conf:   c,
+			events: make(map[string]struct{}),
+			queue:  make(chan Notification, notifyQueueSize),
+		}
+		for _, e := range c.Events {
+			w.events[e] = struct{}{}
+		}
+		if c.Template != "" {
+			t, err := template.New("").Funcs(notifyFuncs).Parse(c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid notification template for %s: %v", c.URL, err)
+			}
+			w.tmpl = t
+		}
+		n.hooks = append(n.hooks, w)
+	}
+	for _, s := range conf.Watch {
+		if _, ipn, err := net.ParseCIDR(s); err == nil {
+			n.nets = append(n.nets, ipn)
+		} else if ip := net.ParseIP(s); ip != nil {
+			n.nets = append(n.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else {
+			n.names[strings.ToLower(s)] = struct{}{}
+		}
+	}
+	return n, nil
+}
+
+// watched checks if the user is in the watchlist.
+func (n *notifier) watched(name string, ip net.IP) bool {
+	if _, ok := n.names[strings.ToLower(name)]; ok {
+		return true
+	}
+	for _, ipn := range n.nets {
+		if ip != nil && ipn.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *notifier) start(closed <-chan struct{}) {
+	for _, w := range n.hooks {
+		go w.run(n.cli, closed)
+	}
+}
+
+func (n *notifier) emit(e Notification) {
+	for _, w := range n.hooks {
+		if !w.accepts(e.Event) {
+			continue
+		}
+		select {
+		case w.queue <- e:
+		default:
+			// queue is full, the webhook is too slow
+		}
+	}
+}
+
+// notify forwards an event to notification webhooks.
+func (h *Hub) notify(event, user, text string) {
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.emit(Notification{
+		Time:  time.Now().UTC(),
+		Event: event,
+		Hub:   h.getName(),
+		User:  user,
+		Text:  text,
+	})
+}
+
+// notifyJoin forwards a join of the peer if it matches the watchlist.
+func (h *Hub) notifyJoin(peer Peer) {
+	if h.notifier == nil || PeerProtocol(peer) == ProtoBot {
+		return
+	}
+	ip := peerIP(peer)
+	if !h.notifier.watched(peer.Name(), ip) {
+		return
+	}
+	h.notify(NotifyJoin, peer.Name(), fmt.Sprintf("%s joined from %s", peer.Name(), addrString(peer.RemoteAddr())))
+}
+
+// notifyChat forwards a message in the operator chat room.
+func (h *Hub) notifyChat(r *Room, m Message) {
+	if h.notifier == nil || r.Name() != h.notifier.opChat {
+		return
+	}
+	h.notify(NotifyOpChat, m.Name, m.Text)
+}
+
+// hubError logs an internal error of the hub and forwards it to notification webhooks.
+func (h *Hub) hubError(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	log.Println(text)
+	h.notify(NotifyError, "", text)
+}
+
+func (h *Hub) cmdReport(p Peer, name string, reason RawCmd) error {
+	if reason == "" {
+		return errors.New("reason must be set")
+	}
+	text := fmt.Sprintf("report from %s about %s: %s", p.Name(), name, reason)
+	h.sendToOps(text)
+	h.notify(NotifyReport, p.Name(), text)
+	h.cmdOutput(p, "report sent to operators")
+	return nil
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies <- r.URL.Path + " " + string(data)
+	}))
+	defer srv.Close()
+
+	h, err := NewHub(Config{
+		Name: "hub",
+		Notify: NotifyConfig{
+			Webhooks: []NotifyWebhook{
+				{
+					URL:      srv.URL + "/discord",
+					Events:   []string{NotifyReport, NotifyJoin},
+					Template: `{"content": {{json .Text}}}`,
+					Rate:     2,
+				},
+				{
+					URL:    srv.URL + "/json",
+					Events: []string{NotifyOpChat},
+				},
+			},
+			Watch: []string{"Watched", "10.0.0.0/8"},
+		},
+	})
+	require.NoError(t, err)
+	h.notifier.start(h.closed)
+	defer h.Close()
+
+	next := func() string {
+		select {
+		case s := <-bodies:
+			return s
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+			return ""
+		}
+	}
+
+	p := newTestADCPeer(t, h, "user")
+	require.True(t, h.isCommand(p, "!report bad spamming in chat"))
+	require.Equal(t, `/discord {"content": "report from user about bad: spamming in chat"}`, next())
+
+	newTestADCPeer(t, h, "watched")
+	require.Equal(t, `/discord {"content": "watched joined from 127.0.0.1"}`, next())
+
+	r, err := h.NewRoom(DefaultOpChatRoom)
+	require.NoError(t, err)
+	r.SendChat(p, Message{Text: "hello ops"})
+	var n Notification
+	got := next()
+	require.Equal(t, "/json ", got[:6])
+	require.NoError(t, json.Unmarshal([]byte(got[6:]), &n))
+	require.Equal(t, NotifyOpChat, n.Event)
+	require.Equal(t, "hub", n.Hub)
+	require.Equal(t, "user", n.User)
+	require.Equal(t, "hello ops", n.Text)
+
+	// rate limit is reached
+	require.True(t, h.isCommand(p, "!report bad again"))
+	select {
+	case s := <-bodies:
+		t.Fatalf("unexpected notification: %s", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
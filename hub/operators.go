@@ -0,0 +1,177 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/go-irc/irc"
+)
+
+// HTTPOpsPathV0 grants (POST) or revokes (DELETE) the operator status of a user given in the "name" parameter.
+const HTTPOpsPathV0 = "/api/v0/ops"
+
+var errOpOwner = errors.New("cannot change the status of the hub owner")
+
+// SetOperator grants or revokes the operator status of a registered user.
+// The profile is saved to the database and, if the user is online, the change takes effect immediately:
+// clients of all protocols see the new status without a reconnect.
+//
+// The profile the user had before the promotion is restored when the status is revoked.
+// Revoking the status of a user that is not an operator does nothing.
+func (h *Hub) SetOperator(name string, op bool) error {
+	_, rec, err := h.getUser(name)
+	if err != nil {
+		return err
+	} else if rec == nil {
+		return ErrUserNotFound
+	}
+	cur := h.Profile(rec.Profile)
+	if cur != nil && cur.IsOwner() {
+		return errOpOwner
+	}
+	if op == cur.HasParent(ProfileNameOperator) {
+		return nil
+	}
+	prof, prev := ProfileNameOperator, rec.Profile
+	if !op {
+		prof, prev = rec.PrevProfile, ""
+		if prof == "" {
+			prof = ProfileNameRegistered
+		}
+	}
+	profile := h.Profile(prof)
+	if profile == nil {
+		return fmt.Errorf("profile %q does not exist", prof)
+	}
+	err = h.UpdateUser(name, func(u *UserRecord) (bool, error) {
+		u.Profile = prof
+		u.PrevProfile = prev
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	peer := h.PeerByName(name)
+	if peer == nil {
+		return nil
+	}
+	u := peer.User()
+	if u == nil || u.IsOwner() {
+		return nil
+	}
+	wasOp := u.IsOp()
+	u.SetProfile(profile)
+	if isOp := u.IsOp(); wasOp != isOp {
+		h.broadcastOpChange(peer, isOp)
+	}
+	return nil
+}
+
+// opChangeNotifier is implemented by peers that must be notified about the change of the operator
+// status in addition to the user info update.
+type opChangeNotifier interface {
+	opChanged(peer Peer, op bool) error
+}
+
+// broadcastOpChange notifies all peers that the operator status of the user has changed.
+func (h *Hub) broadcastOpChange(peer Peer, op bool) {
+	notify := h.Peers()
+	for _, p2 := range notify {
+		if n, ok := p2.(opChangeNotifier); ok {
+			_ = n.opChanged(peer, op)
+		}
+	}
+	// ADC clients see the new CT field, NMDC clients get $OpList
+	h.sendUserUpdate(peer, notify)
+}
+
+// opChanged removes a demoted user from the list of operators. NMDC clients never remove users
+// from $OpList, thus the user is re-added to the user list.
+func (p *nmdcPeer) opChanged(peer Peer, op bool) error {
+	if op {
+		return nil
+	}
+	cmds := []nmdcp.Message{&nmdcp.Quit{Name: nmdcp.Name(peer.Name())}}
+	if !p.ext.nohello {
+		cmds = append(cmds, nmdcHelloCmds([]Peer{peer})...)
+	}
+	return p.SendNMDC(cmds...)
+}
+
+// opChanged sets or removes the operator mode of the user in the hub channel.
+func (p *ircPeer) opChanged(peer Peer, op bool) error {
+	mode := "-o"
+	if op {
+		mode = "+o"
+	}
+	return p.writeMessage(&irc.Message{
+		Prefix:  p.hostPref,
+		Command: "MODE",
+		Params:  []string{ircHubChan, mode, peer.Name()},
+	})
+}
+
+func (h *Hub) cmdOp(p Peer, args string) error {
+	return h.cmdSetOp(p, args, true)
+}
+
+func (h *Hub) cmdDeop(p Peer, args string) error {
+	return h.cmdSetOp(p, args, false)
+}
+
+func (h *Hub) cmdSetOp(p Peer, args string, op bool) error {
+	name := strings.TrimSpace(args)
+	if name == "" {
+		return errCmdInvalidArg
+	}
+	if err := h.SetOperator(name, op); err != nil {
+		return err
+	}
+	if op {
+		h.audit(AuditProfile, p, name, "op")
+		h.cmdOutput(p, name+" is now an operator")
+	} else {
+		h.audit(AuditProfile, p, name, "deop")
+		h.cmdOutput(p, name+" is no longer an operator")
+	}
+	return nil
+}
+
+// serveV0Ops grants or revokes the operator status of a registered user.
+func (h *Hub) serveV0Ops(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	var op bool
+	switch r.Method {
+	case "POST":
+		op = true
+	case "DELETE":
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	err := h.SetOperator(name, op)
+	switch err {
+	case nil:
+	case ErrUserNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errOpOwner:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reason := "deop"
+	if op {
+		reason = "op"
+	}
+	h.audit(AuditProfile, nil, name, reason)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,131 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestSetOperator(t *testing.T) {
+	h, err := NewHub(Config{APIToken: "secret"})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("alice", "password"))
+
+	alice := newTestADCPeer(t, h, "alice")
+	alice.setUser(&User{profile: h.Profile(ProfileNameRegistered)})
+	other := newTestADCPeer(t, h, "other")
+	_, buf := newTestIRCPeer(t, h, "irc")
+	nmdc := loginNMDC(t, h, 1, "nmdc", loginDCPP)
+	nmdc.expect("Supports")
+	nmdc.join(loginDCPP)
+	nmdc.expect("OpList")
+	sentADC(other)
+	sentIRC(t, buf)
+
+	owner := newTestADCPeer(t, h, "owner")
+	owner.setUser(&User{profile: h.Profile(ProfileNameRoot)})
+	require.True(t, h.isCommand(owner, "!op bob"))
+	require.Contains(t, lastChat(t, owner), "does\\snot\\sexist")
+
+	require.True(t, h.isCommand(owner, "!op alice"))
+	require.True(t, alice.User().IsOp())
+	_, rec, err := h.getUser("alice")
+	require.NoError(t, err)
+	require.Equal(t, ProfileNameOperator, rec.Profile)
+
+	// ADC clients see the new user type
+	var u adc.User
+	var found bool
+	for _, p := range sentADC(other) {
+		if b, ok := p.(*adc.BroadcastPacket); ok && b.Name == (adc.User{}).Cmd() && b.ID == alice.SID() {
+			require.NoError(t, adc.Unmarshal(b.Data, &u))
+			found = true
+		}
+	}
+	require.True(t, found)
+	require.Equal(t, adc.UserTypeOperator, u.Type)
+
+	// IRC users see the channel mode
+	got := sentIRC(t, buf)
+	require.Len(t, got, 1)
+	require.Equal(t, "MODE", got[0].Command)
+	require.Equal(t, []string{ircHubChan, "+o", "alice"}, got[0].Params)
+
+	// NMDC users get the operator list
+	ops, ok := nmdc.expect("OpList").(*nmdcp.OpList)
+	require.True(t, ok)
+	require.Equal(t, []string{"alice"}, []string(ops.Names))
+
+	r := httptest.NewRequest("DELETE", HTTPOpsPathV0+"?name=alice", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.serveV0Ops(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.False(t, alice.User().IsOp())
+
+	got = sentIRC(t, buf)
+	require.Len(t, got, 1)
+	require.Equal(t, []string{ircHubChan, "-o", "alice"}, got[0].Params)
+
+	// NMDC clients re-add the user without the operator status
+	quit, ok := nmdc.expect("Quit").(*nmdcp.Quit)
+	require.True(t, ok)
+	require.Equal(t, "alice", string(quit.Name))
+	require.Equal(t, "alice", myINFOName(nmdc.expect("MyINFO")))
+
+	r = httptest.NewRequest("DELETE", HTTPOpsPathV0+"?name=owner", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.serveV0Ops(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSetOperatorRestoreProfile(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.db.PutProfile("vip", Map{ProfileParent: ProfileNameRegistered}))
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("bob", "password"))
+	require.NoError(t, h.RegisterUser("alice", "password"))
+	require.NoError(t, h.UpdateUser("bob", func(u *UserRecord) (bool, error) {
+		u.Profile = "vip"
+		return true, nil
+	}))
+	profile := func(name string) string {
+		_, rec, err := h.getUser(name)
+		require.NoError(t, err)
+		return rec.Profile
+	}
+
+	bob := newTestADCPeer(t, h, "bob")
+	bob.setUser(&User{profile: h.Profile("vip")})
+	other := newTestADCPeer(t, h, "other")
+	sentADC(other)
+
+	require.NoError(t, h.SetOperator("bob", true))
+	require.Equal(t, ProfileNameOperator, profile("bob"))
+	require.True(t, bob.User().IsOp())
+	// already an operator
+	require.NoError(t, h.SetOperator("bob", true))
+
+	require.NoError(t, h.SetOperator("bob", false))
+	require.Equal(t, "vip", profile("bob"))
+	require.Equal(t, "vip", bob.User().Profile().ID())
+	require.False(t, bob.User().IsOp())
+	sentADC(other)
+
+	// deop is a no-op for users that are not operators
+	require.NoError(t, h.SetOperator("bob", false))
+	require.Equal(t, "vip", profile("bob"))
+	require.NoError(t, h.SetOperator("alice", false))
+	require.Equal(t, "", profile("alice"))
+	require.Empty(t, sentADC(other))
+}
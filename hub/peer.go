@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/direct-connect/go-dcpp/internal/safe"
 )
@@ -19,11 +20,18 @@ type ConnInfo struct {
 	Secure  bool
 	TLSVers uint16
 	ALPN    string
+
+	// traffic is nil for virtual peers
+	traffic *connTraffic
+	// upgrade is set if the connection can be switched to TLS during the handshake
+	upgrade *upgradeConn
 }
 
 type Peer interface {
 	base() *BasePeer
 	setUser(u *User)
+	// protocol returns the protocol name, see PeerProtocol.
+	protocol() string
 	connAddr
 
 	// Close the peer's connection.
@@ -38,11 +46,16 @@ type Peer interface {
 
 	// Online flag for this peer.
 	Online() bool
-	// Searchable checks if this peer accepts search requests.
-	Searchable() bool
+	// Capabilities returns a set of operations supported by this peer.
+	// The hub doesn't route unsupported operations to the peer.
+	Capabilities() PeerCaps
+	// HasFeature checks if a protocol extension is active for this peer.
+	HasFeature(name string) bool
 
 	// SID returns a session ID of this peer.
 	SID() SID
+	// CID returns a client ID of this peer. It is zero for protocols without client IDs.
+	CID() CID
 
 	// Name returns peer's user name.
 	Name() string
@@ -78,26 +91,50 @@ type Peer interface {
 	Search(ctx context.Context, req SearchRequest, out Search) error
 }
 
+// PeerCaps is a set of operations supported by a peer.
+type PeerCaps uint
+
+const (
+	// CapSearch is set if the peer accepts search requests.
+	CapSearch = PeerCaps(1 << iota)
+	// CapConnect is set if the peer accepts direct and reverse connection requests.
+	CapConnect
+	// CapRooms is set if the peer can join chat rooms other than the main chat.
+	CapRooms
+	// CapPrivate is set if the peer accepts private messages.
+	CapPrivate
+)
+
+// Has checks if all given capabilities are set.
+func (c PeerCaps) Has(c2 PeerCaps) bool {
+	return c&c2 == c2
+}
+
 type PeerTopic interface {
 	Topic(topic string) error
 }
 
-type PeersJoinEvent struct {
-	Peers []Peer
-
+// nmdcPeersRaw caches NMDC commands for a list of peers.
+// It is shared by all peers that receive the event.
+type nmdcPeersRaw struct {
 	nmdcInfos nmdcRaw
 	nmdcOps   nmdcRaw
 	nmdcBots  nmdcRaw
 	nmdcIPs   nmdcRaw
 }
 
+type PeersJoinEvent struct {
+	Peers []Peer
+
+	nmdcPeersRaw
+}
+
 type PeersUpdateEvent struct {
 	Peers []Peer
 
-	nmdcInfos nmdcRaw
-	nmdcOps   nmdcRaw
-	nmdcBots  nmdcRaw
-	nmdcIPs   nmdcRaw
+	adcInfos map[adcInfoKey][]byte
+
+	nmdcPeersRaw
 }
 
 type PeersLeaveEvent struct {
@@ -106,13 +143,19 @@ type PeersLeaveEvent struct {
 	nmdcQuit nmdcRaw
 }
 
-func (h *Hub) newBasePeer(p *BasePeer, c *ConnInfo) {
+func (h *Hub) newBasePeer(p *BasePeer, c *ConnInfo) error {
+	sid, err := h.nextSID()
+	if err != nil {
+		return err
+	}
 	*p = BasePeer{
-		hub:   h,
-		cinfo: c,
-		sid:   h.nextSID(),
+		hub:     h,
+		cinfo:   c,
+		sid:     sid,
+		created: time.Now(),
 	}
 	p.close.done = make(chan struct{})
+	return nil
 }
 
 type BasePeer struct {
@@ -120,19 +163,54 @@ type BasePeer struct {
 	cinfo   *ConnInfo
 	user    *User
 	offline safe.Bool
+	created time.Time
+	// login is the time when a registered user logged in; zero for unregistered users.
+	login time.Time
+	// joined is the time when the peer was added to the connection history.
+	joined time.Time
 
-	sid  SID
-	name safe.String
+	sid         SID
+	sidReleased uint32 // atomic
+	name        safe.String
 
+	// close holds the lifecycle state of the peer, see closeWith and spawn.
 	close struct {
 		sync.Mutex
-		done chan struct{}
+		done  chan struct{}
+		tasks sync.WaitGroup
 	}
 
 	rooms struct {
 		sync.RWMutex
 		list []*Room
 	}
+
+	// rules holds the timer for users that must accept the rules, see sendWelcome.
+	rules struct {
+		sync.Mutex
+		timer *time.Timer
+	}
+
+	// muted is set for users shadow-muted by the watchlist, see isGagged.
+	muted safe.Bool
+	// pmToOps is set for users whose private messages are forwarded to operators.
+	pmToOps safe.Bool
+	// restricted is set if the client lacks an extension required by the hub, see checkExtensions.
+	restricted *requiredExt
+
+	// tz is a time zone offset set by the user; nil means the hub time zone.
+	tz struct {
+		sync.Mutex
+		loc *time.Location
+	}
+
+	// adcInfo holds the last INF of this peer broadcasted to ADC peers.
+	// It is used to send only the fields that were changed. The lock is held
+	// while the update is delivered, see Hub.sendUserUpdate.
+	adcInfo struct {
+		sync.Mutex
+		last [2][]byte // indexed by adcInfoVariant
+	}
 }
 
 func (p *BasePeer) base() *BasePeer {
@@ -159,6 +237,20 @@ func (p *BasePeer) Name() string {
 	return p.name.Get()
 }
 
+// HasFeature implements Peer. By default, no extensions are supported.
+func (p *BasePeer) HasFeature(name string) bool {
+	return false
+}
+
+// CID implements Peer. By default, the peer has no client ID.
+func (p *BasePeer) CID() CID {
+	return CID{}
+}
+
+func (p *BasePeer) protocol() string {
+	return ""
+}
+
 func (p *BasePeer) Online() bool {
 	return !p.offline.Get()
 }
@@ -175,26 +267,50 @@ func (p *BasePeer) RemoteAddr() net.Addr {
 	return p.cinfo.Remote
 }
 
+// closeWith implements Close for all peer types.
+//
+// Close is idempotent and safe to call concurrently. Only the first call runs the closers;
+// other calls return immediately. The closers run without holding any locks of the peer,
+// so they are free to notify the hub and other peers. After the first call returns,
+// all background tasks started with spawn have exited, so no writes to the connection happen.
 func (p *BasePeer) closeWith(pr Peer, closers ...func() error) error {
-	if !p.Online() {
-		return nil
-	}
 	p.close.Lock()
 	if !p.Online() {
 		p.close.Unlock()
 		return nil
 	}
-	defer func() {
-		p.close.Unlock()
-		p.hub.callOnLeave(pr)
-	}()
-	close(p.close.done)
 	p.offline.Set(true)
+	close(p.close.done)
+	p.close.Unlock()
+
 	var first error
 	for _, fnc := range closers {
-		if err := fnc(); err != nil {
+		if err := fnc(); err != nil && first == nil {
 			first = err
 		}
 	}
+	// closers must close the connection, so blocked tasks will exit as well
+	p.close.tasks.Wait()
+	p.stopRules()
+	p.hub.callOnLeave(pr)
 	return first
 }
+
+// spawn runs a background task of the peer, such as the connection writer.
+// The task must return when close.done is closed or the connection fails.
+// The peer is closed when the task returns, thus the task must not call Close itself.
+//
+// Tasks are not started if the peer is already closed.
+func (p *BasePeer) spawn(pr Peer, task func()) {
+	p.close.Lock()
+	defer p.close.Unlock()
+	if !p.Online() {
+		return
+	}
+	p.close.tasks.Add(1)
+	go func() {
+		task()
+		p.close.tasks.Done()
+		_ = pr.Close()
+	}()
+}
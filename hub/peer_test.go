@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// closeCheckConn fails the test if anything is written after the peer is closed.
+type closeCheckConn struct {
+	discardConn
+	t          *testing.T
+	connClosed uint32 // set by the hub
+	closed     uint32 // set by the test after Close returns
+	writes     uint32
+}
+
+func (c *closeCheckConn) Close() error {
+	atomic.StoreUint32(&c.connClosed, 1)
+	return nil
+}
+
+func (c *closeCheckConn) Write(p []byte) (int, error) {
+	if atomic.LoadUint32(&c.closed) != 0 {
+		c.t.Errorf("write after close: %q", p)
+	}
+	if atomic.LoadUint32(&c.connClosed) != 0 {
+		return 0, io.ErrClosedPipe
+	}
+	atomic.AddUint32(&c.writes, 1)
+	// slow down the writer to increase the chance of a concurrent close
+	time.Sleep(time.Millisecond)
+	return len(p), nil
+}
+
+func TestPeerCloseNoWrites(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	defer h.Close()
+
+	conn := &closeCheckConn{t: t}
+	c, err := adc.NewConn(conn)
+	require.NoError(t, err)
+	p, err := newADC(h, nil, c, adc.ModFeatures{adc.FeaBASE: true, adc.FeaTIGR: true})
+	require.NoError(t, err)
+	p.setName("user")
+	h.acceptPeer(p, nil, nil)
+	p.spawn(p, func() {
+		p.writer(time.Second)
+	})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_ = p.HubChatMsg(Message{Text: "spam"})
+			}
+		}()
+	}
+	for atomic.LoadUint32(&conn.writes) < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, p.Close())
+	atomic.StoreUint32(&conn.closed, 1)
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	require.Equal(t, errConnectionClosed, p.HubChatMsg(Message{Text: "late"}))
+}
+
+func TestPeerCloseConcurrent(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	alice := th.JoinADC("alice")
+	bob := th.JoinADC("bob")
+
+	var leaves uint32
+	th.h.OnLeave(func(p Peer) {
+		atomic.AddUint32(&leaves, 1)
+	})
+
+	p := th.h.PeerByName("bob")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = p.Close()
+		}()
+	}
+	wg.Wait()
+	bob.ExpectClosed()
+	alice.ExpectQuit(bob)
+	th.Sync(alice)
+	require.Len(t, alice.Received("QUI"), 0, "duplicate leave")
+	require.Equal(t, uint32(1), atomic.LoadUint32(&leaves))
+
+	// spawn is a no-op for closed peers
+	started := false
+	p.base().spawn(p, func() { started = true })
+	require.False(t, started)
+}
+
+func TestPeerCapabilities(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	a := newTestADCPeer(t, h, "adc")
+	irc, _ := newTestIRCPeer(t, h, "irc")
+	bot, err := h.NewBot("bot", h.getSoft())
+	require.NoError(t, err)
+	b := h.PeerByName(bot.Name())
+
+	require.True(t, a.Capabilities().Has(CapSearch|CapConnect|CapPrivate))
+	require.False(t, irc.Capabilities().Has(CapSearch))
+	require.False(t, irc.Capabilities().Has(CapConnect))
+	require.True(t, irc.Capabilities().Has(CapRooms|CapPrivate))
+
+	// unsupported operations are not routed to the peer
+	h.privateChat(a, b, Message{Name: a.Name(), Text: "hi"})
+	require.Contains(t, lastChat(t, a), "bot\\sdoes\\snot\\saccept\\sprivate\\smessages")
+
+	_, err = h.JoinRoom(b, "#room", "")
+	require.Equal(t, errRoomNoSupport, err)
+	_, err = h.JoinRoom(irc, "#room", "")
+	require.NoError(t, err)
+}
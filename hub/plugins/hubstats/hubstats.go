@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/direct-connect/go-dcpp/hub"
 )
@@ -23,7 +24,7 @@ func (*hubStats) Name() string {
 }
 
 func (*hubStats) Version() hub.Version {
-	return hub.Version{Major: 0, Minor: 4}
+	return hub.Version{Major: 0, Minor: 5}
 }
 
 func (p *hubStats) Init(h *hub.Hub, path string) error {
@@ -33,6 +34,7 @@ func (p *hubStats) Init(h *hub.Hub, path string) error {
 		Name:    "stats",
 		Aliases: []string{"hubinfo"},
 		Short:   "show hub stats",
+		Long:    "Use \"stats json\" to get the full stats in JSON format.",
 		Func:    p.cmdStats,
 	})
 	h.RegisterCommand(hub.Command{
@@ -45,8 +47,47 @@ func (p *hubStats) Init(h *hub.Hub, path string) error {
 
 func (p *hubStats) cmdStats(peer hub.Peer, args string) error {
 	st := p.h.Stats()
-	data, _ := json.MarshalIndent(st, "", "  ")
-	_ = peer.HubChatMsg(hub.Message{Text: string(data)})
+	if args == "json" {
+		data, _ := json.MarshalIndent(st, "", "  ")
+		_ = peer.HubChatMsg(hub.Message{Text: string(data)})
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	_, _ = fmt.Fprintf(buf, `Hub statistics:
+Uptime: %v
+Users:  %5d (peak: %d)
+Share:  %d MB (%d files, avg: %d MB)
+`,
+		time.Duration(st.Uptime)*time.Second,
+		st.Users, st.PeakUsers,
+		st.Share, st.Files, st.AvgShare,
+	)
+	if t := st.Traffic; t != nil {
+		_, _ = fmt.Fprintf(buf, `
+Traffic:
+Download: %d KB/s (total: %d MB)
+Upload:   %d KB/s (total: %d MB)
+Messages: %.1f/s (total: %d)
+Searches: %.1f/s (total: %d)
+`,
+			t.RxRate/1024, t.RxBytes/(1024*1024),
+			t.TxRate/1024, t.TxBytes/(1024*1024),
+			t.MessageRate, t.Messages,
+			t.SearchRate, t.Searches,
+		)
+	}
+	if len(st.Protocols) != 0 {
+		buf.WriteString("\nProtocols:\n")
+		names := make([]string, 0, len(st.Protocols))
+		for name := range st.Protocols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintf(buf, "%s: %5d\n", name, st.Protocols[name])
+		}
+	}
+	_ = peer.HubChatMsg(hub.Message{Text: buf.String()})
 	return nil
 }
 
@@ -30,12 +30,23 @@ func DefaultProfiles() map[string]Map {
 		ProfileNameOperator: {
 			ProfileParent: ProfileNameRegistered,
 			FlagOpIcon:    true,
-
-			PermRoomsList: true,
-			PermBroadcast: true,
-			PermDrop:      true,
-			PermIP:        true,
-			PermBanIP:     true,
+			FlagSkipRules: true,
+
+			PermRoomsList:   true,
+			PermBroadcast:   true,
+			PermDrop:        true,
+			PermIP:          true,
+			PermBanIP:       true,
+			PermAudit:       true,
+			PermSearchStats: true,
+			PermNotes:       true,
+			PermWatch:       true,
+			PermGag:         true,
+			PermSlowMode:    true,
+			PermAnnounce:    true,
+			PermThrottle:    true,
+
+			PermSlowModeExempt: true,
 		},
 		ProfileNameRegistered: {
 			ProfileParent: ProfileNameGuest,
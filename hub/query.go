@@ -0,0 +1,114 @@
+package hub
+
+import (
+	"net"
+	"sort"
+)
+
+// PeerFilter selects peers in peer queries.
+type PeerFilter func(p Peer) bool
+
+// PeerOrder is a sort order of peer queries.
+type PeerOrder int
+
+const (
+	// OrderNone returns peers in an unspecified order.
+	OrderNone = PeerOrder(iota)
+	// OrderName sorts peers by name.
+	OrderName
+	// OrderShare sorts peers by share size, largest first.
+	OrderShare
+)
+
+// PeerQuery selects a page of peers that match the filter.
+type PeerQuery struct {
+	Filter PeerFilter // nil selects all peers
+	Order  PeerOrder
+	Offset int
+	Limit  int // zero means no limit
+}
+
+// PeersWhere returns all peers that match the filter.
+//
+// The filter is called for a snapshot of the peer list, thus it doesn't block
+// peers joining or leaving the hub.
+func (h *Hub) PeersWhere(filter PeerFilter) []Peer {
+	var out []Peer
+	for _, p := range h.Peers() {
+		if filter(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// QueryPeers returns a single page of peers that match the query and the total number of matching peers.
+func (h *Hub) QueryPeers(q PeerQuery) ([]Peer, int) {
+	var list []Peer
+	if q.Filter != nil {
+		list = h.PeersWhere(q.Filter)
+	} else {
+		// the list is shared, make a copy before sorting it
+		list = append([]Peer{}, h.Peers()...)
+	}
+	switch q.Order {
+	case OrderName:
+		keys := make(map[Peer]nameKey, len(list))
+		for _, p := range list {
+			keys[p] = h.toNameKey(p.Name())
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return keys[list[i]] < keys[list[j]]
+		})
+	case OrderShare:
+		shares := make(map[Peer]uint64, len(list))
+		for _, p := range list {
+			shares[p] = p.UserInfo().Share
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return shares[list[i]] > shares[list[j]]
+		})
+	}
+	total := len(list)
+	if q.Offset > 0 {
+		if q.Offset >= len(list) {
+			return nil, total
+		}
+		list = list[q.Offset:]
+	}
+	if q.Limit > 0 && q.Limit < len(list) {
+		list = list[:q.Limit]
+	}
+	return list, total
+}
+
+// PeerByCID returns an ADC peer with a given CID.
+func (h *Hub) PeerByCID(cid CID) Peer {
+	p := h.peers.index.ByCID(cid)
+	if p == nil {
+		return nil
+	}
+	return p
+}
+
+// PeersByIP returns all peers connected from a given IP. Bots are not included.
+func (h *Hub) PeersByIP(ip net.IP) []Peer {
+	if ip == nil {
+		return nil
+	}
+	return h.PeersWhere(func(p Peer) bool {
+		if _, ok := p.(*botPeer); ok {
+			return false
+		}
+		return ip.Equal(peerIP(p))
+	})
+}
+
+// PeerNameMatch returns a filter that selects peers with names matching the pattern.
+// The pattern is case-insensitive and supports '*' and '?' wildcards.
+func (h *Hub) PeerNameMatch(pattern string) PeerFilter {
+	pat := string(h.toNameKey(pattern))
+	return func(p Peer) bool {
+		return matchNickPattern(pat, string(h.toNameKey(p.Name())))
+	}
+}
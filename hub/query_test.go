@@ -0,0 +1,66 @@
+package hub
+
+import (
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func peerNames(peers []Peer) []string {
+	names := make([]string, 0, len(peers))
+	for _, p := range peers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+func TestQueryPeers(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	for i, name := range []string{"carol", "Alice", "dave", "bob"} {
+		p := newTestADCPeer(t, h, name)
+		p.info.user.ShareSize = int64(i+1) * 100
+	}
+	// the hub bot is also on the list
+	all := len(h.Peers())
+
+	peers, total := h.QueryPeers(PeerQuery{Filter: h.PeerNameMatch("?a*"), Order: OrderName})
+	require.Equal(t, 2, total)
+	require.Equal(t, []string{"carol", "dave"}, peerNames(peers))
+
+	peers, total = h.QueryPeers(PeerQuery{Order: OrderShare, Limit: 2})
+	require.Equal(t, all, total)
+	require.Equal(t, []string{"bob", "dave"}, peerNames(peers))
+
+	peers, total = h.QueryPeers(PeerQuery{
+		Filter: h.PeerNameMatch("*"), Order: OrderName,
+		Offset: 1, Limit: 2,
+	})
+	require.Equal(t, all, total)
+	require.Equal(t, []string{"bob", "carol"}, peerNames(peers))
+
+	peers, total = h.QueryPeers(PeerQuery{Offset: all})
+	require.Equal(t, all, total)
+	require.Empty(t, peers)
+}
+
+func TestPeerLookup(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	p := newTestADCPeer(t, h, "alice")
+	setTestCID(h, p, CID{1})
+	newTestADCPeer(t, h, "bob")
+
+	require.Equal(t, Peer(p), h.PeerByCID(CID{1}))
+	require.Nil(t, h.PeerByCID(CID{2}))
+
+	names := peerNames(h.PeersByIP(peerIP(p)))
+	sort.Strings(names)
+	require.Equal(t, []string{"alice", "bob"}, names)
+	require.Empty(t, h.PeersByIP(net.ParseIP("10.0.0.1")))
+	require.Empty(t, h.PeersByIP(nil))
+}
@@ -0,0 +1,147 @@
+package hub
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-irc/irc"
+)
+
+// DefaultReaperGrace is the default time idle peers are allowed to respond to a keepalive.
+const DefaultReaperGrace = 30 * time.Second
+
+// ReaperConfig configures the reaper of idle connections.
+//
+// A keepalive is sent to peers that haven't sent anything for the interval configured for their
+// protocol: an empty line for ADC, a pipe for NMDC and PING for IRC. Peers that still send nothing
+// within the Grace period are disconnected. Zero interval disables the reaper for the protocol.
+//
+// Only IRC clients are required to respond to keepalives. ADC and NMDC clients send their own
+// keepalives instead, thus intervals for these protocols should be longer than the ones used by clients.
+type ReaperConfig struct {
+	ADC  time.Duration
+	NMDC time.Duration
+	IRC  time.Duration
+	// Grace is the time allowed to respond to the keepalive. Zero value means DefaultReaperGrace.
+	Grace time.Duration
+}
+
+func (c ReaperConfig) enabled() bool {
+	return c.ADC > 0 || c.NMDC > 0 || c.IRC > 0
+}
+
+// pinger is implemented by peers that can send a protocol-specific keepalive.
+type pinger interface {
+	ping() error
+}
+
+type idleReaper struct {
+	h    *Hub
+	conf ReaperConfig
+	// pinged records the time a keepalive was sent to idle peers
+	pinged map[Peer]time.Time
+}
+
+func newIdleReaper(h *Hub, conf ReaperConfig) *idleReaper {
+	if conf.Grace <= 0 {
+		conf.Grace = DefaultReaperGrace
+	}
+	return &idleReaper{h: h, conf: conf, pinged: make(map[Peer]time.Time)}
+}
+
+func (r *idleReaper) interval(p Peer) time.Duration {
+	switch PeerProtocol(p) {
+	case ProtoADC:
+		return r.conf.ADC
+	case ProtoNMDC:
+		return r.conf.NMDC
+	case ProtoIRC:
+		return r.conf.IRC
+	}
+	return 0
+}
+
+// reap sends keepalives to idle peers and disconnects the ones that didn't respond in time.
+func (r *idleReaper) reap(now time.Time) {
+	pinged := make(map[Peer]time.Time)
+	for _, p := range r.h.Peers() {
+		idle := r.interval(p)
+		if idle <= 0 {
+			continue
+		}
+		c := p.ConnInfo()
+		if c == nil || c.traffic == nil {
+			continue
+		}
+		last := c.traffic.lastRead()
+		if now.Sub(last) < idle {
+			continue
+		}
+		t, ok := r.pinged[p]
+		if !ok || t.Before(last) {
+			if pp, ok := p.(pinger); ok {
+				_ = pp.ping()
+			}
+			cntReaperPings.Add(1)
+			pinged[p] = now
+			continue
+		}
+		if now.Sub(t) < r.conf.Grace {
+			pinged[p] = t
+			continue
+		}
+		cntReaperClosed.Add(1)
+		log.Printf("%s: idle for %v, disconnecting %q", p.RemoteAddr(), now.Sub(last), p.Name())
+		_ = p.Close()
+	}
+	r.pinged = pinged
+}
+
+func (r *idleReaper) run(closed <-chan struct{}) {
+	tick := r.conf.Grace
+	for _, d := range []time.Duration{r.conf.ADC, r.conf.NMDC, r.conf.IRC} {
+		if d > 0 && d < tick {
+			tick = d
+		}
+	}
+	ticker := time.NewTicker(tick / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case now := <-ticker.C:
+			r.reap(now)
+		}
+	}
+}
+
+// lastRead returns the time the last data was received from the connection.
+func (t *connTraffic) lastRead() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&t.last))
+}
+
+func (p *adcPeer) ping() error {
+	select {
+	case p.write.ping <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *nmdcPeer) ping() error {
+	select {
+	case p.write.ping <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *ircPeer) ping() error {
+	return p.writeMessage(&irc.Message{
+		Prefix:  p.hostPref,
+		Command: "PING",
+		Params:  []string{p.hostPref.Name},
+	})
+}
@@ -0,0 +1,48 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleReaper(t *testing.T) {
+	h, err := NewHub(Config{Reaper: ReaperConfig{
+		ADC:   time.Minute,
+		IRC:   time.Minute,
+		Grace: 10 * time.Second,
+	}})
+	require.NoError(t, err)
+	r := h.reaper
+	start := time.Now()
+
+	a := newTestADCPeer(t, h, "adc")
+	a.cinfo.traffic = &connTraffic{last: start.UnixNano()}
+	irc, buf := newTestIRCPeer(t, h, "irc")
+	irc.cinfo.traffic = &connTraffic{last: start.UnixNano()}
+	// virtual peers are never reaped
+	newTestADCPeer(t, h, "virtual")
+
+	r.reap(start.Add(30 * time.Second))
+	require.Len(t, a.write.ping, 0)
+	require.Empty(t, sentIRC(t, buf))
+
+	// idle peers receive a keepalive
+	r.reap(start.Add(61 * time.Second))
+	require.Len(t, a.write.ping, 1)
+	got := sentIRC(t, buf)
+	require.Len(t, got, 1)
+	require.Equal(t, "PING", got[0].Command)
+
+	// but only once
+	r.reap(start.Add(65 * time.Second))
+	require.Empty(t, sentIRC(t, buf))
+
+	// peers that don't respond are disconnected
+	irc.cinfo.traffic.last = start.Add(66 * time.Second).UnixNano()
+	r.reap(start.Add(72 * time.Second))
+	require.False(t, a.Online())
+	require.True(t, irc.Online())
+	require.NotNil(t, h.PeerByName("virtual"))
+}
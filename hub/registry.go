@@ -0,0 +1,248 @@
+package hub
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// peerShards is the number of shards in the peer index. Must be a power of 2.
+const peerShards = 64
+
+// peerIndex is a sharded index of online peers by name, SID and CID.
+//
+// Both lookups and registration only lock a single shard, thus routing of private messages,
+// connection requests and logins of other users are not blocked by peers joining or leaving the hub.
+// Names and CIDs of peers that are logging in are reserved in the same shards.
+type peerIndex struct {
+	size  int64 // atomic
+	names [peerShards]struct {
+		sync.RWMutex
+		m map[nameKey]Peer
+		// reserved names are temporarily bound by peers that are logging in
+		reserved map[nameKey]struct{}
+	}
+	sids [peerShards]struct {
+		sync.RWMutex
+		m map[SID]Peer
+	}
+	cids [peerShards]struct {
+		sync.RWMutex
+		m map[CID]*adcPeer
+		// reserved CIDs are temporarily bound by ADC peers that are logging in
+		reserved map[CID]struct{}
+	}
+}
+
+func (idx *peerIndex) init() {
+	for i := range idx.names {
+		idx.names[i].m = make(map[nameKey]Peer)
+		idx.names[i].reserved = make(map[nameKey]struct{})
+	}
+	for i := range idx.sids {
+		idx.sids[i].m = make(map[SID]Peer)
+	}
+	for i := range idx.cids {
+		idx.cids[i].m = make(map[CID]*adcPeer)
+		idx.cids[i].reserved = make(map[CID]struct{})
+	}
+}
+
+func nameShard(key nameKey) int {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h & (peerShards - 1))
+}
+
+func sidShard(sid SID) int {
+	// FNV-1a; SID characters are base32, thus a single one doesn't cover all shards
+	h := uint32(2166136261)
+	for i := 0; i < len(sid); i++ {
+		h ^= uint32(sid[i])
+		h *= 16777619
+	}
+	return int(h & (peerShards - 1))
+}
+
+func cidShard(cid CID) int {
+	// CIDs are hashes, thus the first byte is uniformly distributed
+	return int(cid[0] & (peerShards - 1))
+}
+
+// Len returns the number of peers in the index.
+func (idx *peerIndex) Len() int {
+	return int(atomic.LoadInt64(&idx.size))
+}
+
+// ByName finds a peer by the name key.
+func (idx *peerIndex) ByName(key nameKey) Peer {
+	s := &idx.names[nameShard(key)]
+	s.RLock()
+	p := s.m[key]
+	s.RUnlock()
+	return p
+}
+
+// BySID finds a peer by SID.
+func (idx *peerIndex) BySID(sid SID) Peer {
+	s := &idx.sids[sidShard(sid)]
+	s.RLock()
+	p := s.m[sid]
+	s.RUnlock()
+	return p
+}
+
+// NameAvailable checks if the name is not used or reserved. The callback, if set,
+// is executed under the read lock of the name shard.
+func (idx *peerIndex) NameAvailable(key nameKey, fnc func()) bool {
+	s := &idx.names[nameShard(key)]
+	s.RLock()
+	defer s.RUnlock()
+	_, reserved := s.reserved[key]
+	_, used := s.m[key]
+	if fnc != nil {
+		fnc()
+	}
+	return !reserved && !used
+}
+
+// Reserve binds the name if it's not used or reserved. The callback, if set, is executed under
+// the write lock of the name shard and may prevent the name from being bound by returning false.
+func (idx *peerIndex) Reserve(key nameKey, bind func() bool) bool {
+	s := &idx.names[nameShard(key)]
+	s.Lock()
+	defer s.Unlock()
+	_, reserved := s.reserved[key]
+	_, used := s.m[key]
+	if reserved || used {
+		return false
+	}
+	if bind != nil && !bind() {
+		return false
+	}
+	s.reserved[key] = struct{}{}
+	return true
+}
+
+// Unreserve releases the name bound by Reserve. The callback, if set,
+// is executed under the write lock of the name shard.
+func (idx *peerIndex) Unreserve(key nameKey, unbind func()) {
+	s := &idx.names[nameShard(key)]
+	s.Lock()
+	defer s.Unlock()
+	delete(s.reserved, key)
+	if unbind != nil {
+		unbind()
+	}
+}
+
+// Add adds the peer to the index and removes the reservation of its name.
+func (idx *peerIndex) Add(key nameKey, sid SID, p Peer) {
+	s := &idx.names[nameShard(key)]
+	s.Lock()
+	_, exists := s.m[key]
+	s.m[key] = p
+	delete(s.reserved, key)
+	s.Unlock()
+	if !exists {
+		atomic.AddInt64(&idx.size, 1)
+	}
+
+	s2 := &idx.sids[sidShard(sid)]
+	s2.Lock()
+	s2.m[sid] = p
+	s2.Unlock()
+}
+
+// Remove removes the peer from the index.
+func (idx *peerIndex) Remove(key nameKey, sid SID) {
+	s := &idx.names[nameShard(key)]
+	s.Lock()
+	_, exists := s.m[key]
+	delete(s.m, key)
+	s.Unlock()
+	if exists {
+		atomic.AddInt64(&idx.size, -1)
+	}
+
+	s2 := &idx.sids[sidShard(sid)]
+	s2.Lock()
+	delete(s2.m, sid)
+	s2.Unlock()
+}
+
+// CIDAvailable checks if the CID is not used or reserved.
+func (idx *peerIndex) CIDAvailable(cid CID) bool {
+	s := &idx.cids[cidShard(cid)]
+	s.RLock()
+	defer s.RUnlock()
+	_, reserved := s.reserved[cid]
+	_, used := s.m[cid]
+	return !reserved && !used
+}
+
+// ReserveCID binds the CID if it's not used or reserved.
+func (idx *peerIndex) ReserveCID(cid CID) bool {
+	s := &idx.cids[cidShard(cid)]
+	s.Lock()
+	defer s.Unlock()
+	_, reserved := s.reserved[cid]
+	_, used := s.m[cid]
+	if reserved || used {
+		return false
+	}
+	s.reserved[cid] = struct{}{}
+	return true
+}
+
+// UnreserveCID releases the CID bound by ReserveCID.
+func (idx *peerIndex) UnreserveCID(cid CID) {
+	s := &idx.cids[cidShard(cid)]
+	s.Lock()
+	delete(s.reserved, cid)
+	s.Unlock()
+}
+
+// ByCID finds an ADC peer by CID.
+func (idx *peerIndex) ByCID(cid CID) *adcPeer {
+	s := &idx.cids[cidShard(cid)]
+	s.RLock()
+	p := s.m[cid]
+	s.RUnlock()
+	return p
+}
+
+// AddCID adds the ADC peer to the CID index and removes the reservation of the CID.
+func (idx *peerIndex) AddCID(cid CID, p *adcPeer) {
+	s := &idx.cids[cidShard(cid)]
+	s.Lock()
+	s.m[cid] = p
+	delete(s.reserved, cid)
+	s.Unlock()
+}
+
+// RemoveCID removes the ADC peer from the CID index.
+func (idx *peerIndex) RemoveCID(cid CID) {
+	s := &idx.cids[cidShard(cid)]
+	s.Lock()
+	delete(s.m, cid)
+	s.Unlock()
+}
+
+// List returns all peers in the index.
+// Hub peers lock must be held to get a consistent list.
+func (idx *peerIndex) List() []Peer {
+	list := make([]Peer, 0, idx.Len())
+	for i := range idx.names {
+		s := &idx.names[i]
+		s.RLock()
+		for _, p := range s.m {
+			list = append(list, p)
+		}
+		s.RUnlock()
+	}
+	return list
+}
@@ -0,0 +1,101 @@
+package hub
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerIndex(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	var idx peerIndex
+	idx.init()
+
+	const n = 200
+	peers := make([]*adcPeer, n)
+	for i := range peers {
+		p := newTestADCPeer(t, h, "user"+strconv.Itoa(i))
+		peers[i] = p
+	}
+	var wg sync.WaitGroup
+	for _, p := range peers {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			idx.Add(h.toNameKey(p.Name()), p.SID(), p)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, n, idx.Len())
+	require.Len(t, idx.List(), n)
+
+	for _, p := range peers {
+		require.Equal(t, Peer(p), idx.ByName(h.toNameKey(p.Name())))
+		require.Equal(t, Peer(p), idx.BySID(p.SID()))
+	}
+
+	p := peers[0]
+	idx.Remove(h.toNameKey(p.Name()), p.SID())
+	require.Nil(t, idx.ByName(h.toNameKey(p.Name())))
+	require.Nil(t, idx.BySID(p.SID()))
+	require.Equal(t, n-1, idx.Len())
+
+	// removing it again doesn't change the size
+	idx.Remove(h.toNameKey(p.Name()), p.SID())
+	require.Equal(t, n-1, idx.Len())
+}
+
+func TestPeerIndexShards(t *testing.T) {
+	// all shards are used by sequentially allocated SIDs
+	used := make(map[int]struct{})
+	for i := uint32(0); i < 4*peerShards; i++ {
+		used[sidShard(sidFromInt(i))] = struct{}{}
+	}
+	require.Len(t, used, peerShards)
+}
+
+func TestPeerIndexReserve(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	var idx peerIndex
+	idx.init()
+	key := h.toNameKey("user")
+	cid := CID{1}
+
+	require.True(t, idx.NameAvailable(key, nil))
+	require.True(t, idx.Reserve(key, func() bool {
+		return idx.ReserveCID(cid)
+	}))
+	require.False(t, idx.NameAvailable(key, nil))
+	require.False(t, idx.Reserve(key, nil))
+	require.False(t, idx.CIDAvailable(cid))
+	require.False(t, idx.ReserveCID(cid))
+
+	// adding the peer replaces reservations
+	p := newTestADCPeer(t, h, "user")
+	idx.Add(key, p.SID(), p)
+	idx.AddCID(cid, p)
+	require.False(t, idx.NameAvailable(key, nil))
+	require.Equal(t, p, idx.ByCID(cid))
+
+	idx.Remove(key, p.SID())
+	idx.RemoveCID(cid)
+	require.True(t, idx.NameAvailable(key, nil))
+	require.True(t, idx.CIDAvailable(cid))
+	require.Nil(t, idx.ByCID(cid))
+
+	// a failed bind callback doesn't reserve the name
+	require.True(t, idx.ReserveCID(cid))
+	require.False(t, idx.Reserve(key, func() bool {
+		return idx.ReserveCID(cid)
+	}))
+	require.True(t, idx.NameAvailable(key, nil))
+	idx.UnreserveCID(cid)
+	require.True(t, idx.CIDAvailable(cid))
+}
@@ -31,14 +31,18 @@ func (r *rooms) init() {
 	r.bySID = make(map[SID]*Room)
 }
 
-func (h *Hub) newRoom(name string) *Room {
+func (h *Hub) newRoom(name string) (*Room, error) {
+	sid, err := h.nextSID()
+	if err != nil {
+		return nil, err
+	}
 	cntChatRooms.Add(1)
 	r := &Room{
-		h: h, name: name, sid: h.nextSID(),
+		h: h, name: name, sid: sid,
 		peers: make(map[Peer]struct{}),
 	}
 	r.log.limit = h.conf.ChatLog
-	return r
+	return r, nil
 }
 
 func (h *Hub) NewRoom(name string) (*Room, error) {
@@ -57,7 +61,11 @@ func (h *Hub) NewRoom(name string) (*Room, error) {
 		h.rooms.Unlock()
 		return nil, ErrRoomExists
 	}
-	r := h.newRoom(name)
+	r, err := h.newRoom(name)
+	if err != nil {
+		h.rooms.Unlock()
+		return nil, err
+	}
 	h.rooms.byName[name] = r
 	h.rooms.bySID[r.sid] = r
 	h.rooms.Unlock()
@@ -75,7 +83,7 @@ func (h *Hub) Room(name string) *Room {
 func (h *Hub) Rooms() []*Room {
 	h.rooms.RLock()
 	defer h.rooms.RUnlock()
-	list := make([]*Room, len(h.rooms.byName))
+	list := make([]*Room, 0, len(h.rooms.byName))
 	for _, r := range h.rooms.byName {
 		list = append(list, r)
 	}
@@ -99,6 +107,16 @@ type Room struct {
 
 	pmu   sync.RWMutex
 	peers map[Peer]struct{}
+
+	smu  sync.Mutex
+	subs map[chan Message]struct{}
+
+	slow slowMode
+
+	imu  sync.RWMutex
+	info *RoomInfo // nil for rooms that are not persistent
+
+	acl roomACL
 }
 
 func (r *Room) SID() SID {
@@ -157,16 +175,42 @@ func (r *Room) Leave(p Peer) {
 	}
 	r.pmu.Unlock()
 	if ok {
+		r.forgetSlowMode(p)
 		_ = p.LeaveRoom(r)
 	}
 }
 
 func (r *Room) SendChat(from Peer, m Message) {
+	r.sendChat(from, m, nil)
+}
+
+// sendChat is like SendChat, but only delivers the message to members that match the filter.
+// The sender always receives its own message. Nil filter matches all members.
+func (r *Room) sendChat(from Peer, m Message, match func(p Peer) bool) {
 	m.Time = time.Now().UTC()
 	if m.Name == "" {
 		m.Name = from.Name()
 	}
 
+	if err := r.h.checkRules(from); err != nil {
+		cntChatMsgDropped.Add(1)
+		_ = from.HubChatMsg(Message{Text: r.h.errText(from, err)})
+		return
+	}
+	if r.Info() != nil && PeerProtocol(from) != ProtoBot && !r.InRoom(from) {
+		cntChatMsgDropped.Add(1)
+		_ = from.HubChatMsg(Message{Text: r.h.errText(from, errRoomNotMember)})
+		return
+	}
+	if wait := r.checkSlowMode(from, m.Time); wait > 0 {
+		cntChatMsgDropped.Add(1)
+		wait = wait.Round(time.Second)
+		if wait < time.Second {
+			wait = time.Second
+		}
+		_ = from.HubChatMsg(Message{Text: r.h.text(from, TextSlowMode, textArgs{"Wait": wait})})
+		return
+	}
 	if r.h.globalChat == r {
 		if !r.h.callOnChat(from, m) {
 			cntChatMsgDropped.Add(1)
@@ -174,19 +218,84 @@ func (r *Room) SendChat(from Peer, m Message) {
 		}
 	}
 
+	if r.h.isGagged(from) {
+		// shadow mute: pretend that the message was sent
+		cntChatMsgDropped.Add(1)
+		for _, p := range r.Peers() {
+			if p != from && match != nil && !match(p) {
+				continue
+			}
+			if p == from || r.h.seesGagged(p) {
+				_ = p.ChatMsg(r, from, m)
+			}
+		}
+		return
+	}
+
 	cntChatMsg.Add(1)
+	r.h.stats.message()
 
 	if r.h.conf.ChatLog > 0 {
 		r.lmu.Lock()
 		r.log.Append(m)
 		r.lmu.Unlock()
 	}
+	r.h.notifyChat(r, m)
+	r.publish(m)
 
+	stamp := r.h.globalChat == r && r.h.chatTimestamps()
 	for _, p := range r.Peers() {
+		if p != from && match != nil && !match(p) {
+			continue
+		}
+		if stamp {
+			_ = p.ChatMsg(r, from, r.h.stampMsg(p, m))
+			continue
+		}
 		_ = p.ChatMsg(r, from, m)
 	}
 }
 
+// Log returns up to n last messages from the chat log of the room.
+func (r *Room) Log(n int) []Message {
+	r.lmu.RLock()
+	defer r.lmu.RUnlock()
+	return r.log.Get(n)
+}
+
+// Subscribe returns a feed of messages sent to the room. The returned function must be called
+// to stop the subscription. The channel is closed if the subscriber is too slow.
+func (r *Room) Subscribe(buf int) (<-chan Message, func()) {
+	ch := make(chan Message, buf)
+	r.smu.Lock()
+	if r.subs == nil {
+		r.subs = make(map[chan Message]struct{})
+	}
+	r.subs[ch] = struct{}{}
+	r.smu.Unlock()
+	return ch, func() {
+		r.smu.Lock()
+		defer r.smu.Unlock()
+		if _, ok := r.subs[ch]; ok {
+			delete(r.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (r *Room) publish(m Message) {
+	r.smu.Lock()
+	defer r.smu.Unlock()
+	for ch := range r.subs {
+		select {
+		case ch <- m:
+		default:
+			delete(r.subs, ch)
+			close(ch)
+		}
+	}
+}
+
 func (r *Room) ReplayChat(to Peer, n int) {
 	if r.h.conf.ChatLog <= 0 {
 		return
@@ -198,18 +307,17 @@ func (r *Room) ReplayChat(to Peer, n int) {
 
 	for _, m := range log {
 		// TODO: replay messages from peers themselves, if they are still online
+		ts := r.h.peerTime(to, m.Time).Format(chatTimeFormat)
 		var txt string
 		if m.Me {
 			txt = fmt.Sprintf(
 				"[%s] * %s %s",
-				m.Time.Format("15:04:05"),
-				m.Name, m.Text,
+				ts, m.Name, m.Text,
 			)
 		} else {
 			txt = fmt.Sprintf(
 				"[%s] <%s> %s",
-				m.Time.Format("15:04:05"),
-				m.Name, m.Text,
+				ts, m.Name, m.Text,
 			)
 		}
 		err := to.HubChatMsg(Message{Text: txt, Time: m.Time})
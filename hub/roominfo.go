@@ -0,0 +1,478 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PermRoomsAdmin allows managing all rooms, as if the user was the owner.
+const PermRoomsAdmin = "rooms.admin"
+
+// AuditRoom is recorded in the audit log when the configuration of a room is changed.
+const AuditRoom = "room"
+
+var (
+	errRoomInviteOnly = errors.New("room is invite-only")
+	errRoomPassword   = errors.New("wrong room password")
+	errRoomForbidden  = errors.New("you are not allowed to join this room")
+	errRoomNotMember  = errors.New("please join the room first")
+	errRoomNotOwner   = errors.New("only the owner of the room can do this")
+	errRoomNotMod     = errors.New("only moderators of the room can do this")
+	errRoomNoSupport  = errors.New("rooms are not supported by your client")
+)
+
+// RoomInfo is a persistent configuration of a chat room.
+type RoomInfo struct {
+	Name  string `json:"name"`
+	Topic string `json:"topic,omitempty"`
+	// Owner is the name of the registered user that created the room.
+	Owner      string   `json:"owner,omitempty"`
+	Moderators []string `json:"moderators,omitempty"`
+	// InviteOnly rooms can only be joined by members, moderators and the owner.
+	InviteOnly bool `json:"invite_only,omitempty"`
+	// Password must be provided to join the room. Members, moderators and the owner don't need it.
+	Password string `json:"password,omitempty"`
+	// Profiles restricts the room to users with given profiles. Empty list allows all users.
+	Profiles []string `json:"profiles,omitempty"`
+	// Members is a list of registered users that join the room automatically on login.
+	Members []string `json:"members,omitempty"`
+	// AutoJoin makes all registered users join the room on login, if they are allowed to.
+	AutoJoin bool `json:"auto_join,omitempty"`
+}
+
+func (r *RoomInfo) clone() *RoomInfo {
+	r2 := *r
+	r2.Moderators = append([]string(nil), r.Moderators...)
+	r2.Profiles = append([]string(nil), r.Profiles...)
+	r2.Members = append([]string(nil), r.Members...)
+	return &r2
+}
+
+type RoomDatabase interface {
+	// PutRoom creates or updates a persistent room.
+	PutRoom(r RoomInfo) error
+	// DelRoom removes a persistent room.
+	DelRoom(name string) error
+	// ListRooms returns all persistent rooms.
+	ListRooms() ([]RoomInfo, error)
+}
+
+// Room roles, in the order of privileges.
+const (
+	roomGuest = iota
+	roomMember
+	roomModerator
+	roomOwner
+)
+
+func containsName(list []string, name string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeName(list []string, name string) ([]string, bool) {
+	for i, s := range list {
+		if strings.EqualFold(s, name) {
+			return append(list[:i:i], list[i+1:]...), true
+		}
+	}
+	return list, false
+}
+
+// Info returns the persistent configuration of the room, or nil if the room is not persistent.
+func (r *Room) Info() *RoomInfo {
+	r.imu.RLock()
+	defer r.imu.RUnlock()
+	if r.info == nil {
+		return nil
+	}
+	return r.info.clone()
+}
+
+// Topic returns the topic of a persistent room.
+func (r *Room) Topic() string {
+	r.imu.RLock()
+	defer r.imu.RUnlock()
+	if r.info == nil {
+		return ""
+	}
+	return r.info.Topic
+}
+
+// role returns the role of the peer in the room. Only registered users can have roles.
+func (r *Room) role(p Peer) int {
+	u := p.User()
+	if u.HasPerm(PermRoomsAdmin) {
+		return roomOwner
+	}
+	r.imu.RLock()
+	defer r.imu.RUnlock()
+	if r.info == nil || !u.IsRegistered() {
+		return roomGuest
+	}
+	name := p.Name()
+	switch {
+	case strings.EqualFold(r.info.Owner, name):
+		return roomOwner
+	case containsName(r.info.Moderators, name):
+		return roomModerator
+	case containsName(r.info.Members, name):
+		return roomMember
+	}
+	return roomGuest
+}
+
+// checkRoomAccess checks if the peer is allowed to join the room with a given password.
+func (h *Hub) checkRoomAccess(p Peer, r *Room, pass string) error {
+	role := r.role(p)
+	if PeerProtocol(p) == ProtoBot || role >= roomModerator {
+		return nil
+	}
+	now := time.Now()
+	key := h.toNameKey(p.Name())
+	if r.isBanned(key, now) {
+		return errRoomBanned
+	}
+	if role >= roomMember || r.isInvited(key, now) {
+		return nil
+	}
+	info := r.Info()
+	if info == nil {
+		return nil
+	}
+	if len(info.Profiles) != 0 {
+		prof := p.User().Profile()
+		if prof == nil || !containsName(info.Profiles, prof.ID()) {
+			return errRoomForbidden
+		}
+	}
+	if info.InviteOnly {
+		return errRoomInviteOnly
+	}
+	if info.Password != "" && pass != info.Password {
+		return errRoomPassword
+	}
+	return nil
+}
+
+// JoinRoom adds the peer to the room with a given name, if the peer is allowed to join it.
+// Rooms that don't exist are created, but they are not persistent.
+func (h *Hub) JoinRoom(p Peer, name, pass string) (*Room, error) {
+	if !strings.HasPrefix(name, "#") {
+		return nil, errors.New("room name should start with '#'")
+	} else if !p.Capabilities().Has(CapRooms) {
+		return nil, errRoomNoSupport
+	}
+	r := h.Room(name)
+	if r == nil {
+		var err error
+		r, err = h.NewRoom(name)
+		if err == ErrRoomExists {
+			r = h.Room(name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := h.checkRoomAccess(p, r, pass); err != nil {
+		return nil, err
+	}
+	if r.InRoom(p) {
+		return r, nil
+	}
+	r.Join(p)
+	r.useInvite(h.toNameKey(p.Name()))
+	if topic := r.Topic(); topic != "" {
+		_ = p.ChatMsg(r, h.hubUser.p, h.topicMsg(p, topic))
+	}
+	return r, nil
+}
+
+// loadRooms creates persistent rooms stored in the database.
+func (h *Hub) loadRooms() error {
+	if h.db == nil {
+		return nil
+	}
+	list, err := h.db.ListRooms()
+	if err != nil {
+		return err
+	}
+	for _, info := range list {
+		r, err := h.NewRoom(info.Name)
+		if err == ErrRoomExists {
+			r = h.Room(info.Name)
+		} else if err != nil {
+			log.Printf("cannot create room %q: %v", info.Name, err)
+			continue
+		}
+		r.imu.Lock()
+		r.info = info.clone()
+		r.imu.Unlock()
+	}
+	if len(list) != 0 {
+		log.Printf("loaded %d rooms", len(list))
+	}
+	return nil
+}
+
+// autoJoinRooms joins a registered user to rooms where the user is a member, or that have auto-join enabled.
+func (h *Hub) autoJoinRooms(p Peer) {
+	if !p.User().IsRegistered() || !p.Capabilities().Has(CapRooms) {
+		return
+	}
+	for _, r := range h.Rooms() {
+		if r == nil {
+			continue
+		}
+		info := r.Info()
+		if info == nil {
+			continue
+		}
+		if !info.AutoJoin && r.role(p) < roomMember {
+			continue
+		}
+		if _, err := h.JoinRoom(p, r.Name(), info.Password); err != nil && err != errRoomInviteOnly {
+			log.Printf("%s: cannot auto-join %s: %v", p.Name(), r.Name(), err)
+		}
+	}
+}
+
+// CreateRoom creates a persistent room. Owner may be empty.
+func (h *Hub) CreateRoom(info RoomInfo) (*Room, error) {
+	if h.db == nil {
+		return nil, errors.New("persistent rooms require a database")
+	}
+	r, err := h.NewRoom(info.Name)
+	if err == ErrRoomExists {
+		r = h.Room(info.Name)
+		if r.Info() != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := h.db.PutRoom(info); err != nil {
+		return nil, err
+	}
+	r.imu.Lock()
+	r.info = info.clone()
+	r.imu.Unlock()
+	return r, nil
+}
+
+// UpdateRoom changes the configuration of a persistent room.
+func (h *Hub) UpdateRoom(r *Room, fnc func(info *RoomInfo) error) error {
+	r.imu.Lock()
+	defer r.imu.Unlock()
+	if r.info == nil {
+		return errors.New("room is not persistent: " + r.Name())
+	}
+	info := r.info.clone()
+	if err := fnc(info); err != nil {
+		return err
+	}
+	info.Name = r.Name()
+	if err := h.db.PutRoom(*info); err != nil {
+		return err
+	}
+	r.info = info
+	return nil
+}
+
+// DeleteRoom removes the persistent configuration of the room. Users stay in the room until they leave.
+func (h *Hub) DeleteRoom(r *Room) error {
+	r.imu.Lock()
+	defer r.imu.Unlock()
+	if r.info == nil {
+		return nil
+	}
+	if err := h.db.DelRoom(r.Name()); err != nil {
+		return err
+	}
+	r.info = nil
+	return nil
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+func (h *Hub) cmdRoom(p Peer, args string) error {
+	sub, args := cutReason(strings.TrimSpace(args))
+	name, arg := cutReason(args)
+	if !strings.HasPrefix(name, "#") {
+		return errors.New("usage: room create|info|topic|mod|unmod|member|unmember|kick|ban|unban|inviteonly|password|profiles|autojoin|delete <#room> [value]")
+	}
+	if sub == "create" {
+		if !p.User().IsRegistered() {
+			return errors.New("only registered users can create rooms")
+		}
+		r, err := h.CreateRoom(RoomInfo{Name: name, Owner: p.Name(), Topic: arg})
+		if err != nil {
+			return err
+		}
+		h.audit(AuditRoom, p, name, "create")
+		r.Join(p)
+		h.cmdOutput(p, "room created: "+name)
+		return nil
+	}
+	r := h.Room(name)
+	if r == nil {
+		return errors.New("no such room: " + name)
+	}
+	switch sub {
+	case "info":
+		return h.cmdRoomInfo(p, r)
+	case "kick":
+		return h.cmdRoomKick(p, r, arg)
+	case "ban":
+		return h.cmdRoomBan(p, r, arg)
+	case "unban":
+		return h.cmdRoomUnban(p, r, arg)
+	}
+	need := roomOwner
+	switch sub {
+	case "topic", "member", "unmember":
+		need = roomModerator
+	}
+	if role := r.role(p); role < need {
+		if need == roomOwner {
+			return errRoomNotOwner
+		}
+		return errRoomNotMod
+	}
+	if sub == "delete" {
+		if err := h.DeleteRoom(r); err != nil {
+			return err
+		}
+		h.audit(AuditRoom, p, name, "delete")
+		h.cmdOutput(p, "room is no longer persistent: "+name)
+		return nil
+	}
+	err := h.UpdateRoom(r, func(info *RoomInfo) error {
+		var ok bool
+		switch sub {
+		case "topic":
+			info.Topic = arg
+		case "mod":
+			if arg == "" {
+				return errors.New("user name must be set")
+			} else if !containsName(info.Moderators, arg) {
+				info.Moderators = append(info.Moderators, arg)
+			}
+		case "unmod":
+			if info.Moderators, ok = removeName(info.Moderators, arg); !ok {
+				return errors.New("not a moderator: " + arg)
+			}
+		case "member":
+			if arg == "" {
+				return errors.New("user name must be set")
+			} else if !containsName(info.Members, arg) {
+				info.Members = append(info.Members, arg)
+			}
+		case "unmember":
+			if info.Members, ok = removeName(info.Members, arg); !ok {
+				return errors.New("not a member: " + arg)
+			}
+		case "inviteonly":
+			v, err := parseOnOff(arg)
+			if err != nil {
+				return err
+			}
+			info.InviteOnly = v
+		case "autojoin":
+			v, err := parseOnOff(arg)
+			if err != nil {
+				return err
+			}
+			info.AutoJoin = v
+		case "password":
+			info.Password = arg
+		case "profiles":
+			info.Profiles = nil
+			for _, s := range strings.Split(arg, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					info.Profiles = append(info.Profiles, s)
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported room command: %q", sub)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	reason := sub
+	if sub != "password" && arg != "" {
+		reason += " " + arg
+	}
+	h.audit(AuditRoom, p, name, reason)
+	if sub == "topic" {
+		for _, p2 := range r.Peers() {
+			_ = p2.ChatMsg(r, h.hubUser.p, h.topicMsg(p2, arg))
+		}
+	}
+	h.cmdOutput(p, "room updated: "+name)
+	return nil
+}
+
+func (h *Hub) cmdRoomInfo(p Peer, r *Room) error {
+	info := r.Info()
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "room: %s\nusers: %d", r.Name(), r.Users())
+	if d := r.SlowMode(); d > 0 {
+		fmt.Fprintf(&buf, "\nslow mode: %s", d)
+	}
+	if info == nil {
+		buf.WriteString("\nnot persistent")
+		h.cmdOutput(p, buf.String())
+		return nil
+	}
+	if info.Topic != "" {
+		fmt.Fprintf(&buf, "\ntopic: %s", info.Topic)
+	}
+	if info.Owner != "" {
+		fmt.Fprintf(&buf, "\nowner: %s", info.Owner)
+	}
+	if len(info.Moderators) != 0 {
+		fmt.Fprintf(&buf, "\nmoderators: %s", strings.Join(info.Moderators, ", "))
+	}
+	var flags []string
+	if info.InviteOnly {
+		flags = append(flags, "invite-only")
+	}
+	if info.Password != "" {
+		flags = append(flags, "password")
+	}
+	if info.AutoJoin {
+		flags = append(flags, "auto-join")
+	}
+	if len(flags) != 0 {
+		fmt.Fprintf(&buf, "\naccess: %s", strings.Join(flags, ", "))
+	}
+	if len(info.Profiles) != 0 {
+		fmt.Fprintf(&buf, "\nprofiles: %s", strings.Join(info.Profiles, ", "))
+	}
+	if r.role(p) >= roomModerator && len(info.Members) != 0 {
+		members := append([]string(nil), info.Members...)
+		sort.Strings(members)
+		fmt.Fprintf(&buf, "\nmembers: %s", strings.Join(members, ", "))
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
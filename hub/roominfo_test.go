@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomAccess(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	db := NewDatabase()
+	h.SetDatabase(db)
+	require.NoError(t, h.loadProfiles())
+
+	owner := newTestADCPeer(t, h, "owner")
+	owner.setUser(&User{profile: h.Profile(ProfileNameRegistered)})
+	mod := newTestADCPeer(t, h, "mod")
+	mod.setUser(&User{profile: h.Profile(ProfileNameRegistered)})
+	guest := newTestADCPeer(t, h, "guest")
+
+	require.True(t, h.isCommand(owner, "!room create #dev development"))
+	r := h.Room("#dev")
+	require.NotNil(t, r)
+	require.True(t, r.InRoom(owner))
+	require.Equal(t, "development", r.Topic())
+
+	list, err := db.ListRooms()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "owner", list[0].Owner)
+
+	// only the owner can change access
+	sentADC(mod)
+	require.True(t, h.isCommand(mod, "!room inviteonly #dev on"))
+	require.Contains(t, lastChat(t, mod), "error")
+
+	require.True(t, h.isCommand(owner, "!room mod #dev mod"))
+	require.True(t, h.isCommand(owner, "!room inviteonly #dev on"))
+	require.True(t, r.Info().InviteOnly)
+
+	_, err = h.JoinRoom(guest, "#dev", "")
+	require.Equal(t, errRoomInviteOnly, err)
+	_, err = h.JoinRoom(mod, "#dev", "")
+	require.NoError(t, err)
+
+	// non-members cannot send messages
+	sentADC(mod)
+	r.SendChat(guest, Message{Text: "hi"})
+	require.Empty(t, sentADC(mod))
+
+	// moderators manage members
+	require.True(t, h.isCommand(mod, "!room member #dev guest"))
+	guest.setUser(&User{profile: h.Profile(ProfileNameRegistered)})
+	_, err = h.JoinRoom(guest, "#dev", "")
+	require.NoError(t, err)
+	r.Leave(guest)
+
+	require.True(t, h.isCommand(owner, "!room unmember #dev guest"))
+	require.True(t, h.isCommand(owner, "!room inviteonly #dev off"))
+	require.True(t, h.isCommand(owner, "!room password #dev secret"))
+	_, err = h.JoinRoom(guest, "#dev", "wrong")
+	require.Equal(t, errRoomPassword, err)
+	_, err = h.JoinRoom(guest, "#dev", "secret")
+	require.NoError(t, err)
+	r.Leave(guest)
+
+	require.True(t, h.isCommand(owner, "!room password #dev"))
+	require.True(t, h.isCommand(owner, "!room profiles #dev "+ProfileNameOperator))
+	_, err = h.JoinRoom(guest, "#dev", "")
+	require.Equal(t, errRoomForbidden, err)
+
+	// rooms are restored from the database
+	h2, err := NewHub(Config{})
+	require.NoError(t, err)
+	h2.SetDatabase(db)
+	require.NoError(t, h2.loadProfiles())
+	require.NoError(t, h2.loadRooms())
+	r2 := h2.Room("#dev")
+	require.NotNil(t, r2)
+	info := r2.Info()
+	require.Equal(t, []string{"mod"}, info.Moderators)
+	require.Equal(t, []string{ProfileNameOperator}, info.Profiles)
+
+	// registered users auto-join
+	require.True(t, h.isCommand(owner, "!room profiles #dev"))
+	require.True(t, h.isCommand(owner, "!room autojoin #dev on"))
+	user := newTestADCPeer(t, h, "user")
+	user.setUser(&User{profile: h.Profile(ProfileNameRegistered)})
+	h.autoJoinRooms(user)
+	require.True(t, r.InRoom(user))
+
+	require.True(t, h.isCommand(owner, "!room delete #dev"))
+	require.Nil(t, r.Info())
+	list, err = db.ListRooms()
+	require.NoError(t, err)
+	require.Empty(t, list)
+}
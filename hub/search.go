@@ -2,6 +2,7 @@ package hub
 
 import (
 	"context"
+	"time"
 
 	"github.com/direct-connect/go-dc/tiger"
 )
@@ -70,6 +71,10 @@ type FileSearch struct {
 	FileType FileType
 	MinSize  uint64
 	MaxSize  uint64
+	// MinDate and MaxDate limit the modification time of files. Zero means no limit.
+	// Only supported by ADC peers with ASCH extension.
+	MinDate time.Time
+	MaxDate time.Time
 }
 
 func (FileSearch) isSearchReq() {}
@@ -114,6 +119,10 @@ type File struct {
 	Path string
 	Size uint64
 	TTH  *TTH
+	// FreeSlots and TotalSlots are reported by the peer.
+	// Zero TotalSlots means that slots are unknown.
+	FreeSlots  int
+	TotalSlots int
 }
 
 func (f File) isSearchItem() {}
@@ -122,8 +131,10 @@ func (f File) From() Peer {
 }
 
 type Dir struct {
-	Peer Peer
-	Path string
+	Peer       Peer
+	Path       string
+	FreeSlots  int
+	TotalSlots int
 }
 
 func (f Dir) isSearchItem() {}
@@ -139,18 +150,39 @@ type Search interface {
 
 func (h *Hub) Search(req SearchRequest, s Search, peers []Peer) {
 	cntSearch.Add(1)
+	h.stats.search()
 	defer measure(durSearch)()
 
 	peer := s.Peer()
+	if err := h.checkRules(peer); err != nil {
+		return
+	} else if err = h.checkExtensions(peer); err != nil {
+		return
+	} else if !h.authzSearch(peer, req) {
+		return
+	}
+	if h.searchStats != nil {
+		h.searchStats.add(time.Now(), req)
+	}
 	if peers == nil {
 		peers = h.Peers()
 	}
 	// FIXME: should be bound to the close channel of the peer
 	ctx := context.TODO()
+	if h.searchSched != nil {
+		var targets []Peer
+		for _, p := range peers {
+			if p != peer && p.Capabilities().Has(CapSearch) {
+				targets = append(targets, p)
+			}
+		}
+		h.searchSched.schedule(ctx, req, s, targets)
+		return
+	}
 	for _, p := range peers {
 		if p == peer {
 			continue
-		} else if !p.Searchable() {
+		} else if !p.Capabilities().Has(CapSearch) {
 			continue
 		}
 		_ = p.Search(ctx, req, s)
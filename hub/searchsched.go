@@ -0,0 +1,218 @@
+package hub
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSearchBatch is the default number of searches delivered to peers in one time slice.
+	DefaultSearchBatch = 500
+	// DefaultSearchSlice is the default interval between batches of queued searches.
+	DefaultSearchSlice = 50 * time.Millisecond
+	// DefaultSearchQueue is the default limit of searches queued for a single peer.
+	DefaultSearchQueue = 16
+	// DefaultSearchBacklog is the default number of pending writes that delays searches to a peer.
+	DefaultSearchBacklog = 64
+)
+
+// SearchScheduleConfig configures the scheduler that spreads large search broadcasts over time.
+//
+// At most Batch searches are delivered to peers in each time slice. A search is sent immediately
+// while the budget of the current slice allows it, and the remaining peers receive it in
+// the following time slices. Searches are not sent to peers that have a backlog of other messages,
+// thus joins and chat messages are not delayed by search floods.
+type SearchScheduleConfig struct {
+	// Enabled turns on the scheduler. Otherwise, searches are sent to all peers at once.
+	Enabled bool
+	// Batch is the number of searches delivered to peers in one time slice.
+	// Zero value means DefaultSearchBatch.
+	Batch int
+	// Slice is the interval between batches. Zero value means DefaultSearchSlice.
+	Slice time.Duration
+	// MaxQueue is the limit of searches queued for a single peer. When it's exceeded,
+	// the oldest searches are dropped. Zero value means DefaultSearchQueue.
+	MaxQueue int
+	// Backlog is the number of messages waiting to be written to the peer that delays
+	// searches to it. Zero value means DefaultSearchBacklog.
+	Backlog int
+}
+
+// writeBacklog is implemented by peers that queue messages before writing them.
+type writeBacklog interface {
+	// pendingWrites returns the number of messages waiting to be written.
+	pendingWrites() int
+}
+
+type queuedSearch struct {
+	ctx  context.Context
+	req  SearchRequest
+	out  Search
+	time time.Time
+}
+
+type searchDelivery struct {
+	p Peer
+	queuedSearch
+}
+
+type searchScheduler struct {
+	conf SearchScheduleConfig
+
+	mu     sync.Mutex
+	queues map[Peer][]queuedSearch
+	// order of peers with queued searches; peers that waited longer are first
+	order []Peer
+	// sent is the number of searches delivered in the current time slice,
+	// both immediately and from the queues
+	sent int
+}
+
+func newSearchScheduler(conf SearchScheduleConfig) *searchScheduler {
+	if conf.Batch <= 0 {
+		conf.Batch = DefaultSearchBatch
+	}
+	if conf.Slice <= 0 {
+		conf.Slice = DefaultSearchSlice
+	}
+	if conf.MaxQueue <= 0 {
+		conf.MaxQueue = DefaultSearchQueue
+	}
+	if conf.Backlog <= 0 {
+		conf.Backlog = DefaultSearchBacklog
+	}
+	return &searchScheduler{
+		conf:   conf,
+		queues: make(map[Peer][]queuedSearch),
+	}
+}
+
+// busy checks if the peer has a backlog of other messages.
+func (s *searchScheduler) busy(p Peer) bool {
+	b, ok := p.(writeBacklog)
+	return ok && b.pendingWrites() > s.conf.Backlog
+}
+
+// schedule sends the search to peers while the budget of the current time slice allows it,
+// and queues it for the rest.
+func (s *searchScheduler) schedule(ctx context.Context, req SearchRequest, out Search, peers []Peer) {
+	qs := queuedSearch{ctx: ctx, req: req, out: out, time: time.Now()}
+	var now []Peer
+	s.mu.Lock()
+	for _, p := range peers {
+		// keep the order of searches if some are already queued for the peer
+		if s.sent < s.conf.Batch && len(s.queues[p]) == 0 && !s.busy(p) {
+			now = append(now, p)
+			s.sent++
+			continue
+		}
+		s.enqueue(p, qs)
+	}
+	s.mu.Unlock()
+	for _, p := range now {
+		_ = p.Search(ctx, req, out)
+	}
+}
+
+func (s *searchScheduler) enqueue(p Peer, qs queuedSearch) {
+	q, ok := s.queues[p]
+	if !ok {
+		s.order = append(s.order, p)
+	}
+	q = append(q, qs)
+	if n := len(q) - s.conf.MaxQueue; n > 0 {
+		cntSearchDropped.Add(float64(n))
+		q = q[n:]
+	}
+	s.queues[p] = q
+	cntSearchQueued.Add(1)
+}
+
+// next starts a new time slice and removes the next batch of searches from peer queues.
+// Searches that are older than searchTimeout are dropped, since the results would not
+// be relayed anyway.
+func (s *searchScheduler) next(now time.Time) []searchDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = 0
+	var (
+		send    []searchDelivery
+		waiting = make([]Peer, 0, len(s.order))
+		served  []Peer
+	)
+	for _, p := range s.order {
+		q := s.queues[p]
+		if !p.Online() {
+			cntSearchDropped.Add(float64(len(q)))
+			delete(s.queues, p)
+			continue
+		}
+		for len(q) != 0 && now.Sub(q[0].time) > searchTimeout {
+			cntSearchDropped.Add(1)
+			q = q[1:]
+		}
+		delivered := false
+		if len(q) != 0 && s.sent < s.conf.Batch && !s.busy(p) {
+			send = append(send, searchDelivery{p: p, queuedSearch: q[0]})
+			q = q[1:]
+			s.sent++
+			delivered = true
+		}
+		if len(q) == 0 {
+			delete(s.queues, p)
+			continue
+		}
+		s.queues[p] = q
+		if delivered {
+			served = append(served, p)
+		} else {
+			waiting = append(waiting, p)
+		}
+	}
+	s.order = append(waiting, served...)
+	return send
+}
+
+// tick delivers the next batch of queued searches.
+func (s *searchScheduler) tick(now time.Time) {
+	for _, d := range s.next(now) {
+		_ = d.p.Search(d.ctx, d.req, d.out)
+	}
+}
+
+// queued returns the number of searches queued for all peers.
+func (s *searchScheduler) queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (s *searchScheduler) run(closed <-chan struct{}) {
+	ticker := time.NewTicker(s.conf.Slice)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+func (p *adcPeer) pendingWrites() int {
+	p.write.Lock()
+	defer p.write.Unlock()
+	return len(p.write.buf)
+}
+
+func (p *nmdcPeer) pendingWrites() int {
+	p.write.Lock()
+	defer p.write.Unlock()
+	return len(p.write.buf)
+}
@@ -0,0 +1,105 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// sentSearches returns the number of search requests buffered for the peer and clears the buffer.
+func sentSearches(p *adcPeer) int {
+	n := 0
+	for _, m := range sentADC(p) {
+		if m.Message().Cmd() == (adc.SearchRequest{}).Cmd() {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSearchScheduler(t *testing.T) {
+	h, err := NewHub(Config{SearchSchedule: SearchScheduleConfig{
+		Enabled:  true,
+		Batch:    2,
+		MaxQueue: 2,
+		Backlog:  1,
+	}})
+	require.NoError(t, err)
+	sched := h.searchSched
+
+	from := newTestADCPeer(t, h, "from")
+	var (
+		peers   []Peer
+		targets []*adcPeer
+	)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		p := newTestADCPeer(t, h, name)
+		peers = append(peers, p)
+		targets = append(targets, p)
+	}
+	a := targets[0]
+	search := func() {
+		h.Search(TTHSearch{}, from.newSearch("tok"), append([]Peer{from}, peers...))
+	}
+	sent := func() []int {
+		var out []int
+		for _, p := range targets {
+			out = append(out, sentSearches(p))
+		}
+		return out
+	}
+
+	// the first batch is sent immediately, the rest in the next time slice
+	search()
+	require.Equal(t, []int{1, 1, 0, 0}, sent())
+	require.Equal(t, 2, sched.queued())
+	sched.tick(time.Now())
+	require.Equal(t, []int{0, 0, 1, 1}, sent())
+	require.Equal(t, 0, sched.queued())
+
+	// immediate sends share the budget of the time slice with the queued ones
+	search()
+	require.Equal(t, []int{0, 0, 0, 0}, sent())
+	require.Equal(t, 4, sched.queued())
+	sched.tick(time.Now())
+	require.Equal(t, []int{1, 1, 0, 0}, sent())
+	sched.tick(time.Now())
+	require.Equal(t, []int{0, 0, 1, 1}, sent())
+	require.Equal(t, 0, sched.queued())
+	// start a new time slice
+	sched.tick(time.Now())
+
+	// searches wait until other messages are written to the peer
+	require.NoError(t, a.SendADCInfo(&adc.ChatMessage{Text: "one"}))
+	require.NoError(t, a.SendADCInfo(&adc.ChatMessage{Text: "two"}))
+	search()
+	sched.tick(time.Now())
+	require.Equal(t, 1, sched.queued())
+	require.Equal(t, []int{0, 1, 1, 1}, sent())
+	sched.tick(time.Now())
+	require.Equal(t, []int{1, 0, 0, 0}, sent())
+
+	// stale searches are dropped when the queue is full
+	require.NoError(t, a.SendADCInfo(&adc.ChatMessage{Text: "one"}))
+	require.NoError(t, a.SendADCInfo(&adc.ChatMessage{Text: "two"}))
+	others := make([]int, 3)
+	for i := 0; i < 3; i++ {
+		search()
+		sched.tick(time.Now())
+		sched.tick(time.Now())
+		for j, p := range targets[1:] {
+			others[j] += sentSearches(p)
+		}
+	}
+	require.Equal(t, 2, len(sched.queues[a]))
+	require.Equal(t, []int{3, 3, 3}, others)
+
+	// and when they are too old to receive results
+	sentADC(a)
+	sched.tick(time.Now().Add(2 * searchTimeout))
+	require.Equal(t, 0, sched.queued())
+	require.Equal(t, []int{0, 0, 0, 0}, sent())
+}
@@ -0,0 +1,206 @@
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PermSearchStats allows reading search statistics.
+const PermSearchStats = "stats.search"
+
+const (
+	// DefaultSearchStatsRetention is the default time search statistics are kept.
+	DefaultSearchStatsRetention = 24 * time.Hour
+	// DefaultSearchStatsTerms is the default limit of distinct terms tracked per minute.
+	DefaultSearchStatsTerms = 1000
+
+	searchStatsBucket = time.Minute
+)
+
+// SearchStatsConfig configures collection of search statistics.
+//
+// Statistics are anonymized: only counters and search terms are kept, without any
+// information about users that searched for them.
+type SearchStatsConfig struct {
+	// Enabled turns on collection of search statistics.
+	Enabled bool
+	// Retention is the time search statistics are kept.
+	// Zero value means DefaultSearchStatsRetention.
+	Retention time.Duration
+	// MaxTerms limits the number of distinct terms tracked per minute.
+	// Zero value means DefaultSearchStatsTerms.
+	MaxTerms int
+}
+
+// SearchStats is a summary of searches over a period of time.
+type SearchStats struct {
+	Since     time.Time    `json:"since"`
+	Total     uint64       `json:"total"`
+	TTH       uint64       `json:"tth"`
+	Text      uint64       `json:"text"`
+	TTHRatio  float64      `json:"tth_ratio"`
+	PerMinute float64      `json:"per_minute"`
+	Top       []SearchTerm `json:"top,omitempty"`
+}
+
+// SearchTerm is a search term and the number of searches that contained it.
+type SearchTerm struct {
+	Term  string `json:"term"`
+	Count uint64 `json:"count"`
+}
+
+type searchBucket struct {
+	start time.Time
+	tth   uint64
+	text  uint64
+	terms map[string]uint64
+}
+
+type searchStats struct {
+	retention time.Duration
+	maxTerms  int
+
+	mu      sync.Mutex
+	buckets []*searchBucket // oldest first
+}
+
+func newSearchStats(conf SearchStatsConfig) *searchStats {
+	s := &searchStats{
+		retention: conf.Retention,
+		maxTerms:  conf.MaxTerms,
+	}
+	if s.retention <= 0 {
+		s.retention = DefaultSearchStatsRetention
+	}
+	if s.maxTerms <= 0 {
+		s.maxTerms = DefaultSearchStatsTerms
+	}
+	return s
+}
+
+// expire removes buckets that are older than the retention period. Must be called with the lock held.
+func (s *searchStats) expire(now time.Time) {
+	cut := now.Add(-s.retention)
+	i := 0
+	for i < len(s.buckets) && !s.buckets[i].start.After(cut) {
+		i++
+	}
+	if i != 0 {
+		n := copy(s.buckets, s.buckets[i:])
+		for j := n; j < len(s.buckets); j++ {
+			s.buckets[j] = nil
+		}
+		s.buckets = s.buckets[:n]
+	}
+}
+
+func (s *searchStats) add(now time.Time, req SearchRequest) {
+	start := now.Truncate(searchStatsBucket)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	var b *searchBucket
+	if n := len(s.buckets); n != 0 && s.buckets[n-1].start.Equal(start) {
+		b = s.buckets[n-1]
+	} else {
+		b = &searchBucket{start: start, terms: make(map[string]uint64)}
+		s.buckets = append(s.buckets, b)
+	}
+	switch req := req.(type) {
+	case TTHSearch:
+		b.tth++
+	case NameSearch:
+		b.text++
+		for _, t := range req.And {
+			t = strings.ToLower(t)
+			if _, ok := b.terms[t]; ok || len(b.terms) < s.maxTerms {
+				b.terms[t]++
+			}
+		}
+	}
+}
+
+// report aggregates statistics for a given period and returns top N search terms.
+func (s *searchStats) report(now time.Time, period time.Duration, top int) SearchStats {
+	since := now.Add(-period)
+	terms := make(map[string]uint64)
+	var st SearchStats
+
+	s.mu.Lock()
+	s.expire(now)
+	for _, b := range s.buckets {
+		if b.start.Before(since.Truncate(searchStatsBucket)) {
+			continue
+		}
+		if st.Since.IsZero() {
+			st.Since = b.start
+		}
+		st.TTH += b.tth
+		st.Text += b.text
+		for t, n := range b.terms {
+			terms[t] += n
+		}
+	}
+	s.mu.Unlock()
+
+	st.Total = st.TTH + st.Text
+	if st.Total == 0 {
+		return st
+	}
+	st.TTHRatio = float64(st.TTH) / float64(st.Total)
+	if min := now.Sub(st.Since).Minutes(); min >= 1 {
+		st.PerMinute = float64(st.Total) / min
+	} else {
+		st.PerMinute = float64(st.Total)
+	}
+	for t, n := range terms {
+		st.Top = append(st.Top, SearchTerm{Term: t, Count: n})
+	}
+	sort.Slice(st.Top, func(i, j int) bool {
+		a, b := st.Top[i], st.Top[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Term < b.Term
+	})
+	if top >= 0 && len(st.Top) > top {
+		st.Top = st.Top[:top]
+	}
+	return st
+}
+
+// SearchStats returns search statistics for a given period and top N search terms.
+// It returns false if collection of search statistics is disabled.
+func (h *Hub) SearchStats(period time.Duration, top int) (SearchStats, bool) {
+	if h.searchStats == nil {
+		return SearchStats{}, false
+	}
+	return h.searchStats.report(time.Now(), period, top), true
+}
+
+func (h *Hub) cmdSearchStats(p Peer, args RawCmd) error {
+	period := time.Hour
+	if args != "" {
+		d, err := time.ParseDuration(string(args))
+		if err != nil {
+			return err
+		}
+		period = d
+	}
+	st, ok := h.SearchStats(period, 10)
+	if !ok {
+		return fmt.Errorf("search statistics are disabled")
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "searches for the last %v: %d (%.1f per minute), TTH: %d (%.0f%%), text: %d",
+		period, st.Total, st.PerMinute, st.TTH, st.TTHRatio*100, st.Text)
+	for i, t := range st.Top {
+		fmt.Fprintf(&buf, "\n%d. %s - %d", i+1, t.Term, t.Count)
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
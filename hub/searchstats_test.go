@@ -0,0 +1,55 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchStats(t *testing.T) {
+	s := newSearchStats(SearchStatsConfig{Retention: time.Hour, MaxTerms: 3})
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	s.add(now.Add(-2*time.Hour), NameSearch{And: []string{"expired"}})
+	s.add(now.Add(-30*time.Minute), TTHSearch{})
+	s.add(now.Add(-30*time.Minute), NameSearch{And: []string{"Linux", "iso"}})
+	s.add(now.Add(-time.Minute), NameSearch{And: []string{"linux", "a", "b", "c"}})
+	s.add(now, TTHSearch{})
+
+	st := s.report(now, time.Hour, 10)
+	require.Equal(t, uint64(4), st.Total)
+	require.Equal(t, uint64(2), st.TTH)
+	require.Equal(t, uint64(2), st.Text)
+	require.Equal(t, 0.5, st.TTHRatio)
+	require.Equal(t, now.Add(-30*time.Minute), st.Since)
+	require.InDelta(t, 4.0/30, st.PerMinute, 1e-9)
+	// the last bucket only tracked 3 distinct terms
+	require.Equal(t, []SearchTerm{
+		{Term: "linux", Count: 2},
+		{Term: "a", Count: 1},
+		{Term: "b", Count: 1},
+		{Term: "iso", Count: 1},
+	}, st.Top)
+
+	st = s.report(now, 5*time.Minute, 1)
+	require.Equal(t, uint64(2), st.Total)
+	require.Equal(t, []SearchTerm{{Term: "a", Count: 1}}, st.Top) // ties are sorted by name
+
+	// expired buckets are removed
+	st = s.report(now.Add(2*time.Hour), 3*time.Hour, 10)
+	require.Equal(t, uint64(0), st.Total)
+	require.Empty(t, s.buckets)
+}
+
+func TestSearchStatsDisabled(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	_, ok := h.SearchStats(time.Hour, 10)
+	require.False(t, ok)
+
+	h, err = NewHub(Config{SearchStats: SearchStatsConfig{Enabled: true}})
+	require.NoError(t, err)
+	_, ok = h.SearchStats(time.Hour, 10)
+	require.True(t, ok)
+}
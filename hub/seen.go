@@ -0,0 +1,128 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LoginHistorySize is the number of login records kept for each registered user.
+const LoginHistorySize = 10
+
+// LoginRecord is an entry in the login history of a registered user.
+type LoginRecord struct {
+	Name string
+	// Login is the time of the login. Together with the name it identifies the record.
+	Login time.Time
+	// Logout is the time of the logout. It is zero if the user is still online.
+	Logout time.Time
+	IP     string
+	// CID of the user. Empty for NMDC users.
+	CID string
+}
+
+type LoginDatabase interface {
+	// PutLogin creates or updates a login record. Only LoginHistorySize of the most recent
+	// records are kept for each user.
+	PutLogin(rec LoginRecord) error
+	// ListLogins returns the login history of the user, starting from the most recent login.
+	ListLogins(name string) ([]LoginRecord, error)
+}
+
+// loginRecord returns a login record for the current session of the peer.
+func (h *Hub) loginRecord(peer Peer) LoginRecord {
+	rec := LoginRecord{
+		Name:  peer.Name(),
+		Login: peer.base().login,
+		IP:    addrString(peer.RemoteAddr()),
+	}
+	if cid := peer.CID(); !cid.IsZero() {
+		rec.CID = cid.String()
+	}
+	return rec
+}
+
+// userLoggedIn records the login time of a registered user.
+func (h *Hub) userLoggedIn(peer Peer) {
+	now := time.Now().UTC()
+	name := peer.Name()
+	err := h.UpdateUser(name, func(u *UserRecord) (bool, error) {
+		u.LastLogin = now
+		return true, nil
+	})
+	if err != nil && err != ErrUserNotFound && err != ErrUserRegDisabled {
+		h.hubError("cannot save login time of %q: %v", name, err)
+	}
+	peer.base().login = now
+	if h.db == nil {
+		return
+	}
+	if err = h.db.PutLogin(h.loginRecord(peer)); err != nil {
+		h.hubError("cannot save login of %q: %v", name, err)
+	}
+}
+
+// userLoggedOut records the logout time of a registered user.
+func (h *Hub) userLoggedOut(peer Peer) {
+	if h.db == nil || peer.base().login.IsZero() {
+		return
+	}
+	rec := h.loginRecord(peer)
+	rec.Logout = time.Now().UTC()
+	if err := h.db.PutLogin(rec); err != nil {
+		h.hubError("cannot save logout of %q: %v", rec.Name, err)
+	}
+}
+
+func (h *Hub) loginHistory(name string) ([]LoginRecord, error) {
+	if h.db == nil {
+		return nil, ErrUserRegDisabled
+	}
+	return h.db.ListLogins(name)
+}
+
+func (h *Hub) cmdSeen(p Peer, name string) error {
+	if h.PeerByName(name) != nil {
+		h.cmdOutputf(p, "%s is online", name)
+		return nil
+	}
+	list, err := h.loginHistory(name)
+	if err != nil {
+		return err
+	} else if len(list) == 0 {
+		h.cmdOutputf(p, "%s was not seen", name)
+		return nil
+	}
+	last := list[0].Logout
+	if last.IsZero() {
+		// the hub was not shut down properly
+		last = list[0].Login
+	}
+	h.cmdOutputf(p, "%s was last seen %s ago, at %s",
+		name, time.Since(last).Truncate(time.Second), last.Format(time.RFC1123))
+	return nil
+}
+
+func (h *Hub) cmdTrace(p Peer, name string) error {
+	list, err := h.loginHistory(name)
+	if err != nil {
+		return err
+	} else if len(list) == 0 {
+		return errors.New("no login history for " + name)
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "login history of %s:", name)
+	for _, r := range list {
+		logout := "online"
+		if !r.Logout.IsZero() {
+			logout = r.Logout.Format(time.RFC1123)
+		}
+		fmt.Fprintf(&buf, "\n%s - %s, IP: %s", r.Login.Format(time.RFC1123), logout, r.IP)
+		if r.CID != "" {
+			fmt.Fprintf(&buf, ", CID: %s", r.CID)
+		}
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
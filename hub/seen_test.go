@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lastChat returns a text of the last chat message sent to the peer, in the ADC encoding.
+func lastChat(t testing.TB, p *adcPeer) string {
+	got := sentADC(p)
+	require.NotEmpty(t, got)
+	return string(got[len(got)-1].Message().Data)
+}
+
+func TestSeen(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.RegisterUser("user", "secret"))
+
+	p := newSecureTestPeer(t, h, "user")
+	u, _, err := h.getUser("user")
+	require.NoError(t, err)
+	p.setUser(u)
+	h.userLoggedIn(p)
+
+	other := newTestADCPeer(t, h, "other")
+	sentADC(other)
+
+	require.True(t, h.isCommand(other, "!seen user"))
+	require.Contains(t, lastChat(t, other), `user\sis\sonline`)
+
+	list, err := h.loginHistory("user")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.True(t, list[0].Logout.IsZero())
+	require.Equal(t, "127.0.0.1", list[0].IP)
+
+	require.NoError(t, p.Close())
+	list, err = h.loginHistory("user")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.False(t, list[0].Logout.IsZero())
+
+	require.True(t, h.isCommand(other, "!seen user"))
+	require.Contains(t, lastChat(t, other), `user\swas\slast\sseen`)
+
+	require.True(t, h.isCommand(other, "!seen nobody"))
+	require.Contains(t, lastChat(t, other), `nobody\swas\snot\sseen`)
+
+	// trace is only available to operators
+	require.True(t, h.isCommand(other, "!trace user"))
+	require.Contains(t, lastChat(t, other), "unsupported")
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	sentADC(op)
+	require.True(t, h.isCommand(op, "!trace user"))
+	require.Contains(t, lastChat(t, op), "127.0.0.1")
+}
@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	dc "github.com/direct-connect/go-dc"
+)
+
+// HTTPServicesPathV0 lists (GET), creates (POST) or removes (DELETE) service users.
+const HTTPServicesPathV0 = "/api/v0/services"
+
+const (
+	// ServiceBot is a kind of service users that are shown as bots.
+	ServiceBot = "bot"
+	// ServiceHub is a kind of service users that are shown as the hub itself.
+	ServiceHub = "hub"
+)
+
+// ServiceUser is a virtual user that is not backed by a connection, for example a monitoring bot
+// or a placeholder for a user of a bridged network.
+type ServiceUser struct {
+	Name  string `json:"name"`
+	Desc  string `json:"desc,omitempty"`
+	Email string `json:"email,omitempty"`
+	// Kind of the user, either ServiceBot (default) or ServiceHub.
+	Kind string `json:"kind,omitempty"`
+}
+
+func (s ServiceUser) userKind() (UserKind, error) {
+	switch s.Kind {
+	case "", ServiceBot:
+		return UserBot, nil
+	case ServiceHub:
+		return UserHub, nil
+	}
+	return 0, fmt.Errorf("unsupported service kind: %q", s.Kind)
+}
+
+type serviceUsers struct {
+	sync.RWMutex
+	byName map[string]*serviceUser
+}
+
+type serviceUser struct {
+	ServiceUser
+	bot *Bot
+}
+
+// AddService adds a virtual user to the hub. It is visible in the user list of all clients
+// with a user type that corresponds to its kind, until it is removed with RemoveService.
+func (h *Hub) AddService(s ServiceUser) (*Bot, error) {
+	kind, err := s.userKind()
+	if err != nil {
+		return nil, err
+	}
+	if s.Kind == "" {
+		s.Kind = ServiceBot
+	}
+	bot, err := h.newBot(s.Name, s.Desc, s.Email, kind, dc.Software{})
+	if err != nil {
+		return nil, err
+	}
+	h.services.Lock()
+	if h.services.byName == nil {
+		h.services.byName = make(map[string]*serviceUser)
+	}
+	h.services.byName[s.Name] = &serviceUser{ServiceUser: s, bot: bot}
+	h.services.Unlock()
+	return bot, nil
+}
+
+// RemoveService removes the service user added with AddService.
+func (h *Hub) RemoveService(name string) error {
+	h.services.Lock()
+	s := h.services.byName[name]
+	delete(h.services.byName, name)
+	h.services.Unlock()
+	if s == nil {
+		return ErrUserNotFound
+	}
+	return s.bot.Close()
+}
+
+// Services returns all service users, sorted by name.
+func (h *Hub) Services() []ServiceUser {
+	h.services.RLock()
+	list := make([]ServiceUser, 0, len(h.services.byName))
+	for _, s := range h.services.byName {
+		list = append(list, s.ServiceUser)
+	}
+	h.services.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// serveV0Services manages service users. GET returns all service users, POST creates one from the JSON body,
+// and DELETE removes the user with a given "name".
+func (h *Hub) serveV0Services(w http.ResponseWriter, r *http.Request) {
+	if !h.httpAdmin(w, r) {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		hd := w.Header()
+		hd.Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Services())
+	case "POST":
+		var s ServiceUser
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, err := h.AddService(s)
+		if err == errNickTaken {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		err := h.RemoveService(r.URL.Query().Get("name"))
+		if err == ErrUserNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
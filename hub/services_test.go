@@ -0,0 +1,100 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestServiceUsers(t *testing.T) {
+	h, err := NewHub(Config{APIToken: "secret"})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	a := newTestADCPeer(t, h, "adc")
+	login := nmdcLogin{
+		supports: "$Supports NoGetINFO NoHello BotList |",
+		tag:      loginDCPP.tag,
+	}
+	nmdc := loginNMDC(t, h, 1, "nmdc", login)
+	nmdc.expect("Supports")
+	nmdc.join(login)
+	nmdc.expect("OpList")
+	_, buf := newTestIRCPeer(t, h, "irc")
+	sentADC(a)
+
+	_, err = h.AddService(ServiceUser{Name: "monitor", Kind: "unknown"})
+	require.Error(t, err)
+	_, err = h.AddService(ServiceUser{Name: "monitor", Desc: "Uptime monitor", Kind: ServiceHub})
+	require.NoError(t, err)
+	svc := h.PeerByName("monitor")
+	require.NotNil(t, svc)
+
+	// ADC clients see the user type
+	var u adc.User
+	for _, p := range sentADC(a) {
+		if b, ok := p.(*adc.BroadcastPacket); ok && b.Name == (adc.User{}).Cmd() && b.ID == svc.SID() {
+			require.NoError(t, adc.Unmarshal(b.Data, &u))
+		}
+	}
+	require.Equal(t, "monitor", u.Name)
+	require.Equal(t, adc.UserTypeHub, u.Type)
+
+	// NMDC clients see the user as a bot
+	require.Equal(t, "monitor", myINFOName(nmdc.expect("MyINFO")))
+	bots, ok := nmdc.expect("BotList").(*nmdcp.BotList)
+	require.True(t, ok)
+	require.Contains(t, []string(bots.Names), "monitor")
+
+	// IRC clients see the bot flag
+	sentIRC(t, buf)
+	require.NoError(t, h.ircWho(h.PeerByName("irc").(*ircPeer), "monitor"))
+	who := sentIRC(t, buf)
+	require.Equal(t, "352", who[0].Command)
+	require.True(t, strings.HasSuffix(who[0].Params[6], "B"), who[0].Params[6])
+
+	r := httptest.NewRequest("POST", HTTPServicesPathV0, strings.NewReader(`{"name":"monitor"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.serveV0Services(w, r)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	r = httptest.NewRequest("POST", HTTPServicesPathV0, strings.NewReader(`{"name":"relay"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.serveV0Services(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, []ServiceUser{
+		{Name: "monitor", Desc: "Uptime monitor", Kind: ServiceHub},
+		{Name: "relay", Kind: ServiceBot},
+	}, h.Services())
+
+	sentADC(a)
+	r = httptest.NewRequest("DELETE", HTTPServicesPathV0+"?name=monitor", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.serveV0Services(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Nil(t, h.PeerByName("monitor"))
+	require.Len(t, h.Services(), 1)
+
+	var quit bool
+	for _, p := range sentADC(a) {
+		if p, ok := p.(*adc.InfoPacket); ok && p.Name == (adc.Disconnect{}).Cmd() {
+			quit = true
+		}
+	}
+	require.True(t, quit)
+	quitMsg, ok := nmdc.expect("Quit").(*nmdcp.Quit)
+	require.True(t, ok)
+	require.Equal(t, "monitor", string(quitMsg.Name))
+
+	require.Equal(t, ErrUserNotFound, h.RemoveService("monitor"))
+}
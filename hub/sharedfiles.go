@@ -0,0 +1,567 @@
+package hub
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/direct-connect/go-dcpp/filelist"
+)
+
+const (
+	// DefaultSharedFilesMax is the default limit of entries in a single uploaded file list.
+	DefaultSharedFilesMax = 500000
+	// DefaultSharedListSize is the default limit of the uploaded file list size.
+	DefaultSharedListSize = 64 * 1024 * 1024
+	// DefaultSharedResults is the default number of results returned by the shared files search.
+	DefaultSharedResults = 20
+)
+
+const (
+	// HTTPFileListPathV0 accepts file lists uploaded by users that opted in to the shared files index.
+	HTTPFileListPathV0 = "/api/v0/filelist"
+	// HTTPFilesPathV0 searches the shared files index.
+	HTTPFilesPathV0 = "/api/v0/files.json"
+	// HTTPFilesPath is a web page for searching the shared files index.
+	HTTPFilesPath = "/files"
+)
+
+var (
+	errSharedFilesDisabled = errors.New("shared files index is disabled")
+	errSharedFilesToken    = errors.New("invalid file list token")
+	errSharedFilesBase     = errors.New("base directory of a partial list is not found; upload the full list first")
+)
+
+// SharedFilesConfig configures the hub-wide index of shared files.
+//
+// Users opt in with the "sharefiles" command, which gives them a token for uploading
+// their file lists over HTTP. Lists are only kept while users are online.
+type SharedFilesConfig struct {
+	// Enabled turns on the shared files index.
+	Enabled bool
+	// MaxFiles limits the number of files and directories in the list of a single user.
+	// Zero value means DefaultSharedFilesMax.
+	MaxFiles int
+	// MaxListSize limits the size of an uploaded file list in bytes, before decompression.
+	// Zero value means DefaultSharedListSize.
+	MaxListSize int64
+}
+
+// SharedFilesStats reports the state of the shared files index.
+type SharedFilesStats struct {
+	Users int   `json:"users"`
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+}
+
+type sharedEntry struct {
+	path  string // full path, directories end with a slash
+	lower string // lowercase path for matching
+	name  string
+	dir   bool
+	size  int64
+	tth   TTH
+	end   int32 // the end of the directory range, exclusive
+}
+
+// sharedList is a file list uploaded by a single user.
+//
+// Entries are stored in depth-first order, so each directory and its contents
+// occupy a continuous range of entry IDs.
+type sharedList struct {
+	peer    Peer
+	token   string
+	list    *filelist.FileList // nil until the first upload
+	updated time.Time
+
+	entries []sharedEntry
+	terms   map[string][]int32 // name token -> entry IDs
+	files   int
+	size    int64
+}
+
+type sharedFiles struct {
+	conf SharedFilesConfig
+
+	mu      sync.RWMutex
+	byPeer  map[Peer]*sharedList
+	byToken map[string]*sharedList
+}
+
+func newSharedFiles(conf SharedFilesConfig) *sharedFiles {
+	if conf.MaxFiles <= 0 {
+		conf.MaxFiles = DefaultSharedFilesMax
+	}
+	if conf.MaxListSize <= 0 {
+		conf.MaxListSize = DefaultSharedListSize
+	}
+	return &sharedFiles{
+		conf:    conf,
+		byPeer:  make(map[Peer]*sharedList),
+		byToken: make(map[string]*sharedList),
+	}
+}
+
+// optIn returns an upload token for the peer, creating it if necessary.
+func (s *sharedFiles) optIn(p Peer) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.byPeer[p]; l != nil {
+		return l.token, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	l := &sharedList{peer: p, token: hex.EncodeToString(b[:])}
+	s.byPeer[p] = l
+	s.byToken[l.token] = l
+	return l.token, nil
+}
+
+// optOut removes the list and the upload token of the peer.
+func (s *sharedFiles) optOut(p Peer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.byPeer[p]
+	if l == nil {
+		return false
+	}
+	delete(s.byPeer, p)
+	delete(s.byToken, l.token)
+	return true
+}
+
+// clear removes the list, but keeps the upload token.
+func (s *sharedFiles) clear(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.byToken[token]
+	if l == nil {
+		return errSharedFilesToken
+	}
+	l.list, l.entries, l.terms = nil, nil, nil
+	l.files, l.size = 0, 0
+	l.updated = time.Now()
+	return nil
+}
+
+// decodeSharedList decodes an XML file list, compressed with bzip2 or not.
+func decodeSharedList(r io.Reader) (*filelist.FileList, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(3); string(magic) == "BZh" {
+		return filelist.DecodeBZIP(br)
+	}
+	return filelist.Decode(br)
+}
+
+// upload replaces the file list of the user identified by the token.
+//
+// Partial lists with a Base other than "/" only replace the contents of the base directory,
+// so clients can refresh a part of the share without uploading the whole list again.
+func (s *sharedFiles) upload(token string, upd *filelist.FileList) (*sharedList, error) {
+	s.mu.RLock()
+	l := s.byToken[token]
+	var old *filelist.FileList
+	if l != nil {
+		old = l.list
+	}
+	s.mu.RUnlock()
+	if l == nil {
+		return nil, errSharedFilesToken
+	}
+	list, err := mergeSharedList(old, upd)
+	if err != nil {
+		return nil, err
+	}
+	nl := &sharedList{peer: l.peer, token: l.token, list: list, updated: time.Now()}
+	nl.index()
+	if len(nl.entries) > s.conf.MaxFiles {
+		return nil, fmt.Errorf("file list is too large: %d entries, limit is %d", len(nl.entries), s.conf.MaxFiles)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byToken[token] != l {
+		// opted out or left during the upload
+		return nil, errSharedFilesToken
+	}
+	s.byPeer[l.peer] = nl
+	s.byToken[token] = nl
+	return nl, nil
+}
+
+// mergeSharedList applies an uploaded list to the previous one. The previous list is not modified.
+func mergeSharedList(old, upd *filelist.FileList) (*filelist.FileList, error) {
+	base := strings.Trim(upd.Base, "/")
+	if base == "" {
+		list := *upd
+		list.Base = "/"
+		return &list, nil
+	}
+	if old == nil {
+		return nil, errSharedFilesBase
+	}
+	list := *old
+	list.Dirs = copySharedPath(old.Dirs, strings.Split(base, "/"), upd)
+	if list.Dirs == nil {
+		return nil, errSharedFilesBase
+	}
+	return &list, nil
+}
+
+// copySharedPath copies directories along the path and replaces the contents of the last one.
+// It returns nil if the path is not found.
+func copySharedPath(dirs []filelist.Dir, names []string, upd *filelist.FileList) []filelist.Dir {
+	for i := range dirs {
+		if dirs[i].Name != names[0] {
+			continue
+		}
+		out := make([]filelist.Dir, len(dirs))
+		copy(out, dirs)
+		d := &out[i]
+		if len(names) == 1 {
+			d.Dirs, d.Files, d.Incomplete = upd.Dirs, upd.Files, 0
+			return out
+		}
+		sub := copySharedPath(d.Dirs, names[1:], upd)
+		if sub == nil {
+			return nil
+		}
+		d.Dirs = sub
+		return out
+	}
+	return nil
+}
+
+// sharedTokens splits a string into lowercase alphanumeric tokens.
+func sharedTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (l *sharedList) index() {
+	l.terms = make(map[string][]int32)
+	for i := range l.list.Dirs {
+		d := &l.list.Dirs[i]
+		l.addDir("/"+d.Name+"/", d)
+	}
+	for i := range l.list.Files {
+		l.addFile("/", &l.list.Files[i])
+	}
+}
+
+func (l *sharedList) addDir(fpath string, d *filelist.Dir) {
+	id := l.add(sharedEntry{path: fpath, name: d.Name, dir: true})
+	for i := range d.Dirs {
+		sub := &d.Dirs[i]
+		l.addDir(fpath+sub.Name+"/", sub)
+	}
+	for i := range d.Files {
+		l.addFile(fpath, &d.Files[i])
+	}
+	l.entries[id].end = int32(len(l.entries))
+}
+
+func (l *sharedList) addFile(dir string, f *filelist.File) {
+	l.add(sharedEntry{path: dir + f.Name, name: f.Name, size: f.Size, tth: f.TTH})
+	l.files++
+	l.size += f.Size
+}
+
+func (l *sharedList) add(e sharedEntry) int32 {
+	id := int32(len(l.entries))
+	e.end = id + 1
+	e.lower = strings.ToLower(e.path)
+	l.entries = append(l.entries, e)
+	seen := make(map[string]struct{})
+	for _, t := range sharedTokens(e.name) {
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		l.terms[t] = append(l.terms[t], id)
+	}
+	return id
+}
+
+// candidates returns a set of entries that may match all tokens, or nil if there are no tokens.
+// A token matching a directory name matches all its contents.
+func (l *sharedList) candidates(tokens []string) []bool {
+	var set []bool
+	for _, tok := range tokens {
+		cur := make([]bool, len(l.entries))
+		for t, ids := range l.terms {
+			if !strings.Contains(t, tok) {
+				continue
+			}
+			for _, id := range ids {
+				for j := id; j < l.entries[id].end; j++ {
+					cur[j] = true
+				}
+			}
+		}
+		if set == nil {
+			set = cur
+			continue
+		}
+		for i := range set {
+			set[i] = set[i] && cur[i]
+		}
+	}
+	return set
+}
+
+// matchShared checks if an entry matches the search request.
+func matchShared(req SearchRequest, e *sharedEntry) bool {
+	matchName := func(s NameSearch) bool {
+		for _, t := range s.And {
+			if !strings.Contains(e.lower, strings.ToLower(t)) {
+				return false
+			}
+		}
+		for _, t := range s.Not {
+			if strings.Contains(e.lower, strings.ToLower(t)) {
+				return false
+			}
+		}
+		return true
+	}
+	switch req := req.(type) {
+	case TTHSearch:
+		return !e.dir && e.tth == TTH(req)
+	case NameSearch:
+		return matchName(req)
+	case DirSearch:
+		return e.dir && matchName(req.NameSearch)
+	case FileSearch:
+		if e.dir || !matchName(req.NameSearch) {
+			return false
+		}
+		size := uint64(e.size)
+		if (req.MinSize != 0 && size < req.MinSize) || (req.MaxSize != 0 && size > req.MaxSize) {
+			return false
+		}
+		ext := strings.TrimPrefix(strings.ToLower(path.Ext(e.name)), ".")
+		for _, x := range req.NoExt {
+			if strings.EqualFold(x, ext) {
+				return false
+			}
+		}
+		if len(req.Ext) == 0 {
+			return true
+		}
+		for _, x := range req.Ext {
+			if strings.EqualFold(x, ext) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// sharedRelevance scores a name against search terms. Terms found in the name itself
+// score higher than terms found in parent directories, and whole words score
+// higher than substrings.
+func sharedRelevance(terms []string, name string) int {
+	name = strings.ToLower(name)
+	words := make(map[string]struct{})
+	for _, w := range sharedTokens(name) {
+		words[w] = struct{}{}
+	}
+	score := 0
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		if !strings.Contains(name, term) {
+			continue
+		}
+		score += 2
+		if _, ok := words[term]; ok || name == term {
+			score++
+		}
+	}
+	return score
+}
+
+// searchTerms returns positive name terms of the request.
+func searchTerms(req SearchRequest) []string {
+	switch req := req.(type) {
+	case NameSearch:
+		return req.And
+	case DirSearch:
+		return req.And
+	case FileSearch:
+		return req.And
+	}
+	return nil
+}
+
+// search returns at most limit entries from all lists that match the request, ordered by relevance.
+func (s *sharedFiles) search(req SearchRequest, limit int) []SearchResult {
+	terms := searchTerms(req)
+	var tokens []string
+	for _, t := range terms {
+		tokens = append(tokens, sharedTokens(t)...)
+	}
+	type scored struct {
+		l     *sharedList
+		e     *sharedEntry
+		score int
+	}
+	var found []scored
+
+	s.mu.RLock()
+	for _, l := range s.byPeer {
+		set := l.candidates(tokens)
+		if set == nil && len(terms) != 0 {
+			// terms without letters or digits
+			continue
+		}
+		for i := range l.entries {
+			if set != nil && !set[i] {
+				continue
+			}
+			e := &l.entries[i]
+			if matchShared(req, e) {
+				found = append(found, scored{l: l, e: e, score: sharedRelevance(terms, e.name)})
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.e.path) != len(b.e.path) {
+			return len(a.e.path) < len(b.e.path)
+		}
+		if a.e.path != b.e.path {
+			return a.e.path < b.e.path
+		}
+		return a.l.peer.Name() < b.l.peer.Name()
+	})
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	out := make([]SearchResult, 0, len(found))
+	for _, f := range found {
+		if f.e.dir {
+			out = append(out, Dir{Peer: f.l.peer, Path: f.e.path})
+			continue
+		}
+		tth := f.e.tth
+		out = append(out, File{Peer: f.l.peer, Path: f.e.path, Size: uint64(f.e.size), TTH: &tth})
+	}
+	return out
+}
+
+func (s *sharedFiles) stats() SharedFilesStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var st SharedFilesStats
+	for _, l := range s.byPeer {
+		if l.list == nil {
+			continue
+		}
+		st.Users++
+		st.Files += l.files
+		st.Size += l.size
+	}
+	return st
+}
+
+// SearchSharedFiles searches file lists uploaded to the hub. It returns false if the shared
+// files index is disabled. Zero limit means DefaultSharedResults.
+func (h *Hub) SearchSharedFiles(req SearchRequest, limit int) ([]SearchResult, bool) {
+	if h.sharedFiles == nil {
+		return nil, false
+	}
+	if limit <= 0 {
+		limit = DefaultSharedResults
+	}
+	return h.sharedFiles.search(req, limit), true
+}
+
+// SharedFilesStats returns the state of the shared files index. It returns false if the index is disabled.
+func (h *Hub) SharedFilesStats() (SharedFilesStats, bool) {
+	if h.sharedFiles == nil {
+		return SharedFilesStats{}, false
+	}
+	return h.sharedFiles.stats(), true
+}
+
+// sharedFilesLeave removes the file list of a peer that left the hub.
+func (h *Hub) sharedFilesLeave(peer Peer) {
+	if h.sharedFiles != nil {
+		h.sharedFiles.optOut(peer)
+	}
+}
+
+func (h *Hub) cmdShareFiles(p Peer, args RawCmd) error {
+	if h.sharedFiles == nil {
+		return errSharedFilesDisabled
+	}
+	switch strings.TrimSpace(string(args)) {
+	case "", "on":
+		token, err := h.sharedFiles.optIn(p)
+		if err != nil {
+			return err
+		}
+		url := HTTPFileListPathV0
+		if st := h.Stats(); len(st.Addr) != 0 {
+			url = "https://" + st.Addr[0] + url
+		}
+		h.cmdOutputf(p, "upload your file list with HTTP PUT to %s using the token %s as a bearer token; "+
+			"lists with a Base attribute only refresh a given directory; use \"sharefiles off\" to remove your list",
+			url, token)
+	case "off":
+		if h.sharedFiles.optOut(p) {
+			h.cmdOutput(p, "your file list was removed from the hub")
+		} else {
+			h.cmdOutput(p, "you are not sharing your file list with the hub")
+		}
+	default:
+		return fmt.Errorf("expected \"on\" or \"off\", got %q", string(args))
+	}
+	return nil
+}
+
+func (h *Hub) cmdFind(p Peer, args RawCmd) error {
+	terms := strings.Fields(string(args))
+	if len(terms) == 0 {
+		return errors.New("expected search terms")
+	}
+	res, ok := h.SearchSharedFiles(NameSearch{And: terms}, 0)
+	if !ok {
+		return errSharedFilesDisabled
+	}
+	if len(res) == 0 {
+		h.cmdOutput(p, "nothing found")
+		return nil
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "found %d results:", len(res))
+	for _, r := range res {
+		switch r := r.(type) {
+		case File:
+			fmt.Fprintf(&buf, "\n%s: %s (%d bytes, TTH: %s)", r.Peer.Name(), r.Path, r.Size, r.TTH.Base32())
+		case Dir:
+			fmt.Fprintf(&buf, "\n%s: %s", r.Peer.Name(), r.Path)
+		}
+	}
+	h.cmdOutput(p, buf.String())
+	return nil
+}
@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSharedList = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<FileListing Version="1" Base="/" Generator="test">
+	<Directory Name="Linux">
+		<Directory Name="Debian">
+			<File Name="debian-10.iso" Size="100" TTH="LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ"/>
+		</Directory>
+		<File Name="readme.txt" Size="10" TTH="3I42H3S6NNFQ2MSVX7XZKYAYSCX5QBYJ3CZ4C2A"/>
+	</Directory>
+	<Directory Name="Music">
+		<File Name="Linux Song.mp3" Size="50" TTH="UDRJ6EGCH3CGWIIU2V6CH7VLFN4N2PCZKSPTBQA"/>
+	</Directory>
+</FileListing>`
+
+const testSharedPartial = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<FileListing Version="1" Base="/Linux/Debian/" Generator="test">
+	<File Name="debian-11.iso" Size="200" TTH="LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ"/>
+</FileListing>`
+
+func TestSharedFiles(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	p := newTestADCPeer(t, h, "user")
+	sentADC(p)
+	require.True(t, h.isCommand(p, "!find linux"))
+	require.Contains(t, lastChat(t, p), "disabled")
+
+	h, err = NewHub(Config{SharedFiles: SharedFilesConfig{Enabled: true}})
+	require.NoError(t, err)
+	p = newTestADCPeer(t, h, "user")
+	other := newTestADCPeer(t, h, "other")
+	sentADC(p)
+
+	require.True(t, h.isCommand(p, "!sharefiles on"))
+	token, err := h.sharedFiles.optIn(p)
+	require.NoError(t, err)
+	require.Contains(t, lastChat(t, p), token)
+
+	upload := func(method, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, HTTPFileListPathV0, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.serveV0FileList(w, r)
+		return w
+	}
+	require.Equal(t, http.StatusUnauthorized, upload("PUT", "", testSharedList).Code)
+	require.Equal(t, http.StatusUnauthorized, upload("PUT", "wrong", testSharedList).Code)
+	require.Equal(t, http.StatusConflict, upload("PUT", token, testSharedPartial).Code)
+	require.Equal(t, http.StatusBadRequest, upload("PUT", token, "<FileListing").Code)
+	require.Equal(t, http.StatusOK, upload("PUT", token, testSharedList).Code)
+
+	st, ok := h.SharedFilesStats()
+	require.True(t, ok)
+	require.Equal(t, SharedFilesStats{Users: 1, Files: 3, Size: 160}, st)
+
+	paths := func(res []SearchResult) []string {
+		var out []string
+		for _, r := range res {
+			switch r := r.(type) {
+			case File:
+				require.Equal(t, p, r.Peer)
+				out = append(out, r.Path)
+			case Dir:
+				require.Equal(t, p, r.Peer)
+				out = append(out, r.Path)
+			}
+		}
+		return out
+	}
+	res, ok := h.SearchSharedFiles(NameSearch{And: []string{"linux"}}, 0)
+	require.True(t, ok)
+	// directory names match their contents; names that match score higher
+	require.Equal(t, []string{
+		"/Linux/",
+		"/Music/Linux Song.mp3",
+		"/Linux/Debian/",
+		"/Linux/readme.txt",
+		"/Linux/Debian/debian-10.iso",
+	}, paths(res))
+
+	res, _ = h.SearchSharedFiles(FileSearch{NameSearch: NameSearch{And: []string{"linux"}}, Ext: []string{"iso"}}, 0)
+	require.Equal(t, []string{"/Linux/Debian/debian-10.iso"}, paths(res))
+
+	res, _ = h.SearchSharedFiles(NameSearch{And: []string{"linux"}, Not: []string{"debian"}}, 2)
+	require.Equal(t, []string{"/Linux/", "/Music/Linux Song.mp3"}, paths(res))
+
+	// refresh a single directory
+	require.Equal(t, http.StatusOK, upload("POST", token, testSharedPartial).Code)
+	res, _ = h.SearchSharedFiles(NameSearch{And: []string{"debian"}}, 0)
+	require.Equal(t, []string{"/Linux/Debian/", "/Linux/Debian/debian-11.iso"}, paths(res))
+	res, _ = h.SearchSharedFiles(NameSearch{And: []string{"readme"}}, 0)
+	require.Equal(t, []string{"/Linux/readme.txt"}, paths(res))
+
+	sentADC(other)
+	require.True(t, h.isCommand(other, "!find debian 11"))
+	require.Contains(t, lastChat(t, other), `user:\s/Linux/Debian/debian-11.iso`)
+
+	r := httptest.NewRequest("GET", HTTPFilesPathV0+"?q=song", nil)
+	w := httptest.NewRecorder()
+	h.serveV0Files(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var found []sharedFileResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&found))
+	require.Len(t, found, 1)
+	require.Equal(t, "user", found[0].User)
+	require.Equal(t, uint64(50), found[0].Size)
+
+	r = httptest.NewRequest("GET", HTTPFilesPath+"?q=song", nil)
+	w = httptest.NewRecorder()
+	h.serveFiles(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "/Music/Linux Song.mp3")
+
+	require.Equal(t, http.StatusNoContent, upload("DELETE", token, "").Code)
+	st, _ = h.SharedFilesStats()
+	require.Equal(t, SharedFilesStats{}, st)
+
+	// lists are removed when users leave
+	require.Equal(t, http.StatusOK, upload("PUT", token, testSharedList).Code)
+	require.NoError(t, p.Close())
+	st, _ = h.SharedFilesStats()
+	require.Equal(t, SharedFilesStats{}, st)
+	require.Equal(t, http.StatusUnauthorized, upload("PUT", token, testSharedList).Code)
+}
@@ -0,0 +1,147 @@
+package hub
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// sidMax is the largest SID value. SIDs are 20 bits long.
+	sidMax = 1<<20 - 1
+
+	// defaultSIDQuarantine is the default time before a SID of a departed peer can be reused.
+	defaultSIDQuarantine = time.Minute
+)
+
+var errSIDExhausted = errors.New("no free session IDs")
+
+// SIDStats is a statistics of session ID allocation.
+type SIDStats struct {
+	InUse     int    `json:"in_use"`    // number of allocated SIDs
+	Free      int    `json:"free"`      // number of SIDs that can still be allocated
+	Released  int    `json:"released"`  // number of released SIDs waiting for reuse
+	Allocated uint64 `json:"allocated"` // total number of allocations
+	Reused    uint64 `json:"reused"`    // total number of allocations that reused a SID
+	Exhausted uint64 `json:"exhausted"` // total number of failed allocations
+}
+
+// sidPool allocates session IDs for peers and rooms.
+//
+// SIDs of departed peers are reused only after a quarantine period, so late messages
+// addressed to the old peer are not delivered to a new one. If the SID space is exhausted,
+// released SIDs are reused even if the quarantine is not over yet.
+type sidPool struct {
+	sync.Mutex
+	quarantine time.Duration
+	last       uint32       // last SID that was never allocated before
+	released   []sidRelease // FIFO, ordered by release time
+	inUse      int
+
+	allocated uint64
+	reused    uint64
+	exhausted uint64
+}
+
+type sidRelease struct {
+	v    uint32
+	time time.Time
+}
+
+func (s *sidPool) alloc(now time.Time) (SID, error) {
+	s.Lock()
+	defer s.Unlock()
+	var v uint32
+	if len(s.released) != 0 && now.Sub(s.released[0].time) >= s.quarantine {
+		v = s.popReleased()
+	} else if s.last < sidMax {
+		s.last++
+		v = s.last
+	} else if len(s.released) != 0 {
+		v = s.popReleased()
+	} else {
+		s.exhausted++
+		cntSIDExhausted.Add(1)
+		return SID{}, errSIDExhausted
+	}
+	s.inUse++
+	s.allocated++
+	cntSIDsInUse.Add(1)
+	return sidFromInt(v), nil
+}
+
+func (s *sidPool) popReleased() uint32 {
+	v := s.released[0].v
+	s.released[0] = sidRelease{}
+	s.released = s.released[1:]
+	s.reused++
+	return v
+}
+
+func (s *sidPool) release(sid SID, now time.Time) {
+	v := sidToInt(sid)
+	if v == 0 || v > sidMax {
+		return
+	}
+	s.Lock()
+	s.released = append(s.released, sidRelease{v: v, time: now})
+	s.inUse--
+	s.Unlock()
+	cntSIDsInUse.Add(-1)
+}
+
+func (s *sidPool) stats() SIDStats {
+	s.Lock()
+	defer s.Unlock()
+	return SIDStats{
+		InUse:     s.inUse,
+		Free:      sidMax - int(s.last) + len(s.released),
+		Released:  len(s.released),
+		Allocated: s.allocated,
+		Reused:    s.reused,
+		Exhausted: s.exhausted,
+	}
+}
+
+func sidToInt(sid SID) uint32 {
+	var v uint32
+	for _, c := range sid {
+		v *= 32
+		switch {
+		case c >= 'A' && c <= 'Z':
+			v += uint32(c - 'A')
+		case c >= '2' && c <= '7':
+			v += uint32(c-'2') + 26
+		default:
+			return 0
+		}
+	}
+	return v
+}
+
+// SIDStats returns statistics of session ID allocation.
+func (h *Hub) SIDStats() SIDStats {
+	return h.sids.stats()
+}
+
+func (h *Hub) nextSID() (SID, error) {
+	return h.sids.alloc(time.Now())
+}
+
+// releaseSID returns the SID of the peer to the pool. It's safe to call it multiple times.
+func (p *BasePeer) releaseSID() {
+	if atomic.CompareAndSwapUint32(&p.sidReleased, 0, 1) {
+		p.hub.sids.release(p.sid, time.Now())
+	}
+}
+
+// abortPeer cleans up after a failed handshake. Peers that were already accepted
+// are closed, for other peers only the SID is released.
+func (h *Hub) abortPeer(p Peer) {
+	if h.peerBySID(p.SID()) == p {
+		_ = p.Close()
+		return
+	}
+	p.base().releaseSID()
+}
@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSIDToInt(t *testing.T) {
+	for _, v := range []uint32{0, 1, 31, 32, 1000, sidMax} {
+		require.Equal(t, v, sidToInt(sidFromInt(v)))
+	}
+	require.Equal(t, uint32(0), sidToInt(SID{'A', 'A', '1', 'A'}))
+}
+
+func TestSIDPool(t *testing.T) {
+	now := time.Now()
+	s := &sidPool{quarantine: time.Minute}
+
+	a, err := s.alloc(now)
+	require.NoError(t, err)
+	require.Equal(t, sidFromInt(1), a)
+	b, err := s.alloc(now)
+	require.NoError(t, err)
+	require.Equal(t, sidFromInt(2), b)
+
+	// released SID is not reused during the quarantine
+	s.release(a, now)
+	c, err := s.alloc(now.Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, sidFromInt(3), c)
+
+	// and reused after it
+	d, err := s.alloc(now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, a, d)
+
+	st := s.stats()
+	require.Equal(t, 3, st.InUse)
+	require.Equal(t, uint64(4), st.Allocated)
+	require.Equal(t, uint64(1), st.Reused)
+
+	// exhausted space: quarantined SIDs are reused
+	s.last = sidMax
+	s.release(b, now)
+	e, err := s.alloc(now)
+	require.NoError(t, err)
+	require.Equal(t, b, e)
+
+	// nothing left
+	_, err = s.alloc(now)
+	require.Equal(t, errSIDExhausted, err)
+	st = s.stats()
+	require.Equal(t, uint64(1), st.Exhausted)
+	require.Equal(t, 0, st.Free)
+}
+
+func TestSIDRelease(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	before := h.SIDStats().InUse
+	p := newTestADCPeer(t, h, "alice")
+	require.Equal(t, before+1, h.SIDStats().InUse)
+
+	require.NoError(t, p.Close())
+	require.Equal(t, before, h.SIDStats().InUse)
+
+	// releasing twice doesn't affect other SIDs
+	p.releaseSID()
+	require.Equal(t, before, h.SIDStats().InUse)
+	require.Equal(t, 1, h.SIDStats().Released)
+}
@@ -0,0 +1,108 @@
+package hub
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PermSlowMode allows changing the slow mode of rooms.
+	PermSlowMode = "chat.slowmode"
+	// PermSlowModeExempt allows users to ignore the slow mode, for example for VIP profiles.
+	PermSlowModeExempt = "chat.slowmode.exempt"
+)
+
+// slowMode enforces a minimal interval between messages of each user in a room.
+type slowMode struct {
+	sync.Mutex
+	interval time.Duration
+	last     map[Peer]time.Time
+}
+
+// SlowMode returns the minimal interval between messages of each user. Zero means no limit.
+func (r *Room) SlowMode() time.Duration {
+	r.slow.Lock()
+	defer r.slow.Unlock()
+	return r.slow.interval
+}
+
+// SetSlowMode sets the minimal interval between messages of each user. Zero disables the slow mode.
+func (r *Room) SetSlowMode(interval time.Duration) {
+	if interval < 0 {
+		interval = 0
+	}
+	r.slow.Lock()
+	defer r.slow.Unlock()
+	r.slow.interval = interval
+	r.slow.last = nil
+}
+
+// checkSlowMode checks if the peer is allowed to send a message now.
+// It returns the time the peer should wait otherwise.
+func (r *Room) checkSlowMode(p Peer, now time.Time) time.Duration {
+	r.slow.Lock()
+	defer r.slow.Unlock()
+	if r.slow.interval <= 0 || p.User().HasPerm(PermSlowModeExempt) {
+		return 0
+	}
+	if last, ok := r.slow.last[p]; ok {
+		if wait := last.Add(r.slow.interval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	if r.slow.last == nil {
+		r.slow.last = make(map[Peer]time.Time)
+	}
+	r.slow.last[p] = now
+	return 0
+}
+
+// forgetSlowMode removes the state of the slow mode for a peer that left the room.
+func (r *Room) forgetSlowMode(p Peer) {
+	r.slow.Lock()
+	delete(r.slow.last, p)
+	r.slow.Unlock()
+}
+
+func (h *Hub) cmdSlowMode(p Peer, args string) error {
+	r := h.globalChat
+	name, rest := cutReason(strings.TrimSpace(args))
+	if strings.HasPrefix(name, "#") {
+		if r = h.Room(name); r == nil {
+			return errors.New("no such room: " + name)
+		}
+		args = rest
+	}
+	if args == "" {
+		if d := r.SlowMode(); d > 0 {
+			h.cmdOutput(p, "slow mode: "+d.String())
+		} else {
+			h.cmdOutput(p, "slow mode is disabled")
+		}
+		return nil
+	}
+	var d time.Duration
+	if args != "off" && args != "0" {
+		v, err := time.ParseDuration(args)
+		if err != nil {
+			return err
+		} else if v < 0 {
+			return errors.New("interval must not be negative")
+		}
+		d = v
+	}
+	r.SetSlowMode(d)
+	target := r.Name()
+	if target == "" {
+		target = "main chat"
+	}
+	h.audit(AuditConfig, p, target, "slow mode "+d.String())
+	if d == 0 {
+		h.cmdOutput(p, "slow mode disabled")
+	} else {
+		h.cmdOutput(p, "slow mode: "+d.String())
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowMode(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	require.NoError(t, h.loadProfiles())
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	user := newTestADCPeer(t, h, "user")
+	other := newTestADCPeer(t, h, "other")
+
+	require.True(t, h.isCommand(op, "!slowmode 1h"))
+	require.Equal(t, time.Hour, h.globalChat.SlowMode())
+
+	sentADC(other)
+	h.globalChat.SendChat(user, Message{Text: "first"})
+	require.NotEmpty(t, sentADC(other))
+
+	sentADC(user)
+	h.globalChat.SendChat(user, Message{Text: "second"})
+	require.Empty(t, sentADC(other))
+	require.Contains(t, lastChat(t, user), "slow")
+
+	// operators are exempt
+	h.globalChat.SendChat(op, Message{Text: "first"})
+	h.globalChat.SendChat(op, Message{Text: "second"})
+	require.Len(t, sentADC(other), 2)
+
+	// state is reset when the user leaves
+	h.globalChat.Leave(user)
+	h.globalChat.Join(user)
+	h.globalChat.SendChat(user, Message{Text: "third"})
+	require.NotEmpty(t, sentADC(other))
+
+	require.True(t, h.isCommand(op, "!slowmode off"))
+	require.Equal(t, time.Duration(0), h.globalChat.SlowMode())
+
+	sentADC(op)
+	require.True(t, h.isCommand(op, "!slowmode #nope 10s"))
+	require.Contains(t, lastChat(t, op), "error")
+}
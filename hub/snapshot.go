@@ -0,0 +1,188 @@
+package hub
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+)
+
+// changesBuffer is the number of recent changes kept by the hub.
+const changesBuffer = 1024
+
+// PeerSnapshot is a serializable state of a single peer.
+type PeerSnapshot struct {
+	SID        string      `json:"sid"`
+	Name       string      `json:"name"`
+	CID        string      `json:"cid,omitempty"`
+	IP         string      `json:"ip,omitempty"`
+	Proto      string      `json:"proto"`
+	Share      uint64      `json:"share"`
+	ShareFiles int         `json:"files,omitempty"`
+	Client     dc.Software `json:"client"`
+	Bot        bool        `json:"bot,omitempty"`
+	Op         bool        `json:"op,omitempty"`
+	Registered bool        `json:"reg,omitempty"`
+	Secure     bool        `json:"secure,omitempty"`
+	Away       bool        `json:"away,omitempty"`
+}
+
+// Snapshot is a consistent state of the hub user list.
+type Snapshot struct {
+	// Seq is a sequence number of the last change included in the snapshot.
+	Seq   uint64         `json:"seq"`
+	Time  time.Time      `json:"time"`
+	Peers []PeerSnapshot `json:"peers"`
+}
+
+type ChangeKind string
+
+const (
+	ChangeJoin   = ChangeKind("join")
+	ChangeUpdate = ChangeKind("update")
+	ChangeLeave  = ChangeKind("leave")
+)
+
+// Change is a single event in the hub user list change feed.
+type Change struct {
+	Seq  uint64       `json:"seq"`
+	Kind ChangeKind   `json:"kind"`
+	Time time.Time    `json:"time"`
+	Peer PeerSnapshot `json:"peer"`
+}
+
+func peerSnapshot(p Peer) PeerSnapshot {
+	u := p.UserInfo()
+	s := PeerSnapshot{
+		SID:        p.SID().String(),
+		Name:       u.Name,
+		Proto:      PeerProtocol(p),
+		Share:      u.Share,
+		ShareFiles: u.ShareFiles,
+		Client:     u.App,
+		Bot:        u.Kind != UserNormal,
+		Away:       u.Away,
+	}
+	if cid := p.CID(); !cid.IsZero() {
+		s.CID = cid.String()
+	}
+	if addr, ok := p.RemoteAddr().(*net.TCPAddr); ok && s.Proto != ProtoBot {
+		s.IP = addr.IP.String()
+	}
+	if c := p.ConnInfo(); c != nil {
+		s.Secure = c.Secure
+	}
+	if user := p.User(); user != nil {
+		s.Op = user.IsOp()
+		s.Registered = user.IsRegistered()
+	}
+	return s
+}
+
+// Snapshot returns a consistent snapshot of all peers on the hub.
+//
+// Seq field of the snapshot can be passed to SubscribeChanges to receive all the changes
+// that happened after the snapshot was taken.
+func (h *Hub) Snapshot() Snapshot {
+	h.peers.RLock()
+	defer h.peers.RUnlock()
+	h.feed.Lock()
+	seq := h.feed.seq
+	h.feed.Unlock()
+
+	s := Snapshot{
+		Seq:   seq,
+		Time:  time.Now().UTC(),
+		Peers: make([]PeerSnapshot, 0, h.peers.index.Len()),
+	}
+	for _, p := range h.peers.index.List() {
+		s.Peers = append(s.Peers, peerSnapshot(p))
+	}
+	return s
+}
+
+type changeFeed struct {
+	sync.Mutex
+	epoch string // identifies the hub instance in user list versions
+	seq   uint64
+	last  []Change // ring buffer
+	subs  map[chan Change]struct{}
+}
+
+func (f *changeFeed) emit(kind ChangeKind, p Peer) {
+	c := Change{
+		Kind: kind,
+		Time: time.Now().UTC(),
+		Peer: peerSnapshot(p),
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.seq++
+	c.Seq = f.seq
+	if len(f.last) < changesBuffer {
+		f.last = append(f.last, c)
+	} else {
+		f.last[(c.Seq-1)%changesBuffer] = c
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- c:
+		default:
+			// subscriber is too slow - it should take a new snapshot
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// since returns all buffered changes after a given sequence number.
+// It returns false if some changes are no longer available.
+func (f *changeFeed) since(seq uint64) ([]Change, bool) {
+	if seq >= f.seq {
+		return nil, true
+	} else if f.seq-seq > uint64(len(f.last)) {
+		return nil, false
+	}
+	out := make([]Change, 0, f.seq-seq)
+	for s := seq + 1; s <= f.seq; s++ {
+		out = append(out, f.last[(s-1)%changesBuffer])
+	}
+	return out, true
+}
+
+// SubscribeChanges returns a feed of user list changes that happened after a given
+// sequence number. The returned function must be called to stop the subscription.
+//
+// If the subscriber is too slow to receive changes, or the changes since the sequence number
+// are no longer available, the channel is closed. The subscriber should take a new Snapshot
+// and subscribe again in this case.
+func (h *Hub) SubscribeChanges(seq uint64, buf int) (<-chan Change, func()) {
+	if buf <= 0 {
+		buf = changesBuffer
+	}
+	h.feed.Lock()
+	defer h.feed.Unlock()
+	last, ok := h.feed.since(seq)
+	if !ok || len(last) > buf {
+		ch := make(chan Change)
+		close(ch)
+		return ch, func() {}
+	}
+	ch := make(chan Change, buf)
+	for _, c := range last {
+		ch <- c
+	}
+	if h.feed.subs == nil {
+		h.feed.subs = make(map[chan Change]struct{})
+	}
+	h.feed.subs[ch] = struct{}{}
+	return ch, func() {
+		h.feed.Lock()
+		defer h.feed.Unlock()
+		if _, ok := h.feed.subs[ch]; ok {
+			delete(h.feed.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeed(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	s := h.Snapshot()
+	require.Len(t, s.Peers, 1)
+	require.Equal(t, uint64(1), s.Seq) // hub bot joined
+
+	p := h.HubUser().p
+	ch, cancel := h.SubscribeChanges(s.Seq, 10)
+	h.feed.emit(ChangeUpdate, p)
+	c := <-ch
+	require.Equal(t, s.Seq+1, c.Seq)
+	require.Equal(t, ChangeUpdate, c.Kind)
+	require.Equal(t, p.Name(), c.Peer.Name)
+	cancel()
+
+	for i := 0; i < changesBuffer+10; i++ {
+		h.feed.emit(ChangeUpdate, p)
+	}
+	last := h.feed.seq
+
+	// changes that are too old should not be available
+	_, ok := h.feed.since(s.Seq)
+	require.False(t, ok)
+
+	// all buffered changes should be returned in order
+	out, ok := h.feed.since(last - changesBuffer)
+	require.True(t, ok)
+	require.Len(t, out, changesBuffer)
+	for i, c := range out {
+		require.Equal(t, last-changesBuffer+uint64(i)+1, c.Seq)
+	}
+
+	// slow subscriber should be closed
+	ch, cancel = h.SubscribeChanges(last, 1)
+	defer cancel()
+	h.feed.emit(ChangeUpdate, p)
+	h.feed.emit(ChangeUpdate, p)
+	_, ok = <-ch
+	require.True(t, ok)
+	_, ok = <-ch
+	require.False(t, ok)
+}
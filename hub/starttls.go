@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+var errUpgradeBuffered = errors.New("unexpected data before TLS handshake")
+
+// upgradeConn is a plaintext connection that can be switched to TLS after the protocol handshake has started.
+//
+// It counts bytes read from the connection and bytes of lines consumed by the protocol reader,
+// so the hub can make sure that nothing sent in plaintext is processed after the upgrade.
+type upgradeConn struct {
+	net.Conn
+	read     int
+	consumed int
+}
+
+func (c *upgradeConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read += n
+	return n, err
+}
+
+// onLine must be registered as the first line hook of the reader.
+func (c *upgradeConn) onLine(line []byte) (bool, error) {
+	c.consumed += len(line)
+	return true, nil
+}
+
+// buffered returns the number of bytes read from the connection, but not consumed by the reader.
+func (c *upgradeConn) buffered() int {
+	return c.read - c.consumed
+}
+
+// adcCanUpgrade checks if an ADC client on the connection may switch to TLS, see Config.ADCUpgradeTLS.
+func (h *Hub) adcCanUpgrade(cinfo *ConnInfo) bool {
+	return h.conf.ADCUpgradeTLS && h.tls != nil && !cinfo.Secure
+}
+
+// adcUpgradeTLS flushes the hub SUP that confirmed the upgrade and runs the TLS handshake.
+//
+// The client must not send anything else until it receives the SUP. If something is already
+// buffered by the reader, it was sent in plaintext (possibly injected by a third party),
+// and the connection is rejected instead of processing it as a secure one.
+func (h *Hub) adcUpgradeTLS(c *adc.Conn, cinfo *ConnInfo, deadline time.Time) error {
+	uc := cinfo.upgrade
+	if uc.buffered() != 0 {
+		return errUpgradeBuffered
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	tconn := tls.Server(uc.Conn, h.tls)
+	_ = tconn.SetDeadline(deadline)
+	if err := tconn.Handshake(); err != nil {
+		return err
+	}
+	_ = tconn.SetDeadline(time.Time{})
+	uc.Conn = tconn
+	cinfo.upgrade = nil
+
+	st := tconn.ConnectionState()
+	cinfo.Secure = true
+	cinfo.TLSVers = st.Version
+	cntConnTLS.Add(1)
+	cntConnADCS.Add(1)
+	cntConnADCUpgrade.Add(1)
+	return nil
+}
@@ -0,0 +1,133 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func testTLSConfig(t testing.TB) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// dialUpgradeADC connects to the hub over a plaintext pipe and sends the SUP with given features.
+// It returns the connection, the reader for it and the SUP line sent by the hub.
+func dialUpgradeADC(t *testing.T, h *Hub, fea string) (net.Conn, *bufio.Reader, string) {
+	hc, cc := net.Pipe()
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	hconn := addrOverride{Conn: hc, local: addr, remote: addr}
+	go func() {
+		defer hconn.Close()
+		_ = h.Serve(hconn)
+	}()
+	t.Cleanup(func() { _ = cc.Close() })
+	_ = cc.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err := cc.Write([]byte("HSUP ADBASE ADTIGR" + fea + "\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(cc)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "ISUP "), line)
+	return cc, r, line
+}
+
+func TestADCUpgradeTLS(t *testing.T) {
+	h, err := NewHub(Config{TLS: testTLSConfig(t), ADCUpgradeTLS: true})
+	require.NoError(t, err)
+	defer h.Close()
+
+	cc, r, sup := dialUpgradeADC(t, h, " ADADCS")
+	require.Contains(t, sup, "ADCS")
+	// the hub waits for the handshake after confirming the upgrade
+	require.Equal(t, 0, r.Buffered())
+
+	tconn := tls.Client(cc, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, tconn.Handshake())
+	c, err := adc.NewConn(tconn)
+	require.NoError(t, err)
+	p, err := c.ReadPacket(time.Now().Add(5 * time.Second))
+	require.NoError(t, err)
+	require.Equal(t, (adc.SIDAssign{}).Cmd(), p.Message().Cmd())
+}
+
+func TestADCUpgradeTLSNotRequested(t *testing.T) {
+	h, err := NewHub(Config{TLS: testTLSConfig(t), ADCUpgradeTLS: true})
+	require.NoError(t, err)
+	defer h.Close()
+
+	// clients that don't ask for an upgrade continue in plaintext
+	_, r, sup := dialUpgradeADC(t, h, "")
+	require.NotContains(t, sup, "ADCS")
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "ISID "), line)
+}
+
+func TestADCUpgradeTLSDisabled(t *testing.T) {
+	h, err := NewHub(Config{TLS: testTLSConfig(t)})
+	require.NoError(t, err)
+	defer h.Close()
+
+	_, r, sup := dialUpgradeADC(t, h, " ADADCS")
+	require.NotContains(t, sup, "ADCS")
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "ISID "), line)
+}
+
+func TestADCUpgradeTLSInjection(t *testing.T) {
+	h, err := NewHub(Config{TLS: testTLSConfig(t), ADCUpgradeTLS: true})
+	require.NoError(t, err)
+	defer h.Close()
+
+	hc, cc := net.Pipe()
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	hconn := addrOverride{Conn: hc, local: addr, remote: addr}
+	done := make(chan error, 1)
+	go func() {
+		defer hconn.Close()
+		done <- h.Serve(hconn)
+	}()
+	defer cc.Close()
+	_ = cc.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// commands sent in plaintext right after the SUP must not be processed as secure ones
+	_, err = cc.Write([]byte("HSUP ADBASE ADTIGR ADADCS\nBINF AAAA NIinjected\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, cc)
+	require.NoError(t, err)
+	require.NotContains(t, buf.String(), "ADCS")
+	require.NotContains(t, buf.String(), "ISID")
+	err = <-done
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errUpgradeBuffered.Error())
+	require.Nil(t, h.PeerByName("injected"))
+}
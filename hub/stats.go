@@ -0,0 +1,280 @@
+package hub
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsInterval is an interval used to recalculate hub rates.
+const statsInterval = 5 * time.Second
+
+const (
+	ProtoNMDC   = "nmdc"
+	ProtoADC    = "adc"
+	ProtoIRC    = "irc"
+	ProtoMatrix = "matrix"
+	ProtoXMPP   = "xmpp"
+	ProtoBot    = "bot"
+)
+
+// PeerProtocol returns a protocol name used by the peer.
+func PeerProtocol(p Peer) string {
+	return p.protocol()
+}
+
+// TrafficStats contains hub-wide traffic and activity counters.
+type TrafficStats struct {
+	RxBytes     uint64  `json:"rx-bytes"`
+	TxBytes     uint64  `json:"tx-bytes"`
+	RxRate      uint64  `json:"rx-rate"` // bytes/sec
+	TxRate      uint64  `json:"tx-rate"` // bytes/sec
+	Messages    uint64  `json:"messages"`
+	Searches    uint64  `json:"searches"`
+	MessageRate float64 `json:"messages-rate"` // per sec
+	SearchRate  float64 `json:"searches-rate"` // per sec
+}
+
+type statsRates struct {
+	rx, tx         uint64
+	msgs, searches float64
+}
+
+type hubStats struct {
+	peak     int64  // atomic
+	rx       uint64 // atomic
+	tx       uint64 // atomic
+	msgs     uint64 // atomic
+	searches uint64 // atomic
+
+	users struct {
+		nmdc   int64 // atomic
+		adc    int64 // atomic
+		irc    int64 // atomic
+		matrix int64 // atomic
+		xmpp   int64 // atomic
+		bots   int64 // atomic
+	}
+
+	rates atomic.Value // statsRates
+
+	// out limits the outbound traffic of all connections
+	out tokenBucket
+}
+
+func (s *hubStats) run(done <-chan struct{}) {
+	// this routine recalculates hub rates on each tick
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	rx, tx := atomic.LoadUint64(&s.rx), atomic.LoadUint64(&s.tx)
+	msgs, searches := atomic.LoadUint64(&s.msgs), atomic.LoadUint64(&s.searches)
+	for {
+		select {
+		case <-done:
+			return
+		case t := <-ticker.C:
+			dt := t.Sub(last).Seconds()
+			if dt <= 0 {
+				continue
+			}
+			last = t
+			rx2, tx2 := atomic.LoadUint64(&s.rx), atomic.LoadUint64(&s.tx)
+			msgs2, searches2 := atomic.LoadUint64(&s.msgs), atomic.LoadUint64(&s.searches)
+			s.rates.Store(statsRates{
+				rx:       uint64(float64(rx2-rx) / dt),
+				tx:       uint64(float64(tx2-tx) / dt),
+				msgs:     float64(msgs2-msgs) / dt,
+				searches: float64(searches2-searches) / dt,
+			})
+			rx, tx, msgs, searches = rx2, tx2, msgs2, searches2
+		}
+	}
+}
+
+func (s *hubStats) traffic() *TrafficStats {
+	r, _ := s.rates.Load().(statsRates)
+	return &TrafficStats{
+		RxBytes:     atomic.LoadUint64(&s.rx),
+		TxBytes:     atomic.LoadUint64(&s.tx),
+		RxRate:      r.rx,
+		TxRate:      r.tx,
+		Messages:    atomic.LoadUint64(&s.msgs),
+		Searches:    atomic.LoadUint64(&s.searches),
+		MessageRate: r.msgs,
+		SearchRate:  r.searches,
+	}
+}
+
+func (s *hubStats) protoCounter(p Peer) *int64 {
+	switch PeerProtocol(p) {
+	case ProtoNMDC:
+		return &s.users.nmdc
+	case ProtoADC:
+		return &s.users.adc
+	case ProtoIRC:
+		return &s.users.irc
+	case ProtoMatrix:
+		return &s.users.matrix
+	case ProtoXMPP:
+		return &s.users.xmpp
+	case ProtoBot:
+		return &s.users.bots
+	}
+	return nil
+}
+
+func (s *hubStats) protocols() map[string]int {
+	return map[string]int{
+		ProtoNMDC:   int(atomic.LoadInt64(&s.users.nmdc)),
+		ProtoADC:    int(atomic.LoadInt64(&s.users.adc)),
+		ProtoIRC:    int(atomic.LoadInt64(&s.users.irc)),
+		ProtoMatrix: int(atomic.LoadInt64(&s.users.matrix)),
+		ProtoXMPP:   int(atomic.LoadInt64(&s.users.xmpp)),
+		ProtoBot:    int(atomic.LoadInt64(&s.users.bots)),
+	}
+}
+
+// peerJoined updates per-protocol counters and the peak number of users.
+// Should be called with peers write lock.
+func (s *hubStats) peerJoined(p Peer, users int) {
+	if cnt := s.protoCounter(p); cnt != nil {
+		atomic.AddInt64(cnt, 1)
+	}
+	for {
+		peak := atomic.LoadInt64(&s.peak)
+		if int64(users) <= peak {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&s.peak, peak, int64(users)) {
+			cntPeersPeak.Set(float64(users))
+			return
+		}
+	}
+}
+
+func (s *hubStats) peerLeft(p Peer) {
+	if cnt := s.protoCounter(p); cnt != nil {
+		atomic.AddInt64(cnt, -1)
+	}
+}
+
+func (s *hubStats) message() {
+	atomic.AddUint64(&s.msgs, 1)
+}
+
+func (s *hubStats) search() {
+	atomic.AddUint64(&s.searches, 1)
+}
+
+// wrapConn returns a connection that counts all the traffic passing through it.
+// The traffic of the connection is also counted separately, so it can be attributed to a peer.
+func (s *hubStats) wrapConn(c net.Conn) (net.Conn, *connTraffic) {
+	t := &connTraffic{last: time.Now().UnixNano()}
+	return &statsConn{Conn: c, s: s, t: t, closed: make(chan struct{})}, t
+}
+
+type statsConn struct {
+	net.Conn
+	s *hubStats
+	t *connTraffic
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mu        sync.Mutex
+	wdeadline time.Time // write deadline set by the caller
+}
+
+func (c *statsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return c.Conn.Close()
+}
+
+func (c *statsConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wdeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *statsConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wdeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *statsConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		atomic.AddUint64(&c.s.rx, uint64(n))
+		atomic.AddUint64(&c.t.rx, uint64(n))
+		atomic.StoreInt64(&c.t.last, time.Now().UnixNano())
+		cntConnBytesR.Add(float64(n))
+		throttle(&c.t.in, n)
+	}
+	return n, err
+}
+
+func (c *statsConn) Write(p []byte) (int, error) {
+	if c.s.out.getRate() <= 0 {
+		return c.write(p)
+	}
+	// Write in chunks and reserve bandwidth for each of them. Reservations are served in order,
+	// thus large writes are interleaved with writes of other connections instead of blocking them.
+	var total int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > outChunk {
+			chunk = chunk[:outChunk]
+		}
+		if err := c.waitOut(len(chunk)); err != nil {
+			return total, err
+		}
+		n, err := c.write(chunk)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// waitOut waits for the outbound bandwidth to send n bytes. It returns an error if the connection
+// is closed while waiting. The time spent waiting doesn't count against the write deadline.
+func (c *statsConn) waitOut(n int) error {
+	d := c.s.out.take(n, time.Now())
+	if d <= 0 {
+		return nil
+	}
+	cntHubOutThrottled.Add(d.Seconds())
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-c.closed:
+		return errConnClosed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wdeadline.IsZero() {
+		return nil
+	}
+	c.wdeadline = c.wdeadline.Add(d)
+	return c.Conn.SetWriteDeadline(c.wdeadline)
+}
+
+func (c *statsConn) write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		atomic.AddUint64(&c.s.tx, uint64(n))
+		atomic.AddUint64(&c.t.tx, uint64(n))
+		cntConnBytesW.Add(float64(n))
+	}
+	return n, err
+}
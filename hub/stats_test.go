@@ -0,0 +1,113 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+func TestStatsJoinLeave(t *testing.T) {
+	th := newTestHarness(t, Config{})
+	defer th.Close()
+
+	st := th.h.Stats()
+	base := st.Users // the hub bot
+	require.Equal(t, 1, st.Protocols[ProtoBot])
+	require.Equal(t, 0, st.Protocols[ProtoADC])
+
+	alice := th.JoinADC("alice")
+	bob := th.JoinADC("bob")
+	st = th.h.Stats()
+	require.Equal(t, base+2, st.Users)
+	require.Equal(t, base+2, st.PeakUsers)
+	require.Equal(t, 2, st.Protocols[ProtoADC])
+	require.NotZero(t, st.Traffic.RxBytes)
+	require.NotZero(t, st.Traffic.TxBytes)
+
+	msgs, searches := st.Traffic.Messages, st.Traffic.Searches
+	alice.Chat("hello")
+	alice.Search("term")
+	th.Sync(alice)
+	st = th.h.Stats()
+	require.Equal(t, msgs+1, st.Traffic.Messages)
+	require.Equal(t, searches+1, st.Traffic.Searches)
+
+	// the peak is kept after users leave
+	bob.Close()
+	alice.ExpectQuit(bob)
+	st = th.h.Stats()
+	require.Equal(t, base+1, st.Users)
+	require.Equal(t, base+2, st.PeakUsers)
+	require.Equal(t, 1, st.Protocols[ProtoADC])
+	require.Equal(t, 1, st.Protocols[ProtoBot])
+}
+
+func TestShareTotals(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	p1 := newTestADCPeer(t, h, "p1")
+	p2 := newTestADCPeer(t, h, "p2")
+	update := func(p *adcPeer, data string) {
+		err := h.adcUpdateInfo(p, &adc.BroadcastPacket{
+			ID:         p.SID(),
+			BasePacket: adc.BasePacket{Name: (adc.User{}).Cmd(), Data: []byte(data)},
+		})
+		require.NoError(t, err)
+	}
+	check := func(share, files, avg uint64) {
+		t.Helper()
+		st := h.Stats()
+		require.Equal(t, share, st.Share)
+		require.Equal(t, files, st.Files)
+		require.Equal(t, avg, st.AvgShare)
+	}
+	check(0, 0, 0)
+
+	// p2 shares less than 1 MB, thus it is not counted in the average
+	update(p1, "SS2097152 SF10")
+	check(2, 10, 2)
+	update(p2, "SS4194304 SF5")
+	check(6, 15, 3)
+
+	// users that stop sharing are not counted in the average
+	update(p1, "SS0 SF0")
+	check(4, 5, 4)
+	update(p1, "SS1000 SF1")
+	check(4, 6, 4)
+
+	h.leave(p2, p2.SID(), nil)
+	check(0, 1, 0)
+}
+
+func TestStatsEncoding(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	require.Equal(t, "utf-8", h.Stats().Enc)
+	require.Equal(t, "utf-8", h.nmdcEncodingName())
+
+	h, err = NewHub(Config{NMDCEncoding: "cp1251"})
+	require.NoError(t, err)
+	require.Equal(t, "windows-1251", h.Stats().Enc)
+	require.Equal(t, "windows-1251", h.nmdcEncodingName())
+}
+
+func TestPeerProtocol(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+
+	a := newTestADCPeer(t, h, "alice")
+	cid := CID{1}
+	setTestCID(h, a, cid)
+	i, _ := newTestIRCPeer(t, h, "bob")
+
+	require.Equal(t, ProtoADC, PeerProtocol(a))
+	require.Equal(t, ProtoIRC, PeerProtocol(i))
+	require.Equal(t, ProtoBot, PeerProtocol(h.PeerByName(h.getName())))
+
+	// only ADC peers have client IDs
+	require.Equal(t, cid, a.CID())
+	require.True(t, i.CID().IsZero())
+}
@@ -0,0 +1,201 @@
+package hub
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultLocale is the locale of system messages if the hub doesn't set one.
+const DefaultLocale = "en"
+
+// IDs of system messages sent by the hub. Messages are text/template templates,
+// the comments list the fields available to each of them.
+const (
+	TextTopic           = "topic" // .Topic
+	TextNickTaken       = "nick_taken"
+	TextNickReserved    = "nick_reserved"
+	TextHubFull         = "hub_full"
+	TextInsecure        = "insecure"
+	TextBadPassword     = "bad_password"
+	TextLoginFailed     = "login_failed" // .Reason
+	TextRulesAccept     = "rules_accept" // .Rules, .Command, .Timeout
+	TextRulesTimeout    = "rules_timeout"
+	TextRulesAccepted   = "rules_accepted"
+	TextRulesNone       = "rules_none"
+	TextRulesRequired   = "rules_required"
+	TextKicked          = "kicked" // .By
+	TextRoomJoined      = "room_joined"
+	TextRoomParted      = "room_parted"
+	TextSlowMode        = "slow_mode"      // .Wait
+	TextRoomInvite      = "room_invite"    // .From, .Room, .Command, .Expires
+	TextRoomKicked      = "room_kicked"    // .Room, .By, .Reason
+	TextExtRequired     = "ext_required"   // .Feature
+	TextExtRestricted   = "ext_restricted" // .Feature
+	TextPMUnsupported   = "pm_unsupported" // .Name
+	TextAuthUnsupported = "auth_unsupported"
+)
+
+// Texts is a catalog of system messages: locale -> message ID -> template.
+type Texts map[string]map[string]string
+
+// DefaultTexts is a built-in catalog of system messages.
+var DefaultTexts = Texts{
+	"en": {
+		TextTopic:           "topic: {{.Topic}}",
+		TextNickTaken:       "nick taken",
+		TextNickReserved:    "this name is reserved",
+		TextHubFull:         "hub is full",
+		TextInsecure:        "connection is insecure",
+		TextBadPassword:     "wrong password",
+		TextLoginFailed:     "handshake failed: {{.Reason}}",
+		TextRulesAccept:     "{{.Rules}}\n\nPlease type !{{.Command}} within {{.Timeout}} to accept the rules.",
+		TextRulesTimeout:    "rules were not accepted in time",
+		TextRulesAccepted:   "thank you for accepting the rules",
+		TextRulesNone:       "nothing to accept",
+		TextRulesRequired:   "please accept the rules first",
+		TextKicked:          "you were kicked by {{.By}}",
+		TextRoomJoined:      "joined",
+		TextRoomParted:      "parted",
+		TextSlowMode:        "slow mode is enabled, please wait {{.Wait}}",
+		TextRoomInvite:      "{{.From}} invites you to {{.Room}}, type !{{.Command}} within {{.Expires}} to join",
+		TextRoomKicked:      "you were kicked from {{.Room}} by {{.By}}{{if .Reason}}: {{.Reason}}{{end}}",
+		TextExtRequired:     "your client must support {{.Feature}} to use this hub",
+		TextExtRestricted:   "your client does not support {{.Feature}}, searches and downloads are disabled until you upgrade it",
+		TextPMUnsupported:   "{{.Name}} does not accept private messages",
+		TextAuthUnsupported: "this name is registered, but the account cannot be used with ADC clients",
+	},
+	"ru": {
+		TextTopic:           "тема: {{.Topic}}",
+		TextNickTaken:       "ник занят",
+		TextNickReserved:    "этот ник зарезервирован",
+		TextHubFull:         "хаб переполнен",
+		TextInsecure:        "соединение не защищено",
+		TextBadPassword:     "неверный пароль",
+		TextLoginFailed:     "ошибка входа: {{.Reason}}",
+		TextRulesAccept:     "{{.Rules}}\n\nЧтобы принять правила, наберите !{{.Command}} в течение {{.Timeout}}.",
+		TextRulesTimeout:    "правила не были приняты вовремя",
+		TextRulesAccepted:   "спасибо, что приняли правила",
+		TextRulesNone:       "нечего принимать",
+		TextRulesRequired:   "сначала примите правила",
+		TextKicked:          "вас выкинул {{.By}}",
+		TextRoomJoined:      "вошёл",
+		TextRoomParted:      "вышел",
+		TextSlowMode:        "включён медленный режим, подождите {{.Wait}}",
+		TextRoomInvite:      "{{.From}} приглашает вас в {{.Room}}, наберите !{{.Command}} в течение {{.Expires}}, чтобы войти",
+		TextRoomKicked:      "{{.By}} выкинул вас из {{.Room}}{{if .Reason}}: {{.Reason}}{{end}}",
+		TextExtRequired:     "для входа на хаб клиент должен поддерживать {{.Feature}}",
+		TextExtRestricted:   "ваш клиент не поддерживает {{.Feature}}, поиск и скачивание отключены до его обновления",
+		TextPMUnsupported:   "{{.Name}} не принимает личные сообщения",
+		TextAuthUnsupported: "этот ник зарегистрирован, но учётную запись нельзя использовать с ADC-клиентами",
+	},
+}
+
+// textArgs are the fields passed to message templates.
+type textArgs map[string]interface{}
+
+// errTexts maps errors returned to users to message IDs.
+var errTexts = map[error]string{
+	errNickTaken:        TextNickTaken,
+	errNameReserved:     TextNickReserved,
+	errConnInsecure:     TextInsecure,
+	errRulesNotAccepted: TextRulesRequired,
+}
+
+// textCatalog holds parsed message templates. It is immutable after creation.
+type textCatalog map[string]map[string]*template.Template
+
+// newTextCatalog parses the default catalog merged with the overrides.
+// Overrides may replace individual messages or add new locales.
+func newTextCatalog(override Texts) (textCatalog, error) {
+	c := make(textCatalog)
+	for _, texts := range []Texts{DefaultTexts, override} {
+		for loc, msgs := range texts {
+			loc = normLocale(loc)
+			m := c[loc]
+			if m == nil {
+				m = make(map[string]*template.Template)
+				c[loc] = m
+			}
+			for id, text := range msgs {
+				t, err := template.New(id).Parse(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid text %q for locale %q: %v", id, loc, err)
+				}
+				m[id] = t
+			}
+		}
+	}
+	return c, nil
+}
+
+// normLocale converts locale names like "ru_RU" to "ru-ru".
+func normLocale(loc string) string {
+	return strings.ToLower(strings.Replace(loc, "_", "-", -1))
+}
+
+// lookup finds a message template in a given locale. It falls back to the language without the region.
+func (c textCatalog) lookup(loc, id string) *template.Template {
+	if loc == "" {
+		return nil
+	}
+	loc = normLocale(loc)
+	if t := c[loc][id]; t != nil {
+		return t
+	}
+	if i := strings.IndexByte(loc, '-'); i > 0 {
+		return c[loc[:i]][id]
+	}
+	return nil
+}
+
+// peerLocale is implemented by peers that report a preferred locale.
+type peerLocale interface {
+	Locale() string
+}
+
+func (h *Hub) getLocale() string {
+	h.conf.RLock()
+	loc := h.conf.Locale
+	h.conf.RUnlock()
+	return loc
+}
+
+func (h *Hub) setLocale(loc string) {
+	h.conf.Lock()
+	h.conf.Locale = loc
+	h.conf.Unlock()
+}
+
+// text renders a system message for the peer. The locale reported by the peer is preferred
+// over the hub's locale. Peer may be nil.
+func (h *Hub) text(peer Peer, id string, args textArgs) string {
+	var t *template.Template
+	if p, ok := peer.(peerLocale); ok {
+		t = h.texts.lookup(p.Locale(), id)
+	}
+	if t == nil {
+		t = h.texts.lookup(h.getLocale(), id)
+	}
+	if t == nil {
+		t = h.texts.lookup(DefaultLocale, id)
+	}
+	if t == nil {
+		return id
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := t.Execute(buf, args); err != nil {
+		h.hubError("cannot render text %q: %v", id, err)
+		return id
+	}
+	return buf.String()
+}
+
+// errText returns a localized text for the error sent to the peer.
+func (h *Hub) errText(peer Peer, err error) string {
+	if id, ok := errTexts[err]; ok {
+		return h.text(peer, id, nil)
+	}
+	return err.Error()
+}
@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testLocalePeer struct {
+	Peer
+	loc string
+}
+
+func (p testLocalePeer) Locale() string {
+	return p.loc
+}
+
+func TestTexts(t *testing.T) {
+	h, err := NewHub(Config{
+		BotName: "HubBot",
+		Locale:  "ru",
+		Texts: Texts{
+			"ru": {TextTopic: "Тема: {{.Topic}}!"},
+			"DE": {TextRulesNone: "nichts"},
+		},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.Equal(t, "GoHub", h.getName())
+	require.NotNil(t, h.PeerByName("HubBot"))
+	require.Nil(t, h.PeerByName("GoHub"))
+
+	// override and the default text of the hub locale
+	require.Equal(t, "Тема: x!", h.text(nil, TextTopic, textArgs{"Topic": "x"}))
+	require.Equal(t, "ник занят", h.errText(nil, errNickTaken))
+
+	// user locale with a region falls back to the language, then to the hub locale
+	p := testLocalePeer{loc: "de_DE"}
+	require.Equal(t, "nichts", h.text(p, TextRulesNone, nil))
+	require.Equal(t, "ник занят", h.text(p, TextNickTaken, nil))
+
+	// unknown locale falls back to the default one
+	h.SetConfigString("locale", "xx")
+	require.Equal(t, "nick taken", h.text(nil, TextNickTaken, nil))
+	require.Equal(t, "unknown error", h.errText(nil, errors.New("unknown error")))
+	require.Equal(t, "unknown", h.text(nil, "unknown", nil))
+
+	_, err = NewHub(Config{Texts: Texts{"en": {TextTopic: "{{.Topic"}}})
+	require.Error(t, err)
+}
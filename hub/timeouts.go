@@ -0,0 +1,84 @@
+package hub
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHandshakeTimeout = 5 * time.Second
+	defaultWriteTimeout     = 10 * time.Second
+)
+
+// Timeouts configures connection timeouts for all protocols served by the hub.
+type Timeouts struct {
+	// Handshake is the time allowed for a single step of the protocol handshake.
+	// Zero value means the default of 5 seconds.
+	Handshake time.Duration
+	// ReadIdle disconnects peers that haven't sent anything (including keep-alive messages)
+	// within this time. Zero value disables the limit.
+	ReadIdle time.Duration
+	// Write is the time allowed to write a message or a batch of messages to a peer.
+	// Zero value means the default of 10 seconds.
+	Write time.Duration
+}
+
+func (t Timeouts) handshake() time.Duration {
+	if t.Handshake <= 0 {
+		return defaultHandshakeTimeout
+	}
+	return t.Handshake
+}
+
+func (t Timeouts) write() time.Duration {
+	if t.Write <= 0 {
+		return defaultWriteTimeout
+	}
+	return t.Write
+}
+
+// handshakeDeadline returns a deadline for the next handshake step.
+func (h *Hub) handshakeDeadline() time.Time {
+	return time.Now().Add(h.conf.Timeouts.handshake())
+}
+
+// wrapIdle enforces the read idle timeout on the connection, if it's enabled.
+func (h *Hub) wrapIdle(c net.Conn) net.Conn {
+	if h.conf.Timeouts.ReadIdle <= 0 {
+		return c
+	}
+	return &idleConn{Conn: c, idle: h.conf.Timeouts.ReadIdle}
+}
+
+// idleConn sets a read deadline before each read, unless an explicit deadline is set.
+type idleConn struct {
+	net.Conn
+	idle time.Duration
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.deadline.IsZero() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.idle))
+	}
+	c.mu.Unlock()
+	return c.Conn.Read(p)
+}
+
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *idleConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
@@ -0,0 +1,47 @@
+package hub
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleConn(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	h := &Hub{}
+	h.conf.Timeouts.ReadIdle = 100 * time.Millisecond
+	c := h.wrapIdle(c1)
+
+	go func() {
+		// keep the connection active for a while
+		for i := 0; i < 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+			_, _ = c2.Write([]byte("|"))
+		}
+	}()
+	buf := make([]byte, 1)
+	for i := 0; i < 3; i++ {
+		_, err := c.Read(buf)
+		require.NoError(t, err)
+	}
+	start := time.Now()
+	_, err := c.Read(buf)
+	require.Error(t, err)
+	e, ok := err.(net.Error)
+	require.True(t, ok && e.Timeout())
+	require.True(t, time.Since(start) < time.Second)
+
+	// explicit deadline takes precedence
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(300*time.Millisecond)))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = c2.Write([]byte("|"))
+	}()
+	_, err = c.Read(buf)
+	require.NoError(t, err)
+}
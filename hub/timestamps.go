@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chatTimeFormat is the format of timestamps in chat messages relayed by the hub.
+const chatTimeFormat = "15:04:05"
+
+// maxTZOffset is the maximal absolute value of a time zone offset set by the user.
+const maxTZOffset = 14 * time.Hour
+
+// getTimeZone returns the time zone of the hub. It is never nil.
+func (h *Hub) getTimeZone() *time.Location {
+	h.conf.RLock()
+	loc := h.conf.tz
+	h.conf.RUnlock()
+	if loc == nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (h *Hub) setTimeZone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	h.conf.Lock()
+	h.conf.TimeZone = name
+	h.conf.tz = loc
+	h.conf.Unlock()
+	return nil
+}
+
+func (h *Hub) chatTimestamps() bool {
+	h.conf.RLock()
+	v := h.conf.ChatTimestamps
+	h.conf.RUnlock()
+	return v
+}
+
+func (h *Hub) setChatTimestamps(v bool) {
+	h.conf.Lock()
+	h.conf.ChatTimestamps = v
+	h.conf.Unlock()
+}
+
+// setTZOffset sets a time zone offset for the peer. Nil value resets it to the hub time zone.
+func (p *BasePeer) setTZOffset(loc *time.Location) {
+	p.tz.Lock()
+	p.tz.loc = loc
+	p.tz.Unlock()
+}
+
+// tzOffset returns the time zone set by the peer, or nil if the hub time zone should be used.
+func (p *BasePeer) tzOffset() *time.Location {
+	p.tz.Lock()
+	loc := p.tz.loc
+	p.tz.Unlock()
+	return loc
+}
+
+// peerTime converts the time to the time zone of the peer. Peer may be nil.
+func (h *Hub) peerTime(peer Peer, t time.Time) time.Time {
+	if peer != nil {
+		if loc := peer.base().tzOffset(); loc != nil {
+			return t.In(loc)
+		}
+	}
+	return t.In(h.getTimeZone())
+}
+
+// stampMsg prefixes the text of the chat message with its timestamp in the time zone of the peer.
+func (h *Hub) stampMsg(peer Peer, m Message) Message {
+	m.Text = "[" + h.peerTime(peer, m.Time).Format(chatTimeFormat) + "] " + m.Text
+	return m
+}
+
+// parseTZOffset parses a fixed time zone offset like "+3", "-05:30" or "UTC+2".
+func parseTZOffset(s string) (*time.Location, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimPrefix(strings.TrimPrefix(name, "UTC"), "GMT")
+	if s == "" {
+		return time.UTC, nil
+	}
+	sign := time.Duration(1)
+	switch s[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return nil, fmt.Errorf("expected a time zone offset like +3 or -05:30, got: %q", name)
+	}
+	s = s[1:]
+	hs, ms := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		hs, ms = s[:i], s[i+1:]
+	}
+	hours, err := strconv.ParseUint(hs, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone offset: %q", name)
+	}
+	off := time.Duration(hours) * time.Hour
+	if ms != "" {
+		mins, err := strconv.ParseUint(ms, 10, 8)
+		if err != nil || mins >= 60 {
+			return nil, fmt.Errorf("invalid time zone offset: %q", name)
+		}
+		off += time.Duration(mins) * time.Minute
+	}
+	if off > maxTZOffset {
+		return nil, errors.New("time zone offset is out of range")
+	}
+	off *= sign
+	return time.FixedZone("UTC"+formatTZOffset(off), int(off/time.Second)), nil
+}
+
+// formatTZOffset formats the offset as "+03:00".
+func formatTZOffset(off time.Duration) string {
+	sign := '+'
+	if off < 0 {
+		sign = '-'
+		off = -off
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, int(off/time.Hour), int(off%time.Hour/time.Minute))
+}
+
+func (h *Hub) cmdTimeZone(p Peer, args string) error {
+	switch args = strings.TrimSpace(args); args {
+	case "":
+	case "hub", "reset":
+		p.base().setTZOffset(nil)
+	default:
+		loc, err := parseTZOffset(args)
+		if err != nil {
+			return err
+		}
+		p.base().setTZOffset(loc)
+	}
+	now := h.peerTime(p, time.Now())
+	_, off := now.Zone()
+	h.cmdOutputf(p, "your time zone is UTC%s, current time: %s",
+		formatTZOffset(time.Duration(off)*time.Second), now.Format(chatTimeFormat))
+	return nil
+}
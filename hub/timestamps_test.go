@@ -0,0 +1,55 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var casesTZOffset = []struct {
+	in  string
+	off time.Duration
+	err bool
+}{
+	{in: "", off: 0},
+	{in: "UTC", off: 0},
+	{in: "+3", off: 3 * time.Hour},
+	{in: "-05:30", off: -5*time.Hour - 30*time.Minute},
+	{in: "utc+2", off: 2 * time.Hour},
+	{in: "GMT-1", off: -time.Hour},
+	{in: "3", err: true},
+	{in: "+3:60", err: true},
+	{in: "+15", err: true},
+	{in: "+x", err: true},
+}
+
+func TestParseTZOffset(t *testing.T) {
+	for _, c := range casesTZOffset {
+		t.Run(c.in, func(t *testing.T) {
+			loc, err := parseTZOffset(c.in)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_, off := time.Date(2019, 1, 1, 0, 0, 0, 0, loc).Zone()
+			require.Equal(t, c.off, time.Duration(off)*time.Second)
+		})
+	}
+}
+
+func TestStampMsg(t *testing.T) {
+	h, err := NewHub(Config{TimeZone: "Etc/GMT-2"})
+	require.NoError(t, err)
+	defer h.Close()
+
+	ts := time.Date(2019, 5, 1, 10, 20, 30, 0, time.UTC)
+	m := h.stampMsg(nil, Message{Time: ts, Text: "hi"})
+	require.Equal(t, "[12:20:30] hi", m.Text)
+
+	p := &botPeer{}
+	p.setTZOffset(time.FixedZone("", -3600))
+	m = h.stampMsg(p, Message{Time: ts, Text: "hi"})
+	require.Equal(t, "[09:20:30] hi", m.Text)
+}
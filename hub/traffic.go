@@ -0,0 +1,195 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PermThrottle allows limiting the bandwidth of individual users.
+const PermThrottle = "user.throttle"
+
+// AuditThrottle is recorded in the audit log when a user is throttled.
+const AuditThrottle = "throttle"
+
+// errConnClosed is returned by writes that were waiting for the bandwidth when the connection was closed.
+var errConnClosed = errors.New("connection closed")
+
+// tokenBucket is a rate limiter that allows bursts up to the rate for one second.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes/sec; zero means no limit
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setRate(rate int64) {
+	b.mu.Lock()
+	b.rate = float64(rate)
+	b.tokens = b.rate
+	b.last = time.Now()
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) getRate() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(b.rate)
+}
+
+// take consumes n tokens and returns the time the caller should wait
+// for the bucket to refill. Tokens may go into debt.
+func (b *tokenBucket) take(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	if dt := now.Sub(b.last).Seconds(); dt > 0 {
+		b.tokens += dt * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// connTraffic counts bytes transferred by a single connection and optionally throttles it.
+type connTraffic struct {
+	rx, tx uint64 // atomic
+	last   int64  // atomic, unix nano; the time of the last read
+	// in limits the inbound traffic of the connection.
+	in tokenBucket
+}
+
+// throttle waits for the bucket to refill after transferring n bytes.
+func throttle(b *tokenBucket, n int) {
+	if d := b.take(n, time.Now()); d > 0 {
+		cntConnThrottled.Add(d.Seconds())
+		time.Sleep(d)
+	}
+}
+
+// PeerTraffic returns the number of bytes received from and sent to the peer.
+// Virtual peers have no traffic.
+func PeerTraffic(p Peer) (rx, tx uint64) {
+	c := p.ConnInfo()
+	if c == nil || c.traffic == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&c.traffic.rx), atomic.LoadUint64(&c.traffic.tx)
+}
+
+// ThrottlePeer limits the inbound traffic of the peer to a given number of bytes per second.
+// Zero rate removes the limit.
+func (h *Hub) ThrottlePeer(p Peer, rate int64) error {
+	c := p.ConnInfo()
+	if c == nil || c.traffic == nil {
+		return errors.New("cannot throttle a virtual user: " + p.Name())
+	}
+	if rate < 0 {
+		rate = 0
+	}
+	c.traffic.in.setRate(rate)
+	return nil
+}
+
+// peerThrottle returns the inbound limit of the peer, or zero if it's not throttled.
+func peerThrottle(p Peer) int64 {
+	c := p.ConnInfo()
+	if c == nil || c.traffic == nil {
+		return 0
+	}
+	return c.traffic.in.getRate()
+}
+
+// parseRate parses a rate in bytes per second with an optional K or M suffix, for example "64K".
+func parseRate(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(s), "/S")
+	mul := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mul, s = 1024, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		mul, s = 1024*1024, strings.TrimSuffix(s, "M")
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate: %q", s)
+	} else if v <= 0 {
+		return 0, errors.New("rate must be positive")
+	}
+	return v * mul, nil
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1024*1024*1024))
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func (h *Hub) cmdThrottle(p Peer, args string) error {
+	name, arg := cutReason(strings.TrimSpace(args))
+	if name == "" {
+		return errors.New("usage: throttle <nick> [rate|off]")
+	}
+	peer := h.PeerByName(name)
+	if peer == nil {
+		return errors.New("no such user: " + name)
+	}
+	if arg == "" {
+		rx, tx := PeerTraffic(peer)
+		s := fmt.Sprintf("%s: received %s, sent %s", peer.Name(), formatBytes(rx), formatBytes(tx))
+		if rate := peerThrottle(peer); rate > 0 {
+			s += fmt.Sprintf(", throttled to %s/s", formatBytes(uint64(rate)))
+		}
+		h.cmdOutput(p, s)
+		return nil
+	}
+	var rate int64
+	if arg != "off" && arg != "0" {
+		v, err := parseRate(arg)
+		if err != nil {
+			return err
+		}
+		rate = v
+	}
+	if err := h.ThrottlePeer(peer, rate); err != nil {
+		return err
+	}
+	if rate == 0 {
+		h.audit(AuditThrottle, p, peer.Name(), "off")
+		h.cmdOutput(p, "throttling disabled for "+peer.Name())
+		return nil
+	}
+	h.audit(AuditThrottle, p, peer.Name(), formatBytes(uint64(rate))+"/s")
+	h.cmdOutput(p, fmt.Sprintf("%s is throttled to %s/s", peer.Name(), formatBytes(uint64(rate))))
+	return nil
+}
+
+// outChunk is the size of a single write when the outbound traffic of the hub is limited.
+const outChunk = 4096
+
+// setOutRate limits the outbound traffic of the hub, shared by all connections.
+// Zero rate removes the limit.
+func (h *Hub) setOutRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+	h.stats.out.setRate(rate)
+}
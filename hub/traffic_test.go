@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	var b tokenBucket
+	now := time.Now()
+	require.Equal(t, time.Duration(0), b.take(1<<20, now))
+
+	b.setRate(1000)
+	now = b.last
+	// burst of one second is allowed
+	require.Equal(t, time.Duration(0), b.take(1000, now))
+	require.Equal(t, time.Second/2, b.take(500, now))
+	// the debt is paid after the wait
+	now = now.Add(time.Second / 2)
+	require.Equal(t, time.Duration(0), b.take(0, now))
+	require.Equal(t, 100*time.Millisecond, b.take(100, now))
+}
+
+func TestParseRate(t *testing.T) {
+	for s, exp := range map[string]int64{
+		"100":    100,
+		"16K":    16 * 1024,
+		"2m":     2 * 1024 * 1024,
+		"64kb/s": -1,
+		"64k/s":  64 * 1024,
+		"0":      -1,
+		"x":      -1,
+	} {
+		v, err := parseRate(s)
+		if exp < 0 {
+			require.Error(t, err, s)
+			continue
+		}
+		require.NoError(t, err, s)
+		require.Equal(t, exp, v, s)
+	}
+}
+
+func TestConnTraffic(t *testing.T) {
+	var s hubStats
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn, tr := s.wrapConn(c1)
+	go func() {
+		_, _ = c2.Write(make([]byte, 300))
+		_, _ = io.ReadFull(c2, make([]byte, 100))
+	}()
+	_, err := io.ReadFull(conn, make([]byte, 300))
+	require.NoError(t, err)
+	_, err = conn.Write(make([]byte, 100))
+	require.NoError(t, err)
+
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	p := newTestADCPeer(t, h, "user")
+	p.cinfo.traffic = tr
+
+	rx, tx := PeerTraffic(p)
+	require.Equal(t, uint64(300), rx)
+	require.Equal(t, uint64(100), tx)
+	require.Equal(t, s.traffic().RxBytes, rx)
+
+	require.NoError(t, h.ThrottlePeer(p, 100))
+	require.Equal(t, int64(100), peerThrottle(p))
+
+	// virtual peers cannot be throttled
+	require.Error(t, h.ThrottlePeer(h.hubUser.p, 100))
+}
+
+func TestOutboundLimit(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetConfigInt(ConfigBandwidthOut, 10*outChunk)
+	v, ok := h.GetConfigInt(ConfigBandwidthOut)
+	require.True(t, ok)
+	require.Equal(t, int64(10*outChunk), v)
+
+	c1, _ := h.stats.wrapConn(discardConn{})
+	c2, _ := h.stats.wrapConn(discardConn{})
+	start := time.Now()
+	// the burst is shared by all connections
+	n, err := c1.Write(make([]byte, 10*outChunk))
+	require.NoError(t, err)
+	require.Equal(t, 10*outChunk, n)
+	_, err = c2.Write(make([]byte, 2*outChunk))
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 150*time.Millisecond)
+
+	h.SetConfigInt(ConfigBandwidthOut, 0)
+	start = time.Now()
+	_, err = c2.Write(make([]byte, 100*outChunk))
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestOutboundLimitDeadline(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetConfigInt(ConfigBandwidthOut, 10*outChunk)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, c2)
+	}()
+	conn, _ := h.stats.wrapConn(c1)
+	_, err = conn.Write(make([]byte, 10*outChunk))
+	require.NoError(t, err)
+
+	// waiting for the bandwidth doesn't count against the write timeout
+	require.NoError(t, conn.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Write(make([]byte, 2*outChunk))
+	require.NoError(t, err)
+
+	// closing the connection aborts the wait
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(make([]byte, 100*outChunk))
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	require.NoError(t, conn.Close())
+	require.Error(t, <-errc)
+	require.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"net"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+)
+
+// reportedIP returns the IP address of the peer shown to operators, or an empty string if it has none.
+//
+// For ADC peers it is the address from the user info, which is validated by the hub on login
+// and is the same address ADC users see.
+func reportedIP(p Peer) string {
+	switch p := p.(type) {
+	case *adcPeer:
+		p.info.RLock()
+		ip4, ip6 := p.info.user.Ip4, p.info.user.Ip6
+		p.info.RUnlock()
+		if ip4 != "" {
+			return ip4
+		} else if ip6 != "" {
+			return ip6
+		}
+	case *nmdcPeer:
+		if p.ip != nil {
+			return p.ip.String()
+		}
+	}
+	if addr, ok := p.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// canSeeIP checks if the peer is allowed to see the IP address of another peer.
+// Users can always see their own address.
+func canSeeIP(p, p2 Peer) bool {
+	return p == p2 || p.User().HasPerm(PermIP)
+}
+
+// userIPs returns addresses of the users with given names that the peer is allowed to see.
+func (h *Hub) userIPs(p Peer, names []string) []nmdcp.UserAddress {
+	var ips []nmdcp.UserAddress
+	for _, name := range names {
+		p2 := h.PeerByName(name)
+		if p2 == nil || !canSeeIP(p, p2) {
+			continue
+		}
+		if ip := reportedIP(p2); ip != "" {
+			ips = append(ips, nmdcp.UserAddress{Name: p2.Name(), IP: ip})
+		}
+	}
+	return ips
+}
@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"testing"
+
+	nmdcp "github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNMDCUserIP(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	a := newTestADCPeer(t, h, "adc")
+	a.info.user.Ip4 = "10.0.0.7"
+
+	user := loginNMDC(t, h, 1, "user", loginDCPP)
+	user.expect("Supports")
+	user.join(loginDCPP)
+	ips, ok := user.expect("UserIP").(*nmdcp.UserIP)
+	require.True(t, ok)
+	require.Equal(t, []nmdcp.UserAddress{{Name: "user", IP: "127.0.0.1"}}, ips.List)
+
+	// users can only see their own address
+	user.send("$UserIP adc$$user$$|")
+	ips, ok = user.expect("UserIP").(*nmdcp.UserIP)
+	require.True(t, ok)
+	require.Equal(t, []nmdcp.UserAddress{{Name: "user", IP: "127.0.0.1"}}, ips.List)
+
+	op := h.PeerByName("user")
+	op.(*nmdcPeer).setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	user.send("$UserIP adc$$user$$missing$$|")
+	ips, ok = user.expect("UserIP").(*nmdcp.UserIP)
+	require.True(t, ok)
+	require.Equal(t, []nmdcp.UserAddress{
+		{Name: "adc", IP: "10.0.0.7"},
+		{Name: "user", IP: "127.0.0.1"},
+	}, ips.List)
+
+	// operators are notified about addresses of users that join
+	other := loginNMDC(t, h, 2, "other", loginDCPP)
+	other.expect("Supports")
+	other.join(loginDCPP)
+	ips, ok = user.expect("UserIP").(*nmdcp.UserIP)
+	require.True(t, ok)
+	require.Equal(t, []nmdcp.UserAddress{{Name: "other", IP: "127.0.0.1"}}, ips.List)
+}
@@ -0,0 +1,191 @@
+package hub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/direct-connect/go-dcpp/adc"
+)
+
+// UserListConfig controls how the user list is delivered to peers during login.
+//
+// On big hubs the initial user list dominates the login time and may saturate the
+// outgoing bandwidth when many users reconnect at once.
+type UserListConfig struct {
+	// BatchSize is the number of users written before the connection is flushed.
+	// Zero value means that the whole list is flushed at once.
+	BatchSize int
+	// BatchDelay is a pause between batches. It only applies if BatchSize is set.
+	BatchDelay time.Duration
+	// ZlibBurst enables compression only for the user list, instead of compressing the
+	// whole session. It is used for ADC clients that support ZLIF and saves memory for
+	// idle connections.
+	ZlibBurst bool
+	// Delta enables the DLTA extension for ADC clients. A reconnecting client presents the version
+	// of the user list from the previous session, and the hub only sends the users that joined,
+	// changed or left since then. The full list is sent if the changes are no longer available,
+	// for example after the hub restarts.
+	Delta bool
+	// Lazy enables the LINF extension for ADC clients. The user list sent on login to such clients
+	// only contains the CID, name, type, away status and features of each user. The client requests
+	// the full info of the users it needs with UIR.
+	Lazy bool
+}
+
+// listPacer splits the initial user list into batches.
+type listPacer struct {
+	size  int
+	delay time.Duration
+	n     int
+}
+
+func (h *Hub) newListPacer() *listPacer {
+	return &listPacer{
+		size:  h.conf.UserList.BatchSize,
+		delay: h.conf.UserList.BatchDelay,
+	}
+}
+
+// next must be called after each user is written to the connection.
+// It calls flush at the end of each batch and waits for the configured delay.
+func (l *listPacer) next(flush func() error) error {
+	l.n++
+	if l.size <= 0 || l.n%l.size != 0 {
+		return nil
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	cntUserListBatches.Add(1)
+	if l.delay > 0 {
+		time.Sleep(l.delay)
+	}
+	return nil
+}
+
+// newListEpoch returns a random identifier of the hub instance for user list versions.
+func newListEpoch() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// listVersion formats a user list version for a sequence number of the change feed.
+// Must be called with the feed lock held.
+func (f *changeFeed) listVersion(seq uint64) string {
+	return f.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseListVersion returns the sequence number of the change feed for a user list version.
+// It returns false if the version was issued by a different hub instance.
+// Must be called with the feed lock held.
+func (f *changeFeed) parseListVersion(vers string) (uint64, bool) {
+	i := strings.LastIndexByte(vers, '-')
+	if i < 0 || vers[:i] != f.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(vers[i+1:], 10, 64)
+	if err != nil || seq > f.seq {
+		return 0, false
+	}
+	return seq, true
+}
+
+// userListDelta returns the user list for a client that received a given version of the list.
+//
+// If delta is set, the list only contains peers that joined or changed since the version,
+// and left contains SIDs of peers that left since then and are not online. Otherwise,
+// the list contains all peers. The returned version corresponds to the state of the list.
+func (h *Hub) userListDelta(prev string) (list []Peer, left []SID, vers string, delta bool) {
+	h.peers.RLock()
+	defer h.peers.RUnlock()
+	all := h.peers.index.List()
+
+	h.feed.Lock()
+	vers = h.feed.listVersion(h.feed.seq)
+	var changes []Change
+	if seq, ok := h.feed.parseListVersion(prev); ok {
+		changes, delta = h.feed.since(seq)
+	}
+	h.feed.Unlock()
+	if !delta {
+		return all, nil, vers, false
+	}
+
+	online := make(map[string]Peer, len(all))
+	for _, p := range all {
+		online[p.SID().String()] = p
+	}
+	seen := make(map[string]struct{}, len(changes))
+	for _, c := range changes {
+		if _, ok := seen[c.Peer.SID]; ok {
+			continue
+		}
+		seen[c.Peer.SID] = struct{}{}
+		if p := online[c.Peer.SID]; p != nil {
+			list = append(list, p)
+			continue
+		}
+		var sid SID
+		if err := sid.UnmarshalAdc([]byte(c.Peer.SID)); err == nil {
+			left = append(left, sid)
+		}
+	}
+	if len(list)+len(left) >= len(all) {
+		// the full list is smaller
+		return all, nil, vers, false
+	}
+	return list, left, vers, true
+}
+
+// adcSendUserList sends the user list to a peer during login, except for the peer itself.
+// Peers with the DLTA extension receive the list version, and only the changes if possible:
+// QUI for users that left, followed by INF for users that joined or changed.
+func (h *Hub) adcSendUserList(peer *adcPeer, prev string) error {
+	if !peer.fea.IsSet(adc.FeaDLTA) {
+		return peer.peersJoin(&PeersJoinEvent{Peers: h.Peers()}, true)
+	}
+	list, left, vers, delta := h.userListDelta(prev)
+	if delta {
+		cntUserListDelta.Add(1)
+	}
+	if err := peer.c.WriteInfoMsg(adc.UserListSync{Version: vers, Delta: delta}); err != nil {
+		return err
+	}
+	// users that left first, since the same user may rejoin with a different SID
+	for _, sid := range left {
+		if err := peer.c.WriteInfoMsg(adc.Disconnect{ID: sid}); err != nil {
+			return err
+		}
+	}
+	return peer.peersJoin(&PeersJoinEvent{Peers: list}, true)
+}
+
+// adcLazyInfo returns the minimal user info sent in the user list to clients with the LINF extension.
+func adcLazyInfo(u adc.User) adc.User {
+	return adc.User{
+		Id: u.Id, Name: u.Name, Type: u.Type,
+		Away: u.Away, Features: u.Features,
+	}
+}
+
+// adcUserInfoRequest sends the full info of requested users to a peer with the LINF extension.
+func (h *Hub) adcUserInfoRequest(peer *adcPeer, req adc.UserInfoRequest) error {
+	if !peer.fea.IsSet(adc.FeaLINF) {
+		return nil
+	}
+	var list []Peer
+	for _, sid := range req.Users {
+		if p := h.peerBySID(sid); p != nil {
+			list = append(list, p)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	cntUserInfoRequests.Add(1)
+	return peer.peersJoin(&PeersJoinEvent{Peers: list}, false)
+}
@@ -0,0 +1,180 @@
+package hub
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/adc"
+	"github.com/direct-connect/go-dcpp/adc/types"
+)
+
+func TestListPacer(t *testing.T) {
+	cases := []struct {
+		name    string
+		size    int
+		n       int
+		flushes int
+	}{
+		{name: "disabled", size: 0, n: 10, flushes: 0},
+		{name: "single", size: 1, n: 3, flushes: 3},
+		{name: "batches", size: 4, n: 10, flushes: 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h, err := NewHub(Config{UserList: UserListConfig{BatchSize: c.size}})
+			require.NoError(t, err)
+
+			flushes := 0
+			l := h.newListPacer()
+			for i := 0; i < c.n; i++ {
+				err = l.next(func() error {
+					flushes++
+					return nil
+				})
+				require.NoError(t, err)
+			}
+			require.Equal(t, c.flushes, flushes)
+		})
+	}
+}
+
+// deltaLogin logs in a client with DLTA extension and returns the user list sync message.
+// Other packets of the user list are kept in the queue.
+func deltaLogin(th *testHarness, name string, pid types.PID, vers string) (*testClient, adc.UserListSync) {
+	c := th.Dial()
+	c.Name = name
+	c.Send("HSUP ADBASE ADTIGR ADDLTA")
+	var sid adc.SIDAssign
+	require.NoError(th.t, adc.Unmarshal(c.Expect("SID", nil).Message().Data, &sid))
+	c.SID = sid.SID
+	c.SendMsg("BINF "+c.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: name,
+		Slots: 1, SlotsFree: 1, HubsNormal: 1, ShareSize: 1,
+		ListVersion: vers,
+	})
+	var ls adc.UserListSync
+	require.NoError(th.t, adc.Unmarshal(c.Expect("ULS", nil).Message().Data, &ls))
+	c.ExpectJoin(c)
+	th.clients = append(th.clients, c)
+	return c, ls
+}
+
+func receivedSIDs(c *testClient, cmd string) []adc.SID {
+	var out []adc.SID
+	for _, p := range c.Received(cmd) {
+		if b, ok := p.(*adc.BroadcastPacket); ok {
+			out = append(out, b.ID)
+			continue
+		} else if cmd == "INF" {
+			continue // hub info
+		}
+		var q adc.Disconnect
+		require.NoError(c.t, adc.Unmarshal(p.Message().Data, &q))
+		out = append(out, q.ID)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].String() < out[j].String()
+	})
+	return out
+}
+
+func sortedSIDs(list ...adc.SID) []adc.SID {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+	return list
+}
+
+func TestUserListDelta(t *testing.T) {
+	th := newTestHarness(t, Config{UserList: UserListConfig{Delta: true}})
+	defer th.Close()
+	hubSID := th.h.hubUser.p.SID()
+
+	a := th.JoinADC("alice")
+	b := th.JoinADC("bob")
+	e := th.JoinADC("eve")
+	pid := types.NewPID()
+	c, ls := deltaLogin(th, "carol", pid, "")
+	require.False(t, ls.Delta)
+	require.NotEmpty(t, ls.Version)
+	require.Equal(t, sortedSIDs(hubSID, a.SID, b.SID, e.SID), receivedSIDs(c, "INF"))
+
+	c.Close()
+	b.Close()
+	d := th.JoinADC("dave")
+	th.Sync(d)
+
+	// only the changes are sent to the reconnecting client
+	c2, ls2 := deltaLogin(th, "carol", pid, ls.Version)
+	require.True(t, ls2.Delta)
+	require.NotEqual(t, ls.Version, ls2.Version)
+	require.Equal(t, sortedSIDs(c.SID, b.SID), receivedSIDs(c2, "QUI"))
+	require.Equal(t, []adc.SID{d.SID}, receivedSIDs(c2, "INF"))
+	c2.Close()
+
+	// unknown versions fall back to the full list
+	c3, ls3 := deltaLogin(th, "carol", pid, "unknown-1")
+	require.False(t, ls3.Delta)
+	require.Equal(t, sortedSIDs(hubSID, a.SID, d.SID, e.SID), receivedSIDs(c3, "INF"))
+	require.Empty(t, receivedSIDs(c3, "QUI"))
+	c3.Close()
+
+	// the extension is optional
+	require.True(t, th.h.ADCFeatures().Has(adc.FeaDLTA))
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	require.False(t, h.ADCFeatures().Has(adc.FeaDLTA))
+}
+
+func TestUserListLazy(t *testing.T) {
+	th := newTestHarness(t, Config{UserList: UserListConfig{Lazy: true}})
+	defer th.Close()
+	require.True(t, th.h.ADCFeatures().Has(adc.FeaLINF))
+
+	a := th.JoinADC("alice")
+
+	c := th.Dial()
+	c.Name = "carol"
+	c.Send("HSUP ADBASE ADTIGR ADLINF")
+	var sid adc.SIDAssign
+	require.NoError(t, adc.Unmarshal(c.Expect("SID", nil).Message().Data, &sid))
+	c.SID = sid.SID
+	pid := types.NewPID()
+	c.SendMsg("BINF "+c.SID.String(), adc.User{
+		Id: pid.Hash(), Pid: &pid, Name: c.Name,
+		Slots: 1, SlotsFree: 1, HubsNormal: 1, ShareSize: 1,
+	})
+	infoOf := func(c2 *testClient) adc.User {
+		p := c.Expect("INF", func(p adc.Packet) bool {
+			b, ok := p.(*adc.BroadcastPacket)
+			return ok && b.ID == c2.SID
+		})
+		var u adc.User
+		require.NoError(t, adc.Unmarshal(p.Message().Data, &u))
+		return u
+	}
+
+	// the user list only contains minimal info, except for the own info
+	u := infoOf(a)
+	require.Equal(t, "alice", u.Name)
+	require.Equal(t, int64(0), u.ShareSize)
+	require.Equal(t, 0, u.Slots)
+	u = infoOf(c)
+	require.Equal(t, int64(1), u.ShareSize)
+	th.clients = append(th.clients, c)
+	a.ExpectJoin(c)
+
+	// full info is sent on request
+	c.SendMsg("HUIR", adc.UserInfoRequest{Users: []adc.SID{a.SID}})
+	u = infoOf(a)
+	require.Equal(t, "alice", u.Name)
+	require.Equal(t, int64(1), u.ShareSize)
+	require.Equal(t, 1, u.Slots)
+
+	// the request is ignored for clients without the extension
+	a.SendMsg("HUIR", adc.UserInfoRequest{Users: []adc.SID{c.SID}})
+	th.Sync(a)
+	require.Empty(t, a.Received("INF"))
+}
@@ -3,6 +3,7 @@ package hub
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,6 +20,7 @@ var (
 const (
 	userNameMin = 3
 	userNameMax = 256
+	minPassLen  = 6
 )
 
 type BanKey string
@@ -128,6 +130,12 @@ type Database interface {
 	UserDatabase
 	ProfileDatabase
 	BanDatabase
+	LoginDatabase
+	AuditDatabase
+	HistoryDatabase
+	NoteDatabase
+	WatchDatabase
+	RoomDatabase
 	Close() error
 }
 
@@ -135,6 +143,14 @@ type UserRecord struct {
 	Name    string
 	Pass    string
 	Profile string
+	// RulesAccepted is the time when the user accepted the hub rules.
+	RulesAccepted time.Time
+	// Registered is the time when the user was registered.
+	Registered time.Time
+	// LastLogin is the time of the last successful login.
+	LastLogin time.Time
+	// PrevProfile is the profile the user had before being promoted to an operator.
+	PrevProfile string
 }
 
 type UserDatabase interface {
@@ -181,16 +197,15 @@ var (
 	errNameInvalidPrefix = errors.New("name start with an invalid character")
 	errNamePadding       = errors.New("name should not start or end with spaces")
 	errNameInvalidChars  = errors.New("name contains invalid characters (' ', '<', '>', etc)")
+	errNameReserved      = errors.New("name is reserved for registered users")
 )
 
 func (h *Hub) validateUserName(name string) error {
 	if name == "" {
 		return errNameEmpty
 	}
-	if len(name) > userNameMax {
-		return errNameTooLong
-	} else if len(name) < userNameMin {
-		return errNameTooShort
+	if err := h.nicks.checkLength(name); err != nil {
+		return err
 	}
 	switch name[0] {
 	case ' ', '#', '!', '+', '/':
@@ -213,6 +228,9 @@ func (h *Hub) validateUserName(name string) error {
 	}) >= 0 {
 		return errNameInvalidChars
 	}
+	if err := h.nicks.checkChars(name); err != nil {
+		return err
+	}
 	if h.fallback != nil {
 		_, err := h.fallback.NewEncoder().String(name)
 		if err != nil {
@@ -226,7 +244,7 @@ func (h *Hub) RegisterUser(name, pass string) error {
 	if h.db == nil {
 		return ErrUserRegDisabled
 	}
-	return h.db.CreateUser(UserRecord{Name: name, Pass: pass})
+	return h.db.CreateUser(UserRecord{Name: name, Pass: pass, Registered: time.Now().UTC()})
 }
 
 func (h *Hub) DeleteUser(name string) error {
@@ -254,6 +272,16 @@ func (h *Hub) UpdateUser(name string, fnc func(u *UserRecord) (bool, error)) err
 	})
 }
 
+// selfRegEnabled checks if users are allowed to register themselves.
+// It's enabled by default, if the hub has a database.
+func (h *Hub) selfRegEnabled() bool {
+	if h.db == nil {
+		return false
+	}
+	v, ok := h.GetConfigBool(ConfigUsersSelfReg)
+	return !ok || v
+}
+
 func (h *Hub) IsRegistered(name string) (bool, error) {
 	if h.db == nil {
 		return false, nil
@@ -284,6 +312,10 @@ func NewDatabase() Database {
 		users:    make(map[string]UserRecord),
 		profiles: make(map[string]Map),
 		bans:     make(map[BanKey]Ban),
+		logins:   make(map[string][]LoginRecord),
+		notes:    make(map[string][]UserNote),
+		watch:    make(map[string]WatchEntry),
+		rooms:    make(map[string]RoomInfo),
 	}
 }
 
@@ -292,6 +324,12 @@ type memDB struct {
 	users    map[string]UserRecord
 	profiles map[string]Map
 	bans     map[BanKey]Ban
+	logins   map[string][]LoginRecord // most recent first
+	audit    []AuditEntry
+	history  []ConnRecord // oldest first
+	notes    map[string][]UserNote
+	watch    map[string]WatchEntry
+	rooms    map[string]RoomInfo
 }
 
 func (*memDB) Close() error {
@@ -434,3 +472,184 @@ func (db *memDB) ClearBans() error {
 	db.mu.Unlock()
 	return nil
 }
+
+func (db *memDB) PutLogin(rec LoginRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	list := db.logins[rec.Name]
+	for i, r := range list {
+		if r.Login.Equal(rec.Login) {
+			list[i] = rec
+			return nil
+		}
+	}
+	list = append([]LoginRecord{rec}, list...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Login.After(list[j].Login)
+	})
+	if len(list) > LoginHistorySize {
+		list = list[:LoginHistorySize]
+	}
+	db.logins[rec.Name] = list
+	return nil
+}
+
+func (db *memDB) ListLogins(name string) ([]LoginRecord, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	list := db.logins[name]
+	return append([]LoginRecord(nil), list...), nil
+}
+
+func (db *memDB) AppendAudit(e AuditEntry) error {
+	db.mu.Lock()
+	db.audit = append(db.audit, e)
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *memDB) QueryAudit(q AuditQuery) ([]AuditEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var out []AuditEntry
+	for i := len(db.audit) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(out) >= q.Limit {
+			break
+		}
+		if e := db.audit[i]; q.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (db *memDB) PutConn(rec ConnRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i := len(db.history) - 1; i >= 0; i-- {
+		if r := db.history[i]; r.Name == rec.Name && r.Join.Equal(rec.Join) {
+			db.history[i] = rec
+			return nil
+		}
+	}
+	db.history = append(db.history, rec)
+	return nil
+}
+
+func (db *memDB) QueryConns(q ConnQuery) ([]ConnRecord, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var out []ConnRecord
+	for i := len(db.history) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(out) >= q.Limit {
+			break
+		}
+		if r := db.history[i]; q.Match(r) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (db *memDB) ExpireConns(before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	list := db.history[:0]
+	for _, r := range db.history {
+		if !r.Join.Before(before) {
+			list = append(list, r)
+		}
+	}
+	db.history = list
+	return nil
+}
+
+func (db *memDB) PutNote(n UserNote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	list := db.notes[n.Target]
+	for i, n2 := range list {
+		if n2.Time.Equal(n.Time) {
+			list[i] = n
+			return nil
+		}
+	}
+	list = append(list, n)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	db.notes[n.Target] = list
+	return nil
+}
+
+func (db *memDB) ListNotes(target string) ([]UserNote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return append([]UserNote(nil), db.notes[target]...), nil
+}
+
+func (db *memDB) DelNote(target string, t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	list := db.notes[target]
+	for i, n := range list {
+		if n.Time.Equal(t) {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(db.notes, target)
+	} else {
+		db.notes[target] = list
+	}
+	return nil
+}
+
+func (db *memDB) PutWatch(e WatchEntry) error {
+	db.mu.Lock()
+	db.watch[e.Pattern] = e
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *memDB) DelWatch(pattern string) error {
+	db.mu.Lock()
+	delete(db.watch, pattern)
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *memDB) ListWatch() ([]WatchEntry, error) {
+	db.mu.RLock()
+	list := make([]WatchEntry, 0, len(db.watch))
+	for _, e := range db.watch {
+		list = append(list, e)
+	}
+	db.mu.RUnlock()
+	return list, nil
+}
+
+func (db *memDB) PutRoom(r RoomInfo) error {
+	db.mu.Lock()
+	db.rooms[r.Name] = *r.clone()
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *memDB) DelRoom(name string) error {
+	db.mu.Lock()
+	delete(db.rooms, name)
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *memDB) ListRooms() ([]RoomInfo, error) {
+	db.mu.RLock()
+	list := make([]RoomInfo, 0, len(db.rooms))
+	for _, r := range db.rooms {
+		list = append(list, *r.clone())
+	}
+	db.mu.RUnlock()
+	return list, nil
+}
@@ -0,0 +1,314 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PermWatch allows managing the watchlist.
+const PermWatch = "user.watch"
+
+// AuditWatch is recorded in the audit log when the watchlist is changed.
+const AuditWatch = "watch"
+
+// Actions applied to users that match the watchlist.
+const (
+	// WatchAlert only alerts operators about the join.
+	WatchAlert = "alert"
+	// WatchMute shadow-mutes the user: chat messages are only visible to the user and operators.
+	WatchMute = "mute"
+	// WatchPM forwards copies of private messages sent by the user to operators.
+	WatchPM = "pm"
+)
+
+// WatchEntry is an entry of the watchlist.
+type WatchEntry struct {
+	// Pattern is a nick, a CID, an IP or a CIDR range.
+	Pattern string `json:"pattern"`
+	// Action applied to matching users. Zero value means WatchAlert.
+	Action string    `json:"action,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Added  time.Time `json:"added"`
+	By     string    `json:"by,omitempty"`
+}
+
+func (e WatchEntry) String() string {
+	s := e.Pattern + " (" + e.Action
+	if e.By != "" {
+		s += ", by " + e.By
+	}
+	s += ")"
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+type WatchDatabase interface {
+	// PutWatch adds an entry to the watchlist or replaces the entry with the same pattern.
+	PutWatch(e WatchEntry) error
+	// DelWatch removes the entry with a given pattern from the watchlist.
+	DelWatch(pattern string) error
+	// ListWatch returns all entries of the watchlist.
+	ListWatch() ([]WatchEntry, error)
+}
+
+// watchEntry is a parsed entry of the watchlist.
+type watchEntry struct {
+	WatchEntry
+	name string // lowercase
+	cid  CID
+	ipn  *net.IPNet
+}
+
+func (e *watchEntry) match(name string, ip net.IP, cid *CID) bool {
+	switch {
+	case e.ipn != nil:
+		return ip != nil && e.ipn.Contains(ip)
+	case !e.cid.IsZero():
+		return cid != nil && e.cid == *cid
+	default:
+		return e.name == strings.ToLower(name)
+	}
+}
+
+// parseWatch validates the watchlist entry and normalizes the pattern.
+func parseWatch(e WatchEntry) (*watchEntry, error) {
+	e.Pattern = strings.TrimSpace(e.Pattern)
+	switch e.Action {
+	case "":
+		e.Action = WatchAlert
+	case WatchAlert, WatchMute, WatchPM:
+	default:
+		return nil, fmt.Errorf("unsupported watch action: %q", e.Action)
+	}
+	w := &watchEntry{WatchEntry: e}
+	if e.Pattern == "" {
+		return nil, errors.New("watch pattern must be set")
+	} else if _, ipn, err := net.ParseCIDR(e.Pattern); err == nil {
+		w.ipn = ipn
+		w.Pattern = ipn.String()
+	} else if ip := net.ParseIP(e.Pattern); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		w.ipn = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		w.Pattern = ip.String()
+	} else if err := w.cid.FromBase32(e.Pattern); err == nil {
+		w.Pattern = w.cid.String()
+	} else {
+		w.cid = CID{}
+		w.name = strings.ToLower(e.Pattern)
+	}
+	return w, nil
+}
+
+// watchlist is a cache of the watchlist stored in the database.
+type watchlist struct {
+	sync.RWMutex
+	list []*watchEntry
+}
+
+func (h *Hub) loadWatchlist() error {
+	if h.db == nil {
+		return nil
+	}
+	list, err := h.db.ListWatch()
+	if err != nil {
+		return err
+	}
+	var out []*watchEntry
+	for _, e := range list {
+		w, err := parseWatch(e)
+		if err != nil {
+			log.Printf("invalid watchlist entry %q: %v", e.Pattern, err)
+			continue
+		}
+		out = append(out, w)
+	}
+	h.watch.Lock()
+	h.watch.list = out
+	h.watch.Unlock()
+	return nil
+}
+
+// Watchlist returns all entries of the watchlist, sorted by pattern.
+func (h *Hub) Watchlist() []WatchEntry {
+	h.watch.RLock()
+	list := make([]WatchEntry, 0, len(h.watch.list))
+	for _, w := range h.watch.list {
+		list = append(list, w.WatchEntry)
+	}
+	h.watch.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Pattern < list[j].Pattern
+	})
+	return list
+}
+
+// AddWatch adds an entry to the watchlist. It replaces an existing entry with the same pattern.
+func (h *Hub) AddWatch(e WatchEntry) error {
+	if h.db == nil {
+		return errors.New("watchlist requires a database")
+	}
+	if e.Added.IsZero() {
+		e.Added = time.Now().UTC()
+	}
+	w, err := parseWatch(e)
+	if err != nil {
+		return err
+	}
+	h.watch.Lock()
+	defer h.watch.Unlock()
+	if err := h.db.PutWatch(w.WatchEntry); err != nil {
+		return err
+	}
+	for i, w2 := range h.watch.list {
+		if w2.Pattern == w.Pattern {
+			h.watch.list[i] = w
+			return nil
+		}
+	}
+	h.watch.list = append(h.watch.list, w)
+	return nil
+}
+
+// DelWatch removes an entry with a given pattern from the watchlist.
+func (h *Hub) DelWatch(pattern string) error {
+	if h.db == nil {
+		return nil
+	}
+	w, err := parseWatch(WatchEntry{Pattern: pattern})
+	if err != nil {
+		return err
+	}
+	h.watch.Lock()
+	defer h.watch.Unlock()
+	for i, w2 := range h.watch.list {
+		if w2.Pattern == w.Pattern {
+			if err := h.db.DelWatch(w.Pattern); err != nil {
+				return err
+			}
+			h.watch.list = append(h.watch.list[:i:i], h.watch.list[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("not in the watchlist: %q", pattern)
+}
+
+// matchWatch returns the first watchlist entry that matches the peer.
+func (h *Hub) matchWatch(peer Peer) *WatchEntry {
+	var cid *CID
+	if c := peer.CID(); !c.IsZero() {
+		cid = &c
+	}
+	name, ip := peer.Name(), peerIP(peer)
+	h.watch.RLock()
+	defer h.watch.RUnlock()
+	for _, w := range h.watch.list {
+		if w.match(name, ip, cid) {
+			e := w.WatchEntry
+			return &e
+		}
+	}
+	return nil
+}
+
+// watchJoin alerts operators if the peer matches the watchlist and applies the action of the entry.
+// It returns false if the peer is not in the watchlist.
+func (h *Hub) watchJoin(peer Peer) bool {
+	if PeerProtocol(peer) == ProtoBot {
+		return false
+	}
+	e := h.matchWatch(peer)
+	if e == nil {
+		return false
+	}
+	switch e.Action {
+	case WatchMute:
+		peer.base().muted.Set(true)
+	case WatchPM:
+		peer.base().pmToOps.Set(true)
+	}
+	text := fmt.Sprintf("watchlist: %s joined from %s, matches %s", peer.Name(), addrString(peer.RemoteAddr()), e)
+	log.Println(text)
+	h.opChatMsg(text)
+	h.notify(NotifyJoin, peer.Name(), text)
+	return true
+}
+
+// opChatMsg sends a message from the hub bot to the operator chat room.
+// If the room doesn't exist, the message is sent to operators directly.
+func (h *Hub) opChatMsg(text string) {
+	name := DefaultOpChatRoom
+	if h.notifier != nil {
+		name = h.notifier.opChat
+	}
+	if r := h.Room(name); r != nil {
+		r.SendChat(h.hubUser.p, Message{Name: h.hubUser.Name(), Text: text})
+		return
+	}
+	h.sendToOps(text)
+}
+
+// forwardPM sends a copy of the private message to operators, if the sender is watched.
+func (h *Hub) forwardPM(from, to Peer, m Message) {
+	if !from.base().pmToOps.Get() {
+		return
+	}
+	text := fmt.Sprintf("PM from %s to %s: %s", from.Name(), to.Name(), m.Text)
+	for _, p := range h.Peers() {
+		if p != to && p.User().HasPerm(PermBanIP) {
+			_ = p.HubChatMsg(Message{Text: text})
+		}
+	}
+}
+
+func (h *Hub) cmdWatch(p Peer, args string) error {
+	sub, args := cutReason(strings.TrimSpace(args))
+	switch sub {
+	case "add":
+		pattern, rest := cutReason(args)
+		action, reason := cutReason(rest)
+		switch action {
+		case WatchAlert, WatchMute, WatchPM:
+		default:
+			action, reason = "", rest
+		}
+		e := WatchEntry{Pattern: pattern, Action: action, Reason: reason, By: p.Name()}
+		if err := h.AddWatch(e); err != nil {
+			return err
+		}
+		h.audit(AuditWatch, p, pattern, strings.TrimSpace("add "+action+" "+reason))
+		h.cmdOutput(p, "added to the watchlist: "+pattern)
+		return nil
+	case "del", "rm":
+		if err := h.DelWatch(args); err != nil {
+			return err
+		}
+		h.audit(AuditWatch, p, args, "del")
+		h.cmdOutput(p, "removed from the watchlist: "+args)
+		return nil
+	case "", "list", "ls":
+		list := h.Watchlist()
+		if len(list) == 0 {
+			h.cmdOutput(p, "watchlist is empty")
+			return nil
+		}
+		var buf strings.Builder
+		buf.WriteString("watchlist:")
+		for _, e := range list {
+			buf.WriteString("\n" + e.String())
+		}
+		h.cmdOutput(p, buf.String())
+		return nil
+	default:
+		return fmt.Errorf("expected add, del or list, got: %q", sub)
+	}
+}
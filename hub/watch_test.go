@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var casesWatch = []struct {
+	pattern string
+	name    string
+	ip      string
+	exp     bool
+}{
+	{pattern: "Spammer", name: "spammer", ip: "1.2.3.4", exp: true},
+	{pattern: "spammer", name: "other", ip: "1.2.3.4", exp: false},
+	{pattern: "10.0.0.0/8", name: "a", ip: "10.1.2.3", exp: true},
+	{pattern: "10.0.0.0/8", name: "a", ip: "11.1.2.3", exp: false},
+	{pattern: "1.2.3.4", name: "a", ip: "1.2.3.4", exp: true},
+	{pattern: "1.2.3.4", name: "a", ip: "1.2.3.5", exp: false},
+}
+
+func TestWatchMatch(t *testing.T) {
+	for _, c := range casesWatch {
+		t.Run(c.pattern, func(t *testing.T) {
+			w, err := parseWatch(WatchEntry{Pattern: c.pattern})
+			require.NoError(t, err)
+			require.Equal(t, WatchAlert, w.Action)
+			require.Equal(t, c.exp, w.match(c.name, net.ParseIP(c.ip), nil))
+		})
+	}
+	_, err := parseWatch(WatchEntry{Pattern: "a", Action: "ban"})
+	require.Error(t, err)
+}
+
+func TestWatchJoin(t *testing.T) {
+	h, err := NewHub(Config{})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+
+	op := newTestADCPeer(t, h, "op")
+	op.setUser(&User{profile: h.Profile(ProfileNameOperator)})
+	other := newTestADCPeer(t, h, "other")
+
+	require.True(t, h.isCommand(op, "!watch add spammer mute known spammer"))
+	require.Equal(t, []WatchEntry{{
+		Pattern: "spammer", Action: WatchMute, Reason: "known spammer", By: "op",
+		Added: h.Watchlist()[0].Added,
+	}}, h.Watchlist())
+
+	sentADC(op)
+	spammer := newTestADCPeer(t, h, "spammer")
+	require.Contains(t, lastChat(t, op), "watchlist")
+	require.True(t, spammer.muted.Get())
+
+	// messages of a muted user are only visible to the user and operators
+	sentADC(op)
+	sentADC(other)
+	sentADC(spammer)
+	h.globalChat.SendChat(spammer, Message{Text: "buy"})
+	require.Empty(t, sentADC(other))
+	require.NotEmpty(t, sentADC(op))
+	require.NotEmpty(t, sentADC(spammer))
+
+	require.True(t, h.isCommand(op, "!watch del spammer"))
+	require.Empty(t, h.Watchlist())
+	require.True(t, h.isCommand(op, "!watch del spammer"))
+	require.Contains(t, lastChat(t, op), "error")
+
+	// the watchlist is loaded from the database
+	require.NoError(t, h.AddWatch(WatchEntry{Pattern: "10.0.0.0/8", Action: WatchPM}))
+	h.watch.list = nil
+	require.NoError(t, h.loadWatchlist())
+	require.Len(t, h.Watchlist(), 1)
+}
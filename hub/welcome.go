@@ -0,0 +1,175 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// ProfileMOTD is a profile key for a message of the day sent to users of this profile
+	// instead of the hub's MOTD.
+	ProfileMOTD = "motd"
+	// FlagSkipRules allows users of the profile to join without accepting the rules.
+	FlagSkipRules = "rules.skip"
+)
+
+const (
+	// DefaultRulesTimeout is the default time given to users to accept the rules.
+	DefaultRulesTimeout = 5 * time.Minute
+	// DefaultRulesCommand is the default command to accept the rules.
+	DefaultRulesCommand = "accept"
+)
+
+var errRulesNotAccepted = errors.New("please accept the rules first")
+
+// WelcomeConfig configures the messages sent to users when they join the hub.
+type WelcomeConfig struct {
+	// Rules of the hub. If set, users must accept the rules with a command before
+	// they can chat or search.
+	Rules string
+	// AcceptTimeout is the time given to accept the rules. Users that don't accept
+	// the rules in time are disconnected. Zero value means DefaultRulesTimeout.
+	AcceptTimeout time.Duration
+	// AcceptCommand is the name of the command to accept the rules.
+	// Zero value means DefaultRulesCommand.
+	AcceptCommand string
+}
+
+func (c WelcomeConfig) timeout() time.Duration {
+	if c.AcceptTimeout <= 0 {
+		return DefaultRulesTimeout
+	}
+	return c.AcceptTimeout
+}
+
+func (c WelcomeConfig) command() string {
+	if c.AcceptCommand == "" {
+		return DefaultRulesCommand
+	}
+	return c.AcceptCommand
+}
+
+func (h *Hub) getRules() string {
+	h.conf.RLock()
+	rules := h.conf.Welcome.Rules
+	h.conf.RUnlock()
+	return rules
+}
+
+func (h *Hub) setRules(rules string) {
+	h.conf.Lock()
+	h.conf.Welcome.Rules = rules
+	h.conf.Unlock()
+}
+
+// motdFor returns the message of the day for the peer, taking its profile into account.
+func (h *Hub) motdFor(peer Peer) string {
+	if motd := peer.User().Profile().GetString(ProfileMOTD); motd != "" {
+		return motd
+	}
+	return h.getMOTD()
+}
+
+// sendWelcome sends the message of the day to the peer that joined the hub.
+// If the hub has rules, they are sent as well, and the peer cannot chat or search
+// until it accepts them.
+func (h *Hub) sendWelcome(peer Peer) error {
+	if err := peer.HubChatMsg(Message{Text: h.motdFor(peer)}); err != nil {
+		return err
+	}
+	rules := h.getRules()
+	if rules == "" || !h.needsRules(peer) {
+		return nil
+	}
+	h.conf.RLock()
+	conf := h.conf.Welcome
+	h.conf.RUnlock()
+
+	b := peer.base()
+	b.rules.Lock()
+	b.rules.timer = time.AfterFunc(conf.timeout(), func() {
+		if !h.rulesPending(peer) {
+			return
+		}
+		log.Printf("%s: rules were not accepted: %s", peer.RemoteAddr(), peer.Name())
+		_ = peer.HubChatMsg(Message{Text: h.text(peer, TextRulesTimeout, nil)})
+		_ = peer.Close()
+	})
+	b.rules.Unlock()
+
+	return peer.HubChatMsg(Message{Text: h.text(peer, TextRulesAccept, textArgs{
+		"Rules":   rules,
+		"Command": conf.command(),
+		"Timeout": conf.timeout(),
+	})})
+}
+
+// needsRules checks if the peer must accept the rules.
+func (h *Hub) needsRules(peer Peer) bool {
+	u := peer.User()
+	if u.IsOwner() || u.Has(FlagSkipRules) {
+		return false
+	}
+	if !u.IsRegistered() {
+		return true
+	}
+	_, rec, err := h.getUser(peer.Name())
+	if err != nil {
+		h.hubError("cannot check rules acceptance: %v", err)
+		return true
+	}
+	return rec == nil || rec.RulesAccepted.IsZero()
+}
+
+// rulesPending checks if the peer still has to accept the rules.
+func (h *Hub) rulesPending(peer Peer) bool {
+	b := peer.base()
+	b.rules.Lock()
+	defer b.rules.Unlock()
+	return b.rules.timer != nil
+}
+
+// checkRules returns an error if the peer is not allowed to chat or search yet.
+func (h *Hub) checkRules(peer Peer) error {
+	if h.rulesPending(peer) {
+		return errRulesNotAccepted
+	}
+	return nil
+}
+
+// stopRules cancels the rules timer. It returns false if the peer had no rules to accept.
+func (p *BasePeer) stopRules() bool {
+	p.rules.Lock()
+	defer p.rules.Unlock()
+	if p.rules.timer == nil {
+		return false
+	}
+	p.rules.timer.Stop()
+	p.rules.timer = nil
+	return true
+}
+
+func (h *Hub) cmdAcceptRules(p Peer, args string) error {
+	if strings.TrimSpace(args) != "" {
+		// room invitations are accepted with the same command
+		return h.cmdAccept(p, args)
+	}
+	if !p.base().stopRules() {
+		h.cmdOutput(p, h.text(p, TextRulesNone, nil))
+		return nil
+	}
+	if p.User().IsRegistered() {
+		// remember the acceptance for registered users
+		err := h.UpdateUser(p.Name(), func(u *UserRecord) (bool, error) {
+			u.RulesAccepted = time.Now().UTC()
+			return true, nil
+		})
+		if err != nil {
+			h.hubError("cannot save rules acceptance: %v", err)
+		}
+	}
+	h.cmdOutput(p, h.text(p, TextRulesAccepted, nil))
+	return nil
+}
@@ -0,0 +1,100 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWelcomeRules(t *testing.T) {
+	h, err := NewHub(Config{
+		Welcome: WelcomeConfig{Rules: "be nice"},
+	})
+	require.NoError(t, err)
+
+	p := newTestADCPeer(t, h, "peer")
+	sentADC(p)
+
+	require.NoError(t, h.sendWelcome(p))
+	require.Len(t, sentADC(p), 2) // MOTD and rules
+	require.True(t, h.rulesPending(p))
+	require.Equal(t, errRulesNotAccepted, h.checkRules(p))
+
+	require.True(t, h.isCommand(p, "!"+DefaultRulesCommand))
+	require.False(t, h.rulesPending(p))
+	require.NoError(t, h.checkRules(p))
+	sentADC(p)
+
+	require.True(t, h.isCommand(p, "!"+DefaultRulesCommand))
+	require.Len(t, sentADC(p), 1) // nothing to accept
+}
+
+func TestWelcomeRulesTimeout(t *testing.T) {
+	h, err := NewHub(Config{
+		Welcome: WelcomeConfig{Rules: "be nice", AcceptTimeout: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	p := newTestADCPeer(t, h, "peer")
+	require.NoError(t, h.sendWelcome(p))
+	for i := 0; i < 100 && p.Online(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.False(t, p.Online())
+}
+
+func TestWelcomeRegistered(t *testing.T) {
+	h, err := NewHub(Config{
+		Welcome: WelcomeConfig{Rules: "be nice"},
+	})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.db.CreateUser(UserRecord{Name: "reg", Profile: ProfileNameRegistered}))
+
+	login := func() *adcPeer {
+		p := newTestADCPeer(t, h, "reg")
+		u, _, err := h.getUser("reg")
+		require.NoError(t, err)
+		p.setUser(u)
+		return p
+	}
+
+	p := login()
+	require.NoError(t, h.sendWelcome(p))
+	require.True(t, h.rulesPending(p))
+	require.True(t, h.isCommand(p, "!"+DefaultRulesCommand))
+
+	rec, err := h.db.GetUser("reg")
+	require.NoError(t, err)
+	require.False(t, rec.RulesAccepted.IsZero())
+	_ = p.Close()
+
+	// the acceptance is remembered for the next login
+	p = login()
+	require.NoError(t, h.sendWelcome(p))
+	require.False(t, h.rulesPending(p))
+}
+
+func TestWelcomeProfile(t *testing.T) {
+	h, err := NewHub(Config{
+		Welcome: WelcomeConfig{Rules: "be nice"},
+	})
+	require.NoError(t, err)
+	h.SetDatabase(NewDatabase())
+	require.NoError(t, h.loadProfiles())
+	require.NoError(t, h.db.CreateUser(UserRecord{Name: "op", Profile: ProfileNameOperator}))
+
+	p := newTestADCPeer(t, h, "op")
+	u, _, err := h.getUser("op")
+	require.NoError(t, err)
+	u.profile.m[ProfileMOTD] = "hello, op"
+	p.setUser(u)
+	sentADC(p)
+
+	require.Equal(t, "hello, op", h.motdFor(p))
+	require.NoError(t, h.sendWelcome(p))
+	require.Len(t, sentADC(p), 1) // MOTD only
+	require.False(t, h.rulesPending(p))
+}
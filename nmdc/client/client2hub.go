@@ -31,6 +31,19 @@ func DialHub(addr string, info *Config) (*Conn, error) {
 type Config struct {
 	Name string
 	Ext  []string
+	// Encoding is a text encoding used by the hub, for example "cp1251".
+	// If not set, UTF-8 is used, with a fallback to nmdc.DefaultFallbackEncoding.
+	Encoding string
+	// HandshakeTimeout is the time allowed for a single handshake step.
+	// Zero value means the default of 5 seconds.
+	HandshakeTimeout time.Duration
+}
+
+func (c *Config) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return c.HandshakeTimeout
 }
 
 func (c *Config) validate() error {
@@ -45,6 +58,12 @@ func HubHandshake(conn *nmdc.Conn, conf *Config) (*Conn, error) {
 	if err := conf.validate(); err != nil {
 		return nil, err
 	}
+	enc, err := nmdc.ParseEncoding(conf.Encoding)
+	if err != nil {
+		return nil, err
+	} else if enc != nil {
+		conn.SetEncoding(enc)
+	}
 	mutual, hub, err := hubHanshake(conn, conf)
 	if err != nil {
 		conn.Close()
@@ -69,7 +88,8 @@ func HubHandshake(conn *nmdc.Conn, conf *Config) (*Conn, error) {
 }
 
 func hubHanshake(conn *nmdc.Conn, conf *Config) (nmdcp.Extensions, *HubInfo, error) {
-	deadline := time.Now().Add(time.Second * 5)
+	timeout := conf.handshakeTimeout()
+	deadline := time.Now().Add(timeout)
 
 	ext := []string{
 		nmdcp.ExtNoHello,
@@ -81,7 +101,7 @@ func hubHanshake(conn *nmdc.Conn, conf *Config) (nmdcp.Extensions, *HubInfo, err
 	if err != nil {
 		return nil, nil, err
 	}
-	deadline = deadline.Add(time.Second * 5)
+	deadline = deadline.Add(timeout)
 
 	our := make(nmdcp.Extensions)
 	for _, e := range ext {
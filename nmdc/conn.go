@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -15,6 +16,7 @@ import (
 	"golang.org/x/text/encoding"
 
 	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dcpp/trace"
 )
 
 var (
@@ -81,6 +83,8 @@ func NewConn(conn net.Conn) (*Conn, error) {
 		conn: conn,
 	}
 	c.w = nmdc.NewWriterSize(conn, writeBuffer)
+	// should run before any other line hooks
+	c.w.OnLine(c.applyWriteHooks)
 	c.r = nmdc.NewReader(conn)
 	c.r.OnUnknownEncoding = c.onUnknownEncoding
 	if DefaultFallbackEncoding != nil {
@@ -117,12 +121,72 @@ type Conn struct {
 
 	w *nmdc.Writer
 	r *nmdc.Reader
+
+	// hooks that can modify raw protocol lines
+	hooks struct {
+		w      []trace.Hook
+		inject bool // writing a line modified by hooks
+	}
 }
 
 func (c *Conn) OnUnmarshalError(fnc func(line []byte, err error) (bool, error)) {
 	c.r.OnUnmarshalError = fnc
 }
 
+// OnLineRead registers a hook that is called for each NMDC message read from the connection.
+// The hook may drop the message, or modify it in place. Changing the length of the message
+// is not supported and results in an error.
+//
+// This method is not concurrent-safe and should be called before reading from the connection.
+func (c *Conn) OnLineRead(fnc trace.Hook) {
+	c.r.OnLine(func(line []byte) (bool, error) {
+		out, err := fnc(line)
+		if err != nil {
+			return false, err
+		} else if out == nil {
+			return false, nil
+		} else if len(out) != len(line) {
+			return false, errors.New("nmdc: read hook cannot change the message length")
+		}
+		copy(line, out)
+		return true, nil
+	})
+}
+
+// OnLineWrite registers a hook that is called for each NMDC message written to the connection.
+// The hook may modify or drop the message.
+//
+// This method is not concurrent-safe and should be called before writing to the connection.
+func (c *Conn) OnLineWrite(fnc trace.Hook) {
+	c.hooks.w = append(c.hooks.w, fnc)
+}
+
+// applyWriteHooks runs hooks registered with OnLineWrite. It is called before other line hooks of the writer,
+// thus if the line is modified, the original one is dropped and the new one passes other hooks only once.
+func (c *Conn) applyWriteHooks(line []byte) (bool, error) {
+	if len(c.hooks.w) == 0 || c.hooks.inject {
+		return true, nil
+	}
+	out, err := trace.Apply(c.hooks.w, line)
+	if err != nil {
+		return false, err
+	} else if out == nil {
+		return false, nil
+	} else if bytes.Equal(out, line) {
+		return true, nil
+	}
+	c.hooks.inject = true
+	err = c.w.WriteLine(out)
+	c.hooks.inject = false
+	return false, err
+}
+
+// Trace registers read and write hooks of the tracer.
+func (c *Conn) Trace(t trace.Tracer) {
+	c.OnLineRead(t.LineRead)
+	c.OnLineWrite(t.LineWrite)
+}
+
 func (c *Conn) OnLineR(fnc func(line []byte) (bool, error)) {
 	c.r.OnLine(fnc)
 }
@@ -182,9 +246,7 @@ func (c *Conn) TextDecoder() *encoding.Decoder {
 
 func (c *Conn) setEncoding(enc encoding.Encoding, event bool) {
 	if enc != nil {
-		e := enc.NewEncoder()
-		e = encoding.HTMLEscapeUnsupported(e)
-		c.w.SetEncoder(e)
+		c.w.SetEncoder(newTextEncoder(enc))
 		if !event {
 			c.r.SetDecoder(enc.NewDecoder())
 		}
@@ -0,0 +1,51 @@
+package nmdc
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dcpp/trace"
+)
+
+func TestConnTrace(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	w, err := NewConn(c1)
+	require.NoError(t, err)
+	r, err := NewConn(c2)
+	require.NoError(t, err)
+
+	var lines []string
+	w.OnLineW(func(line []byte) (bool, error) {
+		lines = append(lines, string(line))
+		return true, nil
+	})
+	logs := bytes.NewBuffer(nil)
+	w.Trace(trace.NewLineLogger(logs, "test "))
+	w.OnLineWrite(func(line []byte) ([]byte, error) {
+		if bytes.Contains(line, []byte("drop")) {
+			return nil, nil
+		}
+		return bytes.Replace(line, []byte("hello"), []byte("hello world"), -1), nil
+	})
+
+	go func() {
+		_ = w.WriteMsg(&nmdc.ChatMessage{Text: "drop"})
+		_ = w.WriteMsg(&nmdc.ChatMessage{Text: "hello"})
+		_ = w.Flush()
+	}()
+	m, err := r.ReadMsg(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, &nmdc.ChatMessage{Text: "hello world"}, m)
+	require.Equal(t, 2, strings.Count(logs.String(), "test ->"))
+	// other hooks only see the modified line, and only once
+	require.Equal(t, []string{"hello world|"}, lines)
+}
@@ -0,0 +1,86 @@
+package nmdc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// ParseEncoding finds a text encoding by name, for example "cp1251" or "windows-1252".
+//
+// It returns nil for UTF-8, since NMDC connections use it by default and need no transcoding.
+// An empty name is treated as UTF-8 as well.
+func ParseEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "utf8", "utf-8":
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding %q: %v", name, err)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// EncodingName returns a canonical name of the encoding returned by ParseEncoding.
+func EncodingName(enc encoding.Encoding) string {
+	if enc == nil {
+		return "utf-8"
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return fmt.Sprint(enc)
+	}
+	return name
+}
+
+// newTextEncoder returns an encoder for a given encoding that never fails.
+//
+// Characters that cannot be represented in a single-byte encoding are replaced with '?'.
+// Escaping them as HTML entities does not work well for NMDC, since '&' is escaped again
+// by the protocol. Other encodings fallback to HTML escaping.
+func newTextEncoder(enc encoding.Encoding) *encoding.Encoder {
+	if cm, ok := enc.(*charmap.Charmap); ok {
+		return &encoding.Encoder{Transformer: charmapEncoder{cm: cm}}
+	}
+	return encoding.HTMLEscapeUnsupported(enc.NewEncoder())
+}
+
+// charmapEncoder is a stateless transformer that encodes UTF-8 text to a single-byte encoding.
+// Unlike transformers returned by charmap package, it replaces unsupported characters with '?'.
+type charmapEncoder struct {
+	transform.NopResetter
+	cm *charmap.Charmap
+}
+
+func (e charmapEncoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		r, size := rune(src[nSrc]), 1
+		if r >= utf8.RuneSelf {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r, size = utf8.DecodeRune(src[nSrc:])
+		}
+		b, ok := e.cm.EncodeRune(r)
+		if !ok || (r == utf8.RuneError && size == 1) {
+			b = '?'
+		}
+		dst[nDst] = b
+		nDst++
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,57 @@
+package nmdc
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestParseEncoding(t *testing.T) {
+	for _, name := range []string{"", "utf8", "UTF-8"} {
+		enc, err := ParseEncoding(name)
+		require.NoError(t, err)
+		require.Nil(t, enc, name)
+		require.Equal(t, "utf-8", EncodingName(enc))
+	}
+	for _, name := range []string{"cp1251", "CP1251", "windows-1251"} {
+		enc, err := ParseEncoding(name)
+		require.NoError(t, err)
+		require.Equal(t, charmap.Windows1251, enc, name)
+		require.Equal(t, "windows-1251", EncodingName(enc))
+	}
+	_, err := ParseEncoding("unknown")
+	require.Error(t, err)
+}
+
+func TestConnEncoding(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	c, err := NewConn(c1)
+	require.NoError(t, err)
+	c.SetEncoding(charmap.Windows1251)
+
+	r := bufio.NewReader(c2)
+	go func() {
+		// characters that cannot be encoded are replaced with '?'
+		_ = c.WriteOneMsg(&nmdc.ChatMessage{Name: "Юзер", Text: "привет 日"})
+	}()
+	line, err := r.ReadString('|')
+	require.NoError(t, err)
+	exp, err := charmap.Windows1251.NewEncoder().String("<Юзер> привет ?|")
+	require.NoError(t, err)
+	require.Equal(t, exp, line)
+
+	go func() {
+		_, _ = c2.Write([]byte(exp))
+	}()
+	msg, err := c.ReadMsg(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, &nmdc.ChatMessage{Name: "Юзер", Text: "привет ?"}, msg)
+}
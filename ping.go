@@ -56,10 +56,7 @@ func Ping(ctx context.Context, addr string, conf *PingConfig) (*HubInfo, error)
 		})
 		if err == nmdc.ErrRegisteredOnly {
 			// TODO: should support error code in NMDC
-			err = adc.Error{Status: adc.Status{
-				Sev: adc.Fatal, Code: 26,
-				Msg: err.Error(),
-			}}
+			err = adc.ErrRegisteredOnly(err.Error())
 		}
 		if err != nil && hub == nil {
 			return nil, err
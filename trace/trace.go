@@ -0,0 +1,81 @@
+// Package trace provides hooks for tracing raw protocol lines of ADC and NMDC connections.
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Hook is called for each raw protocol line, including the delimiter.
+//
+// It returns the line that should be used instead of the original one, or nil to drop the line.
+// Returning the same slice leaves the line unchanged. The hook must not retain the line.
+type Hook func(line []byte) ([]byte, error)
+
+// Tracer observes, mirrors or mutates raw protocol lines in both directions.
+type Tracer interface {
+	// LineRead is called for each line read from the connection.
+	LineRead(line []byte) ([]byte, error)
+	// LineWrite is called for each line written to the connection.
+	LineWrite(line []byte) ([]byte, error)
+}
+
+var _ Tracer = (*Logger)(nil)
+
+// Logger is a Tracer that logs all protocol lines to a writer.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	hex    bool
+}
+
+// NewLineLogger returns a Tracer that writes each protocol line as a quoted string.
+func NewLineLogger(w io.Writer, prefix string) *Logger {
+	return &Logger{w: w, prefix: prefix}
+}
+
+// NewHexLogger returns a Tracer that writes a hex dump of each protocol line.
+func NewHexLogger(w io.Writer, prefix string) *Logger {
+	return &Logger{w: w, prefix: prefix, hex: true}
+}
+
+func (l *Logger) log(dir string, line []byte) {
+	ts := time.Now().Format("15:04:05.000")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.hex {
+		fmt.Fprintf(l.w, "%s %s%s %q\n", ts, l.prefix, dir, line)
+		return
+	}
+	fmt.Fprintf(l.w, "%s %s%s %d bytes\n%s", ts, l.prefix, dir, len(line), hex.Dump(line))
+}
+
+// LineRead implements Tracer.
+func (l *Logger) LineRead(line []byte) ([]byte, error) {
+	l.log("<-", line)
+	return line, nil
+}
+
+// LineWrite implements Tracer.
+func (l *Logger) LineWrite(line []byte) ([]byte, error) {
+	l.log("->", line)
+	return line, nil
+}
+
+// Apply runs all the hooks on the line. It returns nil if one of the hooks dropped the line.
+func Apply(hooks []Hook, line []byte) ([]byte, error) {
+	for _, h := range hooks {
+		var err error
+		line, err = h(line)
+		if err != nil {
+			return nil, err
+		} else if line == nil {
+			return nil, nil
+		}
+	}
+	return line, nil
+}